@@ -0,0 +1,139 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// BulkOperations is a set of item operations, on any partition keys, to be executed with ContainerClient.ExecuteBulk.
+// Unlike a TransactionalBatch, the operations are not executed as a single transaction: each operation succeeds
+// or fails on its own.
+type BulkOperations struct {
+	operations []bulkOperation
+}
+
+// bulkOperation is an operation of a BulkOperations, with the partition key it targets.
+type bulkOperation struct {
+	partitionKey PartitionKey
+	operation    batchOperation
+}
+
+// CreateItem adds a create operation.
+func (b *BulkOperations) CreateItem(partitionKey PartitionKey, item []byte, o *BulkItemOptions) {
+	b.add(partitionKey,
+		batchOperationCreate{
+			operationType: "Create",
+			resourceBody:  item})
+}
+
+// DeleteItem adds a delete operation.
+func (b *BulkOperations) DeleteItem(partitionKey PartitionKey, itemID string, o *BulkItemOptions) {
+	if o == nil {
+		o = &BulkItemOptions{}
+	}
+	b.add(partitionKey,
+		batchOperationDelete{
+			operationType: "Delete",
+			id:            itemID,
+			ifMatch:       o.IfMatchETag})
+}
+
+// ReplaceItem adds a replace operation.
+func (b *BulkOperations) ReplaceItem(partitionKey PartitionKey, itemID string, item []byte, o *BulkItemOptions) {
+	if o == nil {
+		o = &BulkItemOptions{}
+	}
+	b.add(partitionKey,
+		batchOperationReplace{
+			operationType: "Replace",
+			id:            itemID,
+			resourceBody:  item,
+			ifMatch:       o.IfMatchETag})
+}
+
+// UpsertItem adds an upsert operation.
+func (b *BulkOperations) UpsertItem(partitionKey PartitionKey, item []byte, o *BulkItemOptions) {
+	if o == nil {
+		o = &BulkItemOptions{}
+	}
+	b.add(partitionKey,
+		batchOperationUpsert{
+			operationType: "Upsert",
+			resourceBody:  item,
+			ifMatch:       o.IfMatchETag})
+}
+
+// ReadItem adds a read operation.
+func (b *BulkOperations) ReadItem(partitionKey PartitionKey, itemID string, o *BulkItemOptions) {
+	b.add(partitionKey,
+		batchOperationRead{
+			operationType: "Read",
+			id:            itemID})
+}
+
+// PatchItem adds a patch operation.
+func (b *BulkOperations) PatchItem(partitionKey PartitionKey, itemID string, p PatchOperations, o *BulkItemOptions) {
+	if o == nil {
+		o = &BulkItemOptions{}
+	}
+	b.add(partitionKey,
+		batchOperationPatch{
+			operationType:   "Patch",
+			id:              itemID,
+			patchOperations: p,
+			ifMatch:         o.IfMatchETag,
+		})
+}
+
+// Len returns the number of operations.
+func (b *BulkOperations) Len() int {
+	return len(b.operations)
+}
+
+func (b *BulkOperations) add(partitionKey PartitionKey, operation batchOperation) {
+	b.operations = append(b.operations, bulkOperation{partitionKey: partitionKey, operation: operation})
+}
+
+// marshalBulkOperation returns the JSON of an operation in a bulk request. It's the JSON of the operation in a
+// transactional batch, with the operation's partition key, since the operations of a bulk request can have
+// different partition keys.
+func marshalBulkOperation(op bulkOperation) (json.RawMessage, error) {
+	body, err := json.Marshal(op.operation)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := op.partitionKey.toJsonString()
+	if err != nil {
+		return nil, err
+	}
+	pkJSON, err := json.Marshal(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBufferString("{\"partitionKey\":")
+	buffer.Write(pkJSON)
+	buffer.WriteString(",")
+	buffer.Write(body[1:])
+	return buffer.Bytes(), nil
+}
+
+// marshaledBulkOperation is an operation whose JSON was computed before the operation is added to a request, to
+// limit the size of the requests.
+type marshaledBulkOperation struct {
+	operationType operationType
+	body          json.RawMessage
+}
+
+func (b marshaledBulkOperation) getOperationType() operationType {
+	return b.operationType
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (b marshaledBulkOperation) MarshalJSON() ([]byte, error) {
+	return b.body, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// BulkOptions includes options for bulk operations.
+type BulkOptions struct {
+	// When EnableContentResponseOnWrite is false, the operation results will have no body, except for Read operations.
+	// The default is false.
+	EnableContentResponseOnWrite bool
+	// MaxConcurrencyPerPartitionKeyRange is the maximum number of requests sent at the same time to each partition key range.
+	// Requests to a partition key range start with one request at a time, and increase up to this number
+	// while the partition key range doesn't throttle them. The default is 5.
+	MaxConcurrencyPerPartitionKeyRange *int32
+	// PriorityLevel overrides the client-level default priority for this operation.
+	// Valid values are PriorityLevelHigh and PriorityLevelLow.
+	PriorityLevel *PriorityLevel
+	// ThroughputBucket overrides the client-level default throughput bucket for this operation.
+	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
+	// The valid range is 1 to 5 (inclusive).
+	ThroughputBucket *int32
+	// ThroughputControlGroupName selects the throughput control group of the operation, instead of the default group of the container.
+	// See ClientOptions.ThroughputControlGroups.
+	ThroughputControlGroupName *string
+}
+
+// BulkItemOptions includes options for the specific operation inside a BulkOperations.
+type BulkItemOptions struct {
+	// IfMatchETag is used to ensure optimistic concurrency control.
+	// https://docs.microsoft.com/azure/cosmos-db/sql/database-transactions-optimistic-concurrency#optimistic-concurrency-control
+	IfMatchETag *azcore.ETag
+}
+
+func (options *BulkOptions) toHeaders() *map[string]string {
+	headers := make(map[string]string, 3)
+
+	headers[cosmosHeaderIsBatchRequest] = "True"
+	headers[cosmosHeaderIsBatchAtomic] = "False"
+	headers[cosmosHeaderBatchContinueOnError] = "True"
+
+	return &headers
+}
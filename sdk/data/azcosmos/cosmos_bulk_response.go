@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// BulkResponse contains the results of bulk operations.
+type BulkResponse struct {
+	// RequestCharge contains the total request charge of all the requests sent to execute the operations,
+	// including requests that were throttled.
+	RequestCharge float32
+	// OperationResults contains the individual operation results.
+	// The order of the results is the same as the order of the operations.
+	OperationResults []BulkOperationResult
+	// Success indicates if all the operations succeeded.
+	// If false, inspect the StatusCode of the OperationResults to find the operations that failed.
+	Success bool
+}
+
+// BulkOperationResult represents the result of a single bulk operation.
+type BulkOperationResult struct {
+	// StatusCode contains the status code of the operation.
+	// If the operation was still throttled after being retried, the status code is http.StatusTooManyRequests.
+	StatusCode int32
+	// RequestCharge contains the request charge for the operation.
+	RequestCharge float32
+	// ResourceBody contains the body response of the operation.
+	// This property is available depending on the EnableContentResponseOnWrite option.
+	ResourceBody []byte
+	// ETag contains the ETag of the operation.
+	ETag azcore.ETag
+}
+
+// bulkOperationResponse is the result of an operation in a bulk request, with the values needed to retry it.
+type bulkOperationResponse struct {
+	result     BulkOperationResult
+	subStatus  string
+	retryAfter time.Duration
+}
+
+func newBulkOperationResponses(resp *http.Response) ([]bulkOperationResponse, error) {
+	var raw []json.RawMessage
+	if err := runtime.UnmarshalAsJSON(resp, &raw); err != nil {
+		return nil, wrapResponseError(err, newResponse(resp))
+	}
+
+	responses := make([]bulkOperationResponse, len(raw))
+	for i, r := range raw {
+		var result TransactionalBatchResult
+		if err := json.Unmarshal(r, &result); err != nil {
+			return nil, err
+		}
+
+		var retry struct {
+			SubStatusCode          int32   `json:"subStatusCode"`
+			RetryAfterMilliseconds float64 `json:"retryAfterMilliseconds"`
+		}
+		if err := json.Unmarshal(r, &retry); err != nil {
+			return nil, err
+		}
+
+		responses[i] = bulkOperationResponse{
+			result: BulkOperationResult{
+				StatusCode:    result.StatusCode,
+				RequestCharge: result.RequestCharge,
+				ResourceBody:  result.ResourceBody,
+				ETag:          result.ETag,
+			},
+			retryAfter: time.Duration(retry.RetryAfterMilliseconds * float64(time.Millisecond)),
+		}
+		if retry.SubStatusCode != 0 {
+			responses[i].subStatus = strconv.Itoa(int(retry.SubStatusCode))
+		}
+	}
+	return responses, nil
+}
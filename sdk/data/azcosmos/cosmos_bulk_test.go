@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkOperations(t *testing.T) {
+	bulk := BulkOperations{}
+	etag := azcore.ETag("someETag")
+	patch := PatchOperations{}
+	patch.AppendSet("/foo", "bar")
+
+	bulk.CreateItem(NewPartitionKeyString("a"), []byte(`{"id":"1"}`), nil)
+	bulk.UpsertItem(NewPartitionKeyString("b"), []byte(`{"id":"2"}`), &BulkItemOptions{IfMatchETag: &etag})
+	bulk.ReplaceItem(NewPartitionKeyString("c"), "3", []byte(`{"id":"3"}`), nil)
+	bulk.DeleteItem(NewPartitionKeyNumber(4), "4", &BulkItemOptions{IfMatchETag: &etag})
+	bulk.ReadItem(NewPartitionKeyString("e").AppendBool(true), "5", nil)
+	bulk.PatchItem(NewPartitionKeyString("f"), "6", patch, nil)
+
+	require.Equal(t, 6, bulk.Len())
+
+	expected := []string{
+		`{"partitionKey":"[\"a\"]","operationType":"Create","resourceBody":{"id":"1"}}`,
+		`{"partitionKey":"[\"b\"]","operationType":"Upsert","ifMatch":"someETag","resourceBody":{"id":"2"}}`,
+		`{"partitionKey":"[\"c\"]","operationType":"Replace","id":"3","resourceBody":{"id":"3"}}`,
+		`{"partitionKey":"[4]","operationType":"Delete","id":"4","ifMatch":"someETag"}`,
+		`{"partitionKey":"[\"e\",true]","operationType":"Read","id":"5"}`,
+		`{"partitionKey":"[\"f\"]","operationType":"Patch","id":"6","resourceBody":{"operations":[{"op":"set","path":"/foo","value":"bar"}]}}`,
+	}
+	for i, op := range bulk.operations {
+		body, err := marshalBulkOperation(op)
+		require.NoError(t, err)
+		require.JSONEq(t, expected[i], string(body))
+		require.True(t, json.Valid(body))
+	}
+}
+
+func TestBulkOptionsToHeaders(t *testing.T) {
+	options := &BulkOptions{}
+	header := options.toHeaders()
+	require.Equal(t, "True", (*header)[cosmosHeaderIsBatchRequest])
+	require.Equal(t, "False", (*header)[cosmosHeaderIsBatchAtomic])
+	require.Equal(t, "True", (*header)[cosmosHeaderBatchContinueOnError])
+	require.NotContains(t, *header, cosmosHeaderIsBatchOrdered)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeFeedEstimatorOptions are the options for ContainerClient.NewChangeFeedEstimator.
+type ChangeFeedEstimatorOptions struct {
+	// StartFrom must be the same as the processor's ChangeFeedProcessorOptions.StartFrom, so that the lag of leases
+	// that have no checkpoint is estimated from the same point.
+	StartFrom *time.Time
+}
+
+// ChangeFeedEstimator estimates how far the instances of a ChangeFeedProcessor are behind the container's changes.
+type ChangeFeedEstimator struct {
+	container  changeFeedReader
+	leaseStore ChangeFeedLeaseStore
+	startFrom  *time.Time
+}
+
+// ChangeFeedLag is the estimated lag of a lease.
+type ChangeFeedLag struct {
+	// LeaseID is the ID of the lease.
+	LeaseID string
+	// FeedRange is the feed range of the lease.
+	FeedRange FeedRange
+	// Owner is the instance name of the processor that owns the lease, or empty if the lease isn't owned.
+	Owner string
+	// EstimatedLag is the estimated number of changes of the lease's feed range that weren't processed yet.
+	EstimatedLag int64
+}
+
+// NewChangeFeedEstimator creates a ChangeFeedEstimator for the processor whose leases are in leaseStore.
+// leaseStore - The store of the processor's leases.
+// o - Options for the estimator.
+func (c *ContainerClient) NewChangeFeedEstimator(leaseStore ChangeFeedLeaseStore, o *ChangeFeedEstimatorOptions) *ChangeFeedEstimator {
+	return newChangeFeedEstimator(c, leaseStore, o)
+}
+
+func newChangeFeedEstimator(container changeFeedReader, leaseStore ChangeFeedLeaseStore, o *ChangeFeedEstimatorOptions) *ChangeFeedEstimator {
+	e := &ChangeFeedEstimator{container: container, leaseStore: leaseStore}
+	if o != nil {
+		e.startFrom = o.StartFrom
+	}
+	return e
+}
+
+// GetEstimatedLag returns the estimated lag of each lease.
+//
+// The lag of a range is the difference between the range's latest logical sequence number (LSN) and the LSN of
+// the first change that wasn't processed. It's an estimate: an item that was changed several times is only in
+// the change feed once.
+func (e *ChangeFeedEstimator) GetEstimatedLag(ctx context.Context) ([]ChangeFeedLag, error) {
+	leases, err := e.leaseStore.ListLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]ChangeFeedLag, 0, len(leases))
+	for _, lease := range leases {
+		lag, err := e.estimateLease(ctx, lease)
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, ChangeFeedLag{
+			LeaseID:      lease.ID,
+			FeedRange:    lease.FeedRange,
+			Owner:        lease.Owner,
+			EstimatedLag: lag,
+		})
+	}
+	return lags, nil
+}
+
+// estimateLease estimates the lag of each range of the lease's continuation token, and returns their sum.
+func (e *ChangeFeedEstimator) estimateLease(ctx context.Context, lease ChangeFeedLease) (int64, error) {
+	if lease.ContinuationToken == "" {
+		feedRange := lease.FeedRange
+		return e.estimate(ctx, &ChangeFeedOptions{FeedRange: &feedRange, StartFrom: e.startFrom, MaxItemCount: 1})
+	}
+
+	var token compositeContinuationToken
+	if err := json.Unmarshal([]byte(lease.ContinuationToken), &token); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal the continuation token of change feed lease %s: %w", lease.ID, err)
+	}
+
+	// ReadChangeFeed stops at the first range that has changes, so each range is read on its own.
+	var total int64
+	for _, r := range token.Continuation {
+		rangeToken := newCompositeContinuationToken(token.ResourceID, []changeFeedRange{r})
+		serialized, err := serializeCompositeContinuationToken(&rangeToken)
+		if err != nil {
+			return 0, err
+		}
+
+		lag, err := e.estimate(ctx, &ChangeFeedOptions{Continuation: &serialized, StartFrom: e.startFrom, MaxItemCount: 1})
+		if err != nil {
+			return 0, err
+		}
+		total += lag
+	}
+	return total, nil
+}
+
+// estimate reads the first change that wasn't processed, and returns the difference between the range's latest
+// LSN, from the response's session token, and the change's LSN.
+func (e *ChangeFeedEstimator) estimate(ctx context.Context, options *ChangeFeedOptions) (int64, error) {
+	resp, err := e.container.ReadChangeFeed(ctx, options)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Items) == 0 || resp.RawResponse == nil {
+		return 0, nil
+	}
+
+	latestLSN, ok := parseSessionTokenLSN(resp.RawResponse.Header.Get(cosmosHeaderSessionToken))
+	if !ok {
+		return 0, fmt.Errorf("failed to estimate the change feed lag: the response has no valid session token")
+	}
+
+	var item struct {
+		LSN int64 `json:"_lsn"`
+	}
+	if err := json.Unmarshal(resp.Items[0], &item); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal the change feed item's LSN: %w", err)
+	}
+
+	return max(0, latestLSN-item.LSN+1), nil
+}
+
+// parseSessionTokenLSN returns the global LSN of a session token, in the format
+// "{partitionKeyRangeId}:{version}#{globalLSN}#{regionId}={localLSN}...".
+func parseSessionTokenLSN(sessionToken string) (int64, bool) {
+	_, token, _ := strings.Cut(sessionToken, ":")
+	parts := strings.Split(token, "#")
+	if len(parts) < 2 {
+		return 0, false
+	}
+	lsn, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return lsn, true
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ChangeFeedItem is a change returned by the change feed in ChangeFeedModeAllVersionsAndDeletes.
+type ChangeFeedItem struct {
+	// Current is the item after the change. It's nil for deletes.
+	Current []byte
+	// Previous is the item before the change. It's nil for creates, and for replaces and deletes when the
+	// previous image isn't available.
+	Previous []byte
+	// Metadata describes the change.
+	Metadata ChangeFeedMetadata
+}
+
+// ChangeFeedMetadata describes a change returned by the change feed in ChangeFeedModeAllVersionsAndDeletes.
+type ChangeFeedMetadata struct {
+	// OperationType is the type of operation of the change.
+	OperationType ChangeFeedOperationType
+	// LSN is the logical sequence number of the change.
+	LSN int64
+	// PreviousImageLSN is the logical sequence number of the previous version of the item, or 0 for creates.
+	PreviousImageLSN int64
+	// ConflictResolutionTimestamp is the time the change was committed, with a precision of seconds.
+	ConflictResolutionTimestamp time.Time
+	// TimeToLiveExpired is true if the item was deleted because its time to live expired.
+	TimeToLiveExpired bool
+	// ID is the ID of the deleted item. It's only set for deletes.
+	ID string
+	// PartitionKey is the partition key of the deleted item, by partition key path. It's only set for deletes.
+	PartitionKey map[string]any
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (item *ChangeFeedItem) UnmarshalJSON(b []byte) error {
+	aux := struct {
+		Current  json.RawMessage `json:"current"`
+		Previous json.RawMessage `json:"previous"`
+		Metadata struct {
+			OperationType     ChangeFeedOperationType `json:"operationType"`
+			LSN               int64                   `json:"lsn"`
+			PreviousImageLSN  int64                   `json:"previousImageLSN"`
+			CRTS              int64                   `json:"crts"`
+			TimeToLiveExpired bool                    `json:"timeToLiveExpired"`
+			ID                string                  `json:"id"`
+			PartitionKey      map[string]any          `json:"partitionKey"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	item.Current = rawMessageBytes(aux.Current)
+	item.Previous = rawMessageBytes(aux.Previous)
+	item.Metadata = ChangeFeedMetadata{
+		OperationType:     aux.Metadata.OperationType,
+		LSN:               aux.Metadata.LSN,
+		PreviousImageLSN:  aux.Metadata.PreviousImageLSN,
+		TimeToLiveExpired: aux.Metadata.TimeToLiveExpired,
+		ID:                aux.Metadata.ID,
+		PartitionKey:      aux.Metadata.PartitionKey,
+	}
+	if aux.Metadata.CRTS > 0 {
+		item.Metadata.ConflictResolutionTimestamp = time.Unix(aux.Metadata.CRTS, 0).UTC()
+	}
+	return nil
+}
+
+// rawMessageBytes returns the bytes of a JSON value, or nil if it's missing or null.
+func rawMessageBytes(m json.RawMessage) []byte {
+	if len(m) == 0 || string(m) == "null" {
+		return nil
+	}
+	return []byte(m)
+}
+
+// AllVersionsAndDeletesItems decodes the items of a response read in ChangeFeedModeAllVersionsAndDeletes.
+func (c ChangeFeedResponse) AllVersionsAndDeletesItems() ([]ChangeFeedItem, error) {
+	items := make([]ChangeFeedItem, len(c.Items))
+	for i, b := range c.Items {
+		if err := json.Unmarshal(b, &items[i]); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal change feed item %d: %w", i, err)
+		}
+	}
+	return items, nil
+}
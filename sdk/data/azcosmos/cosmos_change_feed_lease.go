@@ -0,0 +1,185 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// ErrChangeFeedLeaseConflict is returned by a ChangeFeedLeaseStore when a lease can't be written because it was
+// changed, created or deleted by another instance. For ChangeFeedLeaseStore.CreateLease, the lease already exists.
+// For ChangeFeedLeaseStore.ReplaceLease and ChangeFeedLeaseStore.DeleteLease, the lease's ETag doesn't match the stored
+// lease's ETag, or the lease doesn't exist anymore.
+var ErrChangeFeedLeaseConflict = errors.New("the change feed lease was changed by another instance")
+
+// ChangeFeedLease is the state of a range of a container's change feed, shared by the instances of a
+// ChangeFeedProcessor. A lease is owned by one instance at a time, which reads the changes of the lease's
+// FeedRange and checkpoints its progress in the ContinuationToken.
+type ChangeFeedLease struct {
+	// ID is the unique identifier of the lease.
+	ID string
+	// FeedRange is the range of the change feed the lease covers.
+	FeedRange FeedRange
+	// ContinuationToken is the continuation token, as returned by ContainerClient.ReadChangeFeed, of the changes
+	// that were processed. It's empty if no changes were read yet.
+	ContinuationToken string
+	// Owner is the instance name of the processor that owns the lease, or empty if the lease isn't owned.
+	Owner string
+	// LastModifiedTime is the last time the owner renewed the lease. A lease that isn't renewed expires, and can
+	// be claimed by another instance.
+	LastModifiedTime time.Time
+	// ETag is the ETag of the stored lease, used for optimistic concurrency. It's set by the ChangeFeedLeaseStore.
+	ETag *azcore.ETag
+}
+
+// ChangeFeedLeaseStore stores the leases of a ChangeFeedProcessor. All the instances of a processor must use the
+// same store. Writes must use optimistic concurrency on the lease's ETag, so that only one instance owns a lease.
+type ChangeFeedLeaseStore interface {
+	// ListLeases returns all the leases.
+	ListLeases(ctx context.Context) ([]ChangeFeedLease, error)
+
+	// CreateLease creates a lease, and returns it with its ETag. It returns an error wrapping
+	// ErrChangeFeedLeaseConflict if a lease with the same ID exists.
+	CreateLease(ctx context.Context, lease ChangeFeedLease) (ChangeFeedLease, error)
+
+	// ReplaceLease replaces a lease if its ETag matches the stored lease's ETag, and returns it with its new ETag.
+	// It returns an error wrapping ErrChangeFeedLeaseConflict if the ETag doesn't match or the lease doesn't exist.
+	ReplaceLease(ctx context.Context, lease ChangeFeedLease) (ChangeFeedLease, error)
+
+	// DeleteLease deletes a lease if its ETag matches the stored lease's ETag. It returns an error wrapping
+	// ErrChangeFeedLeaseConflict if the ETag doesn't match.
+	DeleteLease(ctx context.Context, lease ChangeFeedLease) error
+}
+
+// NewContainerLeaseStore creates a ChangeFeedLeaseStore that stores leases as items of a Cosmos container.
+// The lease container must be partitioned by /id. Leases are stored with IDs that start with prefix, so that the
+// leases of several processors can be stored in the same container.
+func NewContainerLeaseStore(leaseContainer *ContainerClient, prefix string) ChangeFeedLeaseStore {
+	return &containerLeaseStore{container: leaseContainer, prefix: prefix}
+}
+
+type containerLeaseStore struct {
+	container *ContainerClient
+	prefix    string
+}
+
+// leaseDocument is a lease, as it's stored in the lease container.
+type leaseDocument struct {
+	ID                string      `json:"id"`
+	FeedRange         FeedRange   `json:"feedRange"`
+	ContinuationToken string      `json:"continuationToken,omitempty"`
+	Owner             string      `json:"owner,omitempty"`
+	Timestamp         time.Time   `json:"timestamp"`
+	ETag              azcore.ETag `json:"_etag,omitempty"`
+}
+
+func (s *containerLeaseStore) ListLeases(ctx context.Context) ([]ChangeFeedLease, error) {
+	pager := s.container.NewQueryItemsPager(
+		"SELECT * FROM c WHERE STARTSWITH(c.id, @prefix)",
+		NewPartitionKey(),
+		&QueryOptions{QueryParameters: []QueryParameter{{Name: "@prefix", Value: s.prefix}}})
+
+	var leases []ChangeFeedLease
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var doc leaseDocument
+			if err := json.Unmarshal(item, &doc); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal change feed lease: %w", err)
+			}
+			leases = append(leases, s.fromDocument(doc))
+		}
+	}
+	return leases, nil
+}
+
+func (s *containerLeaseStore) CreateLease(ctx context.Context, lease ChangeFeedLease) (ChangeFeedLease, error) {
+	doc, err := s.toDocument(lease)
+	if err != nil {
+		return ChangeFeedLease{}, err
+	}
+
+	resp, err := s.container.CreateItem(ctx, NewPartitionKeyString(s.prefix+lease.ID), doc, nil)
+	if err != nil {
+		return ChangeFeedLease{}, leaseConflictError(err, http.StatusConflict)
+	}
+
+	lease.ETag = &resp.ETag
+	return lease, nil
+}
+
+func (s *containerLeaseStore) ReplaceLease(ctx context.Context, lease ChangeFeedLease) (ChangeFeedLease, error) {
+	doc, err := s.toDocument(lease)
+	if err != nil {
+		return ChangeFeedLease{}, err
+	}
+
+	id := s.prefix + lease.ID
+	resp, err := s.container.ReplaceItem(ctx, NewPartitionKeyString(id), id, doc, &ItemOptions{IfMatchEtag: lease.ETag})
+	if err != nil {
+		return ChangeFeedLease{}, leaseConflictError(err, http.StatusPreconditionFailed, http.StatusNotFound)
+	}
+
+	lease.ETag = &resp.ETag
+	return lease, nil
+}
+
+func (s *containerLeaseStore) DeleteLease(ctx context.Context, lease ChangeFeedLease) error {
+	id := s.prefix + lease.ID
+	_, err := s.container.DeleteItem(ctx, NewPartitionKeyString(id), id, &ItemOptions{IfMatchEtag: lease.ETag})
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		// the lease was already deleted.
+		return nil
+	}
+	if err != nil {
+		return leaseConflictError(err, http.StatusPreconditionFailed)
+	}
+	return nil
+}
+
+func (s *containerLeaseStore) toDocument(lease ChangeFeedLease) ([]byte, error) {
+	return json.Marshal(leaseDocument{
+		ID:                s.prefix + lease.ID,
+		FeedRange:         lease.FeedRange,
+		ContinuationToken: lease.ContinuationToken,
+		Owner:             lease.Owner,
+		Timestamp:         lease.LastModifiedTime.UTC(),
+	})
+}
+
+func (s *containerLeaseStore) fromDocument(doc leaseDocument) ChangeFeedLease {
+	etag := doc.ETag
+	return ChangeFeedLease{
+		ID:                doc.ID[len(s.prefix):],
+		FeedRange:         doc.FeedRange,
+		ContinuationToken: doc.ContinuationToken,
+		Owner:             doc.Owner,
+		LastModifiedTime:  doc.Timestamp,
+		ETag:              &etag,
+	}
+}
+
+// leaseConflictError wraps ErrChangeFeedLeaseConflict around a response error with one of the status codes.
+func leaseConflictError(err error, statusCodes ...int) error {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		for _, statusCode := range statusCodes {
+			if respErr.StatusCode == statusCode {
+				return fmt.Errorf("%w: %w", ErrChangeFeedLeaseConflict, err)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// leaseStoreRequest is a request sent by a containerLeaseStore.
+type leaseStoreRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newLeaseStoreTestContainer(t *testing.T, srv *mock.Server, requests *[]leaseStoreRequest) *ContainerClient {
+	capture := policyFunc(func(req *policy.Request) (*http.Response, error) {
+		captured := leaseStoreRequest{header: req.Raw().Header.Clone()}
+		if req.Raw().Body != nil {
+			body, err := io.ReadAll(req.Raw().Body)
+			if err != nil {
+				return nil, err
+			}
+			if err := req.RewindBody(); err != nil {
+				return nil, err
+			}
+			captured.body = body
+		}
+		*requests = append(*requests, captured)
+		return req.Next()
+	})
+	client := createChangeFeedTestClient(t, srv, []policy.Policy{capture}, nil)
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+	return container
+}
+
+func TestContainerLeaseStore_ListLeases(t *testing.T) {
+	srv, closeSrv := mock.NewTLSServer()
+	defer closeSrv()
+
+	var requests []leaseStoreRequest
+	store := NewContainerLeaseStore(newLeaseStoreTestContainer(t, srv, &requests), "processor1.")
+
+	srv.AppendResponse(mock.WithStatusCode(200), mock.WithBody([]byte(`{"Documents":[`+
+		`{"id":"processor1.[,20)","feedRange":{"minInclusive":"","maxExclusive":"20"},"owner":"instance1","timestamp":"2024-01-02T03:04:05Z","_etag":"\"etag1\""},`+
+		`{"id":"processor1.[20,FF)","feedRange":{"minInclusive":"20","maxExclusive":"FF"},"continuationToken":"token","timestamp":"2024-01-02T03:04:05Z","_etag":"\"etag2\""}`+
+		`],"_count":2}`)))
+
+	leases, err := store.ListLeases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+
+	require.Equal(t, "[,20)", leases[0].ID)
+	require.Equal(t, FeedRange{MinInclusive: "", MaxExclusive: "20"}, leases[0].FeedRange)
+	require.Equal(t, "instance1", leases[0].Owner)
+	require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), leases[0].LastModifiedTime)
+	require.Equal(t, azcore.ETag("\"etag1\""), *leases[0].ETag)
+
+	require.Equal(t, "[20,FF)", leases[1].ID)
+	require.Equal(t, "token", leases[1].ContinuationToken)
+	require.Empty(t, leases[1].Owner)
+
+	require.Len(t, requests, 1)
+	require.Equal(t, "True", requests[0].header.Get(cosmosHeaderQuery))
+	require.Equal(t, "true", requests[0].header.Get(cosmosHeaderEnableCrossPartitionQuery))
+}
+
+func TestContainerLeaseStore_CreateLease(t *testing.T) {
+	srv, closeSrv := mock.NewTLSServer()
+	defer closeSrv()
+
+	var requests []leaseStoreRequest
+	store := NewContainerLeaseStore(newLeaseStoreTestContainer(t, srv, &requests), "processor1.")
+	lease := ChangeFeedLease{ID: "[,20)", FeedRange: FeedRange{MinInclusive: "", MaxExclusive: "20"}}
+
+	srv.AppendResponse(mock.WithStatusCode(201), mock.WithHeader(cosmosHeaderEtag, "\"etag1\""))
+	created, err := store.CreateLease(context.Background(), lease)
+	require.NoError(t, err)
+	require.Equal(t, azcore.ETag("\"etag1\""), *created.ETag)
+
+	var doc leaseDocument
+	require.NoError(t, json.Unmarshal(requests[0].body, &doc))
+	require.Equal(t, "processor1.[,20)", doc.ID)
+	require.Equal(t, FeedRange{MinInclusive: "", MaxExclusive: "20"}, doc.FeedRange)
+
+	srv.AppendResponse(mock.WithStatusCode(409))
+	_, err = store.CreateLease(context.Background(), lease)
+	require.ErrorIs(t, err, ErrChangeFeedLeaseConflict)
+	var respErr *azcore.ResponseError
+	require.True(t, errors.As(err, &respErr))
+	require.Equal(t, http.StatusConflict, respErr.StatusCode)
+}
+
+func TestContainerLeaseStore_ReplaceLease(t *testing.T) {
+	srv, closeSrv := mock.NewTLSServer()
+	defer closeSrv()
+
+	var requests []leaseStoreRequest
+	store := NewContainerLeaseStore(newLeaseStoreTestContainer(t, srv, &requests), "processor1.")
+	etag := azcore.ETag("\"etag1\"")
+	lease := ChangeFeedLease{ID: "[,20)", Owner: "instance1", ContinuationToken: "token", ETag: &etag}
+
+	srv.AppendResponse(mock.WithStatusCode(200), mock.WithHeader(cosmosHeaderEtag, "\"etag2\""))
+	replaced, err := store.ReplaceLease(context.Background(), lease)
+	require.NoError(t, err)
+	require.Equal(t, azcore.ETag("\"etag2\""), *replaced.ETag)
+	require.Equal(t, "\"etag1\"", requests[0].header.Get(headerIfMatch))
+
+	var doc leaseDocument
+	require.NoError(t, json.Unmarshal(requests[0].body, &doc))
+	require.Equal(t, "processor1.[,20)", doc.ID)
+	require.Equal(t, "instance1", doc.Owner)
+	require.Equal(t, "token", doc.ContinuationToken)
+
+	for _, statusCode := range []int{http.StatusPreconditionFailed, http.StatusNotFound} {
+		srv.AppendResponse(mock.WithStatusCode(statusCode))
+		_, err = store.ReplaceLease(context.Background(), lease)
+		require.ErrorIs(t, err, ErrChangeFeedLeaseConflict)
+	}
+
+	srv.AppendResponse(mock.WithStatusCode(http.StatusBadRequest))
+	_, err = store.ReplaceLease(context.Background(), lease)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrChangeFeedLeaseConflict)
+}
+
+func TestContainerLeaseStore_DeleteLease(t *testing.T) {
+	srv, closeSrv := mock.NewTLSServer()
+	defer closeSrv()
+
+	var requests []leaseStoreRequest
+	store := NewContainerLeaseStore(newLeaseStoreTestContainer(t, srv, &requests), "processor1.")
+	etag := azcore.ETag("\"etag1\"")
+	lease := ChangeFeedLease{ID: "[,20)", ETag: &etag}
+
+	srv.AppendResponse(mock.WithStatusCode(204))
+	require.NoError(t, store.DeleteLease(context.Background(), lease))
+	require.Equal(t, "\"etag1\"", requests[0].header.Get(headerIfMatch))
+
+	srv.AppendResponse(mock.WithStatusCode(http.StatusNotFound))
+	require.NoError(t, store.DeleteLease(context.Background(), lease), "a deleted lease isn't a conflict")
+
+	srv.AppendResponse(mock.WithStatusCode(http.StatusPreconditionFailed))
+	require.ErrorIs(t, store.DeleteLease(context.Background(), lease), ErrChangeFeedLeaseConflict)
+}
@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+// ChangeFeedMode defines which changes the change feed returns.
+// Valid values are ChangeFeedModeLatestVersion and ChangeFeedModeAllVersionsAndDeletes.
+// For more information, see https://learn.microsoft.com/azure/cosmos-db/nosql/change-feed-modes
+type ChangeFeedMode string
+
+const (
+	// ChangeFeedModeLatestVersion is the default mode. The change feed returns the latest version of each created
+	// or updated item. Intermediate updates and deletes aren't returned.
+	ChangeFeedModeLatestVersion ChangeFeedMode = "LatestVersion"
+	// ChangeFeedModeAllVersionsAndDeletes returns every create, replace and delete, with their metadata. The
+	// container's account must have continuous backups enabled. Reading starts from the current time when there
+	// is no continuation token, so ChangeFeedOptions.StartFrom isn't supported.
+	// Use ChangeFeedResponse.AllVersionsAndDeletesItems to decode the changes.
+	ChangeFeedModeAllVersionsAndDeletes ChangeFeedMode = "AllVersionsAndDeletes"
+)
+
+// ChangeFeedModeValues returns a list of available change feed modes.
+func ChangeFeedModeValues() []ChangeFeedMode {
+	return []ChangeFeedMode{ChangeFeedModeLatestVersion, ChangeFeedModeAllVersionsAndDeletes}
+}
+
+// ChangeFeedOperationType is the type of operation of a change in ChangeFeedModeAllVersionsAndDeletes.
+type ChangeFeedOperationType string
+
+const (
+	// ChangeFeedOperationTypeCreate is the creation of an item.
+	ChangeFeedOperationTypeCreate ChangeFeedOperationType = "create"
+	// ChangeFeedOperationTypeReplace is the replacement, upsert or patch of an existing item.
+	ChangeFeedOperationTypeReplace ChangeFeedOperationType = "replace"
+	// ChangeFeedOperationTypeDelete is the deletion of an item, including its expiration.
+	ChangeFeedOperationTypeDelete ChangeFeedOperationType = "delete"
+)
+
+// ChangeFeedOperationTypeValues returns a list of available change feed operation types.
+func ChangeFeedOperationTypeValues() []ChangeFeedOperationType {
+	return []ChangeFeedOperationType{ChangeFeedOperationTypeCreate, ChangeFeedOperationTypeReplace, ChangeFeedOperationTypeDelete}
+}
@@ -0,0 +1,548 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+)
+
+const (
+	defaultChangeFeedPollInterval            = 5 * time.Second
+	defaultChangeFeedLeaseAcquireInterval    = 13 * time.Second
+	defaultChangeFeedLeaseRenewInterval      = 17 * time.Second
+	defaultChangeFeedLeaseExpirationInterval = 60 * time.Second
+
+	// changeFeedLeaseReleaseTimeout bounds the time spent releasing leases when a processor stops.
+	changeFeedLeaseReleaseTimeout = 5 * time.Second
+)
+
+// ChangeFeedHandler processes the changes read by a ChangeFeedProcessor. The changes of a lease are checkpointed
+// after the handler returns nil. When the handler returns an error, the lease is released without checkpointing,
+// and its changes are read again by the instance that claims it next.
+type ChangeFeedHandler func(ctx context.Context, changes ChangeFeedProcessorChanges) error
+
+// ChangeFeedProcessorChanges are the changes read from a lease's feed range.
+type ChangeFeedProcessorChanges struct {
+	// LeaseID is the ID of the lease the changes were read for.
+	LeaseID string
+	// FeedRange is the feed range of the lease.
+	FeedRange FeedRange
+	// Items are the changed items.
+	Items [][]byte
+}
+
+// ChangeFeedProcessorOptions are the options for ContainerClient.NewChangeFeedProcessor.
+type ChangeFeedProcessorOptions struct {
+	// InstanceName identifies the processor instance in the leases it owns. Each instance must have a unique name.
+	// If not set, a random name is used.
+	InstanceName string
+	// StartFrom is the time to start reading changes from, for leases that have no checkpoint.
+	// If not set, the changes are read from the beginning of the container's change feed.
+	StartFrom *time.Time
+	// MaxItemCount limits the number of items passed to the handler at once.
+	MaxItemCount int32
+	// PollInterval is the time to wait before reading a lease's changes again when there were no changes.
+	// The default is 5 seconds.
+	PollInterval time.Duration
+	// LeaseAcquireInterval is how often the processor balances the leases between the instances.
+	// The default is 13 seconds.
+	LeaseAcquireInterval time.Duration
+	// LeaseRenewInterval is how often the processor renews the leases it owns.
+	// The default is 17 seconds.
+	LeaseRenewInterval time.Duration
+	// LeaseExpirationInterval is the time after which a lease that isn't renewed can be claimed by another instance.
+	// The default is 60 seconds.
+	LeaseExpirationInterval time.Duration
+	// PriorityLevel overrides the client-level default priority for the change feed requests.
+	// Valid values are PriorityLevelHigh and PriorityLevelLow.
+	PriorityLevel *PriorityLevel
+}
+
+// changeFeedReader is the part of a ContainerClient used by the change feed processor and estimator.
+// It's an interface to make testing easier.
+type changeFeedReader interface {
+	ReadChangeFeed(ctx context.Context, options *ChangeFeedOptions) (ChangeFeedResponse, error)
+	ReadFeedRanges(ctx context.Context, o *FeedRangesOptions) ([]FeedRange, error)
+}
+
+// ChangeFeedProcessor reads a container's change feed, distributing its feed ranges across instances, even in
+// separate processes or on separate machines, with leases in a ChangeFeedLeaseStore.
+//
+// Each lease covers a feed range, and is owned by one instance at a time. The instances balance the leases between
+// them: an instance claims the leases that aren't owned or have expired, and takes leases from the instance that
+// owns the most leases, until each instance owns its share. An instance renews the leases it owns, and checkpoints
+// the continuation token of each lease after the handler processes its changes. When a partition is split, the
+// lease of its feed range is replaced by a lease for each new partition. When partitions are merged, the leases of
+// their feed ranges keep reading their own part of the merged partition.
+//
+// Changes are delivered at least once: changes may be processed again after a handler error, or when a lease moves
+// to another instance before its changes were checkpointed.
+type ChangeFeedProcessor struct {
+	container    changeFeedReader
+	leaseStore   ChangeFeedLeaseStore
+	handler      ChangeFeedHandler
+	instanceName string
+
+	startFrom               *time.Time
+	maxItemCount            int32
+	priorityLevel           *PriorityLevel
+	pollInterval            time.Duration
+	leaseAcquireInterval    time.Duration
+	leaseRenewInterval      time.Duration
+	leaseExpirationInterval time.Duration
+
+	runMu   sync.Mutex
+	running bool
+
+	mu      sync.Mutex
+	workers map[string]*changeFeedLeaseWorker
+	wg      sync.WaitGroup
+}
+
+// NewChangeFeedProcessor creates a ChangeFeedProcessor for the container's change feed.
+// leaseStore - The store of the leases, shared by all the instances of the processor.
+// handler - The function that processes the changes.
+// o - Options for the processor.
+func (c *ContainerClient) NewChangeFeedProcessor(leaseStore ChangeFeedLeaseStore, handler ChangeFeedHandler, o *ChangeFeedProcessorOptions) (*ChangeFeedProcessor, error) {
+	return newChangeFeedProcessor(c, leaseStore, handler, o)
+}
+
+func newChangeFeedProcessor(container changeFeedReader, leaseStore ChangeFeedLeaseStore, handler ChangeFeedHandler, o *ChangeFeedProcessorOptions) (*ChangeFeedProcessor, error) {
+	if leaseStore == nil {
+		return nil, errors.New("leaseStore is required")
+	}
+	if handler == nil {
+		return nil, errors.New("handler is required")
+	}
+	if o == nil {
+		o = &ChangeFeedProcessorOptions{}
+	}
+
+	p := &ChangeFeedProcessor{
+		container:               container,
+		leaseStore:              leaseStore,
+		handler:                 handler,
+		instanceName:            o.InstanceName,
+		startFrom:               o.StartFrom,
+		maxItemCount:            o.MaxItemCount,
+		priorityLevel:           o.PriorityLevel,
+		pollInterval:            durationOrDefault(o.PollInterval, defaultChangeFeedPollInterval),
+		leaseAcquireInterval:    durationOrDefault(o.LeaseAcquireInterval, defaultChangeFeedLeaseAcquireInterval),
+		leaseRenewInterval:      durationOrDefault(o.LeaseRenewInterval, defaultChangeFeedLeaseRenewInterval),
+		leaseExpirationInterval: durationOrDefault(o.LeaseExpirationInterval, defaultChangeFeedLeaseExpirationInterval),
+		workers:                 map[string]*changeFeedLeaseWorker{},
+	}
+
+	if p.leaseRenewInterval >= p.leaseExpirationInterval {
+		return nil, fmt.Errorf("LeaseRenewInterval (%s) must be shorter than LeaseExpirationInterval (%s)", p.leaseRenewInterval, p.leaseExpirationInterval)
+	}
+
+	if p.instanceName == "" {
+		id, err := uuid.New()
+		if err != nil {
+			return nil, err
+		}
+		p.instanceName = id.String()
+	}
+	return p, nil
+}
+
+func durationOrDefault(d time.Duration, defaultValue time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return defaultValue
+}
+
+// InstanceName returns the name that identifies this instance in the leases it owns.
+func (p *ChangeFeedProcessor) InstanceName() string {
+	return p.instanceName
+}
+
+// Run processes changes, blocking until the passed in context is cancelled or it encounters an unrecoverable
+// error. On cancellation, it releases the leases this instance owns, so that other instances can claim them
+// without waiting for them to expire, and returns a nil error.
+//
+// If the lease store has no leases, Run creates a lease for each of the container's feed ranges.
+func (p *ChangeFeedProcessor) Run(ctx context.Context) error {
+	p.runMu.Lock()
+	if p.running {
+		p.runMu.Unlock()
+		return errors.New("the ChangeFeedProcessor is currently running, concurrent calls to Run() are not allowed")
+	}
+	p.running = true
+	p.runMu.Unlock()
+
+	defer func() {
+		p.runMu.Lock()
+		p.running = false
+		p.runMu.Unlock()
+	}()
+
+	if err := p.initializeLeases(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	// the workers release their leases when they stop.
+	defer p.wg.Wait()
+
+	for {
+		if err := p.balance(ctx); err != nil && ctx.Err() == nil {
+			log.Writef(EventChangeFeedProcessor, "instance %s failed to balance change feed leases: %v", p.instanceName, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(p.leaseAcquireInterval):
+		}
+	}
+}
+
+// initializeLeases creates a lease for each feed range of the container, if there are no leases.
+// Instances that initialize the leases at the same time create the same leases, so conflicts are ignored.
+func (p *ChangeFeedProcessor) initializeLeases(ctx context.Context) error {
+	leases, err := p.leaseStore.ListLeases(ctx)
+	if err != nil {
+		return err
+	}
+	if len(leases) > 0 {
+		return nil
+	}
+
+	feedRanges, err := p.container.ReadFeedRanges(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, feedRange := range feedRanges {
+		lease := ChangeFeedLease{ID: changeFeedLeaseID(feedRange), FeedRange: feedRange}
+		if _, err := p.leaseStore.CreateLease(ctx, lease); err != nil && !errors.Is(err, ErrChangeFeedLeaseConflict) {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeFeedLeaseID returns the ID of the lease of a feed range.
+func changeFeedLeaseID(feedRange FeedRange) string {
+	return fmt.Sprintf("[%s,%s)", feedRange.MinInclusive, normalizeMaxBoundary(feedRange.MaxExclusive))
+}
+
+// balance claims the leases that aren't owned or have expired, and takes a lease from the instance that owns the
+// most leases, until this instance owns its share of the leases. It also starts processing the leases this instance
+// owns but isn't processing, such as the leases that replace a split lease.
+func (p *ChangeFeedProcessor) balance(ctx context.Context) error {
+	leases, err := p.leaseStore.ListLeases(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	owned := map[string][]ChangeFeedLease{p.instanceName: nil}
+	var available []ChangeFeedLease
+
+	for _, lease := range leases {
+		if lease.Owner == "" || now.Sub(lease.LastModifiedTime) > p.leaseExpirationInterval {
+			available = append(available, lease)
+			continue
+		}
+		owned[lease.Owner] = append(owned[lease.Owner], lease)
+
+		if lease.Owner == p.instanceName && !p.isProcessing(lease.ID) {
+			p.startWorker(ctx, lease)
+		}
+	}
+
+	if len(leases) == 0 {
+		return nil
+	}
+
+	// each instance's share is the number of leases divided by the number of active instances, rounded up.
+	share := (len(leases) + len(owned) - 1) / len(owned)
+	count := len(owned[p.instanceName])
+
+	rand.Shuffle(len(available), func(i, j int) { available[i], available[j] = available[j], available[i] })
+	for _, lease := range available {
+		if count >= share {
+			return nil
+		}
+		if p.claim(ctx, lease) {
+			count++
+		}
+	}
+
+	if count >= share {
+		return nil
+	}
+
+	// take one lease from the instance that owns the most leases, if it owns more than its share.
+	var busiest string
+	for owner, ownerLeases := range owned {
+		if owner != p.instanceName && len(ownerLeases) > share && (busiest == "" || len(ownerLeases) > len(owned[busiest])) {
+			busiest = owner
+		}
+	}
+	if busiest != "" {
+		ownerLeases := owned[busiest]
+		p.claim(ctx, ownerLeases[rand.Intn(len(ownerLeases))])
+	}
+	return nil
+}
+
+// claim makes this instance the owner of a lease and starts processing it. It returns false if another instance
+// changed the lease first.
+func (p *ChangeFeedProcessor) claim(ctx context.Context, lease ChangeFeedLease) bool {
+	previousOwner := lease.Owner
+	lease.Owner = p.instanceName
+	lease.LastModifiedTime = time.Now()
+
+	claimed, err := p.leaseStore.ReplaceLease(ctx, lease)
+	if err != nil {
+		if !errors.Is(err, ErrChangeFeedLeaseConflict) && ctx.Err() == nil {
+			log.Writef(EventChangeFeedProcessor, "instance %s failed to claim change feed lease %s: %v", p.instanceName, lease.ID, err)
+		}
+		return false
+	}
+
+	log.Writef(EventChangeFeedProcessor, "instance %s claimed change feed lease %s from %q", p.instanceName, lease.ID, previousOwner)
+	p.startWorker(ctx, claimed)
+	return true
+}
+
+func (p *ChangeFeedProcessor) isProcessing(leaseID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.workers[leaseID]
+	return ok
+}
+
+func (p *ChangeFeedProcessor) startWorker(ctx context.Context, lease ChangeFeedLease) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.workers[lease.ID]; ok {
+		return
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	w := &changeFeedLeaseWorker{processor: p, leaseID: lease.ID, lease: lease, cancel: cancel}
+	p.workers[lease.ID] = w
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		w.renew(workerCtx)
+	}()
+	go func() {
+		defer p.wg.Done()
+		defer p.removeWorker(lease.ID)
+		defer cancel()
+		w.process(workerCtx)
+
+		if ctx.Err() != nil {
+			// the processor is stopping, so the lease is released for other instances to claim.
+			releaseCtx, cancelRelease := context.WithTimeout(context.WithoutCancel(ctx), changeFeedLeaseReleaseTimeout)
+			defer cancelRelease()
+			w.release(releaseCtx)
+		}
+	}()
+}
+
+func (p *ChangeFeedProcessor) removeWorker(leaseID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.workers, leaseID)
+}
+
+// changeFeedLeaseWorker processes the changes of a lease this instance owns, and renews the lease.
+type changeFeedLeaseWorker struct {
+	processor *ChangeFeedProcessor
+	leaseID   string
+	cancel    context.CancelFunc
+
+	// mu serializes the writes of the lease, since each write needs the ETag of the previous one.
+	mu    sync.Mutex
+	lease ChangeFeedLease
+	lost  bool
+}
+
+// update writes the lease with the changes made by fn. If another instance changed the lease, the lease is lost,
+// and the worker stops.
+func (w *changeFeedLeaseWorker) update(ctx context.Context, fn func(*ChangeFeedLease)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lost {
+		return ErrChangeFeedLeaseConflict
+	}
+
+	lease := w.lease
+	fn(&lease)
+	lease.LastModifiedTime = time.Now()
+
+	updated, err := w.processor.leaseStore.ReplaceLease(ctx, lease)
+	if err != nil {
+		if errors.Is(err, ErrChangeFeedLeaseConflict) {
+			log.Writef(EventChangeFeedProcessor, "instance %s lost change feed lease %s", w.processor.instanceName, lease.ID)
+			w.lost = true
+			w.cancel()
+		}
+		return err
+	}
+	w.lease = updated
+	return nil
+}
+
+func (w *changeFeedLeaseWorker) current() ChangeFeedLease {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lease
+}
+
+func (w *changeFeedLeaseWorker) renew(ctx context.Context) {
+	ticker := time.NewTicker(w.processor.leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.update(ctx, func(*ChangeFeedLease) {}); err != nil && ctx.Err() == nil {
+				log.Writef(EventChangeFeedProcessor, "instance %s failed to renew change feed lease %s: %v", w.processor.instanceName, w.leaseID, err)
+			}
+		}
+	}
+}
+
+// release clears the owner of the lease, unless it was lost to another instance.
+func (w *changeFeedLeaseWorker) release(ctx context.Context) {
+	if err := w.update(ctx, func(l *ChangeFeedLease) { l.Owner = "" }); err != nil && !errors.Is(err, ErrChangeFeedLeaseConflict) {
+		log.Writef(EventChangeFeedProcessor, "instance %s failed to release change feed lease %s: %v", w.processor.instanceName, w.leaseID, err)
+	}
+}
+
+// process reads and handles the changes of the lease until the context is cancelled, the lease is lost or split,
+// or the handler fails.
+func (w *changeFeedLeaseWorker) process(ctx context.Context) {
+	p := w.processor
+
+	for ctx.Err() == nil {
+		lease := w.current()
+
+		options := &ChangeFeedOptions{
+			MaxItemCount:  p.maxItemCount,
+			StartFrom:     p.startFrom,
+			PriorityLevel: p.priorityLevel,
+		}
+		if lease.ContinuationToken != "" {
+			options.Continuation = &lease.ContinuationToken
+		} else {
+			feedRange := lease.FeedRange
+			options.FeedRange = &feedRange
+		}
+
+		resp, err := p.container.ReadChangeFeed(ctx, options)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Writef(EventChangeFeedProcessor, "instance %s failed to read the change feed of lease %s: %v", p.instanceName, lease.ID, err)
+				w.wait(ctx)
+			}
+			continue
+		}
+
+		if len(resp.Items) > 0 {
+			changes := ChangeFeedProcessorChanges{LeaseID: lease.ID, FeedRange: lease.FeedRange, Items: resp.Items}
+			if err := p.handler(ctx, changes); err != nil {
+				log.Writef(EventChangeFeedProcessor, "instance %s releasing change feed lease %s after the handler failed: %v", p.instanceName, lease.ID, err)
+				w.release(ctx)
+				return
+			}
+		}
+
+		if resp.ContinuationToken != "" && resp.ContinuationToken != lease.ContinuationToken {
+			split, err := w.checkpoint(ctx, resp.ContinuationToken)
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, ErrChangeFeedLeaseConflict) {
+					log.Writef(EventChangeFeedProcessor, "instance %s failed to checkpoint change feed lease %s: %v", p.instanceName, lease.ID, err)
+				}
+				return
+			}
+			if split {
+				return
+			}
+		}
+
+		if len(resp.Items) == 0 {
+			w.wait(ctx)
+		}
+	}
+}
+
+func (w *changeFeedLeaseWorker) wait(ctx context.Context) {
+	_ = waitForRetry(ctx, w.processor.pollInterval)
+}
+
+// checkpoint stores the continuation token in the lease. If the token covers more than one range, because the
+// lease's partition was split, the lease is replaced by a lease for each range, and split is true.
+func (w *changeFeedLeaseWorker) checkpoint(ctx context.Context, continuationToken string) (split bool, err error) {
+	var token compositeContinuationToken
+	if err := json.Unmarshal([]byte(continuationToken), &token); err != nil {
+		return false, fmt.Errorf("failed to unmarshal change feed continuation token: %w", err)
+	}
+
+	if len(token.Continuation) <= 1 {
+		return false, w.update(ctx, func(l *ChangeFeedLease) { l.ContinuationToken = continuationToken })
+	}
+
+	return true, w.split(ctx, token)
+}
+
+// split replaces the lease with a lease for each range of its continuation token. The new leases are owned by this
+// instance, which starts processing them when it next balances the leases, unless other instances claim them first.
+func (w *changeFeedLeaseWorker) split(ctx context.Context, token compositeContinuationToken) error {
+	p := w.processor
+	lease := w.current()
+
+	for _, r := range token.Continuation {
+		childToken := newCompositeContinuationToken(token.ResourceID, []changeFeedRange{r})
+		serialized, err := serializeCompositeContinuationToken(&childToken)
+		if err != nil {
+			return err
+		}
+
+		feedRange := FeedRange{MinInclusive: r.MinInclusive, MaxExclusive: r.MaxExclusive}
+		child := ChangeFeedLease{
+			ID:                changeFeedLeaseID(feedRange),
+			FeedRange:         feedRange,
+			ContinuationToken: serialized,
+			Owner:             p.instanceName,
+			LastModifiedTime:  time.Now(),
+		}
+		if _, err := p.leaseStore.CreateLease(ctx, child); err != nil && !errors.Is(err, ErrChangeFeedLeaseConflict) {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := p.leaseStore.DeleteLease(ctx, lease); err != nil {
+		return err
+	}
+	// the lease doesn't exist anymore, so it isn't released when the processor stops.
+	w.lost = true
+	log.Writef(EventChangeFeedProcessor, "instance %s split change feed lease %s into %d leases", p.instanceName, lease.ID, len(token.Continuation))
+	return nil
+}
@@ -0,0 +1,469 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/require"
+)
+
+// inMemoryLeaseStore is a ChangeFeedLeaseStore for tests.
+type inMemoryLeaseStore struct {
+	mu      sync.Mutex
+	leases  map[string]ChangeFeedLease
+	version int
+}
+
+func newInMemoryLeaseStore(leases ...ChangeFeedLease) *inMemoryLeaseStore {
+	s := &inMemoryLeaseStore{leases: map[string]ChangeFeedLease{}}
+	for _, lease := range leases {
+		_, _ = s.CreateLease(context.Background(), lease)
+	}
+	return s
+}
+
+func (s *inMemoryLeaseStore) ListLeases(ctx context.Context) ([]ChangeFeedLease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases := make([]ChangeFeedLease, 0, len(s.leases))
+	for _, lease := range s.leases {
+		leases = append(leases, lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ID < leases[j].ID })
+	return leases, nil
+}
+
+func (s *inMemoryLeaseStore) CreateLease(ctx context.Context, lease ChangeFeedLease) (ChangeFeedLease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.leases[lease.ID]; ok {
+		return ChangeFeedLease{}, ErrChangeFeedLeaseConflict
+	}
+	return s.write(lease), nil
+}
+
+func (s *inMemoryLeaseStore) ReplaceLease(ctx context.Context, lease ChangeFeedLease) (ChangeFeedLease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.leases[lease.ID]
+	if !ok || lease.ETag == nil || *stored.ETag != *lease.ETag {
+		return ChangeFeedLease{}, ErrChangeFeedLeaseConflict
+	}
+	return s.write(lease), nil
+}
+
+func (s *inMemoryLeaseStore) DeleteLease(ctx context.Context, lease ChangeFeedLease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.leases[lease.ID]
+	if !ok {
+		return nil
+	}
+	if lease.ETag == nil || *stored.ETag != *lease.ETag {
+		return ErrChangeFeedLeaseConflict
+	}
+	delete(s.leases, lease.ID)
+	return nil
+}
+
+func (s *inMemoryLeaseStore) write(lease ChangeFeedLease) ChangeFeedLease {
+	s.version++
+	etag := azcore.ETag(strconv.Itoa(s.version))
+	lease.ETag = &etag
+	s.leases[lease.ID] = lease
+	return lease
+}
+
+func (s *inMemoryLeaseStore) get(id string) (ChangeFeedLease, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lease, ok := s.leases[id]
+	return lease, ok
+}
+
+func (s *inMemoryLeaseStore) owners() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owners := map[string]int{}
+	for _, lease := range s.leases {
+		owners[lease.Owner]++
+	}
+	return owners
+}
+
+// fakeChangeFeed is a change feed whose ranges have fixed items. The continuation token of a range is the number of
+// items read. When a range in splits is read, the change feed returns a continuation token with the ranges that
+// replace it, as ReadChangeFeed does after a split.
+type fakeChangeFeed struct {
+	mu     sync.Mutex
+	ranges []FeedRange
+	items  map[FeedRange][]string
+	splits map[FeedRange][]FeedRange
+	reads  int
+}
+
+func (f *fakeChangeFeed) ReadFeedRanges(ctx context.Context, o *FeedRangesOptions) ([]FeedRange, error) {
+	return f.ranges, nil
+}
+
+func (f *fakeChangeFeed) ReadChangeFeed(ctx context.Context, options *ChangeFeedOptions) (ChangeFeedResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+
+	token := compositeContinuationToken{Version: cosmosCompositeContinuationTokenVersion, ResourceID: "rid"}
+	if options.Continuation != nil {
+		if err := json.Unmarshal([]byte(*options.Continuation), &token); err != nil {
+			return ChangeFeedResponse{}, err
+		}
+	} else {
+		token.Continuation = []changeFeedRange{newChangeFeedRange(options.FeedRange.MinInclusive, options.FeedRange.MaxExclusive, nil)}
+	}
+
+	head := token.head()
+	feedRange := FeedRange{MinInclusive: head.MinInclusive, MaxExclusive: head.MaxExclusive}
+	if children, ok := f.splits[feedRange]; ok {
+		var entries []changeFeedRange
+		for _, child := range children {
+			entries = append(entries, changeFeedRange{MinInclusive: child.MinInclusive, MaxExclusive: child.MaxExclusive, ContinuationToken: head.ContinuationToken})
+		}
+		token.replaceHeadWithChildren(entries)
+		head = token.head()
+		feedRange = FeedRange{MinInclusive: head.MinInclusive, MaxExclusive: head.MaxExclusive}
+	}
+
+	position := 0
+	if head.ContinuationToken != nil {
+		position, _ = strconv.Atoi(string(*head.ContinuationToken))
+	}
+
+	items := f.items[feedRange][position:]
+	if options.MaxItemCount > 0 && len(items) > int(options.MaxItemCount) {
+		items = items[:options.MaxItemCount]
+	}
+
+	resp := ChangeFeedResponse{FeedRange: &feedRange}
+	for _, item := range items {
+		resp.Items = append(resp.Items, []byte(item))
+	}
+
+	token.advance(azcore.ETag(strconv.Itoa(position + len(items))))
+	continuation, err := serializeCompositeContinuationToken(&token)
+	if err != nil {
+		return ChangeFeedResponse{}, err
+	}
+	resp.ContinuationToken = continuation
+	return resp, nil
+}
+
+// changeCollector is a ChangeFeedHandler that collects the changes.
+type changeCollector struct {
+	mu    sync.Mutex
+	items map[string]int
+	fail  func(changes ChangeFeedProcessorChanges) error
+}
+
+func (c *changeCollector) handle(ctx context.Context, changes ChangeFeedProcessorChanges) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail != nil {
+		if err := c.fail(changes); err != nil {
+			return err
+		}
+	}
+	if c.items == nil {
+		c.items = map[string]int{}
+	}
+	for _, item := range changes.Items {
+		c.items[string(item)]++
+	}
+	return nil
+}
+
+func (c *changeCollector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+func testChangeFeedProcessorOptions(instanceName string) *ChangeFeedProcessorOptions {
+	return &ChangeFeedProcessorOptions{
+		InstanceName:            instanceName,
+		MaxItemCount:            2,
+		PollInterval:            5 * time.Millisecond,
+		LeaseAcquireInterval:    10 * time.Millisecond,
+		LeaseRenewInterval:      50 * time.Millisecond,
+		LeaseExpirationInterval: 500 * time.Millisecond,
+	}
+}
+
+func runChangeFeedProcessor(t *testing.T, p *ChangeFeedProcessor) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		require.NoError(t, <-done)
+	}
+}
+
+var (
+	testFeedRangeLow  = FeedRange{MinInclusive: "", MaxExclusive: "20"}
+	testFeedRangeHigh = FeedRange{MinInclusive: "20", MaxExclusive: "FF"}
+)
+
+func TestChangeFeedProcessor_ProcessesAllRanges(t *testing.T) {
+	feed := &fakeChangeFeed{
+		ranges: []FeedRange{testFeedRangeLow, testFeedRangeHigh},
+		items: map[FeedRange][]string{
+			testFeedRangeLow:  {`{"id":"1"}`, `{"id":"2"}`, `{"id":"3"}`},
+			testFeedRangeHigh: {`{"id":"4"}`, `{"id":"5"}`},
+		},
+	}
+	store := newInMemoryLeaseStore()
+	collector := &changeCollector{}
+
+	p, err := newChangeFeedProcessor(feed, store, collector.handle, testChangeFeedProcessorOptions("instance1"))
+	require.NoError(t, err)
+
+	stop := runChangeFeedProcessor(t, p)
+	require.Eventually(t, func() bool { return collector.count() == 5 }, 5*time.Second, 5*time.Millisecond)
+	stop()
+
+	leases, err := store.ListLeases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	for _, lease := range leases {
+		require.Empty(t, lease.Owner, "leases are released when the processor stops")
+		require.NotEmpty(t, lease.ContinuationToken, "leases are checkpointed")
+	}
+	for item, count := range collector.items {
+		require.Equal(t, 1, count, "item %s is processed once", item)
+	}
+
+	// a new processor continues from the checkpoints.
+	feed.items[testFeedRangeHigh] = append(feed.items[testFeedRangeHigh], `{"id":"6"}`)
+	collector2 := &changeCollector{}
+	p2, err := newChangeFeedProcessor(feed, store, collector2.handle, testChangeFeedProcessorOptions("instance2"))
+	require.NoError(t, err)
+
+	stop = runChangeFeedProcessor(t, p2)
+	require.Eventually(t, func() bool { return collector2.count() == 1 }, 5*time.Second, 5*time.Millisecond)
+	stop()
+	require.Equal(t, map[string]int{`{"id":"6"}`: 1}, collector2.items)
+}
+
+func TestChangeFeedProcessor_BalancesLeases(t *testing.T) {
+	var ranges []FeedRange
+	items := map[FeedRange][]string{}
+	for i := 0; i < 4; i++ {
+		r := FeedRange{MinInclusive: fmt.Sprintf("%02X", i*0x10), MaxExclusive: fmt.Sprintf("%02X", (i+1)*0x10)}
+		ranges = append(ranges, r)
+		items[r] = nil
+	}
+	feed := &fakeChangeFeed{ranges: ranges, items: items}
+	store := newInMemoryLeaseStore()
+
+	p1, err := newChangeFeedProcessor(feed, store, (&changeCollector{}).handle, testChangeFeedProcessorOptions("instance1"))
+	require.NoError(t, err)
+	stop1 := runChangeFeedProcessor(t, p1)
+	require.Eventually(t, func() bool { return store.owners()["instance1"] == 4 }, 5*time.Second, 5*time.Millisecond)
+
+	p2, err := newChangeFeedProcessor(feed, store, (&changeCollector{}).handle, testChangeFeedProcessorOptions("instance2"))
+	require.NoError(t, err)
+	stop2 := runChangeFeedProcessor(t, p2)
+	require.Eventually(t, func() bool {
+		owners := store.owners()
+		return owners["instance1"] == 2 && owners["instance2"] == 2
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// the leases of a stopped instance are released, and claimed by the other instance.
+	stop1()
+	require.Eventually(t, func() bool { return store.owners()["instance2"] == 4 }, 5*time.Second, 5*time.Millisecond)
+	stop2()
+}
+
+func TestChangeFeedProcessor_ClaimsExpiredLeases(t *testing.T) {
+	feed := &fakeChangeFeed{items: map[FeedRange][]string{testFeedRangeLow: {`{"id":"1"}`}}}
+	store := newInMemoryLeaseStore(ChangeFeedLease{
+		ID:               changeFeedLeaseID(testFeedRangeLow),
+		FeedRange:        testFeedRangeLow,
+		Owner:            "crashed",
+		LastModifiedTime: time.Now().Add(-time.Hour),
+	})
+	collector := &changeCollector{}
+
+	p, err := newChangeFeedProcessor(feed, store, collector.handle, testChangeFeedProcessorOptions("instance1"))
+	require.NoError(t, err)
+
+	stop := runChangeFeedProcessor(t, p)
+	require.Eventually(t, func() bool { return collector.count() == 1 }, 5*time.Second, 5*time.Millisecond)
+	lease, ok := store.get(changeFeedLeaseID(testFeedRangeLow))
+	require.True(t, ok)
+	require.Equal(t, "instance1", lease.Owner)
+	stop()
+}
+
+func TestChangeFeedProcessor_SplitsLeases(t *testing.T) {
+	whole := FeedRange{MinInclusive: "", MaxExclusive: "FF"}
+	feed := &fakeChangeFeed{
+		ranges: []FeedRange{whole},
+		items: map[FeedRange][]string{
+			testFeedRangeLow:  {`{"id":"1"}`, `{"id":"2"}`},
+			testFeedRangeHigh: {`{"id":"3"}`},
+		},
+		splits: map[FeedRange][]FeedRange{whole: {testFeedRangeLow, testFeedRangeHigh}},
+	}
+	store := newInMemoryLeaseStore()
+	collector := &changeCollector{}
+
+	p, err := newChangeFeedProcessor(feed, store, collector.handle, testChangeFeedProcessorOptions("instance1"))
+	require.NoError(t, err)
+
+	stop := runChangeFeedProcessor(t, p)
+	require.Eventually(t, func() bool { return collector.count() == 3 }, 5*time.Second, 5*time.Millisecond)
+	stop()
+
+	leases, err := store.ListLeases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2, "the lease of the split range is replaced by a lease for each new range")
+	require.Equal(t, testFeedRangeLow, leases[0].FeedRange)
+	require.Equal(t, testFeedRangeHigh, leases[1].FeedRange)
+	for item, count := range collector.items {
+		require.Equal(t, 1, count, "item %s is processed once", item)
+	}
+}
+
+func TestChangeFeedProcessor_HandlerError(t *testing.T) {
+	feed := &fakeChangeFeed{
+		ranges: []FeedRange{testFeedRangeLow},
+		items:  map[FeedRange][]string{testFeedRangeLow: {`{"id":"1"}`}},
+	}
+	store := newInMemoryLeaseStore()
+	failures := 0
+	collector := &changeCollector{fail: func(changes ChangeFeedProcessorChanges) error {
+		if failures == 0 {
+			failures++
+			return errors.New("handler failed")
+		}
+		return nil
+	}}
+
+	p, err := newChangeFeedProcessor(feed, store, collector.handle, testChangeFeedProcessorOptions("instance1"))
+	require.NoError(t, err)
+
+	stop := runChangeFeedProcessor(t, p)
+	require.Eventually(t, func() bool { return collector.count() == 1 }, 5*time.Second, 5*time.Millisecond)
+	stop()
+	require.Equal(t, 1, failures, "the changes are read again after the handler fails")
+}
+
+func TestChangeFeedProcessor_ConcurrentRun(t *testing.T) {
+	feed := &fakeChangeFeed{ranges: []FeedRange{testFeedRangeLow}, items: map[FeedRange][]string{}}
+	p, err := newChangeFeedProcessor(feed, newInMemoryLeaseStore(), (&changeCollector{}).handle, testChangeFeedProcessorOptions("instance1"))
+	require.NoError(t, err)
+
+	stop := runChangeFeedProcessor(t, p)
+	require.Eventually(t, func() bool { return p.isProcessing(changeFeedLeaseID(testFeedRangeLow)) }, 5*time.Second, 5*time.Millisecond)
+	require.Error(t, p.Run(context.Background()))
+	stop()
+}
+
+func TestNewChangeFeedProcessor_Options(t *testing.T) {
+	feed := &fakeChangeFeed{}
+	handler := (&changeCollector{}).handle
+
+	p, err := newChangeFeedProcessor(feed, newInMemoryLeaseStore(), handler, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, p.InstanceName())
+	require.Equal(t, defaultChangeFeedPollInterval, p.pollInterval)
+	require.Equal(t, defaultChangeFeedLeaseExpirationInterval, p.leaseExpirationInterval)
+
+	_, err = newChangeFeedProcessor(feed, nil, handler, nil)
+	require.Error(t, err)
+	_, err = newChangeFeedProcessor(feed, newInMemoryLeaseStore(), nil, nil)
+	require.Error(t, err)
+	_, err = newChangeFeedProcessor(feed, newInMemoryLeaseStore(), handler, &ChangeFeedProcessorOptions{LeaseRenewInterval: time.Minute, LeaseExpirationInterval: time.Second})
+	require.Error(t, err)
+}
+
+// lsnChangeFeed is a change feed whose ranges' latest LSN is in the session token of its responses.
+type lsnChangeFeed struct {
+	fakeChangeFeed
+	latestLSN int64
+}
+
+func (f *lsnChangeFeed) ReadChangeFeed(ctx context.Context, options *ChangeFeedOptions) (ChangeFeedResponse, error) {
+	resp, err := f.fakeChangeFeed.ReadChangeFeed(ctx, options)
+	if err != nil {
+		return resp, err
+	}
+	header := http.Header{}
+	header.Set(cosmosHeaderSessionToken, fmt.Sprintf("0:-1#%d", f.latestLSN))
+	resp.RawResponse = &http.Response{StatusCode: http.StatusOK, Header: header}
+	return resp, nil
+}
+
+func TestChangeFeedEstimator(t *testing.T) {
+	feed := &lsnChangeFeed{
+		fakeChangeFeed: fakeChangeFeed{items: map[FeedRange][]string{
+			testFeedRangeLow:  {`{"id":"1","_lsn":7}`, `{"id":"2","_lsn":9}`},
+			testFeedRangeHigh: {`{"id":"3","_lsn":10}`},
+		}},
+		latestLSN: 10,
+	}
+
+	// the lease of the high range processed its only item.
+	highToken := newCompositeContinuationToken("rid", []changeFeedRange{newChangeFeedRange("20", "FF", &ChangeFeedRangeOptions{ContinuationToken: to(azcore.ETag("1"))})})
+	highContinuation, err := serializeCompositeContinuationToken(&highToken)
+	require.NoError(t, err)
+
+	store := newInMemoryLeaseStore(
+		ChangeFeedLease{ID: changeFeedLeaseID(testFeedRangeLow), FeedRange: testFeedRangeLow, Owner: "instance1"},
+		ChangeFeedLease{ID: changeFeedLeaseID(testFeedRangeHigh), FeedRange: testFeedRangeHigh, ContinuationToken: highContinuation},
+	)
+
+	lags, err := newChangeFeedEstimator(feed, store, nil).GetEstimatedLag(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []ChangeFeedLag{
+		{LeaseID: changeFeedLeaseID(testFeedRangeLow), FeedRange: testFeedRangeLow, Owner: "instance1", EstimatedLag: 4},
+		{LeaseID: changeFeedLeaseID(testFeedRangeHigh), FeedRange: testFeedRangeHigh, EstimatedLag: 0},
+	}, lags)
+}
+
+func TestParseSessionTokenLSN(t *testing.T) {
+	for token, expected := range map[string]int64{
+		"0:-1#12345":          12345,
+		"3:2#42#1=40#2=41":    42,
+		"0:1#7":               7,
+		"":                    -1,
+		"0:-1":                -1,
+		"0:-1#notanumber#1=2": -1,
+	} {
+		lsn, ok := parseSessionTokenLSN(token)
+		if expected < 0 {
+			require.False(t, ok, token)
+			continue
+		}
+		require.True(t, ok, token)
+		require.Equal(t, expected, lsn, token)
+	}
+}
+
+func to[T any](v T) *T {
+	return &v
+}
@@ -18,8 +18,13 @@ type ChangeFeedOptions struct {
 
 	// StartFrom is a user-friendly way to specify the time for change feed
 	// Will be set to the IfModifiedSince header
+	// It isn't supported in ChangeFeedModeAllVersionsAndDeletes.
 	StartFrom *time.Time
 
+	// Mode defines which changes are returned. The default is ChangeFeedModeLatestVersion.
+	// A continuation token can only be used with the mode it was read with.
+	Mode ChangeFeedMode
+
 	// PartitionKey is the logical partition key value for the request.
 	// Use this to read from a specific logical partition.
 	PartitionKey *PartitionKey
@@ -37,6 +42,9 @@ type ChangeFeedOptions struct {
 	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
 	// The valid range is 1 to 5 (inclusive).
 	ThroughputBucket *int32
+	// ThroughputControlGroupName selects the throughput control group of the operation, instead of the default group of the container.
+	// See ClientOptions.ThroughputControlGroups.
+	ThroughputControlGroupName *string
 }
 
 // buildRequestHeaders constructs the exact headers needed for a single
@@ -51,12 +59,27 @@ type ChangeFeedOptions struct {
 //
 // Returns an error when PartitionKey serialization fails — sending a
 // change-feed read with a missing PK header would yield an opaque
-// server-side error, so we surface the cause to the caller instead.
+// server-side error, so we surface the cause to the caller instead —
+// and when Mode is unknown or doesn't support the other options.
 func (options *ChangeFeedOptions) buildRequestHeaders(head changeFeedRange, resolvedPKRangeID string) (map[string]string, error) {
 	headers := make(map[string]string, 6)
 	headers[cosmosHeaderChangeFeed] = cosmosHeaderValuesChangeFeed
 
+	allVersionsAndDeletes := false
 	if options != nil {
+		switch options.Mode {
+		case "", ChangeFeedModeLatestVersion:
+		case ChangeFeedModeAllVersionsAndDeletes:
+			if options.StartFrom != nil {
+				return nil, fmt.Errorf("ChangeFeedOptions: StartFrom isn't supported in %s mode", options.Mode)
+			}
+			allVersionsAndDeletes = true
+			headers[cosmosHeaderChangeFeed] = cosmosHeaderValuesChangeFeedAllVersionsAndDeletes
+			headers[cosmosHeaderChangeFeedWireFormatVersion] = cosmosHeaderValuesChangeFeedWireFormatVersion
+		default:
+			return nil, fmt.Errorf("ChangeFeedOptions: unknown Mode %q", options.Mode)
+		}
+
 		if options.MaxItemCount > 0 {
 			headers[cosmosHeaderMaxItemCount] = strconv.FormatInt(int64(options.MaxItemCount), 10)
 		}
@@ -74,6 +97,9 @@ func (options *ChangeFeedOptions) buildRequestHeaders(head changeFeedRange, reso
 
 	if head.ContinuationToken != nil && *head.ContinuationToken != "" {
 		headers[headerIfNoneMatch] = string(*head.ContinuationToken)
+	} else if allVersionsAndDeletes {
+		// all versions and deletes mode can only start from the current time.
+		headers[headerIfNoneMatch] = "*"
 	}
 
 	if resolvedPKRangeID != "" {
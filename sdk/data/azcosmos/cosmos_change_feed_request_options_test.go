@@ -95,3 +95,40 @@ func TestChangeFeedOptions_BuildRequestHeaders_PartitionKeySerializationError(t
 	_, err := options.buildRequestHeaders(changeFeedRange{}, "")
 	require.Error(t, err, "buildRequestHeaders must surface PartitionKey serialization errors")
 }
+
+// TestChangeFeedOptions_BuildRequestHeaders_AllVersionsAndDeletes verifies the
+// full-fidelity AIM and wire format headers, and that a head without a
+// continuation starts from now (If-None-Match: *) while a head with one resumes.
+func TestChangeFeedOptions_BuildRequestHeaders_AllVersionsAndDeletes(t *testing.T) {
+	options := &ChangeFeedOptions{Mode: ChangeFeedModeAllVersionsAndDeletes, MaxItemCount: 10}
+
+	headers, err := options.buildRequestHeaders(changeFeedRange{MinInclusive: "00", MaxExclusive: "FF"}, "0")
+	require.NoError(t, err)
+	require.Equal(t, cosmosHeaderValuesChangeFeedAllVersionsAndDeletes, headers[cosmosHeaderChangeFeed])
+	require.Equal(t, cosmosHeaderValuesChangeFeedWireFormatVersion, headers[cosmosHeaderChangeFeedWireFormatVersion])
+	require.Equal(t, "10", headers[cosmosHeaderMaxItemCount])
+	require.Equal(t, "*", headers[headerIfNoneMatch], "a head without a continuation must start from now")
+
+	etag := azcore.ETag("\"42\"")
+	headers, err = options.buildRequestHeaders(changeFeedRange{MinInclusive: "00", MaxExclusive: "FF", ContinuationToken: &etag}, "0")
+	require.NoError(t, err)
+	require.Equal(t, string(etag), headers[headerIfNoneMatch])
+
+	latest, err := (&ChangeFeedOptions{Mode: ChangeFeedModeLatestVersion}).buildRequestHeaders(changeFeedRange{}, "")
+	require.NoError(t, err)
+	require.Equal(t, cosmosHeaderValuesChangeFeed, latest[cosmosHeaderChangeFeed])
+	_, hasWireFormat := latest[cosmosHeaderChangeFeedWireFormatVersion]
+	require.False(t, hasWireFormat, "latest version mode must not send the wire format version")
+}
+
+// TestChangeFeedOptions_BuildRequestHeaders_InvalidMode verifies that an
+// unknown mode, and StartFrom in all versions and deletes mode, are rejected
+// instead of being sent to the service.
+func TestChangeFeedOptions_BuildRequestHeaders_InvalidMode(t *testing.T) {
+	_, err := (&ChangeFeedOptions{Mode: "FullFidelity"}).buildRequestHeaders(changeFeedRange{}, "")
+	require.Error(t, err)
+
+	now := time.Now()
+	_, err = (&ChangeFeedOptions{Mode: ChangeFeedModeAllVersionsAndDeletes, StartFrom: &now}).buildRequestHeaders(changeFeedRange{}, "")
+	require.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -221,3 +222,57 @@ func TestChangeFeedResponseWithoutFeedRange(t *testing.T) {
 		t.Errorf("expected GetCompositeContinuationToken to return empty string when FeedRange is nil, got: %q", tokenStr)
 	}
 }
+
+func TestChangeFeedResponseAllVersionsAndDeletesItems(t *testing.T) {
+	response := ChangeFeedResponse{Items: [][]byte{
+		[]byte(`{"current":{"id":"1","pk":"a","value":1},"metadata":{"operationType":"create","lsn":10,"crts":1700000000,"timeToLiveExpired":false}}`),
+		[]byte(`{"current":{"id":"1","pk":"a","value":2},"previous":{"id":"1","pk":"a","value":1},"metadata":{"operationType":"replace","lsn":11,"previousImageLSN":10,"crts":1700000001}}`),
+		[]byte(`{"previous":{"id":"1","pk":"a","value":2},"metadata":{"operationType":"delete","lsn":12,"previousImageLSN":11,"crts":1700000002,"timeToLiveExpired":true,"id":"1","partitionKey":{"pk":"a"}}}`),
+	}}
+
+	items, err := response.AllVersionsAndDeletesItems()
+	if err != nil {
+		t.Fatalf("AllVersionsAndDeletesItems returned error: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+
+	create := items[0]
+	if create.Metadata.OperationType != ChangeFeedOperationTypeCreate || create.Metadata.LSN != 10 {
+		t.Errorf("unexpected create metadata: %+v", create.Metadata)
+	}
+	if !create.Metadata.ConflictResolutionTimestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected conflict resolution timestamp: %v", create.Metadata.ConflictResolutionTimestamp)
+	}
+	if create.Previous != nil {
+		t.Errorf("expected no previous image for a create, got %s", create.Previous)
+	}
+
+	replace := items[1]
+	if replace.Metadata.OperationType != ChangeFeedOperationTypeReplace || replace.Metadata.PreviousImageLSN != 10 {
+		t.Errorf("unexpected replace metadata: %+v", replace.Metadata)
+	}
+	var current, previous struct{ Value int }
+	if err := json.Unmarshal(replace.Current, &current); err != nil || current.Value != 2 {
+		t.Errorf("unexpected current image %s: %v", replace.Current, err)
+	}
+	if err := json.Unmarshal(replace.Previous, &previous); err != nil || previous.Value != 1 {
+		t.Errorf("unexpected previous image %s: %v", replace.Previous, err)
+	}
+
+	del := items[2]
+	if del.Metadata.OperationType != ChangeFeedOperationTypeDelete || !del.Metadata.TimeToLiveExpired {
+		t.Errorf("unexpected delete metadata: %+v", del.Metadata)
+	}
+	if del.Current != nil {
+		t.Errorf("expected no current image for a delete, got %s", del.Current)
+	}
+	if del.Metadata.ID != "1" || del.Metadata.PartitionKey["pk"] != "a" {
+		t.Errorf("unexpected deleted item identity: %q %v", del.Metadata.ID, del.Metadata.PartitionKey)
+	}
+
+	if _, err := (ChangeFeedResponse{Items: [][]byte{[]byte(`not json`)}}).AllVersionsAndDeletesItems(); err == nil {
+		t.Error("expected an error for an invalid item")
+	}
+}
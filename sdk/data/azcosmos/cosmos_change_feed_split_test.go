@@ -617,3 +617,122 @@ func TestReadChangeFeed_410BudgetExhaustedMidDrain_SurfacesPartialState(t *testi
 	require.NotEmpty(t, resp.ContinuationToken,
 		"partial response must carry a rotated continuation token after 410-budget exhaustion")
 }
+
+// TestReadChangeFeed_SubRange_SendsEPKHeaders verifies that a feed range that covers
+// only part of a physical partition is scoped with the start and end EPK headers, so
+// that the gateway only returns the changes of the sub-range, and that a feed range
+// that matches the physical partition is read without them.
+func TestReadChangeFeed_SubRange_SendsEPKHeaders(t *testing.T) {
+	srv, closeSrv := mock.NewTLSServer()
+	defer closeSrv()
+
+	var mu sync.Mutex
+	var headers []http.Header
+	capture := policyFunc(func(req *policy.Request) (*http.Response, error) {
+		if req.Raw().Header.Get(cosmosHeaderChangeFeed) != "" {
+			mu.Lock()
+			headers = append(headers, req.Raw().Header.Clone())
+			mu.Unlock()
+		}
+		return req.Next()
+	})
+
+	ranges := []partitionKeyRange{
+		{ID: "0", MinInclusive: "", MaxExclusive: "FF", ResourceID: "testRID"},
+	}
+	client := createChangeFeedTestClient(t, srv, []policy.Policy{capture}, ranges)
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+
+	cfBody := []byte(`{"_rid":"testRID","Documents":[{"id":"doc"}],"_count":1}`)
+	for i := 0; i < 2; i++ {
+		srv.AppendResponse(mock.WithBody(cfBody), mock.WithStatusCode(200),
+			mock.WithHeader(cosmosHeaderEtag, "\"etag\""))
+	}
+
+	_, err := container.ReadChangeFeed(context.Background(), &ChangeFeedOptions{
+		FeedRange: &FeedRange{MinInclusive: "20", MaxExclusive: "40"},
+	})
+	require.NoError(t, err)
+
+	_, err = container.ReadChangeFeed(context.Background(), &ChangeFeedOptions{
+		FeedRange: &FeedRange{MinInclusive: "", MaxExclusive: "FF"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, headers, 2)
+	require.Equal(t, "20", headers[0].Get(cosmosHeaderStartEpk))
+	require.Equal(t, "40", headers[0].Get(cosmosHeaderEndEpk))
+	require.Empty(t, headers[1].Get(cosmosHeaderStartEpk), "a full physical range must not be scoped")
+	require.Empty(t, headers[1].Get(cosmosHeaderEndEpk))
+}
+
+// TestReadChangeFeed_AllVersionsAndDeletes_ContinuesAcrossRanges verifies that
+// all versions and deletes mode drains a FeedRange spanning several physical
+// partitions with the full-fidelity headers, starting each range from now, and
+// that its composite continuation token resumes each range from its own ETag.
+func TestReadChangeFeed_AllVersionsAndDeletes_ContinuesAcrossRanges(t *testing.T) {
+	srv, closeSrv := mock.NewTLSServer()
+	defer closeSrv()
+
+	var mu sync.Mutex
+	var headers []http.Header
+	capture := policyFunc(func(req *policy.Request) (*http.Response, error) {
+		if req.Raw().Header.Get(cosmosHeaderChangeFeed) != "" {
+			mu.Lock()
+			headers = append(headers, req.Raw().Header.Clone())
+			mu.Unlock()
+		}
+		return req.Next()
+	})
+
+	ranges := []partitionKeyRange{
+		{ID: "1a", MinInclusive: "00", MaxExclusive: "55", ResourceID: "testRID"},
+		{ID: "1b", MinInclusive: "55", MaxExclusive: "FF", ResourceID: "testRID"},
+	}
+	client := createChangeFeedTestClient(t, srv, []policy.Policy{capture}, ranges)
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+
+	deleteBody := []byte(`{"_rid":"testRID","Documents":[{"previous":{"id":"doc"},"metadata":{"operationType":"delete","lsn":7,"previousImageLSN":5,"crts":1700000000,"id":"doc","partitionKey":{"pk":"a"}}}],"_count":1}`)
+	srv.AppendResponse(mock.WithStatusCode(304), mock.WithHeader(cosmosHeaderEtag, "\"etag-1a\""))
+	srv.AppendResponse(mock.WithBody(deleteBody), mock.WithStatusCode(200),
+		mock.WithHeader(cosmosHeaderEtag, "\"etag-1b\""))
+
+	resp, err := container.ReadChangeFeed(context.Background(), &ChangeFeedOptions{
+		Mode:      ChangeFeedModeAllVersionsAndDeletes,
+		FeedRange: &FeedRange{MinInclusive: "00", MaxExclusive: "FF"},
+	})
+	require.NoError(t, err)
+
+	items, err := resp.AllVersionsAndDeletesItems()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, ChangeFeedOperationTypeDelete, items[0].Metadata.OperationType)
+	require.Equal(t, int64(7), items[0].Metadata.LSN)
+	require.Equal(t, "doc", items[0].Metadata.ID)
+
+	require.Len(t, headers, 2)
+	for _, h := range headers {
+		require.Equal(t, cosmosHeaderValuesChangeFeedAllVersionsAndDeletes, h.Get(cosmosHeaderChangeFeed))
+		require.Equal(t, cosmosHeaderValuesChangeFeedWireFormatVersion, h.Get(cosmosHeaderChangeFeedWireFormatVersion))
+		require.Equal(t, "*", h.Get(headerIfNoneMatch), "ranges without a continuation must start from now")
+	}
+
+	// Resume from the composite token: each range continues from its own ETag.
+	srv.AppendResponse(mock.WithStatusCode(304), mock.WithHeader(cosmosHeaderEtag, "\"etag-1a\""))
+	srv.AppendResponse(mock.WithStatusCode(304), mock.WithHeader(cosmosHeaderEtag, "\"etag-1b\""))
+
+	headers = nil
+	resp, err = container.ReadChangeFeed(context.Background(), &ChangeFeedOptions{
+		Mode:         ChangeFeedModeAllVersionsAndDeletes,
+		Continuation: &resp.ContinuationToken,
+	})
+	require.NoError(t, err)
+	require.Empty(t, resp.Items)
+
+	require.Len(t, headers, 2)
+	require.Equal(t, "\"etag-1a\"", headers[0].Get(headerIfNoneMatch))
+	require.Equal(t, "\"etag-1b\"", headers[1].Get(headerIfNoneMatch))
+	require.Equal(t, cosmosHeaderValuesChangeFeedAllVersionsAndDeletes, headers[1].Get(cosmosHeaderChangeFeed))
+}
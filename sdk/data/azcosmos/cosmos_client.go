@@ -35,7 +35,10 @@ type Client struct {
 	gem         *globalEndpointManager
 	endpointUrl *url.URL
 	caches      *sharedCacheSet
-	closeOnce   sync.Once
+	itemEncoder ItemEncoder
+	// throughputController applies the throughput control groups, or is nil if there are none.
+	throughputController *throughputController
+	closeOnce            sync.Once
 }
 
 // getContainerCache returns the container properties cache for this client.
@@ -59,6 +62,14 @@ func (c *Client) Endpoint() string {
 	return c.endpoint
 }
 
+// getItemEncoder returns the encoder of the typed item functions.
+func (c *Client) getItemEncoder() ItemEncoder {
+	if c.itemEncoder == nil {
+		return jsonItemEncoder{}
+	}
+	return c.itemEncoder
+}
+
 // Close releases the shared cache reference for this client. The underlying
 // caches are removed from the global registry once all clients to the same
 // account endpoint have been closed. After Close, the client should not be used.
@@ -68,6 +79,9 @@ func (c *Client) Close() {
 		if c.endpoint != "" {
 			releaseCaches(c.endpoint)
 		}
+		if c.throughputController != nil {
+			c.throughputController.close()
+		}
 	})
 }
 
@@ -87,16 +101,27 @@ func NewClientWithKey(endpoint string, cred KeyCredential, o *ClientOptions) (*C
 	}
 	o = withDefaultTransport(o)
 
+	throughputController, err := newThroughputController(o)
+	if err != nil {
+		return nil, err
+	}
+
 	gem, err := newGlobalEndpointManager(endpoint, newInternalPipeline(newSharedKeyCredPolicy(cred), o), preferredRegions, 0, enableCrossRegionRetries)
 	if err != nil {
 		return nil, err
 	}
 
-	internalClient, err := newClient(newSharedKeyCredPolicy(cred), gem, o)
+	internalClient, err := newClient(newSharedKeyCredPolicy(cred), gem, throughputController, o)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{endpoint: endpoint, endpointUrl: endpointUrl, internal: internalClient, gem: gem, caches: acquireCaches(endpoint)}, nil
+	client := &Client{endpoint: endpoint, endpointUrl: endpointUrl, internal: internalClient, gem: gem, caches: acquireCaches(endpoint), itemEncoder: o.ItemEncoder, throughputController: throughputController}
+	if throughputController != nil {
+		throughputController.client = client
+	}
+	gem.partitionBreaker.resolvePartitionKeyRangeID = client.cachedPartitionKeyRangeID
+	gem.partitionBreaker.populatePartitionKeyRanges = client.populatePartitionKeyRanges
+	return client, nil
 }
 
 // NewClient creates a new instance of Cosmos client with Azure AD access token authentication. It uses the default pipeline configuration.
@@ -134,16 +159,27 @@ func NewClient(endpoint string, cred azcore.TokenCredential, o *ClientOptions) (
 		preferredRegions = o.PreferredRegions
 	}
 	o = withDefaultTransport(o)
+	throughputController, err := newThroughputController(o)
+	if err != nil {
+		return nil, err
+	}
+
 	gem, err := newGlobalEndpointManager(endpoint, newInternalPipeline(newCosmosBearerTokenPolicy(cred, scope, nil), o), preferredRegions, 0, enableCrossRegionRetries)
 	if err != nil {
 		return nil, err
 	}
 
-	internalClient, err := newClient(newCosmosBearerTokenPolicy(cred, scope, nil), gem, o)
+	internalClient, err := newClient(newCosmosBearerTokenPolicy(cred, scope, nil), gem, throughputController, o)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{endpoint: endpoint, endpointUrl: endpointUrl, internal: internalClient, gem: gem, caches: acquireCaches(endpoint)}, nil
+	client := &Client{endpoint: endpoint, endpointUrl: endpointUrl, internal: internalClient, gem: gem, caches: acquireCaches(endpoint), itemEncoder: o.ItemEncoder, throughputController: throughputController}
+	if throughputController != nil {
+		throughputController.client = client
+	}
+	gem.partitionBreaker.resolvePartitionKeyRangeID = client.cachedPartitionKeyRangeID
+	gem.partitionBreaker.populatePartitionKeyRanges = client.populatePartitionKeyRanges
+	return client, nil
 }
 
 // NewClientFromConnectionString creates a new instance of Cosmos client from connection string. It uses the default pipeline configuration.
@@ -182,13 +218,31 @@ func NewClientFromConnectionString(connectionString string, o *ClientOptions) (*
 	return NewClientWithKey(endpoint, cred, o)
 }
 
-func newClient(authPolicy policy.Policy, gem *globalEndpointManager, options *ClientOptions) (*azcore.Client, error) {
+func newClient(authPolicy policy.Policy, gem *globalEndpointManager, throughputController *throughputController, options *ClientOptions) (*azcore.Client, error) {
 	if options == nil {
 		options = &ClientOptions{}
 	}
 	if options.Logging.AllowedHeaders == nil {
 		options.Logging.AllowedHeaders = getAllowedHeaders()
 	}
+	perRetryPolicies := []policy.Policy{
+		// clientRetryPolicy is listed before authPolicy so that
+		// its internal retry loop (continue inside Do) naturally
+		// re-invokes authPolicy via req.Next() on each attempt.
+		// This refreshes the Authorization header from the
+		// credential cache on every internal retry — important
+		// for short-lived AAD/MSI tokens that may expire across
+		// the cumulative same-region + cross-region retry
+		// window. Cosmos master/resource keys are unaffected
+		// because they are static.
+		&clientRetryPolicy{gem: gem},
+	}
+	if throughputController != nil {
+		// throughputControlPolicy follows clientRetryPolicy so that
+		// every attempt is charged to its throughput control group.
+		perRetryPolicies = append(perRetryPolicies, &throughputControlPolicy{controller: throughputController})
+	}
+	perRetryPolicies = append(perRetryPolicies, authPolicy)
 	return azcore.NewClient(moduleName, serviceLibVersion,
 		azruntime.PipelineOptions{
 			PerCall: []policy.Policy{
@@ -199,19 +253,7 @@ func newClient(authPolicy policy.Policy, gem *globalEndpointManager, options *Cl
 				},
 				&globalEndpointManagerPolicy{gem: gem},
 			},
-			PerRetry: []policy.Policy{
-				// clientRetryPolicy is listed before authPolicy so that
-				// its internal retry loop (continue inside Do) naturally
-				// re-invokes authPolicy via req.Next() on each attempt.
-				// This refreshes the Authorization header from the
-				// credential cache on every internal retry — important
-				// for short-lived AAD/MSI tokens that may expire across
-				// the cumulative same-region + cross-region retry
-				// window. Cosmos master/resource keys are unaffected
-				// because they are static.
-				&clientRetryPolicy{gem: gem},
-				authPolicy,
-			},
+			PerRetry: perRetryPolicies,
 			Tracing: azruntime.TracingOptions{
 				Namespace: "Microsoft.DocumentDB",
 			},
@@ -25,4 +25,10 @@ type ClientOptions struct {
 	// The valid range is 1 to 5 (inclusive).
 	// Can be overridden per-request via the operation options.
 	ThroughputBucket *int32
+	// ItemEncoder marshals and unmarshals the items of the typed item functions, such as ReadItemAs and UpsertItemAs.
+	// The default uses encoding/json.
+	ItemEncoder ItemEncoder
+	// ThroughputControlGroups limit the throughput that the operations on items of this client consume from containers.
+	// Operations select a group with the ThroughputControlGroupName of their options, or use the default group of the container.
+	ThroughputControlGroups []ThroughputControlGroup
 }
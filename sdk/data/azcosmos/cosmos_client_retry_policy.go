@@ -13,6 +13,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"runtime/debug"
 	"sync/atomic"
 	"syscall"
@@ -192,6 +193,7 @@ func (p *clientRetryPolicy) Do(req *policy.Request) (*http.Response, error) {
 		return nil, fmt.Errorf("failed to obtain request options, please check request being sent: %s", req.Body())
 	}
 
+	routing := newRequestRouting(p.gem.partitionBreaker, req, o)
 	retryContext := retryContext{}
 	for {
 		// Update the retry context with the latest retry values
@@ -202,7 +204,14 @@ func (p *clientRetryPolicy) Do(req *policy.Request) (*http.Response, error) {
 			locationIndex = 0
 			retryContext.resolveFromHead = false
 		}
-		resolvedEndpoint := p.gem.ResolveServiceEndpoint(locationIndex, o.resourceType, o.isWriteOperation, retryContext.useWriteEndpoint)
+		var resolvedEndpoint url.URL
+		if routing.needsResolve() {
+			var skippedRegions []regionId
+			resolvedEndpoint, skippedRegions = p.gem.ResolveServiceEndpointExcluding(locationIndex, o.resourceType, o.isWriteOperation, retryContext.useWriteEndpoint, routing.skip)
+			recordRoutingDecisions(req, &routing, skippedRegions)
+		} else {
+			resolvedEndpoint = p.gem.ResolveServiceEndpoint(locationIndex, o.resourceType, o.isWriteOperation, retryContext.useWriteEndpoint)
+		}
 		regionName := p.gem.GetEndpointLocation(resolvedEndpoint)
 		req.Raw().Host = resolvedEndpoint.Host
 		req.Raw().URL.Host = resolvedEndpoint.Host
@@ -212,6 +221,9 @@ func (p *clientRetryPolicy) Do(req *policy.Request) (*http.Response, error) {
 			if state := requestDiagnosticsStateFromContext(req.Raw().Context()); state != nil && state.clientSideStats != nil {
 				state.clientSideStats.recordHTTPError(attemptStartTime, req.Raw(), err, o.resourceType, regionName.String())
 			}
+			if req.Raw().Context().Err() == nil && routing.recordError(regionName, err) {
+				recordPartitionMarkedUnavailable(req, &routing, regionName)
+			}
 			// Honor the caller's context: if their deadline expired or
 			// they cancelled the request, do not consume their budget
 			// with our retries. Preserve both the cancellation reason
@@ -241,6 +253,9 @@ func (p *clientRetryPolicy) Do(req *policy.Request) (*http.Response, error) {
 			state.clientSideStats.recordHTTPResponse(attemptStartTime, response, o.resourceType, regionName.String())
 		}
 		subStatus := response.Header.Get(cosmosHeaderSubstatus)
+		if routing.recordResponse(regionName, response.StatusCode, subStatus) {
+			recordPartitionMarkedUnavailable(req, &routing, regionName)
+		}
 		if p.shouldRetryStatus(response.StatusCode, subStatus) {
 			retryContext.useWriteEndpoint = false
 			// advanceLocation gates whether the post-switch logic advances
@@ -306,6 +321,35 @@ func (p *clientRetryPolicy) Do(req *policy.Request) (*http.Response, error) {
 
 }
 
+// recordRoutingDecisions records the regions that were skipped to route the request in its diagnostics.
+func recordRoutingDecisions(req *policy.Request, routing *requestRouting, skippedRegions []regionId) {
+	state := requestDiagnosticsStateFromContext(req.Raw().Context())
+	if state == nil || state.clientSideStats == nil {
+		return
+	}
+	for _, region := range skippedRegions {
+		decision := routingDecision{region: region.String(), reason: routing.skipReason(region)}
+		if decision.reason == routingReasonPartitionUnavailable {
+			decision.partition = routing.partitionString()
+		}
+		state.clientSideStats.recordRoutingDecision(decision)
+	}
+}
+
+// recordPartitionMarkedUnavailable records in the diagnostics of the request that its failure made the region
+// unavailable for its partition key range.
+func recordPartitionMarkedUnavailable(req *policy.Request, routing *requestRouting, region regionId) {
+	state := requestDiagnosticsStateFromContext(req.Raw().Context())
+	if state == nil || state.clientSideStats == nil {
+		return
+	}
+	state.clientSideStats.recordRoutingDecision(routingDecision{
+		region:    region.String(),
+		reason:    routingReasonPartitionMarkedUnavailable,
+		partition: routing.partitionString(),
+	})
+}
+
 func (p *clientRetryPolicy) shouldRetryStatus(status int, subStatus string) (shouldRetry bool) {
 	if (status == http.StatusForbidden && (subStatus == subStatusWriteForbidden || subStatus == subStatusDatabaseAccountNotFound)) ||
 		(status == http.StatusNotFound && subStatus == subStatusReadSessionNotAvailable) ||
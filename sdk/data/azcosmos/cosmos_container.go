@@ -279,6 +279,8 @@ func (c *ContainerClient) CreateItem(
 		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+		h.excludedRegions = o.ExcludedRegions
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -338,6 +340,8 @@ func (c *ContainerClient) UpsertItem(
 		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+		h.excludedRegions = o.ExcludedRegions
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -395,6 +399,8 @@ func (c *ContainerClient) ReplaceItem(
 		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+		h.excludedRegions = o.ExcludedRegions
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -449,6 +455,8 @@ func (c *ContainerClient) ReadItem(
 	}
 	h.priorityLevel = o.PriorityLevel
 	h.throughputBucket = o.ThroughputBucket
+	h.throughputControlGroup = o.ThroughputControlGroupName
+	h.excludedRegions = o.ExcludedRegions
 
 	operationContext := pipelineRequestOptions{
 		resourceType:          resourceTypeDocument,
@@ -501,8 +509,9 @@ func (c *ContainerClient) ReadManyItems(
 	}
 
 	h := headerOptionsOverride{
-		priorityLevel:    readManyOptions.PriorityLevel,
-		throughputBucket: readManyOptions.ThroughputBucket,
+		priorityLevel:          readManyOptions.PriorityLevel,
+		throughputBucket:       readManyOptions.ThroughputBucket,
+		throughputControlGroup: readManyOptions.ThroughputControlGroupName,
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -573,6 +582,8 @@ func (c *ContainerClient) DeleteItem(
 		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+		h.excludedRegions = o.ExcludedRegions
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -633,6 +644,8 @@ func (c *ContainerClient) NewQueryItemsPager(query string, partitionKey Partitio
 		queryOptions = &originalOptions
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+		h.excludedRegions = o.ExcludedRegions
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -716,6 +729,8 @@ func (c *ContainerClient) PatchItem(
 		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+		h.excludedRegions = o.ExcludedRegions
 	}
 
 	operationContext := pipelineRequestOptions{
@@ -774,6 +789,7 @@ func (c *ContainerClient) ExecuteTransactionalBatch(ctx context.Context, b Trans
 		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
 		h.priorityLevel = o.PriorityLevel
 		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
 	}
 
 	// If contentResponseOnWrite is not enabled at the client level the
@@ -814,6 +830,43 @@ func (c *ContainerClient) ExecuteTransactionalBatch(ctx context.Context, b Trans
 	return response, err
 }
 
+// ExecuteBulk executes operations, on any partition keys, in bulk.
+// The operations are grouped by partition key range and sent in non-atomic batch requests, so each operation succeeds or fails on its own.
+// Throttled operations are retried, and the requests to a partition key range slow down while the range throttles them.
+// Operations on a partition key range that was split are retried on the new partition key ranges.
+// Once executed, verify the Success property of the response, and the StatusCode of each operation result, to determine which operations succeeded.
+func (c *ContainerClient) ExecuteBulk(ctx context.Context, b BulkOperations, o *BulkOptions) (BulkResponse, error) {
+	var err error
+	spanName, err := c.getSpanForContainer(operationTypeBatch, resourceTypeCollection, c.id)
+	if err != nil {
+		return BulkResponse{}, err
+	}
+	ctx, endSpan := startSpan(ctx, spanName.name, c.database.client.internal.Tracer(), &spanName.options)
+	defer func() { endSpan(err) }()
+	if len(b.operations) == 0 {
+		return BulkResponse{}, errors.New("no operations in bulk")
+	}
+
+	h := headerOptionsOverride{}
+
+	if o == nil {
+		o = &BulkOptions{}
+	} else {
+		h.enableContentResponseOnWrite = &o.EnableContentResponseOnWrite
+		h.priorityLevel = o.PriorityLevel
+		h.throughputBucket = o.ThroughputBucket
+		h.throughputControlGroup = o.ThroughputControlGroupName
+	}
+
+	executor, err := newBulkExecutor(c, b.operations, o, h)
+	if err != nil {
+		return BulkResponse{}, err
+	}
+
+	response, err := executor.execute(ctx)
+	return response, err
+}
+
 // ReadChangeFeed retrieves a single page of the change feed using the provided options.
 // ctx - The context for the request.
 // options - Options for the operation
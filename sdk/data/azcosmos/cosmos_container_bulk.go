@@ -0,0 +1,429 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+const (
+	// maxOperationsPerBulkRequest is the maximum number of operations the service accepts in a batch request.
+	maxOperationsPerBulkRequest = 100
+	// maxBulkRequestBodySize keeps bulk requests well under the service's 2 MB limit, so that a throttled request
+	// doesn't resend much.
+	maxBulkRequestBodySize = 220 * 1024
+	// defaultBulkMaxConcurrencyPerRange is the default maximum number of requests sent at the same time to a
+	// partition key range.
+	defaultBulkMaxConcurrencyPerRange = 5
+	// maxBulkThrottleRetries is the number of times a throttled operation is retried before its 429 result is returned.
+	maxBulkThrottleRetries = 10
+	// defaultBulkThrottleDelay is the delay before retrying throttled operations, when the service doesn't specify one.
+	defaultBulkThrottleDelay = 100 * time.Millisecond
+)
+
+// bulkExecutor executes the operations of a BulkOperations. The operations are grouped by the partition key range
+// of their partition key, and each partition key range's operations are sent in non-atomic batch requests.
+//
+// The requests to each partition key range use additive-increase/multiplicative-decrease congestion control: a
+// range starts with one request at a time, gets one more concurrent request after each request that isn't
+// throttled, up to the maximum, and is halved, and paused for the retry delay, after each throttled request.
+type bulkExecutor struct {
+	container        *ContainerClient
+	options          *BulkOptions
+	headerOptions    headerOptionsOverride
+	path             string
+	maxConcurrency   int
+	partitionKeys    []PartitionKey
+	operations       []marshaledBulkOperation
+	results          []BulkOperationResult
+	throttleAttempts []int
+
+	mu            sync.Mutex
+	requestCharge float32
+}
+
+// bulkBatchOutcome is the outcome of a request for a batch of operations. Operations that completed, successfully
+// or not, have their results set in the executor.
+type bulkBatchOutcome struct {
+	batch []int
+	// throttled are the operations to retry after retryAfter.
+	throttled  []int
+	retryAfter time.Duration
+	// gone are the operations whose partition key range is gone, to retry with the new partition key ranges.
+	gone []int
+	// tooLarge is true if the request was too large and its operations should be retried in smaller requests.
+	tooLarge bool
+	err      error
+}
+
+func newBulkExecutor(c *ContainerClient, operations []bulkOperation, o *BulkOptions, h headerOptionsOverride) (*bulkExecutor, error) {
+	path, err := generatePathForNameBased(resourceTypeDocument, c.link, true)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConcurrency := defaultBulkMaxConcurrencyPerRange
+	if o.MaxConcurrencyPerPartitionKeyRange != nil && *o.MaxConcurrencyPerPartitionKeyRange > 0 {
+		maxConcurrency = int(*o.MaxConcurrencyPerPartitionKeyRange)
+	}
+
+	e := &bulkExecutor{
+		container:        c,
+		options:          o,
+		headerOptions:    h,
+		path:             path,
+		maxConcurrency:   maxConcurrency,
+		partitionKeys:    make([]PartitionKey, len(operations)),
+		operations:       make([]marshaledBulkOperation, len(operations)),
+		results:          make([]BulkOperationResult, len(operations)),
+		throttleAttempts: make([]int, len(operations)),
+	}
+
+	for i, op := range operations {
+		body, err := marshalBulkOperation(op)
+		if err != nil {
+			return nil, err
+		}
+		e.partitionKeys[i] = op.partitionKey
+		e.operations[i] = marshaledBulkOperation{operationType: op.operation.getOperationType(), body: body}
+	}
+	return e, nil
+}
+
+// execute executes all the operations. Operations whose partition key range was split are grouped again with the
+// refreshed partition key ranges, up to maxPKRangeGoneRetries times.
+func (e *bulkExecutor) execute(ctx context.Context) (BulkResponse, error) {
+	pending := make([]int, len(e.operations))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for attempt := 0; ; attempt++ {
+		pkDef, err := e.container.getPartitionKeyDefinition(ctx)
+		if err != nil {
+			return BulkResponse{}, err
+		}
+
+		pkRangeResp, err := e.container.getPartitionKeyRanges(ctx, nil)
+		if err != nil {
+			return BulkResponse{}, err
+		}
+
+		orderedRangeIDs, groups, err := groupBulkOperationsByPhysicalRange(pending, e.partitionKeys, pkDef, pkRangeResp.PartitionKeyRanges)
+		if err != nil {
+			return BulkResponse{}, err
+		}
+
+		gone, err := e.executeRanges(ctx, orderedRangeIDs, groups)
+		if err != nil {
+			return BulkResponse{}, err
+		}
+		if len(gone) == 0 {
+			break
+		}
+
+		if attempt == maxPKRangeGoneRetries {
+			return BulkResponse{}, errors.New("exhausted retries for partition key range gone")
+		}
+		if err := e.container.refreshPKRangeCache(ctx); err != nil {
+			return BulkResponse{}, err
+		}
+		pending = gone
+	}
+
+	response := BulkResponse{RequestCharge: e.requestCharge, OperationResults: e.results, Success: true}
+	for _, result := range e.results {
+		if result.StatusCode < 200 || result.StatusCode >= 300 {
+			response.Success = false
+			break
+		}
+	}
+	return response, nil
+}
+
+// groupBulkOperationsByPhysicalRange groups the pending operations by the physical partition key range of their
+// partition key. It returns the range IDs in first-seen order and the operations keyed by range ID.
+func groupBulkOperationsByPhysicalRange(pending []int, partitionKeys []PartitionKey, pkDef PartitionKeyDefinition, ranges []partitionKeyRange) ([]string, map[string][]int, error) {
+	routingMap := newCollectionRoutingMap(ranges, "")
+
+	order := make([]string, 0)
+	groups := make(map[string][]int)
+
+	for _, idx := range pending {
+		epkR, err := computeEPKRange(&partitionKeys[idx], pkDef)
+		if err != nil {
+			return nil, nil, err
+		}
+		if epkR.isRange() {
+			return nil, nil, fmt.Errorf("bulk operation at index %d has a partial partition key, operations need a value for every partition key path", idx)
+		}
+
+		rangeID, ok := findPhysicalRangeForEPK(epkR.Min, routingMap.orderedRanges)
+		if !ok {
+			return nil, nil, errors.New("could not find physical partition range for operation EPK")
+		}
+		if _, seen := groups[rangeID]; !seen {
+			order = append(order, rangeID)
+		}
+		groups[rangeID] = append(groups[rangeID], idx)
+	}
+
+	return order, groups, nil
+}
+
+// executeRanges executes the operations of each partition key range concurrently. It returns the operations whose
+// partition key range is gone. When a partition key range fails, the requests to the other ranges are cancelled.
+func (e *bulkExecutor) executeRanges(ctx context.Context, orderedRangeIDs []string, groups map[string][]int) ([]int, error) {
+	rangesCtx, cancelRanges := context.WithCancel(ctx)
+	defer cancelRanges()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var gone []int
+	var firstErr error
+
+	for _, rangeID := range orderedRangeIDs {
+		wg.Add(1)
+		go func(rangeID string, queue []int) {
+			defer wg.Done()
+			rangeGone, err := e.executeRange(rangesCtx, rangeID, queue)
+
+			mu.Lock()
+			defer mu.Unlock()
+			gone = append(gone, rangeGone...)
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancelRanges()
+			}
+		}(rangeID, groups[rangeID])
+	}
+
+	wg.Wait()
+	return gone, firstErr
+}
+
+// executeRange sends the operations of a partition key range, with congestion control.
+func (e *bulkExecutor) executeRange(ctx context.Context, rangeID string, queue []int) ([]int, error) {
+	var gone []int
+	var firstErr error
+	var resumeAt time.Time
+
+	limit := 1
+	maxBatchSize := maxOperationsPerBulkRequest
+	inFlight := 0
+	outcomes := make(chan bulkBatchOutcome)
+
+	for {
+		for firstErr == nil && inFlight < limit && len(queue) > 0 {
+			if wait := time.Until(resumeAt); wait > 0 {
+				// the in-flight requests complete before the range is paused.
+				if inFlight > 0 {
+					break
+				}
+				if err := waitForRetry(ctx, wait); err != nil {
+					firstErr = err
+					break
+				}
+			}
+
+			var batch []int
+			batch, queue = e.nextBatch(queue, maxBatchSize)
+			inFlight++
+			go func() {
+				outcomes <- e.sendBatch(ctx, rangeID, batch)
+			}()
+		}
+
+		if inFlight == 0 {
+			return gone, firstErr
+		}
+
+		outcome := <-outcomes
+		inFlight--
+		if firstErr != nil {
+			// the remaining requests are drained, so their goroutines don't leak.
+			continue
+		}
+		if outcome.err != nil {
+			firstErr = outcome.err
+			continue
+		}
+
+		gone = append(gone, outcome.gone...)
+
+		if outcome.tooLarge {
+			maxBatchSize = max(1, len(outcome.batch)/2)
+			queue = append(outcome.batch, queue...)
+			continue
+		}
+
+		if len(outcome.throttled) > 0 {
+			limit = max(1, limit/2)
+			resumeAt = time.Now().Add(outcome.retryAfter)
+			queue = append(outcome.throttled, queue...)
+		} else if limit < e.maxConcurrency {
+			limit++
+		}
+	}
+}
+
+// nextBatch takes the next operations of the queue for a request, up to maxBatchSize operations and
+// maxBulkRequestBodySize bytes. A batch always has at least one operation.
+func (e *bulkExecutor) nextBatch(queue []int, maxBatchSize int) ([]int, []int) {
+	size := 0
+	n := 0
+	for n < len(queue) && n < maxBatchSize {
+		opSize := len(e.operations[queue[n]].body)
+		if n > 0 && size+opSize > maxBulkRequestBodySize {
+			break
+		}
+		size += opSize
+		n++
+	}
+	return queue[:n:n], queue[n:]
+}
+
+// sendBatch sends a batch of operations to a partition key range, and sets the results of the operations that
+// completed.
+func (e *bulkExecutor) sendBatch(ctx context.Context, rangeID string, batch []int) bulkBatchOutcome {
+	outcome := bulkBatchOutcome{batch: batch}
+
+	h := e.headerOptions
+	ops := make([]batchOperation, len(batch))
+	for i, idx := range batch {
+		ops[i] = e.operations[idx]
+		// the service only returns the results of read operations when content response on write is enabled.
+		if ops[i].getOperationType() == operationTypeRead {
+			enableContentResponseOnWriteForReadOperations := true
+			h.enableContentResponseOnWrite = &enableContentResponseOnWriteForReadOperations
+		}
+	}
+
+	operationContext := pipelineRequestOptions{
+		resourceType:          resourceTypeDocument,
+		resourceAddress:       e.container.link,
+		isWriteOperation:      true,
+		headerOptionsOverride: &h}
+
+	azResponse, err := e.container.database.client.sendBatchRequest(
+		ctx,
+		e.path,
+		ops,
+		operationContext,
+		e.options,
+		func(req *policy.Request) {
+			req.Raw().Header.Set(cosmosHeaderPartitionKeyRangeId, rangeID)
+		})
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) {
+			outcome.err = err
+			return outcome
+		}
+		e.addRequestCharge(readRequestCharge(respErr.RawResponse))
+
+		switch {
+		case isPKRangeGoneResponseError(err):
+			outcome.gone = batch
+		case respErr.StatusCode == http.StatusTooManyRequests:
+			for _, idx := range batch {
+				e.throttle(&outcome, idx, BulkOperationResult{StatusCode: http.StatusTooManyRequests}, retryAfterFromResponse(respErr.RawResponse))
+			}
+		case respErr.StatusCode == http.StatusRequestEntityTooLarge && len(batch) > 1:
+			outcome.tooLarge = true
+		case respErr.StatusCode == http.StatusRequestEntityTooLarge:
+			e.results[batch[0]] = BulkOperationResult{StatusCode: http.StatusRequestEntityTooLarge}
+		default:
+			outcome.err = err
+		}
+		return outcome
+	}
+
+	e.addRequestCharge(readRequestCharge(azResponse))
+
+	responses, err := newBulkOperationResponses(azResponse)
+	if err != nil {
+		outcome.err = err
+		return outcome
+	}
+	if len(responses) != len(batch) {
+		outcome.err = fmt.Errorf("bulk response has %d results for %d operations", len(responses), len(batch))
+		return outcome
+	}
+
+	for i, idx := range batch {
+		r := responses[i]
+		switch {
+		case r.result.StatusCode == http.StatusTooManyRequests:
+			e.throttle(&outcome, idx, r.result, r.retryAfter)
+		case isPartitionKeyRangeGoneError(int(r.result.StatusCode), r.subStatus):
+			outcome.gone = append(outcome.gone, idx)
+		default:
+			e.results[idx] = r.result
+		}
+	}
+	return outcome
+}
+
+// throttle adds a throttled operation to the operations to retry, or sets its result if it was retried
+// maxBulkThrottleRetries times.
+func (e *bulkExecutor) throttle(outcome *bulkBatchOutcome, idx int, result BulkOperationResult, retryAfter time.Duration) {
+	if e.throttleAttempts[idx] == maxBulkThrottleRetries {
+		e.results[idx] = result
+		return
+	}
+	e.throttleAttempts[idx]++
+
+	if retryAfter <= 0 {
+		retryAfter = defaultBulkThrottleDelay
+	}
+	outcome.throttled = append(outcome.throttled, idx)
+	outcome.retryAfter = max(outcome.retryAfter, retryAfter)
+}
+
+func (e *bulkExecutor) addRequestCharge(charge float32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requestCharge += charge
+}
+
+// retryAfterFromResponse returns the retry delay of a throttled response, or 0 if it doesn't have one.
+func retryAfterFromResponse(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	ms, err := strconv.ParseFloat(resp.Header.Get(cosmosHeaderRetryAfterMs), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// getPartitionKeyDefinition returns the container's partition key definition, from the container cache if the
+// client has one.
+func (c *ContainerClient) getPartitionKeyDefinition(ctx context.Context) (PartitionKeyDefinition, error) {
+	if c.database.client.getContainerCache() != nil {
+		containerProps, err := c.database.client.getContainerCache().getProperties(ctx, c)
+		if err != nil {
+			return PartitionKeyDefinition{}, err
+		}
+		return containerProps.PartitionKeyDefinition, nil
+	}
+
+	// Fallback: direct fetch without caching
+	containerResp, err := c.Read(ctx, nil)
+	if err != nil {
+		return PartitionKeyDefinition{}, err
+	}
+	return containerResp.ContainerProperties.PartitionKeyDefinition, nil
+}
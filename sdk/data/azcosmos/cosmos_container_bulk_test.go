@@ -0,0 +1,324 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkGateway is a fake gateway for a container partitioned by /pk. Its partition key range "0" is split into "1"
+// and "2" when split is set. Bulk requests are answered by respond, for each operation.
+type bulkGateway struct {
+	mu sync.Mutex
+	// splitOnRequest splits the partition key range "0" when it receives a bulk request.
+	splitOnRequest bool
+	split          bool
+	pkRanges       int
+	requests       []bulkGatewayRequest
+	respond        func(op bulkGatewayOperation, attempt int) string
+	attempts       map[string]int
+	// maxOperations makes requests with more operations fail with 413.
+	maxOperations int
+}
+
+type bulkGatewayRequest struct {
+	header     http.Header
+	operations []bulkGatewayOperation
+}
+
+type bulkGatewayOperation struct {
+	PartitionKey  string          `json:"partitionKey"`
+	OperationType string          `json:"operationType"`
+	ID            string          `json:"id"`
+	ResourceBody  json.RawMessage `json:"resourceBody"`
+}
+
+func (o bulkGatewayOperation) itemID() string {
+	if o.ID != "" {
+		return o.ID
+	}
+	var item struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(o.ResourceBody, &item)
+	return item.ID
+}
+
+func (g *bulkGateway) Do(req *http.Request) (*http.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	respond := func(status int, body string, header http.Header) (*http.Response, error) {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/pkranges"):
+		g.pkRanges++
+		if g.split {
+			return respond(http.StatusOK, `{"PartitionKeyRanges":[{"id":"1","minInclusive":"","maxExclusive":"20"},{"id":"2","minInclusive":"20","maxExclusive":"FF"}]}`, nil)
+		}
+		return respond(http.StatusOK, `{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"FF"}]}`, nil)
+	case req.Method == http.MethodGet:
+		return respond(http.StatusOK, `{"id":"containerId","partitionKey":{"paths":["/pk"],"kind":"Hash","version":2}}`, nil)
+	}
+
+	var operations []bulkGatewayOperation
+	if err := json.NewDecoder(req.Body).Decode(&operations); err != nil {
+		return nil, err
+	}
+	g.requests = append(g.requests, bulkGatewayRequest{header: req.Header.Clone(), operations: operations})
+
+	if req.Header.Get(cosmosHeaderPartitionKeyRangeId) == "0" && g.splitOnRequest {
+		g.split = true
+		header := http.Header{}
+		header.Set(cosmosHeaderSubstatus, subStatusPartitionKeyRangeGone)
+		return respond(http.StatusGone, `{"message":"Gone"}`, header)
+	}
+
+	if g.maxOperations > 0 && len(operations) > g.maxOperations {
+		return respond(http.StatusRequestEntityTooLarge, `{"message":"Request size is too large"}`, nil)
+	}
+
+	results := make([]string, len(operations))
+	status := http.StatusOK
+	for i, op := range operations {
+		g.attempts[op.itemID()]++
+		results[i] = g.respond(op, g.attempts[op.itemID()])
+		if !strings.Contains(results[i], `"statusCode":20`) {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	header := http.Header{}
+	header.Set(cosmosHeaderRequestCharge, fmt.Sprint(len(operations)))
+	return respond(status, "["+strings.Join(results, ",")+"]", header)
+}
+
+func newBulkTestContainer(t *testing.T, g *bulkGateway) *ContainerClient {
+	if g.attempts == nil {
+		g.attempts = map[string]int{}
+	}
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{}, &policy.ClientOptions{Transport: g})
+	require.NoError(t, err)
+
+	endpointURL, err := url.Parse("https://localhost")
+	require.NoError(t, err)
+
+	client := &Client{endpoint: endpointURL.String(), endpointUrl: endpointURL, internal: internalClient, gem: &globalEndpointManager{preferredLocations: []string{}}}
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+	return container
+}
+
+func newBulkTestOperations(count int) BulkOperations {
+	bulk := BulkOperations{}
+	for i := 0; i < count; i++ {
+		bulk.UpsertItem(NewPartitionKeyString(fmt.Sprintf("pk%d", i)), []byte(fmt.Sprintf(`{"id":"%d","pk":"pk%d"}`, i, i)), nil)
+	}
+	return bulk
+}
+
+func echoBulkResult(op bulkGatewayOperation, attempt int) string {
+	return fmt.Sprintf(`{"statusCode":200,"requestCharge":1,"eTag":"etag%s","resourceBody":%s}`, op.itemID(), op.ResourceBody)
+}
+
+func TestExecuteBulk_GroupsOperationsByPartitionKeyRange(t *testing.T) {
+	gateway := &bulkGateway{split: true, respond: echoBulkResult}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(250), nil)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	require.Len(t, response.OperationResults, 250)
+	require.Equal(t, float32(250), response.RequestCharge)
+
+	for i, result := range response.OperationResults {
+		require.Equal(t, int32(http.StatusOK), result.StatusCode)
+		require.Equal(t, azcore.ETag(fmt.Sprintf("etag%d", i)), result.ETag)
+		require.JSONEq(t, fmt.Sprintf(`{"id":"%d","pk":"pk%d"}`, i, i), string(result.ResourceBody))
+	}
+
+	pkDef := PartitionKeyDefinition{Paths: []string{"/pk"}, Kind: PartitionKeyKindHash, Version: 2}
+	ranges := []partitionKeyRange{{ID: "1", MinInclusive: "", MaxExclusive: "20"}, {ID: "2", MinInclusive: "20", MaxExclusive: "FF"}}
+	rangeIDs := map[string]bool{}
+	for _, request := range gateway.requests {
+		require.Equal(t, "True", request.header.Get(cosmosHeaderIsBatchRequest))
+		require.Equal(t, "False", request.header.Get(cosmosHeaderIsBatchAtomic))
+		require.Equal(t, "True", request.header.Get(cosmosHeaderBatchContinueOnError))
+		require.Empty(t, request.header.Get(cosmosHeaderPartitionKey))
+		require.LessOrEqual(t, len(request.operations), maxOperationsPerBulkRequest)
+
+		rangeID := request.header.Get(cosmosHeaderPartitionKeyRangeId)
+		rangeIDs[rangeID] = true
+		for _, op := range request.operations {
+			var values []string
+			require.NoError(t, json.Unmarshal([]byte(op.PartitionKey), &values))
+			pk := NewPartitionKeyString(values[0])
+			epkR, err := computeEPKRange(&pk, pkDef)
+			require.NoError(t, err)
+			expected, ok := findPhysicalRangeForEPK(epkR.Min, ranges)
+			require.True(t, ok)
+			require.Equal(t, expected, rangeID, "operations are sent to the partition key range of their partition key")
+		}
+	}
+	require.Equal(t, map[string]bool{"1": true, "2": true}, rangeIDs)
+}
+
+func TestExecuteBulk_OperationFailures(t *testing.T) {
+	gateway := &bulkGateway{split: true, respond: func(op bulkGatewayOperation, attempt int) string {
+		if op.itemID() == "1" {
+			return `{"statusCode":409,"requestCharge":1}`
+		}
+		return echoBulkResult(op, attempt)
+	}}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(3), nil)
+	require.NoError(t, err)
+	require.False(t, response.Success)
+	require.Equal(t, int32(http.StatusOK), response.OperationResults[0].StatusCode)
+	require.Equal(t, int32(http.StatusConflict), response.OperationResults[1].StatusCode)
+	require.Equal(t, int32(http.StatusOK), response.OperationResults[2].StatusCode)
+}
+
+func TestExecuteBulk_RetriesThrottledOperations(t *testing.T) {
+	gateway := &bulkGateway{split: true, respond: func(op bulkGatewayOperation, attempt int) string {
+		if attempt == 1 {
+			return `{"statusCode":429,"subStatusCode":3200,"retryAfterMilliseconds":1,"requestCharge":0}`
+		}
+		return echoBulkResult(op, attempt)
+	}}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(20), nil)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	for _, result := range response.OperationResults {
+		require.Equal(t, int32(http.StatusOK), result.StatusCode)
+	}
+	for id, attempts := range gateway.attempts {
+		require.Equal(t, 2, attempts, "operation %s is retried once", id)
+	}
+	require.Equal(t, float32(40), response.RequestCharge, "the charges of the throttled requests are included")
+}
+
+func TestExecuteBulk_ThrottleRetriesExhausted(t *testing.T) {
+	gateway := &bulkGateway{split: true, respond: func(op bulkGatewayOperation, attempt int) string {
+		return `{"statusCode":429,"retryAfterMilliseconds":1}`
+	}}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(1), nil)
+	require.NoError(t, err)
+	require.False(t, response.Success)
+	require.Equal(t, int32(http.StatusTooManyRequests), response.OperationResults[0].StatusCode)
+	require.Equal(t, maxBulkThrottleRetries+1, gateway.attempts["0"])
+}
+
+func TestExecuteBulk_PartitionSplit(t *testing.T) {
+	gateway := &bulkGateway{splitOnRequest: true, respond: echoBulkResult}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(50), nil)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	for i, result := range response.OperationResults {
+		require.JSONEq(t, fmt.Sprintf(`{"id":"%d","pk":"pk%d"}`, i, i), string(result.ResourceBody))
+	}
+
+	require.Equal(t, "0", gateway.requests[0].header.Get(cosmosHeaderPartitionKeyRangeId))
+	var rangeIDs []string
+	for _, request := range gateway.requests[1:] {
+		rangeIDs = append(rangeIDs, request.header.Get(cosmosHeaderPartitionKeyRangeId))
+	}
+	require.ElementsMatch(t, []string{"1", "2"}, rangeIDs)
+	require.Equal(t, 2, gateway.pkRanges, "the partition key ranges are read again after the split")
+}
+
+func TestExecuteBulk_PartitionSplitOnOperation(t *testing.T) {
+	gateway := &bulkGateway{respond: func(op bulkGatewayOperation, attempt int) string {
+		if attempt == 1 {
+			return `{"statusCode":410,"subStatusCode":1002}`
+		}
+		return echoBulkResult(op, attempt)
+	}}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(5), nil)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	require.Equal(t, 2, gateway.pkRanges)
+}
+
+func TestExecuteBulk_RequestTooLarge(t *testing.T) {
+	gateway := &bulkGateway{maxOperations: 30, respond: echoBulkResult}
+	container := newBulkTestContainer(t, gateway)
+
+	response, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(100), nil)
+	require.NoError(t, err)
+	require.True(t, response.Success)
+	for _, request := range gateway.requests[1:] {
+		require.LessOrEqual(t, len(request.operations), 50)
+	}
+}
+
+func TestExecuteBulk_RequestError(t *testing.T) {
+	gateway := &bulkGateway{split: true, respond: echoBulkResult}
+	gateway.respond = func(op bulkGatewayOperation, attempt int) string {
+		return `not json`
+	}
+	container := newBulkTestContainer(t, gateway)
+
+	_, err := container.ExecuteBulk(context.Background(), newBulkTestOperations(10), nil)
+	require.Error(t, err)
+}
+
+func TestExecuteBulk_NoOperations(t *testing.T) {
+	container := newBulkTestContainer(t, &bulkGateway{})
+
+	_, err := container.ExecuteBulk(context.Background(), BulkOperations{}, nil)
+	require.Error(t, err)
+}
+
+func TestNextBulkBatch(t *testing.T) {
+	e := &bulkExecutor{operations: []marshaledBulkOperation{
+		{body: make([]byte, maxBulkRequestBodySize-10)},
+		{body: make([]byte, 20)},
+		{body: make([]byte, 20)},
+		{body: make([]byte, maxBulkRequestBodySize+10)},
+		{body: make([]byte, 20)},
+	}}
+
+	batch, queue := e.nextBatch([]int{0, 1, 2, 3, 4}, maxOperationsPerBulkRequest)
+	require.Equal(t, []int{0}, batch)
+	batch, queue = e.nextBatch(queue, maxOperationsPerBulkRequest)
+	require.Equal(t, []int{1, 2}, batch)
+	batch, queue = e.nextBatch(queue, maxOperationsPerBulkRequest)
+	require.Equal(t, []int{3}, batch, "an operation larger than the limit is sent on its own")
+	batch, queue = e.nextBatch(queue, 1)
+	require.Equal(t, []int{4}, batch)
+	require.Empty(t, queue)
+}
@@ -79,7 +79,10 @@ func (c *ContainerClient) buildChangeFeedInitialQueue(
 	if err != nil {
 		return nil, nil, err
 	}
-	entries := buildChildQueueEntries(children, nil)
+	// Clamp the children to the FeedRange, so that a FeedRange for part of a
+	// physical partition only reads the changes within its bounds.
+	feedRange := newChangeFeedRange(options.FeedRange.MinInclusive, options.FeedRange.MaxExclusive, nil)
+	entries := buildChildQueueEntries(clampChildrenToParent(children, feedRange), nil)
 	// Populate ResourceID at construction time so a token persisted from a
 	// 304-only first call still triggers the cross-container guard on resume.
 	currentRID, ridErr := c.getContainerRID(ctx)
@@ -154,6 +157,13 @@ func buildChildQueueEntries(children []partitionKeyRange, inheritETag *azcore.ET
 	return out
 }
 
+// isChangeFeedSubRange reports whether the head covers only part of the PK
+// range it resolved to.
+func isChangeFeedSubRange(head changeFeedRange, pkRange partitionKeyRange) bool {
+	return epk.CompareEPK(head.MinInclusive, pkRange.MinInclusive) != 0 ||
+		epk.CompareEPK(normalizeMaxBoundary(head.MaxExclusive), normalizeMaxBoundary(pkRange.MaxExclusive)) != 0
+}
+
 // clampChildrenToParent narrows each child's [Min, Max) to the intersection
 // with the parent head's [Min, Max), preserving the customer's original sub-
 // range intent across split-expansion. Children that fall entirely outside
@@ -317,6 +327,14 @@ func (c *ContainerClient) getChangeFeedForQueue(
 			return ChangeFeedResponse{}, headerErr
 		}
 
+		// A head narrower than its PK range (a FeedRange for part of a
+		// partition, or a range whose partition was merged into a wider one)
+		// only reads the changes within its own EPK bounds.
+		if isChangeFeedSubRange(*head, overlaps[0]) {
+			headers[cosmosHeaderStartEpk] = head.MinInclusive
+			headers[cosmosHeaderEndEpk] = normalizeMaxBoundary(head.MaxExclusive)
+		}
+
 		addHeaders := func(r *policy.Request) {
 			for k, v := range headers {
 				r.Raw().Header.Set(k, v)
@@ -327,8 +345,9 @@ func (c *ContainerClient) getChangeFeedForQueue(
 			resourceType:    resourceTypeDocument,
 			resourceAddress: c.link,
 			headerOptionsOverride: &headerOptionsOverride{
-				priorityLevel:    options.PriorityLevel,
-				throughputBucket: options.ThroughputBucket,
+				priorityLevel:          options.PriorityLevel,
+				throughputBucket:       options.ThroughputBucket,
+				throughputControlGroup: options.ThroughputControlGroupName,
 			},
 		}
 		path, err := generatePathForNameBased(resourceTypeDocument, operationContext.resourceAddress, true)
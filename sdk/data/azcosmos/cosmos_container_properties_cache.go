@@ -84,6 +84,23 @@ func (c *containerPropertiesCache) getProperties(
 	return props, err
 }
 
+// peekProperties looks up cached container properties by container link.
+// Returns nil if the container is not in the cache or is being refreshed;
+// it never fetches nor waits for a refresh.
+func (c *containerPropertiesCache) peekProperties(containerLink string) *ContainerProperties {
+	c.mu.RLock()
+	entry, exists := c.entries[containerLink]
+	c.mu.RUnlock()
+
+	if !exists || !entry.mu.TryLock() {
+		return nil
+	}
+
+	props := entry.props
+	entry.mu.Unlock()
+	return props
+}
+
 // getPropertiesByRID looks up cached container properties by ResourceID.
 // Returns nil if the RID is not in the cache.
 func (c *containerPropertiesCache) getPropertiesByRID(resourceID string) *ContainerProperties {
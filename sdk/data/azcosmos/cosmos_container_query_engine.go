@@ -123,6 +123,7 @@ func (c *ContainerClient) executeQueryWithEngine(queryEngine queryengine.QueryEn
 				query = queryPipeline.Query()
 			}
 
+			pkRangeGoneAttempts := 0
 			for {
 				if queryPipeline.IsComplete() {
 					log.Writef(EventQueryEngine, "Query pipeline is complete")
@@ -170,9 +171,25 @@ func (c *ContainerClient) executeQueryWithEngine(queryEngine queryengine.QueryEn
 				})
 				_ = charge // totalRequestCharge currently unused for query path;
 				if err != nil {
+					// If a partition key range was split, pipelines that support it continue with the new ranges.
+					// The results of the failed round aren't provided to the pipeline, so it requests them again.
+					if updater, ok := queryPipeline.(queryengine.PartitionKeyRangeUpdater); ok && isPKRangeGoneResponseError(err) && pkRangeGoneAttempts < maxPKRangeGoneRetries {
+						pkRangeGoneAttempts++
+						log.Writef(EventQueryEngine, "Partition key range is gone, updating the query pipeline's partition key ranges (attempt %d)", pkRangeGoneAttempts)
+						pkranges, err := c.getPartitionKeyRangesRaw(ctx, operationContext)
+						if err == nil {
+							err = updater.UpdatePartitionKeyRanges(string(pkranges))
+						}
+						if err != nil {
+							queryPipeline.Close()
+							return QueryItemsResponse{}, err
+						}
+						continue
+					}
 					queryPipeline.Close()
 					return QueryItemsResponse{}, err
 				}
+				pkRangeGoneAttempts = 0
 				// Loop again to attempt to produce items.
 			}
 		},
@@ -0,0 +1,394 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// CreateStoredProcedure creates a stored procedure in the Cosmos container.
+// ctx - The context for the request.
+// properties - The properties of the stored procedure.
+// o - Options for the operation.
+func (c *ContainerClient) CreateStoredProcedure(
+	ctx context.Context,
+	properties StoredProcedureProperties,
+	o *ScriptOptions) (StoredProcedureResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeCreate, resourceTypeStoredProcedure, pathSegmentStoredProcedure, properties.ID, properties, o)
+	if err != nil {
+		return StoredProcedureResponse{}, err
+	}
+	return newStoredProcedureResponse(azResponse)
+}
+
+// ReadStoredProcedure reads a stored procedure in the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the stored procedure.
+// o - Options for the operation.
+func (c *ContainerClient) ReadStoredProcedure(
+	ctx context.Context,
+	id string,
+	o *ScriptOptions) (StoredProcedureResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeRead, resourceTypeStoredProcedure, pathSegmentStoredProcedure, id, nil, o)
+	if err != nil {
+		return StoredProcedureResponse{}, err
+	}
+	return newStoredProcedureResponse(azResponse)
+}
+
+// ReplaceStoredProcedure replaces the stored procedure with the same id in the Cosmos container.
+// ctx - The context for the request.
+// properties - The new properties of the stored procedure.
+// o - Options for the operation.
+func (c *ContainerClient) ReplaceStoredProcedure(
+	ctx context.Context,
+	properties StoredProcedureProperties,
+	o *ScriptOptions) (StoredProcedureResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeReplace, resourceTypeStoredProcedure, pathSegmentStoredProcedure, properties.ID, properties, o)
+	if err != nil {
+		return StoredProcedureResponse{}, err
+	}
+	return newStoredProcedureResponse(azResponse)
+}
+
+// DeleteStoredProcedure deletes a stored procedure in the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the stored procedure.
+// o - Options for the operation.
+func (c *ContainerClient) DeleteStoredProcedure(
+	ctx context.Context,
+	id string,
+	o *ScriptOptions) (StoredProcedureResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeDelete, resourceTypeStoredProcedure, pathSegmentStoredProcedure, id, nil, o)
+	if err != nil {
+		return StoredProcedureResponse{}, err
+	}
+	return newStoredProcedureResponse(azResponse)
+}
+
+// NewQueryStoredProceduresPager executes query for stored procedures within the container.
+// query - The SQL query to execute.
+// o - Options for the operation.
+func (c *ContainerClient) NewQueryStoredProceduresPager(query string, o *QueryScriptsOptions) *runtime.Pager[QueryStoredProceduresResponse] {
+	return newQueryScriptsPager(c, resourceTypeStoredProcedure, query, o,
+		func(page QueryStoredProceduresResponse) *string { return page.ContinuationToken },
+		newStoredProceduresQueryResponse)
+}
+
+// ExecuteStoredProcedure executes a stored procedure on a logical partition of the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the stored procedure.
+// partitionKey - The partition key of the logical partition the stored procedure runs on.
+// parameters - The parameters of the stored procedure's function. Each parameter is serialized to JSON.
+// o - Options for the operation.
+func (c *ContainerClient) ExecuteStoredProcedure(
+	ctx context.Context,
+	id string,
+	partitionKey PartitionKey,
+	parameters []any,
+	o *ExecuteStoredProcedureOptions) (ExecuteStoredProcedureResponse, error) {
+	var err error
+	spanName, err := c.getSpanForContainer(operationTypeExecute, resourceTypeStoredProcedure, c.id)
+	if err != nil {
+		return ExecuteStoredProcedureResponse{}, err
+	}
+	ctx, endSpan := startSpan(ctx, spanName.name, c.database.client.internal.Tracer(), &spanName.options)
+	defer func() { endSpan(err) }()
+
+	if o == nil {
+		o = &ExecuteStoredProcedureOptions{}
+	}
+	if parameters == nil {
+		parameters = []any{}
+	}
+
+	h := headerOptionsOverride{
+		partitionKey:     &partitionKey,
+		priorityLevel:    o.PriorityLevel,
+		throughputBucket: o.ThroughputBucket,
+	}
+
+	operationContext := pipelineRequestOptions{
+		resourceType:          resourceTypeStoredProcedure,
+		resourceAddress:       createLink(c.link, pathSegmentStoredProcedure, id),
+		isWriteOperation:      true,
+		headerOptionsOverride: &h,
+	}
+
+	path, err := generatePathForNameBased(resourceTypeStoredProcedure, operationContext.resourceAddress, false)
+	if err != nil {
+		return ExecuteStoredProcedureResponse{}, err
+	}
+
+	azResponse, err := c.database.client.sendPostRequest(
+		path,
+		ctx,
+		parameters,
+		operationContext,
+		o,
+		nil)
+	if err != nil {
+		return ExecuteStoredProcedureResponse{}, err
+	}
+
+	response, err := newExecuteStoredProcedureResponse(azResponse)
+	return response, err
+}
+
+// CreateTrigger creates a trigger in the Cosmos container.
+// ctx - The context for the request.
+// properties - The properties of the trigger.
+// o - Options for the operation.
+func (c *ContainerClient) CreateTrigger(
+	ctx context.Context,
+	properties TriggerProperties,
+	o *ScriptOptions) (TriggerResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeCreate, resourceTypeTrigger, pathSegmentTrigger, properties.ID, properties, o)
+	if err != nil {
+		return TriggerResponse{}, err
+	}
+	return newTriggerResponse(azResponse)
+}
+
+// ReadTrigger reads a trigger in the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the trigger.
+// o - Options for the operation.
+func (c *ContainerClient) ReadTrigger(
+	ctx context.Context,
+	id string,
+	o *ScriptOptions) (TriggerResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeRead, resourceTypeTrigger, pathSegmentTrigger, id, nil, o)
+	if err != nil {
+		return TriggerResponse{}, err
+	}
+	return newTriggerResponse(azResponse)
+}
+
+// ReplaceTrigger replaces the trigger with the same id in the Cosmos container.
+// ctx - The context for the request.
+// properties - The new properties of the trigger.
+// o - Options for the operation.
+func (c *ContainerClient) ReplaceTrigger(
+	ctx context.Context,
+	properties TriggerProperties,
+	o *ScriptOptions) (TriggerResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeReplace, resourceTypeTrigger, pathSegmentTrigger, properties.ID, properties, o)
+	if err != nil {
+		return TriggerResponse{}, err
+	}
+	return newTriggerResponse(azResponse)
+}
+
+// DeleteTrigger deletes a trigger in the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the trigger.
+// o - Options for the operation.
+func (c *ContainerClient) DeleteTrigger(
+	ctx context.Context,
+	id string,
+	o *ScriptOptions) (TriggerResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeDelete, resourceTypeTrigger, pathSegmentTrigger, id, nil, o)
+	if err != nil {
+		return TriggerResponse{}, err
+	}
+	return newTriggerResponse(azResponse)
+}
+
+// NewQueryTriggersPager executes query for triggers within the container.
+// query - The SQL query to execute.
+// o - Options for the operation.
+func (c *ContainerClient) NewQueryTriggersPager(query string, o *QueryScriptsOptions) *runtime.Pager[QueryTriggersResponse] {
+	return newQueryScriptsPager(c, resourceTypeTrigger, query, o,
+		func(page QueryTriggersResponse) *string { return page.ContinuationToken },
+		newTriggersQueryResponse)
+}
+
+// CreateUserDefinedFunction creates a user defined function in the Cosmos container.
+// ctx - The context for the request.
+// properties - The properties of the user defined function.
+// o - Options for the operation.
+func (c *ContainerClient) CreateUserDefinedFunction(
+	ctx context.Context,
+	properties UserDefinedFunctionProperties,
+	o *ScriptOptions) (UserDefinedFunctionResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeCreate, resourceTypeUserDefinedFunction, pathSegmentUserDefinedFunction, properties.ID, properties, o)
+	if err != nil {
+		return UserDefinedFunctionResponse{}, err
+	}
+	return newUserDefinedFunctionResponse(azResponse)
+}
+
+// ReadUserDefinedFunction reads a user defined function in the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the user defined function.
+// o - Options for the operation.
+func (c *ContainerClient) ReadUserDefinedFunction(
+	ctx context.Context,
+	id string,
+	o *ScriptOptions) (UserDefinedFunctionResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeRead, resourceTypeUserDefinedFunction, pathSegmentUserDefinedFunction, id, nil, o)
+	if err != nil {
+		return UserDefinedFunctionResponse{}, err
+	}
+	return newUserDefinedFunctionResponse(azResponse)
+}
+
+// ReplaceUserDefinedFunction replaces the user defined function with the same id in the Cosmos container.
+// ctx - The context for the request.
+// properties - The new properties of the user defined function.
+// o - Options for the operation.
+func (c *ContainerClient) ReplaceUserDefinedFunction(
+	ctx context.Context,
+	properties UserDefinedFunctionProperties,
+	o *ScriptOptions) (UserDefinedFunctionResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeReplace, resourceTypeUserDefinedFunction, pathSegmentUserDefinedFunction, properties.ID, properties, o)
+	if err != nil {
+		return UserDefinedFunctionResponse{}, err
+	}
+	return newUserDefinedFunctionResponse(azResponse)
+}
+
+// DeleteUserDefinedFunction deletes a user defined function in the Cosmos container.
+// ctx - The context for the request.
+// id - The id of the user defined function.
+// o - Options for the operation.
+func (c *ContainerClient) DeleteUserDefinedFunction(
+	ctx context.Context,
+	id string,
+	o *ScriptOptions) (UserDefinedFunctionResponse, error) {
+	azResponse, err := c.sendScriptRequest(ctx, operationTypeDelete, resourceTypeUserDefinedFunction, pathSegmentUserDefinedFunction, id, nil, o)
+	if err != nil {
+		return UserDefinedFunctionResponse{}, err
+	}
+	return newUserDefinedFunctionResponse(azResponse)
+}
+
+// NewQueryUserDefinedFunctionsPager executes query for user defined functions within the container.
+// query - The SQL query to execute.
+// o - Options for the operation.
+func (c *ContainerClient) NewQueryUserDefinedFunctionsPager(query string, o *QueryScriptsOptions) *runtime.Pager[QueryUserDefinedFunctionsResponse] {
+	return newQueryScriptsPager(c, resourceTypeUserDefinedFunction, query, o,
+		func(page QueryUserDefinedFunctionsResponse) *string { return page.ContinuationToken },
+		newUserDefinedFunctionsQueryResponse)
+}
+
+// sendScriptRequest sends a create, read, replace or delete request for a stored procedure, trigger or user defined
+// function. Creates are sent to the feed of the resource type, the other operations to the resource with the id.
+func (c *ContainerClient) sendScriptRequest(
+	ctx context.Context,
+	operationType operationType,
+	resourceType resourceType,
+	pathSegment string,
+	id string,
+	properties any,
+	o *ScriptOptions) (*http.Response, error) {
+	var err error
+	spanName, err := c.getSpanForContainer(operationType, resourceType, c.id)
+	if err != nil {
+		return nil, err
+	}
+	ctx, endSpan := startSpan(ctx, spanName.name, c.database.client.internal.Tracer(), &spanName.options)
+	defer func() { endSpan(err) }()
+
+	if o == nil {
+		o = &ScriptOptions{}
+	}
+
+	operationContext := pipelineRequestOptions{
+		resourceType:     resourceType,
+		resourceAddress:  createLink(c.link, pathSegment, id),
+		isWriteOperation: operationType != operationTypeRead,
+	}
+	isFeed := false
+	if operationType == operationTypeCreate {
+		operationContext.resourceAddress = c.link
+		isFeed = true
+	}
+
+	path, err := generatePathForNameBased(resourceType, operationContext.resourceAddress, isFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	var azResponse *http.Response
+	switch operationType {
+	case operationTypeCreate:
+		azResponse, err = c.database.client.sendPostRequest(path, ctx, properties, operationContext, o, nil)
+	case operationTypeRead:
+		azResponse, err = c.database.client.sendGetRequest(path, ctx, operationContext, o, nil)
+	case operationTypeReplace:
+		azResponse, err = c.database.client.sendPutRequest(path, ctx, properties, operationContext, o, nil)
+	case operationTypeDelete:
+		azResponse, err = c.database.client.sendDeleteRequest(path, ctx, operationContext, o, nil)
+	default:
+		err = fmt.Errorf("unsupported operation type %v for resource type %v", operationType, resourceType)
+	}
+	return azResponse, err
+}
+
+// newQueryScriptsPager creates a pager that queries the stored procedures, triggers or user defined functions of the
+// container.
+func newQueryScriptsPager[T any](
+	c *ContainerClient,
+	resourceType resourceType,
+	query string,
+	o *QueryScriptsOptions,
+	continuationToken func(T) *string,
+	newResponse func(*http.Response) (T, error)) *runtime.Pager[T] {
+	queryOptions := &QueryScriptsOptions{}
+	if o != nil {
+		originalOptions := *o
+		queryOptions = &originalOptions
+	}
+
+	operationContext := pipelineRequestOptions{
+		resourceType:    resourceType,
+		resourceAddress: c.link,
+	}
+
+	path, _ := generatePathForNameBased(resourceType, operationContext.resourceAddress, true)
+
+	return runtime.NewPager(runtime.PagingHandler[T]{
+		More: func(page T) bool {
+			return continuationToken(page) != nil
+		},
+		Fetcher: func(ctx context.Context, page *T) (T, error) {
+			var err error
+			spanName, err := c.getSpanForContainer(operationTypeQuery, resourceType, c.id)
+			if err != nil {
+				var zero T
+				return zero, err
+			}
+			ctx, endSpan := startSpan(ctx, spanName.name, c.database.client.internal.Tracer(), &spanName.options)
+			defer func() { endSpan(err) }()
+			if page != nil {
+				if token := continuationToken(*page); token != nil {
+					// Use the previous page continuation if available
+					queryOptions.ContinuationToken = token
+				}
+			}
+
+			azResponse, err := c.database.client.sendQueryRequest(
+				path,
+				ctx,
+				query,
+				queryOptions.QueryParameters,
+				operationContext,
+				queryOptions,
+				nil)
+
+			if err != nil {
+				var zero T
+				return zero, err
+			}
+
+			return newResponse(azResponse)
+		},
+	})
+}
@@ -0,0 +1,388 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/mock"
+)
+
+func newScriptsTestContainer(t *testing.T, srv *mock.Server, policies ...policy.Policy) *ContainerClient {
+	defaultEndpoint, _ := url.Parse(srv.URL())
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{PerCall: policies}, &policy.ClientOptions{Transport: srv})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	gem := &globalEndpointManager{preferredLocations: []string{}}
+	client := &Client{endpoint: srv.URL(), endpointUrl: defaultEndpoint, internal: internalClient, gem: gem}
+
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+	return container
+}
+
+func TestContainerCreateStoredProcedure(t *testing.T) {
+	jsonString := []byte(`{"id":"sproc1","body":"function () {}","_etag":"someEtag","_rid":"someRid","_self":"someSelf","_ts":1700000000}`)
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithBody(jsonString),
+		mock.WithHeader(cosmosHeaderEtag, "someEtag"),
+		mock.WithHeader(cosmosHeaderActivityId, "someActivityId"),
+		mock.WithHeader(cosmosHeaderRequestCharge, "13.42"),
+		mock.WithStatusCode(201))
+
+	verifier := pipelineVerifier{}
+	container := newScriptsTestContainer(t, srv, &verifier)
+
+	resp, err := container.CreateStoredProcedure(context.TODO(), StoredProcedureProperties{ID: "sproc1", Body: "function () {}"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create stored procedure: %v", err)
+	}
+
+	if resp.RequestCharge != 13.42 {
+		t.Errorf("Expected RequestCharge to be %f, but got %f", 13.42, resp.RequestCharge)
+	}
+
+	properties := resp.StoredProcedureProperties
+	if properties.ID != "sproc1" || properties.Body != "function () {}" {
+		t.Errorf("Unexpected properties %+v", properties)
+	}
+	if properties.ETag == nil || *properties.ETag != "someEtag" {
+		t.Errorf("Expected ETag to be someEtag, but got %v", properties.ETag)
+	}
+	if properties.ResourceID != "someRid" || properties.SelfLink != "someSelf" {
+		t.Errorf("Unexpected system properties %+v", properties)
+	}
+	if !properties.LastModified.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected LastModified to be %v, but got %v", time.Unix(1700000000, 0), properties.LastModified)
+	}
+
+	if verifier.requests[0].method != http.MethodPost {
+		t.Errorf("Expected method to be %s, but got %s", http.MethodPost, verifier.requests[0].method)
+	}
+	if verifier.requests[0].url.RequestURI() != "/dbs/databaseId/colls/containerId/sprocs" {
+		t.Errorf("Expected url to be %s, but got %s", "/dbs/databaseId/colls/containerId/sprocs", verifier.requests[0].url.RequestURI())
+	}
+	if verifier.requests[0].body != `{"id":"sproc1","body":"function () {}"}` {
+		t.Errorf("Unexpected body %s", verifier.requests[0].body)
+	}
+}
+
+func TestContainerScriptOperations(t *testing.T) {
+	etag := azcore.ETag("someEtag")
+	options := &ScriptOptions{IfMatchEtag: &etag}
+	triggerProperties := TriggerProperties{ID: "script1", Body: "function () {}", TriggerType: TriggerTypePre, TriggerOperation: TriggerOperationCreate}
+
+	tests := []struct {
+		name   string
+		call   func(c *ContainerClient) error
+		method string
+		url    string
+		body   string
+	}{
+		{
+			name: "ReadStoredProcedure",
+			call: func(c *ContainerClient) error {
+				_, err := c.ReadStoredProcedure(context.TODO(), "script1", options)
+				return err
+			},
+			method: http.MethodGet,
+			url:    "/dbs/databaseId/colls/containerId/sprocs/script1",
+		},
+		{
+			name: "ReplaceStoredProcedure",
+			call: func(c *ContainerClient) error {
+				_, err := c.ReplaceStoredProcedure(context.TODO(), StoredProcedureProperties{ID: "script1", Body: "function () {}"}, options)
+				return err
+			},
+			method: http.MethodPut,
+			url:    "/dbs/databaseId/colls/containerId/sprocs/script1",
+			body:   `{"id":"script1","body":"function () {}"}`,
+		},
+		{
+			name: "DeleteStoredProcedure",
+			call: func(c *ContainerClient) error {
+				_, err := c.DeleteStoredProcedure(context.TODO(), "script1", options)
+				return err
+			},
+			method: http.MethodDelete,
+			url:    "/dbs/databaseId/colls/containerId/sprocs/script1",
+		},
+		{
+			name: "CreateTrigger",
+			call: func(c *ContainerClient) error {
+				_, err := c.CreateTrigger(context.TODO(), triggerProperties, options)
+				return err
+			},
+			method: http.MethodPost,
+			url:    "/dbs/databaseId/colls/containerId/triggers",
+			body:   `{"id":"script1","body":"function () {}","triggerType":"Pre","triggerOperation":"Create"}`,
+		},
+		{
+			name: "ReadTrigger",
+			call: func(c *ContainerClient) error {
+				_, err := c.ReadTrigger(context.TODO(), "script1", options)
+				return err
+			},
+			method: http.MethodGet,
+			url:    "/dbs/databaseId/colls/containerId/triggers/script1",
+		},
+		{
+			name: "ReplaceTrigger",
+			call: func(c *ContainerClient) error {
+				_, err := c.ReplaceTrigger(context.TODO(), triggerProperties, options)
+				return err
+			},
+			method: http.MethodPut,
+			url:    "/dbs/databaseId/colls/containerId/triggers/script1",
+			body:   `{"id":"script1","body":"function () {}","triggerType":"Pre","triggerOperation":"Create"}`,
+		},
+		{
+			name: "DeleteTrigger",
+			call: func(c *ContainerClient) error {
+				_, err := c.DeleteTrigger(context.TODO(), "script1", options)
+				return err
+			},
+			method: http.MethodDelete,
+			url:    "/dbs/databaseId/colls/containerId/triggers/script1",
+		},
+		{
+			name: "CreateUserDefinedFunction",
+			call: func(c *ContainerClient) error {
+				_, err := c.CreateUserDefinedFunction(context.TODO(), UserDefinedFunctionProperties{ID: "script1", Body: "function () {}"}, options)
+				return err
+			},
+			method: http.MethodPost,
+			url:    "/dbs/databaseId/colls/containerId/udfs",
+			body:   `{"id":"script1","body":"function () {}"}`,
+		},
+		{
+			name: "ReadUserDefinedFunction",
+			call: func(c *ContainerClient) error {
+				_, err := c.ReadUserDefinedFunction(context.TODO(), "script1", options)
+				return err
+			},
+			method: http.MethodGet,
+			url:    "/dbs/databaseId/colls/containerId/udfs/script1",
+		},
+		{
+			name: "ReplaceUserDefinedFunction",
+			call: func(c *ContainerClient) error {
+				_, err := c.ReplaceUserDefinedFunction(context.TODO(), UserDefinedFunctionProperties{ID: "script1", Body: "function () {}"}, options)
+				return err
+			},
+			method: http.MethodPut,
+			url:    "/dbs/databaseId/colls/containerId/udfs/script1",
+			body:   `{"id":"script1","body":"function () {}"}`,
+		},
+		{
+			name: "DeleteUserDefinedFunction",
+			call: func(c *ContainerClient) error {
+				_, err := c.DeleteUserDefinedFunction(context.TODO(), "script1", options)
+				return err
+			},
+			method: http.MethodDelete,
+			url:    "/dbs/databaseId/colls/containerId/udfs/script1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, close := mock.NewTLSServer()
+			defer close()
+			srv.SetResponse(
+				mock.WithBody([]byte(`{"id":"script1","body":"function () {}"}`)),
+				mock.WithHeader(cosmosHeaderEtag, "someEtag"),
+				mock.WithStatusCode(200))
+
+			verifier := pipelineVerifier{}
+			container := newScriptsTestContainer(t, srv, &verifier)
+
+			if err := tt.call(container); err != nil {
+				t.Fatalf("Failed to execute %s: %v", tt.name, err)
+			}
+
+			request := verifier.requests[0]
+			if request.method != tt.method {
+				t.Errorf("Expected method to be %s, but got %s", tt.method, request.method)
+			}
+			if request.url.RequestURI() != tt.url {
+				t.Errorf("Expected url to be %s, but got %s", tt.url, request.url.RequestURI())
+			}
+			if request.body != tt.body {
+				t.Errorf("Expected body to be %s, but got %s", tt.body, request.body)
+			}
+			if request.headers.Get(headerIfMatch) != "someEtag" {
+				t.Errorf("Expected If-Match to be someEtag, but got %s", request.headers.Get(headerIfMatch))
+			}
+		})
+	}
+}
+
+func TestContainerExecuteStoredProcedure(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"count":2}`)),
+		mock.WithHeader(cosmosHeaderScriptLogResults, "processed%202%20items"),
+		mock.WithHeader(cosmosHeaderSessionToken, "0:1#2"),
+		mock.WithHeader(cosmosHeaderRequestCharge, "3.5"),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`null`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newScriptsTestContainer(t, srv, &headerPolicies{}, &verifier)
+
+	priority := PriorityLevelLow
+	resp, err := container.ExecuteStoredProcedure(context.TODO(), "sproc1", NewPartitionKeyString("pk1"), []any{"a", 1}, &ExecuteStoredProcedureOptions{
+		EnableScriptLogging: true,
+		PriorityLevel:       &priority,
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute stored procedure: %v", err)
+	}
+
+	if string(resp.Value) != `{"count":2}` {
+		t.Errorf("Expected value to be %s, but got %s", `{"count":2}`, string(resp.Value))
+	}
+	if resp.ScriptLogs != "processed 2 items" {
+		t.Errorf("Expected script logs to be %q, but got %q", "processed 2 items", resp.ScriptLogs)
+	}
+	if resp.SessionToken == nil || *resp.SessionToken != "0:1#2" {
+		t.Errorf("Expected session token to be 0:1#2, but got %v", resp.SessionToken)
+	}
+	if resp.RequestCharge != 3.5 {
+		t.Errorf("Expected RequestCharge to be %f, but got %f", 3.5, resp.RequestCharge)
+	}
+
+	request := verifier.requests[0]
+	if request.method != http.MethodPost {
+		t.Errorf("Expected method to be %s, but got %s", http.MethodPost, request.method)
+	}
+	if request.url.RequestURI() != "/dbs/databaseId/colls/containerId/sprocs/sproc1" {
+		t.Errorf("Expected url to be %s, but got %s", "/dbs/databaseId/colls/containerId/sprocs/sproc1", request.url.RequestURI())
+	}
+	if request.body != `["a",1]` {
+		t.Errorf("Expected body to be %s, but got %s", `["a",1]`, request.body)
+	}
+	if request.headers.Get(cosmosHeaderPartitionKey) != `["pk1"]` {
+		t.Errorf("Expected partition key header to be %s, but got %s", `["pk1"]`, request.headers.Get(cosmosHeaderPartitionKey))
+	}
+	if request.headers.Get(cosmosHeaderScriptEnableLogging) != "true" {
+		t.Errorf("Expected script logging header to be true, but got %s", request.headers.Get(cosmosHeaderScriptEnableLogging))
+	}
+	if request.headers.Get(cosmosHeaderPriorityLevel) != "Low" {
+		t.Errorf("Expected priority level header to be Low, but got %s", request.headers.Get(cosmosHeaderPriorityLevel))
+	}
+
+	// parameters default to an empty array.
+	if _, err := container.ExecuteStoredProcedure(context.TODO(), "sproc1", NewPartitionKeyString("pk1"), nil, nil); err != nil {
+		t.Fatalf("Failed to execute stored procedure: %v", err)
+	}
+	if verifier.requests[1].body != `[]` {
+		t.Errorf("Expected body to be [], but got %s", verifier.requests[1].body)
+	}
+	if verifier.requests[1].headers.Get(cosmosHeaderScriptEnableLogging) != "" {
+		t.Errorf("Expected no script logging header, but got %s", verifier.requests[1].headers.Get(cosmosHeaderScriptEnableLogging))
+	}
+}
+
+func TestContainerQueryStoredProcedures(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"StoredProcedures":[{"id":"sproc1","body":"function () {}"}],"_count":1}`)),
+		mock.WithHeader(cosmosHeaderContinuationToken, "someContinuationToken"),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"StoredProcedures":[{"id":"sproc2","body":"function () {}"}],"_count":1}`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newScriptsTestContainer(t, srv, &verifier)
+
+	receivedIds := []string{}
+	pager := container.NewQueryStoredProceduresPager("SELECT * FROM s WHERE s.id = @id", &QueryScriptsOptions{
+		QueryParameters: []QueryParameter{{Name: "@id", Value: "sproc1"}},
+	})
+	for pager.More() {
+		page, err := pager.NextPage(context.TODO())
+		if err != nil {
+			t.Fatalf("Failed to query stored procedures: %v", err)
+		}
+		for _, sproc := range page.StoredProcedures {
+			receivedIds = append(receivedIds, sproc.ID)
+		}
+	}
+
+	if len(receivedIds) != 2 || receivedIds[0] != "sproc1" || receivedIds[1] != "sproc2" {
+		t.Fatalf("Expected stored procedures sproc1 and sproc2, but got %v", receivedIds)
+	}
+
+	if !verifier.requests[0].isQuery {
+		t.Errorf("Expected request to be a query")
+	}
+	if verifier.requests[0].url.RequestURI() != "/dbs/databaseId/colls/containerId/sprocs" {
+		t.Errorf("Expected url to be %s, but got %s", "/dbs/databaseId/colls/containerId/sprocs", verifier.requests[0].url.RequestURI())
+	}
+	if verifier.requests[1].headers.Get(cosmosHeaderContinuationToken) != "someContinuationToken" {
+		t.Errorf("Expected continuation token to be someContinuationToken, but got %s", verifier.requests[1].headers.Get(cosmosHeaderContinuationToken))
+	}
+
+	var query queryBody
+	if err := json.Unmarshal([]byte(verifier.requests[0].body), &query); err != nil {
+		t.Fatalf("Failed to unmarshal query body: %v", err)
+	}
+	if query.Query != "SELECT * FROM s WHERE s.id = @id" || len(query.Parameters) != 1 {
+		t.Errorf("Unexpected query body %s", verifier.requests[0].body)
+	}
+}
+
+func TestContainerQueryTriggersAndUserDefinedFunctions(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"Triggers":[{"id":"trigger1","body":"function () {}","triggerType":"Post","triggerOperation":"All"}],"_count":1}`)),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"UserDefinedFunctions":[{"id":"udf1","body":"function () {}"}],"_count":1}`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newScriptsTestContainer(t, srv, &verifier)
+
+	triggers, err := container.NewQueryTriggersPager("SELECT * FROM t", nil).NextPage(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to query triggers: %v", err)
+	}
+	if len(triggers.Triggers) != 1 || triggers.Triggers[0].TriggerType != TriggerTypePost || triggers.Triggers[0].TriggerOperation != TriggerOperationAll {
+		t.Errorf("Unexpected triggers %+v", triggers.Triggers)
+	}
+	if verifier.requests[0].url.RequestURI() != "/dbs/databaseId/colls/containerId/triggers" {
+		t.Errorf("Expected url to be %s, but got %s", "/dbs/databaseId/colls/containerId/triggers", verifier.requests[0].url.RequestURI())
+	}
+
+	udfs, err := container.NewQueryUserDefinedFunctionsPager("SELECT * FROM u", nil).NextPage(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to query user defined functions: %v", err)
+	}
+	if len(udfs.UserDefinedFunctions) != 1 || udfs.UserDefinedFunctions[0].ID != "udf1" {
+		t.Errorf("Unexpected user defined functions %+v", udfs.UserDefinedFunctions)
+	}
+	if verifier.requests[1].url.RequestURI() != "/dbs/databaseId/colls/containerId/udfs" {
+		t.Errorf("Expected url to be %s, but got %s", "/dbs/databaseId/colls/containerId/udfs", verifier.requests[1].url.RequestURI())
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// ItemMetadata contains the system properties of an item.
+type ItemMetadata struct {
+	// ID contains the unique id of the item.
+	ID string
+	// ETag contains the entity etag of the item.
+	ETag *azcore.ETag
+	// LastModified contains the last modified time of the item.
+	LastModified time.Time
+}
+
+func newItemMetadata(item []byte) (ItemMetadata, error) {
+	aux := struct {
+		ID        string       `json:"id"`
+		ETag      *azcore.ETag `json:"_etag"`
+		Timestamp int64        `json:"_ts"`
+	}{}
+	if err := json.Unmarshal(item, &aux); err != nil {
+		return ItemMetadata{}, err
+	}
+
+	metadata := ItemMetadata{ID: aux.ID, ETag: aux.ETag}
+	if aux.Timestamp != 0 {
+		metadata.LastModified = time.Unix(aux.Timestamp, 0)
+	}
+	return metadata, nil
+}
+
+// TypedItemResponse represents the response from a typed item request.
+type TypedItemResponse[T any] struct {
+	ItemResponse
+	// Item contains the item of the response. It's the zero value of T when the response has no content,
+	// such as for writes when EnableContentResponseOnWrite is false.
+	Item T
+	// Metadata contains the system properties of the item. Only the ETag is set when the response has no content.
+	Metadata ItemMetadata
+}
+
+func newTypedItemResponse[T any](encoder ItemEncoder, response ItemResponse) (TypedItemResponse[T], error) {
+	typedResponse := TypedItemResponse[T]{ItemResponse: response}
+	if len(response.Value) == 0 {
+		if response.ETag != "" {
+			etag := response.ETag
+			typedResponse.Metadata.ETag = &etag
+		}
+		return typedResponse, nil
+	}
+
+	if err := encoder.Unmarshal(response.Value, &typedResponse.Item); err != nil {
+		return typedResponse, fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	metadata, err := newItemMetadata(response.Value)
+	if err != nil {
+		return typedResponse, fmt.Errorf("failed to read item system properties: %w", err)
+	}
+	typedResponse.Metadata = metadata
+	return typedResponse, nil
+}
+
+// TypedQueryItemsResponse represents a page of a typed query.
+type TypedQueryItemsResponse[T any] struct {
+	QueryItemsResponse
+	// Items contains the items of the page. The raw items are in QueryItemsResponse.Items.
+	Items []T
+}
+
+func newTypedQueryItemsResponse[T any](encoder ItemEncoder, response QueryItemsResponse) (TypedQueryItemsResponse[T], error) {
+	typedResponse := TypedQueryItemsResponse[T]{
+		QueryItemsResponse: response,
+		Items:              make([]T, len(response.Items)),
+	}
+	for i, item := range response.Items {
+		if err := encoder.Unmarshal(item, &typedResponse.Items[i]); err != nil {
+			return typedResponse, fmt.Errorf("failed to unmarshal item %d: %w", i, err)
+		}
+	}
+	return typedResponse, nil
+}
+
+// CreateItemAs creates an item in a Cosmos container, marshaling it with the client's ItemEncoder.
+// ctx - The context for the request.
+// c - The container to create the item in.
+// partitionKey - The partition key for the item.
+// item - The item to create.
+// o - Options for the operation.
+func CreateItemAs[T any](ctx context.Context, c *ContainerClient, partitionKey PartitionKey, item T, o *ItemOptions) (TypedItemResponse[T], error) {
+	encoder := c.database.client.getItemEncoder()
+	marshalled, err := encoder.Marshal(item)
+	if err != nil {
+		return TypedItemResponse[T]{}, err
+	}
+
+	response, err := c.CreateItem(ctx, partitionKey, marshalled, o)
+	if err != nil {
+		return TypedItemResponse[T]{ItemResponse: response}, err
+	}
+	return newTypedItemResponse[T](encoder, response)
+}
+
+// UpsertItemAs creates or replaces an item in a Cosmos container, marshaling it with the client's ItemEncoder.
+// ctx - The context for the request.
+// c - The container to upsert the item in.
+// partitionKey - The partition key for the item.
+// item - The item to upsert.
+// o - Options for the operation.
+func UpsertItemAs[T any](ctx context.Context, c *ContainerClient, partitionKey PartitionKey, item T, o *ItemOptions) (TypedItemResponse[T], error) {
+	encoder := c.database.client.getItemEncoder()
+	marshalled, err := encoder.Marshal(item)
+	if err != nil {
+		return TypedItemResponse[T]{}, err
+	}
+
+	response, err := c.UpsertItem(ctx, partitionKey, marshalled, o)
+	if err != nil {
+		return TypedItemResponse[T]{ItemResponse: response}, err
+	}
+	return newTypedItemResponse[T](encoder, response)
+}
+
+// ReplaceItemAs replaces an item in a Cosmos container, marshaling it with the client's ItemEncoder.
+// The id of the item to replace is read from the id property of the marshaled item.
+// ctx - The context for the request.
+// c - The container of the item.
+// partitionKey - The partition key of the item to replace.
+// item - The content to be used to replace.
+// o - Options for the operation.
+func ReplaceItemAs[T any](ctx context.Context, c *ContainerClient, partitionKey PartitionKey, item T, o *ItemOptions) (TypedItemResponse[T], error) {
+	encoder := c.database.client.getItemEncoder()
+	marshalled, err := encoder.Marshal(item)
+	if err != nil {
+		return TypedItemResponse[T]{}, err
+	}
+
+	metadata, err := newItemMetadata(marshalled)
+	if err != nil {
+		return TypedItemResponse[T]{}, fmt.Errorf("failed to read the id of the item: %w", err)
+	}
+	if metadata.ID == "" {
+		return TypedItemResponse[T]{}, errors.New("the item has no id property")
+	}
+
+	response, err := c.ReplaceItem(ctx, partitionKey, metadata.ID, marshalled, o)
+	if err != nil {
+		return TypedItemResponse[T]{ItemResponse: response}, err
+	}
+	return newTypedItemResponse[T](encoder, response)
+}
+
+// ReadItemAs reads an item in a Cosmos container, unmarshaling it with the client's ItemEncoder.
+// ctx - The context for the request.
+// c - The container of the item.
+// partitionKey - The partition key for the item.
+// itemId - The id of the item to read.
+// o - Options for the operation.
+func ReadItemAs[T any](ctx context.Context, c *ContainerClient, partitionKey PartitionKey, itemId string, o *ItemOptions) (TypedItemResponse[T], error) {
+	response, err := c.ReadItem(ctx, partitionKey, itemId, o)
+	if err != nil {
+		return TypedItemResponse[T]{ItemResponse: response}, err
+	}
+	return newTypedItemResponse[T](c.database.client.getItemEncoder(), response)
+}
+
+// PatchItemAs patches an item in a Cosmos container, unmarshaling the patched item with the client's ItemEncoder.
+// Use a PatchBuilder to build the operations from the fields of T.
+// ctx - The context for the request.
+// c - The container of the item.
+// partitionKey - The partition key for the item.
+// itemId - The id of the item to patch.
+// ops - Operations to perform on the patch
+// o - Options for the operation.
+func PatchItemAs[T any](ctx context.Context, c *ContainerClient, partitionKey PartitionKey, itemId string, ops PatchOperations, o *ItemOptions) (TypedItemResponse[T], error) {
+	response, err := c.PatchItem(ctx, partitionKey, itemId, ops, o)
+	if err != nil {
+		return TypedItemResponse[T]{ItemResponse: response}, err
+	}
+	return newTypedItemResponse[T](c.database.client.getItemEncoder(), response)
+}
+
+// NewQueryItemsPagerAs executes a query in a Cosmos container, unmarshaling the items with the client's ItemEncoder.
+// See ContainerClient.NewQueryItemsPager for the queries that can be executed.
+// c - The container to query.
+// query - The SQL query to execute.
+// partitionKey - The partition key to scope the query on.
+// o - Options for the operation.
+func NewQueryItemsPagerAs[T any](c *ContainerClient, query string, partitionKey PartitionKey, o *QueryOptions) *runtime.Pager[TypedQueryItemsResponse[T]] {
+	encoder := c.database.client.getItemEncoder()
+	pager := c.NewQueryItemsPager(query, partitionKey, o)
+	return runtime.NewPager(runtime.PagingHandler[TypedQueryItemsResponse[T]]{
+		More: func(TypedQueryItemsResponse[T]) bool {
+			return pager.More()
+		},
+		Fetcher: func(ctx context.Context, _ *TypedQueryItemsResponse[T]) (TypedQueryItemsResponse[T], error) {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return TypedQueryItemsResponse[T]{}, err
+			}
+			return newTypedQueryItemsResponse[T](encoder, page)
+		},
+	})
+}
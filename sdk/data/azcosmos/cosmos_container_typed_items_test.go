@@ -0,0 +1,294 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/mock"
+)
+
+type typedTestItem struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func newTypedItemsTestContainer(t *testing.T, srv *mock.Server, encoder ItemEncoder, policies ...policy.Policy) *ContainerClient {
+	defaultEndpoint, _ := url.Parse(srv.URL())
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{PerCall: policies}, &policy.ClientOptions{Transport: srv})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	gem := &globalEndpointManager{preferredLocations: []string{}}
+	client := &Client{endpoint: srv.URL(), endpointUrl: defaultEndpoint, internal: internalClient, gem: gem, itemEncoder: encoder}
+
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+	return container
+}
+
+func TestReadItemAs(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithBody([]byte(`{"id":"doc1","value":"someValue","count":3,"_etag":"someEtag","_ts":1700000000,"_rid":"someRid"}`)),
+		mock.WithHeader(cosmosHeaderEtag, "someEtag"),
+		mock.WithHeader(cosmosHeaderRequestCharge, "1"),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newTypedItemsTestContainer(t, srv, nil, &verifier)
+
+	resp, err := ReadItemAs[typedTestItem](context.TODO(), container, NewPartitionKeyString("pk1"), "doc1", nil)
+	if err != nil {
+		t.Fatalf("Failed to read item: %v", err)
+	}
+
+	expected := typedTestItem{ID: "doc1", Value: "someValue", Count: 3}
+	if resp.Item != expected {
+		t.Errorf("Expected item to be %+v, but got %+v", expected, resp.Item)
+	}
+	if resp.Metadata.ID != "doc1" {
+		t.Errorf("Expected metadata ID to be doc1, but got %s", resp.Metadata.ID)
+	}
+	if resp.Metadata.ETag == nil || *resp.Metadata.ETag != "someEtag" {
+		t.Errorf("Expected metadata ETag to be someEtag, but got %v", resp.Metadata.ETag)
+	}
+	if !resp.Metadata.LastModified.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected metadata LastModified to be %v, but got %v", time.Unix(1700000000, 0), resp.Metadata.LastModified)
+	}
+	if resp.RequestCharge != 1 {
+		t.Errorf("Expected RequestCharge to be 1, but got %f", resp.RequestCharge)
+	}
+	if verifier.requests[0].url.RequestURI() != "/dbs/databaseId/colls/containerId/docs/doc1" {
+		t.Errorf("Expected url to be %s, but got %s", "/dbs/databaseId/colls/containerId/docs/doc1", verifier.requests[0].url.RequestURI())
+	}
+}
+
+func TestWriteItemAs(t *testing.T) {
+	item := typedTestItem{ID: "doc1", Value: "someValue", Count: 3}
+	tests := []struct {
+		name   string
+		call   func(c *ContainerClient) (TypedItemResponse[typedTestItem], error)
+		method string
+		url    string
+		upsert bool
+	}{
+		{
+			name: "CreateItemAs",
+			call: func(c *ContainerClient) (TypedItemResponse[typedTestItem], error) {
+				return CreateItemAs(context.TODO(), c, NewPartitionKeyString("pk1"), item, nil)
+			},
+			method: http.MethodPost,
+			url:    "/dbs/databaseId/colls/containerId/docs",
+		},
+		{
+			name: "UpsertItemAs",
+			call: func(c *ContainerClient) (TypedItemResponse[typedTestItem], error) {
+				return UpsertItemAs(context.TODO(), c, NewPartitionKeyString("pk1"), item, nil)
+			},
+			method: http.MethodPost,
+			url:    "/dbs/databaseId/colls/containerId/docs",
+			upsert: true,
+		},
+		{
+			name: "ReplaceItemAs",
+			call: func(c *ContainerClient) (TypedItemResponse[typedTestItem], error) {
+				return ReplaceItemAs(context.TODO(), c, NewPartitionKeyString("pk1"), item, nil)
+			},
+			method: http.MethodPut,
+			url:    "/dbs/databaseId/colls/containerId/docs/doc1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, close := mock.NewTLSServer()
+			defer close()
+			srv.SetResponse(
+				mock.WithBody([]byte(`{"id":"doc1","value":"someValue","count":3,"_etag":"someEtag","_ts":1700000000}`)),
+				mock.WithHeader(cosmosHeaderEtag, "someEtag"),
+				mock.WithStatusCode(200))
+
+			verifier := pipelineVerifier{}
+			container := newTypedItemsTestContainer(t, srv, nil, &verifier)
+
+			resp, err := tt.call(container)
+			if err != nil {
+				t.Fatalf("Failed to execute %s: %v", tt.name, err)
+			}
+			if resp.Item != item {
+				t.Errorf("Expected item to be %+v, but got %+v", item, resp.Item)
+			}
+			if resp.Metadata.ETag == nil || *resp.Metadata.ETag != "someEtag" {
+				t.Errorf("Expected metadata ETag to be someEtag, but got %v", resp.Metadata.ETag)
+			}
+
+			request := verifier.requests[0]
+			if request.method != tt.method {
+				t.Errorf("Expected method to be %s, but got %s", tt.method, request.method)
+			}
+			if request.url.RequestURI() != tt.url {
+				t.Errorf("Expected url to be %s, but got %s", tt.url, request.url.RequestURI())
+			}
+			if request.body != `{"id":"doc1","value":"someValue","count":3}` {
+				t.Errorf("Unexpected body %s", request.body)
+			}
+			if tt.upsert != (request.headers.Get(cosmosHeaderIsUpsert) == "true") {
+				t.Errorf("Expected upsert header to be %v, but got %s", tt.upsert, request.headers.Get(cosmosHeaderIsUpsert))
+			}
+		})
+	}
+}
+
+func TestWriteItemAsWithoutContentResponse(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithHeader(cosmosHeaderEtag, "someEtag"),
+		mock.WithStatusCode(201))
+
+	container := newTypedItemsTestContainer(t, srv, nil)
+
+	resp, err := CreateItemAs(context.TODO(), container, NewPartitionKeyString("pk1"), typedTestItem{ID: "doc1"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	if resp.Item != (typedTestItem{}) {
+		t.Errorf("Expected no item, but got %+v", resp.Item)
+	}
+	if resp.Metadata.ETag == nil || *resp.Metadata.ETag != "someEtag" {
+		t.Errorf("Expected metadata ETag to be someEtag, but got %v", resp.Metadata.ETag)
+	}
+}
+
+func TestReplaceItemAsRequiresID(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+
+	container := newTypedItemsTestContainer(t, srv, nil)
+
+	_, err := ReplaceItemAs(context.TODO(), container, NewPartitionKeyString("pk1"), typedTestItem{Value: "someValue"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "no id") {
+		t.Fatalf("Expected a missing id error, but got %v", err)
+	}
+	if srv.Requests() != 0 {
+		t.Errorf("Expected no requests, but got %d", srv.Requests())
+	}
+}
+
+func TestPatchItemAs(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithBody([]byte(`{"id":"doc1","value":"someValue","count":4}`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newTypedItemsTestContainer(t, srv, nil, &verifier)
+
+	ops, err := NewPatchBuilder[typedTestItem]().Increment("Count", 1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := PatchItemAs[typedTestItem](context.TODO(), container, NewPartitionKeyString("pk1"), "doc1", ops, nil)
+	if err != nil {
+		t.Fatalf("Failed to patch item: %v", err)
+	}
+	if resp.Item.Count != 4 {
+		t.Errorf("Expected count to be 4, but got %d", resp.Item.Count)
+	}
+	if verifier.requests[0].body != `{"operations":[{"op":"incr","path":"/count","value":1}]}` {
+		t.Errorf("Unexpected body %s", verifier.requests[0].body)
+	}
+}
+
+func TestNewQueryItemsPagerAs(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"Documents":[{"id":"doc1","count":1},{"id":"doc2","count":2}],"_count":2}`)),
+		mock.WithHeader(cosmosHeaderContinuationToken, "someContinuationToken"),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"Documents":[{"id":"doc3","count":3}],"_count":1}`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newTypedItemsTestContainer(t, srv, nil, &verifier)
+
+	items := []typedTestItem{}
+	pager := NewQueryItemsPagerAs[typedTestItem](container, "SELECT * FROM c", NewPartitionKeyString("pk1"), nil)
+	for pager.More() {
+		page, err := pager.NextPage(context.TODO())
+		if err != nil {
+			t.Fatalf("Failed to query items: %v", err)
+		}
+		if len(page.Items) != len(page.QueryItemsResponse.Items) {
+			t.Errorf("Expected %d items, but got %d", len(page.QueryItemsResponse.Items), len(page.Items))
+		}
+		items = append(items, page.Items...)
+	}
+
+	if len(items) != 3 || items[0].ID != "doc1" || items[2].Count != 3 {
+		t.Fatalf("Unexpected items %+v", items)
+	}
+	if verifier.requests[1].headers.Get(cosmosHeaderContinuationToken) != "someContinuationToken" {
+		t.Errorf("Expected continuation token to be someContinuationToken, but got %s", verifier.requests[1].headers.Get(cosmosHeaderContinuationToken))
+	}
+}
+
+// upperCaseIDEncoder stores ids in upper case, to verify the encoder is used in both directions.
+type upperCaseIDEncoder struct{}
+
+func (upperCaseIDEncoder) Marshal(v any) ([]byte, error) {
+	item := v.(typedTestItem)
+	item.ID = strings.ToUpper(item.ID)
+	return json.Marshal(item)
+}
+
+func (upperCaseIDEncoder) Unmarshal(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	item := v.(*typedTestItem)
+	item.ID = strings.ToLower(item.ID)
+	return nil
+}
+
+func TestTypedItemsUseItemEncoder(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithBody([]byte(`{"id":"DOC1","value":"someValue"}`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	container := newTypedItemsTestContainer(t, srv, upperCaseIDEncoder{}, &verifier)
+
+	resp, err := UpsertItemAs(context.TODO(), container, NewPartitionKeyString("pk1"), typedTestItem{ID: "doc1", Value: "someValue"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to upsert item: %v", err)
+	}
+	if !strings.Contains(verifier.requests[0].body, `"id":"DOC1"`) {
+		t.Errorf("Expected the encoder to marshal the item, but got %s", verifier.requests[0].body)
+	}
+	if resp.Item.ID != "doc1" {
+		t.Errorf("Expected the encoder to unmarshal the item, but got %s", resp.Item.ID)
+	}
+	if resp.Metadata.ID != "DOC1" {
+		t.Errorf("Expected metadata ID to be DOC1, but got %s", resp.Metadata.ID)
+	}
+}
@@ -57,6 +57,8 @@ type globalEndpointManager struct {
 	// advance lastUpdateTime/lastAttemptTime -- so an invalidation that
 	// happens during an in-flight refresh is not lost.
 	invalidationGen uint64
+	// partitionBreaker tracks the regions that are unavailable for single partition key ranges.
+	partitionBreaker *partitionCircuitBreaker
 }
 
 // updateFlight tracks a single in-flight refresh.
@@ -87,6 +89,7 @@ func newGlobalEndpointManager(clientEndpoint string, pipeline azruntime.Pipeline
 		locationCache:       newLocationCache(preferredLocations, *endpoint, enableCrossRegionRetries),
 		refreshTimeInterval: refreshTimeInterval,
 		lastUpdateTime:      time.Time{},
+		partitionBreaker:    newPartitionCircuitBreaker(),
 	}
 
 	log.Writef(EventEndpointManager,
@@ -212,6 +215,12 @@ func (gem *globalEndpointManager) ResolveServiceEndpoint(locationIndex int, reso
 	return gem.locationCache.resolveServiceEndpoint(locationIndex, resourceType, isWriteOperation, useWriteEndpoint)
 }
 
+// ResolveServiceEndpointExcluding resolves the endpoint like ResolveServiceEndpoint, skipping the regions for which
+// skip returns true. It returns the skipped regions.
+func (gem *globalEndpointManager) ResolveServiceEndpointExcluding(locationIndex int, resourceType resourceType, isWriteOperation, useWriteEndpoint bool, skip func(regionId) bool) (url.URL, []regionId) {
+	return gem.locationCache.resolveServiceEndpointExcluding(locationIndex, resourceType, isWriteOperation, useWriteEndpoint, skip)
+}
+
 // Update refreshes the GEM cache by calling GetAccountProperties when needed.
 // Concurrent callers are coalesced via a single-in-flight pattern so at most
 // one HTTP call is in flight per client at any time. Both successes and
@@ -23,6 +23,9 @@ type headerOptionsOverride struct {
 	correlatedActivityId         *uuid.UUID
 	priorityLevel                *PriorityLevel
 	throughputBucket             *int32
+	throughputControlGroup       *string
+	// excludedRegions isn't a header, it's read by clientRetryPolicy when routing the request.
+	excludedRegions []string
 }
 
 func (p *headerPolicies) Do(req *policy.Request) (*http.Response, error) {
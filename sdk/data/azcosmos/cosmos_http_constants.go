@@ -44,12 +44,16 @@ const (
 	cosmosHeaderIsBatchRequest                     string = "x-ms-cosmos-is-batch-request"
 	cosmosHeaderIsBatchAtomic                      string = "x-ms-cosmos-batch-atomic"
 	cosmosHeaderIsBatchOrdered                     string = "x-ms-cosmos-batch-ordered"
+	cosmosHeaderBatchContinueOnError               string = "x-ms-cosmos-batch-continue-on-error"
+	cosmosHeaderRetryAfterMs                       string = "x-ms-retry-after-ms"
 	cosmosHeaderSDKSupportedCapabilities           string = "x-ms-cosmos-sdk-supportedcapabilities"
 	cosmosHeaderEnableCrossPartitionQuery          string = "x-ms-documentdb-query-enablecrosspartition"
 	cosmosHeaderIsQueryPlanRequest                 string = "x-ms-cosmos-is-query-plan-request"
 	cosmosHeaderSupportedQueryFeatures             string = "x-ms-cosmos-supported-query-features"
 	cosmosHeaderAllowTentativeWrites               string = "x-ms-cosmos-allow-tentative-writes"
 	cosmosHeaderPartitionKeyRangeId                string = "x-ms-documentdb-partitionkeyrangeid"
+	cosmosHeaderStartEpk                           string = "x-ms-start-epk"
+	cosmosHeaderEndEpk                             string = "x-ms-end-epk"
 	headerXmsDate                                  string = "x-ms-date"
 	headerAuthorization                            string = "Authorization"
 	headerContentType                              string = "Content-Type"
@@ -96,13 +100,18 @@ const (
 	headerDedicatedGatewayBypassCache              string = "x-ms-dedicatedgateway-bypass-cache"
 	cosmosHeaderPriorityLevel                      string = "x-ms-cosmos-priority-level"
 	cosmosHeaderThroughputBucket                   string = "x-ms-cosmos-throughput-bucket"
+	cosmosHeaderChangeFeedWireFormatVersion        string = "x-ms-cosmos-changefeed-wire-format-version"
+	cosmosHeaderScriptEnableLogging                string = "x-ms-documentdb-script-enable-logging"
+	cosmosHeaderScriptLogResults                   string = "x-ms-documentdb-script-log-results"
 )
 
 const (
-	cosmosHeaderValuesPreferMinimal string = "return=minimal"
-	cosmosHeaderValuesQuery         string = "application/query+json"
-	cosmosHeaderValuesChangeFeed    string = "Incremental Feed"
-	cosmosHeaderValuesMaxItemAll    string = "-1"
+	cosmosHeaderValuesPreferMinimal                   string = "return=minimal"
+	cosmosHeaderValuesQuery                           string = "application/query+json"
+	cosmosHeaderValuesChangeFeed                      string = "Incremental Feed"
+	cosmosHeaderValuesChangeFeedAllVersionsAndDeletes string = "Full-Fidelity Feed"
+	cosmosHeaderValuesChangeFeedWireFormatVersion     string = "2021-09-15"
+	cosmosHeaderValuesMaxItemAll                      string = "-1"
 )
 
 // Substatus Codes
@@ -17,6 +17,8 @@ var allKnownHttpHeaders []string = []string{
 	cosmosHeaderSessionToken,
 	cosmosHeaderConsistencyLevel,
 	cosmosHeaderPartitionKey,
+	cosmosHeaderChangeFeed,
+	cosmosHeaderIfModifiedSince,
 	cosmosHeaderPrefer,
 	cosmosHeaderIsUpsert,
 	cosmosHeaderOfferThroughput,
@@ -36,12 +38,16 @@ var allKnownHttpHeaders []string = []string{
 	cosmosHeaderIsBatchRequest,
 	cosmosHeaderIsBatchAtomic,
 	cosmosHeaderIsBatchOrdered,
+	cosmosHeaderBatchContinueOnError,
+	cosmosHeaderRetryAfterMs,
 	cosmosHeaderSDKSupportedCapabilities,
 	cosmosHeaderEnableCrossPartitionQuery,
 	cosmosHeaderIsQueryPlanRequest,
 	cosmosHeaderSupportedQueryFeatures,
 	cosmosHeaderAllowTentativeWrites,
 	cosmosHeaderPartitionKeyRangeId,
+	cosmosHeaderStartEpk,
+	cosmosHeaderEndEpk,
 	headerXmsDate,
 	headerAuthorization,
 	headerContentType,
@@ -85,4 +91,10 @@ var allKnownHttpHeaders []string = []string{
 	cosmosHeaderQueryExecutionInfo,
 	headerXmsItemCount,
 	headerDedicatedGatewayMaxAge,
+	headerDedicatedGatewayBypassCache,
+	cosmosHeaderPriorityLevel,
+	cosmosHeaderThroughputBucket,
+	cosmosHeaderChangeFeedWireFormatVersion,
+	cosmosHeaderScriptEnableLogging,
+	cosmosHeaderScriptLogResults,
 }
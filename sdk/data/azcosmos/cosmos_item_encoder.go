@@ -0,0 +1,29 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+)
+
+// ItemEncoder marshals items to and unmarshals items from the JSON documents stored in Cosmos DB.
+// Set it in ClientOptions.ItemEncoder to replace encoding/json in the typed item functions.
+// Implementations must be safe for concurrent use.
+type ItemEncoder interface {
+	// Marshal returns the JSON document of v.
+	Marshal(v any) ([]byte, error)
+	// Unmarshal parses the JSON document data into the value pointed to by v.
+	Unmarshal(data []byte, v any) error
+}
+
+// jsonItemEncoder is the default ItemEncoder, which uses encoding/json.
+type jsonItemEncoder struct{}
+
+func (jsonItemEncoder) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonItemEncoder) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
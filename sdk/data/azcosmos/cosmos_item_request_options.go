@@ -44,6 +44,13 @@ type ItemOptions struct {
 	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
 	// The valid range is 1 to 5 (inclusive).
 	ThroughputBucket *int32
+	// ThroughputControlGroupName selects the throughput control group of the operation, instead of the default group of the container.
+	// See ClientOptions.ThroughputControlGroups.
+	ThroughputControlGroupName *string
+	// ExcludedRegions lists the regions that the operation isn't routed to, such as "West US".
+	// The operation uses the other regions of the account, or the excluded regions if it can't use another region,
+	// such as for writes on accounts with a single write region.
+	ExcludedRegions []string
 }
 
 func (options *ItemOptions) toHeaders() *map[string]string {
@@ -184,6 +184,62 @@ func (lc *locationCache) resolveServiceEndpoint(locationIndex int, resourceType
 	// race with us without this lock.
 	lc.mapMutex.RLock()
 	defer lc.mapMutex.RUnlock()
+	return lc.resolveServiceEndpointLocked(locationIndex, resourceType, isWriteOperation, useWriteEndpoint)
+}
+
+// resolveServiceEndpointExcluding resolves the endpoint like resolveServiceEndpoint, skipping the endpoints of the
+// regions for which skip returns true, and returns the skipped regions. The regions of the account that aren't in
+// the preferred route list are appended to it, so a request can be routed out of its excluded regions without
+// preferred regions. Requests that can only use the single write region, and requests for which every region is
+// skipped, aren't rerouted.
+func (lc *locationCache) resolveServiceEndpointExcluding(locationIndex int, resourceType resourceType, isWriteOperation, useWriteEndpoint bool, skip func(regionId) bool) (url.URL, []regionId) {
+	lc.mapMutex.RLock()
+	defer lc.mapMutex.RUnlock()
+	if (isWriteOperation || useWriteEndpoint) && !lc.canUseMultipleWriteLocsToRoute(resourceType) {
+		return lc.resolveServiceEndpointLocked(locationIndex, resourceType, isWriteOperation, useWriteEndpoint), nil
+	}
+
+	endpoints := lc.locationInfo.readEndpoints
+	locations := lc.locationInfo.availReadLocations
+	endpointsByLocation := lc.locationInfo.availReadEndpointsByLocation
+	if isWriteOperation {
+		endpoints = lc.locationInfo.writeEndpoints
+		locations = lc.locationInfo.availWriteLocations
+		endpointsByLocation = lc.locationInfo.availWriteEndpointsByLocation
+	}
+
+	routed := make([]url.URL, 0, len(endpoints))
+	var skipped []regionId
+	seen := make(map[url.URL]bool, len(endpoints))
+	consider := func(endpoint url.URL) {
+		if seen[endpoint] {
+			return
+		}
+		seen[endpoint] = true
+		if location := lc.getLocationLocked(endpoint); location != "" && skip(location) {
+			skipped = append(skipped, location)
+			return
+		}
+		routed = append(routed, endpoint)
+	}
+	for _, endpoint := range endpoints {
+		consider(endpoint)
+	}
+	if lc.enableCrossRegionRetries {
+		for _, location := range locations {
+			if endpoint, ok := endpointsByLocation[location]; ok {
+				consider(endpoint)
+			}
+		}
+	}
+
+	if len(skipped) == 0 || len(routed) == 0 {
+		return lc.resolveServiceEndpointLocked(locationIndex, resourceType, isWriteOperation, useWriteEndpoint), nil
+	}
+	return routed[locationIndex%len(routed)], skipped
+}
+
+func (lc *locationCache) resolveServiceEndpointLocked(locationIndex int, resourceType resourceType, isWriteOperation, useWriteEndpoint bool) url.URL {
 	if (isWriteOperation || useWriteEndpoint) && !lc.canUseMultipleWriteLocsToRoute(resourceType) {
 		if lc.enableCrossRegionRetries && len(lc.locationInfo.availWriteLocations) > 0 {
 			locationIndex = min(locationIndex%2, len(lc.locationInfo.availWriteLocations)-1)
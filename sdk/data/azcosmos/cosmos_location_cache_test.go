@@ -469,3 +469,69 @@ func TestWriteEndpointUsedAsFallbackForRead(t *testing.T) {
 		t.Errorf("Expected read endpoint order %s, but was %s", expectedReadEndpointOrder, actualReadEndpointsOrder)
 	}
 }
+
+func TestResolveServiceEndpointExcluding(t *testing.T) {
+	lc := ResetLocationCache()
+	lc.locationInfo.prefLocations = []regionId{loc1.Name, loc2.Name}
+	err := lc.databaseAccountRead(CreateDatabaseAccount(false, true))
+	if err != nil {
+		t.Fatalf("Received error Reading DB account: %s", err.Error())
+	}
+	excluding := func(regions ...regionId) func(regionId) bool {
+		return func(region regionId) bool {
+			for _, excluded := range regions {
+				if region == excluded {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	// nothing skipped resolves like resolveServiceEndpoint
+	endpoint, skipped := lc.resolveServiceEndpointExcluding(0, resourceTypeDocument, false, false, excluding())
+	if endpoint != *loc1Endpoint || len(skipped) != 0 {
+		t.Errorf("Expected %s and no skipped regions, but was %s and %v", loc1Endpoint, endpoint.String(), skipped)
+	}
+
+	// the preferred region is skipped
+	endpoint, skipped = lc.resolveServiceEndpointExcluding(0, resourceTypeDocument, false, false, excluding(loc1.Name))
+	if endpoint != *loc2Endpoint || len(skipped) != 1 || skipped[0] != loc1.Name {
+		t.Errorf("Expected %s and skipped %s, but was %s and %v", loc2Endpoint, loc1.Name, endpoint.String(), skipped)
+	}
+
+	// the location index rotates over the regions that aren't skipped, including the regions that aren't preferred
+	endpoint, _ = lc.resolveServiceEndpointExcluding(1, resourceTypeDocument, false, false, excluding(loc1.Name))
+	if endpoint != *loc4Endpoint {
+		t.Errorf("Expected %s, but was %s", loc4Endpoint, endpoint.String())
+	}
+
+	// every region is skipped
+	endpoint, skipped = lc.resolveServiceEndpointExcluding(0, resourceTypeDocument, false, false, excluding(loc1.Name, loc2.Name, loc4.Name))
+	if endpoint != *loc1Endpoint || len(skipped) != 0 {
+		t.Errorf("Expected %s and no skipped regions, but was %s and %v", loc1Endpoint, endpoint.String(), skipped)
+	}
+
+	// writes to the single write region aren't rerouted
+	endpoint, skipped = lc.resolveServiceEndpointExcluding(0, resourceTypeDocument, true, false, excluding(loc1.Name))
+	if endpoint != *loc1Endpoint || len(skipped) != 0 {
+		t.Errorf("Expected %s and no skipped regions, but was %s and %v", loc1Endpoint, endpoint.String(), skipped)
+	}
+}
+
+func TestResolveServiceEndpointExcludingMultiMasterWrite(t *testing.T) {
+	lc := ResetLocationCache()
+	lc.enableMultipleWriteLocations = true
+	lc.locationInfo.prefLocations = []regionId{loc1.Name, loc2.Name, loc3.Name}
+	err := lc.databaseAccountRead(CreateDatabaseAccount(true, false))
+	if err != nil {
+		t.Fatalf("Received error Reading DB account: %s", err.Error())
+	}
+
+	endpoint, skipped := lc.resolveServiceEndpointExcluding(0, resourceTypeDocument, true, false, func(region regionId) bool {
+		return region == loc1.Name
+	})
+	if endpoint != *loc2Endpoint || len(skipped) != 1 {
+		t.Errorf("Expected %s and one skipped region, but was %s and %v", loc2Endpoint, endpoint.String(), skipped)
+	}
+}
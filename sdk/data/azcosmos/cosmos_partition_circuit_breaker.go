@@ -0,0 +1,344 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+)
+
+const (
+	// partitionFailureThreshold is the number of consecutive failures of the requests to a partition key range in a
+	// region after which the region is unavailable for the partition key range.
+	partitionFailureThreshold = 5
+	// partitionUnavailableDuration is how long a region stays unavailable for a partition key range. Afterwards the
+	// requests are routed to the region again, and a single failure makes it unavailable again.
+	partitionUnavailableDuration = time.Minute
+	// partitionKeyRangesPopulateInterval is the minimum time between two attempts to populate the caches of a
+	// container for the breaker.
+	partitionKeyRangesPopulateInterval = 30 * time.Second
+	// partitionKeyRangesPopulateTimeout bounds an attempt to populate the caches of a container for the breaker.
+	partitionKeyRangesPopulateTimeout = time.Minute
+)
+
+// partitionCircuitBreaker tracks the health of partition key ranges per region. The account-level region health of
+// the locationCache doesn't notice a single unhealthy partition key range, so a region becomes unavailable for a
+// partition key range after consecutive 503, 410 or timeout failures of the requests to it. The requests to the
+// partition key range are then routed to the next region, while the other partition key ranges keep using the region.
+type partitionCircuitBreaker struct {
+	mu                  sync.Mutex
+	failureThreshold    int
+	unavailableDuration time.Duration
+	now                 func() time.Time
+	partitions          map[partitionKeyRangeKey]map[regionId]*partitionRegionHealth
+	// resolvePartitionKeyRangeID resolves the partition key range of a partition key from the client caches, without
+	// fetching them. It's nil when the breaker has no client.
+	resolvePartitionKeyRangeID func(containerLink string, partitionKey PartitionKey) (string, bool)
+	// populatePartitionKeyRanges fetches the properties and the partition key ranges of a container into the client
+	// caches, so that resolvePartitionKeyRangeID resolves the partition key ranges of the requests to the container.
+	// It's nil when the breaker has no client.
+	populatePartitionKeyRanges func(ctx context.Context, containerLink string) error
+	// populated holds when the caches of each container were last populated for the breaker.
+	populated map[string]time.Time
+}
+
+// partitionKeyRangeKey identifies the partition key range of a request.
+type partitionKeyRangeKey struct {
+	containerLink       string
+	partitionKeyRangeID string
+}
+
+func (k partitionKeyRangeKey) String() string {
+	return k.containerLink + "/" + pathSegmentPartitionKeyRange + "/" + k.partitionKeyRangeID
+}
+
+type partitionRegionHealth struct {
+	consecutiveFailures int
+	unavailableUntil    time.Time
+}
+
+func newPartitionCircuitBreaker() *partitionCircuitBreaker {
+	return &partitionCircuitBreaker{
+		failureThreshold:    partitionFailureThreshold,
+		unavailableDuration: partitionUnavailableDuration,
+		now:                 time.Now,
+		partitions:          map[partitionKeyRangeKey]map[regionId]*partitionRegionHealth{},
+		populated:           map[string]time.Time{},
+	}
+}
+
+// partitionFor returns the partition key range of a request, or false if the request doesn't target a single
+// partition key range of a container. The requests whose partition key range isn't known, such as before the partition
+// key ranges of the container are cached, aren't tracked, so that the breaker has an entry per partition key range
+// rather than per partition key. Point operations don't need the caches, so the caches are populated in the background
+// for the next requests.
+func (b *partitionCircuitBreaker) partitionFor(req *policy.Request, o pipelineRequestOptions) (partitionKeyRangeKey, bool) {
+	if b == nil || o.resourceType != resourceTypeDocument {
+		return partitionKeyRangeKey{}, false
+	}
+
+	containerLink := o.resourceAddress
+	if i := strings.Index(containerLink, "/"+pathSegmentDocument+"/"); i >= 0 {
+		containerLink = containerLink[:i]
+	}
+
+	if rangeID := req.Raw().Header.Get(cosmosHeaderPartitionKeyRangeId); rangeID != "" {
+		return partitionKeyRangeKey{containerLink: containerLink, partitionKeyRangeID: rangeID}, true
+	}
+	if o.headerOptionsOverride == nil || o.headerOptionsOverride.partitionKey == nil || len(o.headerOptionsOverride.partitionKey.values) == 0 {
+		return partitionKeyRangeKey{}, false
+	}
+
+	if b.resolvePartitionKeyRangeID == nil {
+		return partitionKeyRangeKey{}, false
+	}
+	rangeID, ok := b.resolvePartitionKeyRangeID(containerLink, *o.headerOptionsOverride.partitionKey)
+	if !ok {
+		b.populate(containerLink)
+		return partitionKeyRangeKey{}, false
+	}
+	return partitionKeyRangeKey{containerLink: containerLink, partitionKeyRangeID: rangeID}, true
+}
+
+// populate populates the caches of the container in the background, unless they were populated recently.
+func (b *partitionCircuitBreaker) populate(containerLink string) {
+	if b.populatePartitionKeyRanges == nil {
+		return
+	}
+	b.mu.Lock()
+	now := b.now()
+	if last, ok := b.populated[containerLink]; ok && now.Sub(last) < partitionKeyRangesPopulateInterval {
+		b.mu.Unlock()
+		return
+	}
+	b.populated[containerLink] = now
+	b.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), partitionKeyRangesPopulateTimeout)
+		defer cancel()
+		if err := b.populatePartitionKeyRanges(ctx, containerLink); err != nil {
+			log.Writef(EventEndpointManager,
+				"Failed to populate the partition key ranges of container %s: %v", containerLink, err)
+		}
+	}()
+}
+
+// hasUnavailableRegions reports whether a region is unavailable for the partition key range.
+func (b *partitionCircuitBreaker) hasUnavailableRegions(partition partitionKeyRangeKey) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	for _, health := range b.partitions[partition] {
+		if now.Before(health.unavailableUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnavailable reports whether the region is unavailable for the partition key range.
+func (b *partitionCircuitBreaker) isUnavailable(partition partitionKeyRangeKey, region regionId) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	health, ok := b.partitions[partition][region]
+	return ok && b.now().Before(health.unavailableUntil)
+}
+
+// recordFailure records a failure of a request to the partition key range in the region. It returns true if the
+// failure made the region unavailable for the partition key range.
+func (b *partitionCircuitBreaker) recordFailure(partition partitionKeyRangeKey, region regionId) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	regions, ok := b.partitions[partition]
+	if !ok {
+		regions = map[regionId]*partitionRegionHealth{}
+		b.partitions[partition] = regions
+	}
+	health, ok := regions[region]
+	if !ok {
+		health = &partitionRegionHealth{}
+		regions[region] = health
+	}
+
+	now := b.now()
+	health.consecutiveFailures++
+	if health.consecutiveFailures < b.failureThreshold || now.Before(health.unavailableUntil) {
+		return false
+	}
+	health.unavailableUntil = now.Add(b.unavailableDuration)
+	log.Writef(EventEndpointManager,
+		"Marked partition key range unavailable: partition=%s, region=%s, consecutiveFailures=%d, unavailableFor=%v",
+		partition, region, health.consecutiveFailures, b.unavailableDuration)
+	return true
+}
+
+// recordSuccess records a request to the partition key range in the region that didn't fail, which makes the region
+// available for the partition key range again.
+func (b *partitionCircuitBreaker) recordSuccess(partition partitionKeyRangeKey, region regionId) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	regions, ok := b.partitions[partition]
+	if !ok {
+		return
+	}
+	if health, ok := regions[region]; ok {
+		if health.consecutiveFailures >= b.failureThreshold {
+			log.Writef(EventEndpointManager,
+				"Partition key range is available again: partition=%s, region=%s", partition, region)
+		}
+		delete(regions, region)
+	}
+	if len(regions) == 0 {
+		delete(b.partitions, partition)
+	}
+}
+
+// isPartitionFailureStatus reports whether a response status counts as a failure of the partition key range.
+// A 410 for a partition key range that was split or moved isn't a failure.
+func isPartitionFailureStatus(statusCode int, subStatus string) bool {
+	switch statusCode {
+	case http.StatusServiceUnavailable, http.StatusRequestTimeout:
+		return true
+	case http.StatusGone:
+		return !isPartitionKeyRangeGoneError(statusCode, subStatus)
+	}
+	return false
+}
+
+// requestRouting holds the routing constraints of a request: the regions it excludes, and the partition key range
+// whose unavailable regions it skips.
+type requestRouting struct {
+	breaker         *partitionCircuitBreaker
+	excludedRegions map[regionId]bool
+	partition       partitionKeyRangeKey
+	hasPartition    bool
+}
+
+func newRequestRouting(breaker *partitionCircuitBreaker, req *policy.Request, o pipelineRequestOptions) requestRouting {
+	routing := requestRouting{breaker: breaker}
+	routing.partition, routing.hasPartition = breaker.partitionFor(req, o)
+	if o.headerOptionsOverride != nil && len(o.headerOptionsOverride.excludedRegions) > 0 {
+		routing.excludedRegions = make(map[regionId]bool, len(o.headerOptionsOverride.excludedRegions))
+		for _, region := range o.headerOptionsOverride.excludedRegions {
+			routing.excludedRegions[newRegionId(region)] = true
+		}
+	}
+	return routing
+}
+
+// needsResolve reports whether the request has regions to skip.
+func (r *requestRouting) needsResolve() bool {
+	return len(r.excludedRegions) > 0 || (r.hasPartition && r.breaker.hasUnavailableRegions(r.partition))
+}
+
+func (r *requestRouting) skip(region regionId) bool {
+	return r.excludedRegions[region] || (r.hasPartition && r.breaker.isUnavailable(r.partition, region))
+}
+
+// skipReason returns the reason the region was skipped, for the diagnostics.
+func (r *requestRouting) skipReason(region regionId) string {
+	if r.excludedRegions[region] {
+		return routingReasonExcludedRegion
+	}
+	return routingReasonPartitionUnavailable
+}
+
+// partitionString returns the partition key range of the request for the diagnostics, or "" if it has none.
+func (r *requestRouting) partitionString() string {
+	if !r.hasPartition {
+		return ""
+	}
+	return r.partition.String()
+}
+
+// recordResponse records the outcome of a request to the region. It returns true if the outcome made the region
+// unavailable for the partition key range of the request.
+func (r *requestRouting) recordResponse(region regionId, statusCode int, subStatus string) bool {
+	if !r.hasPartition || region == "" {
+		return false
+	}
+	if isPartitionFailureStatus(statusCode, subStatus) {
+		return r.breaker.recordFailure(r.partition, region)
+	}
+	r.breaker.recordSuccess(r.partition, region)
+	return false
+}
+
+// recordError records a transport failure of a request to the region. It returns true if the failure made the region
+// unavailable for the partition key range of the request.
+func (r *requestRouting) recordError(region regionId, err error) bool {
+	if !r.hasPartition || region == "" || classifyNetworkError(err) == connectionErrorNone {
+		return false
+	}
+	return r.breaker.recordFailure(r.partition, region)
+}
+
+// cachedPartitionKeyRangeID returns the ID of the partition key range of the partition key, if the properties and the
+// partition key ranges of the container are cached.
+func (c *Client) cachedPartitionKeyRangeID(containerLink string, partitionKey PartitionKey) (string, bool) {
+	containerCache := c.getContainerCache()
+	pkRangeCache := c.getPKRangeCache()
+	if containerCache == nil || pkRangeCache == nil {
+		return "", false
+	}
+	props := containerCache.peekProperties(containerLink)
+	if props == nil || props.ResourceID == "" {
+		return "", false
+	}
+	routingMap := pkRangeCache.peekRoutingMap(props.ResourceID)
+	if routingMap == nil {
+		return "", false
+	}
+	epk, err := computeEPKRange(&partitionKey, props.PartitionKeyDefinition)
+	if err != nil || epk.isRange() {
+		return "", false
+	}
+	return findPhysicalRangeForEPK(epk.Min, routingMap.orderedRanges)
+}
+
+// populatePartitionKeyRanges fetches the properties and the partition key ranges of the container into the client
+// caches.
+func (c *Client) populatePartitionKeyRanges(ctx context.Context, containerLink string) error {
+	containerCache := c.getContainerCache()
+	pkRangeCache := c.getPKRangeCache()
+	if containerCache == nil || pkRangeCache == nil {
+		return nil
+	}
+	container, err := c.containerFromLink(containerLink)
+	if err != nil {
+		return err
+	}
+	props, err := containerCache.getProperties(ctx, container)
+	if err != nil {
+		return err
+	}
+	_, err = pkRangeCache.getRoutingMap(ctx, props.ResourceID, containerLink, c)
+	return err
+}
+
+// containerFromLink returns the ContainerClient of a container link such as "dbs/database/colls/container".
+func (c *Client) containerFromLink(containerLink string) (*ContainerClient, error) {
+	segments := strings.Split(containerLink, "/")
+	if len(segments) != 4 || segments[0] != pathSegmentDatabase || segments[2] != pathSegmentCollection {
+		return nil, fmt.Errorf("%q isn't a container link", containerLink)
+	}
+	databaseID, err := url.PathUnescape(segments[1])
+	if err != nil {
+		return nil, err
+	}
+	containerID, err := url.PathUnescape(segments[3])
+	if err != nil {
+		return nil, err
+	}
+	return c.NewContainer(databaseID, containerID)
+}
@@ -0,0 +1,424 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// cSpell:ignore azcosmosgemtest azcosmostest
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPartitionCircuitBreaker(now *time.Time) *partitionCircuitBreaker {
+	breaker := newPartitionCircuitBreaker()
+	breaker.failureThreshold = 2
+	breaker.now = func() time.Time { return *now }
+	return breaker
+}
+
+func TestPartitionCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	now := time.Now()
+	breaker := newTestPartitionCircuitBreaker(&now)
+	partition := partitionKeyRangeKey{containerLink: "dbs/db/colls/coll", partitionKeyRangeID: "0"}
+	other := partitionKeyRangeKey{containerLink: "dbs/db/colls/coll", partitionKeyRangeID: "1"}
+	eastUS := newRegionId("East US")
+
+	require.False(t, breaker.recordFailure(partition, eastUS))
+	breaker.recordSuccess(partition, eastUS)
+	require.False(t, breaker.recordFailure(partition, eastUS))
+	require.False(t, breaker.isUnavailable(partition, eastUS))
+
+	require.True(t, breaker.recordFailure(partition, eastUS))
+	require.True(t, breaker.isUnavailable(partition, eastUS))
+	require.True(t, breaker.hasUnavailableRegions(partition))
+	require.False(t, breaker.isUnavailable(partition, newRegionId("West US")))
+	require.False(t, breaker.hasUnavailableRegions(other))
+
+	// failures while the region is unavailable don't open it again
+	require.False(t, breaker.recordFailure(partition, eastUS))
+
+	// the region is available again after the unavailable duration, and a single failure makes it unavailable again
+	now = now.Add(partitionUnavailableDuration + time.Second)
+	require.False(t, breaker.isUnavailable(partition, eastUS))
+	require.True(t, breaker.recordFailure(partition, eastUS))
+
+	now = now.Add(partitionUnavailableDuration + time.Second)
+	breaker.recordSuccess(partition, eastUS)
+	require.False(t, breaker.recordFailure(partition, eastUS))
+	require.False(t, breaker.isUnavailable(partition, eastUS))
+}
+
+func TestIsPartitionFailureStatus(t *testing.T) {
+	require.True(t, isPartitionFailureStatus(http.StatusServiceUnavailable, ""))
+	require.True(t, isPartitionFailureStatus(http.StatusRequestTimeout, ""))
+	require.True(t, isPartitionFailureStatus(http.StatusGone, ""))
+	require.False(t, isPartitionFailureStatus(http.StatusGone, subStatusPartitionKeyRangeGone))
+	require.False(t, isPartitionFailureStatus(http.StatusGone, subStatusCompletingSplit))
+	require.False(t, isPartitionFailureStatus(http.StatusNotFound, ""))
+	require.False(t, isPartitionFailureStatus(http.StatusTooManyRequests, ""))
+}
+
+func TestRequestRoutingRecordsTransportFailures(t *testing.T) {
+	now := time.Now()
+	routing := requestRouting{
+		breaker:      newTestPartitionCircuitBreaker(&now),
+		partition:    partitionKeyRangeKey{containerLink: "dbs/db/colls/coll", partitionKeyRangeID: "0"},
+		hasPartition: true,
+	}
+	eastUS := newRegionId("East US")
+
+	require.False(t, routing.recordError(eastUS, errors.New("not a transport failure")))
+	require.False(t, routing.recordError(eastUS, syscall.ECONNREFUSED))
+	require.True(t, routing.recordError(eastUS, syscall.ECONNRESET))
+	require.True(t, routing.skip(eastUS))
+	require.Equal(t, routingReasonPartitionUnavailable, routing.skipReason(eastUS))
+}
+
+func TestPartitionForRequest(t *testing.T) {
+	breaker := newPartitionCircuitBreaker()
+	partitionKey := NewPartitionKeyString("1")
+	newRequest := func(header string) *policy.Request {
+		req, err := azruntime.NewRequest(context.Background(), http.MethodGet, "https://localhost/dbs/db/colls/coll/docs/doc1")
+		require.NoError(t, err)
+		if header != "" {
+			req.Raw().Header.Set(cosmosHeaderPartitionKeyRangeId, header)
+		}
+		return req
+	}
+
+	o := pipelineRequestOptions{
+		resourceType:          resourceTypeDocument,
+		resourceAddress:       "dbs/db/colls/coll/docs/doc1",
+		headerOptionsOverride: &headerOptionsOverride{partitionKey: &partitionKey},
+	}
+	// the partition key range isn't known without the caches, so the request isn't tracked
+	_, ok := breaker.partitionFor(newRequest(""), o)
+	require.False(t, ok)
+
+	breaker.resolvePartitionKeyRangeID = func(containerLink string, pk PartitionKey) (string, bool) {
+		return "", false
+	}
+	_, ok = breaker.partitionFor(newRequest(""), o)
+	require.False(t, ok)
+
+	breaker.resolvePartitionKeyRangeID = func(containerLink string, pk PartitionKey) (string, bool) {
+		require.Equal(t, "dbs/db/colls/coll", containerLink)
+		return "3", true
+	}
+	partition, ok := breaker.partitionFor(newRequest(""), o)
+	require.True(t, ok)
+	require.Equal(t, partitionKeyRangeKey{containerLink: "dbs/db/colls/coll", partitionKeyRangeID: "3"}, partition)
+
+	partition, ok = breaker.partitionFor(newRequest("7"), o)
+	require.True(t, ok)
+	require.Equal(t, "dbs/db/colls/coll/pkranges/7", partition.String())
+
+	emptyKey := NewPartitionKey()
+	_, ok = breaker.partitionFor(newRequest(""), pipelineRequestOptions{
+		resourceType:          resourceTypeDocument,
+		resourceAddress:       "dbs/db/colls/coll",
+		headerOptionsOverride: &headerOptionsOverride{partitionKey: &emptyKey},
+	})
+	require.False(t, ok)
+
+	_, ok = breaker.partitionFor(newRequest(""), pipelineRequestOptions{resourceType: resourceTypeCollection, resourceAddress: "dbs/db/colls/coll"})
+	require.False(t, ok)
+
+	var nilBreaker *partitionCircuitBreaker
+	_, ok = nilBreaker.partitionFor(newRequest(""), o)
+	require.False(t, ok)
+}
+
+func TestCachedPartitionKeyRangeID(t *testing.T) {
+	containerCache := newContainerPropertiesCache()
+	pkRangeCache := newPartitionKeyRangeCache()
+	client := &Client{caches: &sharedCacheSet{containerCache: containerCache, pkRangeCache: pkRangeCache}}
+	containerLink := "dbs/databaseId/colls/containerId"
+
+	_, ok := client.cachedPartitionKeyRangeID(containerLink, NewPartitionKeyString("1"))
+	require.False(t, ok)
+
+	containerCache.set(containerLink, &ContainerProperties{
+		ID:         "containerId",
+		ResourceID: "testRID",
+		PartitionKeyDefinition: PartitionKeyDefinition{
+			Paths:   []string{"/pk"},
+			Kind:    PartitionKeyKindHash,
+			Version: 2,
+		},
+	})
+	_, ok = client.cachedPartitionKeyRangeID(containerLink, NewPartitionKeyString("1"))
+	require.False(t, ok)
+
+	pkRangeCache.entries["testRID"] = &pkRangeCacheEntry{
+		routingMap: newCollectionRoutingMap([]partitionKeyRange{
+			{ID: "0", MinInclusive: "", MaxExclusive: "FF", ResourceID: "testRID"},
+		}, "etag1"),
+	}
+	rangeID, ok := client.cachedPartitionKeyRangeID(containerLink, NewPartitionKeyString("1"))
+	require.True(t, ok)
+	require.Equal(t, "0", rangeID)
+
+	_, ok = (&Client{}).cachedPartitionKeyRangeID(containerLink, NewPartitionKeyString("1"))
+	require.False(t, ok)
+}
+
+// newPartitionRoutingTestContainer creates a container whose reads resolve to endpointA in East US, followed by
+// endpointB in Central US.
+func newPartitionRoutingTestContainer(t *testing.T, transport policy.Transporter, endpointA, endpointB *url.URL, breaker *partitionCircuitBreaker) *ContainerClient {
+	lc := CreateMockLC(*endpointA, false)
+	lc.locationInfo.readEndpoints = []url.URL{*endpointA, *endpointB}
+	lc.locationInfo.availReadLocations = []regionId{newRegionId("East US"), newRegionId("Central US")}
+	lc.locationInfo.availReadEndpointsByLocation = map[regionId]url.URL{
+		newRegionId("East US"):    *endpointA,
+		newRegionId("Central US"): *endpointB,
+	}
+
+	gem := &globalEndpointManager{
+		preferredLocations:  []string{"East US", "Central US"},
+		locationCache:       lc,
+		refreshTimeInterval: defaultExpirationTime,
+		partitionBreaker:    breaker,
+	}
+
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{PerRetry: []policy.Policy{&clientRetryPolicy{gem: gem}}}, &policy.ClientOptions{Transport: transport})
+	require.NoError(t, err)
+
+	client := &Client{endpoint: endpointA.String(), endpointUrl: endpointA, internal: internalClient, gem: gem}
+	db, err := client.NewDatabase("database_id")
+	require.NoError(t, err)
+	container, err := db.NewContainer("container_id")
+	require.NoError(t, err)
+	return container
+}
+
+func routingDecisionsOf(t *testing.T, diagnostics Diagnostics) []any {
+	var parsed map[string]any
+	require.NoError(t, json.Unmarshal([]byte(diagnostics.String()), &parsed))
+
+	var decisions []any
+	var walk func(node map[string]any)
+	walk = func(node map[string]any) {
+		if data, ok := node["data"].(map[string]any); ok {
+			if stats, ok := data[traceDatumKeyClientSideRequestStats].(map[string]any); ok {
+				if found, ok := stats["RoutingDecisions"].([]any); ok {
+					decisions = append(decisions, found...)
+				}
+			}
+		}
+		children, _ := node["children"].([]any)
+		for _, child := range children {
+			walk(child.(map[string]any))
+		}
+	}
+	walk(parsed)
+	return decisions
+}
+
+func TestPartitionFailoverRoutesPartitionToNextRegion(t *testing.T) {
+	srvA, closeA := mock.NewTLSServer()
+	defer closeA()
+	srvB, closeB := mock.NewTLSServer()
+	defer closeB()
+	endpointA, err := url.Parse(srvA.URL())
+	require.NoError(t, err)
+	endpointB, err := url.Parse(srvB.URL())
+	require.NoError(t, err)
+
+	transport := &hostRoutingTransport{routes: map[string]policy.Transporter{endpointA.Host: srvA, endpointB.Host: srvB}}
+	now := time.Now()
+	breaker := newTestPartitionCircuitBreaker(&now)
+	breaker.resolvePartitionKeyRangeID = func(containerLink string, pk PartitionKey) (string, bool) {
+		pkJSON, err := pk.toJsonString()
+		require.NoError(t, err)
+		return map[string]string{`["1"]`: "0", `["2"]`: "1"}[pkJSON], true
+	}
+	container := newPartitionRoutingTestContainer(t, transport, endpointA, endpointB, breaker)
+
+	// two reads of the partition fail in East US and are retried in Central US
+	for i := 0; i < 2; i++ {
+		srvA.AppendResponse(mock.WithStatusCode(http.StatusServiceUnavailable))
+		srvB.AppendResponse(mock.WithStatusCode(http.StatusOK))
+	}
+	_, err = container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+	require.NoError(t, err)
+	response, err := container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{endpointA.Host, endpointB.Host, endpointA.Host, endpointB.Host}, transport.seenHosts)
+	// the second failure makes East US unavailable for the partition, and the retry skips it
+	require.Equal(t, []any{map[string]any{
+		"Region":    "eastus",
+		"Reason":    routingReasonPartitionMarkedUnavailable,
+		"Partition": "dbs/database_id/colls/container_id/pkranges/0",
+	}, map[string]any{
+		"Region":    "eastus",
+		"Reason":    routingReasonPartitionUnavailable,
+		"Partition": "dbs/database_id/colls/container_id/pkranges/0",
+	}}, routingDecisionsOf(t, response.Diagnostics))
+
+	// East US is skipped for the partition, while the other partitions keep using it
+	transport.seenHosts = nil
+	srvB.AppendResponse(mock.WithStatusCode(http.StatusOK))
+	response, err = container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{map[string]any{
+		"Region":    "eastus",
+		"Reason":    routingReasonPartitionUnavailable,
+		"Partition": "dbs/database_id/colls/container_id/pkranges/0",
+	}}, routingDecisionsOf(t, response.Diagnostics))
+
+	srvA.AppendResponse(mock.WithStatusCode(http.StatusOK))
+	response, err = container.ReadItem(context.Background(), NewPartitionKeyString("2"), "doc2", nil)
+	require.NoError(t, err)
+	require.Empty(t, routingDecisionsOf(t, response.Diagnostics))
+	require.Equal(t, []string{endpointB.Host, endpointA.Host}, transport.seenHosts)
+
+	// East US is used for the partition again once it's available
+	transport.seenHosts = nil
+	now = now.Add(partitionUnavailableDuration + time.Second)
+	srvA.AppendResponse(mock.WithStatusCode(http.StatusOK))
+	_, err = container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{endpointA.Host}, transport.seenHosts)
+	require.False(t, breaker.hasUnavailableRegions(partitionKeyRangeKey{containerLink: "dbs/database_id/colls/container_id", partitionKeyRangeID: "0"}))
+}
+
+// partitionCacheTransport answers the reads of the container and of its partition key ranges in every region, and
+// fails the point reads in failingHost.
+type partitionCacheTransport struct {
+	failingHost string
+	mu          sync.Mutex
+	pointReads  []string
+}
+
+func (f *partitionCacheTransport) Do(req *http.Request) (*http.Response, error) {
+	respond := func(statusCode int, body string) (*http.Response, error) {
+		header := http.Header{}
+		header.Set(cosmosHeaderEtag, "etag1")
+		return &http.Response{
+			StatusCode: statusCode,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/"+pathSegmentPartitionKeyRange):
+		if req.Header.Get(headerIfNoneMatch) != "" {
+			return respond(http.StatusNotModified, "")
+		}
+		return respond(http.StatusOK, `{"_rid":"testRID","PartitionKeyRanges":[{"_rid":"r0","id":"0","minInclusive":"","maxExclusive":"FF","parents":[]}],"_count":1}`)
+	case strings.Contains(req.URL.Path, "/"+pathSegmentDocument+"/"):
+		f.mu.Lock()
+		f.pointReads = append(f.pointReads, req.URL.Host)
+		f.mu.Unlock()
+		if req.URL.Host == f.failingHost {
+			return respond(http.StatusServiceUnavailable, "")
+		}
+		return respond(http.StatusOK, `{"id":"doc1"}`)
+	default:
+		return respond(http.StatusOK, `{"id":"container_id","_rid":"testRID","partitionKey":{"paths":["/pk"],"kind":"Hash","version":2}}`)
+	}
+}
+
+func TestPartitionFailoverWithPointOperations(t *testing.T) {
+	endpointA, err := url.Parse("https://account-eastus.documents.azure.com:443/")
+	require.NoError(t, err)
+	endpointB, err := url.Parse("https://account-centralus.documents.azure.com:443/")
+	require.NoError(t, err)
+
+	transport := &partitionCacheTransport{failingHost: endpointA.Host}
+	now := time.Now()
+	breaker := newTestPartitionCircuitBreaker(&now)
+	container := newPartitionRoutingTestContainer(t, transport, endpointA, endpointB, breaker)
+	client := container.database.client
+	client.caches = &sharedCacheSet{containerCache: newContainerPropertiesCache(), pkRangeCache: newPartitionKeyRangeCache()}
+	breaker.resolvePartitionKeyRangeID = client.cachedPartitionKeyRangeID
+	breaker.populatePartitionKeyRanges = client.populatePartitionKeyRanges
+
+	// the partition key range of the first read isn't cached, so the read isn't tracked, but the caches are populated
+	_, err = container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok := client.cachedPartitionKeyRangeID(container.link, NewPartitionKeyString("1"))
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the next reads resolve the partition key range, and two failures make East US unavailable for it
+	for i := 0; i < 2; i++ {
+		_, err = container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+		require.NoError(t, err)
+	}
+	require.True(t, breaker.hasUnavailableRegions(partitionKeyRangeKey{containerLink: container.link, partitionKeyRangeID: "0"}))
+
+	response, err := container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{map[string]any{
+		"Region":    "eastus",
+		"Reason":    routingReasonPartitionUnavailable,
+		"Partition": "dbs/database_id/colls/container_id/pkranges/0",
+	}}, routingDecisionsOf(t, response.Diagnostics))
+	require.Equal(t, []string{endpointA.Host, endpointB.Host, endpointA.Host, endpointB.Host, endpointA.Host, endpointB.Host, endpointB.Host}, transport.pointReads)
+}
+
+func TestContainerFromLink(t *testing.T) {
+	client := &Client{}
+	container, err := client.containerFromLink("dbs/my%20db/colls/my%2Fcontainer")
+	require.NoError(t, err)
+	require.Equal(t, "my db", container.database.id)
+	require.Equal(t, "my/container", container.id)
+	require.Equal(t, "dbs/my%20db/colls/my%2Fcontainer", container.link)
+
+	_, err = client.containerFromLink("dbs/db")
+	require.Error(t, err)
+}
+
+func TestExcludedRegionsRouteToOtherRegions(t *testing.T) {
+	srvA, closeA := mock.NewTLSServer()
+	defer closeA()
+	srvB, closeB := mock.NewTLSServer()
+	defer closeB()
+	endpointA, err := url.Parse(srvA.URL())
+	require.NoError(t, err)
+	endpointB, err := url.Parse(srvB.URL())
+	require.NoError(t, err)
+
+	transport := &hostRoutingTransport{routes: map[string]policy.Transporter{endpointA.Host: srvA, endpointB.Host: srvB}}
+	container := newPartitionRoutingTestContainer(t, transport, endpointA, endpointB, newPartitionCircuitBreaker())
+
+	srvB.AppendResponse(mock.WithStatusCode(http.StatusOK))
+	response, err := container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", &ItemOptions{ExcludedRegions: []string{"East US"}})
+	require.NoError(t, err)
+	require.Equal(t, []any{map[string]any{
+		"Region": "eastus",
+		"Reason": routingReasonExcludedRegion,
+	}}, routingDecisionsOf(t, response.Diagnostics))
+
+	srvB.AppendResponse(mock.WithStatusCode(http.StatusOK), mock.WithBody([]byte(`{"Documents":[{"id":"doc1"}],"_count":1}`)))
+	pager := container.NewQueryItemsPager("SELECT * FROM c", NewPartitionKeyString("1"), &QueryOptions{ExcludedRegions: []string{"eastus"}})
+	page, err := pager.NextPage(context.Background())
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+
+	// the excluded regions are used when every region is excluded
+	srvA.AppendResponse(mock.WithStatusCode(http.StatusOK))
+	_, err = container.ReadItem(context.Background(), NewPartitionKeyString("1"), "doc1", &ItemOptions{ExcludedRegions: []string{"East US", "Central US"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{endpointB.Host, endpointB.Host, endpointA.Host}, transport.seenHosts)
+}
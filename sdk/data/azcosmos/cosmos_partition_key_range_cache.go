@@ -297,6 +297,21 @@ func awaitRefresh(ctx context.Context, op *refreshOp) (*collectionRoutingMap, er
 	}
 }
 
+// peekRoutingMap returns the cached routing map for the given container RID,
+// or nil if it isn't cached. It never starts a refresh.
+func (c *partitionKeyRangeCache) peekRoutingMap(containerRID string) *collectionRoutingMap {
+	c.mu.RLock()
+	entry, exists := c.entries[containerRID]
+	c.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return entry.routingMap
+}
+
 // invalidate clears the cached routing map, bumps the entry's generation,
 // AND cancels any in-flight refresh. The generation bump guarantees a
 // pre-invalidate result is discarded rather than installed; the cancel
@@ -0,0 +1,197 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchBuilder builds PatchOperations from the field paths of the item type T.
+// A field path is a dot-separated list of Go field names, such as "Address.City", which is converted to the JSON path
+// of the fields, such as "/address/city", using their json tags. Elements of slices and arrays are referenced by
+// index, or by "-" to append with an add operation, and entries of maps by key.
+// The first invalid field path is returned by Build.
+type PatchBuilder[T any] struct {
+	operations PatchOperations
+	err        error
+}
+
+// NewPatchBuilder creates a PatchBuilder for the item type T.
+func NewPatchBuilder[T any]() *PatchBuilder[T] {
+	return &PatchBuilder[T]{}
+}
+
+// Condition sets the condition of the patch request.
+func (b *PatchBuilder[T]) Condition(condition string) *PatchBuilder[T] {
+	b.operations.SetCondition(condition)
+	return b
+}
+
+// Add appends an add operation for the field.
+func (b *PatchBuilder[T]) Add(fieldPath string, value any) *PatchBuilder[T] {
+	if path, ok := b.resolve(fieldPath, false); ok {
+		b.operations.AppendAdd(path, value)
+	}
+	return b
+}
+
+// Replace appends a replace operation for the field.
+func (b *PatchBuilder[T]) Replace(fieldPath string, value any) *PatchBuilder[T] {
+	if path, ok := b.resolve(fieldPath, false); ok {
+		b.operations.AppendReplace(path, value)
+	}
+	return b
+}
+
+// Set appends a set operation for the field.
+func (b *PatchBuilder[T]) Set(fieldPath string, value any) *PatchBuilder[T] {
+	if path, ok := b.resolve(fieldPath, false); ok {
+		b.operations.AppendSet(path, value)
+	}
+	return b
+}
+
+// Remove appends a remove operation for the field.
+func (b *PatchBuilder[T]) Remove(fieldPath string) *PatchBuilder[T] {
+	if path, ok := b.resolve(fieldPath, false); ok {
+		b.operations.AppendRemove(path)
+	}
+	return b
+}
+
+// Increment appends an increment operation for the field, which must be numeric.
+func (b *PatchBuilder[T]) Increment(fieldPath string, value int64) *PatchBuilder[T] {
+	if path, ok := b.resolve(fieldPath, true); ok {
+		b.operations.AppendIncrement(path, value)
+	}
+	return b
+}
+
+// Build returns the operations, or the error of the first invalid field path.
+func (b *PatchBuilder[T]) Build() (PatchOperations, error) {
+	if b.err != nil {
+		return PatchOperations{}, b.err
+	}
+	return b.operations, nil
+}
+
+func (b *PatchBuilder[T]) resolve(fieldPath string, numeric bool) (string, bool) {
+	if b.err != nil {
+		return "", false
+	}
+
+	path, fieldType, err := patchPathOf(reflect.TypeFor[T](), fieldPath)
+	if err == nil && numeric && !isNumericPatchField(fieldType) {
+		err = fmt.Errorf("field path %q: %s isn't numeric", fieldPath, fieldType)
+	}
+	if err != nil {
+		b.err = err
+		return "", false
+	}
+	return path, true
+}
+
+var patchPathEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// patchPathOf converts a field path of t to a JSON path and returns the type of the field.
+func patchPathOf(t reflect.Type, fieldPath string) (string, reflect.Type, error) {
+	if fieldPath == "" {
+		return "", nil, errors.New("field path is empty")
+	}
+
+	var path strings.Builder
+	for _, name := range strings.Split(fieldPath, ".") {
+		if name == "" {
+			return "", nil, fmt.Errorf("field path %q has an empty field name", fieldPath)
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		segment := name
+		switch t.Kind() {
+		case reflect.Struct:
+			field, jsonName, ok := findPatchField(t, name)
+			if !ok {
+				return "", nil, fmt.Errorf("field path %q: %s has no field %s", fieldPath, t, name)
+			}
+			segment = jsonName
+			t = field.Type
+		case reflect.Slice, reflect.Array:
+			if name != "-" {
+				if _, err := strconv.ParseUint(name, 10, 0); err != nil {
+					return "", nil, fmt.Errorf("field path %q: %q isn't an index of %s", fieldPath, name, t)
+				}
+			}
+			t = t.Elem()
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Interface:
+			// the fields of an interface are only known at run time.
+		default:
+			return "", nil, fmt.Errorf("field path %q: %s has no field %s", fieldPath, t, name)
+		}
+
+		path.WriteString("/")
+		path.WriteString(patchPathEscaper.Replace(segment))
+	}
+	return path.String(), t, nil
+}
+
+// findPatchField finds the field of t with the Go name name, following the encoding/json rules for
+// ignored and embedded fields, and returns its JSON name.
+func findPatchField(t reflect.Type, name string) (reflect.StructField, string, bool) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && jsonName == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() || field.Name != name {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		return field, jsonName, true
+	}
+
+	// fields of embedded structs are promoted unless a field with the same name is declared.
+	for _, embeddedType := range embedded {
+		if field, jsonName, ok := findPatchField(embeddedType, name); ok {
+			return field, jsonName, true
+		}
+	}
+	return reflect.StructField{}, "", false
+}
+
+func isNumericPatchField(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Interface:
+		return true
+	}
+	return false
+}
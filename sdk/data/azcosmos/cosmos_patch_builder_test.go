@@ -0,0 +1,144 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type patchBuilderAudit struct {
+	Version int    `json:"version"`
+	Owner   string `json:"owner,omitempty"`
+}
+
+type patchBuilderAddress struct {
+	City   string
+	Street string `json:"street"`
+}
+
+type patchBuilderItem struct {
+	patchBuilderAudit
+	ID       string               `json:"id"`
+	Address  *patchBuilderAddress `json:"address"`
+	Tags     []string             `json:"tags"`
+	Scores   map[string]float64   `json:"scores"`
+	Extra    any                  `json:"extra"`
+	Ignored  string               `json:"-"`
+	Slashed  string               `json:"a/b~c"`
+	Quantity int64
+}
+
+func TestPatchBuilderPaths(t *testing.T) {
+	ops, err := NewPatchBuilder[patchBuilderItem]().
+		Condition("from c where c.version = 1").
+		Set("Address.City", "Seattle").
+		Replace("Address.Street", "Pike").
+		Add("Tags.-", "new").
+		Remove("Tags.0").
+		Set("Scores.math", 1.5).
+		Set("Extra.anything.goes", true).
+		Set("Slashed", "x").
+		Increment("Version", 1).
+		Increment("Quantity", -2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonString, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSerialization := `{"condition":"from c where c.version = 1","operations":[` +
+		`{"op":"set","path":"/address/City","value":"Seattle"},` +
+		`{"op":"replace","path":"/address/street","value":"Pike"},` +
+		`{"op":"add","path":"/tags/-","value":"new"},` +
+		`{"op":"remove","path":"/tags/0"},` +
+		`{"op":"set","path":"/scores/math","value":1.5},` +
+		`{"op":"set","path":"/extra/anything/goes","value":true},` +
+		`{"op":"set","path":"/a~1b~0c","value":"x"},` +
+		`{"op":"incr","path":"/version","value":1},` +
+		`{"op":"incr","path":"/Quantity","value":-2}]}`
+
+	if string(jsonString) != expectedSerialization {
+		t.Fatalf("Expected serialization %v, but got %v", expectedSerialization, string(jsonString))
+	}
+}
+
+func TestPatchBuilderInvalidPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem]
+		message string
+	}{
+		{
+			name:    "unknown field",
+			build:   func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] { return b.Set("Missing", 1) },
+			message: "has no field Missing",
+		},
+		{
+			name:    "ignored field",
+			build:   func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] { return b.Set("Ignored", 1) },
+			message: "has no field Ignored",
+		},
+		{
+			name: "JSON name",
+			build: func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] {
+				return b.Set("address.City", 1)
+			},
+			message: "has no field address",
+		},
+		{
+			name:    "field of a string",
+			build:   func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] { return b.Set("ID.Length", 1) },
+			message: "has no field Length",
+		},
+		{
+			name:    "invalid index",
+			build:   func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] { return b.Remove("Tags.first") },
+			message: `"first" isn't an index`,
+		},
+		{
+			name: "empty field name",
+			build: func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] {
+				return b.Remove("Address..City")
+			},
+			message: "has an empty field name",
+		},
+		{
+			name:    "empty path",
+			build:   func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] { return b.Remove("") },
+			message: "field path is empty",
+		},
+		{
+			name: "increment of a string",
+			build: func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] {
+				return b.Increment("Address.City", 1)
+			},
+			message: "isn't numeric",
+		},
+		{
+			name: "first error is kept",
+			build: func(b *PatchBuilder[patchBuilderItem]) *PatchBuilder[patchBuilderItem] {
+				return b.Set("ID", "id").Set("First", 1).Set("Second", 2)
+			},
+			message: "has no field First",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.build(NewPatchBuilder[patchBuilderItem]()).Build()
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("Expected error to contain %q, but got %q", tt.message, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos/queryengine"
+	"github.com/stretchr/testify/require"
+)
+
+// splittingGateway is a fake gateway for a container whose partition key range "0" is split into "1" and "2"
+// when it's first queried.
+type splittingGateway struct {
+	mu       sync.Mutex
+	split    bool
+	queried  []string
+	pkRanges int
+}
+
+func (g *splittingGateway) Do(req *http.Request) (*http.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	respond := func(status int, body string, header http.Header) (*http.Response, error) {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+
+	switch {
+	case req.Header.Get(cosmosHeaderIsQueryPlanRequest) == "True":
+		return respond(http.StatusOK, `{"queryInfo":{"orderBy":["Ascending"],"rewrittenQuery":"SELECT c._rid, [{\"item\": c.v}] AS orderByItems, c AS payload FROM c ORDER BY c.v"}}`, nil)
+	case strings.HasSuffix(req.URL.Path, "/pkranges"):
+		g.pkRanges++
+		if g.split {
+			return respond(http.StatusOK, `{"PartitionKeyRanges":[{"id":"1","minInclusive":"","maxExclusive":"80"},{"id":"2","minInclusive":"80","maxExclusive":"FF"}]}`, nil)
+		}
+		return respond(http.StatusOK, `{"PartitionKeyRanges":[{"id":"0","minInclusive":"","maxExclusive":"FF"}]}`, nil)
+	}
+
+	pkRangeID := req.Header.Get(cosmosHeaderPartitionKeyRangeId)
+	g.queried = append(g.queried, pkRangeID)
+
+	switch pkRangeID {
+	case "0":
+		g.split = true
+		header := http.Header{}
+		header.Set(cosmosHeaderSubstatus, subStatusPartitionKeyRangeGone)
+		return respond(http.StatusGone, `{"message":"Gone"}`, header)
+	case "1":
+		return respond(http.StatusOK, `{"Documents":[{"_rid":"a","orderByItems":[{"item":1}],"payload":{"v":1}},{"_rid":"c","orderByItems":[{"item":3}],"payload":{"v":3}}]}`, nil)
+	default:
+		return respond(http.StatusOK, `{"Documents":[{"_rid":"b","orderByItems":[{"item":2}],"payload":{"v":2}}]}`, nil)
+	}
+}
+
+func TestQueryEngine_PartitionSplit(t *testing.T) {
+	gateway := &splittingGateway{}
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{}, &policy.ClientOptions{Transport: gateway})
+	require.NoError(t, err)
+
+	client := &Client{endpoint: "https://localhost", internal: internalClient, gem: &globalEndpointManager{preferredLocations: []string{}}}
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer("containerId", database)
+
+	pager := container.NewQueryItemsPager("SELECT * FROM c ORDER BY c.v", NewPartitionKey(), &QueryOptions{QueryEngine: queryengine.NewQueryEngine()})
+
+	var items []string
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		require.NoError(t, err)
+		for _, item := range page.Items {
+			items = append(items, string(item))
+		}
+	}
+
+	require.Equal(t, []string{`{"v":1}`, `{"v":2}`, `{"v":3}`}, items)
+	require.Equal(t, "0", gateway.queried[0])
+	require.ElementsMatch(t, []string{"1", "2"}, gateway.queried[1:])
+	require.Equal(t, 2, gateway.pkRanges, "the partition key ranges are read again after the split")
+}
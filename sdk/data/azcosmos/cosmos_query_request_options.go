@@ -48,6 +48,7 @@ type QueryOptions struct {
 	EnableCrossPartitionQuery *bool
 	// QueryEngine can be set to enable the use of an external query engine for processing cross-partition queries.
 	// This is a preview feature, which is NOT SUPPORTED in production, and is subject to breaking changes.
+	// queryengine.NewQueryEngine returns an engine implemented in Go, which doesn't require cgo.
 	QueryEngine queryengine.QueryEngine
 	// PriorityLevel overrides the client-level default priority for this operation.
 	// Valid values are PriorityLevelHigh and PriorityLevelLow.
@@ -56,6 +57,13 @@ type QueryOptions struct {
 	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
 	// The valid range is 1 to 5 (inclusive).
 	ThroughputBucket *int32
+	// ThroughputControlGroupName selects the throughput control group of the operation, instead of the default group of the container.
+	// See ClientOptions.ThroughputControlGroups.
+	ThroughputControlGroupName *string
+	// ExcludedRegions lists the regions that the operation isn't routed to, such as "West US".
+	// The operation uses the other regions of the account, or the excluded regions if it can't use another region,
+	// such as for writes on accounts with a single write region.
+	ExcludedRegions []string
 }
 
 func (options *QueryOptions) toHeaders() *map[string]string {
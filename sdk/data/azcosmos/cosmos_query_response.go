@@ -144,3 +144,102 @@ type ReadManyItemsResponse struct {
 	// List of items.
 	Items [][]byte
 }
+
+// QueryStoredProceduresResponse contains response from the stored procedure query operation.
+type QueryStoredProceduresResponse struct {
+	Response
+	// ContinuationToken contains the value of the x-ms-continuation header in the response.
+	// It can be used to stop a query and resume it later.
+	ContinuationToken *string
+	// List of stored procedures.
+	StoredProcedures []StoredProcedureProperties
+}
+
+func newStoredProceduresQueryResponse(resp *http.Response) (QueryStoredProceduresResponse, error) {
+	response := QueryStoredProceduresResponse{
+		Response: newResponse(resp),
+	}
+
+	continuationToken := resp.Header.Get(cosmosHeaderContinuationToken)
+	if continuationToken != "" {
+		response.ContinuationToken = &continuationToken
+	}
+	result := queryStoredProceduresServiceResponse{}
+	if err := runtime.UnmarshalAsJSON(resp, &result); err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+
+	response.StoredProcedures = result.StoredProcedures
+
+	return response, nil
+}
+
+type queryStoredProceduresServiceResponse struct {
+	StoredProcedures []StoredProcedureProperties `json:"StoredProcedures,omitempty"`
+}
+
+// QueryTriggersResponse contains response from the trigger query operation.
+type QueryTriggersResponse struct {
+	Response
+	// ContinuationToken contains the value of the x-ms-continuation header in the response.
+	// It can be used to stop a query and resume it later.
+	ContinuationToken *string
+	// List of triggers.
+	Triggers []TriggerProperties
+}
+
+func newTriggersQueryResponse(resp *http.Response) (QueryTriggersResponse, error) {
+	response := QueryTriggersResponse{
+		Response: newResponse(resp),
+	}
+
+	continuationToken := resp.Header.Get(cosmosHeaderContinuationToken)
+	if continuationToken != "" {
+		response.ContinuationToken = &continuationToken
+	}
+	result := queryTriggersServiceResponse{}
+	if err := runtime.UnmarshalAsJSON(resp, &result); err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+
+	response.Triggers = result.Triggers
+
+	return response, nil
+}
+
+type queryTriggersServiceResponse struct {
+	Triggers []TriggerProperties `json:"Triggers,omitempty"`
+}
+
+// QueryUserDefinedFunctionsResponse contains response from the user defined function query operation.
+type QueryUserDefinedFunctionsResponse struct {
+	Response
+	// ContinuationToken contains the value of the x-ms-continuation header in the response.
+	// It can be used to stop a query and resume it later.
+	ContinuationToken *string
+	// List of user defined functions.
+	UserDefinedFunctions []UserDefinedFunctionProperties
+}
+
+func newUserDefinedFunctionsQueryResponse(resp *http.Response) (QueryUserDefinedFunctionsResponse, error) {
+	response := QueryUserDefinedFunctionsResponse{
+		Response: newResponse(resp),
+	}
+
+	continuationToken := resp.Header.Get(cosmosHeaderContinuationToken)
+	if continuationToken != "" {
+		response.ContinuationToken = &continuationToken
+	}
+	result := queryUserDefinedFunctionsServiceResponse{}
+	if err := runtime.UnmarshalAsJSON(resp, &result); err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+
+	response.UserDefinedFunctions = result.UserDefinedFunctions
+
+	return response, nil
+}
+
+type queryUserDefinedFunctionsServiceResponse struct {
+	UserDefinedFunctions []UserDefinedFunctionProperties `json:"UserDefinedFunctions,omitempty"`
+}
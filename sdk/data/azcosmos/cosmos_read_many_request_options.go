@@ -32,6 +32,9 @@ type ReadManyItemsOptions struct {
 	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
 	// The valid range is 1 to 5 (inclusive).
 	ThroughputBucket *int32
+	// ThroughputControlGroupName selects the throughput control group of the operation, instead of the default group of the container.
+	// See ClientOptions.ThroughputControlGroups.
+	ThroughputControlGroupName *string
 }
 
 func (options *ReadManyItemsOptions) toHeaders() *map[string]string {
@@ -0,0 +1,185 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// StoredProcedureProperties represents the properties of a stored procedure.
+type StoredProcedureProperties struct {
+	// ID contains the unique id of the stored procedure.
+	ID string
+	// Body contains the JavaScript function of the stored procedure.
+	Body string
+	// ETag contains the entity etag of the stored procedure.
+	ETag *azcore.ETag
+	// SelfLink contains the self-link of the stored procedure.
+	SelfLink string
+	// ResourceID contains the resource id of the stored procedure.
+	ResourceID string
+	// LastModified contains the last modified time of the stored procedure.
+	LastModified time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (sp StoredProcedureProperties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+		scriptSystemProperties
+	}{
+		ID:                     sp.ID,
+		Body:                   sp.Body,
+		scriptSystemProperties: newScriptSystemProperties(sp.ETag, sp.SelfLink, sp.ResourceID, sp.LastModified),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (sp *StoredProcedureProperties) UnmarshalJSON(b []byte) error {
+	aux := struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+		scriptSystemProperties
+	}{}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	sp.ID = aux.ID
+	sp.Body = aux.Body
+	sp.ETag, sp.SelfLink, sp.ResourceID, sp.LastModified = aux.values()
+	return nil
+}
+
+// TriggerProperties represents the properties of a trigger.
+type TriggerProperties struct {
+	// ID contains the unique id of the trigger.
+	ID string
+	// Body contains the JavaScript function of the trigger.
+	Body string
+	// TriggerType defines whether the trigger runs before or after the operation.
+	TriggerType TriggerType
+	// TriggerOperation defines the operations the trigger runs on.
+	TriggerOperation TriggerOperation
+	// ETag contains the entity etag of the trigger.
+	ETag *azcore.ETag
+	// SelfLink contains the self-link of the trigger.
+	SelfLink string
+	// ResourceID contains the resource id of the trigger.
+	ResourceID string
+	// LastModified contains the last modified time of the trigger.
+	LastModified time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (tp TriggerProperties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID               string           `json:"id"`
+		Body             string           `json:"body"`
+		TriggerType      TriggerType      `json:"triggerType"`
+		TriggerOperation TriggerOperation `json:"triggerOperation"`
+		scriptSystemProperties
+	}{
+		ID:                     tp.ID,
+		Body:                   tp.Body,
+		TriggerType:            tp.TriggerType,
+		TriggerOperation:       tp.TriggerOperation,
+		scriptSystemProperties: newScriptSystemProperties(tp.ETag, tp.SelfLink, tp.ResourceID, tp.LastModified),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (tp *TriggerProperties) UnmarshalJSON(b []byte) error {
+	aux := struct {
+		ID               string           `json:"id"`
+		Body             string           `json:"body"`
+		TriggerType      TriggerType      `json:"triggerType"`
+		TriggerOperation TriggerOperation `json:"triggerOperation"`
+		scriptSystemProperties
+	}{}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	tp.ID = aux.ID
+	tp.Body = aux.Body
+	tp.TriggerType = aux.TriggerType
+	tp.TriggerOperation = aux.TriggerOperation
+	tp.ETag, tp.SelfLink, tp.ResourceID, tp.LastModified = aux.values()
+	return nil
+}
+
+// UserDefinedFunctionProperties represents the properties of a user defined function.
+type UserDefinedFunctionProperties struct {
+	// ID contains the unique id of the user defined function. Queries call the function as udf.<ID>.
+	ID string
+	// Body contains the JavaScript function of the user defined function.
+	Body string
+	// ETag contains the entity etag of the user defined function.
+	ETag *azcore.ETag
+	// SelfLink contains the self-link of the user defined function.
+	SelfLink string
+	// ResourceID contains the resource id of the user defined function.
+	ResourceID string
+	// LastModified contains the last modified time of the user defined function.
+	LastModified time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (up UserDefinedFunctionProperties) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+		scriptSystemProperties
+	}{
+		ID:                     up.ID,
+		Body:                   up.Body,
+		scriptSystemProperties: newScriptSystemProperties(up.ETag, up.SelfLink, up.ResourceID, up.LastModified),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (up *UserDefinedFunctionProperties) UnmarshalJSON(b []byte) error {
+	aux := struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+		scriptSystemProperties
+	}{}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	up.ID = aux.ID
+	up.Body = aux.Body
+	up.ETag, up.SelfLink, up.ResourceID, up.LastModified = aux.values()
+	return nil
+}
+
+// scriptSystemProperties are the system properties of stored procedures, triggers and user defined functions.
+type scriptSystemProperties struct {
+	ETag       *azcore.ETag `json:"_etag,omitempty"`
+	SelfLink   string       `json:"_self,omitempty"`
+	ResourceID string       `json:"_rid,omitempty"`
+	Timestamp  int64        `json:"_ts,omitempty"`
+}
+
+func newScriptSystemProperties(etag *azcore.ETag, selfLink string, resourceID string, lastModified time.Time) scriptSystemProperties {
+	p := scriptSystemProperties{ETag: etag, SelfLink: selfLink, ResourceID: resourceID}
+	if !lastModified.IsZero() {
+		p.Timestamp = lastModified.Unix()
+	}
+	return p
+}
+
+func (p scriptSystemProperties) values() (*azcore.ETag, string, string, time.Time) {
+	var lastModified time.Time
+	if p.Timestamp != 0 {
+		lastModified = time.Unix(p.Timestamp, 0)
+	}
+	return p.ETag, p.SelfLink, p.ResourceID, lastModified
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func TestTriggerPropertiesSerialization(t *testing.T) {
+	nowAsUnix := time.Unix(time.Now().Unix(), 0)
+
+	etag := azcore.ETag("someETag")
+	properties := TriggerProperties{
+		ID:               "someId",
+		Body:             "function () {}",
+		TriggerType:      TriggerTypePost,
+		TriggerOperation: TriggerOperationReplace,
+		ETag:             &etag,
+		SelfLink:         "someSelfLink",
+		ResourceID:       "someResourceId",
+		LastModified:     nowAsUnix,
+	}
+
+	jsonString, err := json.Marshal(properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherProperties := &TriggerProperties{}
+	err = json.Unmarshal(jsonString, otherProperties)
+	if err != nil {
+		t.Fatal(err, string(jsonString))
+	}
+
+	if properties.ID != otherProperties.ID {
+		t.Errorf("Expected otherProperties.ID to be %s, but got %s", properties.ID, otherProperties.ID)
+	}
+
+	if properties.Body != otherProperties.Body {
+		t.Errorf("Expected otherProperties.Body to be %s, but got %s", properties.Body, otherProperties.Body)
+	}
+
+	if properties.TriggerType != otherProperties.TriggerType {
+		t.Errorf("Expected otherProperties.TriggerType to be %s, but got %s", properties.TriggerType, otherProperties.TriggerType)
+	}
+
+	if properties.TriggerOperation != otherProperties.TriggerOperation {
+		t.Errorf("Expected otherProperties.TriggerOperation to be %s, but got %s", properties.TriggerOperation, otherProperties.TriggerOperation)
+	}
+
+	if *properties.ETag != *otherProperties.ETag {
+		t.Errorf("Expected otherProperties.ETag to be %s, but got %s", *properties.ETag, *otherProperties.ETag)
+	}
+
+	if properties.SelfLink != otherProperties.SelfLink {
+		t.Errorf("Expected otherProperties.SelfLink to be %s, but got %s", properties.SelfLink, otherProperties.SelfLink)
+	}
+
+	if properties.ResourceID != otherProperties.ResourceID {
+		t.Errorf("Expected otherProperties.ResourceID to be %s, but got %s", properties.ResourceID, otherProperties.ResourceID)
+	}
+
+	if properties.LastModified != otherProperties.LastModified {
+		t.Errorf("Expected otherProperties.LastModified to be %v, but got %v", properties.LastModified, otherProperties.LastModified)
+	}
+}
+
+func TestStoredProcedurePropertiesSerializationOmitsEmptySystemProperties(t *testing.T) {
+	jsonString, err := json.Marshal(StoredProcedureProperties{ID: "someId", Body: "function () {}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(jsonString) != `{"id":"someId","body":"function () {}"}` {
+		t.Errorf("Unexpected serialization %s", string(jsonString))
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// ScriptOptions includes options for operations on stored procedures, triggers and user defined functions.
+type ScriptOptions struct {
+	// IfMatchEtag is used to ensure optimistic concurrency control.
+	// https://docs.microsoft.com/azure/cosmos-db/sql/database-transactions-optimistic-concurrency#optimistic-concurrency-control
+	IfMatchEtag *azcore.ETag
+	// IfNoneMatchEtag is used to read the script only if it changed.
+	IfNoneMatchEtag *azcore.ETag
+}
+
+func (options *ScriptOptions) toHeaders() *map[string]string {
+	if options.IfMatchEtag == nil && options.IfNoneMatchEtag == nil {
+		return nil
+	}
+
+	headers := make(map[string]string)
+	if options.IfMatchEtag != nil {
+		headers[headerIfMatch] = string(*options.IfMatchEtag)
+	}
+	if options.IfNoneMatchEtag != nil {
+		headers[headerIfNoneMatch] = string(*options.IfNoneMatchEtag)
+	}
+	return &headers
+}
+
+// ExecuteStoredProcedureOptions includes options for executing a stored procedure.
+type ExecuteStoredProcedureOptions struct {
+	// EnableScriptLogging makes the output of console.log in the stored procedure available in
+	// ExecuteStoredProcedureResponse.ScriptLogs.
+	EnableScriptLogging bool
+	// SessionToken to be used when using Session consistency on the account.
+	SessionToken *string
+	// PriorityLevel overrides the client-level default priority for this operation.
+	// Valid values are PriorityLevelHigh and PriorityLevelLow.
+	PriorityLevel *PriorityLevel
+	// ThroughputBucket overrides the client-level default throughput bucket for this operation.
+	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
+	// The valid range is 1 to 5 (inclusive).
+	ThroughputBucket *int32
+}
+
+func (options *ExecuteStoredProcedureOptions) toHeaders() *map[string]string {
+	headers := make(map[string]string)
+
+	if options.EnableScriptLogging {
+		headers[cosmosHeaderScriptEnableLogging] = "true"
+	}
+
+	if options.SessionToken != nil {
+		headers[cosmosHeaderSessionToken] = *options.SessionToken
+	}
+
+	return &headers
+}
+
+// QueryScriptsOptions are options to query stored procedures, triggers and user defined functions.
+type QueryScriptsOptions struct {
+	// ContinuationToken to be used to continue a previous query execution.
+	// Obtained from the ContinuationToken of the previous page.
+	ContinuationToken *string
+
+	// QueryParameters allows execution of parametrized queries.
+	// See https://docs.microsoft.com/azure/cosmos-db/sql/sql-query-parameterized-queries
+	QueryParameters []QueryParameter
+}
+
+func (options *QueryScriptsOptions) toHeaders() *map[string]string {
+	headers := make(map[string]string)
+
+	if options.ContinuationToken != nil {
+		headers[cosmosHeaderContinuationToken] = *options.ContinuationToken
+	}
+
+	return &headers
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"net/http"
+	"net/url"
+
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// StoredProcedureResponse represents the response from a stored procedure request.
+type StoredProcedureResponse struct {
+	// StoredProcedureProperties contains the unmarshalled response body in StoredProcedureProperties format.
+	StoredProcedureProperties *StoredProcedureProperties
+	Response
+}
+
+func newStoredProcedureResponse(resp *http.Response) (StoredProcedureResponse, error) {
+	response := StoredProcedureResponse{
+		Response: newResponse(resp),
+	}
+	properties := &StoredProcedureProperties{}
+	err := azruntime.UnmarshalAsJSON(resp, properties)
+	if err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+	response.StoredProcedureProperties = properties
+	return response, nil
+}
+
+// TriggerResponse represents the response from a trigger request.
+type TriggerResponse struct {
+	// TriggerProperties contains the unmarshalled response body in TriggerProperties format.
+	TriggerProperties *TriggerProperties
+	Response
+}
+
+func newTriggerResponse(resp *http.Response) (TriggerResponse, error) {
+	response := TriggerResponse{
+		Response: newResponse(resp),
+	}
+	properties := &TriggerProperties{}
+	err := azruntime.UnmarshalAsJSON(resp, properties)
+	if err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+	response.TriggerProperties = properties
+	return response, nil
+}
+
+// UserDefinedFunctionResponse represents the response from a user defined function request.
+type UserDefinedFunctionResponse struct {
+	// UserDefinedFunctionProperties contains the unmarshalled response body in UserDefinedFunctionProperties format.
+	UserDefinedFunctionProperties *UserDefinedFunctionProperties
+	Response
+}
+
+func newUserDefinedFunctionResponse(resp *http.Response) (UserDefinedFunctionResponse, error) {
+	response := UserDefinedFunctionResponse{
+		Response: newResponse(resp),
+	}
+	properties := &UserDefinedFunctionProperties{}
+	err := azruntime.UnmarshalAsJSON(resp, properties)
+	if err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+	response.UserDefinedFunctionProperties = properties
+	return response, nil
+}
+
+// ExecuteStoredProcedureResponse represents the response from executing a stored procedure.
+type ExecuteStoredProcedureResponse struct {
+	// Value contains the JSON value the stored procedure set with getContext().getResponse().setBody().
+	Value []byte
+	// ScriptLogs contains the output of console.log in the stored procedure,
+	// when ExecuteStoredProcedureOptions.EnableScriptLogging is true.
+	ScriptLogs string
+	// SessionToken contains the value from the session token header to be used on session consistency.
+	SessionToken *string
+	Response
+}
+
+func newExecuteStoredProcedureResponse(resp *http.Response) (ExecuteStoredProcedureResponse, error) {
+	response := ExecuteStoredProcedureResponse{
+		Response: newResponse(resp),
+	}
+
+	if sessionToken := resp.Header.Get(cosmosHeaderSessionToken); sessionToken != "" {
+		response.SessionToken = &sessionToken
+	}
+
+	if logs := resp.Header.Get(cosmosHeaderScriptLogResults); logs != "" {
+		// the logs are URL encoded.
+		if decoded, err := url.QueryUnescape(logs); err == nil {
+			logs = decoded
+		}
+		response.ScriptLogs = logs
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	body, err := azruntime.Payload(resp)
+	if err != nil {
+		return response, wrapResponseError(err, response.Response)
+	}
+	response.Value = body
+	return response, nil
+}
@@ -0,0 +1,467 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+)
+
+// ErrThroughputControlBudgetExceeded is returned for the operations of a throughput control group
+// with RejectWhenOverBudget set, when the group has consumed its budget.
+var ErrThroughputControlBudgetExceeded = errors.New("the throughput control group has consumed its budget")
+
+const (
+	defaultThroughputControlRenewInterval = 10 * time.Second
+	// throughputControlRefreshInterval is how often the provisioned throughput of a container is read again
+	// for groups with a TargetThroughputThreshold.
+	throughputControlRefreshInterval = 5 * time.Minute
+)
+
+// ThroughputControlGroup limits the throughput that operations on items of a container consume.
+// The request charge of each response is deducted from a budget that is refilled at the target throughput,
+// and the operations of the group are delayed, or rejected, while the budget is consumed. The budget is
+// deducted when requests complete, so concurrent requests can briefly exceed it.
+type ThroughputControlGroup struct {
+	// Name identifies the group in the operation options. It must be unique for the container.
+	Name string
+	// DatabaseID is the id of the database of the container.
+	DatabaseID string
+	// ContainerID is the id of the container whose operations the group controls.
+	ContainerID string
+	// TargetThroughput is the throughput, in RU/s, that the operations of the group can consume.
+	TargetThroughput *int32
+	// TargetThroughputThreshold is the fraction of the provisioned throughput of the container, greater than 0 and at most 1,
+	// that the operations of the group can consume. If TargetThroughput is also set, the lower target is used.
+	TargetThroughputThreshold *float64
+	// IsDefault makes the group control the operations on the container that don't set ThroughputControlGroupName.
+	// At most one group of a container can be the default.
+	IsDefault bool
+	// RejectWhenOverBudget fails operations with ErrThroughputControlBudgetExceeded while the group has consumed its budget,
+	// instead of delaying them.
+	RejectWhenOverBudget bool
+	// GlobalControl shares the target throughput between the clients using the group, instead of applying it to each client.
+	GlobalControl *ThroughputControlGlobalOptions
+}
+
+// ThroughputControlGlobalOptions defines how the clients using a throughput control group coordinate.
+// Each client stores a document in the control container, and the target throughput is divided
+// equally between the clients whose documents haven't expired.
+type ThroughputControlGlobalOptions struct {
+	// ControlContainer stores the documents of the clients. It must be partitioned by /groupId, and should
+	// have time to live enabled so that the documents of stopped clients are deleted.
+	ControlContainer *ContainerClient
+	// RenewInterval is how often a client renews its document and counts the clients of the group.
+	// The default is 10 seconds.
+	RenewInterval time.Duration
+	// ExpireInterval is how long the document of a client is kept without being renewed. It must be greater than RenewInterval.
+	// The default is three times RenewInterval.
+	ExpireInterval time.Duration
+}
+
+// throughputController applies the throughput control groups of a client.
+type throughputController struct {
+	// groups are the groups by container link and name.
+	groups map[string]*throughputControlGroupState
+	// defaults are the default groups by container link.
+	defaults map[string]*throughputControlGroupState
+	// client reads the provisioned throughput of the containers. It's set once the client is created.
+	client *Client
+
+	now  func() time.Time
+	wait func(ctx context.Context, d time.Duration) error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// throughputControlGroupState is the budget of a throughput control group.
+type throughputControlGroupState struct {
+	controller    *throughputController
+	group         ThroughputControlGroup
+	containerLink string
+	globalOnce    sync.Once
+
+	// resolveMu serializes the reads of the provisioned throughput.
+	resolveMu sync.Mutex
+
+	mu sync.Mutex
+	// provisioned is the provisioned throughput of the container, or 0 if it hasn't been read.
+	provisioned float64
+	resolvedAt  time.Time
+	// instances is the number of clients sharing the target throughput.
+	instances int
+	// available is the budget, in RU. It's negative when the group is over budget.
+	available   float64
+	refilledAt  time.Time
+	initialized bool
+}
+
+func newThroughputController(o *ClientOptions) (*throughputController, error) {
+	if o == nil || len(o.ThroughputControlGroups) == 0 {
+		return nil, nil
+	}
+
+	tc := &throughputController{
+		groups:   map[string]*throughputControlGroupState{},
+		defaults: map[string]*throughputControlGroupState{},
+		now:      time.Now,
+		wait:     waitThroughputControl,
+		stop:     make(chan struct{}),
+	}
+	for _, group := range o.ThroughputControlGroups {
+		if err := validateThroughputControlGroup(&group); err != nil {
+			return nil, err
+		}
+
+		containerLink := createLink(createLink("", pathSegmentDatabase, group.DatabaseID), pathSegmentCollection, group.ContainerID)
+		key := containerLink + "/" + group.Name
+		if _, ok := tc.groups[key]; ok {
+			return nil, fmt.Errorf("throughput control group %q is defined twice for container %s", group.Name, group.ContainerID)
+		}
+		state := &throughputControlGroupState{controller: tc, group: group, containerLink: containerLink, instances: 1}
+		tc.groups[key] = state
+
+		if group.IsDefault {
+			if existing, ok := tc.defaults[containerLink]; ok {
+				return nil, fmt.Errorf("throughput control groups %q and %q are both the default of container %s", existing.group.Name, group.Name, group.ContainerID)
+			}
+			tc.defaults[containerLink] = state
+		}
+	}
+	return tc, nil
+}
+
+func validateThroughputControlGroup(group *ThroughputControlGroup) error {
+	if group.Name == "" {
+		return errors.New("throughput control group name is required")
+	}
+	if group.DatabaseID == "" || group.ContainerID == "" {
+		return fmt.Errorf("throughput control group %q requires a DatabaseID and a ContainerID", group.Name)
+	}
+	if group.TargetThroughput == nil && group.TargetThroughputThreshold == nil {
+		return fmt.Errorf("throughput control group %q requires a TargetThroughput or a TargetThroughputThreshold", group.Name)
+	}
+	if group.TargetThroughput != nil && *group.TargetThroughput <= 0 {
+		return fmt.Errorf("throughput control group %q: TargetThroughput must be greater than 0", group.Name)
+	}
+	if group.TargetThroughputThreshold != nil && (*group.TargetThroughputThreshold <= 0 || *group.TargetThroughputThreshold > 1) {
+		return fmt.Errorf("throughput control group %q: TargetThroughputThreshold must be greater than 0 and at most 1", group.Name)
+	}
+
+	if group.GlobalControl != nil {
+		globalControl := *group.GlobalControl
+		if globalControl.ControlContainer == nil {
+			return fmt.Errorf("throughput control group %q: GlobalControl requires a ControlContainer", group.Name)
+		}
+		if globalControl.RenewInterval <= 0 {
+			globalControl.RenewInterval = defaultThroughputControlRenewInterval
+		}
+		if globalControl.ExpireInterval <= 0 {
+			globalControl.ExpireInterval = 3 * globalControl.RenewInterval
+		}
+		if globalControl.ExpireInterval <= globalControl.RenewInterval {
+			return fmt.Errorf("throughput control group %q: GlobalControl.ExpireInterval must be greater than RenewInterval", group.Name)
+		}
+		group.GlobalControl = &globalControl
+	}
+	return nil
+}
+
+// groupFor returns the group of an operation on the resource at resourceAddress, or nil if no group controls it.
+func (tc *throughputController) groupFor(resourceAddress string, name *string) (*throughputControlGroupState, error) {
+	segments := strings.SplitN(resourceAddress, "/", 5)
+	if len(segments) < 4 || segments[0] != pathSegmentDatabase || segments[2] != pathSegmentCollection {
+		return nil, nil
+	}
+	containerLink := strings.Join(segments[:4], "/")
+
+	if name == nil {
+		return tc.defaults[containerLink], nil
+	}
+	state, ok := tc.groups[containerLink+"/"+*name]
+	if !ok {
+		return nil, fmt.Errorf("throughput control group %q isn't defined for container %s", *name, segments[3])
+	}
+	return state, nil
+}
+
+func (tc *throughputController) close() {
+	tc.stopOnce.Do(func() {
+		close(tc.stop)
+	})
+	tc.wg.Wait()
+}
+
+func waitThroughputControl(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire waits until the group has budget, or returns ErrThroughputControlBudgetExceeded if it rejects operations over budget.
+func (s *throughputControlGroupState) acquire(ctx context.Context) error {
+	if s.group.GlobalControl != nil {
+		s.globalOnce.Do(s.startGlobalControl)
+	}
+	if err := s.resolve(ctx); err != nil {
+		return err
+	}
+
+	for {
+		s.mu.Lock()
+		limit := s.refillLocked()
+		deficit := -s.available
+		s.mu.Unlock()
+
+		if deficit < 0 {
+			return nil
+		}
+		if s.group.RejectWhenOverBudget {
+			return fmt.Errorf("%w: group %q", ErrThroughputControlBudgetExceeded, s.group.Name)
+		}
+		wait := time.Duration(math.Ceil(deficit / limit * float64(time.Second)))
+		if err := s.controller.wait(ctx, max(wait, time.Millisecond)); err != nil {
+			return err
+		}
+	}
+}
+
+// charge deducts the request charge of a response from the budget.
+func (s *throughputControlGroupState) charge(requestCharge float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refillLocked()
+	s.available -= float64(requestCharge)
+}
+
+// refillLocked refills the budget for the time elapsed since the last refill, up to one second of throughput, and returns the throughput.
+func (s *throughputControlGroupState) refillLocked() float64 {
+	limit := s.limitLocked()
+	now := s.controller.now()
+	if !s.initialized {
+		s.available = limit
+		s.initialized = true
+	} else {
+		s.available = math.Min(s.available+now.Sub(s.refilledAt).Seconds()*limit, limit)
+	}
+	s.refilledAt = now
+	return limit
+}
+
+// limitLocked returns the throughput of this client, in RU/s.
+func (s *throughputControlGroupState) limitLocked() float64 {
+	limit := math.Inf(1)
+	if s.group.TargetThroughput != nil {
+		limit = float64(*s.group.TargetThroughput)
+	}
+	if s.group.TargetThroughputThreshold != nil && s.provisioned > 0 {
+		limit = math.Min(limit, *s.group.TargetThroughputThreshold*s.provisioned)
+	}
+	return limit / float64(max(s.instances, 1))
+}
+
+// resolve reads the provisioned throughput of the container when the group has a TargetThroughputThreshold
+// and it hasn't been read recently. A stale value is kept if it can't be read again.
+func (s *throughputControlGroupState) resolve(ctx context.Context) error {
+	if s.group.TargetThroughputThreshold == nil {
+		return nil
+	}
+
+	s.resolveMu.Lock()
+	defer s.resolveMu.Unlock()
+
+	s.mu.Lock()
+	resolved := s.provisioned > 0
+	stale := s.controller.now().Sub(s.resolvedAt) >= throughputControlRefreshInterval
+	s.mu.Unlock()
+	if resolved && !stale {
+		return nil
+	}
+
+	provisioned, err := s.readProvisionedThroughput(ctx)
+	if err != nil {
+		if resolved {
+			log.Writef(EventThroughputControl, "failed to refresh the provisioned throughput of throughput control group %s: %v", s.group.Name, err)
+			return nil
+		}
+		return fmt.Errorf("throughput control group %q: reading the provisioned throughput: %w", s.group.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.provisioned = float64(provisioned)
+	s.resolvedAt = s.controller.now()
+	return nil
+}
+
+// readProvisionedThroughput reads the throughput of the container, or of its database if the container shares the database throughput.
+func (s *throughputControlGroupState) readProvisionedThroughput(ctx context.Context) (int32, error) {
+	if s.controller.client == nil {
+		return 0, errors.New("the client isn't initialized")
+	}
+	database, err := s.controller.client.NewDatabase(s.group.DatabaseID)
+	if err != nil {
+		return 0, err
+	}
+	container, err := database.NewContainer(s.group.ContainerID)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := container.ReadThroughput(ctx, nil)
+	if err != nil {
+		var databaseErr error
+		response, databaseErr = database.ReadThroughput(ctx, nil)
+		if databaseErr != nil {
+			return 0, errors.Join(err, databaseErr)
+		}
+	}
+
+	if response.ThroughputProperties != nil {
+		if throughput, ok := response.ThroughputProperties.ManualThroughput(); ok {
+			return throughput, nil
+		}
+		if throughput, ok := response.ThroughputProperties.AutoscaleMaxThroughput(); ok {
+			return throughput, nil
+		}
+	}
+	return 0, errors.New("the offer has no throughput")
+}
+
+// throughputControlInstance is the document of a client in the control container.
+type throughputControlInstance struct {
+	ID        string `json:"id"`
+	GroupID   string `json:"groupId"`
+	TTL       int64  `json:"ttl"`
+	Timestamp int64  `json:"_ts,omitempty"`
+}
+
+// startGlobalControl renews the document of this client and counts the clients of the group until the client is closed.
+func (s *throughputControlGroupState) startGlobalControl() {
+	instanceID, err := uuid.New()
+	if err != nil {
+		log.Writef(EventThroughputControl, "failed to start the global control of throughput control group %s: %v", s.group.Name, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.controller.wg.Add(1)
+	go func() {
+		defer s.controller.wg.Done()
+		defer cancel()
+		<-s.controller.stop
+	}()
+
+	s.controller.wg.Add(1)
+	go func() {
+		defer s.controller.wg.Done()
+		ticker := time.NewTicker(s.group.GlobalControl.RenewInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.renewGlobalControl(ctx, instanceID.String()); err != nil && ctx.Err() == nil {
+				log.Writef(EventThroughputControl, "failed to renew the global control of throughput control group %s: %v", s.group.Name, err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// renewGlobalControl renews the document of this client and updates the number of clients sharing the target throughput.
+func (s *throughputControlGroupState) renewGlobalControl(ctx context.Context, instanceID string) error {
+	globalControl := s.group.GlobalControl
+	groupID := s.containerLink + "/" + s.group.Name
+	partitionKey := NewPartitionKeyString(groupID)
+	expireInterval := int64(math.Ceil(globalControl.ExpireInterval.Seconds()))
+
+	document, err := json.Marshal(throughputControlInstance{ID: instanceID, GroupID: groupID, TTL: expireInterval})
+	if err != nil {
+		return err
+	}
+	if _, err := globalControl.ControlContainer.UpsertItem(ctx, partitionKey, document, nil); err != nil {
+		return err
+	}
+
+	expired := s.controller.now().Unix() - expireInterval
+	// this client is counted even if the query doesn't see its document yet.
+	instances := 1
+	pager := globalControl.ControlContainer.NewQueryItemsPager("SELECT * FROM c", partitionKey, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			var instance throughputControlInstance
+			if err := json.Unmarshal(item, &instance); err != nil {
+				return err
+			}
+			if instance.ID != instanceID && instance.Timestamp >= expired {
+				instances++
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// settle the budget at the previous throughput before changing it.
+	s.refillLocked()
+	s.instances = instances
+	return nil
+}
+
+// throughputControlPolicy applies the throughput control groups to the requests on items.
+// It runs for each attempt, since retried attempts consume throughput too.
+type throughputControlPolicy struct {
+	controller *throughputController
+}
+
+func (p *throughputControlPolicy) Do(req *policy.Request) (*http.Response, error) {
+	o := pipelineRequestOptions{}
+	if !req.OperationValue(&o) || o.resourceType != resourceTypeDocument {
+		return req.Next()
+	}
+
+	var name *string
+	if o.headerOptionsOverride != nil {
+		name = o.headerOptionsOverride.throughputControlGroup
+	}
+	group, err := p.controller.groupFor(o.resourceAddress, name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return req.Next()
+	}
+
+	if err := group.acquire(req.Raw().Context()); err != nil {
+		return nil, err
+	}
+	resp, err := req.Next()
+	if resp != nil {
+		group.charge(readRequestCharge(resp))
+	}
+	return resp, err
+}
@@ -0,0 +1,409 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/mock"
+)
+
+// newThroughputControlTestClient creates a client whose throughput controller uses a fake clock.
+// The returned waits record how long requests were delayed.
+func newThroughputControlTestClient(t *testing.T, srv *mock.Server, groups []ThroughputControlGroup) (*Client, *[]time.Duration) {
+	controller, err := newThroughputController(&ClientOptions{ThroughputControlGroups: groups})
+	if err != nil {
+		t.Fatalf("Failed to create throughput controller: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	waits := []time.Duration{}
+	controller.now = func() time.Time { return now }
+	controller.wait = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	defaultEndpoint, _ := url.Parse(srv.URL())
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{PerCall: []policy.Policy{&throughputControlPolicy{controller: controller}}}, &policy.ClientOptions{Transport: srv})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	gem := &globalEndpointManager{preferredLocations: []string{}}
+	client := &Client{endpoint: srv.URL(), endpointUrl: defaultEndpoint, internal: internalClient, gem: gem, throughputController: controller}
+	controller.client = client
+	return client, &waits
+}
+
+func newThroughputControlTestContainer(t *testing.T, client *Client, id string) *ContainerClient {
+	database, _ := newDatabase("databaseId", client)
+	container, _ := newContainer(id, database)
+	return container
+}
+
+func TestThroughputControlGroupValidation(t *testing.T) {
+	target := int32(100)
+	zero := int32(0)
+	threshold := 1.5
+
+	tests := []struct {
+		name    string
+		groups  []ThroughputControlGroup
+		message string
+	}{
+		{
+			name:    "no name",
+			groups:  []ThroughputControlGroup{{DatabaseID: "db", ContainerID: "c", TargetThroughput: &target}},
+			message: "name is required",
+		},
+		{
+			name:    "no container",
+			groups:  []ThroughputControlGroup{{Name: "g", DatabaseID: "db", TargetThroughput: &target}},
+			message: "requires a DatabaseID and a ContainerID",
+		},
+		{
+			name:    "no target",
+			groups:  []ThroughputControlGroup{{Name: "g", DatabaseID: "db", ContainerID: "c"}},
+			message: "requires a TargetThroughput or a TargetThroughputThreshold",
+		},
+		{
+			name:    "invalid target",
+			groups:  []ThroughputControlGroup{{Name: "g", DatabaseID: "db", ContainerID: "c", TargetThroughput: &zero}},
+			message: "TargetThroughput must be greater than 0",
+		},
+		{
+			name:    "invalid threshold",
+			groups:  []ThroughputControlGroup{{Name: "g", DatabaseID: "db", ContainerID: "c", TargetThroughputThreshold: &threshold}},
+			message: "TargetThroughputThreshold must be greater than 0 and at most 1",
+		},
+		{
+			name: "duplicate name",
+			groups: []ThroughputControlGroup{
+				{Name: "g", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target},
+				{Name: "g", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target},
+			},
+			message: "defined twice",
+		},
+		{
+			name: "two defaults",
+			groups: []ThroughputControlGroup{
+				{Name: "g1", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target, IsDefault: true},
+				{Name: "g2", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target, IsDefault: true},
+			},
+			message: "are both the default",
+		},
+		{
+			name:    "no control container",
+			groups:  []ThroughputControlGroup{{Name: "g", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target, GlobalControl: &ThroughputControlGlobalOptions{}}},
+			message: "requires a ControlContainer",
+		},
+		{
+			name: "expire before renew",
+			groups: []ThroughputControlGroup{{Name: "g", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target, GlobalControl: &ThroughputControlGlobalOptions{
+				ControlContainer: &ContainerClient{},
+				RenewInterval:    time.Minute,
+				ExpireInterval:   time.Second,
+			}}},
+			message: "ExpireInterval must be greater than RenewInterval",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newThroughputController(&ClientOptions{ThroughputControlGroups: tt.groups})
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("Expected error to contain %q, but got %v", tt.message, err)
+			}
+		})
+	}
+
+	// the same group name can be used for different containers.
+	_, err := newThroughputController(&ClientOptions{ThroughputControlGroups: []ThroughputControlGroup{
+		{Name: "g", DatabaseID: "db", ContainerID: "c1", TargetThroughput: &target, IsDefault: true},
+		{Name: "g", DatabaseID: "db", ContainerID: "c2", TargetThroughput: &target, IsDefault: true},
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+}
+
+func TestThroughputControlGroupFor(t *testing.T) {
+	target := int32(100)
+	controller, err := newThroughputController(&ClientOptions{ThroughputControlGroups: []ThroughputControlGroup{
+		{Name: "default", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target, IsDefault: true},
+		{Name: "batch", DatabaseID: "db", ContainerID: "c", TargetThroughput: &target},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := controller.groupFor("dbs/db/colls/c/docs/item1", nil)
+	if err != nil || group == nil || group.group.Name != "default" {
+		t.Errorf("Expected the default group, but got %v, %v", group, err)
+	}
+
+	name := "batch"
+	group, err = controller.groupFor("dbs/db/colls/c", &name)
+	if err != nil || group == nil || group.group.Name != "batch" {
+		t.Errorf("Expected the batch group, but got %v, %v", group, err)
+	}
+
+	group, err = controller.groupFor("dbs/db/colls/other/docs/item1", nil)
+	if err != nil || group != nil {
+		t.Errorf("Expected no group, but got %v, %v", group, err)
+	}
+
+	name = "missing"
+	_, err = controller.groupFor("dbs/db/colls/c/docs/item1", &name)
+	if err == nil || !strings.Contains(err.Error(), "isn't defined") {
+		t.Errorf("Expected an undefined group error, but got %v", err)
+	}
+}
+
+func TestThroughputControlDelaysRequestsOverBudget(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithBody([]byte(`{"id":"item1"}`)),
+		mock.WithHeader(cosmosHeaderRequestCharge, "20"),
+		mock.WithStatusCode(200))
+
+	target := int32(10)
+	client, waits := newThroughputControlTestClient(t, srv, []ThroughputControlGroup{
+		{Name: "batch", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, IsDefault: true},
+	})
+	container := newThroughputControlTestContainer(t, client, "containerId")
+
+	// the budget starts at one second of the target throughput.
+	if _, err := container.ReadItem(context.TODO(), NewPartitionKeyString("pk"), "item1", nil); err != nil {
+		t.Fatalf("Failed to read item: %v", err)
+	}
+	if len(*waits) != 0 {
+		t.Fatalf("Expected no delay, but got %v", *waits)
+	}
+
+	// the first request consumed 20 RU of the 10 RU budget, so the next one waits for the 10 RU debt to be refilled.
+	if _, err := container.ReadItem(context.TODO(), NewPartitionKeyString("pk"), "item1", nil); err != nil {
+		t.Fatalf("Failed to read item: %v", err)
+	}
+	var total time.Duration
+	for _, wait := range *waits {
+		total += wait
+	}
+	if total < time.Second || total > time.Second+10*time.Millisecond {
+		t.Fatalf("Expected a delay of 1s, but got %v", *waits)
+	}
+
+	// requests to other containers aren't controlled.
+	*waits = (*waits)[:0]
+	other := newThroughputControlTestContainer(t, client, "otherContainerId")
+	if _, err := other.ReadItem(context.TODO(), NewPartitionKeyString("pk"), "item1", nil); err != nil {
+		t.Fatalf("Failed to read item: %v", err)
+	}
+	if len(*waits) != 0 {
+		t.Fatalf("Expected no delay, but got %v", *waits)
+	}
+
+	if srv.Requests() != 3 {
+		t.Fatalf("Expected 3 requests, but got %d", srv.Requests())
+	}
+}
+
+func TestThroughputControlRejectsRequestsOverBudget(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	srv.SetResponse(
+		mock.WithBody([]byte(`{"Documents":[],"_count":0}`)),
+		mock.WithHeader(cosmosHeaderRequestCharge, "20"),
+		mock.WithStatusCode(200))
+
+	target := int32(10)
+	client, waits := newThroughputControlTestClient(t, srv, []ThroughputControlGroup{
+		{Name: "api", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, IsDefault: true},
+		{Name: "batch", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, RejectWhenOverBudget: true},
+	})
+	container := newThroughputControlTestContainer(t, client, "containerId")
+
+	name := "batch"
+	options := &QueryOptions{ThroughputControlGroupName: &name}
+	if _, err := container.NewQueryItemsPager("SELECT * FROM c", NewPartitionKeyString("pk"), options).NextPage(context.TODO()); err != nil {
+		t.Fatalf("Failed to query items: %v", err)
+	}
+
+	_, err := container.NewQueryItemsPager("SELECT * FROM c", NewPartitionKeyString("pk"), options).NextPage(context.TODO())
+	if !errors.Is(err, ErrThroughputControlBudgetExceeded) {
+		t.Fatalf("Expected ErrThroughputControlBudgetExceeded, but got %v", err)
+	}
+	if srv.Requests() != 1 {
+		t.Fatalf("Expected 1 request, but got %d", srv.Requests())
+	}
+
+	// the default group has its own budget.
+	if _, err := container.NewQueryItemsPager("SELECT * FROM c", NewPartitionKeyString("pk"), nil).NextPage(context.TODO()); err != nil {
+		t.Fatalf("Failed to query items: %v", err)
+	}
+	if len(*waits) != 0 {
+		t.Fatalf("Expected no delay, but got %v", *waits)
+	}
+}
+
+func TestThroughputControlTargetThroughputThreshold(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	// the container, its offer and the offer content.
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"id":"containerId","_rid":"someRid"}`)),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"Offers":[{"id":"offerId","_self":"offers/offerId/","offerResourceId":"someRid","content":{"offerThroughput":1000}}]}`)),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"id":"offerId","_self":"offers/offerId/","offerResourceId":"someRid","content":{"offerThroughput":1000}}`)),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"id":"item1"}`)),
+		mock.WithHeader(cosmosHeaderRequestCharge, "300"),
+		mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"id":"item1"}`)),
+		mock.WithHeader(cosmosHeaderRequestCharge, "300"),
+		mock.WithStatusCode(200))
+
+	target := int32(400)
+	threshold := 0.2
+	client, waits := newThroughputControlTestClient(t, srv, []ThroughputControlGroup{
+		{Name: "batch", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, TargetThroughputThreshold: &threshold, IsDefault: true},
+	})
+	container := newThroughputControlTestContainer(t, client, "containerId")
+
+	for i := 0; i < 2; i++ {
+		if _, err := container.ReadItem(context.TODO(), NewPartitionKeyString("pk"), "item1", nil); err != nil {
+			t.Fatalf("Failed to read item: %v", err)
+		}
+	}
+
+	// the target is the lower of 400 RU/s and 20% of 1000 RU/s, so the 100 RU debt takes half a second to refill.
+	var total time.Duration
+	for _, wait := range *waits {
+		total += wait
+	}
+	if total < 500*time.Millisecond || total > 510*time.Millisecond {
+		t.Fatalf("Expected a delay of 500ms, but got %v", *waits)
+	}
+	if srv.Requests() != 5 {
+		t.Fatalf("Expected the provisioned throughput to be read once, but got %d requests", srv.Requests())
+	}
+}
+
+func TestThroughputControlGlobalControlSharesTarget(t *testing.T) {
+	srv, close := mock.NewTLSServer()
+	defer close()
+	// the upsert of this instance, and the instances of the group: this one, an active one and an expired one.
+	srv.AppendResponse(mock.WithStatusCode(200))
+	srv.AppendResponse(
+		mock.WithBody([]byte(`{"Documents":[{"id":"other","_ts":1699999990},{"id":"expired","_ts":1699990000}],"_count":2}`)),
+		mock.WithStatusCode(200))
+
+	verifier := pipelineVerifier{}
+	defaultEndpoint, _ := url.Parse(srv.URL())
+	internalClient, err := azcore.NewClient("azcosmostest", "v1.0.0", azruntime.PipelineOptions{PerCall: []policy.Policy{&verifier}}, &policy.ClientOptions{Transport: srv})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client := &Client{endpoint: srv.URL(), endpointUrl: defaultEndpoint, internal: internalClient, gem: &globalEndpointManager{preferredLocations: []string{}}}
+	controlContainer := newThroughputControlTestContainer(t, client, "controlContainerId")
+
+	target := int32(100)
+	controller, err := newThroughputController(&ClientOptions{ThroughputControlGroups: []ThroughputControlGroup{
+		{Name: "batch", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, GlobalControl: &ThroughputControlGlobalOptions{
+			ControlContainer: controlContainer,
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.now = func() time.Time { return time.Unix(1700000000, 0) }
+	state := controller.groups["dbs/databaseId/colls/containerId/batch"]
+
+	if err := state.renewGlobalControl(context.TODO(), "self"); err != nil {
+		t.Fatalf("Failed to renew global control: %v", err)
+	}
+
+	if state.instances != 2 {
+		t.Fatalf("Expected 2 instances, but got %d", state.instances)
+	}
+	state.mu.Lock()
+	limit := state.limitLocked()
+	state.mu.Unlock()
+	if limit != 50 {
+		t.Fatalf("Expected a limit of 50 RU/s, but got %v", limit)
+	}
+
+	upsert := verifier.requests[0]
+	if upsert.headers.Get(cosmosHeaderIsUpsert) != "true" || upsert.url.RequestURI() != "/dbs/databaseId/colls/controlContainerId/docs" {
+		t.Errorf("Unexpected upsert request %s %s", upsert.method, upsert.url.RequestURI())
+	}
+	if upsert.body != `{"id":"self","groupId":"dbs/databaseId/colls/containerId/batch","ttl":30}` {
+		t.Errorf("Unexpected upsert body %s", upsert.body)
+	}
+}
+
+func TestThroughputControlGlobalControlStopsOnClose(t *testing.T) {
+	srv, closeServer := mock.NewTLSServer()
+	defer closeServer()
+	srv.SetResponse(
+		mock.WithBody([]byte(`{"Documents":[],"_count":0}`)),
+		mock.WithStatusCode(200))
+
+	target := int32(100)
+	client, _ := newThroughputControlTestClient(t, srv, []ThroughputControlGroup{
+		{Name: "batch", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, IsDefault: true},
+	})
+	controlContainer := newThroughputControlTestContainer(t, client, "controlContainerId")
+
+	controller, err := newThroughputController(&ClientOptions{ThroughputControlGroups: []ThroughputControlGroup{
+		{Name: "batch", DatabaseID: "databaseId", ContainerID: "containerId", TargetThroughput: &target, GlobalControl: &ThroughputControlGlobalOptions{
+			ControlContainer: controlContainer,
+			RenewInterval:    time.Millisecond,
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := controller.groups["dbs/databaseId/colls/containerId/batch"]
+
+	if err := state.acquire(context.TODO()); err != nil {
+		t.Fatalf("Failed to acquire budget: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		controller.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the global control to stop")
+	}
+}
+
+func TestNewClientValidatesThroughputControlGroups(t *testing.T) {
+	cred, _ := NewKeyCredential("dGVzdA==")
+	_, err := NewClientWithKey("https://localhost:8081", cred, &ClientOptions{
+		ThroughputControlGroups: []ThroughputControlGroup{{Name: "batch", DatabaseID: "db", ContainerID: "c"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "requires a TargetThroughput") {
+		t.Fatalf("Expected a validation error, but got %v", err)
+	}
+}
@@ -30,6 +30,9 @@ type TransactionalBatchOptions struct {
 	// For more information, see https://aka.ms/CosmosDB/ThroughputBuckets
 	// The valid range is 1 to 5 (inclusive).
 	ThroughputBucket *int32
+	// ThroughputControlGroupName selects the throughput control group of the operation, instead of the default group of the container.
+	// See ClientOptions.ThroughputControlGroups.
+	ThroughputControlGroupName *string
 }
 
 // TransactionalBatchItemOptions includes options for the specific operation inside a TransactionalBatch
@@ -160,6 +160,33 @@ Querying items with parametrized queries
 		}
 	}
 
+Using typed items
+
+	type Task struct {
+		ID           string `json:"id"`
+		PartitionKey string `json:"myPartitionKeyProperty"`
+		Done         int    `json:"done"`
+	}
+
+	pk := azcosmos.NewPartitionKeyString("myPartitionKeyValue")
+	taskResponse, err := azcosmos.UpsertItemAs(context, container, pk, Task{ID: "1", PartitionKey: "myPartitionKeyValue"}, nil)
+	handle(err)
+
+	ops, err := azcosmos.NewPatchBuilder[Task]().Increment("Done", 1).Build()
+	handle(err)
+	taskResponse, err = azcosmos.PatchItemAs[Task](context, container, pk, taskResponse.Metadata.ID, ops, nil)
+	handle(err)
+
+	taskPager := azcosmos.NewQueryItemsPagerAs[Task](container, "select * from docs c", pk, nil)
+	for taskPager.More() {
+		taskPage, err := taskPager.NextPage(context)
+		handle(err)
+
+		for _, task := range taskPage.Items {
+			fmt.Println(task.ID, task.Done)
+		}
+	}
+
 Using Transactional batch
 
 	pk := azcosmos.NewPartitionKeyString("myPartitionKeyValue")
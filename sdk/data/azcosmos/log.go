@@ -11,4 +11,12 @@ const (
 	// EventEndpointManager logs related to endpoint management initialization,
 	// failover, and endpoint priority recomputation
 	EventEndpointManager azlog.Event = "azcosmos.EndpointManager"
+
+	// EventChangeFeedProcessor logs related to change feed processor lease
+	// acquisition, renewal, splits and processing errors
+	EventChangeFeedProcessor azlog.Event = "azcosmos.ChangeFeedProcessor"
+
+	// EventThroughputControl logs related to throughput control groups
+	// resolving their provisioned throughput and coordinating across clients
+	EventThroughputControl azlog.Event = "azcosmos.ThroughputControl"
 )
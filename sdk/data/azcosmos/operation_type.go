@@ -12,6 +12,7 @@ const (
 	operationTypeRead    operationType = 2
 	operationTypeReplace operationType = 5
 	operationTypeDelete  operationType = 4
+	operationTypeExecute operationType = 9
 	operationTypeUpsert  operationType = 20
 	operationTypeQuery   operationType = 15
 	operationTypeBatch   operationType = 40
@@ -34,6 +34,22 @@ const (
 	otelSpanNamePatchItem                   = "patch_item"
 	otelSpanNameQueryItems                  = "query_items"
 	otelSpanNamePartitionKeyRanges          = "read_partition_key_ranges"
+	otelSpanNameCreateStoredProcedure       = "create_stored_procedure"
+	otelSpanNameReadStoredProcedure         = "read_stored_procedure"
+	otelSpanNameReplaceStoredProcedure      = "replace_stored_procedure"
+	otelSpanNameDeleteStoredProcedure       = "delete_stored_procedure"
+	otelSpanNameQueryStoredProcedures       = "query_stored_procedures"
+	otelSpanNameExecuteStoredProcedure      = "execute_stored_procedure"
+	otelSpanNameCreateTrigger               = "create_trigger"
+	otelSpanNameReadTrigger                 = "read_trigger"
+	otelSpanNameReplaceTrigger              = "replace_trigger"
+	otelSpanNameDeleteTrigger               = "delete_trigger"
+	otelSpanNameQueryTriggers               = "query_triggers"
+	otelSpanNameCreateUserDefinedFunction   = "create_user_defined_function"
+	otelSpanNameReadUserDefinedFunction     = "read_user_defined_function"
+	otelSpanNameReplaceUserDefinedFunction  = "replace_user_defined_function"
+	otelSpanNameDeleteUserDefinedFunction   = "delete_user_defined_function"
+	otelSpanNameQueryUserDefinedFunctions   = "query_user_defined_functions"
 )
 
 type span struct {
@@ -112,6 +128,47 @@ func getSpanNameForContainers(endpoint *url.URL, operationType operationType, re
 		case operationTypeReplace:
 			spanName = otelSpanNameReaplaceThroughputContainer
 		}
+	case resourceTypeStoredProcedure:
+		switch operationType {
+		case operationTypeCreate:
+			spanName = otelSpanNameCreateStoredProcedure
+		case operationTypeRead:
+			spanName = otelSpanNameReadStoredProcedure
+		case operationTypeReplace:
+			spanName = otelSpanNameReplaceStoredProcedure
+		case operationTypeDelete:
+			spanName = otelSpanNameDeleteStoredProcedure
+		case operationTypeQuery:
+			spanName = otelSpanNameQueryStoredProcedures
+		case operationTypeExecute:
+			spanName = otelSpanNameExecuteStoredProcedure
+		}
+	case resourceTypeTrigger:
+		switch operationType {
+		case operationTypeCreate:
+			spanName = otelSpanNameCreateTrigger
+		case operationTypeRead:
+			spanName = otelSpanNameReadTrigger
+		case operationTypeReplace:
+			spanName = otelSpanNameReplaceTrigger
+		case operationTypeDelete:
+			spanName = otelSpanNameDeleteTrigger
+		case operationTypeQuery:
+			spanName = otelSpanNameQueryTriggers
+		}
+	case resourceTypeUserDefinedFunction:
+		switch operationType {
+		case operationTypeCreate:
+			spanName = otelSpanNameCreateUserDefinedFunction
+		case operationTypeRead:
+			spanName = otelSpanNameReadUserDefinedFunction
+		case operationTypeReplace:
+			spanName = otelSpanNameReplaceUserDefinedFunction
+		case operationTypeDelete:
+			spanName = otelSpanNameDeleteUserDefinedFunction
+		case operationTypeQuery:
+			spanName = otelSpanNameQueryUserDefinedFunctions
+		}
 	}
 
 	if spanName == "" {
@@ -0,0 +1,334 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// aggregator combines the partial aggregates returned by each partition.
+type aggregator interface {
+	add(v any) error
+	result() any
+}
+
+func newAggregator(kind string) (aggregator, error) {
+	switch kind {
+	case "Count", "CountIf", "Sum":
+		return &sumAggregator{}, nil
+	case "Average":
+		return &averageAggregator{}, nil
+	case "Min":
+		return &minMaxAggregator{key: "min", value: undefined}, nil
+	case "Max":
+		return &minMaxAggregator{key: "max", max: true, value: undefined}, nil
+	case "MakeList":
+		return &makeListAggregator{}, nil
+	case "MakeSet":
+		return &makeListAggregator{set: map[string]bool{}}, nil
+	default:
+		return nil, fmt.Errorf("aggregate %q isn't supported", kind)
+	}
+}
+
+// sumAggregator sums the partial sums, or counts, from each partition. The sum is undefined if any partition
+// returned a value that isn't a number.
+type sumAggregator struct {
+	sum       float64
+	undefined bool
+}
+
+func (a *sumAggregator) add(v any) error {
+	if v == undefined {
+		return nil
+	}
+
+	n, ok := toFloat(v)
+	if !ok {
+		a.undefined = true
+		return nil
+	}
+
+	a.sum += n
+	return nil
+}
+
+func (a *sumAggregator) result() any {
+	if a.undefined {
+		return undefined
+	}
+	return a.sum
+}
+
+// averageAggregator averages the partial sums and counts each partition returns, as {"sum": ..., "count": ...}.
+type averageAggregator struct {
+	sum       float64
+	count     float64
+	undefined bool
+}
+
+func (a *averageAggregator) add(v any) error {
+	if v == undefined {
+		return nil
+	}
+
+	partial, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected a partial average, got %T", v)
+	}
+
+	count, _ := toFloat(partial["count"])
+	if count == 0 {
+		return nil
+	}
+
+	sum, ok := toFloat(partial["sum"])
+	if !ok {
+		a.undefined = true
+		return nil
+	}
+
+	a.sum += sum
+	a.count += count
+	return nil
+}
+
+func (a *averageAggregator) result() any {
+	if a.undefined || a.count == 0 {
+		return undefined
+	}
+	return a.sum / a.count
+}
+
+// minMaxAggregator finds the smallest, or largest, of the values each partition returns. Partitions return either
+// the value, or {"min": ..., "count": ...} (or "max"), where count is the number of values the partition compared.
+type minMaxAggregator struct {
+	key   string
+	max   bool
+	value any
+}
+
+func (a *minMaxAggregator) add(v any) error {
+	if partial, ok := v.(map[string]any); ok {
+		if count, hasCount := partial["count"]; hasCount {
+			if n, _ := toFloat(count); n == 0 {
+				return nil
+			}
+
+			var found bool
+			if v, found = partial[a.key]; !found {
+				v = undefined
+			}
+		}
+	}
+
+	if v == undefined {
+		return nil
+	}
+
+	if a.value == undefined {
+		a.value = v
+		return nil
+	}
+
+	c := compareValues(v, a.value)
+	if (a.max && c > 0) || (!a.max && c < 0) {
+		a.value = v
+	}
+	return nil
+}
+
+func (a *minMaxAggregator) result() any {
+	return a.value
+}
+
+// makeListAggregator concatenates the arrays each partition returns for MakeList. When set isn't nil, it's a
+// MakeSet aggregate, so duplicate values are removed.
+type makeListAggregator struct {
+	items []any
+	set   map[string]bool
+}
+
+func (a *makeListAggregator) add(v any) error {
+	if v == undefined {
+		return nil
+	}
+
+	items, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("expected an array, got %T", v)
+	}
+
+	for _, item := range items {
+		if a.set != nil {
+			key := canonicalKey(item)
+			if a.set[key] {
+				continue
+			}
+			a.set[key] = true
+		}
+		a.items = append(a.items, item)
+	}
+	return nil
+}
+
+func (a *makeListAggregator) result() any {
+	if a.items == nil {
+		return []any{}
+	}
+	return a.items
+}
+
+// aggregateValue is a value in the results of an aggregate query. It's either an aggregate, which the partitions
+// return as {"item": ...}, or a scalar, such as a GROUP BY expression, which is the same in every partition.
+type aggregateValue struct {
+	aggregator aggregator
+	scalar     any
+}
+
+func (v *aggregateValue) add(x any) error {
+	if v.aggregator == nil {
+		if v.scalar == undefined {
+			v.scalar = x
+		}
+		return nil
+	}
+
+	item := any(undefined)
+	if partial, ok := x.(map[string]any); ok {
+		if i, ok := partial["item"]; ok {
+			item = i
+		}
+	}
+	return v.aggregator.add(item)
+}
+
+func (v *aggregateValue) result() any {
+	if v.aggregator == nil {
+		return v.scalar
+	}
+	return v.aggregator.result()
+}
+
+// groupAggregator combines the rows that each partition returns for a group (or, without GROUP BY, for the whole
+// query) into a single result.
+type groupAggregator struct {
+	selectValue bool
+	aliases     []string
+	values      []*aggregateValue
+}
+
+func newGroupAggregator(info *queryInfo) (*groupAggregator, error) {
+	g := &groupAggregator{selectValue: info.HasSelectValue}
+
+	newValue := func(kind *string) (*aggregateValue, error) {
+		if kind == nil {
+			return &aggregateValue{scalar: undefined}, nil
+		}
+		agg, err := newAggregator(*kind)
+		if err != nil {
+			return nil, err
+		}
+		return &aggregateValue{aggregator: agg}, nil
+	}
+
+	if info.HasSelectValue {
+		var kind *string
+		if len(info.Aggregates) > 0 {
+			kind = &info.Aggregates[0]
+		}
+		v, err := newValue(kind)
+		if err != nil {
+			return nil, err
+		}
+		g.values = []*aggregateValue{v}
+		return g, nil
+	}
+
+	g.aliases = info.GroupByAliases
+	if len(g.aliases) == 0 {
+		for alias := range info.GroupByAliasToAggregateType {
+			g.aliases = append(g.aliases, alias)
+		}
+		slices.Sort(g.aliases)
+	}
+
+	for _, alias := range g.aliases {
+		v, err := newValue(info.GroupByAliasToAggregateType[alias])
+		if err != nil {
+			return nil, err
+		}
+		g.values = append(g.values, v)
+	}
+	return g, nil
+}
+
+// add adds a partition's row for the group.
+func (g *groupAggregator) add(payload any) error {
+	if g.selectValue {
+		v := g.values[0]
+		// aggregates are returned as [{"item": ...}].
+		if items, ok := payload.([]any); ok && len(items) == 1 && v.aggregator != nil {
+			payload = items[0]
+		}
+		return v.add(payload)
+	}
+
+	row, ok := payload.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected an object for the aggregates, got %T", payload)
+	}
+
+	for i, alias := range g.aliases {
+		value, ok := row[alias]
+		if !ok {
+			value = undefined
+		}
+		if err := g.values[i].add(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// result returns the aggregated row, or nil if it's undefined.
+func (g *groupAggregator) result() ([]byte, error) {
+	if g.selectValue {
+		v := g.values[0].result()
+		if v == undefined {
+			return nil, nil
+		}
+		return json.Marshal(v)
+	}
+
+	// the properties are written in the order of the query's SELECT clause.
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, alias := range g.aliases {
+		v := g.values[i].result()
+		if v == undefined {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(alias)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -100,3 +100,13 @@ type QueryPipeline interface {
 	// Close frees the resources associated with the pipeline.
 	Close()
 }
+
+// PartitionKeyRangeUpdater can be implemented by a QueryPipeline to continue a query when partition key ranges are split.
+//
+// When a request fails because its partition key range is gone, the SDK gets the container's partition key ranges again
+// and calls UpdatePartitionKeyRanges with them, in the same format as for QueryEngine.CreateQueryPipeline.
+// The pipeline's next requests should read from the ranges that replaced the ones that are gone.
+// Results of the failed requests aren't provided to the pipeline, so they're requested again.
+type PartitionKeyRangeUpdater interface {
+	UpdatePartitionKeyRanges(pkranges string) error
+}
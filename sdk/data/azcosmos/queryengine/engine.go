@@ -0,0 +1,46 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import "errors"
+
+// supportedQueryFeatures are the query features the engine returned by NewQueryEngine supports.
+// The gateway rejects queries that need other features.
+const supportedQueryFeatures = "Aggregate,CompositeAggregate,CountIf,DCount,Distinct,GroupBy,HybridSearch,ListAndSetAggregate,MultipleAggregates,MultipleOrderBy,NonStreamingOrderBy,NonValueAggregate,OffsetAndLimit,OrderBy,Top,WeightedRankFusion"
+
+// NewQueryEngine creates a QueryEngine implemented in Go, which doesn't require cgo.
+// Set it in azcosmos.QueryOptions.QueryEngine to run cross-partition queries with ORDER BY, aggregates, DISTINCT,
+// GROUP BY, OFFSET and LIMIT, and hybrid search.
+//
+// The engine's pipelines implement PartitionKeyRangeUpdater, so queries continue when partitions are split.
+func NewQueryEngine() QueryEngine {
+	return &engine{}
+}
+
+type engine struct{}
+
+// CreateQueryPipeline creates a pipeline for the query, from the gateway's query plan and the container's partition key ranges.
+func (e *engine) CreateQueryPipeline(query string, plan string, pkranges string) (QueryPipeline, error) {
+	qp, err := parseQueryPlan(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := parsePartitionKeyRanges(pkranges)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPipeline(query, qp, ranges)
+}
+
+// CreateReadManyPipeline isn't supported. The SDK reads many items without a query engine.
+func (e *engine) CreateReadManyPipeline(items []ItemIdentity, pkranges string, pkKind string, pkVersion uint8, pkPaths []string) (QueryPipeline, error) {
+	return nil, errors.New("CreateReadManyPipeline isn't supported by this query engine")
+}
+
+// SupportedFeatures returns the query features the engine supports, which are sent to the gateway when getting the query plan.
+func (e *engine) SupportedFeatures() string {
+	return supportedQueryFeatures
+}
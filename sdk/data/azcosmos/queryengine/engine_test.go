@@ -0,0 +1,475 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const twoRanges = `{"PartitionKeyRanges":[{"id":"1","minInclusive":"80","maxExclusive":"FF"},{"id":"0","minInclusive":"","maxExclusive":"80"}]}`
+
+// fakeContainer answers a pipeline's requests with pages of documents for each query and partition key range.
+// Continuation tokens are the index of the next page.
+type fakeContainer struct {
+	// pages are JSON arrays of documents, by query, then by partition key range ID.
+	pages map[string]map[string][]string
+
+	// gone are the partition key ranges that were split. Requesting one updates the pipeline's ranges to splitRanges.
+	gone        map[string]bool
+	splitRanges string
+
+	requests []QueryRequest
+}
+
+// run runs the pipeline to completion, and returns its items.
+func (c *fakeContainer) run(t *testing.T, p QueryPipeline) []string {
+	var items []string
+	for i := 0; !p.IsComplete(); i++ {
+		require.Less(t, i, 100, "the pipeline should complete")
+
+		result, err := p.Run()
+		require.NoError(t, err)
+		for _, item := range result.Items {
+			items = append(items, string(item))
+		}
+		if len(result.Items) > 0 || result.IsCompleted {
+			continue
+		}
+		require.NotEmpty(t, result.Requests)
+
+		var data []QueryResult
+		split := false
+		for _, req := range result.Requests {
+			c.requests = append(c.requests, req)
+			if c.gone[req.PartitionKeyRangeID] {
+				split = true
+				continue
+			}
+			data = append(data, c.execute(t, req)...)
+		}
+
+		if split {
+			// the SDK doesn't provide the data of a round that failed, and updates the ranges.
+			require.NoError(t, p.(PartitionKeyRangeUpdater).UpdatePartitionKeyRanges(c.splitRanges))
+			continue
+		}
+		require.NoError(t, p.ProvideData(data))
+	}
+	return items
+}
+
+func (c *fakeContainer) execute(t *testing.T, req QueryRequest) []QueryResult {
+	byRange, ok := c.pages[req.Query]
+	require.True(t, ok, "unexpected query %q", req.Query)
+	pages := byRange[req.PartitionKeyRangeID]
+
+	start := 0
+	if req.Continuation != "" {
+		var err error
+		start, err = strconv.Atoi(req.Continuation)
+		require.NoError(t, err)
+	}
+
+	if len(pages) == 0 {
+		return []QueryResult{{PartitionKeyRangeID: req.PartitionKeyRangeID, RequestId: req.Id, Data: []byte(`{"Documents":[]}`)}}
+	}
+
+	var results []QueryResult
+	for i := start; i < len(pages); i++ {
+		next := ""
+		if i+1 < len(pages) {
+			next = strconv.Itoa(i + 1)
+		}
+		results = append(results, QueryResult{
+			PartitionKeyRangeID: req.PartitionKeyRangeID,
+			RequestId:           req.Id,
+			NextContinuation:    next,
+			Data:                []byte(`{"_rid":"test","Documents":` + pages[i] + `,"_count":1}`),
+		})
+		if !req.Drain {
+			break
+		}
+	}
+	return results
+}
+
+func newTestPipeline(t *testing.T, query string, plan string, pkranges string) QueryPipeline {
+	p, err := NewQueryEngine().CreateQueryPipeline(query, plan, pkranges)
+	require.NoError(t, err)
+	return p
+}
+
+// orderByDoc returns a document in the format of a rewritten ORDER BY query. Items that are "" are undefined.
+func orderByDoc(rid string, payload string, items ...string) string {
+	orderByItems := make([]string, len(items))
+	for i, item := range items {
+		if item == "" {
+			orderByItems[i] = `{}`
+		} else {
+			orderByItems[i] = `{"item":` + item + `}`
+		}
+	}
+
+	doc := `{"_rid":"` + rid + `","orderByItems":[` + strings.Join(orderByItems, ",") + `]`
+	if payload != "" {
+		doc += `,"payload":` + payload
+	}
+	return doc + `}`
+}
+
+func docs(docs ...string) string {
+	return "[" + strings.Join(docs, ",") + "]"
+}
+
+func TestParallelQuery(t *testing.T) {
+	query := "SELECT * FROM c"
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"": {
+			"0": {`[{"id":"a"},{"id":"b"}]`, `[]`, `[{"id":"c"}]`},
+			"1": {`[{"id":"d"}]`, `[{"id":"e"}]`},
+		},
+	}}
+
+	p := newTestPipeline(t, query, `{"partitionedQueryExecutionInfoVersion":2,"queryInfo":{"distinctType":"None","rewrittenQuery":""},"queryRanges":[{"min":"","max":"FF","isMinInclusive":true,"isMaxInclusive":false}]}`, twoRanges)
+	require.Equal(t, query, p.Query())
+
+	items := c.run(t, p)
+	require.Equal(t, []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`, `{"id":"d"}`, `{"id":"e"}`}, items, "results are in the order of the partitions")
+
+	for _, req := range c.requests {
+		require.Empty(t, req.Query, "the original query is used")
+		require.False(t, req.Drain)
+	}
+}
+
+func TestParallelQuery_Limit(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"SELECT * FROM c": {
+			"0": {`[1,2]`, `[3]`},
+			"1": {`[4]`},
+		},
+	}}
+
+	p := newTestPipeline(t, "SELECT * FROM c OFFSET 1 LIMIT 2", `{"queryInfo":{"offset":1,"limit":2,"rewrittenQuery":"SELECT * FROM c"}}`, twoRanges)
+	require.Equal(t, "SELECT * FROM c", p.Query())
+	require.Equal(t, []string{"2", "3"}, c.run(t, p))
+	require.Len(t, c.requests, 3, "no more pages are read once the limit is reached")
+}
+
+func TestOrderByQuery(t *testing.T) {
+	rewritten := `SELECT c._rid, [{"item": c.a}, {"item": c.b}] AS orderByItems, c AS payload FROM c WHERE ({documentdb-formattableorderbyquery-filter}) ORDER BY c.a, c.b DESC`
+	query := strings.ReplaceAll(rewritten, orderByFilterPlaceholder, "true")
+
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		query: {
+			"0": {
+				docs(orderByDoc("r1", `"undefined-a"`, "", "1"), orderByDoc("r2", `"null"`, "null", "1")),
+				docs(orderByDoc("r3", `"1-b9"`, "1", "9"), orderByDoc("r4", `"1-b1"`, "1", "1"), orderByDoc("r5", `"string"`, `"x"`, "1")),
+			},
+			"1": {
+				docs(orderByDoc("r6", `"false"`, "false", "1"), orderByDoc("r7", `"1-b5"`, "1", "5")),
+				docs(orderByDoc("r8", `"2"`, "2.0", "1"), orderByDoc("r9", "", "3", "1")),
+			},
+		},
+	}}
+
+	plan := fmt.Sprintf(`{"queryInfo":{"orderBy":["Ascending","Descending"],"orderByExpressions":["c.a","c.b"],"rewrittenQuery":%q}}`, rewritten)
+	p := newTestPipeline(t, "SELECT * FROM c ORDER BY c.a, c.b DESC", plan, twoRanges)
+	require.Equal(t, query, p.Query())
+
+	items := c.run(t, p)
+	// undefined sorts first, then null, booleans, numbers and strings. The item without a payload isn't returned.
+	require.Equal(t, []string{`"undefined-a"`, `"null"`, `"false"`, `"1-b9"`, `"1-b5"`, `"1-b1"`, `"2"`, `"string"`}, items)
+
+	for _, req := range c.requests {
+		require.Equal(t, query, req.Query)
+		require.True(t, req.IncludeParameters)
+	}
+}
+
+func TestOrderByQuery_DistinctOffsetLimit(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {docs(orderByDoc("r1", `{"v":1}`, "1"), orderByDoc("r2", `{"v":2}`, "2"), orderByDoc("r3", `{"v":4}`, "4"))},
+			"1": {docs(orderByDoc("r4", `{"v":1}`, "1"), orderByDoc("r5", `{"v":3}`, "3")), docs(orderByDoc("r6", `{"v":5}`, "5"))},
+		},
+	}}
+
+	p := newTestPipeline(t, "SELECT DISTINCT c.v FROM c ORDER BY c.v OFFSET 1 LIMIT 2", `{"queryInfo":{"distinctType":"Ordered","orderBy":["Ascending"],"offset":1,"limit":2,"rewrittenQuery":"rewritten"}}`, twoRanges)
+	require.Equal(t, []string{`{"v":2}`, `{"v":3}`}, c.run(t, p))
+}
+
+func TestOrderByQuery_Top(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {docs(orderByDoc("r1", "5", "5"), orderByDoc("r2", "3", "3"))},
+			"1": {docs(orderByDoc("r3", "4", "4")), docs(orderByDoc("r4", "1", "1"))},
+		},
+	}}
+
+	p := newTestPipeline(t, "SELECT TOP 2 VALUE c.v FROM c ORDER BY c.v DESC", `{"queryInfo":{"top":2,"orderBy":["Descending"],"rewrittenQuery":"rewritten"}}`, twoRanges)
+	require.Equal(t, []string{"5", "4"}, c.run(t, p))
+	require.Len(t, c.requests, 2, "the second page of partition 1 isn't needed")
+}
+
+func TestUnorderedDistinct(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"": {
+			"0": {`[{"a":1,"b":2},1,"x"]`},
+			"1": {`[{"b":2,"a":1.0},1.0,"y",null]`},
+		},
+	}}
+
+	p := newTestPipeline(t, "SELECT DISTINCT VALUE c.v FROM c", `{"queryInfo":{"distinctType":"Unordered"}}`, twoRanges)
+	require.Equal(t, []string{`{"a":1,"b":2}`, `1`, `"x"`, `"y"`, `null`}, c.run(t, p))
+}
+
+func TestValueAggregates(t *testing.T) {
+	tests := []struct {
+		aggregate string
+		pages     [2]string
+		expected  []string
+	}{
+		{"Count", [2]string{`[[{"item":3}]]`, `[[{"item":4}]]`}, []string{"7"}},
+		{"Sum", [2]string{`[[{"item":1.5}]]`, `[[{"item":2}]]`}, []string{"3.5"}},
+		{"Sum", [2]string{`[[{"item":1}]]`, `[[{"item":"x"}]]`}, nil},
+		{"Average", [2]string{`[[{"item":{"sum":6,"count":2}}]]`, `[[{"item":{"sum":3,"count":1}}]]`}, []string{"3"}},
+		{"Average", [2]string{`[[{"item":{"count":0}}]]`, `[[{}]]`}, nil},
+		{"Min", [2]string{`[[{"item":{"min":4,"count":2}}]]`, `[[{"item":{"min":2,"count":1}}]]`}, []string{"2"}},
+		{"Min", [2]string{`[[{"item":{"count":0}}]]`, `[[{"item":"b"}]]`}, []string{`"b"`}},
+		{"Max", [2]string{`[[{"item":{"max":"a","count":2}}]]`, `[[{"item":{"max":3,"count":1}}]]`}, []string{`"a"`}},
+		{"MakeSet", [2]string{`[[{"item":[1,2]}]]`, `[[{"item":[2,3]}]]`}, []string{"[1,2,3]"}},
+		{"MakeList", [2]string{`[[{"item":[1,2]}]]`, `[[{"item":[2]}]]`}, []string{"[1,2,2]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.aggregate, func(t *testing.T) {
+			c := &fakeContainer{pages: map[string]map[string][]string{
+				"rewritten": {"0": {tt.pages[0]}, "1": {tt.pages[1]}},
+			}}
+
+			plan := fmt.Sprintf(`{"queryInfo":{"aggregates":[%q],"hasSelectValue":true,"rewrittenQuery":"rewritten"}}`, tt.aggregate)
+			p := newTestPipeline(t, "SELECT VALUE AGG(c.v) FROM c", plan, twoRanges)
+			require.Equal(t, tt.expected, c.run(t, p))
+
+			for _, req := range c.requests {
+				require.True(t, req.Drain, "aggregates need all the results")
+			}
+		})
+	}
+}
+
+func TestNonValueAggregates(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {`[{"payload":{"total":{"item":2},"largest":{"item":{"max":5,"count":2}}}}]`},
+			"1": {`[{"payload":{"total":{"item":3},"largest":{"item":{"max":9,"count":3}}}}]`},
+		},
+	}}
+
+	plan := `{"queryInfo":{"aggregates":["Count","Max"],"groupByAliases":["total","largest"],"groupByAliasToAggregateType":{"total":"Count","largest":"Max"},"rewrittenQuery":"rewritten"}}`
+	p := newTestPipeline(t, "SELECT COUNT(1) AS total, MAX(c.v) AS largest FROM c", plan, twoRanges)
+	require.Equal(t, []string{`{"total":5,"largest":9}`}, c.run(t, p))
+}
+
+func TestGroupBy(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {
+				`[{"groupByItems":[{"item":"a"}],"payload":{"category":"a","n":{"item":2},"avg":{"item":{"sum":4,"count":2}}}}]`,
+				`[{"groupByItems":[{"item":"b"}],"payload":{"category":"b","n":{"item":1},"avg":{"item":{"sum":7,"count":1}}}}]`,
+			},
+			"1": {
+				`[{"groupByItems":[{"item":"a"}],"payload":{"category":"a","n":{"item":1},"avg":{"item":{"sum":5,"count":1}}}}]`,
+				`[{"groupByItems":[{}],"payload":{"n":{"item":1},"avg":{"item":{"sum":1,"count":1}}}}]`,
+			},
+		},
+	}}
+
+	plan := `{"queryInfo":{"groupByExpressions":["c.category"],"groupByAliases":["category","n","avg"],"aggregates":["Count","Average"],"groupByAliasToAggregateType":{"category":null,"n":"Count","avg":"Average"},"rewrittenQuery":"rewritten"}}`
+	p := newTestPipeline(t, "SELECT c.category, COUNT(1) AS n, AVG(c.v) AS avg FROM c GROUP BY c.category", plan, twoRanges)
+	require.Equal(t, []string{
+		`{"category":"a","n":3,"avg":3}`,
+		`{"category":"b","n":1,"avg":7}`,
+		`{"n":1,"avg":1}`,
+	}, c.run(t, p))
+}
+
+func TestGroupBy_SelectValue(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {`[{"groupByItems":[{"item":"a"}],"payload":[{"item":2}]},{"groupByItems":[{"item":"b"}],"payload":[{"item":1}]}]`},
+			"1": {`[{"groupByItems":[{"item":"a"}],"payload":[{"item":5}]}]`},
+		},
+	}}
+
+	plan := `{"queryInfo":{"groupByExpressions":["c.category"],"aggregates":["Count"],"groupByAliasToAggregateType":{"$1":"Count"},"hasSelectValue":true,"offset":1,"limit":5,"rewrittenQuery":"rewritten"}}`
+	p := newTestPipeline(t, "SELECT VALUE COUNT(1) FROM c GROUP BY c.category OFFSET 1 LIMIT 5", plan, twoRanges)
+	require.Equal(t, []string{"1"}, c.run(t, p))
+}
+
+func TestDCount(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {`["a","b"]`},
+			"1": {`["b","c"]`},
+		},
+	}}
+
+	p := newTestPipeline(t, "SELECT COUNT(DISTINCT c.v) AS n FROM c", `{"queryInfo":{"distinctType":"Unordered","dCountInfo":{"dCountAlias":"n"},"rewrittenQuery":"rewritten"}}`, twoRanges)
+	require.Equal(t, []string{`{"n":3}`}, c.run(t, p))
+
+	c.requests = nil
+	p = newTestPipeline(t, "SELECT VALUE COUNT(DISTINCT c.v) FROM c", `{"queryInfo":{"distinctType":"Unordered","dCountInfo":{"dCountAlias":""},"rewrittenQuery":"rewritten"}}`, twoRanges)
+	require.Equal(t, []string{`3`}, c.run(t, p))
+}
+
+func TestNonStreamingOrderBy(t *testing.T) {
+	// each page is sorted, but the pages of a partition aren't sorted relative to each other.
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"rewritten": {
+			"0": {docs(orderByDoc("r1", `"a"`, "0.9"), orderByDoc("r2", `"b"`, "0.1")), docs(orderByDoc("r3", `"c"`, "0.95"))},
+			"1": {docs(orderByDoc("r4", `"d"`, "0.5"))},
+		},
+	}}
+
+	plan := `{"queryInfo":{"top":3,"orderBy":["Descending"],"hasNonStreamingOrderBy":true,"rewrittenQuery":"rewritten"}}`
+	p := newTestPipeline(t, "SELECT TOP 3 c.name FROM c ORDER BY VectorDistance(c.v, [1,2])", plan, twoRanges)
+	require.Equal(t, []string{`"c"`, `"a"`, `"d"`}, c.run(t, p))
+}
+
+func TestQueryRanges(t *testing.T) {
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"": {"1": {`[1]`}},
+	}}
+
+	p := newTestPipeline(t, "SELECT * FROM c WHERE c.pk = 'x'", `{"queryInfo":{},"queryRanges":[{"min":"A0","max":"A0","isMinInclusive":true,"isMaxInclusive":true}]}`, twoRanges)
+	require.Equal(t, []string{"1"}, c.run(t, p))
+	require.Len(t, c.requests, 1)
+	require.Equal(t, "1", c.requests[0].PartitionKeyRangeID)
+}
+
+func TestHybridSearch(t *testing.T) {
+	component := func(rid string, payload string, score string, scores string) string {
+		return orderByDoc(rid, `{"payload":`+payload+`,"componentScores":`+scores+`}`, score)
+	}
+
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"statistics": {
+			"0": {`[{"documentCount":10,"fullTextStatistics":[{"totalWordCount":100,"hitCounts":[1,2]}]}]`},
+			"1": {`[{"documentCount":5,"fullTextStatistics":[{"totalWordCount":50,"hitCounts":[3,4]}]}]`},
+		},
+		"FullTextScore 15 150 [4,6]": {
+			"0": {docs(component("r1", `"one"`, "3", "[3,0.1]"), component("r2", `"two"`, "2", "[2,0.9]"))},
+			"1": {docs(component("r3", `"three"`, "1", "[1,0.5]"))},
+		},
+		"VectorDistance": {
+			"0": {docs(component("r2", `"two"`, "0.9", "[2,0.9]"))},
+			"1": {docs(component("r3", `"three"`, "0.5", "[1,0.5]"))},
+		},
+	}}
+
+	plan := `{"hybridSearchQueryInfo":{
+		"globalStatisticsQuery":"statistics",
+		"componentQueryInfos":[
+			{"orderBy":["Descending"],"rewrittenQuery":"FullTextScore {documentdb-formattablehybridsearchquery-totaldocumentcount} {documentdb-formattablehybridsearchquery-totalwordcount-0} {documentdb-formattablehybridsearchquery-hitcountsarray-0}"},
+			{"orderBy":["Descending"],"rewrittenQuery":"VectorDistance"}
+		],
+		"skip":0,"take":2,"requiresGlobalStatistics":true}}`
+	p := newTestPipeline(t, "SELECT TOP 2 c.name FROM c ORDER BY RANK RRF(FullTextScore(c.text, 'x'), VectorDistance(c.v, [1]))", plan, twoRanges)
+
+	// "two" ranks 2nd and 1st, "one" ranks 1st and 3rd, and "three" ranks 3rd and 2nd.
+	require.Equal(t, []string{`"two"`, `"one"`}, c.run(t, p))
+}
+
+func TestHybridSearch_SingleComponent(t *testing.T) {
+	component := func(rid string, payload string, score string) string {
+		return orderByDoc(rid, `{"payload":`+payload+`,"componentScores":[`+score+`]}`, score)
+	}
+
+	c := &fakeContainer{pages: map[string]map[string][]string{
+		"FullTextScore 3": {
+			"0": {docs(component("r1", `"one"`, "1"), component("r2", `"two"`, "5"))},
+			"1": {docs(component("r3", `"three"`, "3"))},
+		},
+		"statistics": {
+			"0": {`[{"documentCount":1}]`},
+			"1": {`[{"documentCount":2}]`},
+		},
+	}}
+
+	plan := `{"hybridSearchQueryInfo":{"globalStatisticsQuery":"statistics","componentQueryInfos":[{"orderBy":["Descending"],"rewrittenQuery":"FullTextScore {documentdb-formattablehybridsearchquery-totaldocumentcount}"}],"skip":1,"take":5,"requiresGlobalStatistics":true}}`
+	p := newTestPipeline(t, "SELECT c.name FROM c ORDER BY RANK FullTextScore(c.text, 'x') OFFSET 1 LIMIT 5", plan, twoRanges)
+	require.Equal(t, []string{`"three"`, `"one"`}, c.run(t, p))
+}
+
+func TestSplit_OrderBy(t *testing.T) {
+	c := &fakeContainer{
+		pages: map[string]map[string][]string{
+			"rewritten": {
+				"0": {docs(orderByDoc("r1", "1", "1"), orderByDoc("r4", "4", "4")), docs(orderByDoc("r6", "6", "6"))},
+				"1": {docs(orderByDoc("r2", "2", "2")), docs(orderByDoc("r3", "3", "3"), orderByDoc("r5", "5", "5"), orderByDoc("r9", "9", "9"))},
+				// partition 0 was split. The new partitions continue from its continuation token.
+				"2": {"[]", docs(orderByDoc("r7", "7", "7"))},
+				"3": {"[]", docs(orderByDoc("r6", "6", "6"), orderByDoc("r8", "8", "8"))},
+			},
+		},
+		splitRanges: `{"PartitionKeyRanges":[{"id":"2","minInclusive":"","maxExclusive":"40"},{"id":"3","minInclusive":"40","maxExclusive":"80"},{"id":"1","minInclusive":"80","maxExclusive":"FF"}]}`,
+	}
+
+	p := newTestPipeline(t, "SELECT VALUE c.v FROM c ORDER BY c.v", `{"queryInfo":{"orderBy":["Ascending"],"rewrittenQuery":"rewritten"}}`, twoRanges)
+
+	// read the first pages, before partition 0 is split.
+	result, err := p.Run()
+	require.NoError(t, err)
+	var data []QueryResult
+	for _, req := range result.Requests {
+		data = append(data, c.execute(t, req)...)
+	}
+	require.NoError(t, p.ProvideData(data))
+
+	c.gone = map[string]bool{"0": true}
+	items := c.run(t, p)
+	require.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}, items)
+
+	var continued []string
+	for _, req := range c.requests {
+		if req.PartitionKeyRangeID == "2" || req.PartitionKeyRangeID == "3" {
+			continued = append(continued, req.PartitionKeyRangeID+":"+req.Continuation)
+		}
+	}
+	require.ElementsMatch(t, []string{"2:1", "3:1"}, continued)
+}
+
+func TestSplit_Merge(t *testing.T) {
+	p := newTestPipeline(t, "SELECT * FROM c", `{"queryInfo":{}}`, twoRanges)
+	err := p.(PartitionKeyRangeUpdater).UpdatePartitionKeyRanges(`{"PartitionKeyRanges":[{"id":"2","minInclusive":"","maxExclusive":"FF"}]}`)
+	require.ErrorContains(t, err, "merged")
+}
+
+func TestProvideData_Unrequested(t *testing.T) {
+	p := newTestPipeline(t, "SELECT * FROM c", `{"queryInfo":{}}`, twoRanges)
+
+	result, err := p.Run()
+	require.NoError(t, err)
+	require.Len(t, result.Requests, 2)
+
+	err = p.ProvideData([]QueryResult{{PartitionKeyRangeID: "1", RequestId: result.Requests[0].Id, Data: []byte(`{"Documents":[]}`)}})
+	require.Error(t, err)
+
+	// the same requests are returned until their data is provided.
+	again, err := p.Run()
+	require.NoError(t, err)
+	require.Equal(t, result.Requests, again.Requests)
+}
+
+func TestUnsupportedAggregate(t *testing.T) {
+	_, err := NewQueryEngine().CreateQueryPipeline("SELECT VALUE X(c.v) FROM c", `{"queryInfo":{"aggregates":["X"],"hasSelectValue":true}}`, twoRanges)
+	require.ErrorContains(t, err, `aggregate "X" isn't supported`)
+}
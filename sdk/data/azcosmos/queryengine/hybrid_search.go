@@ -0,0 +1,269 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	totalDocumentCountPlaceholder = "{documentdb-formattablehybridsearchquery-totaldocumentcount}"
+	totalWordCountPlaceholder     = "{documentdb-formattablehybridsearchquery-totalwordcount-%d}"
+	hitCountsArrayPlaceholder     = "{documentdb-formattablehybridsearchquery-hitcountsarray-%d}"
+
+	// rrfRankConstant is the constant k in the reciprocal rank fusion score, weight / (k + rank).
+	rrfRankConstant = 60
+)
+
+// globalStatistics are the full text statistics of all the partitions, which the component queries of a hybrid
+// search use to score documents.
+type globalStatistics struct {
+	DocumentCount      int64 `json:"documentCount"`
+	FullTextStatistics []struct {
+		TotalWordCount int64   `json:"totalWordCount"`
+		HitCounts      []int64 `json:"hitCounts"`
+	} `json:"fullTextStatistics"`
+}
+
+// hybridSearchExecutor runs a hybrid search query. It first reads the global statistics, if the component queries
+// need them, then runs each component query against all the partitions, and combines the results of the components
+// with reciprocal rank fusion.
+type hybridSearchExecutor struct {
+	tracker *requestTracker
+	info    *hybridSearchQueryInfo
+	ranges  []partitionKeyRange
+
+	statistics *partitionSet
+	components []*partitionSet
+}
+
+func newHybridSearchExecutor(tracker *requestTracker, info *hybridSearchQueryInfo, ranges []partitionKeyRange) *hybridSearchExecutor {
+	e := &hybridSearchExecutor{tracker: tracker, info: info, ranges: ranges}
+	if info.RequiresGlobalStatistics {
+		e.statistics = newPartitionSet(tracker, ranges, info.GlobalStatisticsQuery, true, parseDocument)
+	}
+	return e
+}
+
+func (e *hybridSearchExecutor) partitionSets() []*partitionSet {
+	var sets []*partitionSet
+	if e.statistics != nil {
+		sets = append(sets, e.statistics)
+	}
+	return append(sets, e.components...)
+}
+
+func (e *hybridSearchExecutor) run() ([][]byte, []QueryRequest, bool, error) {
+	if e.components == nil {
+		if e.statistics != nil && !e.statistics.done() {
+			return nil, e.statistics.requests(), false, nil
+		}
+
+		if err := e.startComponents(); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	var requests []QueryRequest
+	for _, set := range e.components {
+		if !set.done() {
+			requests = append(requests, set.requests()...)
+		}
+	}
+	if len(requests) > 0 {
+		return nil, requests, false, nil
+	}
+
+	items, err := e.combine()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return items, nil, true, nil
+}
+
+// startComponents creates the component queries, with the global statistics.
+func (e *hybridSearchExecutor) startComponents() error {
+	var stats globalStatistics
+	if e.statistics != nil {
+		for _, p := range e.statistics.partitions {
+			for len(p.queue) > 0 {
+				var partial globalStatistics
+				if err := json.Unmarshal(p.pop().raw, &partial); err != nil {
+					return fmt.Errorf("failed to unmarshal hybrid search statistics: %w", err)
+				}
+				stats.add(partial)
+			}
+		}
+	}
+
+	// the partitions of the statistics query may have been split, so the components read from the same ranges.
+	ranges := e.ranges
+	if e.statistics != nil {
+		ranges = ranges[:0:0]
+		for _, p := range e.statistics.partitions {
+			ranges = append(ranges, p.partitionKeyRange)
+		}
+	}
+
+	for i := range e.info.ComponentQueryInfos {
+		query := stats.format(e.info.ComponentQueryInfos[i].partitionQuery())
+		e.components = append(e.components, newPartitionSet(e.tracker, ranges, query, true, parseOrderByDocument))
+	}
+	return nil
+}
+
+func (s *globalStatistics) add(partial globalStatistics) {
+	s.DocumentCount += partial.DocumentCount
+	for i, fts := range partial.FullTextStatistics {
+		if i == len(s.FullTextStatistics) {
+			s.FullTextStatistics = append(s.FullTextStatistics, fts)
+			s.FullTextStatistics[i].HitCounts = slices.Clone(fts.HitCounts)
+			continue
+		}
+
+		total := &s.FullTextStatistics[i]
+		total.TotalWordCount += fts.TotalWordCount
+		for j, hits := range fts.HitCounts {
+			if j == len(total.HitCounts) {
+				total.HitCounts = append(total.HitCounts, hits)
+			} else {
+				total.HitCounts[j] += hits
+			}
+		}
+	}
+}
+
+// format replaces the placeholders for the global statistics in a component query.
+func (s *globalStatistics) format(query string) string {
+	query = strings.ReplaceAll(query, totalDocumentCountPlaceholder, strconv.FormatInt(s.DocumentCount, 10))
+
+	for i, fts := range s.FullTextStatistics {
+		hitCounts := make([]string, len(fts.HitCounts))
+		for j, hits := range fts.HitCounts {
+			hitCounts[j] = strconv.FormatInt(hits, 10)
+		}
+
+		query = strings.ReplaceAll(query, fmt.Sprintf(totalWordCountPlaceholder, i), strconv.FormatInt(fts.TotalWordCount, 10))
+		query = strings.ReplaceAll(query, fmt.Sprintf(hitCountsArrayPlaceholder, i), "["+strings.Join(hitCounts, ",")+"]")
+	}
+	return query
+}
+
+// hybridSearchResult is a document returned by a component query. Its payload is
+// {"payload": ..., "componentScores": [...]}, with the scores of the document for every component.
+type hybridSearchResult struct {
+	payload         json.RawMessage
+	componentScores []float64
+	score           float64
+}
+
+// combine combines the results of the component queries, and applies the query's skip and take.
+func (e *hybridSearchExecutor) combine() ([][]byte, error) {
+	var results []*hybridSearchResult
+	seen := map[string]bool{}
+
+	for _, set := range e.components {
+		var docs []*document
+		for _, p := range set.partitions {
+			for len(p.queue) > 0 {
+				docs = append(docs, p.pop())
+			}
+		}
+
+		if len(e.components) == 1 {
+			slices.SortStableFunc(docs, func(a, b *document) int {
+				return compareOrderBy(a, b, e.info.ComponentQueryInfos[0].OrderBy)
+			})
+		}
+
+		for _, doc := range docs {
+			// a document is returned by every component that matches it.
+			if doc.rid != "" {
+				if seen[doc.rid] {
+					continue
+				}
+				seen[doc.rid] = true
+			}
+
+			var payload struct {
+				Payload         json.RawMessage `json:"payload"`
+				ComponentScores []float64       `json:"componentScores"`
+			}
+			if err := json.Unmarshal(doc.payload, &payload); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal hybrid search result: %w", err)
+			}
+			results = append(results, &hybridSearchResult{payload: payload.Payload, componentScores: payload.ComponentScores})
+		}
+	}
+
+	if len(e.components) > 1 {
+		e.fuse(results)
+	}
+
+	if e.info.Skip != nil {
+		results = results[min(uint64(len(results)), *e.info.Skip):]
+	}
+	if e.info.Take != nil && uint64(len(results)) > *e.info.Take {
+		results = results[:*e.info.Take]
+	}
+
+	var items [][]byte
+	for _, r := range results {
+		if r.payload != nil {
+			items = append(items, r.payload)
+		}
+	}
+	return items, nil
+}
+
+// fuse sorts the results by their reciprocal rank fusion scores: the sum, for each component, of the component's
+// weight / (60 + the result's rank by the component's score). A negative weight reverses the component's ranking.
+func (e *hybridSearchExecutor) fuse(results []*hybridSearchResult) {
+	ranked := slices.Clone(results)
+
+	for i, info := range e.info.ComponentQueryInfos {
+		weight := 1.0
+		if i < len(e.info.ComponentWeights) {
+			weight = e.info.ComponentWeights[i]
+		}
+
+		descending := len(info.OrderBy) == 0 || info.OrderBy[0] == "Descending"
+		if weight < 0 {
+			descending = !descending
+		}
+
+		score := func(r *hybridSearchResult) float64 {
+			if i < len(r.componentScores) {
+				return r.componentScores[i]
+			}
+			return math.Inf(-1)
+		}
+
+		slices.SortStableFunc(ranked, func(a, b *hybridSearchResult) int {
+			if descending {
+				return cmp.Compare(score(b), score(a))
+			}
+			return cmp.Compare(score(a), score(b))
+		})
+
+		// results with the same score have the same rank.
+		rank := 1
+		for j, r := range ranked {
+			if j > 0 && score(r) != score(ranked[j-1]) {
+				rank = j + 1
+			}
+			r.score += math.Abs(weight) / float64(rrfRankConstant+rank)
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b *hybridSearchResult) int {
+		return cmp.Compare(b.score, a.score)
+	})
+}
@@ -0,0 +1,264 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// document is a document returned by a partition.
+type document struct {
+	raw json.RawMessage
+
+	// for ORDER BY queries, the partitions return {"_rid": ..., "orderByItems": [{"item": ...}], "payload": ...}.
+	rid     string
+	orderBy []any
+	payload json.RawMessage
+}
+
+// parseDocument is for documents that are returned as they are, without ORDER BY values.
+func parseDocument(raw json.RawMessage) (*document, error) {
+	return &document{raw: raw, payload: raw}, nil
+}
+
+func parseOrderByDocument(raw json.RawMessage) (*document, error) {
+	var d struct {
+		RID          string                       `json:"_rid"`
+		OrderByItems []map[string]json.RawMessage `json:"orderByItems"`
+		Payload      json.RawMessage              `json:"payload"`
+	}
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ORDER BY result: %w", err)
+	}
+
+	doc := &document{raw: raw, rid: d.RID, payload: d.Payload}
+	for _, item := range d.OrderByItems {
+		// the item is missing when the ORDER BY value is undefined.
+		v, err := decodeValue(item["item"])
+		if err != nil {
+			return nil, err
+		}
+		doc.orderBy = append(doc.orderBy, v)
+	}
+	return doc, nil
+}
+
+// compareOrderBy compares the ORDER BY values of two documents. directions are the query's ORDER BY directions,
+// "Ascending" or "Descending".
+func compareOrderBy(a, b *document, directions []string) int {
+	for i, direction := range directions {
+		var x, y any = undefined, undefined
+		if i < len(a.orderBy) {
+			x = a.orderBy[i]
+		}
+		if i < len(b.orderBy) {
+			y = b.orderBy[i]
+		}
+
+		c := compareValues(x, y)
+		if direction == "Descending" {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// requestTracker assigns IDs to the requests of a pipeline, and routes results to the partition that requested them.
+// IDs are unique across the pipeline, so the same partition key range can be read by different queries at once.
+type requestTracker struct {
+	lastID  uint64
+	pending map[uint64]*partition
+}
+
+func newRequestTracker() *requestTracker {
+	return &requestTracker{pending: map[uint64]*partition{}}
+}
+
+// provideData adds the results to the partitions that requested them.
+func (t *requestTracker) provideData(data []QueryResult) error {
+	var received []*partition
+	for _, result := range data {
+		p := t.pending[result.RequestId]
+		if p == nil || p.ID != result.PartitionKeyRangeID {
+			return fmt.Errorf("received data for request %d for partition key range %q, which wasn't requested", result.RequestId, result.PartitionKeyRangeID)
+		}
+		if err := p.provideData(result); err != nil {
+			return err
+		}
+		received = append(received, p)
+	}
+
+	// the pages of a draining request share its ID, so requests are completed once all the data is added.
+	for _, p := range received {
+		delete(t.pending, p.requestID)
+		p.pending = false
+	}
+	return nil
+}
+
+// partition is the state of a partition key range that a query reads from.
+type partition struct {
+	partitionKeyRange
+	set *partitionSet
+
+	started      bool
+	continuation string
+	queue        []*document
+
+	pending   bool
+	requestID uint64
+}
+
+// done is true if all the partition's results were received.
+func (p *partition) done() bool {
+	return p.started && p.continuation == ""
+}
+
+// exhausted is true if all the partition's results were received and consumed.
+func (p *partition) exhausted() bool {
+	return p.done() && len(p.queue) == 0
+}
+
+func (p *partition) provideData(result QueryResult) error {
+	var page struct {
+		Documents []json.RawMessage `json:"Documents"`
+	}
+	if err := json.Unmarshal(result.Data, &page); err != nil {
+		return fmt.Errorf("failed to unmarshal results for partition key range %q: %w", p.ID, err)
+	}
+
+	for _, raw := range page.Documents {
+		doc, err := p.set.parse(raw)
+		if err != nil {
+			return err
+		}
+		p.queue = append(p.queue, doc)
+	}
+
+	p.started = true
+	p.continuation = result.NextContinuation
+	return nil
+}
+
+func (p *partition) pop() *document {
+	doc := p.queue[0]
+	p.queue[0] = nil
+	p.queue = p.queue[1:]
+	return doc
+}
+
+// partitionSet is the partitions that a query reads from, ordered by their effective partition key ranges.
+type partitionSet struct {
+	// query is the query to run against each partition, or "" for the original query.
+	query string
+	// drain is true if each partition's results are read all at once.
+	drain bool
+	parse func(json.RawMessage) (*document, error)
+
+	tracker    *requestTracker
+	partitions []*partition
+}
+
+func newPartitionSet(tracker *requestTracker, ranges []partitionKeyRange, query string, drain bool, parse func(json.RawMessage) (*document, error)) *partitionSet {
+	s := &partitionSet{query: query, drain: drain, parse: parse, tracker: tracker}
+	for _, r := range ranges {
+		s.partitions = append(s.partitions, &partition{partitionKeyRange: r, set: s})
+	}
+	return s
+}
+
+// request returns the request for the partition's next page of results. The request is the same, with the same ID,
+// until its results are provided.
+func (s *partitionSet) request(p *partition) QueryRequest {
+	if !p.pending {
+		s.tracker.lastID++
+		p.requestID = s.tracker.lastID
+		p.pending = true
+		s.tracker.pending[p.requestID] = p
+	}
+
+	return QueryRequest{
+		PartitionKeyRangeID: p.ID,
+		Id:                  p.requestID,
+		Continuation:        p.continuation,
+		Query:               s.query,
+		IncludeParameters:   true,
+		Drain:               s.drain,
+	}
+}
+
+// requests returns requests for the partitions that have no results to consume, and more results to read.
+func (s *partitionSet) requests() []QueryRequest {
+	var requests []QueryRequest
+	for _, p := range s.partitions {
+		if len(p.queue) == 0 && !p.done() {
+			requests = append(requests, s.request(p))
+		}
+	}
+	return requests
+}
+
+// done is true if all the results of all the partitions were received.
+func (s *partitionSet) done() bool {
+	for _, p := range s.partitions {
+		if !p.done() {
+			return false
+		}
+	}
+	return true
+}
+
+// updateRanges replaces the partitions whose partition key ranges are gone, after a split, with the ranges that
+// replaced them. Each new range continues from the old range's continuation token, and the first one also gets the
+// results that weren't consumed yet, so the results are still in order.
+//
+// Merges can't be handled: the merged range would return results that were already read from the other range.
+func (s *partitionSet) updateRanges(ranges []partitionKeyRange) error {
+	current := map[string]bool{}
+	for _, r := range ranges {
+		current[r.ID] = true
+	}
+
+	var updated []*partition
+	for _, p := range s.partitions {
+		if current[p.ID] || p.done() {
+			updated = append(updated, p)
+			continue
+		}
+
+		var children []*partition
+		for _, r := range ranges {
+			if r.MinInclusive >= p.MaxExclusive || r.MaxExclusive <= p.MinInclusive {
+				continue
+			}
+			if r.MinInclusive < p.MinInclusive || r.MaxExclusive > p.MaxExclusive {
+				return fmt.Errorf("partition key range %q was merged into partition key range %q, which isn't supported", p.ID, r.ID)
+			}
+			children = append(children, &partition{
+				partitionKeyRange: r,
+				set:               s,
+				started:           p.started,
+				continuation:      p.continuation,
+			})
+		}
+
+		if len(children) == 0 {
+			return fmt.Errorf("no partition key range replaces partition key range %q", p.ID)
+		}
+
+		children[0].queue = p.queue
+
+		if p.pending {
+			delete(s.tracker.pending, p.requestID)
+		}
+		updated = append(updated, children...)
+	}
+
+	s.partitions = updated
+	return nil
+}
@@ -0,0 +1,451 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// pipeline is the QueryPipeline of the engine returned by NewQueryEngine.
+type pipeline struct {
+	query     string
+	tracker   *requestTracker
+	exec      executor
+	completed bool
+}
+
+// executor runs a query against the partitions, and combines their results.
+type executor interface {
+	// run returns the results that are available, and the requests for the data needed for more results.
+	// done is true when there are no more results.
+	run() (items [][]byte, requests []QueryRequest, done bool, err error)
+
+	// partitionSets returns the partitions the executor reads from, to update them when partitions are split.
+	partitionSets() []*partitionSet
+}
+
+func newPipeline(query string, plan *queryPlan, ranges []partitionKeyRange) (*pipeline, error) {
+	p := &pipeline{query: query, tracker: newRequestTracker()}
+	ranges = targetRanges(ranges, plan.QueryRanges)
+
+	if plan.HybridSearchQueryInfo != nil {
+		p.exec = newHybridSearchExecutor(p.tracker, plan.HybridSearchQueryInfo, ranges)
+		return p, nil
+	}
+
+	info := plan.QueryInfo
+	if rewritten := info.partitionQuery(); rewritten != "" {
+		p.query = rewritten
+	}
+
+	parse := parseDocument
+	if len(info.OrderBy) > 0 {
+		parse = parseOrderByDocument
+	}
+
+	filter := newResultFilter(info.DistinctType, info.Offset, minLimit(info.Limit, info.Top))
+
+	if info.streaming() {
+		p.exec = &streamingExecutor{
+			set:     newPartitionSet(p.tracker, ranges, info.partitionQuery(), false, parse),
+			orderBy: info.OrderBy,
+			filter:  filter,
+		}
+		return p, nil
+	}
+
+	e := &drainingExecutor{
+		set:    newPartitionSet(p.tracker, ranges, info.partitionQuery(), true, parse),
+		info:   info,
+		filter: filter,
+	}
+
+	if info.hasAggregates() || info.hasGroupBy() {
+		// validate the aggregates before reading any data.
+		if _, err := newGroupAggregator(info); err != nil {
+			return nil, err
+		}
+	}
+	p.exec = e
+	return p, nil
+}
+
+// Query returns the query to run against each partition.
+func (p *pipeline) Query() string {
+	return p.query
+}
+
+// IsComplete returns true when all the results have been returned.
+func (p *pipeline) IsComplete() bool {
+	return p.completed
+}
+
+// Run returns the results that are available, or the requests for the data needed for more results.
+func (p *pipeline) Run() (*PipelineResult, error) {
+	if p.completed {
+		return &PipelineResult{IsCompleted: true}, nil
+	}
+
+	items, requests, done, err := p.exec.run()
+	if err != nil {
+		return nil, err
+	}
+
+	p.completed = done
+	return &PipelineResult{IsCompleted: done, Items: items, Requests: requests}, nil
+}
+
+// ProvideData adds the results of the pipeline's requests.
+func (p *pipeline) ProvideData(data []QueryResult) error {
+	return p.tracker.provideData(data)
+}
+
+// UpdatePartitionKeyRanges replaces the partition key ranges that were split.
+func (p *pipeline) UpdatePartitionKeyRanges(pkranges string) error {
+	ranges, err := parsePartitionKeyRanges(pkranges)
+	if err != nil {
+		return err
+	}
+
+	for _, set := range p.exec.partitionSets() {
+		if err := set.updateRanges(ranges); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close frees the resources of the pipeline. The pipeline doesn't hold any resources outside of Go.
+func (p *pipeline) Close() {}
+
+// resultFilter applies DISTINCT, OFFSET and LIMIT (or TOP) to the results, in that order.
+type resultFilter struct {
+	distinctType string
+	seen         map[string]bool
+	last         *string
+
+	skip uint64
+	take *uint64
+}
+
+func newResultFilter(distinctType string, offset *uint64, take *uint64) *resultFilter {
+	f := &resultFilter{distinctType: distinctType}
+	if offset != nil {
+		f.skip = *offset
+	}
+	if take != nil {
+		t := *take
+		f.take = &t
+	}
+	return f
+}
+
+// accept returns true if the item is in the results.
+func (f *resultFilter) accept(item json.RawMessage) (bool, error) {
+	if f.full() {
+		return false, nil
+	}
+
+	if f.distinctType != "" && f.distinctType != "None" {
+		v, err := decodeValue(item)
+		if err != nil {
+			return false, err
+		}
+		key := canonicalKey(v)
+
+		if f.distinctType == "Ordered" {
+			// duplicates are next to each other, so only the last item is compared.
+			if f.last != nil && *f.last == key {
+				return false, nil
+			}
+			f.last = &key
+		} else {
+			if f.seen == nil {
+				f.seen = map[string]bool{}
+			}
+			if f.seen[key] {
+				return false, nil
+			}
+			f.seen[key] = true
+		}
+	}
+
+	if f.skip > 0 {
+		f.skip--
+		return false, nil
+	}
+
+	if f.take != nil {
+		*f.take--
+	}
+	return true, nil
+}
+
+// full is true when the LIMIT, or TOP, has been reached.
+func (f *resultFilter) full() bool {
+	return f.take != nil && *f.take == 0
+}
+
+func minLimit(a, b *uint64) *uint64 {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case *a < *b:
+		return a
+	default:
+		return b
+	}
+}
+
+// streamingExecutor returns results as they're read. Without ORDER BY, the results of each partition are returned
+// in the order of the partitions. With ORDER BY, the sorted results of the partitions are merged.
+type streamingExecutor struct {
+	set     *partitionSet
+	orderBy []string
+	filter  *resultFilter
+}
+
+func (e *streamingExecutor) partitionSets() []*partitionSet {
+	return []*partitionSet{e.set}
+}
+
+func (e *streamingExecutor) run() ([][]byte, []QueryRequest, bool, error) {
+	var items [][]byte
+
+	for !e.filter.full() {
+		doc, needData := e.next()
+		if doc == nil {
+			if !needData {
+				return items, nil, true, nil
+			}
+			return items, e.set.requests(), false, nil
+		}
+
+		// an undefined payload, such as for SELECT VALUE of a missing property, isn't in the results.
+		if doc.payload == nil {
+			continue
+		}
+
+		ok, err := e.filter.accept(doc.payload)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if ok {
+			items = append(items, doc.payload)
+		}
+	}
+
+	return items, nil, true, nil
+}
+
+// next returns the next document. If it returns nil, needData is true when more data is needed from the partitions,
+// or false when there are no more documents.
+func (e *streamingExecutor) next() (doc *document, needData bool) {
+	if len(e.orderBy) == 0 {
+		for _, p := range e.set.partitions {
+			if len(p.queue) > 0 {
+				return p.pop(), false
+			}
+			if !p.done() {
+				return nil, true
+			}
+		}
+		return nil, false
+	}
+
+	// the next document is the first one, in ORDER BY order, of the partitions' next documents. Equal documents
+	// are returned in the order of the partitions.
+	var next *partition
+	for _, p := range e.set.partitions {
+		if len(p.queue) == 0 {
+			if !p.done() {
+				return nil, true
+			}
+			continue
+		}
+		if next == nil || compareOrderBy(p.queue[0], next.queue[0], e.orderBy) < 0 {
+			next = p
+		}
+	}
+
+	if next == nil {
+		return nil, false
+	}
+	return next.pop(), false
+}
+
+// drainingExecutor reads all the results of all the partitions before combining them, for aggregates, GROUP BY,
+// non-streaming ORDER BY (such as for vector search) and DISTINCT counts.
+type drainingExecutor struct {
+	set    *partitionSet
+	info   *queryInfo
+	filter *resultFilter
+}
+
+func (e *drainingExecutor) partitionSets() []*partitionSet {
+	return []*partitionSet{e.set}
+}
+
+func (e *drainingExecutor) run() ([][]byte, []QueryRequest, bool, error) {
+	if !e.set.done() {
+		return nil, e.set.requests(), false, nil
+	}
+
+	results, err := e.combine()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	var items [][]byte
+	for _, item := range results {
+		ok, err := e.filter.accept(item)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if ok {
+			items = append(items, item)
+		}
+	}
+
+	if e.info.DCountInfo != nil {
+		count, err := dCountResult(e.info.DCountInfo, len(items))
+		if err != nil {
+			return nil, nil, false, err
+		}
+		items = [][]byte{count}
+	}
+
+	return items, nil, true, nil
+}
+
+// combine combines the results of all the partitions, before DISTINCT, OFFSET and LIMIT are applied.
+func (e *drainingExecutor) combine() ([][]byte, error) {
+	var docs []*document
+	for _, p := range e.set.partitions {
+		for len(p.queue) > 0 {
+			docs = append(docs, p.pop())
+		}
+	}
+
+	switch {
+	case e.info.hasGroupBy():
+		return combineGroups(e.info, docs)
+	case e.info.hasAggregates():
+		g, err := newGroupAggregator(e.info)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, doc := range docs {
+			// SELECT VALUE aggregates are returned as they are, other aggregates are in the document's payload.
+			raw := doc.raw
+			if !e.info.HasSelectValue {
+				raw, err = property(doc.raw, "payload")
+				if err != nil {
+					return nil, err
+				}
+			}
+			if err := addToGroup(g, raw); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := g.result()
+		if err != nil || result == nil {
+			return nil, err
+		}
+		return [][]byte{result}, nil
+	case len(e.info.OrderBy) > 0:
+		// the sort is stable, so equal documents are in the order of the partitions.
+		slices.SortStableFunc(docs, func(a, b *document) int {
+			return compareOrderBy(a, b, e.info.OrderBy)
+		})
+	}
+
+	var results [][]byte
+	for _, doc := range docs {
+		if doc.payload != nil {
+			results = append(results, doc.payload)
+		}
+	}
+	return results, nil
+}
+
+// combineGroups aggregates the partitions' rows for each group. The partitions return
+// {"groupByItems": [...], "payload": ...} for each group.
+func combineGroups(info *queryInfo, docs []*document) ([][]byte, error) {
+	groups := map[string]*groupAggregator{}
+	var order []*groupAggregator
+
+	for _, doc := range docs {
+		var row struct {
+			GroupByItems json.RawMessage `json:"groupByItems"`
+			Payload      json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(doc.raw, &row); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal GROUP BY result: %w", err)
+		}
+
+		keyValue, err := decodeValue(row.GroupByItems)
+		if err != nil {
+			return nil, err
+		}
+		key := canonicalKey(keyValue)
+
+		g := groups[key]
+		if g == nil {
+			if g, err = newGroupAggregator(info); err != nil {
+				return nil, err
+			}
+			groups[key] = g
+			order = append(order, g)
+		}
+
+		if err := addToGroup(g, row.Payload); err != nil {
+			return nil, err
+		}
+	}
+
+	var results [][]byte
+	for _, g := range order {
+		result, err := g.result()
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func addToGroup(g *groupAggregator, raw json.RawMessage) error {
+	payload, err := decodeValue(raw)
+	if err != nil {
+		return err
+	}
+	return g.add(payload)
+}
+
+// property returns a property of a JSON object, or nil if it's missing.
+func property(raw json.RawMessage, name string) (json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("expected an object: %w", err)
+	}
+	return obj[name], nil
+}
+
+// dCountResult is the result of a COUNT(DISTINCT ...) query: the count, or an object with the count when the query
+// doesn't use SELECT VALUE.
+func dCountResult(info *dCountInfo, count int) ([]byte, error) {
+	if info.DCountAlias == "" {
+		return json.Marshal(count)
+	}
+	return json.Marshal(map[string]int{info.DCountAlias: count})
+}
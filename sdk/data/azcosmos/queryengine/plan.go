@@ -0,0 +1,147 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// orderByFilterPlaceholder is replaced in the rewritten ORDER BY queries with a filter on the ORDER BY values, when
+// resuming a query. Continuation tokens are tracked per partition by this engine, so the filter is always true.
+const orderByFilterPlaceholder = "{documentdb-formattableorderbyquery-filter}"
+
+// queryPlan is the query plan the gateway returns for a query.
+type queryPlan struct {
+	QueryInfo             *queryInfo             `json:"queryInfo"`
+	QueryRanges           []queryRange           `json:"queryRanges"`
+	HybridSearchQueryInfo *hybridSearchQueryInfo `json:"hybridSearchQueryInfo"`
+}
+
+// queryInfo describes how the results of the query, from each partition, are combined.
+type queryInfo struct {
+	DistinctType                string             `json:"distinctType"`
+	Top                         *uint64            `json:"top"`
+	Offset                      *uint64            `json:"offset"`
+	Limit                       *uint64            `json:"limit"`
+	OrderBy                     []string           `json:"orderBy"`
+	GroupByExpressions          []string           `json:"groupByExpressions"`
+	GroupByAliases              []string           `json:"groupByAliases"`
+	Aggregates                  []string           `json:"aggregates"`
+	GroupByAliasToAggregateType map[string]*string `json:"groupByAliasToAggregateType"`
+	RewrittenQuery              string             `json:"rewrittenQuery"`
+	HasSelectValue              bool               `json:"hasSelectValue"`
+	DCountInfo                  *dCountInfo        `json:"dCountInfo"`
+	HasNonStreamingOrderBy      bool               `json:"hasNonStreamingOrderBy"`
+}
+
+type dCountInfo struct {
+	DCountAlias string `json:"dCountAlias"`
+}
+
+// queryRange is a range of effective partition key values the query reads from.
+type queryRange struct {
+	Min            string `json:"min"`
+	Max            string `json:"max"`
+	IsMinInclusive bool   `json:"isMinInclusive"`
+	IsMaxInclusive bool   `json:"isMaxInclusive"`
+}
+
+// hybridSearchQueryInfo describes a hybrid search query: the component queries whose results are combined with
+// reciprocal rank fusion.
+type hybridSearchQueryInfo struct {
+	GlobalStatisticsQuery    string      `json:"globalStatisticsQuery"`
+	ComponentQueryInfos      []queryInfo `json:"componentQueryInfos"`
+	ComponentWeights         []float64   `json:"componentWeights"`
+	Skip                     *uint64     `json:"skip"`
+	Take                     *uint64     `json:"take"`
+	RequiresGlobalStatistics bool        `json:"requiresGlobalStatistics"`
+}
+
+func (qi *queryInfo) hasAggregates() bool {
+	return len(qi.Aggregates) > 0 || len(qi.GroupByAliasToAggregateType) > 0
+}
+
+func (qi *queryInfo) hasGroupBy() bool {
+	return len(qi.GroupByExpressions) > 0
+}
+
+func (qi *queryInfo) hasDistinct() bool {
+	return qi.DistinctType != "" && qi.DistinctType != "None"
+}
+
+// streaming is true if results can be returned before all the partitions have been read.
+func (qi *queryInfo) streaming() bool {
+	return !qi.hasAggregates() && !qi.hasGroupBy() && !qi.HasNonStreamingOrderBy && qi.DCountInfo == nil
+}
+
+// partitionQuery returns the query to run against each partition, or "" to run the original query.
+func (qi *queryInfo) partitionQuery() string {
+	return strings.ReplaceAll(qi.RewrittenQuery, orderByFilterPlaceholder, "true")
+}
+
+func parseQueryPlan(plan string) (*queryPlan, error) {
+	var qp queryPlan
+	if err := json.Unmarshal([]byte(plan), &qp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal query plan: %w", err)
+	}
+
+	if qp.QueryInfo == nil && qp.HybridSearchQueryInfo == nil {
+		qp.QueryInfo = &queryInfo{}
+	}
+	return &qp, nil
+}
+
+// partitionKeyRange is a physical partition's range of effective partition key values.
+type partitionKeyRange struct {
+	ID           string `json:"id"`
+	MinInclusive string `json:"minInclusive"`
+	MaxExclusive string `json:"maxExclusive"`
+}
+
+// parsePartitionKeyRanges parses the partition key ranges of a container, and sorts them by their effective
+// partition key values.
+func parsePartitionKeyRanges(pkranges string) ([]partitionKeyRange, error) {
+	var feed struct {
+		PartitionKeyRanges []partitionKeyRange `json:"PartitionKeyRanges"`
+	}
+	if err := json.Unmarshal([]byte(pkranges), &feed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal partition key ranges: %w", err)
+	}
+
+	slices.SortFunc(feed.PartitionKeyRanges, func(a, b partitionKeyRange) int {
+		return strings.Compare(a.MinInclusive, b.MinInclusive)
+	})
+	return feed.PartitionKeyRanges, nil
+}
+
+// targetRanges returns the partition key ranges that overlap the ranges the query reads from.
+func targetRanges(ranges []partitionKeyRange, queryRanges []queryRange) []partitionKeyRange {
+	if len(queryRanges) == 0 {
+		return ranges
+	}
+
+	var targets []partitionKeyRange
+	for _, r := range ranges {
+		for _, qr := range queryRanges {
+			if qr.overlaps(r) {
+				targets = append(targets, r)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+func (qr queryRange) overlaps(r partitionKeyRange) bool {
+	if qr.Min >= r.MaxExclusive {
+		return false
+	}
+	if qr.IsMaxInclusive {
+		return r.MinInclusive <= qr.Max
+	}
+	return r.MinInclusive < qr.Max
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package queryengine
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// undefinedValue is a value that's missing from a query result, such as a property that doesn't exist on an item.
+// Unlike null, undefined values are omitted from the results.
+type undefinedValue struct{}
+
+var undefined = undefinedValue{}
+
+// decodeValue decodes a JSON value, keeping numbers as json.Number. Empty data decodes to undefined.
+func decodeValue(data json.RawMessage) (any, error) {
+	if len(data) == 0 {
+		return undefined, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// typeOrder is the order of the types of values, when values of different types are compared.
+func typeOrder(v any) int {
+	switch v.(type) {
+	case undefinedValue:
+		return 0
+	case nil:
+		return 1
+	case bool:
+		return 2
+	case json.Number, float64:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// compareValues compares values the way Azure Cosmos DB orders them: undefined, then null, booleans, numbers, strings,
+// arrays and objects. Values of the same type are compared by value.
+func compareValues(a, b any) int {
+	if c := cmp.Compare(typeOrder(a), typeOrder(b)); c != 0 {
+		return c
+	}
+
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case json.Number, float64:
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		return cmp.Compare(fa, fb)
+	case string:
+		return strings.Compare(x, b.(string))
+	case []any:
+		y := b.([]any)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareValues(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(len(x), len(y))
+	case map[string]any:
+		return strings.Compare(canonicalKey(a), canonicalKey(b))
+	}
+	return 0
+}
+
+// canonicalKey returns a string that's the same for equal values, regardless of the order of the properties of
+// objects or how numbers are written. It's used to find duplicates for DISTINCT, and the groups for GROUP BY.
+func canonicalKey(v any) string {
+	sb := &strings.Builder{}
+	writeCanonical(sb, v)
+	return sb.String()
+}
+
+func writeCanonical(sb *strings.Builder, v any) {
+	switch x := v.(type) {
+	case undefinedValue:
+		sb.WriteString("undefined")
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		sb.WriteString(strconv.FormatBool(x))
+	case json.Number, float64:
+		f, _ := toFloat(v)
+		sb.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	case string:
+		sb.WriteString(strconv.Quote(x))
+	case []any:
+		sb.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeCanonical(sb, item)
+		}
+		sb.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		sb.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.Quote(k))
+			sb.WriteByte(':')
+			writeCanonical(sb, x[k])
+		}
+		sb.WriteByte('}')
+	}
+}
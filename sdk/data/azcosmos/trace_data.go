@@ -128,6 +128,7 @@ type clientSideRequestStatisticsTraceDatum struct {
 	httpResponseStatistics      []httpResponseStatistics
 	addressResolutionStatistics []addressResolutionStatistics
 	forceAddressRefreshes       []forceAddressRefresh
+	routingDecisions            []routingDecision
 }
 
 type clientSideRequestStatisticsSnapshot struct {
@@ -135,6 +136,7 @@ type clientSideRequestStatisticsSnapshot struct {
 	httpResponseStatistics      []httpResponseStatistics
 	addressResolutionStatistics []addressResolutionStatistics
 	forceAddressRefreshes       []forceAddressRefresh
+	routingDecisions            []routingDecision
 }
 
 type contactedRegion struct {
@@ -168,6 +170,24 @@ type forceAddressRefresh struct {
 	newValues       []string
 }
 
+const (
+	// routingReasonExcludedRegion is the reason of a region skipped because the request excludes it.
+	routingReasonExcludedRegion = "ExcludedRegion"
+	// routingReasonPartitionUnavailable is the reason of a region skipped because it's unavailable for the
+	// partition key range of the request.
+	routingReasonPartitionUnavailable = "PartitionUnavailable"
+	// routingReasonPartitionMarkedUnavailable is the reason of a region that became unavailable for the partition
+	// key range of the request after the failure of the request.
+	routingReasonPartitionMarkedUnavailable = "PartitionMarkedUnavailable"
+)
+
+// routingDecision records a region that a request wasn't routed to.
+type routingDecision struct {
+	region    string
+	reason    string
+	partition string
+}
+
 type pointOperationStatisticsTraceDatum struct {
 	ActivityID           string
 	ResponseTimeUTC      time.Time
@@ -190,6 +210,7 @@ func newClientSideRequestStatisticsTraceDatum(startTime time.Time, trace *trace)
 		httpResponseStatistics:      []httpResponseStatistics{},
 		addressResolutionStatistics: []addressResolutionStatistics{},
 		forceAddressRefreshes:       []forceAddressRefresh{},
+		routingDecisions:            []routingDecision{},
 	}
 }
 
@@ -272,13 +293,28 @@ func (d *clientSideRequestStatisticsTraceDatum) snapshot() clientSideRequestStat
 	httpResponseStatistics := append([]httpResponseStatistics(nil), d.httpResponseStatistics...)
 	addressResolutionStatistics := append([]addressResolutionStatistics(nil), d.addressResolutionStatistics...)
 	forceAddressRefreshes := append([]forceAddressRefresh(nil), d.forceAddressRefreshes...)
+	routingDecisions := append([]routingDecision(nil), d.routingDecisions...)
 
 	return clientSideRequestStatisticsSnapshot{
 		regionsContacted:            regionsContacted,
 		httpResponseStatistics:      httpResponseStatistics,
 		addressResolutionStatistics: addressResolutionStatistics,
 		forceAddressRefreshes:       forceAddressRefreshes,
+		routingDecisions:            routingDecisions,
+	}
+}
+
+// recordRoutingDecision records a routing decision, once per request.
+func (d *clientSideRequestStatisticsTraceDatum) recordRoutingDecision(decision routingDecision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, recorded := range d.routingDecisions {
+		if recorded == decision {
+			return
+		}
 	}
+	d.routingDecisions = append(d.routingDecisions, decision)
 }
 
 func (d *clientSideRequestStatisticsTraceDatum) updateRequestEndTime(endTime time.Time) {
@@ -333,6 +333,33 @@ func writeClientSideRequestStatistics(buffer *bytes.Buffer, snapshot clientSideR
 		})
 	}
 
+	if len(snapshot.routingDecisions) > 0 {
+		writeField("RoutingDecisions", func() {
+			buffer.WriteByte('[')
+			for index, decision := range snapshot.routingDecisions {
+				if index > 0 {
+					buffer.WriteByte(',')
+				}
+				buffer.WriteByte('{')
+				writeJSONString(buffer, "Region")
+				buffer.WriteByte(':')
+				writeJSONString(buffer, decision.region)
+				buffer.WriteByte(',')
+				writeJSONString(buffer, "Reason")
+				buffer.WriteByte(':')
+				writeJSONString(buffer, decision.reason)
+				if decision.partition != "" {
+					buffer.WriteByte(',')
+					writeJSONString(buffer, "Partition")
+					buffer.WriteByte(':')
+					writeJSONString(buffer, decision.partition)
+				}
+				buffer.WriteByte('}')
+			}
+			buffer.WriteByte(']')
+		})
+	}
+
 	writeField("AddressResolutionStatistics", func() {
 		buffer.WriteByte('[')
 		for index, stat := range snapshot.addressResolutionStatistics {
@@ -0,0 +1,30 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+// TriggerOperation defines the operations a trigger runs on in the Azure Cosmos DB service.
+type TriggerOperation string
+
+const (
+	// TriggerOperationAll runs the trigger on all operations.
+	TriggerOperationAll TriggerOperation = "All"
+	// TriggerOperationCreate runs the trigger on creates.
+	TriggerOperationCreate TriggerOperation = "Create"
+	// TriggerOperationReplace runs the trigger on replaces.
+	TriggerOperationReplace TriggerOperation = "Replace"
+	// TriggerOperationUpsert runs the trigger on upserts.
+	TriggerOperationUpsert TriggerOperation = "Upsert"
+	// TriggerOperationDelete runs the trigger on deletes.
+	TriggerOperationDelete TriggerOperation = "Delete"
+)
+
+// TriggerOperationValues returns a list of available trigger operations.
+func TriggerOperationValues() []TriggerOperation {
+	return []TriggerOperation{TriggerOperationAll, TriggerOperationCreate, TriggerOperationReplace, TriggerOperationUpsert, TriggerOperationDelete}
+}
+
+// ToPtr returns a *TriggerOperation
+func (t TriggerOperation) ToPtr() *TriggerOperation {
+	return &t
+}
@@ -0,0 +1,24 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azcosmos
+
+// TriggerType defines when a trigger runs in the Azure Cosmos DB service.
+type TriggerType string
+
+const (
+	// TriggerTypePre runs the trigger before the operation.
+	TriggerTypePre TriggerType = "Pre"
+	// TriggerTypePost runs the trigger after the operation.
+	TriggerTypePost TriggerType = "Post"
+)
+
+// TriggerTypeValues returns a list of available trigger types.
+func TriggerTypeValues() []TriggerType {
+	return []TriggerType{TriggerTypePre, TriggerTypePost}
+}
+
+// ToPtr returns a *TriggerType
+func (t TriggerType) ToPtr() *TriggerType {
+	return &t
+}
@@ -0,0 +1,310 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aztables
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const (
+	// maxTransactionActions is the maximum number of actions in a transaction.
+	maxTransactionActions = 100
+
+	defaultBulkConcurrency   = 8
+	defaultBulkMaxRetries    = 5
+	defaultBulkRetryDelay    = time.Second
+	defaultBulkMaxRetryDelay = 30 * time.Second
+)
+
+// SubmitBulk submits any number of TransactionActions, for entities with any PartitionKey. The actions are grouped
+// by PartitionKey into transactions of at most 100 actions, which are submitted concurrently. The actions for the same
+// entity are submitted in order, in separate transactions.
+//
+// A throttled transaction is retried with backoff, see SubmitBulkOptions.MaxRetries. When a transaction fails because
+// of one of its actions, that action fails and the other actions are submitted again, so that they're still
+// committed. The outcome of each action is reported in SubmitBulkResponse.Results, and SubmitBulk returns an error
+// only when it can't submit the actions.
+func (t *Client) SubmitBulk(ctx context.Context, transactionActions []TransactionAction, options *SubmitBulkOptions) (SubmitBulkResponse, error) {
+	var err error
+	ctx, endSpan := runtime.StartSpan(ctx, "Client.SubmitBulk", t.client.Tracer(), nil)
+	defer func() { endSpan(err) }()
+
+	writer := newBulkWriter(func(ctx context.Context, actions []TransactionAction) error {
+		_, err := t.submitTransaction(ctx, actions, nil)
+		return err
+	}, options)
+	resp := writer.write(ctx, transactionActions)
+	err = ctx.Err()
+	return resp, err
+}
+
+// bulkWriter submits the transactions of SubmitBulk.
+type bulkWriter struct {
+	submit        func(ctx context.Context, actions []TransactionAction) error
+	concurrency   int
+	maxRetries    int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	actions []TransactionAction
+	results []BulkActionResult
+
+	mu      sync.Mutex
+	queue   chan *bulkBatch
+	pending int
+}
+
+// bulkPartition holds the transactions of a PartitionKey. The n-th action for an entity is in the n-th generation of
+// transactions, and a generation is submitted after the previous one completed.
+type bulkPartition struct {
+	generations [][]*bulkBatch
+	current     int
+	remaining   int
+}
+
+// bulkBatch is a transaction, as the indexes of its actions.
+type bulkBatch struct {
+	partition *bulkPartition
+	indexes   []int
+}
+
+func newBulkWriter(submit func(ctx context.Context, actions []TransactionAction) error, options *SubmitBulkOptions) *bulkWriter {
+	if options == nil {
+		options = &SubmitBulkOptions{}
+	}
+	w := &bulkWriter{
+		submit:        submit,
+		concurrency:   options.Concurrency,
+		maxRetries:    int(options.MaxRetries),
+		retryDelay:    options.RetryDelay,
+		maxRetryDelay: options.MaxRetryDelay,
+	}
+	if w.concurrency <= 0 {
+		w.concurrency = defaultBulkConcurrency
+	}
+	if w.maxRetries == 0 {
+		w.maxRetries = defaultBulkMaxRetries
+	} else if w.maxRetries < 0 {
+		w.maxRetries = 0
+	}
+	if w.retryDelay <= 0 {
+		w.retryDelay = defaultBulkRetryDelay
+	}
+	if w.maxRetryDelay <= 0 {
+		w.maxRetryDelay = defaultBulkMaxRetryDelay
+	}
+	if w.maxRetryDelay < w.retryDelay {
+		w.maxRetryDelay = w.retryDelay
+	}
+	return w
+}
+
+// write submits the actions and returns their outcomes.
+func (w *bulkWriter) write(ctx context.Context, actions []TransactionAction) SubmitBulkResponse {
+	w.actions = actions
+	w.results = make([]BulkActionResult, len(actions))
+	partitions := w.group()
+
+	total := 0
+	for _, p := range partitions {
+		for _, generation := range p.generations {
+			total += len(generation)
+		}
+	}
+	if total == 0 {
+		return SubmitBulkResponse{Results: w.results}
+	}
+
+	w.queue = make(chan *bulkBatch, total)
+	w.pending = total
+	for _, p := range partitions {
+		w.enqueue(p)
+	}
+
+	var wg sync.WaitGroup
+	for range min(w.concurrency, total) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range w.queue {
+				w.writeBatch(ctx, batch.indexes)
+				w.complete(batch)
+			}
+		}()
+	}
+	wg.Wait()
+	return SubmitBulkResponse{Results: w.results}
+}
+
+// group groups the actions into transactions. The actions without a PartitionKey and RowKey fail without being
+// submitted.
+func (w *bulkWriter) group() []*bulkPartition {
+	var partitions []*bulkPartition
+	byPartitionKey := map[string]*bulkPartition{}
+	rowKeyCounts := map[string]map[string]int{}
+	for i, action := range w.actions {
+		pk, rk, err := transactionActionKeys(action)
+		w.results[i] = BulkActionResult{PartitionKey: pk, RowKey: rk, Err: err}
+		if err != nil {
+			continue
+		}
+
+		p, ok := byPartitionKey[pk]
+		if !ok {
+			p = &bulkPartition{}
+			byPartitionKey[pk] = p
+			rowKeyCounts[pk] = map[string]int{}
+			partitions = append(partitions, p)
+		}
+		generation := rowKeyCounts[pk][rk]
+		rowKeyCounts[pk][rk]++
+		if generation == len(p.generations) {
+			p.generations = append(p.generations, nil)
+		}
+		batches := p.generations[generation]
+		if len(batches) == 0 || len(batches[len(batches)-1].indexes) == maxTransactionActions {
+			batches = append(batches, &bulkBatch{partition: p})
+			p.generations[generation] = batches
+		}
+		last := batches[len(batches)-1]
+		last.indexes = append(last.indexes, i)
+	}
+	return partitions
+}
+
+// transactionActionKeys returns the PartitionKey and RowKey of the entity of an action.
+func transactionActionKeys(action TransactionAction) (string, string, error) {
+	var keys struct {
+		PartitionKey *string
+		RowKey       *string
+	}
+	if err := json.Unmarshal(action.Entity, &keys); err != nil {
+		return "", "", err
+	}
+	if keys.PartitionKey == nil || keys.RowKey == nil {
+		return "", "", errPartitionKeyRowKeyError
+	}
+	return *keys.PartitionKey, *keys.RowKey, nil
+}
+
+// enqueue queues the transactions of the current generation of the partition. It must be called with mu held, or
+// before the workers start.
+func (w *bulkWriter) enqueue(p *bulkPartition) {
+	generation := p.generations[p.current]
+	p.remaining = len(generation)
+	for _, batch := range generation {
+		w.queue <- batch
+	}
+}
+
+// complete records that a transaction completed, queueing the next generation of its partition.
+func (w *bulkWriter) complete(batch *bulkBatch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := batch.partition
+	p.remaining--
+	if p.remaining == 0 && p.current+1 < len(p.generations) {
+		p.current++
+		w.enqueue(p)
+	}
+	w.pending--
+	if w.pending == 0 {
+		close(w.queue)
+	}
+}
+
+// writeBatch submits the actions at indexes as a transaction. When an action fails the transaction, that action fails
+// and the other actions are submitted again. If the service doesn't report which action failed, the transaction is
+// split in two and each half is submitted.
+func (w *bulkWriter) writeBatch(ctx context.Context, indexes []int) {
+	for len(indexes) > 0 {
+		err := w.submitWithRetries(ctx, w.batchActions(indexes))
+
+		var actionErr *transactionActionError
+		if err == nil || len(indexes) == 1 || !errors.As(err, &actionErr) || !isActionError(actionErr.ResponseError) {
+			for _, i := range indexes {
+				w.results[i].Err = err
+			}
+			return
+		}
+
+		if actionErr.index < 0 || actionErr.index >= len(indexes) {
+			half := len(indexes) / 2
+			w.writeBatch(ctx, indexes[:half])
+			w.writeBatch(ctx, indexes[half:])
+			return
+		}
+
+		// the transaction is atomic, so none of the other actions were committed.
+		w.results[indexes[actionErr.index]].Err = err
+		indexes = append(indexes[:actionErr.index:actionErr.index], indexes[actionErr.index+1:]...)
+	}
+}
+
+// batchActions returns the actions at indexes.
+func (w *bulkWriter) batchActions(indexes []int) []TransactionAction {
+	actions := make([]TransactionAction, len(indexes))
+	for i, index := range indexes {
+		actions[i] = w.actions[index]
+	}
+	return actions
+}
+
+// submitWithRetries submits the actions as a transaction, retrying it while it's throttled.
+func (w *bulkWriter) submitWithRetries(ctx context.Context, actions []TransactionAction) error {
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := w.submit(ctx, actions)
+		if err == nil || !isThrottlingError(err) || attempt >= w.maxRetries {
+			return err
+		}
+
+		// add up to 20% of jitter so that the throttled transactions don't retry at the same time
+		jittered := delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+		timer := time.NewTimer(jittered)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(delay*2, w.maxRetryDelay)
+	}
+}
+
+// isThrottlingError reports whether a transaction failed because the account or the partition is busy. The service
+// can report it for the whole transaction, or as the response of one of its actions.
+func isThrottlingError(err error) bool {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	return respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode == http.StatusServiceUnavailable ||
+		respErr.ErrorCode == "ServerBusy"
+}
+
+// isActionError reports whether the failed response of an action was caused by that action, rather than by the
+// table, the request or the account, such as when the table doesn't exist or the request isn't authorized.
+func isActionError(respErr *azcore.ResponseError) bool {
+	if respErr.ErrorCode == string(TableNotFound) || isThrottlingError(respErr) {
+		return false
+	}
+	switch respErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout:
+		return false
+	}
+	return respErr.StatusCode < http.StatusInternalServerError
+}
@@ -0,0 +1,257 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aztables
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/require"
+)
+
+func bulkAction(t *testing.T, actionType TransactionType, pk, rk string) TransactionAction {
+	marshalled, err := json.Marshal(Entity{PartitionKey: pk, RowKey: rk})
+	require.NoError(t, err)
+	return TransactionAction{ActionType: actionType, Entity: marshalled}
+}
+
+// fakeBulkTable records the transactions submitted by a bulkWriter.
+type fakeBulkTable struct {
+	t         *testing.T
+	mu        sync.Mutex
+	submitted [][]string
+	committed []string
+	inFlight  atomic.Int32
+	maxFlight atomic.Int32
+	// fail returns the error of a transaction, given the keys of its actions.
+	fail func(keys []string) error
+}
+
+func (f *fakeBulkTable) submit(_ context.Context, actions []TransactionAction) error {
+	inFlight := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		highest := f.maxFlight.Load()
+		if inFlight <= highest || f.maxFlight.CompareAndSwap(highest, inFlight) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	var pk string
+	keys := make([]string, len(actions))
+	for i, action := range actions {
+		actionPK, rk, err := transactionActionKeys(action)
+		require.NoError(f.t, err)
+		if i == 0 {
+			pk = actionPK
+		}
+		require.Equal(f.t, pk, actionPK, "a transaction must have a single PartitionKey")
+		keys[i] = actionPK + "/" + rk
+	}
+	require.LessOrEqual(f.t, len(actions), maxTransactionActions)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.submitted = append(f.submitted, keys)
+	if f.fail != nil {
+		if err := f.fail(keys); err != nil {
+			return err
+		}
+	}
+	f.committed = append(f.committed, keys...)
+	return nil
+}
+
+func TestSubmitBulkGroupsByPartitionKey(t *testing.T) {
+	var actions []TransactionAction
+	for i := range 250 {
+		actions = append(actions, bulkAction(t, TransactionTypeInsertReplace, fmt.Sprintf("pk%d", i%3), fmt.Sprintf("rk%d", i)))
+	}
+	actions = append(actions, TransactionAction{ActionType: TransactionTypeAdd, Entity: []byte(`{"RowKey":"missing"}`)})
+
+	table := &fakeBulkTable{t: t}
+	resp := newBulkWriter(table.submit, &SubmitBulkOptions{Concurrency: 2}).write(context.Background(), actions)
+	require.Len(t, resp.Results, len(actions))
+	for i, result := range resp.Results[:250] {
+		require.NoError(t, result.Err)
+		require.Equal(t, fmt.Sprintf("pk%d", i%3), result.PartitionKey)
+		require.Equal(t, fmt.Sprintf("rk%d", i), result.RowKey)
+	}
+	require.ErrorIs(t, resp.Results[250].Err, errPartitionKeyRowKeyError)
+
+	// 84, 83 and 83 actions per partition key
+	require.Len(t, table.submitted, 3)
+	require.Len(t, table.committed, 250)
+	require.LessOrEqual(t, table.maxFlight.Load(), int32(2))
+
+	table = &fakeBulkTable{t: t}
+	actions = nil
+	for i := range 250 {
+		actions = append(actions, bulkAction(t, TransactionTypeAdd, "pk", fmt.Sprintf("rk%d", i)))
+	}
+	resp = newBulkWriter(table.submit, nil).write(context.Background(), actions)
+	require.Len(t, resp.Results, 250)
+	require.Len(t, table.submitted, 3)
+	require.Len(t, table.committed, 250)
+}
+
+func TestSubmitBulkOrdersActionsForTheSameEntity(t *testing.T) {
+	actions := []TransactionAction{
+		bulkAction(t, TransactionTypeAdd, "pk", "a"),
+		bulkAction(t, TransactionTypeAdd, "pk", "b"),
+		bulkAction(t, TransactionTypeUpdateMerge, "pk", "a"),
+		bulkAction(t, TransactionTypeDelete, "pk", "a"),
+	}
+	table := &fakeBulkTable{t: t}
+	resp := newBulkWriter(table.submit, nil).write(context.Background(), actions)
+	for _, result := range resp.Results {
+		require.NoError(t, result.Err)
+	}
+	require.Equal(t, [][]string{{"pk/a", "pk/b"}, {"pk/a"}, {"pk/a"}}, table.submitted)
+}
+
+func TestSubmitBulkResubmitsFailedTransactions(t *testing.T) {
+	var actions []TransactionAction
+	for i := range 10 {
+		actions = append(actions, bulkAction(t, TransactionTypeAdd, "pk", fmt.Sprintf("rk%d", i)))
+	}
+	failingKeys := func(index func(int) int) func(keys []string) error {
+		return func(keys []string) error {
+			for i, key := range keys {
+				if key == "pk/rk3" || key == "pk/rk8" {
+					return failedTransaction(t, index(i), http.StatusConflict, string(EntityAlreadyExists))
+				}
+			}
+			return nil
+		}
+	}
+
+	table := &fakeBulkTable{t: t, fail: failingKeys(func(i int) int { return i })}
+	resp := newBulkWriter(table.submit, nil).write(context.Background(), actions)
+	for i, result := range resp.Results {
+		if i == 3 || i == 8 {
+			var respErr *azcore.ResponseError
+			require.ErrorAs(t, result.Err, &respErr)
+			require.Equal(t, http.StatusConflict, respErr.StatusCode)
+			require.Equal(t, string(EntityAlreadyExists), respErr.ErrorCode)
+			continue
+		}
+		require.NoError(t, result.Err)
+	}
+	require.Len(t, table.committed, 8)
+	require.NotContains(t, table.committed, "pk/rk3")
+	require.NotContains(t, table.committed, "pk/rk8")
+	// only the failed actions are removed from the transaction
+	require.Len(t, table.submitted, 3)
+	require.Len(t, table.submitted[1], 9)
+	require.Len(t, table.submitted[2], 8)
+
+	// when the failed action isn't reported, the transaction is split until it's found
+	table = &fakeBulkTable{t: t, fail: failingKeys(func(int) int { return -1 })}
+	resp = newBulkWriter(table.submit, nil).write(context.Background(), actions)
+	for i, result := range resp.Results {
+		if i == 3 || i == 8 {
+			require.Error(t, result.Err)
+			continue
+		}
+		require.NoError(t, result.Err)
+	}
+	require.Len(t, table.committed, 8)
+	require.Greater(t, len(table.submitted), 3)
+}
+
+func TestSubmitBulkFailedTransactions(t *testing.T) {
+	actions := []TransactionAction{
+		bulkAction(t, TransactionTypeAdd, "pk", "a"),
+		bulkAction(t, TransactionTypeAdd, "pk", "b"),
+	}
+
+	// errors that fail every action aren't split or retried
+	for _, err := range []error{
+		failedTransaction(t, 0, http.StatusNotFound, string(TableNotFound)),
+		failedTransaction(t, 0, http.StatusForbidden, "AuthorizationFailure"),
+	} {
+		table := &fakeBulkTable{t: t, fail: func([]string) error { return err }}
+		resp := newBulkWriter(table.submit, nil).write(context.Background(), actions)
+		for _, result := range resp.Results {
+			require.ErrorIs(t, result.Err, err)
+		}
+		require.Len(t, table.submitted, 1)
+		require.Empty(t, table.committed)
+	}
+}
+
+func TestSubmitBulkRetriesThrottledTransactions(t *testing.T) {
+	actions := []TransactionAction{
+		bulkAction(t, TransactionTypeAdd, "pk", "a"),
+		bulkAction(t, TransactionTypeAdd, "pk", "b"),
+	}
+	options := &SubmitBulkOptions{RetryDelay: time.Millisecond}
+
+	// the service reports throttling for the whole transaction, or as the response of its changeset
+	for _, err := range []error{
+		&azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+		&azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServerBusy"},
+		failedTransaction(t, 0, http.StatusTooManyRequests, "TooManyRequests"),
+		failedTransaction(t, -1, http.StatusServiceUnavailable, "ServerBusy"),
+	} {
+		throttled := 2
+		table := &fakeBulkTable{t: t, fail: func([]string) error {
+			if throttled == 0 {
+				return nil
+			}
+			throttled--
+			return err
+		}}
+		resp := newBulkWriter(table.submit, options).write(context.Background(), actions)
+		for _, result := range resp.Results {
+			require.NoError(t, result.Err)
+		}
+		require.Len(t, table.submitted, 3)
+		require.Equal(t, []string{"pk/a", "pk/b"}, table.committed)
+	}
+
+	// the retries are bounded
+	throttledErr := &azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServerBusy"}
+	table := &fakeBulkTable{t: t, fail: func([]string) error { return throttledErr }}
+	resp := newBulkWriter(table.submit, &SubmitBulkOptions{MaxRetries: 2, RetryDelay: time.Millisecond}).write(context.Background(), actions)
+	for _, result := range resp.Results {
+		require.ErrorIs(t, result.Err, throttledErr)
+	}
+	require.Len(t, table.submitted, 3)
+	require.Empty(t, table.committed)
+
+	table = &fakeBulkTable{t: t, fail: func([]string) error { return throttledErr }}
+	resp = newBulkWriter(table.submit, &SubmitBulkOptions{MaxRetries: -1}).write(context.Background(), actions)
+	require.ErrorIs(t, resp.Results[0].Err, throttledErr)
+	require.Len(t, table.submitted, 1)
+
+	// a retry stops waiting when the context is canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	table = &fakeBulkTable{t: t, fail: func([]string) error { return throttledErr }}
+	resp = newBulkWriter(table.submit, &SubmitBulkOptions{RetryDelay: time.Hour}).write(ctx, actions)
+	require.ErrorIs(t, resp.Results[0].Err, context.DeadlineExceeded)
+	require.Len(t, table.submitted, 1)
+}
+
+func TestSubmitBulkCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	table := &fakeBulkTable{t: t}
+	resp := newBulkWriter(table.submit, nil).write(ctx, []TransactionAction{bulkAction(t, TransactionTypeAdd, "pk", "a")})
+	require.ErrorIs(t, resp.Results[0].Err, context.Canceled)
+	require.Empty(t, table.submitted)
+
+	resp = newBulkWriter(table.submit, nil).write(context.Background(), nil)
+	require.Empty(t, resp.Results)
+}
@@ -117,6 +117,29 @@ ensure proper round-trip serialization of all properties.
 		}
 	}
 
+Structs can be mapped to entities with MarshalEntity and UnmarshalEntity. Fields named PartitionKey
+and RowKey, such as the fields of an embedded aztables.Entity, are the keys of the entity, and the
+"aztables" struct tag renames fields or sets their EDM type.
+
+	type Product struct {
+		aztables.Entity
+		Product     string
+		Price       float64
+		Count       int64
+		ProductGUID string `aztables:",guid"`
+	}
+	marshalled, err := aztables.MarshalEntity(Product{...})
+	handle(err)
+	product, err := aztables.UnmarshalEntity[Product](resp.Value)
+	handle(err)
+
+Filters can be built with FilterProperty, which formats and escapes the values for their EDM type.
+
+	filter, err := aztables.FilterProperty("PartitionKey").Eq("pencils").
+		And(aztables.FilterProperty("DateReceived").Gt(time.Now().AddDate(0, -1, 0))).
+		Build()
+	handle(err)
+
 # More Examples
 
 The following sections provide several code snippets covering some of the most common Table tasks, including:
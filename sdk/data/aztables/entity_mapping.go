@@ -0,0 +1,534 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aztables
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarshalEntity marshals a struct to the JSON of an entity, for use with AddEntity, UpsertEntity,
+// UpdateEntity and transactions. See ToEDMEntity for how the fields of the struct are mapped.
+func MarshalEntity[T any](v T) ([]byte, error) {
+	entity, err := ToEDMEntity(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entity)
+}
+
+// UnmarshalEntity unmarshals the JSON of an entity, such as GetEntityResponse.Value or an
+// entity of ListEntitiesResponse.Entities, to a struct. See FromEDMEntity for how the properties
+// of the entity are mapped.
+func UnmarshalEntity[T any](data []byte) (T, error) {
+	var entity EDMEntity
+	if err := json.Unmarshal(data, &entity); err != nil {
+		var zero T
+		return zero, err
+	}
+	return FromEDMEntity[T](entity)
+}
+
+// ToEDMEntity maps a struct, or a pointer to a struct, to an EDMEntity.
+//
+// Each exported field is mapped to the property of the same name. The fields can be customized with the
+// "aztables" struct tag, such as `aztables:"Name,omitempty"`. The name in the tag replaces the field name,
+// "-" skips the field, and the following options are supported:
+//
+//   - partitionkey, rowkey: the string field is the PartitionKey or the RowKey of the entity. Fields named
+//     PartitionKey and RowKey, such as the fields of an embedded Entity, are used when no field has these options.
+//   - timestamp, etag: the field receives the Timestamp or the ETag of the entity, and isn't marshaled. A field
+//     named Timestamp is used when no field has the timestamp option.
+//   - int64, guid, binary: the field is an Edm.Int64, Edm.Guid or Edm.Binary property, such as for a string field
+//     holding a GUID.
+//   - omitempty: the property is omitted when the field has its zero value.
+//
+// Fields of embedded structs are promoted. Field types map to properties as follows:
+//
+//   - string and bool to Edm.String and Edm.Boolean
+//   - int8, int16, int32, uint8 and uint16 to Edm.Int32
+//   - int, int64, uint, uint32, uint64 and EDMInt64 to Edm.Int64
+//   - float32 and float64 to Edm.Double
+//   - time.Time and EDMDateTime to Edm.DateTime
+//   - []byte and EDMBinary to Edm.Binary
+//   - EDMGUID to Edm.Guid
+//
+// Nil pointers are omitted, and other field types return an error.
+func ToEDMEntity[T any](v T) (EDMEntity, error) {
+	rv := reflect.ValueOf(&v).Elem()
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return EDMEntity{}, errors.New("entity is nil")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return EDMEntity{}, fmt.Errorf("entity must be a struct, not %s", rv.Type())
+	}
+
+	fields, err := entityFieldsOf(rv.Type())
+	if err != nil {
+		return EDMEntity{}, err
+	}
+
+	entity := EDMEntity{Properties: map[string]any{}}
+	for _, field := range fields {
+		fv, ok := entityFieldValue(rv, field.index, false)
+		if !ok {
+			continue
+		}
+		switch field.role {
+		case entityFieldPartitionKey:
+			entity.PartitionKey = fv.String()
+		case entityFieldRowKey:
+			entity.RowKey = fv.String()
+		case entityFieldProperty:
+			if field.omitEmpty && fv.IsZero() {
+				continue
+			}
+			value, ok, err := toEDMValue(fv, field.edmType)
+			if err != nil {
+				return EDMEntity{}, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			if ok {
+				entity.Properties[field.name] = value
+			}
+		}
+	}
+	return entity, nil
+}
+
+// FromEDMEntity maps an EDMEntity to a struct, or a pointer to a struct, of type T. The fields are mapped as
+// described by ToEDMEntity. Numeric properties are converted to the numeric type of their field, and return an error
+// if they overflow it. Properties without a field are ignored.
+func FromEDMEntity[T any](entity EDMEntity) (T, error) {
+	var v T
+	rv := reflect.ValueOf(&v).Elem()
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return v, fmt.Errorf("entity must be unmarshaled to a struct, not %s", rv.Type())
+	}
+
+	fields, err := entityFieldsOf(rv.Type())
+	if err != nil {
+		return v, err
+	}
+
+	for _, field := range fields {
+		var value any
+		switch field.role {
+		case entityFieldPartitionKey:
+			value = entity.PartitionKey
+		case entityFieldRowKey:
+			value = entity.RowKey
+		case entityFieldTimestamp:
+			if time.Time(entity.Timestamp).IsZero() {
+				continue
+			}
+			value = entity.Timestamp
+		case entityFieldETag:
+			if entity.ETag == "" {
+				continue
+			}
+			value = entity.ETag
+		default:
+			var ok bool
+			if value, ok = entity.Properties[field.name]; !ok || value == nil {
+				continue
+			}
+		}
+
+		fv, _ := entityFieldValue(rv, field.index, true)
+		if err := setEntityFieldValue(fv, value); err != nil {
+			return v, fmt.Errorf("property %s: %w", field.name, err)
+		}
+	}
+	return v, nil
+}
+
+type entityFieldRole int
+
+const (
+	entityFieldProperty entityFieldRole = iota
+	entityFieldPartitionKey
+	entityFieldRowKey
+	entityFieldTimestamp
+	entityFieldETag
+)
+
+// entityField describes a struct field mapped to an entity.
+type entityField struct {
+	name      string
+	index     []int
+	role      entityFieldRole
+	edmType   string
+	omitEmpty bool
+	// tagged is set when the role comes from the struct tag.
+	tagged bool
+}
+
+var entityFieldsCache sync.Map // map[reflect.Type][]entityField, or error
+
+var (
+	timeType        = reflect.TypeFor[time.Time]()
+	edmDateTimeType = reflect.TypeFor[EDMDateTime]()
+)
+
+// entityFieldsOf returns the fields of the struct type t mapped to an entity.
+func entityFieldsOf(t reflect.Type) ([]entityField, error) {
+	if cached, ok := entityFieldsCache.Load(t); ok {
+		if err, ok := cached.(error); ok {
+			return nil, err
+		}
+		return cached.([]entityField), nil
+	}
+
+	fields, err := buildEntityFields(t)
+	if err != nil {
+		entityFieldsCache.Store(t, err)
+		return nil, err
+	}
+	entityFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+func buildEntityFields(t reflect.Type) ([]entityField, error) {
+	var fields []entityField
+	seen := map[string]bool{}
+	var collect func(t reflect.Type, index []int, visited map[reflect.Type]bool) error
+	collect = func(t reflect.Type, index []int, visited map[reflect.Type]bool) error {
+		var embedded []reflect.StructField
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("aztables")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+
+			if sf.Anonymous && name == "" {
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct && ft != timeType && ft != edmDateTimeType {
+					embedded = append(embedded, sf)
+					continue
+				}
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			if seen[name] {
+				// fields of outer structs shadow the fields of embedded structs
+				continue
+			}
+			seen[name] = true
+
+			field := entityField{name: name, index: append(append([]int{}, index...), i)}
+			for _, option := range strings.Split(options, ",") {
+				switch strings.ToLower(strings.TrimSpace(option)) {
+				case "":
+				case "partitionkey":
+					field.role, field.tagged = entityFieldPartitionKey, true
+				case "rowkey":
+					field.role, field.tagged = entityFieldRowKey, true
+				case "timestamp":
+					field.role, field.tagged = entityFieldTimestamp, true
+				case "etag":
+					field.role, field.tagged = entityFieldETag, true
+				case "int64":
+					field.edmType = "Edm.Int64"
+				case "guid":
+					field.edmType = "Edm.Guid"
+				case "binary":
+					field.edmType = "Edm.Binary"
+				case "omitempty":
+					field.omitEmpty = true
+				default:
+					return fmt.Errorf("field %s of %s has the unknown aztables option %q", sf.Name, t, option)
+				}
+			}
+			fields = append(fields, field)
+		}
+
+		for _, sf := range embedded {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if visited[ft] {
+				continue
+			}
+			visited[ft] = true
+			if err := collect(ft, append(append([]int{}, index...), sf.Index...), visited); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := collect(t, nil, map[reflect.Type]bool{t: true}); err != nil {
+		return nil, err
+	}
+
+	// fields named after the system properties are used when no field is tagged with their option
+	for _, role := range []struct {
+		role entityFieldRole
+		name string
+	}{
+		{entityFieldPartitionKey, "PartitionKey"},
+		{entityFieldRowKey, "RowKey"},
+		{entityFieldTimestamp, "Timestamp"},
+	} {
+		tagged := false
+		for _, field := range fields {
+			if field.tagged && field.role == role.role {
+				tagged = true
+			}
+		}
+		if tagged {
+			continue
+		}
+		for i := range fields {
+			if fields[i].name == role.name && fields[i].role == entityFieldProperty {
+				fields[i].role = role.role
+			}
+		}
+	}
+
+	for _, field := range fields {
+		ft := t.FieldByIndex(field.index).Type
+		switch field.role {
+		case entityFieldPartitionKey, entityFieldRowKey, entityFieldETag:
+			if ft.Kind() != reflect.String {
+				return nil, fmt.Errorf("field %s of %s must be a string", field.name, t)
+			}
+		case entityFieldTimestamp:
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft != timeType && ft != edmDateTimeType {
+				return nil, fmt.Errorf("field %s of %s must be a time.Time or an EDMDateTime", field.name, t)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// entityFieldValue returns the field of v at index. When alloc is false, it returns false if the field is in a nil
+// embedded pointer, otherwise the pointer is allocated.
+func entityFieldValue(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// toEDMValue converts a field value to a property value. It returns false if the value is a nil pointer.
+func toEDMValue(v reflect.Value, edmType string) (any, bool, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		v = v.Elem()
+	}
+
+	switch value := v.Interface().(type) {
+	case EDMInt64, EDMGUID, EDMBinary, EDMDateTime:
+		return value, true, nil
+	case time.Time:
+		return EDMDateTime(value), true, nil
+	}
+
+	switch edmType {
+	case "Edm.Int64":
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return EDMInt64(v.Int()), true, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.Uint() > math.MaxInt64 {
+				return nil, false, fmt.Errorf("%d overflows Edm.Int64", v.Uint())
+			}
+			return EDMInt64(v.Uint()), true, nil
+		}
+		return nil, false, fmt.Errorf("%s can't be an Edm.Int64", v.Type())
+	case "Edm.Guid":
+		if v.Kind() != reflect.String {
+			return nil, false, fmt.Errorf("%s can't be an Edm.Guid", v.Type())
+		}
+		return EDMGUID(v.String()), true, nil
+	case "Edm.Binary":
+		if v.Kind() == reflect.String {
+			return EDMBinary(v.String()), true, nil
+		}
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, false, fmt.Errorf("%s can't be an Edm.Binary", v.Type())
+		}
+		return EDMBinary(v.Bytes()), true, nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return v.Bool(), true, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return int32(v.Int()), true, nil
+	case reflect.Uint8, reflect.Uint16:
+		return int32(v.Uint()), true, nil
+	case reflect.Int, reflect.Int64:
+		return EDMInt64(v.Int()), true, nil
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return nil, false, fmt.Errorf("%d overflows Edm.Int64", v.Uint())
+		}
+		return EDMInt64(v.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return EDMBinary(v.Bytes()), true, nil
+		}
+	}
+	return nil, false, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// setEntityFieldValue sets a field to a property value.
+func setEntityFieldValue(v reflect.Value, value any) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType || v.Type() == edmDateTimeType {
+		var t time.Time
+		switch value := value.(type) {
+		case EDMDateTime:
+			t = time.Time(value)
+		case string:
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return err
+			}
+			t = parsed
+		default:
+			return fmt.Errorf("can't set %T to %s", value, v.Type())
+		}
+		v.Set(reflect.ValueOf(t).Convert(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if reflect.TypeOf(value).AssignableTo(v.Type()) {
+			v.Set(reflect.ValueOf(value))
+			return nil
+		}
+	case reflect.String:
+		switch value := value.(type) {
+		case string:
+			v.SetString(value)
+			return nil
+		case EDMGUID:
+			v.SetString(string(value))
+			return nil
+		}
+	case reflect.Bool:
+		if value, ok := value.(bool); ok {
+			v.SetBool(value)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := integerOf(value)
+		if !ok {
+			break
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := integerOf(value)
+		if !ok {
+			break
+		}
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return fmt.Errorf("%d overflows %s", i, v.Type())
+		}
+		v.SetUint(uint64(i))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch value := value.(type) {
+		case float64:
+			v.SetFloat(value)
+			return nil
+		case int32:
+			v.SetFloat(float64(value))
+			return nil
+		case EDMInt64:
+			v.SetFloat(float64(value))
+			return nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		switch value := value.(type) {
+		case EDMBinary:
+			v.SetBytes(append([]byte{}, value...))
+			return nil
+		case string:
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(decoded)
+			return nil
+		}
+	}
+	return fmt.Errorf("can't set %T to %s", value, v.Type())
+}
+
+// integerOf returns the integer of a numeric property value.
+func integerOf(value any) (int64, bool) {
+	switch value := value.(type) {
+	case int32:
+		return int64(value), true
+	case EDMInt64:
+		return int64(value), true
+	case float64:
+		if value != math.Trunc(value) || value < math.MinInt64 || value >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(value), true
+	}
+	return 0, false
+}
@@ -0,0 +1,160 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aztables
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/require"
+)
+
+type mappedProduct struct {
+	Entity
+	Name     string
+	Count    int
+	Stock    int32
+	Price    float64
+	OnSale   bool
+	Received time.Time
+	Code     []byte
+	ID       string `aztables:"ProductID,guid"`
+	Weight   *float64
+	Notes    string      `aztables:",omitempty"`
+	ETag     azcore.ETag `aztables:",etag"`
+	Ignored  string      `aztables:"-"`
+	internal string
+}
+
+func TestEntityMappingRoundTrip(t *testing.T) {
+	received := time.Date(2021, time.August, 21, 1, 1, 0, 0, time.UTC)
+	product := mappedProduct{
+		Entity:   Entity{PartitionKey: "pencils", RowKey: "id-'003"},
+		Name:     "Ticonderoga Pencils",
+		Count:    12345678901234,
+		Stock:    15,
+		Price:    5,
+		OnSale:   true,
+		Received: received,
+		Code:     []byte("somebinaryvalue"),
+		ID:       "c9da6455-213d-42c9-9a79-3e9149a57833",
+		Ignored:  "ignored",
+		internal: "internal",
+	}
+
+	entity, err := ToEDMEntity(product)
+	require.NoError(t, err)
+	require.Equal(t, "pencils", entity.PartitionKey)
+	require.Equal(t, "id-'003", entity.RowKey)
+	require.Equal(t, map[string]any{
+		"Name":      "Ticonderoga Pencils",
+		"Count":     EDMInt64(12345678901234),
+		"Stock":     int32(15),
+		"Price":     float64(5),
+		"OnSale":    true,
+		"Received":  EDMDateTime(received),
+		"Code":      EDMBinary("somebinaryvalue"),
+		"ProductID": EDMGUID("c9da6455-213d-42c9-9a79-3e9149a57833"),
+	}, entity.Properties)
+
+	marshalled, err := MarshalEntity(&product)
+	require.NoError(t, err)
+	require.Contains(t, string(marshalled), `"Count@odata.type":"Edm.Int64"`)
+	require.Contains(t, string(marshalled), `"ProductID@odata.type":"Edm.Guid"`)
+
+	// the service returns the system properties and the ETag
+	withMetadata := []byte(`{"odata.etag":"W/\"datetime'2021-08-21T01%3A01%3A00Z'\"","PartitionKey":"pencils","RowKey":"id-003","Timestamp":"2021-08-21T01:01:00Z",` +
+		`"Name":"Ticonderoga Pencils","Count@odata.type":"Edm.Int64","Count":"12345678901234","Stock":15,"Price":5.0,"OnSale":true,` +
+		`"Received@odata.type":"Edm.DateTime","Received":"2021-08-21T01:01:00Z","Code@odata.type":"Edm.Binary","Code":"c29tZWJpbmFyeXZhbHVl",` +
+		`"ProductID@odata.type":"Edm.Guid","ProductID":"c9da6455-213d-42c9-9a79-3e9149a57833","Weight":2.5,"Extra":"ignored"}`)
+	got, err := UnmarshalEntity[mappedProduct](withMetadata)
+	require.NoError(t, err)
+	require.Equal(t, "pencils", got.PartitionKey)
+	require.Equal(t, "id-003", got.RowKey)
+	require.Equal(t, received, time.Time(got.Timestamp))
+	require.Equal(t, azcore.ETag(`W/"datetime'2021-08-21T01%3A01%3A00Z'"`), got.ETag)
+	require.Equal(t, 12345678901234, got.Count)
+	require.EqualValues(t, 15, got.Stock)
+	require.Equal(t, 5.0, got.Price)
+	require.True(t, got.OnSale)
+	require.Equal(t, received, got.Received)
+	require.Equal(t, []byte("somebinaryvalue"), got.Code)
+	require.Equal(t, "c9da6455-213d-42c9-9a79-3e9149a57833", got.ID)
+	require.NotNil(t, got.Weight)
+	require.Equal(t, 2.5, *got.Weight)
+	require.Empty(t, got.Ignored)
+
+	ptr, err := UnmarshalEntity[*mappedProduct](withMetadata)
+	require.NoError(t, err)
+	require.Equal(t, got, *ptr)
+}
+
+func TestEntityMappingTags(t *testing.T) {
+	type order struct {
+		Customer  string    `aztables:",partitionkey"`
+		OrderID   string    `aztables:",rowkey"`
+		Placed    time.Time `aztables:",timestamp"`
+		Total     uint16
+		Quantity  int16 `aztables:"Qty,int64"`
+		RowKey    string
+		Reference string `aztables:",binary"`
+	}
+	entity, err := ToEDMEntity(order{
+		Customer:  "contoso",
+		OrderID:   "42",
+		Placed:    time.Now(),
+		Total:     7,
+		Quantity:  3,
+		RowKey:    "a property",
+		Reference: "ref",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "contoso", entity.PartitionKey)
+	require.Equal(t, "42", entity.RowKey)
+	require.Equal(t, map[string]any{
+		"Total":     int32(7),
+		"Qty":       EDMInt64(3),
+		"RowKey":    "a property",
+		"Reference": EDMBinary("ref"),
+	}, entity.Properties)
+
+	got, err := FromEDMEntity[order](EDMEntity{
+		Entity:     Entity{PartitionKey: "contoso", RowKey: "42"},
+		Properties: map[string]any{"Qty": EDMInt64(3)},
+	})
+	require.NoError(t, err)
+	require.Equal(t, order{Customer: "contoso", OrderID: "42", Quantity: 3}, got)
+}
+
+func TestEntityMappingErrors(t *testing.T) {
+	_, err := ToEDMEntity(struct{ Values []string }{})
+	require.ErrorContains(t, err, "field Values: unsupported type []string")
+
+	_, err = ToEDMEntity(struct{ Big uint64 }{Big: math.MaxUint64})
+	require.ErrorContains(t, err, "overflows Edm.Int64")
+
+	_, err = ToEDMEntity(struct {
+		PartitionKey int
+	}{})
+	require.ErrorContains(t, err, "must be a string")
+
+	_, err = ToEDMEntity(struct {
+		Name string `aztables:",unknown"`
+	}{})
+	require.ErrorContains(t, err, `unknown aztables option "unknown"`)
+
+	_, err = ToEDMEntity("not a struct")
+	require.ErrorContains(t, err, "must be a struct")
+
+	_, err = FromEDMEntity[struct{ Small int8 }](EDMEntity{Properties: map[string]any{"Small": int32(300)}})
+	require.ErrorContains(t, err, "property Small: 300 overflows int8")
+
+	_, err = FromEDMEntity[struct{ Count uint }](EDMEntity{Properties: map[string]any{"Count": int32(-1)}})
+	require.ErrorContains(t, err, "overflows uint")
+
+	_, err = FromEDMEntity[struct{ Name int }](EDMEntity{Properties: map[string]any{"Name": "text"}})
+	require.ErrorContains(t, err, "can't set string to int")
+}
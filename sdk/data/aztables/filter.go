@@ -0,0 +1,231 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aztables
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterProperty is the name of an entity property in a Filter, such as FilterProperty("PartitionKey").
+type FilterProperty string
+
+// Eq returns a Filter matching the entities whose property equals value.
+// See Filter for the supported value types.
+func (p FilterProperty) Eq(value any) Filter {
+	return p.compare("eq", value)
+}
+
+// Ne returns a Filter matching the entities whose property doesn't equal value.
+func (p FilterProperty) Ne(value any) Filter {
+	return p.compare("ne", value)
+}
+
+// Gt returns a Filter matching the entities whose property is greater than value.
+func (p FilterProperty) Gt(value any) Filter {
+	return p.compare("gt", value)
+}
+
+// Ge returns a Filter matching the entities whose property is greater than or equal to value.
+func (p FilterProperty) Ge(value any) Filter {
+	return p.compare("ge", value)
+}
+
+// Lt returns a Filter matching the entities whose property is less than value.
+func (p FilterProperty) Lt(value any) Filter {
+	return p.compare("lt", value)
+}
+
+// Le returns a Filter matching the entities whose property is less than or equal to value.
+func (p FilterProperty) Le(value any) Filter {
+	return p.compare("le", value)
+}
+
+func (p FilterProperty) compare(op string, value any) Filter {
+	if !isFilterPropertyName(string(p)) {
+		return Filter{err: fmt.Errorf("invalid property name %q", string(p))}
+	}
+	literal, err := filterLiteral(value)
+	if err != nil {
+		return Filter{err: fmt.Errorf("property %s: %w", string(p), err)}
+	}
+	return Filter{expr: string(p) + " " + op + " " + literal}
+}
+
+// Filter is an OData filter expression for ListEntitiesOptions.Filter and ListTablesOptions.Filter, built
+// from the comparisons of FilterProperty and combined with And, Or and Not. The values of the comparisons
+// are formatted and escaped for their EDM type:
+//
+//   - string: Edm.String, with its single quotes doubled
+//   - bool: Edm.Boolean
+//   - int8, int16, int32, uint8 and uint16: Edm.Int32
+//   - int, int64, uint, uint32, uint64 and EDMInt64: Edm.Int64, such as 123L
+//   - float32 and float64: Edm.Double
+//   - time.Time and EDMDateTime: Edm.DateTime in UTC, such as datetime'2021-08-21T01:01:00Z'
+//   - EDMGUID: Edm.Guid, such as guid'c9da6455-213d-42c9-9a79-3e9149a57833'
+//   - []byte and EDMBinary: Edm.Binary, such as X'0aff'
+//
+// Other types, invalid property names and invalid GUIDs are reported by Build.
+// The zero Filter is empty, and combining it with a Filter returns that Filter.
+type Filter struct {
+	expr string
+	err  error
+}
+
+// And returns a Filter matching the entities matched by both f and other.
+func (f Filter) And(other Filter) Filter {
+	return f.combine("and", other)
+}
+
+// Or returns a Filter matching the entities matched by f or other.
+func (f Filter) Or(other Filter) Filter {
+	return f.combine("or", other)
+}
+
+// Not returns a Filter matching the entities not matched by f.
+func (f Filter) Not() Filter {
+	if f.err != nil {
+		return f
+	}
+	if f.expr == "" {
+		return Filter{err: errors.New("can't negate an empty filter")}
+	}
+	return Filter{expr: "not (" + f.expr + ")"}
+}
+
+func (f Filter) combine(op string, other Filter) Filter {
+	if f.err != nil {
+		return f
+	}
+	if other.err != nil {
+		return other
+	}
+	if f.expr == "" {
+		return other
+	}
+	if other.expr == "" {
+		return f
+	}
+	return Filter{expr: "(" + f.expr + ") " + op + " (" + other.expr + ")"}
+}
+
+// Build returns the filter expression, or the first error of the comparisons of the filter.
+func (f Filter) Build() (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.expr, nil
+}
+
+// isFilterPropertyName reports whether name is a valid property name: letters, digits and
+// underscores, not starting with a digit.
+func isFilterPropertyName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// filterLiteral formats a value as an OData literal.
+func filterLiteral(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10) + "L", nil
+	case int64:
+		return strconv.FormatInt(v, 10) + "L", nil
+	case EDMInt64:
+		return strconv.FormatInt(int64(v), 10) + "L", nil
+	case uint:
+		return filterUint64Literal(uint64(v))
+	case uint32:
+		return filterUint64Literal(uint64(v))
+	case uint64:
+		return filterUint64Literal(v)
+	case float32:
+		return filterFloatLiteral(float64(v), 32)
+	case float64:
+		return filterFloatLiteral(v, 64)
+	case time.Time:
+		return "datetime'" + v.UTC().Format(rfc3339) + "'", nil
+	case EDMDateTime:
+		return "datetime'" + time.Time(v).UTC().Format(rfc3339) + "'", nil
+	case EDMGUID:
+		if !isGUID(string(v)) {
+			return "", fmt.Errorf("invalid GUID %q", string(v))
+		}
+		return "guid'" + string(v) + "'", nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case EDMBinary:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case nil:
+		return "", errors.New("can't compare to nil")
+	}
+	return "", fmt.Errorf("unsupported type %T", value)
+}
+
+func filterUint64Literal(v uint64) (string, error) {
+	if v > math.MaxInt64 {
+		return "", fmt.Errorf("%d overflows Edm.Int64", v)
+	}
+	return strconv.FormatUint(v, 10) + "L", nil
+}
+
+func filterFloatLiteral(v float64, bitSize int) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", fmt.Errorf("%v can't be compared", v)
+	}
+	s := strconv.FormatFloat(v, 'f', -1, bitSize)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+// isGUID reports whether s is a GUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func isGUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if _, err := strconv.ParseUint(s[i:i+1], 16, 8); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aztables
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterLiterals(t *testing.T) {
+	for _, test := range []struct {
+		value    any
+		expected string
+	}{
+		{"O'Brien", "Name eq 'O''Brien'"},
+		{true, "Name eq true"},
+		{int32(-15), "Name eq -15"},
+		{uint8(7), "Name eq 7"},
+		{15, "Name eq 15L"},
+		{EDMInt64(12345678901234), "Name eq 12345678901234L"},
+		{uint64(42), "Name eq 42L"},
+		{2.5, "Name eq 2.5"},
+		{float64(3), "Name eq 3.0"},
+		{time.Date(2021, time.August, 21, 1, 1, 0, 0, time.FixedZone("", 3600)), "Name eq datetime'2021-08-21T00:01:00Z'"},
+		{EDMDateTime(time.Date(2021, time.August, 21, 1, 1, 0, 500000000, time.UTC)), "Name eq datetime'2021-08-21T01:01:00.5Z'"},
+		{EDMGUID("c9da6455-213d-42c9-9a79-3e9149a57833"), "Name eq guid'c9da6455-213d-42c9-9a79-3e9149a57833'"},
+		{[]byte{0x0a, 0xff}, "Name eq X'0aff'"},
+		{EDMBinary("A"), "Name eq X'41'"},
+	} {
+		filter, err := FilterProperty("Name").Eq(test.value).Build()
+		require.NoError(t, err)
+		require.Equal(t, test.expected, filter)
+	}
+}
+
+func TestFilterCombinations(t *testing.T) {
+	pk := FilterProperty("PartitionKey")
+	rk := FilterProperty("RowKey")
+	filter, err := pk.Eq("markers").And(rk.Ge("id-001").Or(rk.Lt("id-000"))).Build()
+	require.NoError(t, err)
+	require.Equal(t, "(PartitionKey eq 'markers') and ((RowKey ge 'id-001') or (RowKey lt 'id-000'))", filter)
+
+	filter, err = FilterProperty("Price").Gt(9.99).Not().Build()
+	require.NoError(t, err)
+	require.Equal(t, "not (Price gt 9.99)", filter)
+
+	var built Filter
+	built = built.And(pk.Ne("pens")).And(FilterProperty("Count").Le(int32(3)))
+	filter, err = built.Build()
+	require.NoError(t, err)
+	require.Equal(t, "(PartitionKey ne 'pens') and (Count le 3)", filter)
+
+	filter, err = Filter{}.Build()
+	require.NoError(t, err)
+	require.Empty(t, filter)
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, filter := range []Filter{
+		FilterProperty("Name eq 'x' or Name").Eq("y"),
+		FilterProperty("1Name").Eq("y"),
+		FilterProperty("Name").Eq(nil),
+		FilterProperty("Name").Eq([]string{"a"}),
+		FilterProperty("Name").Eq(math.NaN()),
+		FilterProperty("Name").Eq(uint64(math.MaxUint64)),
+		FilterProperty("Name").Eq(EDMGUID("not-a-guid')")),
+		FilterProperty("Name").Eq("ok").Or(FilterProperty("").Eq("y")),
+		Filter{}.Not(),
+	} {
+		built, err := filter.Build()
+		require.Error(t, err)
+		require.Empty(t, built)
+	}
+}
@@ -4,6 +4,8 @@
 package aztables
 
 import (
+	"time"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	generated "github.com/Azure/azure-sdk-for-go/sdk/data/aztables/internal"
 )
@@ -171,6 +173,25 @@ func (s *SetPropertiesOptions) toGenerated() *generated.ServiceClientSetProperti
 	return &generated.ServiceClientSetPropertiesOptions{}
 }
 
+// SubmitBulkOptions contains optional parameters for Client.SubmitBulk
+type SubmitBulkOptions struct {
+	// Concurrency is the maximum number of transactions submitted at the same time.
+	// The default is 8.
+	Concurrency int
+
+	// MaxRetries is the maximum number of times a throttled transaction is retried, after the retries of the
+	// client's retry policy. The default is 5, and a value less than zero disables the retries.
+	MaxRetries int32
+
+	// RetryDelay is the delay before the first retry of a throttled transaction. The delay doubles on each
+	// retry, up to MaxRetryDelay. The default is one second.
+	RetryDelay time.Duration
+
+	// MaxRetryDelay is the maximum delay before a retry of a throttled transaction.
+	// The default is 30 seconds.
+	MaxRetryDelay time.Duration
+}
+
 // SubmitTransactionOptions contains optional parameters for Client.SubmitTransaction
 type SubmitTransactionOptions struct {
 	// placeholder for future optional parameters
@@ -85,6 +85,22 @@ type SetPropertiesResponse struct {
 	// placeholder for future response fields
 }
 
+// SubmitBulkResponse contains response fields for Client.SubmitBulk
+type SubmitBulkResponse struct {
+	// Results contains the outcome of each action, in the order of the actions.
+	Results []BulkActionResult
+}
+
+// BulkActionResult is the outcome of an action submitted by Client.SubmitBulk.
+type BulkActionResult struct {
+	// PartitionKey and RowKey identify the entity of the action.
+	PartitionKey string
+	RowKey       string
+
+	// Err is the error of the action, or nil if the action was committed.
+	Err error
+}
+
 // TransactionResponse contains response fields for Client.TransactionResponse
 type TransactionResponse struct {
 	// placeholder for future response fields
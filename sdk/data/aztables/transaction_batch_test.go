@@ -4,11 +4,16 @@
 package aztables
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/tracing"
 	"github.com/Azure/azure-sdk-for-go/sdk/internal/recording"
 	"github.com/stretchr/testify/require"
@@ -370,3 +375,68 @@ func TestBatchComplex(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildTransactionResponseActionError(t *testing.T) {
+	err := failedTransaction(t, 1, http.StatusConflict, string(EntityAlreadyExists))
+	var respErr *azcore.ResponseError
+	require.ErrorAs(t, err, &respErr)
+	require.Equal(t, http.StatusConflict, respErr.StatusCode)
+	require.Equal(t, string(EntityAlreadyExists), respErr.ErrorCode)
+	require.Contains(t, respErr.Error(), "1:The specified entity already exists.")
+
+	var actionErr *transactionActionError
+	require.ErrorAs(t, err, &actionErr)
+	require.Equal(t, 1, actionErr.index)
+
+	// SubmitTransaction returns the error of the response of the transaction
+	var transactionErr *azcore.ResponseError
+	require.ErrorAs(t, actionErr.transactionErr, &transactionErr)
+	require.Equal(t, http.StatusAccepted, transactionErr.StatusCode)
+
+	// Azure Cosmos DB doesn't report the index of the failed action
+	err = failedTransaction(t, -1, http.StatusNotFound, string(ResourceNotFound))
+	require.ErrorAs(t, err, &actionErr)
+	require.Equal(t, -1, actionErr.index)
+	require.Equal(t, http.StatusNotFound, actionErr.StatusCode)
+	require.Equal(t, string(ResourceNotFound), actionErr.ErrorCode)
+}
+
+// failedTransaction returns the error of a transaction whose action at index failed, built from a multipart
+// response like the one of a storage account. A negative index isn't included in the error message.
+func failedTransaction(t *testing.T, index int, statusCode int, errorCode string) error {
+	message := "The specified entity already exists.\\nRequestId:00000000-0000-0000-0000-000000000000\\nTime:2026-10-19T00:00:00.0000000Z"
+	if index >= 0 {
+		message = fmt.Sprintf("%d:%s", index, message)
+	}
+	body := strings.Join([]string{
+		"--batchresponse_00000000-0000-0000-0000-000000000000",
+		"Content-Type: multipart/mixed; boundary=changesetresponse_00000000-0000-0000-0000-000000000001",
+		"",
+		"--changesetresponse_00000000-0000-0000-0000-000000000001",
+		"Content-Type: application/http",
+		"Content-Transfer-Encoding: binary",
+		"",
+		fmt.Sprintf("HTTP/1.1 %d %s", statusCode, http.StatusText(statusCode)),
+		"X-Content-Type-Options: nosniff",
+		"Cache-Control: no-cache",
+		"DataServiceVersion: 3.0;",
+		"Content-Type: application/json;odata=minimalmetadata;streaming=true;charset=utf-8",
+		"",
+		fmt.Sprintf(`{"odata.error":{"code":"%s","message":{"lang":"en-US","value":"%s"}}}`, errorCode, message),
+		"--changesetresponse_00000000-0000-0000-0000-000000000001--",
+		"--batchresponse_00000000-0000-0000-0000-000000000000--",
+		"",
+	}, "\r\n")
+
+	req, err := runtime.NewRequest(context.Background(), http.MethodPost, "https://myaccount.table.core.windows.net/$batch")
+	require.NoError(t, err)
+	resp := &http.Response{
+		StatusCode: http.StatusAccepted,
+		Header:     http.Header{"Content-Type": []string{"multipart/mixed; boundary=batchresponse_00000000-0000-0000-0000-000000000000"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req.Raw(),
+	}
+	_, err = buildTransactionResponse(req, resp)
+	require.Error(t, err)
+	return err
+}
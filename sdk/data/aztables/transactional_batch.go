@@ -8,12 +8,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -41,6 +44,18 @@ func (t *Client) SubmitTransaction(ctx context.Context, transactionActions []Tra
 	ctx, endSpan := runtime.StartSpan(ctx, "Client.SubmitTransaction", t.client.Tracer(), nil)
 	defer func() { endSpan(err) }()
 
+	resp, err := t.submitTransaction(ctx, transactionActions, tableSubmitTransactionOptions)
+	var actionErr *transactionActionError
+	if errors.As(err, &actionErr) {
+		// SubmitTransaction reports the response of the transaction, only SubmitBulk reports the failed action.
+		err = actionErr.transactionErr
+	}
+	return resp, err
+}
+
+// submitTransaction submits the transaction. When an action fails the transaction, the error is a
+// *transactionActionError.
+func (t *Client) submitTransaction(ctx context.Context, transactionActions []TransactionAction, options *SubmitTransactionOptions) (TransactionResponse, error) {
 	batchID, err := uuid.New()
 	if err != nil {
 		return TransactionResponse{}, err
@@ -49,8 +64,7 @@ func (t *Client) SubmitTransaction(ctx context.Context, transactionActions []Tra
 	if err != nil {
 		return TransactionResponse{}, err
 	}
-	resp, err := t.submitTransactionInternal(ctx, transactionActions, batchID, changesetID, tableSubmitTransactionOptions)
-	return resp, err
+	return t.submitTransactionInternal(ctx, transactionActions, batchID, changesetID, options)
 }
 
 // submitTransactionInternal is the internal implementation for SubmitTransaction. It allows for explicit configuration of the batch and changeset UUID values for testing.
@@ -147,7 +161,7 @@ func buildTransactionResponse(req *policy.Request, resp *http.Response) (Transac
 			return TransactionResponse{}, err
 		}
 		if r.StatusCode >= 400 {
-			return TransactionResponse{}, runtime.NewResponseError(resp)
+			return TransactionResponse{}, newTransactionActionError(runtime.NewResponseError(resp), r)
 		}
 		i++
 	}
@@ -155,6 +169,44 @@ func buildTransactionResponse(req *policy.Request, resp *http.Response) (Transac
 	return TransactionResponse{}, nil
 }
 
+// transactionActionError is the error of a transaction that failed because of one of its actions. The
+// *azcore.ResponseError has the status and error code of the response of that action.
+type transactionActionError struct {
+	*azcore.ResponseError
+
+	// index is the index of the failed action in the transaction, or -1 if the service didn't report it.
+	index int
+
+	// transactionErr is the error for the response of the transaction, which SubmitTransaction returns.
+	transactionErr error
+}
+
+func (e *transactionActionError) Unwrap() error {
+	return e.ResponseError
+}
+
+// newTransactionActionError returns the error for the failed response of an action. The service reports the
+// index of the failed action at the start of the error message, such as "1:The specified entity already exists.".
+func newTransactionActionError(transactionErr error, resp *http.Response) error {
+	respErr := runtime.NewResponseError(resp).(*azcore.ResponseError)
+	index := -1
+	var body struct {
+		ODataError struct {
+			Message struct {
+				Value string `json:"value"`
+			} `json:"message"`
+		} `json:"odata.error"`
+	}
+	if payload, err := runtime.Payload(resp); err == nil && json.Unmarshal(payload, &body) == nil {
+		if prefix, _, ok := strings.Cut(body.ODataError.Message.Value, ":"); ok {
+			if i, err := strconv.Atoi(prefix); err == nil && i >= 0 {
+				index = i
+			}
+		}
+	}
+	return &transactionActionError{ResponseError: respErr, index: index, transactionErr: transactionErr}
+}
+
 func getBoundaryName(bytesBody []byte) string {
 	end := bytes.Index(bytesBody, []byte("\n"))
 	if end > 0 && bytesBody[end-1] == '\r' {
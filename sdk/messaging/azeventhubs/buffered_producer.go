@@ -0,0 +1,563 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/eh"
+)
+
+// ErrBufferedProducerClosed is returned by [BufferedProducer.Enqueue] after the BufferedProducer has been closed,
+// and is the error for any events that couldn't be sent before [BufferedProducer.Close] returned.
+var ErrBufferedProducerClosed = errors.New("the BufferedProducer has been closed")
+
+// BufferedProducerOptions contains optional parameters for the [NewBufferedProducer] function.
+type BufferedProducerOptions struct {
+	// MaxBufferedEventsPerPartition is the maximum number of events that can be buffered for
+	// each partition. When a partition's buffer is full [BufferedProducer.Enqueue] blocks until
+	// events have been sent.
+	//
+	// The default is 1500 events.
+	MaxBufferedEventsPerPartition int
+
+	// MaxWaitTime is the maximum amount of time to wait for a batch to fill before it's sent.
+	// Batches are sent immediately when they're full.
+	//
+	// The default is 1 second.
+	MaxWaitTime time.Duration
+
+	// SendSucceeded is called, after a batch of events has been sent. It's called from a
+	// goroutine for the partition, so it can be called concurrently for different partitions.
+	SendSucceeded func(args SendEventsSucceededArgs)
+
+	// SendFailed is called when a batch of events couldn't be sent, after retries have been exhausted,
+	// or when an event is too large to fit in a batch. It's called from a goroutine for the partition,
+	// so it can be called concurrently for different partitions.
+	//
+	// If SendFailed is nil, failures are only logged.
+	SendFailed func(args SendEventsFailedArgs)
+}
+
+// SendEventsSucceededArgs contains the events passed to [BufferedProducerOptions.SendSucceeded].
+type SendEventsSucceededArgs struct {
+	// PartitionID is the ID of the partition the events were sent to.
+	PartitionID string
+
+	// Events are the events that were sent, in the order they were enqueued.
+	Events []*EventData
+}
+
+// SendEventsFailedArgs contains the events and error passed to [BufferedProducerOptions.SendFailed].
+type SendEventsFailedArgs struct {
+	// PartitionID is the ID of the partition the events were being sent to.
+	PartitionID string
+
+	// Events are the events that couldn't be sent, in the order they were enqueued.
+	Events []*EventData
+
+	// Err is the reason the events couldn't be sent.
+	Err error
+}
+
+// EnqueueEventOptions contains optional parameters for the [BufferedProducer.Enqueue] function.
+//
+// If both PartitionKey and PartitionID are nil, the event is assigned to a partition by the BufferedProducer.
+type EnqueueEventOptions struct {
+	// PartitionKey is hashed to calculate the partition assignment. Events with the same
+	// PartitionKey are sent to the same partition, using the same assignment as the service.
+	// Note that if you use this option then PartitionID cannot be set.
+	PartitionKey *string
+
+	// PartitionID is the ID of the partition to send the event to.
+	// Note that if you use this option then PartitionKey cannot be set.
+	PartitionID *string
+}
+
+// BufferedProducer sends events in the background, as batches, to each partition of an event hub.
+//
+// Events are added with [BufferedProducer.Enqueue], which returns as soon as the event is buffered.
+// Each partition's buffered events are sent when enough events are buffered to fill a batch, or after
+// [BufferedProducerOptions.MaxWaitTime]. The outcome for each event is reported using the
+// [BufferedProducerOptions.SendSucceeded] and [BufferedProducerOptions.SendFailed] callbacks.
+//
+// Call [BufferedProducer.Close] to send any remaining events, before closing the [ProducerClient].
+type BufferedProducer struct {
+	client        bufferedProducerClient
+	maxBuffered   int
+	maxWaitTime   time.Duration
+	sendSucceeded func(args SendEventsSucceededArgs)
+	sendFailed    func(args SendEventsFailedArgs)
+
+	// sendCtx is used for all operations in the partition goroutines, and is cancelled
+	// if Close's context expires before all events are sent.
+	sendCtx    context.Context
+	cancelSend context.CancelFunc
+
+	mu           sync.Mutex
+	partitionIDs []string
+	partitions   map[string]*partitionBuffer
+	nextIndex    int
+	closed       bool
+
+	// flushing is incremented while Flush or Close are waiting, and stops the partition goroutines from
+	// waiting for their batches to fill.
+	flushing atomic.Int32
+
+	// sentMu guards sentCh, which is closed (and replaced) each time events are released from a buffer.
+	sentMu sync.Mutex
+	sentCh chan struct{}
+
+	wg sync.WaitGroup
+}
+
+// bufferedProducerClient is the subset of [ProducerClient] that the BufferedProducer uses.
+// It's an interface here to make testing easier.
+type bufferedProducerClient interface {
+	GetEventHubProperties(ctx context.Context, options *GetEventHubPropertiesOptions) (EventHubProperties, error)
+	NewEventDataBatch(ctx context.Context, options *EventDataBatchOptions) (*EventDataBatch, error)
+	SendEventDataBatch(ctx context.Context, batch *EventDataBatch, options *SendEventDataBatchOptions) error
+}
+
+// NewBufferedProducer creates a BufferedProducer that sends events using producerClient.
+//
+// The BufferedProducer doesn't close the producerClient. Close the BufferedProducer first, so it
+// can send any remaining events, and then close the producerClient.
+func NewBufferedProducer(producerClient *ProducerClient, options *BufferedProducerOptions) (*BufferedProducer, error) {
+	return newBufferedProducerImpl(producerClient, options)
+}
+
+func newBufferedProducerImpl(client bufferedProducerClient, options *BufferedProducerOptions) (*BufferedProducer, error) {
+	if options == nil {
+		options = &BufferedProducerOptions{}
+	}
+
+	if options.MaxBufferedEventsPerPartition < 0 {
+		return nil, errors.New("MaxBufferedEventsPerPartition cannot be negative")
+	}
+
+	if options.MaxWaitTime < 0 {
+		return nil, errors.New("MaxWaitTime cannot be negative")
+	}
+
+	bp := &BufferedProducer{
+		client:        client,
+		maxBuffered:   options.MaxBufferedEventsPerPartition,
+		maxWaitTime:   options.MaxWaitTime,
+		sendSucceeded: options.SendSucceeded,
+		sendFailed:    options.SendFailed,
+		partitions:    map[string]*partitionBuffer{},
+		sentCh:        make(chan struct{}),
+	}
+
+	if bp.maxBuffered == 0 {
+		bp.maxBuffered = 1500
+	}
+
+	if bp.maxWaitTime == 0 {
+		bp.maxWaitTime = time.Second
+	}
+
+	bp.sendCtx, bp.cancelSend = context.WithCancel(context.Background())
+	return bp, nil
+}
+
+// Enqueue adds an event to the buffer for its partition. The event is sent in the background, and
+// the result is reported to the [BufferedProducerOptions.SendSucceeded] or [BufferedProducerOptions.SendFailed]
+// callbacks. The event must not be modified after it's been enqueued.
+//
+// If the partition's buffer is full Enqueue blocks until there's room, or ctx is cancelled.
+//
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (bp *BufferedProducer) Enqueue(ctx context.Context, event *EventData, options *EnqueueEventOptions) error {
+	if options == nil {
+		options = &EnqueueEventOptions{}
+	}
+
+	if options.PartitionID != nil && options.PartitionKey != nil {
+		return errors.New("either PartitionID or PartitionKey can be set, but not both")
+	}
+
+	pb, err := bp.getPartitionBuffer(ctx, options)
+
+	if err != nil {
+		return err
+	}
+
+	// reserve room in the partition's buffer first, to apply backpressure.
+	select {
+	case pb.capacity <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-bp.sendCtx.Done():
+		return ErrBufferedProducerClosed
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.closed {
+		bp.release(pb, 1)
+		return ErrBufferedProducerClosed
+	}
+
+	pb.push(event)
+	return nil
+}
+
+// BufferedEventCount returns the number of events that have been enqueued but haven't been sent yet.
+func (bp *BufferedProducer) BufferedEventCount() int {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	count := 0
+
+	for _, pb := range bp.partitions {
+		count += len(pb.capacity)
+	}
+
+	return count
+}
+
+// FlushOptions contains optional parameters for the [BufferedProducer.Flush] function.
+type FlushOptions struct {
+	// For future expansion
+}
+
+// Flush sends all buffered events immediately, without waiting for batches to fill, and waits until
+// they've been sent. Events enqueued while Flush is running are also sent before it returns.
+//
+// Flush returns when the buffers are empty, even if some events failed to send. Failures are reported to
+// [BufferedProducerOptions.SendFailed].
+func (bp *BufferedProducer) Flush(ctx context.Context, options *FlushOptions) error {
+	bp.flushing.Add(1)
+	defer bp.flushing.Add(-1)
+
+	return bp.waitForEmptyBuffers(ctx)
+}
+
+// Close sends all buffered events and then stops the BufferedProducer. Enqueue will
+// return [ErrBufferedProducerClosed] after Close has been called.
+//
+// If ctx expires before all events have been sent, Close cancels any sends that are in progress and
+// returns the context's error. Events that weren't sent are reported to [BufferedProducerOptions.SendFailed].
+func (bp *BufferedProducer) Close(ctx context.Context) error {
+	bp.mu.Lock()
+	alreadyClosed := bp.closed
+	bp.closed = true
+	bp.mu.Unlock()
+
+	if alreadyClosed {
+		return nil
+	}
+
+	bp.flushing.Add(1)
+	err := bp.waitForEmptyBuffers(ctx)
+
+	// stops the partition goroutines, which report any events that are still buffered as failures.
+	bp.cancelSend()
+	bp.wg.Wait()
+
+	return err
+}
+
+func (bp *BufferedProducer) waitForEmptyBuffers(ctx context.Context) error {
+	for {
+		sentCh := bp.sentChannel()
+
+		bp.mu.Lock()
+		empty := true
+
+		for _, pb := range bp.partitions {
+			if len(pb.capacity) > 0 {
+				empty = false
+			}
+
+			// wake any partitions that are waiting for their batch to fill.
+			pb.notify()
+		}
+		bp.mu.Unlock()
+
+		if empty {
+			return nil
+		}
+
+		select {
+		case <-sentCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sentChannel returns a channel that is closed the next time events are released from a buffer.
+func (bp *BufferedProducer) sentChannel() chan struct{} {
+	bp.sentMu.Lock()
+	defer bp.sentMu.Unlock()
+
+	return bp.sentCh
+}
+
+// release frees room for count events in pb's buffer.
+func (bp *BufferedProducer) release(pb *partitionBuffer, count int) {
+	for i := 0; i < count; i++ {
+		<-pb.capacity
+	}
+
+	bp.sentMu.Lock()
+	close(bp.sentCh)
+	bp.sentCh = make(chan struct{})
+	bp.sentMu.Unlock()
+}
+
+// getPartitionBuffer returns the buffer for the event's partition, creating it (and its goroutine) if needed.
+func (bp *BufferedProducer) getPartitionBuffer(ctx context.Context, options *EnqueueEventOptions) (*partitionBuffer, error) {
+	var partitionID string
+
+	if options.PartitionID != nil {
+		partitionID = *options.PartitionID
+	} else {
+		partitionIDs, err := bp.getPartitionIDs(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if options.PartitionKey != nil {
+			partitionID = eh.PartitionForKey(*options.PartitionKey, partitionIDs)
+		} else {
+			bp.mu.Lock()
+			partitionID = partitionIDs[bp.nextIndex%len(partitionIDs)]
+			bp.nextIndex++
+			bp.mu.Unlock()
+		}
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.closed {
+		return nil, ErrBufferedProducerClosed
+	}
+
+	pb := bp.partitions[partitionID]
+
+	if pb == nil {
+		pb = newPartitionBuffer(partitionID, bp.maxBuffered)
+		bp.partitions[partitionID] = pb
+
+		bp.wg.Add(1)
+
+		go func() {
+			defer bp.wg.Done()
+			bp.runPartition(pb)
+		}()
+	}
+
+	return pb, nil
+}
+
+func (bp *BufferedProducer) getPartitionIDs(ctx context.Context) ([]string, error) {
+	bp.mu.Lock()
+	partitionIDs := bp.partitionIDs
+	bp.mu.Unlock()
+
+	if partitionIDs != nil {
+		return partitionIDs, nil
+	}
+
+	props, err := bp.client.GetEventHubProperties(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(props.PartitionIDs) == 0 {
+		return nil, errors.New("the event hub has no partitions")
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.partitionIDs = props.PartitionIDs
+	return bp.partitionIDs, nil
+}
+
+// runPartition sends batches of events from pb until the BufferedProducer is closed.
+func (bp *BufferedProducer) runPartition(pb *partitionBuffer) {
+	for {
+		select {
+		case <-pb.wake:
+			for pb.len() > 0 && bp.sendCtx.Err() == nil {
+				bp.sendBatch(pb)
+			}
+		case <-bp.sendCtx.Done():
+			if events := pb.popAll(); len(events) > 0 {
+				bp.reportFailure(pb, events, ErrBufferedProducerClosed)
+			}
+			return
+		}
+	}
+}
+
+// sendBatch sends a single batch of events from pb. If the buffered events don't fill the batch it waits,
+// up to MaxWaitTime, for more events, unless the BufferedProducer is being flushed or closed.
+func (bp *BufferedProducer) sendBatch(pb *partitionBuffer) {
+	batch, err := bp.client.NewEventDataBatch(bp.sendCtx, &EventDataBatchOptions{
+		PartitionID: &pb.partitionID,
+	})
+
+	if err != nil {
+		bp.reportFailure(pb, pb.popAll(), err)
+		return
+	}
+
+	deadline := time.NewTimer(bp.maxWaitTime)
+	defer deadline.Stop()
+
+	var events []*EventData
+
+BatchLoop:
+	for {
+		event := pb.peek()
+
+		if event == nil {
+			if bp.flushing.Load() > 0 {
+				break
+			}
+
+			select {
+			case <-pb.wake:
+				continue
+			case <-deadline.C:
+				break BatchLoop
+			case <-bp.sendCtx.Done():
+				break BatchLoop
+			}
+		}
+
+		err := batch.AddEventData(event, nil)
+
+		if errors.Is(err, ErrEventDataTooLarge) && batch.NumEvents() > 0 {
+			// the batch is full.
+			break
+		}
+
+		pb.pop()
+
+		if err != nil {
+			bp.reportFailure(pb, []*EventData{event}, err)
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	if err := bp.client.SendEventDataBatch(bp.sendCtx, batch, nil); err != nil {
+		bp.reportFailure(pb, events, err)
+		return
+	}
+
+	if bp.sendSucceeded != nil {
+		bp.sendSucceeded(SendEventsSucceededArgs{PartitionID: pb.partitionID, Events: events})
+	}
+
+	bp.release(pb, len(events))
+}
+
+func (bp *BufferedProducer) reportFailure(pb *partitionBuffer, events []*EventData, err error) {
+	if len(events) == 0 {
+		return
+	}
+
+	azlog.Writef(EventProducer, "[%s] failed to send %d buffered events: %s", pb.partitionID, len(events), err)
+
+	if bp.sendFailed != nil {
+		bp.sendFailed(SendEventsFailedArgs{PartitionID: pb.partitionID, Events: events, Err: err})
+	}
+
+	bp.release(pb, len(events))
+}
+
+// partitionBuffer holds the events that are waiting to be sent to a partition.
+type partitionBuffer struct {
+	partitionID string
+
+	// capacity has a token for each event that has been enqueued, but not sent. It's
+	// full when the buffer is full, which is how Enqueue blocks.
+	capacity chan struct{}
+
+	// wake is signalled when events are added, or the partition should stop waiting for its batch to fill.
+	wake chan struct{}
+
+	mu     sync.Mutex
+	events []*EventData
+}
+
+func newPartitionBuffer(partitionID string, maxBuffered int) *partitionBuffer {
+	return &partitionBuffer{
+		partitionID: partitionID,
+		capacity:    make(chan struct{}, maxBuffered),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (pb *partitionBuffer) push(event *EventData) {
+	pb.mu.Lock()
+	pb.events = append(pb.events, event)
+	pb.mu.Unlock()
+
+	pb.notify()
+}
+
+func (pb *partitionBuffer) notify() {
+	select {
+	case pb.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (pb *partitionBuffer) len() int {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	return len(pb.events)
+}
+
+func (pb *partitionBuffer) peek() *EventData {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if len(pb.events) == 0 {
+		return nil
+	}
+
+	return pb.events[0]
+}
+
+func (pb *partitionBuffer) pop() {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	pb.events[0] = nil
+	pb.events = pb.events[1:]
+}
+
+func (pb *partitionBuffer) popAll() []*EventData {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	events := pb.events
+	pb.events = nil
+	return events
+}
@@ -0,0 +1,380 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/eh"
+	"github.com/Azure/go-amqp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_BufferedProducer_Routing(t *testing.T) {
+	client := newFakeBufferedProducerClient("0", "1", "2")
+	bp, err := newBufferedProducerImpl(client, &BufferedProducerOptions{MaxWaitTime: time.Hour})
+	require.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte(fmt.Sprintf("rr-%d", i))}, nil))
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte(fmt.Sprintf("key-%d", i))}, &EnqueueEventOptions{
+			PartitionKey: to.Ptr("my key"),
+		}))
+	}
+
+	require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte("id")}, &EnqueueEventOptions{
+		PartitionID: to.Ptr("2"),
+	}))
+
+	require.Equal(t, 10, bp.BufferedEventCount())
+	require.NoError(t, bp.Flush(context.Background(), nil))
+	require.Zero(t, bp.BufferedEventCount())
+
+	sent := client.SentBodies()
+	keyPartition := eh.PartitionForKey("my key", []string{"0", "1", "2"})
+
+	for _, partitionID := range []string{"0", "1", "2"} {
+		var expected []string
+
+		for i := 0; i < 6; i++ {
+			if fmt.Sprint(i%3) == partitionID {
+				expected = append(expected, fmt.Sprintf("rr-%d", i))
+			}
+		}
+
+		if partitionID == keyPartition {
+			expected = append(expected, "key-0", "key-1", "key-2")
+		}
+
+		if partitionID == "2" {
+			expected = append(expected, "id")
+		}
+
+		require.ElementsMatch(t, expected, sent[partitionID], "events for partition %s", partitionID)
+	}
+
+	// events for a partition key are sent in order
+	var keyEvents []string
+
+	for _, body := range sent[keyPartition] {
+		if len(body) > 4 && body[:4] == "key-" {
+			keyEvents = append(keyEvents, body)
+		}
+	}
+
+	require.Equal(t, []string{"key-0", "key-1", "key-2"}, keyEvents)
+	require.Equal(t, 1, client.GetEventHubPropertiesCalls(), "partition IDs are only fetched once")
+
+	require.NoError(t, bp.Close(context.Background()))
+}
+
+func TestUnit_BufferedProducer_InvalidOptions(t *testing.T) {
+	client := newFakeBufferedProducerClient("0")
+
+	_, err := newBufferedProducerImpl(client, &BufferedProducerOptions{MaxBufferedEventsPerPartition: -1})
+	require.EqualError(t, err, "MaxBufferedEventsPerPartition cannot be negative")
+
+	_, err = newBufferedProducerImpl(client, &BufferedProducerOptions{MaxWaitTime: -1})
+	require.EqualError(t, err, "MaxWaitTime cannot be negative")
+
+	bp, err := newBufferedProducerImpl(client, nil)
+	require.NoError(t, err)
+
+	err = bp.Enqueue(context.Background(), &EventData{}, &EnqueueEventOptions{PartitionID: to.Ptr("0"), PartitionKey: to.Ptr("key")})
+	require.EqualError(t, err, "either PartitionID or PartitionKey can be set, but not both")
+
+	require.NoError(t, bp.Close(context.Background()))
+}
+
+func TestUnit_BufferedProducer_SendsWhenBatchIsFullOrAfterMaxWaitTime(t *testing.T) {
+	client := newFakeBufferedProducerClient("0")
+
+	// only room for a couple of events in each batch
+	client.maxBytes = 200
+
+	succeeded := make(chan SendEventsSucceededArgs, 100)
+
+	bp, err := newBufferedProducerImpl(client, &BufferedProducerOptions{
+		MaxWaitTime: 100 * time.Millisecond,
+		SendSucceeded: func(args SendEventsSucceededArgs) {
+			succeeded <- args
+		},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte(fmt.Sprintf("event %d", i))}, nil))
+	}
+
+	// everything is sent, without a Flush, once the last batch has waited for MaxWaitTime.
+	var bodies []string
+	batches := 0
+
+	for len(bodies) < 5 {
+		select {
+		case args := <-succeeded:
+			require.Equal(t, "0", args.PartitionID)
+			batches++
+
+			for _, e := range args.Events {
+				bodies = append(bodies, string(e.Body))
+			}
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "timed out waiting for events to be sent")
+		}
+	}
+
+	require.Equal(t, []string{"event 0", "event 1", "event 2", "event 3", "event 4"}, bodies)
+	require.Greater(t, batches, 1, "events are split into multiple batches")
+	require.Zero(t, bp.BufferedEventCount())
+
+	require.NoError(t, bp.Close(context.Background()))
+}
+
+func TestUnit_BufferedProducer_Failures(t *testing.T) {
+	client := newFakeBufferedProducerClient("0")
+	client.maxBytes = 200
+	client.sendErr = errors.New("send failed")
+
+	var mu sync.Mutex
+	var failures []SendEventsFailedArgs
+
+	bp, err := newBufferedProducerImpl(client, &BufferedProducerOptions{
+		MaxWaitTime: time.Hour,
+		SendSucceeded: func(args SendEventsSucceededArgs) {
+			require.Fail(t, "no sends should succeed")
+		},
+		SendFailed: func(args SendEventsFailedArgs) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, args)
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: make([]byte, 1000)}, nil))
+	require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte("small")}, nil))
+
+	require.NoError(t, bp.Flush(context.Background(), nil))
+	require.Zero(t, bp.BufferedEventCount())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, failures, 2)
+
+	require.ErrorIs(t, failures[0].Err, ErrEventDataTooLarge)
+	require.Len(t, failures[0].Events, 1)
+	require.Len(t, failures[0].Events[0].Body, 1000)
+
+	require.EqualError(t, failures[1].Err, "send failed")
+	require.Len(t, failures[1].Events, 1)
+	require.Equal(t, "small", string(failures[1].Events[0].Body))
+
+	require.NoError(t, bp.Close(context.Background()))
+}
+
+func TestUnit_BufferedProducer_Backpressure(t *testing.T) {
+	client := newFakeBufferedProducerClient("0")
+	client.sendStarted = make(chan struct{}, 10)
+	client.unblockSend = make(chan struct{})
+
+	bp, err := newBufferedProducerImpl(client, &BufferedProducerOptions{
+		MaxBufferedEventsPerPartition: 1,
+		MaxWaitTime:                   time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte("first")}, nil))
+	<-client.sendStarted
+
+	// the buffer is full until the first event has been sent.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = bp.Enqueue(ctx, &EventData{Body: []byte("second")}, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	enqueueErr := make(chan error, 1)
+
+	go func() {
+		enqueueErr <- bp.Enqueue(context.Background(), &EventData{Body: []byte("second")}, nil)
+	}()
+
+	close(client.unblockSend)
+	require.NoError(t, <-enqueueErr)
+
+	require.NoError(t, bp.Close(context.Background()))
+	require.Equal(t, map[string][]string{"0": {"first", "second"}}, client.SentBodies())
+}
+
+func TestUnit_BufferedProducer_Close(t *testing.T) {
+	t.Run("flushes", func(t *testing.T) {
+		client := newFakeBufferedProducerClient("0", "1")
+
+		bp, err := newBufferedProducerImpl(client, &BufferedProducerOptions{MaxWaitTime: time.Hour})
+		require.NoError(t, err)
+
+		for i := 0; i < 4; i++ {
+			require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte(fmt.Sprintf("event %d", i))}, nil))
+		}
+
+		require.NoError(t, bp.Close(context.Background()))
+		require.Equal(t, map[string][]string{
+			"0": {"event 0", "event 2"},
+			"1": {"event 1", "event 3"},
+		}, client.SentBodies())
+
+		err = bp.Enqueue(context.Background(), &EventData{}, nil)
+		require.ErrorIs(t, err, ErrBufferedProducerClosed)
+
+		// closing again is a no-op
+		require.NoError(t, bp.Close(context.Background()))
+	})
+
+	t.Run("context expires", func(t *testing.T) {
+		client := newFakeBufferedProducerClient("0")
+		client.sendStarted = make(chan struct{}, 10)
+		client.unblockSend = make(chan struct{})
+
+		var mu sync.Mutex
+		var failed []string
+
+		bp, err := newBufferedProducerImpl(client, &BufferedProducerOptions{
+			MaxWaitTime: time.Millisecond,
+			SendFailed: func(args SendEventsFailedArgs) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				for _, e := range args.Events {
+					failed = append(failed, string(e.Body))
+				}
+			},
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte("first")}, nil))
+		<-client.sendStarted
+
+		require.NoError(t, bp.Enqueue(context.Background(), &EventData{Body: []byte("second")}, nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err = bp.Close(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		sort.Strings(failed)
+		require.Equal(t, []string{"first", "second"}, failed)
+		require.Zero(t, bp.BufferedEventCount())
+	})
+}
+
+type fakeBufferedProducerClient struct {
+	partitionIDs []string
+	maxBytes     uint64
+	sendErr      error
+
+	// sendStarted, if non-nil, is signalled when a send starts.
+	sendStarted chan struct{}
+
+	// unblockSend, if non-nil, blocks sends until it's closed, or the context is cancelled.
+	unblockSend chan struct{}
+
+	mu              sync.Mutex
+	propsCalls      int
+	sentByPartition map[string][]string
+}
+
+func newFakeBufferedProducerClient(partitionIDs ...string) *fakeBufferedProducerClient {
+	return &fakeBufferedProducerClient{
+		partitionIDs:    partitionIDs,
+		maxBytes:        1024 * 1024,
+		sentByPartition: map[string][]string{},
+	}
+}
+
+func (c *fakeBufferedProducerClient) GetEventHubProperties(ctx context.Context, options *GetEventHubPropertiesOptions) (EventHubProperties, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.propsCalls++
+	return EventHubProperties{PartitionIDs: c.partitionIDs}, nil
+}
+
+func (c *fakeBufferedProducerClient) NewEventDataBatch(ctx context.Context, options *EventDataBatchOptions) (*EventDataBatch, error) {
+	return &EventDataBatch{maxBytes: c.maxBytes, partitionID: options.PartitionID}, nil
+}
+
+func (c *fakeBufferedProducerClient) SendEventDataBatch(ctx context.Context, batch *EventDataBatch, options *SendEventDataBatchOptions) error {
+	if c.sendStarted != nil {
+		c.sendStarted <- struct{}{}
+	}
+
+	if c.unblockSend != nil {
+		select {
+		case <-c.unblockSend:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+
+	msg, err := batch.toAMQPMessage()
+
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, data := range msg.Data {
+		var event amqp.Message
+
+		if err := event.UnmarshalBinary(data); err != nil {
+			return err
+		}
+
+		c.sentByPartition[*batch.partitionID] = append(c.sentByPartition[*batch.partitionID], string(event.GetData()))
+	}
+
+	return nil
+}
+
+func (c *fakeBufferedProducerClient) SentBodies() map[string][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sent := map[string][]string{}
+
+	for k, v := range c.sentByPartition {
+		sent[k] = append([]string(nil), v...)
+	}
+
+	return sent
+}
+
+func (c *fakeBufferedProducerClient) GetEventHubPropertiesCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.propsCalls
+}
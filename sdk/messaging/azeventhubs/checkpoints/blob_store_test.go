@@ -15,6 +15,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/internal/test/credential"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/checkpoints"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/checkpoints/checkpointstoretest"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/test"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/joho/godotenv"
@@ -333,6 +334,12 @@ func TestBlobStore_RelinquishClaim(t *testing.T) {
 	require.Equal(t, "new owner!", lastClaimed[0].OwnerID)
 }
 
+func TestBlobStore_Conformance(t *testing.T) {
+	checkpointstoretest.Run(t, func(t *testing.T) azeventhubs.CheckpointStore {
+		return newBlobStoreTestData(t).BlobStore
+	})
+}
+
 type blobStoreTestData struct {
 	CC        *container.Client
 	BlobStore *checkpoints.BlobStore
@@ -0,0 +1,368 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package checkpointstoretest provides a conformance test suite for implementations of
+// [azeventhubs.CheckpointStore].
+//
+// The [Processor] relies on the checkpoint store to coordinate ownership between multiple
+// consumers. Run the suite from a test to check that an implementation provides the same
+// guarantees as [checkpoints.BlobStore]:
+//
+//	func TestMyStore(t *testing.T) {
+//		checkpointstoretest.Run(t, func(t *testing.T) azeventhubs.CheckpointStore {
+//			return newMyStore(t)
+//		})
+//	}
+//
+// [Processor]: https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2#Processor
+// [checkpoints.BlobStore]: https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/checkpoints#BlobStore
+package checkpointstoretest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance tests against the [azeventhubs.CheckpointStore] returned by newStore.
+//
+// newStore is called once for each test. Each test uses its own fully qualified namespace, so stores
+// can share their underlying storage.
+func Run(t *testing.T, newStore func(t *testing.T) azeventhubs.CheckpointStore) {
+	tests := []struct {
+		Name string
+		Fn   func(t *testing.T, store azeventhubs.CheckpointStore, ns string)
+	}{
+		{"Checkpoints", testCheckpoints},
+		{"CheckpointsAreScoped", testCheckpointsAreScoped},
+		{"ClaimOwnership", testClaimOwnership},
+		{"ClaimOwnershipWithStaleETag", testClaimOwnershipWithStaleETag},
+		{"ClaimOwnershipWithoutETagWhenOwned", testClaimOwnershipWithoutETagWhenOwned},
+		{"ClaimOwnershipPartialSuccess", testClaimOwnershipPartialSuccess},
+		{"OwnershipIsScoped", testOwnershipIsScoped},
+		{"RelinquishOwnership", testRelinquishOwnership},
+		{"ConcurrentClaims", testConcurrentClaims},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			store := newStore(t)
+			require.NotNil(t, store)
+
+			id, err := uuid.New()
+			require.NoError(t, err)
+
+			test.Fn(t, store, fmt.Sprintf("ns-%s.servicebus.windows.net", id))
+		})
+	}
+}
+
+const (
+	eventHubName  = "event-hub-name"
+	consumerGroup = azeventhubs.DefaultConsumerGroup
+)
+
+func testCheckpoints(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	checkpoints, err := store.ListCheckpoints(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Empty(t, checkpoints)
+
+	for i := int64(0); i < 3; i++ {
+		for _, partitionID := range []string{"0", "1"} {
+			err = store.SetCheckpoint(context.Background(), newCheckpoint(ns, consumerGroup, partitionID, i), nil)
+			require.NoError(t, err)
+		}
+
+		checkpoints, err = store.ListCheckpoints(context.Background(), ns, eventHubName, consumerGroup, nil)
+		require.NoError(t, err)
+
+		require.Equal(t, []azeventhubs.Checkpoint{
+			newCheckpoint(ns, consumerGroup, "0", i),
+			newCheckpoint(ns, consumerGroup, "1", i),
+		}, sortCheckpoints(checkpoints))
+	}
+}
+
+func testCheckpointsAreScoped(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	err := store.SetCheckpoint(context.Background(), newCheckpoint(ns, consumerGroup, "0", 100), nil)
+	require.NoError(t, err)
+
+	err = store.SetCheckpoint(context.Background(), newCheckpoint(ns, "other-consumer-group", "0", 200), nil)
+	require.NoError(t, err)
+
+	otherHub := newCheckpoint(ns, consumerGroup, "0", 300)
+	otherHub.EventHubName = "other-event-hub-name"
+	err = store.SetCheckpoint(context.Background(), otherHub, nil)
+	require.NoError(t, err)
+
+	checkpoints, err := store.ListCheckpoints(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{newCheckpoint(ns, consumerGroup, "0", 100)}, checkpoints)
+
+	checkpoints, err = store.ListCheckpoints(context.Background(), ns, eventHubName, "other-consumer-group", nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{newCheckpoint(ns, "other-consumer-group", "0", 200)}, checkpoints)
+
+	checkpoints, err = store.ListCheckpoints(context.Background(), ns, "other-event-hub-name", consumerGroup, nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{otherHub}, checkpoints)
+}
+
+func testClaimOwnership(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Empty(t, ownerships)
+
+	// the first claim, for an unowned partition, doesn't have an ETag.
+	claim := newOwnership(ns, consumerGroup, "0", "owner-id")
+
+	for i := 0; i < 3; i++ {
+		claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{claim}, nil)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+
+		requireOwnership(t, claim, claimed[0])
+		require.NotNil(t, claimed[0].ETag)
+
+		if claim.ETag != nil {
+			require.NotEqual(t, *claim.ETag, *claimed[0].ETag, "ETag changes each time ownership is claimed")
+		}
+
+		ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+		require.NoError(t, err)
+		require.Len(t, ownerships, 1)
+
+		requireOwnership(t, claim, ownerships[0])
+		require.Equal(t, claimed[0].ETag, ownerships[0].ETag)
+
+		claim = ownerships[0]
+	}
+}
+
+func testClaimOwnershipWithStaleETag(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newOwnership(ns, consumerGroup, "0", "owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	staleClaim := claimed[0]
+
+	// the owner renews their claim, which changes the ETag.
+	renewed, err := store.ClaimOwnership(context.Background(), claimed, nil)
+	require.NoError(t, err)
+	require.Len(t, renewed, 1)
+
+	// a claim with an ETag that no longer matches isn't an error, it just isn't claimed.
+	staleClaim.OwnerID = "new-owner-id"
+	claimed, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{staleClaim}, nil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	require.Equal(t, "owner-id", ownerships[0].OwnerID)
+	require.Equal(t, renewed[0].ETag, ownerships[0].ETag)
+}
+
+func testClaimOwnershipWithoutETagWhenOwned(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newOwnership(ns, consumerGroup, "0", "owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	// a claim without an ETag can only succeed if the partition has never been owned.
+	claimed, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newOwnership(ns, consumerGroup, "0", "new-owner-id")}, nil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	require.Equal(t, "owner-id", ownerships[0].OwnerID)
+}
+
+func testClaimOwnershipPartialSuccess(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newOwnership(ns, consumerGroup, "0", "owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	// partition "0" is already owned, so only partitions "1" and "2" can be claimed.
+	claimed, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{
+		newOwnership(ns, consumerGroup, "0", "new-owner-id"),
+		newOwnership(ns, consumerGroup, "1", "new-owner-id"),
+		newOwnership(ns, consumerGroup, "2", "new-owner-id"),
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+
+	sortOwnerships(claimed)
+	require.Equal(t, "1", claimed[0].PartitionID)
+	require.Equal(t, "2", claimed[1].PartitionID)
+
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	sortOwnerships(ownerships)
+
+	var owners []string
+
+	for _, o := range ownerships {
+		owners = append(owners, o.PartitionID+"="+o.OwnerID)
+	}
+
+	require.Equal(t, []string{"0=owner-id", "1=new-owner-id", "2=new-owner-id"}, owners)
+}
+
+func testOwnershipIsScoped(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{
+		newOwnership(ns, consumerGroup, "0", "owner-id"),
+		newOwnership(ns, "other-consumer-group", "0", "other-owner-id"),
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	requireOwnership(t, newOwnership(ns, consumerGroup, "0", "owner-id"), ownerships[0])
+
+	ownerships, err = store.ListOwnership(context.Background(), ns, eventHubName, "other-consumer-group", nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	requireOwnership(t, newOwnership(ns, "other-consumer-group", "0", "other-owner-id"), ownerships[0])
+
+	ownerships, err = store.ListOwnership(context.Background(), ns, "other-event-hub-name", consumerGroup, nil)
+	require.NoError(t, err)
+	require.Empty(t, ownerships)
+}
+
+func testRelinquishOwnership(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newOwnership(ns, consumerGroup, "0", "owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	// the Processor relinquishes ownership by claiming it with an empty owner ID.
+	claimed[0].OwnerID = ""
+	relinquished, err := store.ClaimOwnership(context.Background(), claimed, nil)
+	require.NoError(t, err)
+	require.Len(t, relinquished, 1)
+	require.Empty(t, relinquished[0].OwnerID)
+
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	require.Empty(t, ownerships[0].OwnerID)
+
+	ownerships[0].OwnerID = "new-owner-id"
+	claimed, err = store.ClaimOwnership(context.Background(), ownerships, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, "new-owner-id", claimed[0].OwnerID)
+}
+
+func testConcurrentClaims(t *testing.T, store azeventhubs.CheckpointStore, ns string) {
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newOwnership(ns, consumerGroup, "0", "owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	const numClaimers = 10
+
+	type claimResult struct {
+		Ownerships []azeventhubs.Ownership
+		Err        error
+	}
+
+	var wg sync.WaitGroup
+	claimsCh := make(chan claimResult, numClaimers)
+
+	// all the claimers have the same ETag, so only one of them can win.
+	for i := 0; i < numClaimers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			claim := claimed[0]
+			claim.OwnerID = fmt.Sprintf("owner-%d", i)
+
+			ownerships, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{claim}, nil)
+			claimsCh <- claimResult{ownerships, err}
+		}(i)
+	}
+
+	wg.Wait()
+	close(claimsCh)
+
+	var winners []azeventhubs.Ownership
+
+	for result := range claimsCh {
+		require.NoError(t, result.Err)
+		winners = append(winners, result.Ownerships...)
+	}
+
+	require.Len(t, winners, 1, "exactly one of the claimers wins")
+
+	ownerships, err := store.ListOwnership(context.Background(), ns, eventHubName, consumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	require.Equal(t, winners[0].OwnerID, ownerships[0].OwnerID)
+	require.Equal(t, winners[0].ETag, ownerships[0].ETag)
+}
+
+func newCheckpoint(ns string, consumerGroup string, partitionID string, i int64) azeventhubs.Checkpoint {
+	return azeventhubs.Checkpoint{
+		FullyQualifiedNamespace: ns,
+		EventHubName:            eventHubName,
+		ConsumerGroup:           consumerGroup,
+		PartitionID:             partitionID,
+		Offset:                  to.Ptr(fmt.Sprintf("%d", i*100)),
+		SequenceNumber:          to.Ptr(i),
+	}
+}
+
+func newOwnership(ns string, consumerGroup string, partitionID string, ownerID string) azeventhubs.Ownership {
+	return azeventhubs.Ownership{
+		FullyQualifiedNamespace: ns,
+		EventHubName:            eventHubName,
+		ConsumerGroup:           consumerGroup,
+		PartitionID:             partitionID,
+		OwnerID:                 ownerID,
+	}
+}
+
+// requireOwnership checks that actual has the same identity and owner as expected, and that the
+// store filled out the ETag and LastModifiedTime.
+func requireOwnership(t *testing.T, expected azeventhubs.Ownership, actual azeventhubs.Ownership) {
+	require.Equal(t, expected.FullyQualifiedNamespace, actual.FullyQualifiedNamespace)
+	require.Equal(t, expected.EventHubName, actual.EventHubName)
+	require.Equal(t, expected.ConsumerGroup, actual.ConsumerGroup)
+	require.Equal(t, expected.PartitionID, actual.PartitionID)
+	require.Equal(t, expected.OwnerID, actual.OwnerID)
+
+	require.NotNil(t, actual.ETag)
+	require.NotEqual(t, azcore.ETag(""), *actual.ETag)
+
+	// the Processor uses LastModifiedTime to expire ownership, so it has to be close to the current time.
+	require.WithinDuration(t, time.Now(), actual.LastModifiedTime, 5*time.Minute)
+}
+
+func sortCheckpoints(checkpoints []azeventhubs.Checkpoint) []azeventhubs.Checkpoint {
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].PartitionID < checkpoints[j].PartitionID
+	})
+
+	return checkpoints
+}
+
+func sortOwnerships(ownerships []azeventhubs.Ownership) {
+	sort.Slice(ownerships, func(i, j int) bool {
+		return ownerships[i].PartitionID < ownerships[j].PartitionID
+	})
+}
@@ -0,0 +1,8 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package cosmosstore provides a CheckpointStore for the azeventhubs [Processor] that uses an Azure Cosmos DB
+// for NoSQL container.
+//
+// [Processor]: https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2#Processor
+package cosmosstore
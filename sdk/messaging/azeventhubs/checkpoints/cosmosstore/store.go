@@ -0,0 +1,314 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cosmosstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+)
+
+// Store is a CheckpointStore implementation that uses an Azure Cosmos DB for NoSQL container.
+//
+// Each consumer group is stored as two logical partitions in the container, one for ownership and
+// one for checkpoints, with an item for each Event Hubs partition.
+type Store struct {
+	client cosmosContainerClient
+}
+
+// StoreOptions contains optional parameters for the NewStore function
+type StoreOptions struct {
+	// For future expansion
+}
+
+// cosmosContainerClient is the subset of [azcosmos.ContainerClient] that the Store uses.
+type cosmosContainerClient interface {
+	CreateItem(ctx context.Context, partitionKey azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+	NewQueryItemsPager(query string, partitionKey azcosmos.PartitionKey, o *azcosmos.QueryOptions) *runtime.Pager[azcosmos.QueryItemsResponse]
+	ReplaceItem(ctx context.Context, partitionKey azcosmos.PartitionKey, itemId string, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+	UpsertItem(ctx context.Context, partitionKey azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error)
+}
+
+// NewStore creates a checkpoint store that stores ownership and checkpoints in
+// an Azure Cosmos DB container.
+// NOTE: the container must exist before the checkpoint store can be used, and its partition
+// key path must be "/partitionKey".
+func NewStore(containerClient *azcosmos.ContainerClient, options *StoreOptions) (*Store, error) {
+	return &Store{
+		client: containerClient,
+	}, nil
+}
+
+// cosmosOwnershipItem is the item stored for each partition's ownership.
+type cosmosOwnershipItem struct {
+	ID           string `json:"id"`
+	PartitionKey string `json:"partitionKey"`
+	OwnerID      string `json:"ownerId"`
+
+	// set by Cosmos DB
+	ETag      azcore.ETag `json:"_etag,omitempty"`
+	Timestamp int64       `json:"_ts,omitempty"`
+}
+
+// cosmosCheckpointItem is the item stored for each partition's checkpoint.
+type cosmosCheckpointItem struct {
+	ID             string  `json:"id"`
+	PartitionKey   string  `json:"partitionKey"`
+	Offset         *string `json:"offset,omitempty"`
+	SequenceNumber *int64  `json:"sequenceNumber,omitempty"`
+}
+
+// ClaimOwnership attempts to claim ownership of the partitions in partitionOwnership and returns
+// the actual partitions that were claimed.
+//
+// If we fail to claim ownership because of another update then it will be omitted from the
+// returned slice of [Ownership]'s. It is not considered an error.
+func (s *Store) ClaimOwnership(ctx context.Context, partitionOwnership []azeventhubs.Ownership, options *azeventhubs.ClaimOwnershipOptions) ([]azeventhubs.Ownership, error) {
+	var ownerships []azeventhubs.Ownership
+
+	for _, po := range partitionOwnership {
+		partitionKey, err := partitionKeyForOwnership(po.FullyQualifiedNamespace, po.EventHubName, po.ConsumerGroup)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if po.PartitionID == "" {
+			return nil, errors.New("missing partition ID for ownership")
+		}
+
+		item, err := s.setOwnershipItem(ctx, partitionKey, po)
+
+		if err != nil {
+			if isCosmosConflict(err) {
+				log.Writef(azeventhubs.EventConsumer, "[%s] skipping %s because: %s", po.OwnerID, po.PartitionID, err)
+				continue
+			}
+
+			return nil, err
+		}
+
+		newOwnership := po
+		newOwnership.ETag = &item.ETag
+		newOwnership.LastModifiedTime = time.Unix(item.Timestamp, 0).UTC()
+
+		ownerships = append(ownerships, newOwnership)
+	}
+
+	return ownerships, nil
+}
+
+// ListCheckpoints lists all the available checkpoints.
+func (s *Store) ListCheckpoints(ctx context.Context, fullyQualifiedNamespace string, eventHubName string, consumerGroup string, options *azeventhubs.ListCheckpointsOptions) ([]azeventhubs.Checkpoint, error) {
+	partitionKey, err := partitionKeyForCheckpoints(fullyQualifiedNamespace, eventHubName, consumerGroup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []azeventhubs.Checkpoint
+
+	err = s.listItems(ctx, partitionKey, func(rawItem []byte) error {
+		var item cosmosCheckpointItem
+
+		if err := json.Unmarshal(rawItem, &item); err != nil {
+			return err
+		}
+
+		if item.SequenceNumber == nil {
+			return errors.New("sequenceNumber is missing from item")
+		}
+
+		if item.Offset == nil {
+			return errors.New("offset is missing from item")
+		}
+
+		checkpoints = append(checkpoints, azeventhubs.Checkpoint{
+			FullyQualifiedNamespace: fullyQualifiedNamespace,
+			EventHubName:            eventHubName,
+			ConsumerGroup:           consumerGroup,
+			PartitionID:             item.ID,
+			Offset:                  item.Offset,
+			SequenceNumber:          item.SequenceNumber,
+		})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+// ListOwnership lists all ownerships.
+func (s *Store) ListOwnership(ctx context.Context, fullyQualifiedNamespace string, eventHubName string, consumerGroup string, options *azeventhubs.ListOwnershipOptions) ([]azeventhubs.Ownership, error) {
+	partitionKey, err := partitionKeyForOwnership(fullyQualifiedNamespace, eventHubName, consumerGroup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ownerships []azeventhubs.Ownership
+
+	err = s.listItems(ctx, partitionKey, func(rawItem []byte) error {
+		var item cosmosOwnershipItem
+
+		if err := json.Unmarshal(rawItem, &item); err != nil {
+			return err
+		}
+
+		ownerships = append(ownerships, azeventhubs.Ownership{
+			FullyQualifiedNamespace: fullyQualifiedNamespace,
+			EventHubName:            eventHubName,
+			ConsumerGroup:           consumerGroup,
+			PartitionID:             item.ID,
+			OwnerID:                 item.OwnerID,
+			LastModifiedTime:        time.Unix(item.Timestamp, 0).UTC(),
+			ETag:                    &item.ETag,
+		})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ownerships, nil
+}
+
+// SetCheckpoint updates a specific checkpoint with a sequence and offset.
+//
+// NOTE: This function doesn't attempt to prevent simultaneous checkpoint updates - ownership is assumed.
+func (s *Store) SetCheckpoint(ctx context.Context, checkpoint azeventhubs.Checkpoint, options *azeventhubs.SetCheckpointOptions) error {
+	partitionKey, err := partitionKeyForCheckpoints(checkpoint.FullyQualifiedNamespace, checkpoint.EventHubName, checkpoint.ConsumerGroup)
+
+	if err != nil {
+		return err
+	}
+
+	if checkpoint.PartitionID == "" {
+		return errors.New("missing partition ID for checkpoint")
+	}
+
+	item, err := json.Marshal(cosmosCheckpointItem{
+		ID:             checkpoint.PartitionID,
+		PartitionKey:   partitionKey,
+		Offset:         checkpoint.Offset,
+		SequenceNumber: checkpoint.SequenceNumber,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.UpsertItem(ctx, azcosmos.NewPartitionKeyString(partitionKey), item, nil)
+	return err
+}
+
+// setOwnershipItem creates the ownership item if ownership.ETag is nil, otherwise it replaces
+// the existing item, as long as its ETag still matches. It returns the item that was written.
+func (s *Store) setOwnershipItem(ctx context.Context, partitionKey string, ownership azeventhubs.Ownership) (cosmosOwnershipItem, error) {
+	item, err := json.Marshal(cosmosOwnershipItem{
+		ID:           ownership.PartitionID,
+		PartitionKey: partitionKey,
+		OwnerID:      ownership.OwnerID,
+	})
+
+	if err != nil {
+		return cosmosOwnershipItem{}, err
+	}
+
+	var resp azcosmos.ItemResponse
+
+	if ownership.ETag != nil {
+		log.Writef(azeventhubs.EventConsumer, "[%s] claiming ownership for %s with etag %s", ownership.OwnerID, ownership.PartitionID, string(*ownership.ETag))
+		resp, err = s.client.ReplaceItem(ctx, azcosmos.NewPartitionKeyString(partitionKey), ownership.PartitionID, item, &azcosmos.ItemOptions{
+			IfMatchEtag:                  ownership.ETag,
+			EnableContentResponseOnWrite: true,
+		})
+	} else {
+		log.Writef(azeventhubs.EventConsumer, "[%s] claiming ownership for %s with NO etags", ownership.PartitionID, ownership.OwnerID)
+		resp, err = s.client.CreateItem(ctx, azcosmos.NewPartitionKeyString(partitionKey), item, &azcosmos.ItemOptions{
+			EnableContentResponseOnWrite: true,
+		})
+	}
+
+	if err != nil {
+		return cosmosOwnershipItem{}, err
+	}
+
+	var written cosmosOwnershipItem
+
+	if err := json.Unmarshal(resp.Value, &written); err != nil {
+		return cosmosOwnershipItem{}, err
+	}
+
+	if written.ETag == "" {
+		written.ETag = resp.ETag
+	}
+
+	return written, nil
+}
+
+func (s *Store) listItems(ctx context.Context, partitionKey string, fn func(item []byte) error) error {
+	pager := s.client.NewQueryItemsPager("SELECT * FROM c", azcosmos.NewPartitionKeyString(partitionKey), nil)
+
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		for _, item := range resp.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isCosmosConflict returns true if the item was created, or replaced, by someone else before we
+// could create or replace it.
+func isCosmosConflict(err error) bool {
+	var respErr *azcore.ResponseError
+
+	if !errors.As(err, &respErr) {
+		return false
+	}
+
+	return respErr.StatusCode == http.StatusConflict || respErr.StatusCode == http.StatusPreconditionFailed
+}
+
+// partitionKeyForOwnership returns the partition key value for ownership in a consumer group.
+func partitionKeyForOwnership(fullyQualifiedNamespace string, eventHubName string, consumerGroup string) (string, error) {
+	return partitionKeyFor(fullyQualifiedNamespace, eventHubName, consumerGroup, "ownership")
+}
+
+// partitionKeyForCheckpoints returns the partition key value for checkpoints in a consumer group.
+func partitionKeyForCheckpoints(fullyQualifiedNamespace string, eventHubName string, consumerGroup string) (string, error) {
+	return partitionKeyFor(fullyQualifiedNamespace, eventHubName, consumerGroup, "checkpoint")
+}
+
+func partitionKeyFor(fullyQualifiedNamespace string, eventHubName string, consumerGroup string, kind string) (string, error) {
+	if fullyQualifiedNamespace == "" || eventHubName == "" || consumerGroup == "" {
+		return "", errors.New("missing fields for partition key")
+	}
+
+	// ownership : fully-qualified-namespace|event-hub-name|consumer-group|ownership
+	// checkpoint: fully-qualified-namespace|event-hub-name|consumer-group|checkpoint
+	return strings.Join([]string{fullyQualifiedNamespace, eventHubName, consumerGroup, kind}, "|"), nil
+}
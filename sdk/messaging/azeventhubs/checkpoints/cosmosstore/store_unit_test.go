@@ -0,0 +1,288 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cosmosstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/checkpoints/cosmosstore/internal/checkpointstoretest"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	client := newFakeCosmosContainer()
+
+	checkpointstoretest.Run(t, func(t *testing.T) azeventhubs.CheckpointStore {
+		return &Store{client: client}
+	})
+}
+
+func TestStore_ClaimOwnership(t *testing.T) {
+	store := &Store{client: newFakeCosmosContainer()}
+	claim := newTestOwnership("0", "owner-id")
+
+	// the first claim, for an unowned partition, doesn't have an ETag.
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{claim}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NotNil(t, claimed[0].ETag)
+	require.WithinDuration(t, time.Now(), claimed[0].LastModifiedTime, time.Minute)
+
+	// a claim without an ETag can only succeed if the partition has never been owned.
+	other, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newTestOwnership("0", "other-owner-id"), newTestOwnership("1", "other-owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, other, 1)
+	require.Equal(t, "1", other[0].PartitionID)
+
+	// renewing the claim changes the ETag, so the previous ETag is stale.
+	renewed, err := store.ClaimOwnership(context.Background(), claimed, nil)
+	require.NoError(t, err)
+	require.Len(t, renewed, 1)
+	require.NotEqual(t, *claimed[0].ETag, *renewed[0].ETag)
+
+	stale := claimed[0]
+	stale.OwnerID = "other-owner-id"
+	other, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{stale}, nil)
+	require.NoError(t, err)
+	require.Empty(t, other)
+
+	// the Processor relinquishes ownership by claiming it with an empty owner ID.
+	renewed[0].OwnerID = ""
+	_, err = store.ClaimOwnership(context.Background(), renewed, nil)
+	require.NoError(t, err)
+
+	ownerships, err := store.ListOwnership(context.Background(), claim.FullyQualifiedNamespace, claim.EventHubName, claim.ConsumerGroup, nil)
+	require.NoError(t, err)
+	sort.Slice(ownerships, func(i, j int) bool { return ownerships[i].PartitionID < ownerships[j].PartitionID })
+	require.Len(t, ownerships, 2)
+	require.Empty(t, ownerships[0].OwnerID)
+	require.Equal(t, "other-owner-id", ownerships[1].OwnerID)
+	require.NotNil(t, ownerships[1].ETag)
+
+	ownerships, err = store.ListOwnership(context.Background(), claim.FullyQualifiedNamespace, claim.EventHubName, "other-consumer-group", nil)
+	require.NoError(t, err)
+	require.Empty(t, ownerships)
+}
+
+func TestStore_Checkpoints(t *testing.T) {
+	store := &Store{client: newFakeCosmosContainer()}
+
+	for i := int64(0); i < 2; i++ {
+		err := store.SetCheckpoint(context.Background(), newTestCheckpoint("0", "$Default", i), nil)
+		require.NoError(t, err)
+	}
+
+	err := store.SetCheckpoint(context.Background(), newTestCheckpoint("0", "other-consumer-group", 100), nil)
+	require.NoError(t, err)
+
+	checkpoints, err := store.ListCheckpoints(context.Background(), "ns.servicebus.windows.net", "event-hub-name", "$Default", nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{newTestCheckpoint("0", "$Default", 1)}, checkpoints)
+
+	checkpoints, err = store.ListCheckpoints(context.Background(), "ns.servicebus.windows.net", "event-hub-name", "other-consumer-group", nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{newTestCheckpoint("0", "other-consumer-group", 100)}, checkpoints)
+}
+
+func TestStore_MissingFields(t *testing.T) {
+	store := &Store{client: newFakeCosmosContainer()}
+
+	_, err := store.ListOwnership(context.Background(), "", "eh", "cg", nil)
+	require.EqualError(t, err, "missing fields for partition key")
+
+	err = store.SetCheckpoint(context.Background(), azeventhubs.Checkpoint{FullyQualifiedNamespace: "ns", EventHubName: "eh", ConsumerGroup: "cg"}, nil)
+	require.EqualError(t, err, "missing partition ID for checkpoint")
+
+	_, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{{FullyQualifiedNamespace: "ns", EventHubName: "eh", ConsumerGroup: "cg"}}, nil)
+	require.EqualError(t, err, "missing partition ID for ownership")
+}
+
+func TestStore_isCosmosConflict(t *testing.T) {
+	require.True(t, isCosmosConflict(&azcore.ResponseError{StatusCode: http.StatusConflict}))
+	require.True(t, isCosmosConflict(fmt.Errorf("wrapped: %w", &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed})))
+	require.False(t, isCosmosConflict(&azcore.ResponseError{StatusCode: http.StatusNotFound}))
+	require.False(t, isCosmosConflict(context.Canceled))
+}
+
+// fakeCosmosContainer implements enough of Azure Cosmos DB's semantics to test the Store.
+type fakeCosmosContainer struct {
+	mu    sync.Mutex
+	etag  int
+	items map[string]map[string]map[string]any // partition key -> id -> item
+}
+
+func newFakeCosmosContainer() *fakeCosmosContainer {
+	return &fakeCosmosContainer{items: map[string]map[string]map[string]any{}}
+}
+
+func (fc *fakeCosmosContainer) CreateItem(ctx context.Context, partitionKey azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	pk, props, err := fc.unmarshal(partitionKey, item)
+
+	if err != nil {
+		return azcosmos.ItemResponse{}, err
+	}
+
+	if _, exists := fc.items[pk][props["id"].(string)]; exists {
+		return azcosmos.ItemResponse{}, &azcore.ResponseError{StatusCode: http.StatusConflict}
+	}
+
+	return fc.store(pk, props, o)
+}
+
+func (fc *fakeCosmosContainer) ReplaceItem(ctx context.Context, partitionKey azcosmos.PartitionKey, itemId string, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	pk, props, err := fc.unmarshal(partitionKey, item)
+
+	if err != nil {
+		return azcosmos.ItemResponse{}, err
+	}
+
+	current, exists := fc.items[pk][itemId]
+
+	if !exists {
+		return azcosmos.ItemResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound}
+	}
+
+	if o != nil && o.IfMatchEtag != nil && string(*o.IfMatchEtag) != current["_etag"] {
+		return azcosmos.ItemResponse{}, &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed}
+	}
+
+	return fc.store(pk, props, o)
+}
+
+func (fc *fakeCosmosContainer) UpsertItem(ctx context.Context, partitionKey azcosmos.PartitionKey, item []byte, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	pk, props, err := fc.unmarshal(partitionKey, item)
+
+	if err != nil {
+		return azcosmos.ItemResponse{}, err
+	}
+
+	return fc.store(pk, props, o)
+}
+
+func (fc *fakeCosmosContainer) NewQueryItemsPager(query string, partitionKey azcosmos.PartitionKey, o *azcosmos.QueryOptions) *runtime.Pager[azcosmos.QueryItemsResponse] {
+	return runtime.NewPager(runtime.PagingHandler[azcosmos.QueryItemsResponse]{
+		More: func(azcosmos.QueryItemsResponse) bool { return false },
+		Fetcher: func(ctx context.Context, _ *azcosmos.QueryItemsResponse) (azcosmos.QueryItemsResponse, error) {
+			fc.mu.Lock()
+			defer fc.mu.Unlock()
+
+			pk := fc.partitionKeyValue(partitionKey)
+
+			var resp azcosmos.QueryItemsResponse
+
+			for _, props := range fc.items[pk] {
+				value, err := json.Marshal(props)
+
+				if err != nil {
+					return azcosmos.QueryItemsResponse{}, err
+				}
+
+				resp.Items = append(resp.Items, value)
+			}
+
+			return resp, nil
+		},
+	})
+}
+
+func (fc *fakeCosmosContainer) partitionKeyValue(partitionKey azcosmos.PartitionKey) string {
+	// PartitionKey doesn't expose its values, so we look for the stored partition key that it matches.
+	for pk := range fc.items {
+		if reflect.DeepEqual(azcosmos.NewPartitionKeyString(pk), partitionKey) {
+			return pk
+		}
+	}
+
+	return ""
+}
+
+func (fc *fakeCosmosContainer) unmarshal(partitionKey azcosmos.PartitionKey, item []byte) (string, map[string]any, error) {
+	var props map[string]any
+
+	if err := json.Unmarshal(item, &props); err != nil {
+		return "", nil, err
+	}
+
+	pk, _ := props["partitionKey"].(string)
+
+	if !reflect.DeepEqual(azcosmos.NewPartitionKeyString(pk), partitionKey) {
+		return "", nil, &azcore.ResponseError{StatusCode: http.StatusBadRequest}
+	}
+
+	return pk, props, nil
+}
+
+// store adds the service-assigned properties to the item and stores it.
+func (fc *fakeCosmosContainer) store(pk string, props map[string]any, o *azcosmos.ItemOptions) (azcosmos.ItemResponse, error) {
+	fc.etag++
+	etag := fmt.Sprintf(`"%08d-0000-0000-0000-000000000000"`, fc.etag)
+
+	props["_etag"] = etag
+	props["_ts"] = time.Now().Unix()
+
+	if fc.items[pk] == nil {
+		fc.items[pk] = map[string]map[string]any{}
+	}
+
+	fc.items[pk][props["id"].(string)] = props
+
+	resp := azcosmos.ItemResponse{
+		Response: azcosmos.Response{ETag: azcore.ETag(etag)},
+	}
+
+	if o != nil && o.EnableContentResponseOnWrite {
+		value, err := json.Marshal(props)
+
+		if err != nil {
+			return azcosmos.ItemResponse{}, err
+		}
+
+		resp.Value = value
+	}
+
+	return resp, nil
+}
+
+func newTestOwnership(partitionID string, ownerID string) azeventhubs.Ownership {
+	return azeventhubs.Ownership{
+		FullyQualifiedNamespace: "ns.servicebus.windows.net",
+		EventHubName:            "event-hub-name",
+		ConsumerGroup:           azeventhubs.DefaultConsumerGroup,
+		PartitionID:             partitionID,
+		OwnerID:                 ownerID,
+	}
+}
+
+func newTestCheckpoint(partitionID string, consumerGroup string, i int64) azeventhubs.Checkpoint {
+	return azeventhubs.Checkpoint{
+		FullyQualifiedNamespace: "ns.servicebus.windows.net",
+		EventHubName:            "event-hub-name",
+		ConsumerGroup:           consumerGroup,
+		PartitionID:             partitionID,
+		Offset:                  to.Ptr(fmt.Sprintf("%d", i*100)),
+		SequenceNumber:          to.Ptr(i),
+	}
+}
@@ -0,0 +1,8 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package tablestore provides a CheckpointStore for the azeventhubs [Processor] that uses Azure Table storage,
+// or the Azure Cosmos DB for Table API.
+//
+// [Processor]: https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2#Processor
+package tablestore
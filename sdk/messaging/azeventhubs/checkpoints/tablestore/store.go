@@ -0,0 +1,375 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package tablestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+)
+
+// Store is a CheckpointStore implementation that uses Azure Table storage, or the
+// Azure Cosmos DB for Table API.
+//
+// Each consumer group is stored as two partitions in the table, one for ownership and one for
+// checkpoints, with an entity for each Event Hubs partition.
+type Store struct {
+	client tableClient
+}
+
+// StoreOptions contains optional parameters for the NewStore function
+type StoreOptions struct {
+	// For future expansion
+}
+
+// tableClient is the subset of [aztables.Client] that the Store uses.
+type tableClient interface {
+	AddEntity(ctx context.Context, entity []byte, options *aztables.AddEntityOptions) (aztables.AddEntityResponse, error)
+	NewListEntitiesPager(listOptions *aztables.ListEntitiesOptions) *runtime.Pager[aztables.ListEntitiesResponse]
+	UpdateEntity(ctx context.Context, entity []byte, options *aztables.UpdateEntityOptions) (aztables.UpdateEntityResponse, error)
+	UpsertEntity(ctx context.Context, entity []byte, options *aztables.UpsertEntityOptions) (aztables.UpsertEntityResponse, error)
+}
+
+// NewStore creates a checkpoint store that stores ownership and checkpoints in
+// Azure Table storage.
+// NOTE: the table must exist before the checkpoint store can be used.
+func NewStore(tableClient *aztables.Client, options *StoreOptions) (*Store, error) {
+	return &Store{
+		client: tableClient,
+	}, nil
+}
+
+// ClaimOwnership attempts to claim ownership of the partitions in partitionOwnership and returns
+// the actual partitions that were claimed.
+//
+// If we fail to claim ownership because of another update then it will be omitted from the
+// returned slice of [Ownership]'s. It is not considered an error.
+func (s *Store) ClaimOwnership(ctx context.Context, partitionOwnership []azeventhubs.Ownership, options *azeventhubs.ClaimOwnershipOptions) ([]azeventhubs.Ownership, error) {
+	var ownerships []azeventhubs.Ownership
+
+	for _, po := range partitionOwnership {
+		partitionKey, err := partitionKeyForOwnership(po.FullyQualifiedNamespace, po.EventHubName, po.ConsumerGroup)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if po.PartitionID == "" {
+			return nil, errors.New("missing partition ID for ownership")
+		}
+
+		etag, err := s.setOwnershipEntity(ctx, partitionKey, po)
+
+		if err != nil {
+			if isTableConflict(err) {
+				log.Writef(azeventhubs.EventConsumer, "[%s] skipping %s because: %s", po.OwnerID, po.PartitionID, err)
+				continue
+			}
+
+			return nil, err
+		}
+
+		newOwnership := po
+		newOwnership.ETag = &etag
+		newOwnership.LastModifiedTime = lastModifiedFromTableETag(etag)
+
+		ownerships = append(ownerships, newOwnership)
+	}
+
+	return ownerships, nil
+}
+
+// ListCheckpoints lists all the available checkpoints.
+func (s *Store) ListCheckpoints(ctx context.Context, fullyQualifiedNamespace string, eventHubName string, consumerGroup string, options *azeventhubs.ListCheckpointsOptions) ([]azeventhubs.Checkpoint, error) {
+	partitionKey, err := partitionKeyForCheckpoints(fullyQualifiedNamespace, eventHubName, consumerGroup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []azeventhubs.Checkpoint
+
+	err = s.listEntities(ctx, partitionKey, func(entity aztables.EDMEntity) error {
+		cp := azeventhubs.Checkpoint{
+			FullyQualifiedNamespace: fullyQualifiedNamespace,
+			EventHubName:            eventHubName,
+			ConsumerGroup:           consumerGroup,
+			PartitionID:             entity.RowKey,
+		}
+
+		if err := updateCheckpointFromEntity(entity.Properties, &cp); err != nil {
+			return err
+		}
+
+		checkpoints = append(checkpoints, cp)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+// ListOwnership lists all ownerships.
+func (s *Store) ListOwnership(ctx context.Context, fullyQualifiedNamespace string, eventHubName string, consumerGroup string, options *azeventhubs.ListOwnershipOptions) ([]azeventhubs.Ownership, error) {
+	partitionKey, err := partitionKeyForOwnership(fullyQualifiedNamespace, eventHubName, consumerGroup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ownerships []azeventhubs.Ownership
+
+	err = s.listEntities(ctx, partitionKey, func(entity aztables.EDMEntity) error {
+		// an empty owner ID is a partition that was owned, but was relinquished.
+		ownerID, _ := entity.Properties["OwnerID"].(string)
+
+		ownerships = append(ownerships, azeventhubs.Ownership{
+			FullyQualifiedNamespace: fullyQualifiedNamespace,
+			EventHubName:            eventHubName,
+			ConsumerGroup:           consumerGroup,
+			PartitionID:             entity.RowKey,
+			OwnerID:                 ownerID,
+			LastModifiedTime:        time.Time(entity.Timestamp),
+			ETag:                    to.Ptr(azcore.ETag(entity.ETag)),
+		})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ownerships, nil
+}
+
+// SetCheckpoint updates a specific checkpoint with a sequence and offset.
+//
+// NOTE: This function doesn't attempt to prevent simultaneous checkpoint updates - ownership is assumed.
+func (s *Store) SetCheckpoint(ctx context.Context, checkpoint azeventhubs.Checkpoint, options *azeventhubs.SetCheckpointOptions) error {
+	partitionKey, err := partitionKeyForCheckpoints(checkpoint.FullyQualifiedNamespace, checkpoint.EventHubName, checkpoint.ConsumerGroup)
+
+	if err != nil {
+		return err
+	}
+
+	if checkpoint.PartitionID == "" {
+		return errors.New("missing partition ID for checkpoint")
+	}
+
+	properties := map[string]any{}
+
+	if checkpoint.SequenceNumber != nil {
+		properties["SequenceNumber"] = aztables.EDMInt64(*checkpoint.SequenceNumber)
+	}
+
+	if checkpoint.Offset != nil {
+		properties["Offset"] = *checkpoint.Offset
+	}
+
+	entity, err := json.Marshal(aztables.EDMEntity{
+		Entity: aztables.Entity{
+			PartitionKey: partitionKey,
+			RowKey:       checkpoint.PartitionID,
+		},
+		Properties: properties,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.UpsertEntity(ctx, entity, &aztables.UpsertEntityOptions{
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	return err
+}
+
+// setOwnershipEntity creates the ownership entity if ownership.ETag is nil, otherwise it replaces
+// the existing entity, as long as its ETag still matches.
+func (s *Store) setOwnershipEntity(ctx context.Context, partitionKey string, ownership azeventhubs.Ownership) (azcore.ETag, error) {
+	entity, err := json.Marshal(aztables.EDMEntity{
+		Entity: aztables.Entity{
+			PartitionKey: partitionKey,
+			RowKey:       ownership.PartitionID,
+		},
+		Properties: map[string]any{
+			"OwnerID": ownership.OwnerID,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if ownership.ETag != nil {
+		log.Writef(azeventhubs.EventConsumer, "[%s] claiming ownership for %s with etag %s", ownership.OwnerID, ownership.PartitionID, string(*ownership.ETag))
+		resp, err := s.client.UpdateEntity(ctx, entity, &aztables.UpdateEntityOptions{
+			IfMatch:    ownership.ETag,
+			UpdateMode: aztables.UpdateModeReplace,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return resp.ETag, nil
+	}
+
+	log.Writef(azeventhubs.EventConsumer, "[%s] claiming ownership for %s with NO etags", ownership.PartitionID, ownership.OwnerID)
+	resp, err := s.client.AddEntity(ctx, entity, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ETag, nil
+}
+
+func (s *Store) listEntities(ctx context.Context, partitionKey string, fn func(entity aztables.EDMEntity) error) error {
+	pager := s.client.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: to.Ptr(partitionKeyFilter(partitionKey)),
+	})
+
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		for _, rawEntity := range resp.Entities {
+			var entity aztables.EDMEntity
+
+			if err := json.Unmarshal(rawEntity, &entity); err != nil {
+				return err
+			}
+
+			if err := fn(entity); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isTableConflict returns true if the entity was created, or updated, by someone else before we
+// could create or update it.
+func isTableConflict(err error) bool {
+	var respErr *azcore.ResponseError
+
+	if !errors.As(err, &respErr) {
+		return false
+	}
+
+	switch aztables.TableErrorCode(respErr.ErrorCode) {
+	case aztables.EntityAlreadyExists, aztables.UpdateConditionNotSatisfied:
+		return true
+	}
+
+	return false
+}
+
+func updateCheckpointFromEntity(properties map[string]any, destCheckpoint *azeventhubs.Checkpoint) error {
+	var sequenceNumber int64
+
+	switch v := properties["SequenceNumber"].(type) {
+	case aztables.EDMInt64:
+		sequenceNumber = int64(v)
+	case int32:
+		// small values can come back without their EDM type.
+		sequenceNumber = int64(v)
+	case string:
+		tmp, err := strconv.ParseInt(v, 10, 64)
+
+		if err != nil {
+			return fmt.Errorf("SequenceNumber could not be parsed as an int64: %s", err.Error())
+		}
+
+		sequenceNumber = tmp
+	case nil:
+		return errors.New("SequenceNumber is missing from entity")
+	default:
+		return fmt.Errorf("SequenceNumber has an unexpected type %T", v)
+	}
+
+	offset, ok := properties["Offset"].(string)
+
+	if !ok {
+		return errors.New("Offset is missing from entity")
+	}
+
+	destCheckpoint.Offset = &offset
+	destCheckpoint.SequenceNumber = &sequenceNumber
+	return nil
+}
+
+// lastModifiedFromTableETag gets the time an entity was modified from its ETag, which has the format
+// W/"datetime'<url encoded RFC3339 time>'". Updates don't return the entity's Timestamp, so this avoids
+// mixing the local clock with the service's clock. The current time is used if the ETag can't be parsed.
+func lastModifiedFromTableETag(etag azcore.ETag) time.Time {
+	const prefix = "datetime'"
+
+	s := string(etag)
+	start := strings.Index(s, prefix)
+
+	if start != -1 {
+		s = s[start+len(prefix):]
+
+		if end := strings.Index(s, "'"); end != -1 {
+			if unescaped, err := url.QueryUnescape(s[:end]); err == nil {
+				if t, err := time.Parse(time.RFC3339Nano, unescaped); err == nil {
+					return t
+				}
+			}
+		}
+	}
+
+	return time.Now().UTC()
+}
+
+// partitionKeyForOwnership returns the key for ownership in a consumer group.
+// This key is used as the PartitionKey of the entities.
+func partitionKeyForOwnership(fullyQualifiedNamespace string, eventHubName string, consumerGroup string) (string, error) {
+	return partitionKeyFor(fullyQualifiedNamespace, eventHubName, consumerGroup, "ownership")
+}
+
+// partitionKeyForCheckpoints returns the key for checkpoints in a consumer group.
+// This key is used as the PartitionKey of the entities.
+func partitionKeyForCheckpoints(fullyQualifiedNamespace string, eventHubName string, consumerGroup string) (string, error) {
+	return partitionKeyFor(fullyQualifiedNamespace, eventHubName, consumerGroup, "checkpoint")
+}
+
+// partitionKeyFilter returns an OData filter for the entities with partitionKey. The key
+// includes the namespace, event hub and consumer group names, so any quotes in it are doubled,
+// as OData string literals require.
+func partitionKeyFilter(partitionKey string) string {
+	return "PartitionKey eq '" + strings.ReplaceAll(partitionKey, "'", "''") + "'"
+}
+
+func partitionKeyFor(fullyQualifiedNamespace string, eventHubName string, consumerGroup string, kind string) (string, error) {
+	if fullyQualifiedNamespace == "" || eventHubName == "" || consumerGroup == "" {
+		return "", errors.New("missing fields for partition key")
+	}
+
+	// '/' can't be used in a Table storage key, so we use '|' instead.
+	// ownership : fully-qualified-namespace|event-hub-name|consumer-group|ownership
+	// checkpoint: fully-qualified-namespace|event-hub-name|consumer-group|checkpoint
+	return strings.Join([]string{fullyQualifiedNamespace, eventHubName, consumerGroup, kind}, "|"), nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package tablestore_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/test/credential"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/checkpoints/tablestore"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/checkpoints/tablestore/internal/checkpointstoretest"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Live(t *testing.T) {
+	store := newTableStoreForTest(t)
+
+	ownership := azeventhubs.Ownership{
+		FullyQualifiedNamespace: "ns.servicebus.windows.net",
+		EventHubName:            "event-hub-name",
+		ConsumerGroup:           azeventhubs.DefaultConsumerGroup,
+		PartitionID:             "0",
+		OwnerID:                 "owner-id",
+	}
+
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{ownership}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	renewed, err := store.ClaimOwnership(context.Background(), claimed, nil)
+	require.NoError(t, err)
+	require.Len(t, renewed, 1)
+
+	// the first claim's ETag is stale now.
+	claimed, err = store.ClaimOwnership(context.Background(), claimed, nil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	ownerships, err := store.ListOwnership(context.Background(), ownership.FullyQualifiedNamespace, ownership.EventHubName, ownership.ConsumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 1)
+	require.Equal(t, renewed[0].ETag, ownerships[0].ETag)
+	require.WithinDuration(t, time.Now(), ownerships[0].LastModifiedTime, 5*time.Minute)
+
+	checkpoint := azeventhubs.Checkpoint{
+		FullyQualifiedNamespace: ownership.FullyQualifiedNamespace,
+		EventHubName:            ownership.EventHubName,
+		ConsumerGroup:           ownership.ConsumerGroup,
+		PartitionID:             "0",
+		Offset:                  to.Ptr("202"),
+		SequenceNumber:          to.Ptr(int64(101)),
+	}
+	require.NoError(t, store.SetCheckpoint(context.Background(), checkpoint, nil))
+
+	checkpoints, err := store.ListCheckpoints(context.Background(), ownership.FullyQualifiedNamespace, ownership.EventHubName, ownership.ConsumerGroup, nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{checkpoint}, checkpoints)
+}
+
+func TestStore_LiveConformance(t *testing.T) {
+	store := newTableStoreForTest(t)
+
+	checkpointstoretest.Run(t, func(t *testing.T) azeventhubs.CheckpointStore {
+		return store
+	})
+}
+
+// newTableStoreForTest creates an Azure Storage table and returns a Store that uses it.
+func newTableStoreForTest(t *testing.T) *tablestore.Store {
+	_ = godotenv.Load("../../.env")
+
+	tablesEndpoint := os.Getenv("CHECKPOINTSTORE_TABLES_ENDPOINT")
+
+	if tablesEndpoint == "" {
+		t.Skipf("CHECKPOINTSTORE_TABLES_ENDPOINT is not defined in the environment. Skipping table checkpoint store live tests")
+		return nil
+	}
+
+	cred, err := credential.New(nil)
+	require.NoError(t, err)
+
+	serviceClient, err := aztables.NewServiceClient(tablesEndpoint, cred, nil)
+	require.NoError(t, err)
+
+	tableName := fmt.Sprintf("checkpoints%d", time.Now().UTC().UnixNano())
+
+	_, err = serviceClient.CreateTable(context.Background(), tableName, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, err := serviceClient.DeleteTable(context.Background(), tableName, nil)
+		require.NoError(t, err)
+	})
+
+	tableStore, err := tablestore.NewStore(serviceClient.NewClient(tableName), nil)
+	require.NoError(t, err)
+
+	return tableStore
+}
@@ -0,0 +1,290 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package tablestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/checkpoints/tablestore/internal/checkpointstoretest"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	client := newFakeTable()
+
+	checkpointstoretest.Run(t, func(t *testing.T) azeventhubs.CheckpointStore {
+		return &Store{client: client}
+	})
+}
+
+func TestStore_ClaimOwnership(t *testing.T) {
+	store := &Store{client: newFakeTable()}
+	claim := newTestOwnership("0", "owner-id")
+
+	// the first claim, for an unowned partition, doesn't have an ETag.
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{claim}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NotNil(t, claimed[0].ETag)
+	require.WithinDuration(t, time.Now(), claimed[0].LastModifiedTime, time.Minute)
+
+	// a claim without an ETag can only succeed if the partition has never been owned.
+	other, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{newTestOwnership("0", "other-owner-id"), newTestOwnership("1", "other-owner-id")}, nil)
+	require.NoError(t, err)
+	require.Len(t, other, 1)
+	require.Equal(t, "1", other[0].PartitionID)
+
+	// renewing the claim changes the ETag, so the previous ETag is stale.
+	renewed, err := store.ClaimOwnership(context.Background(), claimed, nil)
+	require.NoError(t, err)
+	require.Len(t, renewed, 1)
+	require.NotEqual(t, *claimed[0].ETag, *renewed[0].ETag)
+
+	stale := claimed[0]
+	stale.OwnerID = "other-owner-id"
+	other, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{stale}, nil)
+	require.NoError(t, err)
+	require.Empty(t, other)
+
+	// the Processor relinquishes ownership by claiming it with an empty owner ID.
+	renewed[0].OwnerID = ""
+	_, err = store.ClaimOwnership(context.Background(), renewed, nil)
+	require.NoError(t, err)
+
+	ownerships, err := store.ListOwnership(context.Background(), claim.FullyQualifiedNamespace, claim.EventHubName, claim.ConsumerGroup, nil)
+	require.NoError(t, err)
+	sort.Slice(ownerships, func(i, j int) bool { return ownerships[i].PartitionID < ownerships[j].PartitionID })
+	require.Len(t, ownerships, 2)
+	require.Empty(t, ownerships[0].OwnerID)
+	require.Equal(t, "other-owner-id", ownerships[1].OwnerID)
+	require.NotNil(t, ownerships[1].ETag)
+
+	ownerships, err = store.ListOwnership(context.Background(), claim.FullyQualifiedNamespace, claim.EventHubName, "other-consumer-group", nil)
+	require.NoError(t, err)
+	require.Empty(t, ownerships)
+}
+
+func TestStore_Checkpoints(t *testing.T) {
+	store := &Store{client: newFakeTable()}
+
+	for i := int64(0); i < 2; i++ {
+		err := store.SetCheckpoint(context.Background(), newTestCheckpoint("0", "$Default", i), nil)
+		require.NoError(t, err)
+	}
+
+	err := store.SetCheckpoint(context.Background(), newTestCheckpoint("0", "other-consumer-group", 100), nil)
+	require.NoError(t, err)
+
+	checkpoints, err := store.ListCheckpoints(context.Background(), "ns.servicebus.windows.net", "event-hub-name", "$Default", nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{newTestCheckpoint("0", "$Default", 1)}, checkpoints)
+
+	checkpoints, err = store.ListCheckpoints(context.Background(), "ns.servicebus.windows.net", "event-hub-name", "other-consumer-group", nil)
+	require.NoError(t, err)
+	require.Equal(t, []azeventhubs.Checkpoint{newTestCheckpoint("0", "other-consumer-group", 100)}, checkpoints)
+}
+
+func TestStore_partitionKeyFilter(t *testing.T) {
+	partitionKey, err := partitionKeyForCheckpoints("ns.servicebus.windows.net", "event-hub-name", "o'brien")
+	require.NoError(t, err)
+	require.Equal(t, `PartitionKey eq 'ns.servicebus.windows.net|event-hub-name|o''brien|checkpoint'`, partitionKeyFilter(partitionKey))
+}
+
+func TestStore_lastModifiedFromTableETag(t *testing.T) {
+	lastModified := lastModifiedFromTableETag(`W/"datetime'2019-04-09T16%3A14%3A11.2730473Z'"`)
+	require.Equal(t, time.Date(2019, 4, 9, 16, 14, 11, 273047300, time.UTC), lastModified)
+
+	// falls back to the current time if the ETag isn't in the expected format.
+	lastModified = lastModifiedFromTableETag(`"not a table etag"`)
+	require.WithinDuration(t, time.Now(), lastModified, time.Minute)
+}
+
+func TestStore_updateCheckpointFromEntity(t *testing.T) {
+	var cp azeventhubs.Checkpoint
+
+	require.NoError(t, updateCheckpointFromEntity(map[string]any{"SequenceNumber": aztables.EDMInt64(101), "Offset": "202"}, &cp))
+	require.Equal(t, int64(101), *cp.SequenceNumber)
+	require.Equal(t, "202", *cp.Offset)
+
+	require.NoError(t, updateCheckpointFromEntity(map[string]any{"SequenceNumber": int32(1), "Offset": "2"}, &cp))
+	require.Equal(t, int64(1), *cp.SequenceNumber)
+
+	require.EqualError(t, updateCheckpointFromEntity(map[string]any{"Offset": "2"}, &cp), "SequenceNumber is missing from entity")
+	require.EqualError(t, updateCheckpointFromEntity(map[string]any{"SequenceNumber": aztables.EDMInt64(1)}, &cp), "Offset is missing from entity")
+	require.EqualError(t, updateCheckpointFromEntity(map[string]any{"SequenceNumber": true, "Offset": "2"}, &cp), "SequenceNumber has an unexpected type bool")
+}
+
+func TestStore_MissingFields(t *testing.T) {
+	store := &Store{client: newFakeTable()}
+
+	_, err := store.ListCheckpoints(context.Background(), "ns", "", "cg", nil)
+	require.EqualError(t, err, "missing fields for partition key")
+
+	err = store.SetCheckpoint(context.Background(), azeventhubs.Checkpoint{FullyQualifiedNamespace: "ns", EventHubName: "eh", ConsumerGroup: "cg"}, nil)
+	require.EqualError(t, err, "missing partition ID for checkpoint")
+
+	_, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{{FullyQualifiedNamespace: "ns", EventHubName: "eh", ConsumerGroup: "cg"}}, nil)
+	require.EqualError(t, err, "missing partition ID for ownership")
+}
+
+// fakeTable implements enough of Azure Table storage's semantics to test the Store.
+type fakeTable struct {
+	mu       sync.Mutex
+	entities map[string]map[string]any // PartitionKey|RowKey -> entity
+}
+
+func newFakeTable() *fakeTable {
+	return &fakeTable{entities: map[string]map[string]any{}}
+}
+
+func (ft *fakeTable) AddEntity(ctx context.Context, entity []byte, options *aztables.AddEntityOptions) (aztables.AddEntityResponse, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	key, props, err := ft.unmarshal(entity)
+
+	if err != nil {
+		return aztables.AddEntityResponse{}, err
+	}
+
+	if _, exists := ft.entities[key]; exists {
+		return aztables.AddEntityResponse{}, &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: string(aztables.EntityAlreadyExists)}
+	}
+
+	etag := ft.store(key, props)
+	value, err := json.Marshal(props)
+
+	return aztables.AddEntityResponse{ETag: etag, Value: value}, err
+}
+
+func (ft *fakeTable) UpdateEntity(ctx context.Context, entity []byte, options *aztables.UpdateEntityOptions) (aztables.UpdateEntityResponse, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	key, props, err := ft.unmarshal(entity)
+
+	if err != nil {
+		return aztables.UpdateEntityResponse{}, err
+	}
+
+	current, exists := ft.entities[key]
+
+	if !exists {
+		return aztables.UpdateEntityResponse{}, &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: string(aztables.ResourceNotFound)}
+	}
+
+	if options != nil && options.IfMatch != nil && string(*options.IfMatch) != current["odata.etag"] {
+		return aztables.UpdateEntityResponse{}, &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed, ErrorCode: string(aztables.UpdateConditionNotSatisfied)}
+	}
+
+	return aztables.UpdateEntityResponse{ETag: ft.store(key, props)}, nil
+}
+
+func (ft *fakeTable) UpsertEntity(ctx context.Context, entity []byte, options *aztables.UpsertEntityOptions) (aztables.UpsertEntityResponse, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	key, props, err := ft.unmarshal(entity)
+
+	if err != nil {
+		return aztables.UpsertEntityResponse{}, err
+	}
+
+	return aztables.UpsertEntityResponse{ETag: ft.store(key, props)}, nil
+}
+
+func (ft *fakeTable) NewListEntitiesPager(listOptions *aztables.ListEntitiesOptions) *runtime.Pager[aztables.ListEntitiesResponse] {
+	// the Store only filters on the PartitionKey
+	partitionKey := strings.TrimSuffix(strings.TrimPrefix(*listOptions.Filter, "PartitionKey eq '"), "'")
+	partitionKey = strings.ReplaceAll(partitionKey, "''", "'")
+
+	return runtime.NewPager(runtime.PagingHandler[aztables.ListEntitiesResponse]{
+		More: func(aztables.ListEntitiesResponse) bool { return false },
+		Fetcher: func(ctx context.Context, _ *aztables.ListEntitiesResponse) (aztables.ListEntitiesResponse, error) {
+			ft.mu.Lock()
+			defer ft.mu.Unlock()
+
+			var resp aztables.ListEntitiesResponse
+
+			for _, props := range ft.entities {
+				if props["PartitionKey"] != partitionKey {
+					continue
+				}
+
+				value, err := json.Marshal(props)
+
+				if err != nil {
+					return aztables.ListEntitiesResponse{}, err
+				}
+
+				resp.Entities = append(resp.Entities, value)
+			}
+
+			return resp, nil
+		},
+	})
+}
+
+func (ft *fakeTable) unmarshal(entity []byte) (string, map[string]any, error) {
+	var props map[string]any
+
+	if err := json.Unmarshal(entity, &props); err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("%s|%s", props["PartitionKey"], props["RowKey"]), props, nil
+}
+
+// store adds the service-assigned properties to the entity and stores it, returning its new ETag.
+func (ft *fakeTable) store(key string, props map[string]any) azcore.ETag {
+	// the service's timestamps have 100ns precision, so they're unique enough to use as the ETag.
+	now := time.Now().UTC().Truncate(100 * time.Nanosecond)
+
+	if current, exists := ft.entities[key]; exists && current["Timestamp"] == now.Format(time.RFC3339Nano) {
+		now = now.Add(100 * time.Nanosecond)
+	}
+
+	etag := fmt.Sprintf(`W/"datetime'%s'"`, url.QueryEscape(now.Format(time.RFC3339Nano)))
+
+	props["Timestamp"] = now.Format(time.RFC3339Nano)
+	props["odata.etag"] = etag
+	ft.entities[key] = props
+
+	return azcore.ETag(etag)
+}
+
+func newTestOwnership(partitionID string, ownerID string) azeventhubs.Ownership {
+	return azeventhubs.Ownership{
+		FullyQualifiedNamespace: "ns.servicebus.windows.net",
+		EventHubName:            "event-hub-name",
+		ConsumerGroup:           azeventhubs.DefaultConsumerGroup,
+		PartitionID:             partitionID,
+		OwnerID:                 ownerID,
+	}
+}
+
+func newTestCheckpoint(partitionID string, consumerGroup string, i int64) azeventhubs.Checkpoint {
+	return azeventhubs.Checkpoint{
+		FullyQualifiedNamespace: "ns.servicebus.windows.net",
+		EventHubName:            "event-hub-name",
+		ConsumerGroup:           consumerGroup,
+		PartitionID:             partitionID,
+		Offset:                  to.Ptr(fmt.Sprintf("%d", i*100)),
+		SequenceNumber:          to.Ptr(i),
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package claimcheck implements the claim-check pattern for events that are too large to send.
+// The body of a large event is uploaded to an Azure Blob Storage container, and the event is sent
+// with a reference to the blob in its properties. When the event is received, the body is
+// downloaded from the blob.
+//
+// [Producer] adds events to an [azeventhubs.EventDataBatch], and [Receiver] wraps an
+// [azeventhubs.PartitionClient] or an [azeventhubs.ProcessorPartitionClient]. [Store] can also be
+// used on its own.
+//
+// Events can be read more than once, so blobs aren't deleted when they're received. Call
+// [Store.Delete] once an event's checkpoint has been updated, or use a lifecycle management
+// policy on the container, based on the event hub's retention, to delete old blobs.
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+const (
+	// BlobNameProperty is the property that holds the name of the blob that contains the event body.
+	BlobNameProperty = "claimcheck-blob-name"
+
+	// BodySizeProperty is the property that holds the size, in bytes, of the event body that's
+	// stored in the blob.
+	BodySizeProperty = "claimcheck-body-size"
+
+	// DefaultThreshold is the default size, in bytes, above which event bodies are stored in a blob.
+	// It leaves room for the event's properties within the 1MB event size of the Standard tier.
+	DefaultThreshold = 768 * 1024
+
+	// DefaultRehydrateTimeout is the default time that Receiver.ReceiveEvents spends downloading
+	// the bodies of the events it received.
+	DefaultRehydrateTimeout = time.Minute
+)
+
+// Store stores event bodies in an Azure Blob Storage container.
+type Store struct {
+	cc        *container.Client
+	threshold int
+}
+
+// StoreOptions contains optional parameters for NewStore.
+type StoreOptions struct {
+	// Threshold is the size, in bytes, above which event bodies are stored in a blob.
+	// Defaults to DefaultThreshold.
+	Threshold int
+}
+
+// NewStore creates a Store that stores event bodies in a container.
+// NOTE: the container must exist before the store can be used.
+func NewStore(containerClient *container.Client, options *StoreOptions) *Store {
+	if options == nil {
+		options = &StoreOptions{}
+	}
+
+	threshold := options.Threshold
+
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	return &Store{cc: containerClient, threshold: threshold}
+}
+
+// Offload stores the body of the event in a blob, if it's larger than the threshold. It returns
+// a copy of the event with an empty body and a reference to the blob, or the event itself if
+// it's small enough to send as is. The event passed in isn't modified.
+func (s *Store) Offload(ctx context.Context, event *azeventhubs.EventData) (*azeventhubs.EventData, error) {
+	if len(event.Body) <= s.threshold {
+		return event, nil
+	}
+
+	id, err := uuid.New()
+
+	if err != nil {
+		return nil, err
+	}
+
+	blobName := id.String()
+
+	_, err = s.cc.NewBlockBlobClient(blobName).UploadBuffer(ctx, event.Body, &blockblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: event.ContentType},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload the event body to blob %q: %w", blobName, err)
+	}
+
+	offloaded := *event
+	offloaded.Body = []byte{}
+	offloaded.Properties = make(map[string]any, len(event.Properties)+2)
+
+	for k, v := range event.Properties {
+		offloaded.Properties[k] = v
+	}
+
+	offloaded.Properties[BlobNameProperty] = blobName
+	offloaded.Properties[BodySizeProperty] = int64(len(event.Body))
+
+	return &offloaded, nil
+}
+
+// Rehydrate downloads the body of an event that was sent with Offload, and replaces the event's
+// body with it. Events that don't reference a blob aren't changed.
+func (s *Store) Rehydrate(ctx context.Context, event *azeventhubs.ReceivedEventData) error {
+	blobName, ok := BlobName(event)
+
+	if !ok {
+		return nil
+	}
+
+	resp, err := s.cc.NewBlobClient(blobName).DownloadStream(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to download the event body from blob %q: %w", blobName, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return fmt.Errorf("failed to download the event body from blob %q: %w", blobName, err)
+	}
+
+	if size, ok := event.Properties[BodySizeProperty].(int64); ok && size != int64(len(body)) {
+		return fmt.Errorf("blob %q has %d bytes, but the event body had %d bytes", blobName, len(body), size)
+	}
+
+	event.Body = body
+	return nil
+}
+
+// Delete deletes the blob that an event references. It does nothing for events that don't
+// reference a blob, or if the blob was already deleted.
+func (s *Store) Delete(ctx context.Context, event *azeventhubs.ReceivedEventData) error {
+	blobName, ok := BlobName(event)
+
+	if !ok {
+		return nil
+	}
+
+	return s.deleteBlob(ctx, blobName)
+}
+
+func (s *Store) deleteBlob(ctx context.Context, blobName string) error {
+	_, err := s.cc.NewBlobClient(blobName).Delete(ctx, &blob.DeleteOptions{
+		DeleteSnapshots: to.Ptr(blob.DeleteSnapshotsOptionTypeInclude),
+	})
+
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("failed to delete blob %q: %w", blobName, err)
+	}
+
+	return nil
+}
+
+// BlobName returns the name of the blob that contains the event body, if the event was sent
+// with Offload.
+func BlobName(event *azeventhubs.ReceivedEventData) (string, bool) {
+	blobName, ok := event.Properties[BlobNameProperty].(string)
+	return blobName, ok && blobName != ""
+}
+
+// Producer adds events to batches for an azeventhubs.ProducerClient, storing large event bodies
+// in a Store.
+type Producer struct {
+	store *Store
+}
+
+// NewProducer creates a Producer.
+func NewProducer(store *Store) *Producer {
+	return &Producer{store: store}
+}
+
+// AddEventData adds an event to a batch, storing its body in a blob if it's larger than the store's
+// threshold. If the event doesn't fit in the batch, the blob is deleted and the error is
+// azeventhubs.ErrEventDataTooLarge, as it is for EventDataBatch.AddEventData.
+//
+// The blobs aren't deleted if the batch can't be sent.
+func (p *Producer) AddEventData(ctx context.Context, batch *azeventhubs.EventDataBatch, event *azeventhubs.EventData, options *azeventhubs.AddEventDataOptions) error {
+	offloaded, err := p.store.Offload(ctx, event)
+
+	if err != nil {
+		return err
+	}
+
+	if err := batch.AddEventData(offloaded, options); err != nil {
+		if offloaded == event {
+			return err
+		}
+
+		if delErr := p.store.deleteBlob(ctx, offloaded.Properties[BlobNameProperty].(string)); delErr != nil {
+			return errors.Join(err, delErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// EventReceiver receives events. It's implemented by azeventhubs.PartitionClient and
+// azeventhubs.ProcessorPartitionClient.
+type EventReceiver interface {
+	ReceiveEvents(ctx context.Context, count int, options *azeventhubs.ReceiveEventsOptions) ([]*azeventhubs.ReceivedEventData, error)
+}
+
+// Receiver receives events with an EventReceiver, downloading the bodies that are stored in a Store.
+type Receiver struct {
+	receiver         EventReceiver
+	store            *Store
+	rehydrateTimeout time.Duration
+}
+
+// ReceiverOptions contains optional parameters for NewReceiver.
+type ReceiverOptions struct {
+	// RehydrateTimeout is the time that ReceiveEvents spends downloading the bodies of the events
+	// it received. Defaults to DefaultRehydrateTimeout.
+	RehydrateTimeout time.Duration
+}
+
+// NewReceiver creates a Receiver.
+func NewReceiver(receiver EventReceiver, store *Store, options *ReceiverOptions) *Receiver {
+	if options == nil {
+		options = &ReceiverOptions{}
+	}
+
+	rehydrateTimeout := options.RehydrateTimeout
+
+	if rehydrateTimeout <= 0 {
+		rehydrateTimeout = DefaultRehydrateTimeout
+	}
+
+	return &Receiver{receiver: receiver, store: store, rehydrateTimeout: rehydrateTimeout}
+}
+
+// ReceiveEvents receives events, and downloads the bodies that are stored in blobs.
+//
+// ReceiveEvents returns the events it received when ctx expires, so their bodies are downloaded
+// with a context that has ctx's values, but that expires after ReceiverOptions.RehydrateTimeout.
+//
+// All the events are returned, in order. If a body can't be downloaded, the event still references
+// its blob, and the error has a [*RehydrateError] for it. Call [Store.Rehydrate] to download the
+// body again before the event's checkpoint is updated.
+func (r *Receiver) ReceiveEvents(ctx context.Context, count int, options *azeventhubs.ReceiveEventsOptions) ([]*azeventhubs.ReceivedEventData, error) {
+	events, err := r.receiver.ReceiveEvents(ctx, count, options)
+
+	if len(events) == 0 {
+		return events, err
+	}
+
+	rehydrateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.rehydrateTimeout)
+	defer cancel()
+
+	var errs []error
+
+	for _, e := range events {
+		if rehydrateErr := r.store.Rehydrate(rehydrateCtx, e); rehydrateErr != nil {
+			errs = append(errs, &RehydrateError{Event: e, Err: rehydrateErr})
+		}
+	}
+
+	// an expired ctx only means that ReceiveEvents stopped waiting for more events, and it would hide
+	// the RehydrateErrors from callers that ignore it.
+	if err != nil && ctx.Err() == nil {
+		errs = append([]error{err}, errs...)
+	}
+
+	if len(errs) == 0 {
+		return events, err
+	}
+
+	return events, errors.Join(errs...)
+}
+
+// RehydrateError is returned by [Receiver.ReceiveEvents] for an event whose body couldn't be
+// downloaded. Use [errors.As] to get it from the error.
+type RehydrateError struct {
+	// Event is the received event, with an empty body and the reference to its blob.
+	Event *azeventhubs.ReceivedEventData
+
+	// Err is the error returned by [Store.Rehydrate].
+	Err error
+}
+
+func (e *RehydrateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RehydrateError) Unwrap() error {
+	return e.Err
+}
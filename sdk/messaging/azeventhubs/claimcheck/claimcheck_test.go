@@ -0,0 +1,339 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package claimcheck_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/claimcheck"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/emulator"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimCheck_SendAndReceive(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	producerClient, consumerClient := newEmulatorClients(t)
+
+	producer := claimcheck.NewProducer(store)
+
+	batch, err := producerClient.NewEventDataBatch(context.Background(), &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")})
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("a"), 2*1024*1024)
+	event := &azeventhubs.EventData{
+		Body:        large,
+		ContentType: to.Ptr("text/plain"),
+		Properties:  map[string]any{"kind": "large"},
+	}
+
+	require.NoError(t, producer.AddEventData(context.Background(), batch, event, nil))
+	require.NoError(t, producer.AddEventData(context.Background(), batch, &azeventhubs.EventData{Body: []byte("small")}, nil))
+	require.NoError(t, producerClient.SendEventDataBatch(context.Background(), batch, nil))
+
+	require.Equal(t, large, event.Body, "the event that's passed in isn't modified")
+	require.Equal(t, map[string]any{"kind": "large"}, event.Properties)
+	require.Len(t, blobs.names(), 1)
+
+	partitionClient, err := consumerClient.NewPartitionClient("0", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+	require.NoError(t, err)
+	defer partitionClient.Close(context.Background())
+
+	receiver := claimcheck.NewReceiver(partitionClient, store, nil)
+
+	events, err := receiver.ReceiveEvents(context.Background(), 2, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	require.Equal(t, large, events[0].Body)
+	require.Equal(t, "large", events[0].Properties["kind"])
+	blobName, ok := claimcheck.BlobName(events[0])
+	require.True(t, ok)
+	require.Equal(t, []string{blobName}, blobs.names())
+	require.Equal(t, "text/plain", blobs.contentTypes[blobName])
+
+	require.Equal(t, []byte("small"), events[1].Body)
+	_, ok = claimcheck.BlobName(events[1])
+	require.False(t, ok)
+
+	for _, e := range events {
+		require.NoError(t, store.Delete(context.Background(), e))
+	}
+
+	require.Empty(t, blobs.names())
+}
+
+func TestClaimCheck_ReceiveEventsAfterDeadline(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	producerClient, consumerClient := newEmulatorClients(t)
+
+	batch, err := producerClient.NewEventDataBatch(context.Background(), &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")})
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("a"), 4096)
+	require.NoError(t, claimcheck.NewProducer(store).AddEventData(context.Background(), batch, &azeventhubs.EventData{Body: large}, nil))
+	require.NoError(t, producerClient.SendEventDataBatch(context.Background(), batch, nil))
+
+	partitionClient, err := consumerClient.NewPartitionClient("0", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+	require.NoError(t, err)
+	defer partitionClient.Close(context.Background())
+
+	receiver := claimcheck.NewReceiver(partitionClient, store, nil)
+
+	// the context expires while waiting for more events, but the body of the event that was
+	// received is still downloaded.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	events, err := receiver.ReceiveEvents(ctx, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, large, events[0].Body)
+
+	blobs.remove(blobs.names()[0])
+	err = store.Rehydrate(context.Background(), events[0])
+	require.ErrorContains(t, err, "failed to download the event body")
+}
+
+func TestClaimCheck_BlobDeletedWhenEventDoesNotFit(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	producerClient, _ := newEmulatorClients(t)
+
+	batch, err := producerClient.NewEventDataBatch(context.Background(), &azeventhubs.EventDataBatchOptions{MaxBytes: 2048})
+	require.NoError(t, err)
+
+	// the body is offloaded, but the event's properties are still too large for the batch.
+	err = claimcheck.NewProducer(store).AddEventData(context.Background(), batch, &azeventhubs.EventData{
+		Body:       bytes.Repeat([]byte("a"), 4096),
+		Properties: map[string]any{"padding": strings.Repeat("p", 4096)},
+	}, nil)
+	require.ErrorIs(t, err, azeventhubs.ErrEventDataTooLarge)
+	require.Empty(t, blobs.names())
+}
+
+func TestClaimCheck_ReceiveEventsReturnsEventsWithError(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), nil)
+
+	missing := &azeventhubs.ReceivedEventData{EventData: azeventhubs.EventData{
+		Properties: map[string]any{claimcheck.BlobNameProperty: "missing"},
+	}}
+	small := &azeventhubs.ReceivedEventData{EventData: azeventhubs.EventData{Body: []byte("small")}}
+
+	receiver := claimcheck.NewReceiver(fakeEventReceiver{events: []*azeventhubs.ReceivedEventData{missing, small}}, store, nil)
+
+	events, err := receiver.ReceiveEvents(context.Background(), 2, nil)
+	require.ErrorContains(t, err, `failed to download the event body from blob "missing"`)
+	require.Equal(t, []*azeventhubs.ReceivedEventData{missing, small}, events)
+	require.Empty(t, missing.Body)
+
+	var rehydrateErr *claimcheck.RehydrateError
+	require.ErrorAs(t, err, &rehydrateErr)
+	require.Same(t, missing, rehydrateErr.Event)
+}
+
+func TestClaimCheck_ReceiveEventsWithExpiredContext(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{"large": []byte("large body")}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), nil)
+
+	large := &azeventhubs.ReceivedEventData{EventData: azeventhubs.EventData{
+		Properties: map[string]any{claimcheck.BlobNameProperty: "large"},
+	}}
+	missing := &azeventhubs.ReceivedEventData{EventData: azeventhubs.EventData{
+		Properties: map[string]any{claimcheck.BlobNameProperty: "missing"},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	// the events received before ctx expired are still rehydrated.
+	receiver := claimcheck.NewReceiver(fakeEventReceiver{events: []*azeventhubs.ReceivedEventData{large}, err: ctx.Err()}, store, nil)
+	events, err := receiver.ReceiveEvents(ctx, 2, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, []byte("large body"), events[0].Body)
+
+	// the RehydrateError isn't hidden behind the expired ctx's error.
+	receiver = claimcheck.NewReceiver(fakeEventReceiver{events: []*azeventhubs.ReceivedEventData{missing}, err: ctx.Err()}, store, nil)
+	_, err = receiver.ReceiveEvents(ctx, 2, nil)
+	require.NotErrorIs(t, err, context.DeadlineExceeded)
+
+	var rehydrateErr *claimcheck.RehydrateError
+	require.ErrorAs(t, err, &rehydrateErr)
+	require.Same(t, missing, rehydrateErr.Event)
+}
+
+func TestClaimCheck_ReceiveEventsRehydrateTimeout(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{"large": []byte("large body")}, hang: true}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), nil)
+
+	large := &azeventhubs.ReceivedEventData{EventData: azeventhubs.EventData{
+		Properties: map[string]any{claimcheck.BlobNameProperty: "large"},
+	}}
+
+	receiver := claimcheck.NewReceiver(fakeEventReceiver{events: []*azeventhubs.ReceivedEventData{large}}, store, &claimcheck.ReceiverOptions{
+		RehydrateTimeout: 10 * time.Millisecond,
+	})
+
+	events, err := receiver.ReceiveEvents(context.Background(), 1, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, events[0].Body)
+
+	var rehydrateErr *claimcheck.RehydrateError
+	require.ErrorAs(t, err, &rehydrateErr)
+}
+
+type fakeEventReceiver struct {
+	events []*azeventhubs.ReceivedEventData
+	err    error
+}
+
+func (r fakeEventReceiver) ReceiveEvents(ctx context.Context, count int, options *azeventhubs.ReceiveEventsOptions) ([]*azeventhubs.ReceivedEventData, error) {
+	return r.events, r.err
+}
+
+func newEmulatorClients(t *testing.T) (*azeventhubs.ProducerClient, *azeventhubs.ConsumerClient) {
+	emu, err := emulator.New(nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = emu.Close() })
+
+	require.NoError(t, emu.CreateEventHub("hub", &emulator.EventHubOptions{PartitionCount: 1}))
+
+	producerClient, err := emu.NewProducerClient("hub", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = producerClient.Close(context.Background()) })
+
+	consumerClient, err := emu.NewConsumerClient("hub", azeventhubs.DefaultConsumerGroup, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = consumerClient.Close(context.Background()) })
+
+	return producerClient, consumerClient
+}
+
+func newContainerClient(t *testing.T, transport *fakeBlobTransport) *container.Client {
+	cc, err := container.NewClientWithNoCredential("https://account.blob.core.windows.net/claimchecks", &container.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: transport,
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	require.NoError(t, err)
+	return cc
+}
+
+// fakeBlobTransport is an in-memory blob container that supports uploading, downloading and
+// deleting block blobs.
+type fakeBlobTransport struct {
+	mu           sync.Mutex
+	blobs        map[string][]byte
+	contentTypes map[string]string
+	// hang makes downloads wait until their request is canceled.
+	hang bool
+}
+
+func (f *fakeBlobTransport) Do(req *http.Request) (*http.Response, error) {
+	if f.hang && req.Method == http.MethodGet {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.TrimPrefix(req.URL.Path, "/claimchecks/")
+	header := http.Header{}
+	header.Set("ETag", `"0x1"`)
+	header.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+	switch req.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(req.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if f.contentTypes == nil {
+			f.contentTypes = map[string]string{}
+		}
+
+		f.blobs[name] = body
+		// the blob client sets the header without canonicalizing its name.
+		f.contentTypes[name] = strings.Join(req.Header["x-ms-blob-content-type"], "")
+		return newFakeResponse(req, http.StatusCreated, header, nil), nil
+	case http.MethodGet:
+		body, ok := f.blobs[name]
+
+		if !ok {
+			return newBlobNotFoundResponse(req), nil
+		}
+
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		return newFakeResponse(req, http.StatusOK, header, body), nil
+	case http.MethodDelete:
+		if _, ok := f.blobs[name]; !ok {
+			return newBlobNotFoundResponse(req), nil
+		}
+
+		delete(f.blobs, name)
+		return newFakeResponse(req, http.StatusAccepted, header, nil), nil
+	}
+
+	return nil, errors.New("unsupported method " + req.Method)
+}
+
+func (f *fakeBlobTransport) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+
+	for name := range f.blobs {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func (f *fakeBlobTransport) remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.blobs, name)
+}
+
+func newBlobNotFoundResponse(req *http.Request) *http.Response {
+	header := http.Header{}
+	header.Set("x-ms-error-code", "BlobNotFound")
+	return newFakeResponse(req, http.StatusNotFound, header, nil)
+}
+
+func newFakeResponse(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
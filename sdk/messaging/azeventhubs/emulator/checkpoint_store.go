@@ -0,0 +1,141 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+)
+
+// CheckpointStore is an in-memory azeventhubs.CheckpointStore, for running an azeventhubs.Processor
+// against the emulator.
+//
+// Ownership is claimed with the same optimistic concurrency as the checkpoint store in the
+// checkpoints package: a claim succeeds if the partition isn't owned, or if the claim's ETag
+// matches the current ownership. LastModifiedTime uses the wall clock, not the emulator's clock,
+// since the Processor uses the wall clock to decide when an ownership has expired.
+type CheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]azeventhubs.Checkpoint
+	ownerships  map[string]azeventhubs.Ownership
+}
+
+// NewCheckpointStore creates an empty CheckpointStore.
+func NewCheckpointStore() *CheckpointStore {
+	return &CheckpointStore{
+		checkpoints: map[string]azeventhubs.Checkpoint{},
+		ownerships:  map[string]azeventhubs.Ownership{},
+	}
+}
+
+// ClaimOwnership attempts to claim ownership of the partitions in partitionOwnership and returns
+// the actual partitions that were claimed.
+func (cps *CheckpointStore) ClaimOwnership(ctx context.Context, partitionOwnership []azeventhubs.Ownership, options *azeventhubs.ClaimOwnershipOptions) ([]azeventhubs.Ownership, error) {
+	cps.mu.Lock()
+	defer cps.mu.Unlock()
+
+	var owned []azeventhubs.Ownership
+
+	for _, po := range partitionOwnership {
+		if po.FullyQualifiedNamespace == "" || po.EventHubName == "" || po.ConsumerGroup == "" || po.PartitionID == "" {
+			return nil, errors.New("FullyQualifiedNamespace, EventHubName, ConsumerGroup and PartitionID are required")
+		}
+
+		key := storeKey(po.FullyQualifiedNamespace, po.EventHubName, po.ConsumerGroup, po.PartitionID)
+
+		if current, exists := cps.ownerships[key]; exists && (po.ETag == nil || *po.ETag != *current.ETag) {
+			// someone else claimed the partition since this ownership was listed.
+			continue
+		}
+
+		etag, err := uuid.New()
+
+		if err != nil {
+			return nil, err
+		}
+
+		po.ETag = to.Ptr(azcore.ETag(etag.String()))
+		po.LastModifiedTime = time.Now().UTC()
+		cps.ownerships[key] = po
+		owned = append(owned, po)
+	}
+
+	return owned, nil
+}
+
+// ListCheckpoints lists all the available checkpoints.
+func (cps *CheckpointStore) ListCheckpoints(ctx context.Context, fullyQualifiedNamespace string, eventHubName string, consumerGroup string, options *azeventhubs.ListCheckpointsOptions) ([]azeventhubs.Checkpoint, error) {
+	cps.mu.Lock()
+	defer cps.mu.Unlock()
+
+	var checkpoints []azeventhubs.Checkpoint
+
+	for _, c := range cps.checkpoints {
+		if c.FullyQualifiedNamespace == fullyQualifiedNamespace && c.EventHubName == eventHubName && c.ConsumerGroup == consumerGroup {
+			checkpoints = append(checkpoints, c)
+		}
+	}
+
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].PartitionID < checkpoints[j].PartitionID })
+	return checkpoints, nil
+}
+
+// ListOwnership lists all ownerships.
+func (cps *CheckpointStore) ListOwnership(ctx context.Context, fullyQualifiedNamespace string, eventHubName string, consumerGroup string, options *azeventhubs.ListOwnershipOptions) ([]azeventhubs.Ownership, error) {
+	cps.mu.Lock()
+	defer cps.mu.Unlock()
+
+	var ownerships []azeventhubs.Ownership
+
+	for _, o := range cps.ownerships {
+		if o.FullyQualifiedNamespace == fullyQualifiedNamespace && o.EventHubName == eventHubName && o.ConsumerGroup == consumerGroup {
+			ownerships = append(ownerships, o)
+		}
+	}
+
+	sort.Slice(ownerships, func(i, j int) bool { return ownerships[i].PartitionID < ownerships[j].PartitionID })
+	return ownerships, nil
+}
+
+// SetCheckpoint updates a specific checkpoint with a sequence and offset.
+func (cps *CheckpointStore) SetCheckpoint(ctx context.Context, checkpoint azeventhubs.Checkpoint, options *azeventhubs.SetCheckpointOptions) error {
+	if checkpoint.FullyQualifiedNamespace == "" || checkpoint.EventHubName == "" || checkpoint.ConsumerGroup == "" || checkpoint.PartitionID == "" {
+		return errors.New("FullyQualifiedNamespace, EventHubName, ConsumerGroup and PartitionID are required")
+	}
+
+	cps.mu.Lock()
+	defer cps.mu.Unlock()
+
+	cps.checkpoints[storeKey(checkpoint.FullyQualifiedNamespace, checkpoint.EventHubName, checkpoint.ConsumerGroup, checkpoint.PartitionID)] = checkpoint
+	return nil
+}
+
+// ExpireOwnership makes a partition's ownership look abandoned, as if its Processor had stopped
+// without releasing it, so another Processor can claim the partition on its next load balancing pass.
+func (cps *CheckpointStore) ExpireOwnership(o azeventhubs.Ownership) {
+	cps.mu.Lock()
+	defer cps.mu.Unlock()
+
+	key := storeKey(o.FullyQualifiedNamespace, o.EventHubName, o.ConsumerGroup, o.PartitionID)
+
+	if current, exists := cps.ownerships[key]; exists {
+		current.LastModifiedTime = time.Now().UTC().Add(-24 * time.Hour)
+		cps.ownerships[key] = current
+	}
+}
+
+func storeKey(fullyQualifiedNamespace, eventHubName, consumerGroup, partitionID string) string {
+	return strings.Join([]string{fullyQualifiedNamespace, eventHubName, consumerGroup, partitionID}, "/")
+}
+
+var _ azeventhubs.CheckpointStore = (*CheckpointStore)(nil)
@@ -0,0 +1,237 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package emulator is an in-memory Event Hubs namespace for unit tests. It speaks AMQP, so
+// the clients in the azeventhubs package connect to it unchanged, using the connection string
+// from [Emulator.ConnectionString].
+//
+// The emulator supports event hubs with any number of partitions, consumer groups, partition
+// keys, every start position, owner levels (epochs), idempotent publishing and the event hub and
+// partition properties.
+// [CheckpointStore] is an in-memory [azeventhubs.CheckpointStore], so an [azeventhubs.Processor]
+// can run against the emulator without a storage account. Time only moves when the test says so,
+// with [Emulator.AdvanceTime], so enqueued times are deterministic.
+//
+// The emulator isn't a complete implementation of Event Hubs. It doesn't support retention,
+// throttling, geo-replication or the administration API.
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/amqpserver"
+	"github.com/Azure/go-amqp"
+)
+
+// Options contains optional settings for [New].
+type Options struct {
+	// Now is the emulator's starting time. Defaults to the current time.
+	Now time.Time
+}
+
+// Emulator is an in-memory Event Hubs namespace.
+type Emulator struct {
+	server *amqpserver.Server
+
+	mu   sync.Mutex
+	now  time.Time
+	hubs map[string]*eventHub
+
+	// replyLinks are the links management and CBS responses are sent on, by their address.
+	replyLinks map[string]*replyLink
+}
+
+// New creates an Emulator, listening on a local port.
+func New(options *Options) (*Emulator, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	e := &Emulator{
+		now:        options.Now,
+		hubs:       map[string]*eventHub{},
+		replyLinks: map[string]*replyLink{},
+	}
+
+	if e.now.IsZero() {
+		e.now = time.Now()
+	}
+
+	e.now = e.now.UTC().Truncate(time.Millisecond)
+
+	server, err := amqpserver.Listen("127.0.0.1:0", amqpserver.HandlerFunc(e.attach))
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.server = server
+	return e, nil
+}
+
+// ConnectionString is a connection string for the emulator. Pass it to
+// azeventhubs.NewProducerClientFromConnectionString or azeventhubs.NewConsumerClientFromConnectionString.
+func (e *Emulator) ConnectionString() string {
+	return fmt.Sprintf("Endpoint=sb://%s;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=emulator;UseDevelopmentEmulator=true", e.server.Addr())
+}
+
+// FullyQualifiedNamespace is the namespace that clients of the emulator report, ex: in the
+// checkpoints and ownerships an azeventhubs.Processor stores.
+func (e *Emulator) FullyQualifiedNamespace() string {
+	return e.server.Addr()
+}
+
+// NewProducerClient creates an azeventhubs.ProducerClient that's connected to the emulator.
+func (e *Emulator) NewProducerClient(eventHub string, options *azeventhubs.ProducerClientOptions) (*azeventhubs.ProducerClient, error) {
+	return azeventhubs.NewProducerClientFromConnectionString(e.ConnectionString(), eventHub, options)
+}
+
+// NewConsumerClient creates an azeventhubs.ConsumerClient that's connected to the emulator.
+func (e *Emulator) NewConsumerClient(eventHub string, consumerGroup string, options *azeventhubs.ConsumerClientOptions) (*azeventhubs.ConsumerClient, error) {
+	return azeventhubs.NewConsumerClientFromConnectionString(e.ConnectionString(), eventHub, consumerGroup, options)
+}
+
+// Now is the emulator's current time. Events are enqueued at this time.
+func (e *Emulator) Now() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.now
+}
+
+// AdvanceTime moves the emulator's clock forward.
+func (e *Emulator) AdvanceTime(d time.Duration) {
+	if d < 0 {
+		panic("emulator: time can't go backwards")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.now = e.now.Add(d)
+}
+
+// DisconnectAll closes every client connection, as if the service had restarted. Clients
+// reconnect on their next operation.
+func (e *Emulator) DisconnectAll() {
+	e.server.CloseConnections(&amqp.Error{
+		Condition:   amqp.ErrCondConnectionForced,
+		Description: "the emulator closed the connection",
+	})
+}
+
+// Close closes all connections and stops the emulator.
+func (e *Emulator) Close() error {
+	return e.server.Close()
+}
+
+// EventHubOptions contains optional settings for [Emulator.CreateEventHub].
+type EventHubOptions struct {
+	// PartitionCount is the number of partitions. Partition IDs are "0" to PartitionCount-1.
+	// Defaults to 4.
+	PartitionCount int
+
+	// ConsumerGroups are the consumer groups to create, in addition to "$Default".
+	ConsumerGroups []string
+}
+
+// CreateEventHub creates an event hub.
+func (e *Emulator) CreateEventHub(name string, options *EventHubOptions) error {
+	if options == nil {
+		options = &EventHubOptions{}
+	}
+
+	partitionCount := options.PartitionCount
+
+	if partitionCount == 0 {
+		partitionCount = 4
+	}
+
+	if partitionCount < 0 {
+		return fmt.Errorf("invalid partition count %d", partitionCount)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := strings.ToLower(name)
+
+	if e.hubs[key] != nil {
+		return fmt.Errorf("event hub %q: %w", name, errEntityExists)
+	}
+
+	hub := &eventHub{
+		name:           name,
+		createdAt:      e.now,
+		consumerGroups: map[string]bool{"$default": true},
+	}
+
+	for i := 0; i < partitionCount; i++ {
+		hub.partitions = append(hub.partitions, &partition{id: strconv.Itoa(i)})
+	}
+
+	for _, cg := range options.ConsumerGroups {
+		hub.consumerGroups[strings.ToLower(cg)] = true
+	}
+
+	e.hubs[key] = hub
+	return nil
+}
+
+// CreateConsumerGroup creates a consumer group in an event hub.
+func (e *Emulator) CreateConsumerGroup(eventHub string, consumerGroup string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	hub, err := e.findEventHubLocked(eventHub)
+
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToLower(consumerGroup)
+
+	if hub.consumerGroups[key] {
+		return fmt.Errorf("consumer group %q: %w", consumerGroup, errEntityExists)
+	}
+
+	hub.consumerGroups[key] = true
+	return nil
+}
+
+// EventCount returns the number of events in a partition.
+func (e *Emulator) EventCount(eventHub string, partitionID string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	hub, err := e.findEventHubLocked(eventHub)
+
+	if err != nil {
+		return 0, err
+	}
+
+	p, err := hub.findPartition(partitionID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p.events), nil
+}
+
+func (e *Emulator) findEventHubLocked(name string) (*eventHub, error) {
+	hub := e.hubs[strings.ToLower(name)]
+
+	if hub == nil {
+		return nil, fmt.Errorf("event hub %q does not exist", name)
+	}
+
+	return hub, nil
+}
+
+var errEntityExists = errors.New("entity already exists")
@@ -0,0 +1,523 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/emulator"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/eh"
+	"github.com/Azure/go-amqp"
+	"github.com/stretchr/testify/require"
+)
+
+var startTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newEmulator(t *testing.T) *emulator.Emulator {
+	emu, err := emulator.New(&emulator.Options{Now: startTime})
+	require.NoError(t, err)
+
+	require.NoError(t, emu.CreateEventHub("hub", nil))
+
+	t.Cleanup(func() { require.NoError(t, emu.Close()) })
+	return emu
+}
+
+func newClients(t *testing.T, emu *emulator.Emulator) (*azeventhubs.ProducerClient, *azeventhubs.ConsumerClient) {
+	producer, err := emu.NewProducerClient("hub", nil)
+	require.NoError(t, err)
+
+	consumer, err := emu.NewConsumerClient("hub", azeventhubs.DefaultConsumerGroup, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, producer.Close(context.Background()))
+		require.NoError(t, consumer.Close(context.Background()))
+	})
+
+	return producer, consumer
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func sendEvents(t *testing.T, producer *azeventhubs.ProducerClient, options *azeventhubs.EventDataBatchOptions, bodies ...string) {
+	batch, err := producer.NewEventDataBatch(testContext(t), options)
+	require.NoError(t, err)
+
+	for _, body := range bodies {
+		require.NoError(t, batch.AddEventData(&azeventhubs.EventData{Body: []byte(body)}, nil))
+	}
+
+	require.NoError(t, producer.SendEventDataBatch(testContext(t), batch, nil))
+}
+
+// receiveN receives events until there are n of them.
+func receiveN(t *testing.T, pc interface {
+	ReceiveEvents(ctx context.Context, count int, options *azeventhubs.ReceiveEventsOptions) ([]*azeventhubs.ReceivedEventData, error)
+}, n int) []*azeventhubs.ReceivedEventData {
+	var all []*azeventhubs.ReceivedEventData
+
+	for len(all) < n {
+		ctx, cancel := context.WithTimeout(testContext(t), 5*time.Second)
+		events, err := pc.ReceiveEvents(ctx, n-len(all), nil)
+		cancel()
+
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			require.NoError(t, err)
+		}
+
+		all = append(all, events...)
+	}
+
+	return all
+}
+
+func eventBodies(events []*azeventhubs.ReceivedEventData) []string {
+	var bodies []string
+
+	for _, e := range events {
+		bodies = append(bodies, string(e.Body))
+	}
+
+	return bodies
+}
+
+func newPartitionClient(t *testing.T, consumer *azeventhubs.ConsumerClient, partitionID string, options *azeventhubs.PartitionClientOptions) *azeventhubs.PartitionClient {
+	pc, err := consumer.NewPartitionClient(partitionID, options)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { require.NoError(t, pc.Close(context.Background())) })
+	return pc
+}
+
+func TestEmulator_SendAndReceive(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("1")}, "hello", "world")
+
+	count, err := emu.EventCount("hub", "1")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	pc := newPartitionClient(t, consumer, "1", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+
+	events := receiveN(t, pc, 2)
+	require.Equal(t, []string{"hello", "world"}, eventBodies(events))
+	require.Equal(t, int64(0), events[0].SequenceNumber)
+	require.Equal(t, int64(1), events[1].SequenceNumber)
+	require.Equal(t, "0", events[0].Offset)
+	require.NotEqual(t, "0", events[1].Offset)
+	require.Equal(t, startTime, events[0].EnqueuedTime.UTC())
+
+	// events that arrive later are delivered to the open receiver.
+	emu.AdvanceTime(time.Hour)
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("1")}, "later")
+
+	events = receiveN(t, pc, 1)
+	require.Equal(t, []string{"later"}, eventBodies(events))
+	require.Equal(t, startTime.Add(time.Hour), events[0].EnqueuedTime.UTC())
+}
+
+func TestEmulator_PartitionKey(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	for i := 0; i < 3; i++ {
+		sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionKey: to.Ptr("device-1")}, strconv.Itoa(i))
+	}
+
+	partitionID := eh.PartitionForKey("device-1", []string{"0", "1", "2", "3"})
+
+	count, err := emu.EventCount("hub", partitionID)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	pc := newPartitionClient(t, consumer, partitionID, &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+
+	events := receiveN(t, pc, 3)
+	require.Equal(t, []string{"0", "1", "2"}, eventBodies(events))
+	require.Equal(t, "device-1", *events[0].PartitionKey)
+}
+
+func TestEmulator_RoundRobin(t *testing.T) {
+	emu := newEmulator(t)
+	producer, _ := newClients(t, emu)
+
+	for i := 0; i < 8; i++ {
+		sendEvents(t, producer, nil, strconv.Itoa(i))
+	}
+
+	for _, id := range []string{"0", "1", "2", "3"} {
+		count, err := emu.EventCount("hub", id)
+		require.NoError(t, err)
+		require.Equal(t, 2, count, "partition %s", id)
+	}
+}
+
+func TestEmulator_StartPositions(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	for i := 0; i < 4; i++ {
+		sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, strconv.Itoa(i))
+		emu.AdvanceTime(time.Minute)
+	}
+
+	all := receiveN(t, newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	}), 4)
+
+	tests := []struct {
+		name     string
+		position azeventhubs.StartPosition
+		expected []string
+	}{
+		{"sequence number", azeventhubs.StartPosition{SequenceNumber: to.Ptr(int64(1))}, []string{"2", "3"}},
+		{"sequence number, inclusive", azeventhubs.StartPosition{SequenceNumber: to.Ptr(int64(1)), Inclusive: true}, []string{"1", "2", "3"}},
+		{"offset", azeventhubs.StartPosition{Offset: to.Ptr(all[2].Offset)}, []string{"3"}},
+		{"offset, inclusive", azeventhubs.StartPosition{Offset: to.Ptr(all[2].Offset), Inclusive: true}, []string{"2", "3"}},
+		{"enqueued time", azeventhubs.StartPosition{EnqueuedTime: to.Ptr(startTime.Add(time.Minute))}, []string{"2", "3"}},
+		{"enqueued time, inclusive", azeventhubs.StartPosition{EnqueuedTime: to.Ptr(startTime.Add(time.Minute)), Inclusive: true}, []string{"1", "2", "3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pc := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{StartPosition: test.position})
+			require.Equal(t, test.expected, eventBodies(receiveN(t, pc, len(test.expected))))
+		})
+	}
+
+	t.Run("latest", func(t *testing.T) {
+		pc := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{
+			StartPosition: azeventhubs.StartPosition{Latest: to.Ptr(true)},
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		events, err := pc.ReceiveEvents(ctx, 1, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Empty(t, events)
+
+		sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, "4")
+		require.Equal(t, []string{"4"}, eventBodies(receiveN(t, pc, 1)))
+	})
+}
+
+func TestEmulator_Properties(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	hubProps, err := consumer.GetEventHubProperties(testContext(t), nil)
+	require.NoError(t, err)
+	require.Equal(t, "hub", hubProps.Name)
+	require.Equal(t, []string{"0", "1", "2", "3"}, hubProps.PartitionIDs)
+	require.Equal(t, startTime, hubProps.CreatedOn.UTC())
+
+	props, err := producer.GetPartitionProperties(testContext(t), "2", nil)
+	require.NoError(t, err)
+	require.True(t, props.IsEmpty)
+	require.Equal(t, int64(-1), props.LastEnqueuedSequenceNumber)
+
+	emu.AdvanceTime(time.Minute)
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("2")}, "a", "b")
+
+	props, err = producer.GetPartitionProperties(testContext(t), "2", nil)
+	require.NoError(t, err)
+	require.False(t, props.IsEmpty)
+	require.Equal(t, "2", props.PartitionID)
+	require.Equal(t, int64(0), props.BeginningSequenceNumber)
+	require.Equal(t, int64(1), props.LastEnqueuedSequenceNumber)
+	require.Equal(t, startTime.Add(time.Minute), props.LastEnqueuedOn.UTC())
+}
+
+func TestEmulator_MissingEventHub(t *testing.T) {
+	emu := newEmulator(t)
+
+	producer, err := emu.NewProducerClient("missing", nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, producer.Close(context.Background())) }()
+
+	_, err = producer.GetEventHubProperties(testContext(t), nil)
+	require.Error(t, err)
+
+	require.Error(t, emu.CreateEventHub("HUB", nil))
+
+	_, err = emu.EventCount("hub", "100")
+	require.Error(t, err)
+}
+
+func TestEmulator_OwnerLevel(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, "a")
+
+	earliest := azeventhubs.StartPosition{Earliest: to.Ptr(true)}
+
+	first := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{StartPosition: earliest, OwnerLevel: to.Ptr(int64(1))})
+	require.Equal(t, []string{"a"}, eventBodies(receiveN(t, first, 1)))
+
+	// a receiver with a lower epoch can't be created.
+	lower := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{StartPosition: earliest, OwnerLevel: to.Ptr(int64(0))})
+	_, err := lower.ReceiveEvents(testContext(t), 1, nil)
+
+	var ehErr *azeventhubs.Error
+	require.ErrorAs(t, err, &ehErr)
+	require.Equal(t, azeventhubs.ErrorCodeOwnershipLost, ehErr.Code)
+
+	// a receiver with a higher epoch takes over the partition.
+	second := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{StartPosition: earliest, OwnerLevel: to.Ptr(int64(2))})
+	require.Equal(t, []string{"a"}, eventBodies(receiveN(t, second, 1)))
+
+	_, err = first.ReceiveEvents(testContext(t), 1, nil)
+	require.ErrorAs(t, err, &ehErr)
+	require.Equal(t, azeventhubs.ErrorCodeOwnershipLost, ehErr.Code)
+}
+
+func TestEmulator_ConsumerGroups(t *testing.T) {
+	emu := newEmulator(t)
+	require.NoError(t, emu.CreateConsumerGroup("hub", "analytics"))
+	require.Error(t, emu.CreateConsumerGroup("hub", "Analytics"))
+
+	producer, _ := newClients(t, emu)
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, "a")
+
+	consumer, err := emu.NewConsumerClient("hub", "analytics", nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, consumer.Close(context.Background())) }()
+
+	pc := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+	require.Equal(t, []string{"a"}, eventBodies(receiveN(t, pc, 1)))
+
+	missing, err := emu.NewConsumerClient("hub", "missing", nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, missing.Close(context.Background())) }()
+
+	pc = newPartitionClient(t, missing, "0", nil)
+	_, err = pc.ReceiveEvents(testContext(t), 1, nil)
+
+	var amqpErr *amqp.Error
+	require.ErrorAs(t, err, &amqpErr)
+	require.Equal(t, amqp.ErrCondNotFound, amqpErr.Condition)
+}
+
+func TestEmulator_DisconnectAll(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, "a")
+
+	pc := newPartitionClient(t, consumer, "0", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+	require.Equal(t, []string{"a"}, eventBodies(receiveN(t, pc, 1)))
+
+	emu.DisconnectAll()
+
+	// both clients recover, and the partition client continues after the last event it received.
+	sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, "b")
+	require.Equal(t, []string{"b"}, eventBodies(receiveN(t, pc, 1)))
+}
+
+func TestEmulator_Processor(t *testing.T) {
+	emu := newEmulator(t)
+	producer, consumer := newClients(t, emu)
+
+	var expected []string
+
+	for i := 0; i < 4; i++ {
+		id := strconv.Itoa(i)
+		body := fmt.Sprintf("event for partition %s", id)
+		sendEvents(t, producer, &azeventhubs.EventDataBatchOptions{PartitionID: &id}, body)
+		expected = append(expected, body)
+	}
+
+	store := emulator.NewCheckpointStore()
+
+	processor, err := azeventhubs.NewProcessor(consumer, store, &azeventhubs.ProcessorOptions{
+		StartPositions: azeventhubs.StartPositions{Default: azeventhubs.StartPosition{Earliest: to.Ptr(true)}},
+		UpdateInterval: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- processor.Run(ctx) }()
+
+	var mu sync.Mutex
+	var received []string
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		pc := processor.NextPartitionClient(ctx)
+		require.NotNil(t, pc)
+
+		wg.Add(1)
+
+		// closing a partition client releases its partition, so they stay open until every partition has been processed.
+		defer func() { require.NoError(t, pc.Close(context.Background())) }()
+
+		go func() {
+			defer wg.Done()
+
+			events := receiveN(t, pc, 1)
+			require.NoError(t, pc.UpdateCheckpoint(ctx, events[0], nil))
+
+			mu.Lock()
+			received = append(received, eventBodies(events)...)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	cancel()
+	require.NoError(t, <-runErr)
+
+	sort.Strings(received)
+	require.Equal(t, expected, received)
+
+	ownerships, err := store.ListOwnership(testContext(t), emu.FullyQualifiedNamespace(), "hub", azeventhubs.DefaultConsumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, ownerships, 4)
+
+	checkpoints, err := store.ListCheckpoints(testContext(t), emu.FullyQualifiedNamespace(), "hub", azeventhubs.DefaultConsumerGroup, nil)
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 4)
+
+	for _, c := range checkpoints {
+		require.Equal(t, int64(0), *c.SequenceNumber)
+	}
+}
+
+func TestCheckpointStore_ClaimOwnership(t *testing.T) {
+	store := emulator.NewCheckpointStore()
+
+	ownership := azeventhubs.Ownership{
+		FullyQualifiedNamespace: "ns",
+		EventHubName:            "hub",
+		ConsumerGroup:           "$Default",
+		PartitionID:             "0",
+		OwnerID:                 "owner-1",
+	}
+
+	claimed, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{ownership}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NotNil(t, claimed[0].ETag)
+
+	// a claim without the current ETag fails.
+	stale := ownership
+	stale.OwnerID = "owner-2"
+	claimed2, err := store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{stale}, nil)
+	require.NoError(t, err)
+	require.Empty(t, claimed2)
+
+	// a claim with the current ETag succeeds.
+	stale.ETag = claimed[0].ETag
+	claimed2, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{stale}, nil)
+	require.NoError(t, err)
+	require.Len(t, claimed2, 1)
+
+	store.ExpireOwnership(stale)
+
+	ownerships, err := store.ListOwnership(context.Background(), "ns", "hub", "$Default", nil)
+	require.NoError(t, err)
+	require.Equal(t, "owner-2", ownerships[0].OwnerID)
+	require.True(t, time.Since(ownerships[0].LastModifiedTime) > time.Hour)
+
+	_, err = store.ClaimOwnership(context.Background(), []azeventhubs.Ownership{{OwnerID: "owner-3"}}, nil)
+	require.Error(t, err)
+}
+
+func TestEmulator_IdempotentPublishing(t *testing.T) {
+	emu := newEmulator(t)
+
+	producer, err := emu.NewProducerClient("hub", &azeventhubs.ProducerClientOptions{EnableIdempotentPublishing: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, producer.Close(context.Background())) })
+
+	_, err = producer.NewEventDataBatch(testContext(t), nil)
+	require.Error(t, err, "idempotent batches must have a partition ID")
+
+	props, err := producer.GetPartitionPublishingProperties(testContext(t), "0", nil)
+	require.NoError(t, err)
+	require.True(t, props.IsIdempotentPublishingEnabled)
+	require.Equal(t, int64(1), *props.ProducerGroupID)
+	require.Equal(t, int16(0), *props.OwnerLevel)
+	require.Equal(t, int32(-1), *props.LastPublishedSequenceNumber)
+
+	batch, err := producer.NewEventDataBatch(testContext(t), &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")})
+	require.NoError(t, err)
+
+	for _, body := range []string{"a", "b", "c"} {
+		require.NoError(t, batch.AddEventData(&azeventhubs.EventData{Body: []byte(body)}, nil))
+	}
+
+	require.NoError(t, producer.SendEventDataBatch(testContext(t), batch, nil))
+	require.Equal(t, int32(0), *batch.StartingPublishedSequenceNumber())
+
+	// the batch keeps its sequence numbers, so sending it again is deduplicated.
+	require.NoError(t, producer.SendEventDataBatch(testContext(t), batch, nil))
+
+	count, err := emu.EventCount("hub", "0")
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	props, err = producer.GetPartitionPublishingProperties(testContext(t), "0", nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), *props.LastPublishedSequenceNumber)
+
+	// another producer, with a higher owner level, continues from the producer group's last sequence number.
+	next, err := emu.NewProducerClient("hub", &azeventhubs.ProducerClientOptions{
+		EnableIdempotentPublishing: true,
+		PartitionOptions: map[string]azeventhubs.PartitionPublishingOptions{
+			"0": {ProducerGroupID: props.ProducerGroupID, OwnerLevel: to.Ptr(int16(1))},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, next.Close(context.Background())) })
+
+	sendEvents(t, next, &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")}, "d")
+
+	props, err = next.GetPartitionPublishingProperties(testContext(t), "0", nil)
+	require.NoError(t, err)
+	require.Equal(t, int16(1), *props.OwnerLevel)
+	require.Equal(t, int32(3), *props.LastPublishedSequenceNumber)
+
+	// the producer with the lower owner level can no longer publish.
+	batch, err = producer.NewEventDataBatch(testContext(t), &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")})
+	require.NoError(t, err)
+	require.NoError(t, batch.AddEventData(&azeventhubs.EventData{Body: []byte("e")}, nil))
+
+	var amqpErr *amqp.Error
+	require.ErrorAs(t, producer.SendEventDataBatch(testContext(t), batch, nil), &amqpErr)
+	require.Equal(t, amqp.ErrCond("com.microsoft:producer-epoch-stolen"), amqpErr.Condition)
+
+	count, err = emu.EventCount("hub", "0")
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
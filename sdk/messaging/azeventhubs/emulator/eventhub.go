@@ -0,0 +1,304 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/amqpserver"
+	"github.com/Azure/go-amqp"
+)
+
+const (
+	partitionKeyAnnotation   = "x-opt-partition-key"
+	sequenceNumberAnnotation = "x-opt-sequence-number"
+	offsetAnnotation         = "x-opt-offset"
+	enqueuedTimeAnnotation   = "x-opt-enqueued-time"
+)
+
+type eventHub struct {
+	name           string
+	createdAt      time.Time
+	partitions     []*partition
+	consumerGroups map[string]bool
+
+	// nextPartition is the partition that gets the next event that doesn't have a partition key.
+	nextPartition int
+
+	// lastProducerID is the last producer group ID assigned to an idempotent producer.
+	lastProducerID int64
+}
+
+func (hub *eventHub) findPartition(id string) (*partition, error) {
+	for _, p := range hub.partitions {
+		if p.id == id {
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("partition %q does not exist in event hub %q", id, hub.name)
+}
+
+func (hub *eventHub) partitionIDs() []string {
+	ids := make([]string, 0, len(hub.partitions))
+
+	for _, p := range hub.partitions {
+		ids = append(ids, p.id)
+	}
+
+	return ids
+}
+
+type partition struct {
+	id     string
+	events []*event
+
+	// nextOffset is the offset of the next event: the number of bytes enqueued so far.
+	nextOffset int64
+
+	receivers []*receiver
+
+	// producers are the idempotent producer groups that publish to the partition, by producer group ID.
+	producers map[int64]*producer
+}
+
+// producer is the state of an idempotent producer group.
+type producer struct {
+	epoch              int16
+	lastSequenceNumber int64
+}
+
+type event struct {
+	// payload is the encoded message, with the service's annotations.
+	payload        []byte
+	sequenceNumber int64
+	offset         int64
+	enqueuedTime   time.Time
+}
+
+// appendLocked enqueues messages in the partition, and sends them to the partition's receivers.
+func (p *partition) appendLocked(messages []*amqp.Message, partitionKey *string, now time.Time) error {
+	for _, msg := range messages {
+		sequenceNumber := int64(len(p.events))
+
+		if msg.Annotations == nil {
+			msg.Annotations = amqp.Annotations{}
+		}
+
+		msg.Annotations[sequenceNumberAnnotation] = sequenceNumber
+		msg.Annotations[offsetAnnotation] = strconv.FormatInt(p.nextOffset, 10)
+		msg.Annotations[enqueuedTimeAnnotation] = now
+
+		if partitionKey != nil {
+			msg.Annotations[partitionKeyAnnotation] = *partitionKey
+		}
+
+		payload, err := msg.MarshalBinary()
+
+		if err != nil {
+			return err
+		}
+
+		p.events = append(p.events, &event{
+			payload:        payload,
+			sequenceNumber: sequenceNumber,
+			offset:         p.nextOffset,
+			enqueuedTime:   now,
+		})
+
+		p.nextOffset += int64(len(payload))
+	}
+
+	for _, r := range p.receivers {
+		r.deliverLocked()
+	}
+
+	return nil
+}
+
+// selectorRegexp matches the filters the azeventhubs package sends for a start position.
+var selectorRegexp = regexp.MustCompile(`^amqp\.annotation\.(x-opt-offset|x-opt-sequence-number|x-opt-enqueued-time)\s*(>=|>)\s*'([^']*)'$`)
+
+// startIndexLocked returns the index of the first event a receiver, with the selector filter,
+// should receive.
+func (p *partition) startIndexLocked(selector string) (int, error) {
+	matches := selectorRegexp.FindStringSubmatch(selector)
+
+	if matches == nil {
+		return 0, fmt.Errorf("the selector filter %q isn't supported by the emulator", selector)
+	}
+
+	annotation, inclusive, value := matches[1], matches[2] == ">=", matches[3]
+
+	if annotation == offsetAnnotation {
+		switch value {
+		case "-1":
+			return 0, nil
+		case "@latest":
+			return len(p.events), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("the selector filter %q has an invalid value: %w", selector, err)
+	}
+
+	return sort.Search(len(p.events), func(i int) bool {
+		var v int64
+
+		switch annotation {
+		case offsetAnnotation:
+			v = p.events[i].offset
+		case sequenceNumberAnnotation:
+			v = p.events[i].sequenceNumber
+		default:
+			v = p.events[i].enqueuedTime.UnixMilli()
+		}
+
+		if inclusive {
+			return v >= n
+		}
+
+		return v > n
+	}), nil
+}
+
+// receiver is a client's receiver link, for a partition in a consumer group.
+type receiver struct {
+	link          *amqpserver.Link
+	p             *partition
+	consumerGroup string
+	epoch         *int64
+	name          string
+
+	// next is the index of the next event to send.
+	next    int
+	nextTag uint64
+}
+
+// deliverLocked sends events to the receiver, while it has credit.
+func (r *receiver) deliverLocked() {
+	for r.next < len(r.p.events) && r.link.Credit() > 0 {
+		r.nextTag++
+		tag := make([]byte, 8)
+		binary.BigEndian.PutUint64(tag, r.nextTag)
+
+		if !r.link.Send(tag, 0, r.p.events[r.next].payload, true) {
+			return
+		}
+
+		r.next++
+	}
+}
+
+func (p *partition) removeReceiverLocked(r *receiver) {
+	for i, other := range p.receivers {
+		if other == r {
+			p.receivers = append(p.receivers[:i], p.receivers[i+1:]...)
+			return
+		}
+	}
+}
+
+// attachProducerLocked negotiates the producer state for an idempotent producer's link, and returns
+// it to the client in the link's properties.
+func (hub *eventHub) attachProducerLocked(link *amqpserver.Link, p *partition) *amqp.Error {
+	if p == nil {
+		return &amqp.Error{Condition: errCondNotAllowed, Description: "Idempotent producers must publish to a partition."}
+	}
+
+	id, hasID := link.Properties[producerIDProperty].(int64)
+	epoch, hasEpoch := link.Properties[producerEpochProperty].(int16)
+	seq, hasSeq := link.Properties[producerSequenceNumberProperty].(int32)
+
+	if !hasID {
+		hub.lastProducerID++
+		id = hub.lastProducerID
+	}
+
+	if p.producers == nil {
+		p.producers = map[int64]*producer{}
+	}
+
+	pr := p.producers[id]
+
+	switch {
+	case pr == nil:
+		pr = &producer{epoch: epoch, lastSequenceNumber: -1}
+
+		if hasSeq {
+			pr.lastSequenceNumber = int64(seq)
+		}
+
+		p.producers[id] = pr
+	case hasEpoch && epoch < pr.epoch:
+		return &amqp.Error{
+			Condition:   errCondProducerEpochStolen,
+			Description: fmt.Sprintf("The producer epoch '%d' is lower than the current epoch '%d' of producer group '%d'.", epoch, pr.epoch, id),
+		}
+	case hasEpoch && epoch > pr.epoch:
+		// a higher epoch takes over the producer group.
+		pr.epoch = epoch
+
+		if hasSeq {
+			pr.lastSequenceNumber = int64(seq)
+		}
+	}
+
+	link.ResponseProperties = map[string]any{
+		producerIDProperty:             id,
+		producerEpochProperty:          pr.epoch,
+		producerSequenceNumberProperty: int32(pr.lastSequenceNumber),
+	}
+
+	return nil
+}
+
+// checkSequenceLocked checks the producer state an idempotent producer stamped on the events it
+// published. It returns true if the events were already published, and should be discarded.
+func (p *partition) checkSequenceLocked(envelope *amqp.Message, count int) (bool, *amqp.Error) {
+	id, ok1 := envelope.Annotations[producerIDProperty].(int64)
+	epoch, ok2 := envelope.Annotations[producerEpochProperty].(int16)
+	seq, ok3 := envelope.Annotations[producerSequenceNumberProperty].(int32)
+
+	if !ok1 || !ok2 || !ok3 {
+		return false, &amqp.Error{Condition: amqp.ErrCondInvalidField, Description: "Events from idempotent producers must have the producer state annotations."}
+	}
+
+	pr := p.producers[id]
+
+	if pr == nil {
+		return false, &amqp.Error{Condition: errCondNotAllowed, Description: fmt.Sprintf("The producer group '%d' doesn't exist.", id)}
+	}
+
+	if epoch < pr.epoch {
+		return false, &amqp.Error{
+			Condition:   errCondProducerEpochStolen,
+			Description: fmt.Sprintf("The producer epoch '%d' is lower than the current epoch '%d' of producer group '%d'.", epoch, pr.epoch, id),
+		}
+	}
+
+	first, last := int64(seq), int64(seq)+int64(count)-1
+
+	if last <= pr.lastSequenceNumber {
+		return true, nil
+	}
+
+	if first != pr.lastSequenceNumber+1 {
+		return false, &amqp.Error{
+			Condition:   errCondOutOfOrderSequence,
+			Description: fmt.Sprintf("The sequence number '%d' doesn't follow the last sequence number '%d' of producer group '%d'.", first, pr.lastSequenceNumber, id),
+		}
+	}
+
+	pr.lastSequenceNumber = last
+	return false, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/emulator"
+)
+
+func Example() {
+	emu, err := emulator.New(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer emu.Close()
+
+	if err := emu.CreateEventHub("telemetry", &emulator.EventHubOptions{PartitionCount: 2}); err != nil {
+		panic(err)
+	}
+
+	// the clients are ordinary azeventhubs clients, connected to the emulator.
+	producer, err := emu.NewProducerClient("telemetry", nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer producer.Close(context.TODO())
+
+	batch, err := producer.NewEventDataBatch(context.TODO(), &azeventhubs.EventDataBatchOptions{PartitionID: to.Ptr("0")})
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := batch.AddEventData(&azeventhubs.EventData{Body: []byte("temperature: 21C")}, nil); err != nil {
+		panic(err)
+	}
+
+	if err := producer.SendEventDataBatch(context.TODO(), batch, nil); err != nil {
+		panic(err)
+	}
+
+	consumer, err := emu.NewConsumerClient("telemetry", azeventhubs.DefaultConsumerGroup, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer consumer.Close(context.TODO())
+
+	partitionClient, err := consumer.NewPartitionClient("0", &azeventhubs.PartitionClientOptions{
+		StartPosition: azeventhubs.StartPosition{Earliest: to.Ptr(true)},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer partitionClient.Close(context.TODO())
+
+	events, err := partitionClient.ReceiveEvents(context.TODO(), 1, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("sequence number %d: %s\n", events[0].SequenceNumber, events[0].Body)
+
+	// Output:
+	// sequence number 0: temperature: 21C
+}
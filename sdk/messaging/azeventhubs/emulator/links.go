@@ -0,0 +1,470 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/amqpserver"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/eh"
+	"github.com/Azure/go-amqp"
+)
+
+const (
+	cbsAddress        = "$cbs"
+	managementAddress = "$management"
+	selectorFilter    = "apache.org:selector-filter:string"
+	epochProperty     = "com.microsoft:epoch"
+	receiverNameProp  = "com.microsoft:receiver-name"
+
+	idempotentProducerCapability   = "com.microsoft:idempotent-producer"
+	producerIDProperty             = "com.microsoft:producer-id"
+	producerEpochProperty          = "com.microsoft:producer-epoch"
+	producerSequenceNumberProperty = "com.microsoft:producer-sequence-number"
+
+	// batchMessageFormat is the message format of a batch, where each data section is an encoded message.
+	batchMessageFormat = 0x80013700
+
+	// maxMessageSize is the largest event, or batch, the emulator accepts: the limit for the standard tier.
+	maxMessageSize = 1024 * 1024
+)
+
+const (
+	errCondLinkStolen          amqp.ErrCond = amqp.ErrCondStolen
+	errCondEntityNotFound      amqp.ErrCond = amqp.ErrCondNotFound
+	errCondMessageSizeExceeded amqp.ErrCond = amqp.ErrCondMessageSizeExceeded
+	errCondNotImplemented      amqp.ErrCond = amqp.ErrCondNotImplemented
+	errCondInternalError       amqp.ErrCond = amqp.ErrCondInternalError
+	errCondNotAllowed          amqp.ErrCond = amqp.ErrCondNotAllowed
+	errCondProducerEpochStolen amqp.ErrCond = "com.microsoft:producer-epoch-stolen"
+	errCondOutOfOrderSequence  amqp.ErrCond = "com.microsoft:out-of-order-sequence"
+)
+
+// attach is the emulator's [amqpserver.Handler]. It decides what each link the clients
+// attach is connected to.
+func (e *Emulator) attach(link *amqpserver.Link) *amqp.Error {
+	if link.Outgoing {
+		address := ""
+
+		if link.Source != nil {
+			address = link.Source.Address
+		}
+
+		if link.Target != nil && isRequestAddress(address) {
+			return e.attachReplyLink(link)
+		}
+
+		return e.attachReceiver(link, address)
+	}
+
+	address := ""
+
+	if link.Target != nil {
+		address = link.Target.Address
+	}
+
+	switch {
+	case address == cbsAddress:
+		link.OnMessage = func(msg *amqpserver.IncomingMessage) amqpserver.DeliveryState {
+			return e.onRequest(msg, e.handleCBS)
+		}
+		return nil
+	case isRequestAddress(address):
+		link.OnMessage = func(msg *amqpserver.IncomingMessage) amqpserver.DeliveryState {
+			return e.onRequest(msg, e.handleManagement)
+		}
+		return nil
+	default:
+		return e.attachSender(link, address)
+	}
+}
+
+// isRequestAddress returns true for $cbs, and the $management address, which clients address
+// as "$management" or "<event hub>/$management".
+func isRequestAddress(address string) bool {
+	return address == cbsAddress || address == managementAddress || strings.HasSuffix(address, "/"+managementAddress)
+}
+
+// replyLink is a client's receiver, for the responses to its management and CBS requests.
+type replyLink struct {
+	link    *amqpserver.Link
+	pending [][]byte
+	nextTag uint64
+}
+
+func (rl *replyLink) flushLocked() {
+	for len(rl.pending) > 0 && rl.link != nil {
+		rl.nextTag++
+		tag := make([]byte, 8)
+		binary.BigEndian.PutUint64(tag, rl.nextTag)
+
+		if !rl.link.Send(tag, 0, rl.pending[0], true) {
+			return
+		}
+
+		rl.pending = rl.pending[1:]
+	}
+}
+
+func (e *Emulator) attachReplyLink(link *amqpserver.Link) *amqp.Error {
+	address := link.Target.Address
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rl := e.replyLinks[address]
+
+	if rl == nil {
+		rl = &replyLink{}
+		e.replyLinks[address] = rl
+	}
+
+	rl.link = link
+
+	link.OnCredit = func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		rl.flushLocked()
+	}
+
+	link.OnDetach = func(*amqp.Error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if e.replyLinks[address] == rl {
+			delete(e.replyLinks, address)
+		}
+	}
+
+	return nil
+}
+
+// onRequest handles a request sent to $cbs or $management, and queues the response for the client's reply link.
+func (e *Emulator) onRequest(msg *amqpserver.IncomingMessage, handle func(req *amqp.Message) *amqp.Message) amqpserver.DeliveryState {
+	var req amqp.Message
+
+	if err := req.UnmarshalBinary(msg.Payload); err != nil {
+		return &amqpserver.Rejected{Error: &amqp.Error{Condition: amqp.ErrCondDecodeError, Description: err.Error()}}
+	}
+
+	if req.Properties == nil || req.Properties.ReplyTo == nil {
+		return &amqpserver.Rejected{Error: &amqp.Error{Condition: amqp.ErrCondInvalidField, Description: "the request has no reply-to address"}}
+	}
+
+	resp := handle(&req)
+
+	if resp.Properties == nil {
+		resp.Properties = &amqp.MessageProperties{}
+	}
+
+	resp.Properties.CorrelationID = req.Properties.MessageID
+
+	payload, err := resp.MarshalBinary()
+
+	if err != nil {
+		return &amqpserver.Rejected{Error: &amqp.Error{Condition: errCondInternalError, Description: err.Error()}}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rl := e.replyLinks[*req.Properties.ReplyTo]
+
+	if rl == nil {
+		rl = &replyLink{}
+		e.replyLinks[*req.Properties.ReplyTo] = rl
+	}
+
+	rl.pending = append(rl.pending, payload)
+	rl.flushLocked()
+
+	return &amqpserver.Accepted{}
+}
+
+func newResponse(statusCode int32, description string, value any) *amqp.Message {
+	return &amqp.Message{
+		ApplicationProperties: map[string]any{
+			"status-code":        statusCode,
+			"status-description": description,
+		},
+		Value: value,
+	}
+}
+
+// handleCBS accepts every token. The emulator doesn't check authorization.
+func (e *Emulator) handleCBS(req *amqp.Message) *amqp.Message {
+	return newResponse(202, "Accepted", nil)
+}
+
+// parseSenderAddress splits a sender's address, "<event hub>" or "<event hub>/Partitions/<partition ID>".
+func parseSenderAddress(address string) (string, *string) {
+	hubName, partitionID, ok := strings.Cut(address, "/Partitions/")
+
+	if !ok {
+		return address, nil
+	}
+
+	return hubName, &partitionID
+}
+
+// findSendTargetLocked finds the event hub, and optionally the partition, that a sender sends to.
+func (e *Emulator) findSendTargetLocked(address string) (*eventHub, *partition, *amqp.Error) {
+	hubName, partitionID := parseSenderAddress(address)
+	hub, err := e.findEventHubLocked(hubName)
+
+	if err != nil {
+		return nil, nil, &amqp.Error{Condition: errCondEntityNotFound, Description: fmt.Sprintf("The messaging entity '%s' could not be found.", address)}
+	}
+
+	if partitionID == nil {
+		return hub, nil, nil
+	}
+
+	p, err := hub.findPartition(*partitionID)
+
+	if err != nil {
+		return nil, nil, &amqp.Error{Condition: errCondEntityNotFound, Description: err.Error()}
+	}
+
+	return hub, p, nil
+}
+
+func (e *Emulator) attachSender(link *amqpserver.Link, address string) *amqp.Error {
+	idempotent := false
+
+	for _, c := range link.DesiredCapabilities {
+		idempotent = idempotent || c == idempotentProducerCapability
+	}
+
+	e.mu.Lock()
+	hub, p, amqpErr := e.findSendTargetLocked(address)
+
+	if amqpErr == nil && idempotent {
+		amqpErr = hub.attachProducerLocked(link, p)
+	}
+
+	e.mu.Unlock()
+
+	if amqpErr != nil {
+		return amqpErr
+	}
+
+	link.MaxMessageSize = maxMessageSize
+
+	link.OnMessage = func(msg *amqpserver.IncomingMessage) amqpserver.DeliveryState {
+		if len(msg.Payload) > maxMessageSize {
+			return &amqpserver.Rejected{Error: &amqp.Error{
+				Condition:   errCondMessageSizeExceeded,
+				Description: fmt.Sprintf("the message size (%d bytes) exceeds the limit (%d bytes)", len(msg.Payload), maxMessageSize),
+			}}
+		}
+
+		envelope, messages, partitionKey, err := decodeMessages(msg)
+
+		if err != nil {
+			return &amqpserver.Rejected{Error: &amqp.Error{Condition: amqp.ErrCondDecodeError, Description: err.Error()}}
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		hub, p, amqpErr := e.findSendTargetLocked(address)
+
+		if amqpErr != nil {
+			return &amqpserver.Rejected{Error: amqpErr}
+		}
+
+		// a batch is stored in a single partition: the sender's partition, the partition for its
+		// partition key or, otherwise, the next partition.
+		switch {
+		case p != nil:
+		case partitionKey != nil:
+			p, _ = hub.findPartition(eh.PartitionForKey(*partitionKey, hub.partitionIDs()))
+		default:
+			p = hub.partitions[hub.nextPartition%len(hub.partitions)]
+			hub.nextPartition++
+		}
+
+		if idempotent {
+			duplicate, amqpErr := p.checkSequenceLocked(envelope, len(messages))
+
+			if amqpErr != nil {
+				return &amqpserver.Rejected{Error: amqpErr}
+			}
+
+			if duplicate {
+				// the events were already published, so they're accepted but not stored again.
+				return &amqpserver.Accepted{}
+			}
+		}
+
+		if err := p.appendLocked(messages, partitionKey, e.now); err != nil {
+			return &amqpserver.Rejected{Error: &amqp.Error{Condition: errCondInternalError, Description: err.Error()}}
+		}
+
+		return &amqpserver.Accepted{}
+	}
+
+	return nil
+}
+
+// decodeMessages decodes a message, or the messages in a batch, and the partition key they were sent with.
+// It also returns the outer message, which is the batch's envelope.
+func decodeMessages(msg *amqpserver.IncomingMessage) (*amqp.Message, []*amqp.Message, *string, error) {
+	var outer amqp.Message
+
+	if err := outer.UnmarshalBinary(msg.Payload); err != nil {
+		return nil, nil, nil, err
+	}
+
+	partitionKey := func(m *amqp.Message) *string {
+		if pk, ok := m.Annotations[partitionKeyAnnotation].(string); ok {
+			return &pk
+		}
+
+		return nil
+	}
+
+	if msg.Format != batchMessageFormat {
+		return &outer, []*amqp.Message{&outer}, partitionKey(&outer), nil
+	}
+
+	messages := make([]*amqp.Message, 0, len(outer.Data))
+
+	for _, data := range outer.Data {
+		var inner amqp.Message
+
+		if err := inner.UnmarshalBinary(data); err != nil {
+			return nil, nil, nil, err
+		}
+
+		messages = append(messages, &inner)
+	}
+
+	pk := partitionKey(&outer)
+
+	if pk == nil && len(messages) > 0 {
+		pk = partitionKey(messages[0])
+	}
+
+	return &outer, messages, pk, nil
+}
+
+// parseReceiverAddress splits a receiver's address, "<event hub>/ConsumerGroups/<consumer group>/Partitions/<partition ID>".
+func parseReceiverAddress(address string) (hubName string, consumerGroup string, partitionID string, ok bool) {
+	hubName, rest, ok := strings.Cut(address, "/ConsumerGroups/")
+
+	if !ok {
+		return "", "", "", false
+	}
+
+	consumerGroup, partitionID, ok = strings.Cut(rest, "/Partitions/")
+	return hubName, consumerGroup, partitionID, ok
+}
+
+func (e *Emulator) attachReceiver(link *amqpserver.Link, address string) *amqp.Error {
+	hubName, consumerGroup, partitionID, ok := parseReceiverAddress(address)
+
+	if !ok {
+		return &amqp.Error{Condition: errCondEntityNotFound, Description: fmt.Sprintf("The messaging entity '%s' could not be found.", address)}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	hub, err := e.findEventHubLocked(hubName)
+
+	if err != nil {
+		return &amqp.Error{Condition: errCondEntityNotFound, Description: err.Error()}
+	}
+
+	if !hub.consumerGroups[strings.ToLower(consumerGroup)] {
+		return &amqp.Error{Condition: errCondEntityNotFound, Description: fmt.Sprintf("The consumer group '%s' does not exist in event hub '%s'.", consumerGroup, hubName)}
+	}
+
+	p, err := hub.findPartition(partitionID)
+
+	if err != nil {
+		return &amqp.Error{Condition: errCondEntityNotFound, Description: err.Error()}
+	}
+
+	selector, _ := link.Source.FilterValue(selectorFilter)
+	selectorStr, _ := selector.(string)
+	start, err := p.startIndexLocked(selectorStr)
+
+	if err != nil {
+		return &amqp.Error{Condition: errCondNotImplemented, Description: err.Error()}
+	}
+
+	r := &receiver{
+		link:          link,
+		p:             p,
+		consumerGroup: strings.ToLower(consumerGroup),
+		next:          start,
+	}
+
+	r.name, _ = link.Properties[receiverNameProp].(string)
+
+	if epoch, ok := eh.ConvertToInt64(link.Properties[epochProperty]); ok {
+		r.epoch = &epoch
+	}
+
+	if amqpErr := e.claimPartitionLocked(r); amqpErr != nil {
+		// the service accepts the link, and then detaches it, so the client sees a link error.
+		link.OnCredit = func() { link.Detach(amqpErr) }
+		return nil
+	}
+
+	link.OnCredit = func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		r.deliverLocked()
+	}
+
+	link.OnDetach = func(*amqp.Error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		r.p.removeReceiverLocked(r)
+	}
+
+	p.receivers = append(p.receivers, r)
+	return nil
+}
+
+// claimPartitionLocked applies the owner level (epoch) rules for a new receiver: a receiver with an
+// epoch disconnects the receivers in its consumer group that have a lower epoch, or no epoch. A
+// receiver can't be created if there's a receiver with a higher epoch, or, without an epoch, if
+// there's a receiver with any epoch.
+func (e *Emulator) claimPartitionLocked(r *receiver) *amqp.Error {
+	var stolen []*receiver
+
+	for _, other := range r.p.receivers {
+		if other.consumerGroup != r.consumerGroup || other.epoch == nil && r.epoch == nil {
+			continue
+		}
+
+		if r.epoch == nil || other.epoch != nil && *other.epoch > *r.epoch {
+			return &amqp.Error{
+				Condition:   errCondLinkStolen,
+				Description: fmt.Sprintf("Receiver '%s' can't be created because receiver '%s' with a higher epoch of '%d' already exists.", r.name, other.name, *other.epoch),
+			}
+		}
+
+		stolen = append(stolen, other)
+	}
+
+	for _, other := range stolen {
+		r.p.removeReceiverLocked(other)
+
+		// Detach calls OnDetach, which takes e.mu.
+		go other.link.Detach(&amqp.Error{
+			Condition:   errCondLinkStolen,
+			Description: fmt.Sprintf("New receiver '%s' with higher epoch of '%d' is created hence current receiver '%s' is getting disconnected.", r.name, *r.epoch, other.name),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+// handleManagement handles a request sent to the $management address.
+func (e *Emulator) handleManagement(req *amqp.Message) *amqp.Message {
+	operation, _ := req.ApplicationProperties["operation"].(string)
+	hubName, _ := req.ApplicationProperties["name"].(string)
+	entityType, _ := req.ApplicationProperties["type"].(string)
+
+	if operation != "READ" {
+		return newResponse(501, fmt.Sprintf("The operation %q isn't supported by the emulator.", operation), nil)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	hub, err := e.findEventHubLocked(hubName)
+
+	if err != nil {
+		return newResponse(404, err.Error(), nil)
+	}
+
+	switch entityType {
+	case "com.microsoft:eventhub":
+		return newResponse(200, "OK", map[string]any{
+			"name":                  hub.name,
+			"created_at":            hub.createdAt,
+			"partition_ids":         hub.partitionIDs(),
+			"georeplication_factor": int32(1),
+		})
+	case "com.microsoft:partition":
+		partitionID, _ := req.ApplicationProperties["partition"].(string)
+		p, err := hub.findPartition(partitionID)
+
+		if err != nil {
+			return newResponse(404, err.Error(), nil)
+		}
+
+		props := map[string]any{
+			"name":                          hub.name,
+			"partition":                     p.id,
+			"begin_sequence_number":         int64(0),
+			"last_enqueued_sequence_number": int64(-1),
+			"last_enqueued_offset":          "-1",
+			"last_enqueued_time_utc":        time.Time{},
+			"is_partition_empty":            len(p.events) == 0,
+		}
+
+		if len(p.events) > 0 {
+			last := p.events[len(p.events)-1]
+			props["last_enqueued_sequence_number"] = last.sequenceNumber
+			props["last_enqueued_offset"] = strconv.FormatInt(last.offset, 10)
+			props["last_enqueued_time_utc"] = last.enqueuedTime
+		}
+
+		return newResponse(200, "OK", props)
+	}
+
+	return newResponse(400, fmt.Sprintf("The entity type %q is invalid.", entityType), nil)
+}
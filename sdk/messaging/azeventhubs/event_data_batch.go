@@ -6,6 +6,7 @@ package azeventhubs
 import (
 	"errors"
 	"fmt"
+	"math"
 	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
@@ -33,9 +34,25 @@ type (
 
 		partitionID  *string
 		partitionKey *string
+
+		// idempotent is true for batches created by a ProducerClient with idempotent publishing enabled.
+		// Space for the producer state is reserved in each event, and the state is stamped on the
+		// events when the batch is sent.
+		idempotent bool
+
+		// publishing is the producer state the batch was assigned when it was first sent. The batch keeps
+		// it, so sending the batch again is deduplicated by the service.
+		publishing *batchPublishingState
 	}
 )
 
+// batchPublishingState is the producer state that's stamped on the events in an idempotent batch.
+type batchPublishingState struct {
+	producerGroupID        int64
+	ownerLevel             int16
+	startingSequenceNumber int32
+}
+
 const (
 	batchMessageFormat uint32 = 0x80013700
 )
@@ -87,6 +104,21 @@ func (b *EventDataBatch) NumEvents() int32 {
 	return int32(len(b.marshaledMessages))
 }
 
+// StartingPublishedSequenceNumber is the sequence number the service assigned to the first event in the
+// batch, when the batch was sent with idempotent publishing enabled. It's nil until the batch is sent, or
+// if idempotent publishing isn't enabled.
+func (b *EventDataBatch) StartingPublishedSequenceNumber() *int32 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.publishing == nil {
+		return nil
+	}
+
+	seq := b.publishing.startingSequenceNumber
+	return &seq
+}
+
 // toAMQPMessage converts this batch into a sendable *amqp.Message
 // NOTE: not idempotent!
 func (b *EventDataBatch) toAMQPMessage() (*amqp.Message, error) {
@@ -109,9 +141,57 @@ func (b *EventDataBatch) toAMQPMessage() (*amqp.Message, error) {
 	}
 
 	copy(b.batchEnvelope.Data, b.marshaledMessages)
+
+	if b.publishing != nil {
+		if err := b.stampPublishingStateLocked(); err != nil {
+			return nil, err
+		}
+	}
+
 	return b.batchEnvelope, nil
 }
 
+// stampPublishingStateLocked replaces the producer state that was reserved in the envelope, and in
+// each event, with the state the batch was assigned. Each event gets its own sequence number.
+func (b *EventDataBatch) stampPublishingStateLocked() error {
+	for i, data := range b.batchEnvelope.Data {
+		var msg amqp.Message
+
+		if err := msg.UnmarshalBinary(data); err != nil {
+			return err
+		}
+
+		setPublishingAnnotations(&msg, b.publishing.producerGroupID, b.publishing.ownerLevel, addSequenceNumber(b.publishing.startingSequenceNumber, i))
+
+		bin, err := msg.MarshalBinary()
+
+		if err != nil {
+			return err
+		}
+
+		b.batchEnvelope.Data[i] = bin
+	}
+
+	setPublishingAnnotations(b.batchEnvelope, b.publishing.producerGroupID, b.publishing.ownerLevel, b.publishing.startingSequenceNumber)
+	return nil
+}
+
+func setPublishingAnnotations(msg *amqp.Message, producerGroupID int64, ownerLevel int16, sequenceNumber int32) {
+	if msg.Annotations == nil {
+		msg.Annotations = make(amqp.Annotations)
+	}
+
+	msg.Annotations[internal.ProducerIDProperty] = producerGroupID
+	msg.Annotations[internal.ProducerEpochProperty] = ownerLevel
+	msg.Annotations[internal.ProducerSequenceNumberProperty] = sequenceNumber
+}
+
+// addSequenceNumber adds n to an idempotent producer's sequence number. Sequence numbers wrap around to
+// zero after math.MaxInt32.
+func addSequenceNumber(sequenceNumber int32, n int) int32 {
+	return int32((int64(sequenceNumber) + int64(n)) % (math.MaxInt32 + 1))
+}
+
 func (b *EventDataBatch) addAMQPMessage(msg *amqp.Message) error {
 	if msg.Properties.MessageID == nil || msg.Properties.MessageID == "" {
 		uid, err := uuid.New()
@@ -129,6 +209,12 @@ func (b *EventDataBatch) addAMQPMessage(msg *amqp.Message) error {
 		msg.Annotations[partitionKeyAnnotation] = *b.partitionKey
 	}
 
+	if b.idempotent {
+		// the largest values take the most space, so the batch has room for the actual producer state,
+		// which is stamped on the event when the batch is sent.
+		setPublishingAnnotations(msg, math.MaxInt64, math.MaxInt16, math.MaxInt32)
+	}
+
 	bin, err := msg.MarshalBinary()
 	if err != nil {
 		return err
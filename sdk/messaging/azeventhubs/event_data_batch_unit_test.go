@@ -5,10 +5,12 @@ package azeventhubs
 
 import (
 	"fmt"
+	"math"
 	"sync"
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/amqpwrap"
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/mock"
 	"github.com/Azure/go-amqp"
@@ -275,6 +277,33 @@ func TestUnitEventDataBatchAlwaysHasProperties(t *testing.T) {
 	})
 }
 
+func TestUnitEventDataBatchIdempotent(t *testing.T) {
+	batch, err := newEventDataBatch(eventBatchLinkForTest{maxMessageSize: 10000}, &EventDataBatchOptions{PartitionID: to.Ptr("0")})
+	require.NoError(t, err)
+	batch.idempotent = true
+
+	require.NoError(t, batch.AddEventData(&EventData{Body: []byte("a")}, nil))
+	require.NoError(t, batch.AddEventData(&EventData{Body: []byte("b")}, nil))
+	require.Nil(t, batch.StartingPublishedSequenceNumber())
+
+	batch.publishing = &batchPublishingState{producerGroupID: 5, ownerLevel: 1, startingSequenceNumber: math.MaxInt32}
+
+	msg, err := batch.toAMQPMessage()
+	require.NoError(t, err)
+	require.LessOrEqual(t, uint64(mustEncode(t, msg)), batch.NumBytes(), "the space reserved for the producer state is enough")
+
+	require.Equal(t, int64(5), msg.Annotations[internal.ProducerIDProperty])
+	require.Equal(t, int16(1), msg.Annotations[internal.ProducerEpochProperty])
+	require.Equal(t, int32(math.MaxInt32), msg.Annotations[internal.ProducerSequenceNumberProperty])
+
+	// each event has its own sequence number, which wraps around to zero.
+	for i, expected := range []int32{math.MaxInt32, 0} {
+		var event amqp.Message
+		require.NoError(t, event.UnmarshalBinary(msg.Data[i]))
+		require.Equal(t, expected, event.Annotations[internal.ProducerSequenceNumberProperty])
+	}
+}
+
 func mustEncode(t *testing.T, msg *amqp.Message) int {
 	bytes, err := msg.MarshalBinary()
 	require.NoError(t, err)
@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+)
+
+// Shows how to send events using the [BufferedProducer], which batches events for each
+// partition in the background.
+func Example_producingEventsUsingBufferedProducer() {
+	eventHubNamespace := os.Getenv("EVENTHUB_NAMESPACE") // <ex: myeventhubnamespace.servicebus.windows.net>
+	eventHubName := os.Getenv("EVENTHUB_NAME")
+
+	defaultAzureCred, err := azidentity.NewDefaultAzureCredential(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	producerClient, err := azeventhubs.NewProducerClient(eventHubNamespace, eventHubName, defaultAzureCred, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer func() { _ = producerClient.Close(context.TODO()) }()
+
+	bufferedProducer, err := azeventhubs.NewBufferedProducer(producerClient, &azeventhubs.BufferedProducerOptions{
+		// send batches that haven't filled up after 500ms.
+		MaxWaitTime: 500 * time.Millisecond,
+		SendSucceeded: func(args azeventhubs.SendEventsSucceededArgs) {
+			fmt.Printf("Sent %d events to partition %s\n", len(args.Events), args.PartitionID)
+		},
+		SendFailed: func(args azeventhubs.SendEventsFailedArgs) {
+			// The events could be logged, or enqueued again.
+			fmt.Printf("Failed to send %d events to partition %s: %s\n", len(args.Events), args.PartitionID, args.Err)
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		// Events with the same partition key are always sent to the same partition.
+		err := bufferedProducer.Enqueue(context.TODO(), &azeventhubs.EventData{
+			Body: []byte(fmt.Sprintf("hello world %d", i)),
+		}, &azeventhubs.EnqueueEventOptions{
+			PartitionKey: to.Ptr(fmt.Sprintf("device-%d", i%10)),
+		})
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Close sends any events that are still buffered. The ProducerClient should be closed afterwards.
+	if err := bufferedProducer.Close(context.TODO()); err != nil {
+		panic(err)
+	}
+}
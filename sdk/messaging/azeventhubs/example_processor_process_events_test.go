@@ -0,0 +1,90 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+)
+
+// Shows how to use [ProcessorPartitionClient.ProcessEvents] to process the events in each partition
+// concurrently, while events with the same partition key are processed in order, and checkpoints
+// are updated automatically.
+func ExampleProcessorPartitionClient_ProcessEvents() {
+	eventHubNamespace := os.Getenv("EVENTHUB_NAMESPACE")
+	eventHubName := os.Getenv("EVENTHUB_NAME")
+
+	storageEndpoint := os.Getenv("CHECKPOINTSTORE_STORAGE_ENDPOINT")
+	storageContainerName := os.Getenv("CHECKPOINTSTORE_STORAGE_CONTAINER_NAME")
+
+	if eventHubName == "" || eventHubNamespace == "" || storageEndpoint == "" || storageContainerName == "" {
+		fmt.Fprintf(os.Stderr, "Skipping example, environment variables missing\n")
+		return
+	}
+
+	consumerClient, checkpointStore, err := createClientsForExample(eventHubNamespace, eventHubName, storageEndpoint, storageContainerName)
+
+	if err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Printf("ERROR: %s", err)
+		return
+	}
+
+	defer func() { _ = consumerClient.Close(context.TODO()) }()
+
+	processor, err := azeventhubs.NewProcessor(consumerClient, checkpointStore, nil)
+
+	if err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Printf("ERROR: %s", err)
+		return
+	}
+
+	processorCtx, processorCancel := context.WithCancel(context.TODO())
+	defer processorCancel()
+
+	go func() {
+		for {
+			partitionClient := processor.NextPartitionClient(processorCtx)
+
+			if partitionClient == nil {
+				// Processor has stopped
+				break
+			}
+
+			go func() {
+				defer func() { _ = partitionClient.Close(context.TODO()) }()
+
+				err := partitionClient.ProcessEvents(processorCtx, func(ctx context.Context, event *azeventhubs.ReceivedEventData) error {
+					log.Printf("Processing event %d from partition %s", event.SequenceNumber, partitionClient.PartitionID())
+					return nil
+				}, &azeventhubs.ProcessEventsOptions{
+					// process up to 8 events at a time. Events with the same partition key are
+					// still processed one at a time, in order.
+					Concurrency: 8,
+
+					// update the checkpoint after every 100 events, or every 10 seconds.
+					CheckpointEveryEvents: 100,
+					CheckpointInterval:    10 * time.Second,
+				})
+
+				if err != nil {
+					// TODO: Update the following line with your application specific error handling logic
+					log.Printf("ERROR: %s", err)
+				}
+			}()
+		}
+	}()
+
+	if err := processor.Run(processorCtx); err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Printf("ERROR: %s", err)
+		return
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs
+
+// NewCheckpointStoreForTest exposes the in-memory checkpoint store to the azeventhubs_test package,
+// so it can run the conformance tests in checkpoints/checkpointstoretest without an import cycle.
+func NewCheckpointStoreForTest() CheckpointStore {
+	return newCheckpointStoreForTest()
+}
@@ -220,11 +220,7 @@ func (cps *testCheckpointStore) ClaimOwnership(ctx context.Context, partitionOwn
 			current, exists := cps.ownerships[key]
 
 			if exists {
-				if po.ETag == nil {
-					panic("Ownership blob exists, we should have claimed it using an etag")
-				}
-
-				if *po.ETag != *current.ETag {
+				if po.ETag == nil || *po.ETag != *current.ETag {
 					// can't own it, didn't have the expected etag
 					return nil, nil
 				}
@@ -263,7 +259,9 @@ func (cps *testCheckpointStore) ListCheckpoints(ctx context.Context, fullyQualif
 	var checkpoints []Checkpoint
 
 	for _, v := range cps.checkpoints {
-		checkpoints = append(checkpoints, v)
+		if v.FullyQualifiedNamespace == fullyQualifiedNamespace && v.EventHubName == eventHubName && v.ConsumerGroup == consumerGroup {
+			checkpoints = append(checkpoints, v)
+		}
 	}
 
 	return checkpoints, nil
@@ -276,7 +274,9 @@ func (cps *testCheckpointStore) ListOwnership(ctx context.Context, fullyQualifie
 	var ownerships []Ownership
 
 	for _, v := range cps.ownerships {
-		ownerships = append(ownerships, v)
+		if v.FullyQualifiedNamespace == fullyQualifiedNamespace && v.EventHubName == eventHubName && v.ConsumerGroup == consumerGroup {
+			ownerships = append(ownerships, v)
+		}
 	}
 
 	sort.Slice(ownerships, func(i, j int) bool {
@@ -0,0 +1,325 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package amqpserver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/go-amqp"
+)
+
+// descriptor codes, from the AMQP 1.0 spec.
+const (
+	codeOpen        uint64 = 0x10
+	codeBegin       uint64 = 0x11
+	codeAttach      uint64 = 0x12
+	codeFlow        uint64 = 0x13
+	codeTransfer    uint64 = 0x14
+	codeDisposition uint64 = 0x15
+	codeDetach      uint64 = 0x16
+	codeEnd         uint64 = 0x17
+	codeClose       uint64 = 0x18
+	codeError       uint64 = 0x1d
+	codeAccepted    uint64 = 0x24
+	codeRejected    uint64 = 0x25
+	codeReleased    uint64 = 0x26
+	codeModified    uint64 = 0x27
+	codeSource      uint64 = 0x28
+	codeTarget      uint64 = 0x29
+
+	codeSASLMechanisms uint64 = 0x40
+	codeSASLInit       uint64 = 0x41
+	codeSASLOutcome    uint64 = 0x44
+)
+
+const (
+	frameTypeAMQP = 0x0
+	frameTypeSASL = 0x1
+)
+
+// performative is a decoded frame body: the descriptor code and its fields.
+type performative struct {
+	code   uint64
+	fields []any
+}
+
+func (p performative) field(i int) any {
+	if i < len(p.fields) {
+		return p.fields[i]
+	}
+
+	return nil
+}
+
+func (p performative) uint32(i int) (uint32, bool) {
+	v, ok := p.field(i).(uint32)
+	return v, ok
+}
+
+func (p performative) bool(i int) bool {
+	v, _ := p.field(i).(bool)
+	return v
+}
+
+func decodePerformative(body []byte) (performative, []byte, error) {
+	d := &decoder{buf: body}
+	v, err := d.readValue()
+
+	if err != nil {
+		return performative{}, nil, err
+	}
+
+	desc, ok := v.(described)
+
+	if !ok {
+		return performative{}, nil, errors.New("amqp: frame body is not a described type")
+	}
+
+	code, ok := descriptorCode(desc.descriptor)
+
+	if !ok {
+		return performative{}, nil, fmt.Errorf("amqp: unsupported descriptor %v", desc.descriptor)
+	}
+
+	fields, _ := desc.value.([]any)
+
+	return performative{code: code, fields: fields}, body[d.pos:], nil
+}
+
+func descriptorCode(v any) (uint64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return v, true
+	case amqp.Symbol:
+		// symbolic descriptors are valid, but go-amqp always sends the numeric ones.
+		return 0, false
+	}
+
+	return 0, false
+}
+
+func encodePerformative(code uint64, fields ...any) ([]byte, error) {
+	// trailing nulls can be omitted
+	for len(fields) > 0 && fields[len(fields)-1] == nil {
+		fields = fields[:len(fields)-1]
+	}
+
+	e := encoder{}
+
+	if err := e.writeValue(described{descriptor: code, value: fields}); err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+// Terminus is the source or target of a link, as sent by the client.
+type Terminus struct {
+	// Address is the address of the terminus.
+	Address string
+
+	// Filter is the filter set of the source, keyed by filter name.
+	Filter map[amqp.Symbol]any
+
+	code   uint64
+	fields []any
+}
+
+// FilterValue returns the value of the filter with the given name, and whether it was set.
+func (t *Terminus) FilterValue(name string) (any, bool) {
+	if t == nil {
+		return nil, false
+	}
+
+	v, ok := t.Filter[amqp.Symbol(name)]
+
+	if !ok {
+		return nil, false
+	}
+
+	if d, ok := v.(described); ok {
+		return d.value, true
+	}
+
+	return v, true
+}
+
+// SetFilterValue replaces the value of a filter that was sent by the client. Use it to
+// tell the client which filter was applied, ex: the session that was locked.
+func (t *Terminus) SetFilterValue(name string, value any) {
+	if t == nil {
+		return
+	}
+
+	if d, ok := t.Filter[amqp.Symbol(name)].(described); ok {
+		t.Filter[amqp.Symbol(name)] = described{descriptor: d.descriptor, value: value}
+	}
+}
+
+func parseTerminus(v any) *Terminus {
+	d, ok := v.(described)
+
+	if !ok {
+		return nil
+	}
+
+	code, _ := descriptorCode(d.descriptor)
+	fields, _ := d.value.([]any)
+	t := &Terminus{code: code, fields: fields}
+
+	if len(fields) > 0 {
+		t.Address, _ = fields[0].(string)
+	}
+
+	if code == codeSource && len(fields) > 7 {
+		if m, ok := fields[7].(map[any]any); ok {
+			t.Filter = map[amqp.Symbol]any{}
+
+			for k, v := range m {
+				if s, ok := k.(amqp.Symbol); ok {
+					t.Filter[s] = v
+				}
+			}
+		}
+	}
+
+	return t
+}
+
+func (t *Terminus) encode() any {
+	if t == nil {
+		return nil
+	}
+
+	fields := append([]any(nil), t.fields...)
+
+	if t.code == codeSource && t.Filter != nil {
+		for len(fields) < 8 {
+			fields = append(fields, nil)
+		}
+
+		m := map[any]any{}
+
+		for k, v := range t.Filter {
+			m[k] = v
+		}
+
+		fields[7] = m
+	}
+
+	return described{descriptor: t.code, value: fields}
+}
+
+// DeliveryState is the outcome of a delivery: [*Accepted], [*Rejected], [*Released] or [*Modified].
+type DeliveryState interface {
+	encode() any
+}
+
+// Accepted is the accepted outcome.
+type Accepted struct{}
+
+// Rejected is the rejected outcome.
+type Rejected struct {
+	Error *amqp.Error
+}
+
+// Released is the released outcome.
+type Released struct{}
+
+// Modified is the modified outcome.
+type Modified struct {
+	DeliveryFailed    bool
+	UndeliverableHere bool
+	Annotations       map[any]any
+}
+
+func (*Accepted) encode() any { return described{descriptor: codeAccepted, value: []any{}} }
+
+func (s *Rejected) encode() any {
+	if s.Error == nil {
+		return described{descriptor: codeRejected, value: []any{}}
+	}
+
+	return described{descriptor: codeRejected, value: []any{s.Error}}
+}
+
+func (*Released) encode() any { return described{descriptor: codeReleased, value: []any{}} }
+
+func (s *Modified) encode() any {
+	var annotations any
+
+	if s.Annotations != nil {
+		annotations = s.Annotations
+	}
+
+	return described{descriptor: codeModified, value: []any{s.DeliveryFailed, s.UndeliverableHere, annotations}}
+}
+
+func parseDeliveryState(v any) DeliveryState {
+	d, ok := v.(described)
+
+	if !ok {
+		return nil
+	}
+
+	code, _ := descriptorCode(d.descriptor)
+	p := performative{code: code}
+	p.fields, _ = d.value.([]any)
+
+	switch code {
+	case codeAccepted:
+		return &Accepted{}
+	case codeRejected:
+		return &Rejected{Error: parseError(p.field(0))}
+	case codeReleased:
+		return &Released{}
+	case codeModified:
+		annotations, _ := p.field(2).(map[any]any)
+		return &Modified{DeliveryFailed: p.bool(0), UndeliverableHere: p.bool(1), Annotations: annotations}
+	}
+
+	return nil
+}
+
+func parseError(v any) *amqp.Error {
+	d, ok := v.(described)
+
+	if !ok {
+		return nil
+	}
+
+	p := performative{}
+	p.fields, _ = d.value.([]any)
+
+	cond, _ := p.field(0).(amqp.Symbol)
+	desc, _ := p.field(1).(string)
+	e := &amqp.Error{Condition: amqp.ErrCond(cond), Description: desc}
+
+	e.Info = stringMap(p.field(2))
+
+	return e
+}
+
+// stringMap converts a decoded AMQP map with symbol or string keys.
+func stringMap(v any) map[string]any {
+	m, ok := v.(map[any]any)
+
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string]any, len(m))
+
+	for k, v := range m {
+		switch k := k.(type) {
+		case amqp.Symbol:
+			result[string(k)] = v
+		case string:
+			result[k] = v
+		}
+	}
+
+	return result
+}
@@ -48,6 +48,9 @@ type AMQPSender interface {
 	MaxMessageSize() uint64
 	LinkName() string
 	ConnID() uint64
+
+	// Properties returns the link properties the service sent when the link was attached.
+	Properties() map[string]any
 }
 
 // AMQPSenderCloser is implemented by *amqp.Sender
@@ -102,6 +105,7 @@ type goamqpSender interface {
 	Send(ctx context.Context, msg *amqp.Message, o *amqp.SendOptions) error
 	MaxMessageSize() uint64
 	LinkName() string
+	Properties() map[string]any
 	Close(ctx context.Context) error
 }
 
@@ -290,6 +294,10 @@ func (sw *AMQPSenderWrapper) LinkName() string {
 	return sw.Inner.LinkName()
 }
 
+func (sw *AMQPSenderWrapper) Properties() map[string]any {
+	return sw.Inner.Properties()
+}
+
 func (sw *AMQPSenderWrapper) Close(ctx context.Context) error {
 	ctx, cancel := sw.ContextWithTimeoutFn(ctx, defaultCloseTimeout)
 	defer cancel()
@@ -4,7 +4,18 @@
 package internal
 
 // Version is the semantic version number
-const Version = "v2.0.3"
+const Version = "v2.1.0-beta.1"
 
 // CapabilityGeoDRReplication is passed as part of our desired capabilities when creating links.
 const CapabilityGeoDRReplication = "com.microsoft:georeplication"
+
+// CapabilityIdempotentProducer is passed as part of our desired capabilities when creating producer
+// links with idempotent publishing enabled.
+const CapabilityIdempotentProducer = "com.microsoft:idempotent-producer"
+
+// These are the link properties, and message annotations, that carry an idempotent producer's state.
+const (
+	ProducerIDProperty             = "com.microsoft:producer-id"
+	ProducerEpochProperty          = "com.microsoft:producer-epoch"
+	ProducerSequenceNumberProperty = "com.microsoft:producer-sequence-number"
+)
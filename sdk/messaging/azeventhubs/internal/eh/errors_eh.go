@@ -13,6 +13,14 @@ import (
 // geo-replication enabled, which requires the new stroffset format.
 const ErrCondGeoReplicationOffset = amqp.ErrCond("com.microsoft:georeplication:invalid-offset")
 
+// ErrCondProducerEpochStolen occurs when an idempotent producer publishes to a partition after another
+// producer, with the same producer group and a higher owner level, has claimed it.
+const ErrCondProducerEpochStolen = amqp.ErrCond("com.microsoft:producer-epoch-stolen")
+
+// ErrCondOutOfOrderSequence occurs when an idempotent producer publishes events whose sequence numbers
+// don't follow the last sequence number the service has for the producer group.
+const ErrCondOutOfOrderSequence = amqp.ErrCond("com.microsoft:out-of-order-sequence")
+
 // IsGeoReplicationOffsetError checks if we've received a "bad offset" error from Event Hubs.
 // This should only happpen if:
 //
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package eh
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// PartitionForKey returns the partition that Event Hubs assigns events with partitionKey to.
+//
+// It uses the same algorithm as the service, and the other Event Hubs SDKs: the partition key is
+// hashed with Bob Jenkins' lookup3 (hashlittle2), the two 32-bit hashes are folded into an int16,
+// and its absolute value, modulo the partition count, is the index into partitionIDs.
+func PartitionForKey(partitionKey string, partitionIDs []string) string {
+	hash1, hash2 := ComputeHash([]byte(partitionKey), 0, 0)
+	hash := int(int16(hash1 ^ hash2))
+
+	index := hash % len(partitionIDs)
+
+	if index < 0 {
+		index = -index
+	}
+
+	return partitionIDs[index]
+}
+
+// ComputeHash is lookup3's hashlittle2, returning the primary (c) and secondary (b) hashes.
+// See http://burtleburtle.net/bob/c/lookup3.c
+func ComputeHash(data []byte, seed1 uint32, seed2 uint32) (uint32, uint32) {
+	a := 0xdeadbeef + uint32(len(data)) + seed1
+	b, c := a, a
+	c += seed2
+
+	for len(data) > 12 {
+		a += binary.LittleEndian.Uint32(data)
+		b += binary.LittleEndian.Uint32(data[4:])
+		c += binary.LittleEndian.Uint32(data[8:])
+
+		// mix(a, b, c)
+		a -= c
+		a ^= bits.RotateLeft32(c, 4)
+		c += b
+		b -= a
+		b ^= bits.RotateLeft32(a, 6)
+		a += c
+		c -= b
+		c ^= bits.RotateLeft32(b, 8)
+		b += a
+		a -= c
+		a ^= bits.RotateLeft32(c, 16)
+		c += b
+		b -= a
+		b ^= bits.RotateLeft32(a, 19)
+		a += c
+		c -= b
+		c ^= bits.RotateLeft32(b, 4)
+		b += a
+
+		data = data[12:]
+	}
+
+	if len(data) == 0 {
+		return c, b
+	}
+
+	// the last block is zero padded, so it can be read like the full blocks.
+	var tail [12]byte
+	copy(tail[:], data)
+
+	a += binary.LittleEndian.Uint32(tail[:])
+	b += binary.LittleEndian.Uint32(tail[4:])
+	c += binary.LittleEndian.Uint32(tail[8:])
+
+	// final(a, b, c)
+	c ^= b
+	c -= bits.RotateLeft32(b, 14)
+	a ^= c
+	a -= bits.RotateLeft32(c, 11)
+	b ^= a
+	b -= bits.RotateLeft32(a, 25)
+	c ^= b
+	c -= bits.RotateLeft32(b, 16)
+	a ^= c
+	a -= bits.RotateLeft32(c, 4)
+	b ^= a
+	b -= bits.RotateLeft32(a, 14)
+	c ^= b
+	c -= bits.RotateLeft32(b, 24)
+
+	return c, b
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package eh
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeHash(t *testing.T) {
+	// test vectors from lookup3.c's driver5()
+	tests := []struct {
+		data   string
+		seed1  uint32
+		seed2  uint32
+		hash1  uint32
+		hash2  uint32
+		reason string
+	}{
+		{"", 0, 0, 0xdeadbeef, 0xdeadbeef, "empty, no seeds"},
+		{"", 0, 0xdeadbeef, 0xbd5b7dde, 0xdeadbeef, "empty, second seed"},
+		{"", 0xdeadbeef, 0xdeadbeef, 0x9c093ccd, 0xbd5b7dde, "empty, both seeds"},
+		{"Four score and seven years ago", 0, 0, 0x17770551, 0xce7226e6, "no seeds"},
+		{"Four score and seven years ago", 0, 1, 0xe3607cae, 0xbd371de4, "second seed"},
+		{"Four score and seven years ago", 1, 0, 0xcd628161, 0x6cbea4b3, "first seed"},
+	}
+
+	for _, test := range tests {
+		hash1, hash2 := ComputeHash([]byte(test.data), test.seed1, test.seed2)
+		require.Equalf(t, test.hash1, hash1, "hash1 for %s", test.reason)
+		require.Equalf(t, test.hash2, hash2, "hash2 for %s", test.reason)
+	}
+}
+
+func TestPartitionForKey(t *testing.T) {
+	partitionIDs := []string{"0", "1", "2", "3"}
+	seen := map[string]bool{}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		partitionID := PartitionForKey(key, partitionIDs)
+
+		require.Contains(t, partitionIDs, partitionID)
+		require.Equal(t, partitionID, PartitionForKey(key, partitionIDs), "the same key always goes to the same partition")
+		seen[partitionID] = true
+	}
+
+	require.Len(t, seen, len(partitionIDs), "keys are spread over all partitions")
+}
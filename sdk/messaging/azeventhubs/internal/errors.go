@@ -144,6 +144,8 @@ var amqpConditionsToRecoveryKind = map[amqp.ErrCond]RecoveryKind{
 	amqp.ErrCond("com.microsoft:argument-out-of-range"):    RecoveryKindFatal, // asked for a partition ID that doesn't exist
 	errorConditionLockLost:                                 RecoveryKindFatal,
 	eh.ErrCondGeoReplicationOffset:                         RecoveryKindFatal,
+	eh.ErrCondProducerEpochStolen:                          RecoveryKindFatal,
+	eh.ErrCondOutOfOrderSequence:                           RecoveryKindFatal,
 }
 
 // GetRecoveryKind determines the recovery type for non-session based links.
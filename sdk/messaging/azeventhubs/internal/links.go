@@ -120,6 +120,12 @@ func (l *Links[LinkT]) GetLink(ctx context.Context, partitionID string) (LinkWit
 	return current, nil
 }
 
+// CloseLink closes the link for a partition, if it's still the link named linkName, so the next
+// operation on the partition opens a new link.
+func (l *Links[LinkT]) CloseLink(ctx context.Context, partitionID string, linkName string) error {
+	return l.closePartitionLinkIfMatch(ctx, partitionID, linkName)
+}
+
 func (l *Links[LinkT]) GetManagementLink(ctx context.Context) (LinkWithID[amqpwrap.RPCLink], error) {
 	if err := l.checkOpen(); err != nil {
 		return nil, err
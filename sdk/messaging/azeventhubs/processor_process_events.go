@@ -0,0 +1,384 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+)
+
+// EventHandler processes an event for [ProcessorPartitionClient.ProcessEvents].
+//
+// The event is only included in a checkpoint after the handler returns nil. If the handler returns
+// an error, processing stops, and the event will be received again when the partition is next
+// processed.
+type EventHandler func(ctx context.Context, event *ReceivedEventData) error
+
+// ProcessEventsOptions contains optional parameters for the [ProcessorPartitionClient.ProcessEvents] function.
+type ProcessEventsOptions struct {
+	// CheckpointEveryEvents updates the checkpoint once this many events have been processed
+	// since the last checkpoint.
+	CheckpointEveryEvents int
+
+	// CheckpointInterval updates the checkpoint at this interval, if events have been processed
+	// since the last checkpoint.
+	// If CheckpointEveryEvents and CheckpointInterval are both zero, this defaults to 10 seconds.
+	CheckpointInterval time.Duration
+
+	// Concurrency is the number of events that can be processed at the same time. Events with the
+	// same ordering key are always processed one at a time, in the order they were received.
+	// Default is 1, which processes the events in the partition one at a time.
+	Concurrency int
+
+	// OrderingKey returns the ordering key for an event. Events without a key, when OrderingKey
+	// returns "", can be processed in any order.
+	// Default uses the event's PartitionKey.
+	OrderingKey func(event *ReceivedEventData) string
+
+	// ReceiveCount is the maximum number of events to receive in each call to ReceiveEvents.
+	// Default is 100.
+	ReceiveCount int
+
+	// ReceiveWaitTime is the maximum time to wait for ReceiveCount events in each call to
+	// ReceiveEvents.
+	// Default is 1 second.
+	ReceiveWaitTime time.Duration
+}
+
+// ProcessEvents receives events from the partition and passes each one to the handler, until the context
+// is cancelled, another Processor claims the partition, or an error occurs.
+//
+// The checkpoint is updated periodically, based on CheckpointEveryEvents and CheckpointInterval, and
+// when ProcessEvents returns. Events can be processed concurrently, so the checkpoint is the last
+// event for which all the events received before it have also been processed. If processing
+// restarts, events that were processed after the checkpoint are received again.
+//
+// ProcessEvents returns nil when the context is cancelled, or when the partition is claimed by
+// another Processor. Otherwise, it returns the first error from the handler, ReceiveEvents or
+// UpdateCheckpoint, after the events that are being processed have finished. Call Close when
+// ProcessEvents returns.
+func (c *ProcessorPartitionClient) ProcessEvents(ctx context.Context, handler EventHandler, options *ProcessEventsOptions) error {
+	return processEvents(ctx, c, handler, options)
+}
+
+// eventProcessorClient is the subset of ProcessorPartitionClient that processEvents uses.
+type eventProcessorClient interface {
+	ReceiveEvents(ctx context.Context, count int, options *ReceiveEventsOptions) ([]*ReceivedEventData, error)
+	UpdateCheckpoint(ctx context.Context, latestEvent *ReceivedEventData, options *UpdateCheckpointOptions) error
+	PartitionID() string
+}
+
+func processEvents(ctx context.Context, client eventProcessorClient, handler EventHandler, options *ProcessEventsOptions) error {
+	opts := ProcessEventsOptions{}
+
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.CheckpointEveryEvents <= 0 && opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = 10 * time.Second
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	if opts.OrderingKey == nil {
+		opts.OrderingKey = func(event *ReceivedEventData) string {
+			if event.PartitionKey == nil {
+				return ""
+			}
+
+			return *event.PartitionKey
+		}
+	}
+
+	if opts.ReceiveCount <= 0 {
+		opts.ReceiveCount = 100
+	}
+
+	if opts.ReceiveWaitTime <= 0 {
+		opts.ReceiveWaitTime = time.Second
+	}
+
+	ep := &eventProcessor{
+		client:  client,
+		handler: handler,
+		tracker: &checkpointTracker{checkpointEvery: opts.CheckpointEveryEvents},
+		due:     make(chan struct{}, 1),
+	}
+
+	return ep.run(ctx, opts)
+}
+
+type eventProcessor struct {
+	client  eventProcessorClient
+	handler EventHandler
+	tracker *checkpointTracker
+
+	// due is signalled when enough events have been processed to update the checkpoint.
+	due chan struct{}
+
+	errMu sync.Mutex
+	err   error
+}
+
+func (ep *eventProcessor) run(ctx context.Context, opts ProcessEventsOptions) error {
+	processCtx, cancelProcess := context.WithCancel(ctx)
+	defer cancelProcess()
+
+	// each lane processes its events one at a time, so events with the same ordering key,
+	// which always go to the same lane, are processed in order.
+	lanes := make([]chan *trackedEvent, opts.Concurrency)
+	lanesWG := sync.WaitGroup{}
+
+	for i := range lanes {
+		lanes[i] = make(chan *trackedEvent, opts.ReceiveCount)
+		lanesWG.Add(1)
+
+		go func(lane chan *trackedEvent) {
+			defer lanesWG.Done()
+			ep.processLane(processCtx, lane, cancelProcess)
+		}(lanes[i])
+	}
+
+	checkpointerDone := make(chan struct{})
+	stopCheckpointer := make(chan struct{})
+
+	go func() {
+		defer close(checkpointerDone)
+		ep.runCheckpointer(processCtx, opts.CheckpointInterval, stopCheckpointer, cancelProcess)
+	}()
+
+	ownershipLost := false
+	nextLane := 0
+
+	for processCtx.Err() == nil {
+		receiveCtx, cancelReceive := context.WithTimeout(processCtx, opts.ReceiveWaitTime)
+		events, err := ep.client.ReceiveEvents(receiveCtx, opts.ReceiveCount, nil)
+		cancelReceive()
+
+		for _, te := range ep.tracker.add(events) {
+			lane := nextLane
+
+			if key := opts.OrderingKey(te.event); key != "" {
+				h := fnv.New32a()
+				_, _ = h.Write([]byte(key))
+				lane = int(h.Sum32() % uint32(len(lanes)))
+			} else {
+				nextLane = (nextLane + 1) % len(lanes)
+			}
+
+			lanes[lane] <- te
+		}
+
+		if err == nil || (errors.Is(err, context.DeadlineExceeded) && processCtx.Err() == nil) {
+			continue
+		}
+
+		if processCtx.Err() != nil {
+			break
+		}
+
+		if ehErr := (*Error)(nil); errors.As(err, &ehErr) && ehErr.Code == ErrorCodeOwnershipLost {
+			log.Writef(EventConsumer, "[%s] stopping processing, ownership was lost: %s", ep.client.PartitionID(), err)
+			ownershipLost = true
+			break
+		}
+
+		ep.setErr(err)
+		break
+	}
+
+	for _, lane := range lanes {
+		close(lane)
+	}
+
+	lanesWG.Wait()
+	close(stopCheckpointer)
+	<-checkpointerDone
+
+	// another Processor owns the partition now, so its checkpoint can't be overwritten.
+	if !ownershipLost {
+		if err := ep.checkpoint(context.WithoutCancel(ctx)); err != nil {
+			ep.setErr(err)
+		}
+	}
+
+	return ep.getErr()
+}
+
+func (ep *eventProcessor) processLane(ctx context.Context, lane <-chan *trackedEvent, stop context.CancelFunc) {
+	for te := range lane {
+		// once processing has stopped, the remaining events aren't processed, so they're
+		// received again when the partition is next processed.
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if err := ep.handler(ctx, te.event); err != nil {
+			// the context being cancelled isn't an error, it just means we're stopping.
+			if ctx.Err() == nil {
+				ep.setErr(err)
+			}
+
+			stop()
+			continue
+		}
+
+		if ep.tracker.complete(te) {
+			select {
+			case ep.due <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (ep *eventProcessor) runCheckpointer(ctx context.Context, interval time.Duration, stop <-chan struct{}, stopProcessing context.CancelFunc) {
+	var tick <-chan time.Time
+
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ep.due:
+		case <-tick:
+		}
+
+		if err := ep.checkpoint(ctx); err != nil {
+			if ctx.Err() == nil {
+				ep.setErr(err)
+			}
+
+			stopProcessing()
+			return
+		}
+	}
+}
+
+// checkpoint updates the checkpoint, if events have been processed since the last one.
+func (ep *eventProcessor) checkpoint(ctx context.Context) error {
+	event, count := ep.tracker.next()
+
+	if event == nil {
+		return nil
+	}
+
+	if err := ep.client.UpdateCheckpoint(ctx, event, nil); err != nil {
+		return err
+	}
+
+	ep.tracker.checkpointed(count)
+	return nil
+}
+
+func (ep *eventProcessor) setErr(err error) {
+	ep.errMu.Lock()
+	defer ep.errMu.Unlock()
+
+	if ep.err == nil {
+		ep.err = err
+	}
+}
+
+func (ep *eventProcessor) getErr() error {
+	ep.errMu.Lock()
+	defer ep.errMu.Unlock()
+	return ep.err
+}
+
+type trackedEvent struct {
+	event *ReceivedEventData
+	done  bool
+}
+
+// checkpointTracker tracks the events that are being processed, in the order they were received,
+// to find the latest event that can be checkpointed: the last event for which it, and every event
+// received before it, have been processed.
+type checkpointTracker struct {
+	mu sync.Mutex
+
+	// pending are the events that haven't been processed, or were processed after an event that
+	// was received before them and hasn't been processed yet.
+	pending []*trackedEvent
+
+	// processed is the latest event that can be checkpointed, and processedCount is the number of
+	// events up to, and including, it.
+	processed      *ReceivedEventData
+	processedCount int
+
+	checkpointEvery   int
+	checkpointedCount int
+}
+
+func (ct *checkpointTracker) add(events []*ReceivedEventData) []*trackedEvent {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	tracked := make([]*trackedEvent, 0, len(events))
+
+	for _, e := range events {
+		te := &trackedEvent{event: e}
+		ct.pending = append(ct.pending, te)
+		tracked = append(tracked, te)
+	}
+
+	return tracked
+}
+
+// complete marks an event as processed. It returns true if enough events have been processed to
+// update the checkpoint.
+func (ct *checkpointTracker) complete(te *trackedEvent) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	te.done = true
+
+	i := 0
+
+	for ; i < len(ct.pending) && ct.pending[i].done; i++ {
+		ct.processed = ct.pending[i].event
+		ct.processedCount++
+	}
+
+	if i > 0 {
+		ct.pending = append(ct.pending[:0:0], ct.pending[i:]...)
+	}
+
+	return ct.checkpointEvery > 0 && ct.processedCount-ct.checkpointedCount >= ct.checkpointEvery
+}
+
+// next returns the event to checkpoint, and the count to pass to checkpointed once the checkpoint
+// is updated. The event is nil if no events have been processed since the last checkpoint.
+func (ct *checkpointTracker) next() (*ReceivedEventData, int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if ct.processedCount == ct.checkpointedCount {
+		return nil, 0
+	}
+
+	return ct.processed, ct.processedCount
+}
+
+// checkpointed records that the checkpoint was updated. Events that were processed while the
+// checkpoint was being updated count towards the next one.
+func (ct *checkpointTracker) checkpointed(count int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.checkpointedCount = count
+}
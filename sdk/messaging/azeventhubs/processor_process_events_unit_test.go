@@ -0,0 +1,269 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+package azeventhubs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/exported"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessEvents_Serial(t *testing.T) {
+	client := newFakeEventProcessorClient(newTestEvents(10, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var processed []int64
+
+	err := processEvents(ctx, client, func(ctx context.Context, event *ReceivedEventData) error {
+		processed = append(processed, event.SequenceNumber)
+
+		if event.SequenceNumber == 6 {
+			// wait for the checkpoint that's due after the first three events.
+			for i := 0; i < 500 && len(client.checkpointSequenceNumbers()) == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		if len(processed) == 10 {
+			cancel()
+		}
+
+		return nil
+	}, &ProcessEventsOptions{CheckpointEveryEvents: 3, ReceiveCount: 4})
+	require.NoError(t, err)
+
+	require.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, processed)
+
+	checkpoints := client.checkpointSequenceNumbers()
+	require.IsIncreasing(t, checkpoints)
+	require.Equal(t, int64(9), checkpoints[len(checkpoints)-1], "the final checkpoint is the last event")
+	require.Greater(t, len(checkpoints), 1, "checkpoints are updated while processing")
+}
+
+func TestProcessEvents_CheckpointInterval(t *testing.T) {
+	client := newFakeEventProcessorClient(newTestEvents(3, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- processEvents(ctx, client, func(ctx context.Context, event *ReceivedEventData) error {
+			return nil
+		}, &ProcessEventsOptions{CheckpointInterval: 10 * time.Millisecond, ReceiveWaitTime: time.Millisecond})
+	}()
+
+	require.Eventually(t, func() bool {
+		checkpoints := client.checkpointSequenceNumbers()
+		return len(checkpoints) == 1 && checkpoints[0] == 2
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// nothing's been processed since, so the checkpoint isn't updated again.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	require.Equal(t, []int64{2}, client.checkpointSequenceNumbers())
+}
+
+func TestProcessEvents_PerKeyOrdering(t *testing.T) {
+	keys := []string{"a", "b", "c", "d"}
+	client := newFakeEventProcessorClient(newTestEvents(200, func(i int) *string { return &keys[i%len(keys)] }))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	processedByKey := map[string][]int64{}
+	var inFlight, maxInFlight, total int32
+
+	err := processEvents(ctx, client, func(ctx context.Context, event *ReceivedEventData) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		mu.Lock()
+		if n > maxInFlight {
+			maxInFlight = n
+		}
+		processedByKey[*event.PartitionKey] = append(processedByKey[*event.PartitionKey], event.SequenceNumber)
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		if atomic.AddInt32(&total, 1) == 200 {
+			cancel()
+		}
+
+		return nil
+	}, &ProcessEventsOptions{Concurrency: 8, CheckpointEveryEvents: 50})
+	require.NoError(t, err)
+
+	for _, key := range keys {
+		require.Len(t, processedByKey[key], 50)
+		require.IsIncreasing(t, processedByKey[key], "events with the same key are processed in order")
+	}
+
+	require.Greater(t, maxInFlight, int32(1), "events with different keys are processed concurrently")
+
+	checkpoints := client.checkpointSequenceNumbers()
+	require.IsIncreasing(t, checkpoints)
+	require.Equal(t, int64(199), checkpoints[len(checkpoints)-1])
+}
+
+func TestProcessEvents_HandlerErrorCheckpointsContiguousPrefix(t *testing.T) {
+	// events without a key are spread across all the lanes.
+	client := newFakeEventProcessorClient(newTestEvents(6, nil))
+	handlerErr := errors.New("handler failed")
+
+	others := sync.WaitGroup{}
+	others.Add(5)
+
+	err := processEvents(context.Background(), client, func(ctx context.Context, event *ReceivedEventData) error {
+		if event.SequenceNumber == 3 {
+			// the events after this one finish first, but they can't be checkpointed, since
+			// this one wasn't processed.
+			others.Wait()
+			return handlerErr
+		}
+
+		others.Done()
+		return nil
+	}, &ProcessEventsOptions{Concurrency: 6, CheckpointEveryEvents: 1})
+	require.ErrorIs(t, err, handlerErr)
+
+	checkpoints := client.checkpointSequenceNumbers()
+	require.NotEmpty(t, checkpoints)
+	require.Equal(t, int64(2), checkpoints[len(checkpoints)-1])
+}
+
+func TestProcessEvents_OwnershipLost(t *testing.T) {
+	client := newFakeEventProcessorClient(newTestEvents(2, nil))
+	client.finalErr = exported.NewError(exported.ErrorCodeOwnershipLost, errors.New("link stolen"))
+
+	err := processEvents(context.Background(), client, func(ctx context.Context, event *ReceivedEventData) error {
+		return nil
+	}, &ProcessEventsOptions{CheckpointInterval: time.Hour})
+	require.NoError(t, err)
+
+	// another processor owns the partition, so the checkpoint isn't updated.
+	require.Empty(t, client.checkpointSequenceNumbers())
+}
+
+func TestProcessEvents_ReceiveError(t *testing.T) {
+	client := newFakeEventProcessorClient(newTestEvents(2, nil))
+	client.finalErr = errors.New("receive failed")
+
+	err := processEvents(context.Background(), client, func(ctx context.Context, event *ReceivedEventData) error {
+		return nil
+	}, &ProcessEventsOptions{CheckpointInterval: time.Hour})
+	require.EqualError(t, err, "receive failed")
+	require.Equal(t, []int64{1}, client.checkpointSequenceNumbers())
+}
+
+func TestCheckpointTracker(t *testing.T) {
+	ct := &checkpointTracker{checkpointEvery: 2}
+	tracked := ct.add(newTestEvents(4, nil))
+
+	event, _ := ct.next()
+	require.Nil(t, event)
+
+	require.False(t, ct.complete(tracked[1]))
+	event, _ = ct.next()
+	require.Nil(t, event, "event 0 hasn't been processed")
+
+	require.True(t, ct.complete(tracked[0]))
+	event, count := ct.next()
+	require.Equal(t, int64(1), event.SequenceNumber)
+
+	// events 2 and 3 are processed while the checkpoint is being updated.
+	require.True(t, ct.complete(tracked[3]), "the checkpoint is still due")
+	require.True(t, ct.complete(tracked[2]))
+	ct.checkpointed(count)
+
+	event, count = ct.next()
+	require.Equal(t, int64(3), event.SequenceNumber)
+	ct.checkpointed(count)
+
+	event, _ = ct.next()
+	require.Nil(t, event)
+	require.Empty(t, ct.pending)
+}
+
+func newTestEvents(count int, partitionKey func(i int) *string) []*ReceivedEventData {
+	var events []*ReceivedEventData
+
+	for i := 0; i < count; i++ {
+		e := &ReceivedEventData{SequenceNumber: int64(i), Offset: fmt.Sprintf("%d", i*100)}
+
+		if partitionKey != nil {
+			e.PartitionKey = partitionKey(i)
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
+
+// fakeEventProcessorClient returns its events, then finalErr or, if that's nil, waits for
+// the context to be cancelled.
+type fakeEventProcessorClient struct {
+	mu          sync.Mutex
+	events      []*ReceivedEventData
+	finalErr    error
+	checkpoints []*ReceivedEventData
+}
+
+func newFakeEventProcessorClient(events []*ReceivedEventData) *fakeEventProcessorClient {
+	return &fakeEventProcessorClient{events: events}
+}
+
+func (c *fakeEventProcessorClient) ReceiveEvents(ctx context.Context, count int, options *ReceiveEventsOptions) ([]*ReceivedEventData, error) {
+	c.mu.Lock()
+
+	if len(c.events) > 0 {
+		n := min(count, len(c.events))
+		events := c.events[:n]
+		c.events = c.events[n:]
+		c.mu.Unlock()
+		return events, nil
+	}
+
+	finalErr := c.finalErr
+	c.mu.Unlock()
+
+	if finalErr != nil {
+		return nil, finalErr
+	}
+
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *fakeEventProcessorClient) UpdateCheckpoint(ctx context.Context, latestEvent *ReceivedEventData, options *UpdateCheckpointOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoints = append(c.checkpoints, latestEvent)
+	return nil
+}
+
+func (c *fakeEventProcessorClient) PartitionID() string {
+	return "0"
+}
+
+func (c *fakeEventProcessorClient) checkpointSequenceNumbers() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var seqs []int64
+
+	for _, e := range c.checkpoints {
+		seqs = append(seqs, e.SequenceNumber)
+	}
+
+	return seqs
+}
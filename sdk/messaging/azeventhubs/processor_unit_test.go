@@ -364,9 +364,9 @@ func TestUnit_Processor_getStartPosition_checkpointStore(t *testing.T) {
 
 	for _, td := range checkpointTests {
 		cps := newCheckpointStoreForTest()
-		td.Checkpoint.ConsumerGroup = "cg"
-		td.Checkpoint.EventHubName = "eh"
-		td.Checkpoint.FullyQualifiedNamespace = "ns"
+		td.Checkpoint.ConsumerGroup = "consumer-group"
+		td.Checkpoint.EventHubName = "event-hub"
+		td.Checkpoint.FullyQualifiedNamespace = "fqdn"
 		td.Checkpoint.PartitionID = "a"
 
 		err := cps.SetCheckpoint(context.Background(), td.Checkpoint, nil)
@@ -392,7 +392,7 @@ func TestUnit_Processor_getStartPosition_checkpointStore(t *testing.T) {
 		cps := newCheckpointStoreForTest()
 
 		err := cps.SetCheckpoint(context.Background(), Checkpoint{
-			ConsumerGroup: "cg", EventHubName: "eh", FullyQualifiedNamespace: "ns", PartitionID: "a",
+			ConsumerGroup: "consumer-group", EventHubName: "event-hub", FullyQualifiedNamespace: "fqdn", PartitionID: "a",
 			// no offset or sequence number set
 		}, nil)
 		require.NoError(t, err)
@@ -492,7 +492,7 @@ func TestUnit_Processor_addPartitionClient(t *testing.T) {
 	cps := newCheckpointStoreForTest()
 
 	err := cps.SetCheckpoint(context.Background(), Checkpoint{
-		ConsumerGroup: "cg", EventHubName: "eh", FullyQualifiedNamespace: "fqdn", PartitionID: "0",
+		ConsumerGroup: "consumer-group", EventHubName: "event-hub", FullyQualifiedNamespace: "fqdn", PartitionID: "0",
 		Offset: to.Ptr("100"), // ie, a legacy offset
 	}, nil)
 	require.NoError(t, err)
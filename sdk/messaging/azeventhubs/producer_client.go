@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -34,10 +35,21 @@ type ProducerClientOptions struct {
 	// A custom endpoint address that can be used when establishing the connection to the service.
 	CustomEndpoint string
 
+	// EnableIdempotentPublishing publishes events so Event Hubs can detect, and discard, events that
+	// were already published. When it's enabled, batches must be created with a PartitionID, and a batch
+	// whose send failed can be sent again without its events being duplicated.
+	//
+	// Use [ProducerClient.GetPartitionPublishingProperties] to get the producer state for a partition.
+	EnableIdempotentPublishing bool
+
 	// NewWebSocketConn is a function that can create a net.Conn for use with websockets.
 	// For an example, see ExampleNewClient_usingWebsockets() function in example_client_test.go.
 	NewWebSocketConn func(ctx context.Context, params WebSocketConnParams) (net.Conn, error)
 
+	// PartitionOptions configures idempotent publishing for individual partitions, by partition ID.
+	// They're only used when EnableIdempotentPublishing is true.
+	PartitionOptions map[string]PartitionPublishingOptions
+
 	// RetryOptions controls how often operations are retried from this client and any
 	// Receivers and Senders created from this client.
 	RetryOptions RetryOptions
@@ -52,6 +64,12 @@ type ProducerClient struct {
 	links        *internal.Links[amqpwrap.AMQPSenderCloser]
 	namespace    internal.NamespaceForProducerOrConsumer
 	retryOptions RetryOptions
+
+	idempotent       bool
+	partitionOptions map[string]PartitionPublishingOptions
+
+	publishingStatesMu sync.Mutex
+	publishingStates   map[string]*partitionPublishingState
 }
 
 // anyPartitionID is what we target if we want to send a message and let Event Hubs pick a partition
@@ -129,6 +147,8 @@ type EventDataBatchOptions struct {
 // NOTE: if options is nil or empty, Event Hubs will choose an arbitrary partition for any
 // events in this [EventDataBatch].
 //
+// If idempotent publishing is enabled, the options must have a PartitionID.
+//
 // If the operation fails it can return an azeventhubs.Error type if the failure is actionable.
 func (pc *ProducerClient) NewEventDataBatch(ctx context.Context, options *EventDataBatchOptions) (*EventDataBatch, error) {
 	var batch *EventDataBatch
@@ -139,6 +159,10 @@ func (pc *ProducerClient) NewEventDataBatch(ctx context.Context, options *EventD
 		partitionID = *options.PartitionID
 	}
 
+	if pc.idempotent && (partitionID == anyPartitionID || options.PartitionKey != nil) {
+		return nil, errors.New("a PartitionID must be set, and PartitionKey can't be set, when idempotent publishing is enabled")
+	}
+
 	err := pc.links.Retry(ctx, exported.EventProducer, "NewEventDataBatch", partitionID, pc.retryOptions, func(ctx context.Context, lwid internal.LinkWithID[amqpwrap.AMQPSenderCloser]) error {
 		tmpBatch, err := newEventDataBatch(lwid.Link(), options)
 
@@ -146,6 +170,7 @@ func (pc *ProducerClient) NewEventDataBatch(ctx context.Context, options *EventD
 			return err
 		}
 
+		tmpBatch.idempotent = pc.idempotent
 		batch = tmpBatch
 		return nil
 	})
@@ -163,7 +188,14 @@ type SendEventDataBatchOptions struct {
 }
 
 // SendEventDataBatch sends an event data batch to Event Hubs.
+//
+// If idempotent publishing is enabled, a batch can be sent again if the send fails. The service discards
+// the events if they were published by the failed send.
 func (pc *ProducerClient) SendEventDataBatch(ctx context.Context, batch *EventDataBatch, options *SendEventDataBatchOptions) error {
+	if pc.idempotent || batch.idempotent {
+		return pc.sendEventDataBatchIdempotent(ctx, batch)
+	}
+
 	amqpMessage, err := batch.toAMQPMessage()
 
 	if err != nil {
@@ -210,18 +242,36 @@ func (pc *ProducerClient) getEntityPath(partitionID string) string {
 }
 
 func (pc *ProducerClient) newEventHubProducerLink(ctx context.Context, session amqpwrap.AMQPSession, entityPath string, partitionID string) (amqpwrap.AMQPSenderCloser, error) {
-	sender, err := session.NewSender(ctx, entityPath, partitionID, &amqp.SenderOptions{
+	senderOptions := &amqp.SenderOptions{
 		SettlementMode:              to.Ptr(amqp.SenderSettleModeMixed),
 		RequestedReceiverSettleMode: to.Ptr(amqp.ReceiverSettleModeFirst),
 		DesiredCapabilities: []string{
 			internal.CapabilityGeoDRReplication,
 		},
-	})
+	}
+
+	var state *partitionPublishingState
+
+	if pc.idempotent && partitionID != anyPartitionID {
+		// the producer state is negotiated when the link is opened.
+		state = pc.getPublishingState(partitionID)
+		senderOptions.DesiredCapabilities = append(senderOptions.DesiredCapabilities, internal.CapabilityIdempotentProducer)
+		senderOptions.Properties = state.linkProperties()
+	}
+
+	sender, err := session.NewSender(ctx, entityPath, partitionID, senderOptions)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if state != nil {
+		if err := state.linkOpened(sender.Properties()); err != nil {
+			_ = sender.Close(ctx)
+			return nil, err
+		}
+	}
+
 	return sender, nil
 }
 
@@ -254,6 +304,8 @@ func newProducerClientImpl(creds producerClientCreds, options *ProducerClientOpt
 
 	if options != nil {
 		client.retryOptions = options.RetryOptions
+		client.idempotent = options.EnableIdempotentPublishing
+		client.partitionOptions = options.PartitionOptions
 
 		if options.TLSConfig != nil {
 			nsOptions = append(nsOptions, internal.NamespaceWithTLSConfig(options.TLSConfig))
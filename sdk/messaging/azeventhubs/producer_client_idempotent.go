@@ -0,0 +1,323 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azeventhubs
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/amqpwrap"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal/exported"
+)
+
+// PartitionPublishingOptions configures idempotent publishing for a partition. It's used in
+// [ProducerClientOptions.PartitionOptions].
+//
+// The options are only needed to continue publishing as an existing producer group, ex: after
+// restarting your application. Use [ProducerClient.GetPartitionPublishingProperties] to get the
+// values to continue from.
+type PartitionPublishingOptions struct {
+	// OwnerLevel is the owner level (epoch) of the producer. A producer with a higher owner level
+	// takes over the producer group, and producers with a lower owner level can no longer publish.
+	// By default, the service assigns the owner level.
+	OwnerLevel *int16
+
+	// ProducerGroupID is the producer group to publish as. By default, the service assigns a new
+	// producer group.
+	ProducerGroupID *int64
+
+	// StartingSequenceNumber is the last sequence number that was published by the producer group.
+	// The first event that's published has the next sequence number.
+	// By default, the service uses the last sequence number it has for the producer group.
+	StartingSequenceNumber *int32
+}
+
+// PartitionPublishingProperties is the idempotent publishing state of a partition, returned by
+// [ProducerClient.GetPartitionPublishingProperties].
+type PartitionPublishingProperties struct {
+	// IsIdempotentPublishingEnabled is true if idempotent publishing is enabled for the ProducerClient.
+	// The other fields are nil if it's false.
+	IsIdempotentPublishingEnabled bool
+
+	// LastPublishedSequenceNumber is the sequence number of the last event that was published to the
+	// partition by the producer group.
+	LastPublishedSequenceNumber *int32
+
+	// OwnerLevel is the owner level (epoch) of the producer.
+	OwnerLevel *int16
+
+	// ProducerGroupID is the producer group the ProducerClient publishes as.
+	ProducerGroupID *int64
+}
+
+// GetPartitionPublishingPropertiesOptions contains optional parameters for the [ProducerClient.GetPartitionPublishingProperties] function.
+type GetPartitionPublishingPropertiesOptions struct {
+	// For future expansion
+}
+
+// GetPartitionPublishingProperties gets the idempotent publishing state of a partition. The state is
+// negotiated with Event Hubs when the partition is first used, so this function opens a link to the
+// partition, if there isn't one already.
+//
+// If idempotent publishing isn't enabled, the returned properties only have IsIdempotentPublishingEnabled,
+// set to false.
+func (pc *ProducerClient) GetPartitionPublishingProperties(ctx context.Context, partitionID string, options *GetPartitionPublishingPropertiesOptions) (PartitionPublishingProperties, error) {
+	if !pc.idempotent {
+		return PartitionPublishingProperties{}, nil
+	}
+
+	if partitionID == anyPartitionID {
+		return PartitionPublishingProperties{}, errors.New("partitionID must be set")
+	}
+
+	state := pc.getPublishingState(partitionID)
+
+	err := pc.links.Retry(ctx, exported.EventProducer, "GetPartitionPublishingProperties", partitionID, pc.retryOptions, func(ctx context.Context, lwid internal.LinkWithID[amqpwrap.AMQPSenderCloser]) error {
+		_, err := pc.getPublishingLink(ctx, state, partitionID, lwid)
+		return err
+	})
+
+	if err != nil {
+		return PartitionPublishingProperties{}, internal.TransformError(err)
+	}
+
+	return state.properties(), nil
+}
+
+func (pc *ProducerClient) sendEventDataBatchIdempotent(ctx context.Context, batch *EventDataBatch) error {
+	if !pc.idempotent || !batch.idempotent {
+		return errors.New("batches must be created by a ProducerClient with idempotent publishing enabled, and sent with the same ProducerClient")
+	}
+
+	if batch.NumEvents() == 0 {
+		return internal.NewErrNonRetriable("batch is nil or empty")
+	}
+
+	partID := *batch.partitionID
+	state := pc.getPublishingState(partID)
+
+	// each batch's sequence numbers follow the previous batch's, so batches are sent to a partition
+	// one at a time.
+	state.sendMu.Lock()
+	defer state.sendMu.Unlock()
+
+	err := pc.links.Retry(ctx, exported.EventProducer, "SendEventDataBatch", partID, pc.retryOptions, func(ctx context.Context, lwid internal.LinkWithID[amqpwrap.AMQPSenderCloser]) error {
+		link, err := pc.getPublishingLink(ctx, state, partID, lwid)
+
+		if err != nil {
+			return err
+		}
+
+		if err := state.assign(batch); err != nil {
+			return err
+		}
+
+		amqpMessage, err := batch.toAMQPMessage()
+
+		if err != nil {
+			return err
+		}
+
+		azlog.Writef(EventProducer, "[%s] Sending message with ID %v to partition %q, starting at sequence number %d", lwid.String(), amqpMessage.Properties.MessageID, partID, *batch.StartingPublishedSequenceNumber())
+
+		if err := link.Send(ctx, amqpMessage, nil); err != nil {
+			state.sendFailed(batch)
+			return err
+		}
+
+		return nil
+	})
+
+	return internal.TransformError(err)
+}
+
+// getPublishingLink returns the link to publish with. The producer state is only read from Event Hubs
+// when a link is opened so, if a send failed since the link was opened, the link is replaced.
+func (pc *ProducerClient) getPublishingLink(ctx context.Context, state *partitionPublishingState, partitionID string, lwid internal.LinkWithID[amqpwrap.AMQPSenderCloser]) (amqpwrap.AMQPSenderCloser, error) {
+	if !state.isStale() {
+		return lwid.Link(), nil
+	}
+
+	if err := pc.links.CloseLink(ctx, partitionID, lwid.Link().LinkName()); err != nil {
+		azlog.Writef(EventProducer, "[%s] Failed closing link to refresh the producer state: %s", lwid.String(), err)
+	}
+
+	newLWID, err := pc.links.GetLink(ctx, partitionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newLWID.Link(), nil
+}
+
+func (pc *ProducerClient) getPublishingState(partitionID string) *partitionPublishingState {
+	pc.publishingStatesMu.Lock()
+	defer pc.publishingStatesMu.Unlock()
+
+	if pc.publishingStates == nil {
+		pc.publishingStates = map[string]*partitionPublishingState{}
+	}
+
+	state := pc.publishingStates[partitionID]
+
+	if state == nil {
+		options := pc.partitionOptions[partitionID]
+
+		state = &partitionPublishingState{
+			producerGroupID:    options.ProducerGroupID,
+			ownerLevel:         options.OwnerLevel,
+			lastSequenceNumber: options.StartingSequenceNumber,
+		}
+
+		pc.publishingStates[partitionID] = state
+	}
+
+	return state
+}
+
+// partitionPublishingState is the idempotent producer state for a partition.
+type partitionPublishingState struct {
+	sendMu sync.Mutex
+
+	mu                 sync.Mutex
+	producerGroupID    *int64
+	ownerLevel         *int16
+	lastSequenceNumber *int32
+
+	// stale is true when a send failed, so the last sequence number isn't known. It's read from
+	// Event Hubs when the partition's link is next opened.
+	stale bool
+
+	// failed is the batch whose send failed. Event Hubs might have stored it, so its sequence numbers
+	// are only released once the last sequence number is known.
+	failed *EventDataBatch
+}
+
+// linkProperties are the properties for the partition's link, which request the producer state.
+func (s *partitionPublishingState) linkProperties() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	props := map[string]any{}
+
+	if s.producerGroupID != nil {
+		props[internal.ProducerIDProperty] = *s.producerGroupID
+	}
+
+	if s.ownerLevel != nil {
+		props[internal.ProducerEpochProperty] = *s.ownerLevel
+	}
+
+	if s.lastSequenceNumber != nil && !s.stale {
+		props[internal.ProducerSequenceNumberProperty] = *s.lastSequenceNumber
+	}
+
+	return props
+}
+
+// linkOpened updates the producer state with the state Event Hubs returned when the partition's
+// link was opened.
+func (s *partitionPublishingState) linkOpened(props map[string]any) error {
+	producerGroupID, ok1 := props[internal.ProducerIDProperty].(int64)
+	ownerLevel, ok2 := props[internal.ProducerEpochProperty].(int16)
+	lastSequenceNumber, ok3 := props[internal.ProducerSequenceNumberProperty].(int32)
+
+	if !ok1 || !ok2 || !ok3 {
+		return internal.NewErrNonRetriable("the producer state wasn't returned when the link was opened. Idempotent publishing may not be supported for this Event Hub")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.producerGroupID = &producerGroupID
+	s.ownerLevel = &ownerLevel
+	s.lastSequenceNumber = &lastSequenceNumber
+	s.stale = false
+
+	if s.failed != nil {
+		s.failed.mu.Lock()
+
+		// if the failed batch was stored, sending it again is deduplicated. Otherwise, it gets new
+		// sequence numbers when it's sent again.
+		if p := s.failed.publishing; p != nil && addSequenceNumber(p.startingSequenceNumber, len(s.failed.marshaledMessages)-1) != lastSequenceNumber {
+			s.failed.publishing = nil
+		}
+
+		s.failed.mu.Unlock()
+		s.failed = nil
+	}
+
+	return nil
+}
+
+// assign gives the batch the next sequence numbers, unless it was assigned sequence numbers when it
+// was sent before.
+func (s *partitionPublishingState) assign(batch *EventDataBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	if batch.publishing != nil {
+		return nil
+	}
+
+	if s.producerGroupID == nil || s.ownerLevel == nil || s.lastSequenceNumber == nil {
+		return internal.NewErrNonRetriable("the producer state for the partition isn't known")
+	}
+
+	batch.publishing = &batchPublishingState{
+		producerGroupID:        *s.producerGroupID,
+		ownerLevel:             *s.ownerLevel,
+		startingSequenceNumber: addSequenceNumber(*s.lastSequenceNumber, 1),
+	}
+
+	last := addSequenceNumber(*s.lastSequenceNumber, len(batch.marshaledMessages))
+	s.lastSequenceNumber = &last
+	return nil
+}
+
+func (s *partitionPublishingState) sendFailed(batch *EventDataBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stale = true
+	s.failed = batch
+}
+
+func (s *partitionPublishingState) isStale() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stale
+}
+
+func (s *partitionPublishingState) properties() PartitionPublishingProperties {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	props := PartitionPublishingProperties{IsIdempotentPublishingEnabled: true}
+
+	if s.producerGroupID != nil {
+		v := *s.producerGroupID
+		props.ProducerGroupID = &v
+	}
+
+	if s.ownerLevel != nil {
+		v := *s.ownerLevel
+		props.OwnerLevel = &v
+	}
+
+	if s.lastSequenceNumber != nil {
+		v := *s.lastSequenceNumber
+		props.LastPublishedSequenceNumber = &v
+	}
+
+	return props
+}
@@ -5,6 +5,8 @@ package azeventhubs
 import (
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/internal"
 	"github.com/stretchr/testify/require"
 )
 
@@ -43,3 +45,76 @@ func TestUnitNewProducerClient(t *testing.T) {
 		require.Equal(t, "eventHubName", client.eventHub)
 	})
 }
+
+func TestUnitPartitionPublishingState(t *testing.T) {
+	newBatch := func(t *testing.T) *EventDataBatch {
+		batch, err := newEventDataBatch(eventBatchLinkForTest{maxMessageSize: 10000}, &EventDataBatchOptions{PartitionID: to.Ptr("0")})
+		require.NoError(t, err)
+		batch.idempotent = true
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, batch.AddEventData(&EventData{}, nil))
+		}
+
+		return batch
+	}
+
+	linkProps := func(lastSequenceNumber int32) map[string]any {
+		return map[string]any{
+			internal.ProducerIDProperty:             int64(5),
+			internal.ProducerEpochProperty:          int16(0),
+			internal.ProducerSequenceNumberProperty: lastSequenceNumber,
+		}
+	}
+
+	t.Run("service doesn't return the producer state", func(t *testing.T) {
+		state := &partitionPublishingState{}
+		require.Error(t, state.linkOpened(map[string]any{}))
+	})
+
+	t.Run("failed batch was stored", func(t *testing.T) {
+		state := &partitionPublishingState{}
+		require.NoError(t, state.linkOpened(linkProps(9)))
+		require.Equal(t, map[string]any{
+			internal.ProducerIDProperty:             int64(5),
+			internal.ProducerEpochProperty:          int16(0),
+			internal.ProducerSequenceNumberProperty: int32(9),
+		}, state.linkProperties())
+
+		batch := newBatch(t)
+		require.NoError(t, state.assign(batch))
+		require.Equal(t, int32(10), *batch.StartingPublishedSequenceNumber())
+
+		state.sendFailed(batch)
+		require.True(t, state.isStale())
+		require.NotContains(t, state.linkProperties(), internal.ProducerSequenceNumberProperty, "the service has the last sequence number")
+
+		require.NoError(t, state.linkOpened(linkProps(12)))
+		require.False(t, state.isStale())
+
+		// the batch keeps its sequence numbers, so sending it again is deduplicated.
+		require.NoError(t, state.assign(batch))
+		require.Equal(t, int32(10), *batch.StartingPublishedSequenceNumber())
+		require.Equal(t, int32(12), *state.properties().LastPublishedSequenceNumber)
+	})
+
+	t.Run("failed batch wasn't stored", func(t *testing.T) {
+		state := &partitionPublishingState{}
+		require.NoError(t, state.linkOpened(linkProps(9)))
+
+		batch := newBatch(t)
+		require.NoError(t, state.assign(batch))
+		state.sendFailed(batch)
+
+		require.NoError(t, state.linkOpened(linkProps(9)))
+		require.Nil(t, batch.StartingPublishedSequenceNumber())
+
+		// another batch gets the sequence numbers the failed batch had.
+		other := newBatch(t)
+		require.NoError(t, state.assign(other))
+		require.Equal(t, int32(10), *other.StartingPublishedSequenceNumber())
+
+		require.NoError(t, state.assign(batch))
+		require.Equal(t, int32(13), *batch.StartingPublishedSequenceNumber())
+	})
+}
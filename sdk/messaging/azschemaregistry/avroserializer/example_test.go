@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package avroserializer_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry/avroserializer"
+)
+
+type User struct {
+	Name string `avro:"name"`
+	Age  int    `avro:"age"`
+}
+
+const userSchema = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "example",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int", "default": 0}
+	]
+}`
+
+func ExampleSerializer_Serialize() {
+	// FullyQualifiedNamespace is the Event Hubs namespace, ex: <your-namespace>.servicebus.windows.net
+	fullyQualifiedNamespace := os.Getenv("SCHEMAREGISTRY_NAMESPACE")
+	groupName := os.Getenv("SCHEMAREGISTRY_GROUP")
+
+	if fullyQualifiedNamespace == "" {
+		return
+	}
+
+	tokenCredential, err := azidentity.NewDefaultAzureCredential(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	client, err := azschemaregistry.NewClient(fullyQualifiedNamespace, tokenCredential, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	serializer, err := avroserializer.NewSerializer(client, groupName, &avroserializer.SerializerOptions{
+		// register the schema the first time it's used, if it isn't already registered.
+		AutoRegisterSchemas: true,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	content, err := serializer.Serialize(context.TODO(), User{Name: "Ada", Age: 36}, userSchema, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Use content.Body and content.ContentType as the Body and ContentType of an azeventhubs.EventData
+	// or an azservicebus.Message.
+	fmt.Printf("Event with content type %s is ready to send\n", *content.ContentType)
+}
+
+func ExampleSerializer_Deserialize() {
+	var serializer *avroserializer.Serializer = nil // see ExampleSerializer_Serialize for an example of creating a Serializer
+	// the Body and ContentType of an azeventhubs.ReceivedEventData or an azservicebus.ReceivedMessage
+	var received *avroserializer.MessageContent = nil
+
+	if serializer == nil || received == nil {
+		return
+	}
+
+	var user User
+
+	err := serializer.Deserialize(context.TODO(), *received, &user, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Received user %s\n", user.Name)
+
+	// Or, to read the values without a struct:
+	var values map[string]any
+
+	err = serializer.Deserialize(context.TODO(), *received, &values, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Received user %s\n", values["name"])
+}
@@ -0,0 +1,426 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package avroserializer serializes and deserializes Apache Avro payloads, using schemas stored in Azure
+// Schema Registry.
+//
+// Serialized payloads contain only the Avro binary encoding of the value. The schema's ID is stored in the
+// content type, as avro/binary+<schema ID>, so a [MessageContent] maps directly onto the Body and ContentType
+// fields of azeventhubs.EventData and azservicebus.Message.
+package avroserializer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry"
+	"github.com/hamba/avro/v2"
+)
+
+const contentTypePrefix = "avro/binary+"
+
+// MessageContent is a serialized payload, and its content type.
+//
+// Use Body and ContentType to fill in the fields with the same names in azeventhubs.EventData or
+// azservicebus.Message, and to deserialize received events and messages.
+type MessageContent struct {
+	// Body is the Avro binary encoding of the value.
+	Body []byte
+
+	// ContentType is avro/binary+<schema ID>.
+	ContentType *string
+}
+
+// Compatibility controls how a new schema has to relate to the latest registered version
+// of a schema with the same name, before the Serializer registers it.
+type Compatibility string
+
+const (
+	// CompatibilityBackward - data written with the latest registered version can be read using the new schema.
+	// This matches the default compatibility for schema groups in Schema Registry.
+	CompatibilityBackward Compatibility = "Backward"
+	// CompatibilityForward - data written with the new schema can be read using the latest registered version.
+	CompatibilityForward Compatibility = "Forward"
+	// CompatibilityFull - both Backward and Forward.
+	CompatibilityFull Compatibility = "Full"
+	// CompatibilityNone - new schemas aren't checked.
+	CompatibilityNone Compatibility = "None"
+)
+
+// PossibleCompatibilityValues returns the possible values for the Compatibility const type.
+func PossibleCompatibilityValues() []Compatibility {
+	return []Compatibility{
+		CompatibilityBackward,
+		CompatibilityForward,
+		CompatibilityFull,
+		CompatibilityNone,
+	}
+}
+
+// SerializerOptions contains optional parameters for [NewSerializer].
+type SerializerOptions struct {
+	// AutoRegisterSchemas registers schemas that aren't in the schema group the first time they're used
+	// with [Serializer.Serialize]. If false, serializing with an unregistered schema fails.
+	AutoRegisterSchemas bool
+
+	// Compatibility is checked before a schema is registered, against the latest registered
+	// version of the schema. If the schema isn't compatible [Serializer.Serialize] fails, and the
+	// schema isn't registered.
+	//
+	// The default is CompatibilityBackward.
+	Compatibility Compatibility
+}
+
+// SerializeOptions contains optional parameters for [Serializer.Serialize].
+type SerializeOptions struct {
+	// For future expansion
+}
+
+// DeserializeOptions contains optional parameters for [Serializer.Deserialize].
+type DeserializeOptions struct {
+	// ReaderSchema is the schema to read the data with. It has to be compatible with the schema the
+	// data was written with, using Avro's schema resolution rules.
+	//
+	// If nil, the data is read using the schema it was written with.
+	ReaderSchema *string
+}
+
+// Serializer serializes values to Avro using schemas from Azure Schema Registry.
+// Don't use this type directly, use [NewSerializer] instead.
+//
+// A Serializer is safe for concurrent use.
+type Serializer struct {
+	client        schemaRegistryClient
+	groupName     string
+	autoRegister  bool
+	compatibility Compatibility
+	schemaCompat  *avro.SchemaCompatibility
+
+	mu sync.RWMutex
+
+	// writerSchemas are the schemas used with Serialize, by definition.
+	writerSchemas map[string]writerSchema
+
+	// schemasByID are the schemas that data being deserialized was written with.
+	schemasByID map[string]avro.Schema
+
+	// readerSchemas are the parsed DeserializeOptions.ReaderSchemas, by definition.
+	readerSchemas map[string]avro.Schema
+
+	// resolvedSchemas are the result of resolving a reader schema against a writer schema.
+	resolvedSchemas map[resolvedSchemaKey]avro.Schema
+}
+
+type writerSchema struct {
+	ID     string
+	Schema avro.Schema
+}
+
+type resolvedSchemaKey struct {
+	WriterID     string
+	ReaderSchema string
+}
+
+// schemaRegistryClient is the subset of [azschemaregistry.Client] that the Serializer uses.
+type schemaRegistryClient interface {
+	GetSchema(ctx context.Context, id string, options *azschemaregistry.GetSchemaOptions) (azschemaregistry.GetSchemaResponse, error)
+	GetSchemaByVersion(ctx context.Context, groupName string, name string, version int32, options *azschemaregistry.GetSchemaByVersionOptions) (azschemaregistry.GetSchemaByVersionResponse, error)
+	GetSchemaProperties(ctx context.Context, groupName string, name string, definition string, format azschemaregistry.SchemaFormat, options *azschemaregistry.GetSchemaPropertiesOptions) (azschemaregistry.GetSchemaPropertiesResponse, error)
+	NewListSchemaVersionsPager(groupName string, name string, options *azschemaregistry.ListSchemaVersionsOptions) *runtime.Pager[azschemaregistry.ListSchemaVersionsResponse]
+	RegisterSchema(ctx context.Context, groupName string, name string, definition string, format azschemaregistry.SchemaFormat, options *azschemaregistry.RegisterSchemaOptions) (azschemaregistry.RegisterSchemaResponse, error)
+}
+
+// NewSerializer creates a Serializer that uses schemas from groupName.
+//   - client - the Schema Registry client.
+//   - groupName - the schema group that schemas are registered in, and looked up from. Deserialize can
+//     read data written using schemas from any group.
+//   - options - optional settings for the Serializer. Pass nil to accept the defaults.
+func NewSerializer(client *azschemaregistry.Client, groupName string, options *SerializerOptions) (*Serializer, error) {
+	return newSerializer(client, groupName, options)
+}
+
+func newSerializer(client schemaRegistryClient, groupName string, options *SerializerOptions) (*Serializer, error) {
+	if options == nil {
+		options = &SerializerOptions{}
+	}
+
+	if groupName == "" {
+		return nil, errors.New("groupName cannot be empty")
+	}
+
+	compatibility := options.Compatibility
+
+	if compatibility == "" {
+		compatibility = CompatibilityBackward
+	}
+
+	switch compatibility {
+	case CompatibilityBackward, CompatibilityForward, CompatibilityFull, CompatibilityNone:
+	default:
+		return nil, fmt.Errorf("invalid Compatibility %q", compatibility)
+	}
+
+	return &Serializer{
+		client:          client,
+		groupName:       groupName,
+		autoRegister:    options.AutoRegisterSchemas,
+		compatibility:   compatibility,
+		schemaCompat:    avro.NewSchemaCompatibility(),
+		writerSchemas:   map[string]writerSchema{},
+		schemasByID:     map[string]avro.Schema{},
+		readerSchemas:   map[string]avro.Schema{},
+		resolvedSchemas: map[resolvedSchemaKey]avro.Schema{},
+	}, nil
+}
+
+// Serialize encodes value using schema, which must be a named Avro type (a record, enum or fixed).
+// The schema is registered, or looked up, in Schema Registry using its full name.
+//
+// value can be a struct, using `avro` field tags, or a map[string]any, in the same way as
+// the github.com/hamba/avro/v2 package.
+func (s *Serializer) Serialize(ctx context.Context, value any, schema string, options *SerializeOptions) (MessageContent, error) {
+	ws, err := s.getWriterSchema(ctx, schema)
+
+	if err != nil {
+		return MessageContent{}, err
+	}
+
+	body, err := avro.Marshal(ws.Schema, value)
+
+	if err != nil {
+		return MessageContent{}, err
+	}
+
+	contentType := contentTypePrefix + ws.ID
+
+	return MessageContent{
+		Body:        body,
+		ContentType: &contentType,
+	}, nil
+}
+
+// Deserialize decodes content into v, which must be a pointer. The schema the data was written with
+// is read from Schema Registry, using the schema ID in content's ContentType.
+//
+// v can be a pointer to a struct, using `avro` field tags, or a pointer to a map[string]any or any, for generic values.
+func (s *Serializer) Deserialize(ctx context.Context, content MessageContent, v any, options *DeserializeOptions) error {
+	if content.ContentType == nil {
+		return errors.New("content has no ContentType")
+	}
+
+	id, ok := strings.CutPrefix(*content.ContentType, contentTypePrefix)
+
+	if !ok || id == "" {
+		return fmt.Errorf("content type %q is not %s<schema ID>", *content.ContentType, contentTypePrefix)
+	}
+
+	schema, err := s.getSchemaByID(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if options != nil && options.ReaderSchema != nil {
+		schema, err = s.getResolvedSchema(id, schema, *options.ReaderSchema)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return avro.Unmarshal(schema, content.Body, v)
+}
+
+func (s *Serializer) getWriterSchema(ctx context.Context, definition string) (writerSchema, error) {
+	s.mu.RLock()
+	ws, ok := s.writerSchemas[definition]
+	s.mu.RUnlock()
+
+	if ok {
+		return ws, nil
+	}
+
+	parsed, err := parseSchema(definition)
+
+	if err != nil {
+		return writerSchema{}, err
+	}
+
+	named, ok := parsed.(avro.NamedSchema)
+
+	if !ok {
+		return writerSchema{}, fmt.Errorf("schema must be a named type (record, enum or fixed), not %s", parsed.Type())
+	}
+
+	name := named.FullName()
+
+	props, err := s.client.GetSchemaProperties(ctx, s.groupName, name, definition, azschemaregistry.SchemaFormatAvro, nil)
+
+	if isNotFound(err) {
+		if !s.autoRegister {
+			return writerSchema{}, fmt.Errorf("schema %s with this definition isn't registered in schema group %s, and AutoRegisterSchemas is false: %w", name, s.groupName, err)
+		}
+
+		if err := s.checkCompatibility(ctx, name, parsed); err != nil {
+			return writerSchema{}, err
+		}
+
+		var regResp azschemaregistry.RegisterSchemaResponse
+		regResp, err = s.client.RegisterSchema(ctx, s.groupName, name, definition, azschemaregistry.SchemaFormatAvro, nil)
+		props = azschemaregistry.GetSchemaPropertiesResponse(regResp)
+	}
+
+	if err != nil {
+		return writerSchema{}, err
+	}
+
+	ws = writerSchema{ID: props.ID, Schema: parsed}
+
+	s.mu.Lock()
+	s.writerSchemas[definition] = ws
+	s.schemasByID[props.ID] = parsed
+	s.mu.Unlock()
+
+	return ws, nil
+}
+
+// checkCompatibility checks that newSchema is compatible with the latest registered version
+// of the schema called name.
+func (s *Serializer) checkCompatibility(ctx context.Context, name string, newSchema avro.Schema) error {
+	if s.compatibility == CompatibilityNone {
+		return nil
+	}
+
+	latestVersion := int32(0)
+	pager := s.client.NewListSchemaVersionsPager(s.groupName, name, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+
+		if isNotFound(err) {
+			// this is the first version of the schema
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, v := range page.Versions {
+			latestVersion = max(latestVersion, v)
+		}
+	}
+
+	if latestVersion == 0 {
+		return nil
+	}
+
+	latest, err := s.client.GetSchemaByVersion(ctx, s.groupName, name, latestVersion, nil)
+
+	if err != nil {
+		return err
+	}
+
+	latestSchema, err := parseSchema(latest.Definition)
+
+	if err != nil {
+		return err
+	}
+
+	if s.compatibility == CompatibilityBackward || s.compatibility == CompatibilityFull {
+		if err := s.schemaCompat.Compatible(newSchema, latestSchema); err != nil {
+			return fmt.Errorf("schema %s isn't backward compatible with version %d: %w", name, latestVersion, err)
+		}
+	}
+
+	if s.compatibility == CompatibilityForward || s.compatibility == CompatibilityFull {
+		if err := s.schemaCompat.Compatible(latestSchema, newSchema); err != nil {
+			return fmt.Errorf("schema %s isn't forward compatible with version %d: %w", name, latestVersion, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Serializer) getSchemaByID(ctx context.Context, id string) (avro.Schema, error) {
+	s.mu.RLock()
+	schema, ok := s.schemasByID[id]
+	s.mu.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	resp, err := s.client.GetSchema(ctx, id, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Properties.Format != azschemaregistry.SchemaFormatAvro {
+		return nil, fmt.Errorf("schema %s has format %q, not %q", id, resp.Properties.Format, azschemaregistry.SchemaFormatAvro)
+	}
+
+	schema, err = parseSchema(resp.Definition)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.schemasByID[id] = schema
+	s.mu.Unlock()
+
+	return schema, nil
+}
+
+func (s *Serializer) getResolvedSchema(writerID string, writer avro.Schema, readerDefinition string) (avro.Schema, error) {
+	key := resolvedSchemaKey{WriterID: writerID, ReaderSchema: readerDefinition}
+
+	s.mu.RLock()
+	resolved, ok := s.resolvedSchemas[key]
+	reader, readerOK := s.readerSchemas[readerDefinition]
+	s.mu.RUnlock()
+
+	if ok {
+		return resolved, nil
+	}
+
+	if !readerOK {
+		var err error
+
+		if reader, err = parseSchema(readerDefinition); err != nil {
+			return nil, err
+		}
+	}
+
+	resolved, err := s.schemaCompat.Resolve(reader, writer)
+
+	if err != nil {
+		return nil, fmt.Errorf("reader schema isn't compatible with schema %s: %w", writerID, err)
+	}
+
+	s.mu.Lock()
+	s.readerSchemas[readerDefinition] = reader
+	s.resolvedSchemas[key] = resolved
+	s.mu.Unlock()
+
+	return resolved, nil
+}
+
+// parseSchema parses definition, without using hamba/avro's global cache of named types, since
+// different versions of a schema share the same names.
+func parseSchema(definition string) (avro.Schema, error) {
+	return avro.ParseWithCache(definition, "", &avro.SchemaCache{})
+}
+
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
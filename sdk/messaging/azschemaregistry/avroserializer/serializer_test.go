@@ -0,0 +1,235 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package avroserializer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry/internal/fakeregistry"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userSchemaV1 = `{"type":"record","name":"User","namespace":"example","fields":[{"name":"name","type":"string"}]}`
+
+	// adds a field, with a default, so it's backward and forward compatible with v1
+	userSchemaV2 = `{"type":"record","name":"User","namespace":"example","fields":[{"name":"name","type":"string"},{"name":"age","type":"int","default":0}]}`
+
+	// adds a field without a default, so data written with v1 can't be read using it.
+	userSchemaNotBackward = `{"type":"record","name":"User","namespace":"example","fields":[{"name":"name","type":"string"},{"name":"email","type":"string"}]}`
+)
+
+type userV1 struct {
+	Name string `avro:"name"`
+}
+
+type userV2 struct {
+	Name string `avro:"name"`
+	Age  int    `avro:"age"`
+}
+
+func TestSerializer_RoundTrip(t *testing.T) {
+	client := newClientForTest(t, fakeregistry.New())
+
+	serializer, err := newSerializer(client, "group", &SerializerOptions{AutoRegisterSchemas: true})
+	require.NoError(t, err)
+
+	content, err := serializer.Serialize(context.Background(), userV2{Name: "Ada", Age: 36}, userSchemaV2, nil)
+	require.NoError(t, err)
+
+	props, err := client.GetSchemaProperties(context.Background(), "group", "example.User", userSchemaV2, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+	require.Equal(t, "avro/binary+"+props.ID, *content.ContentType)
+
+	// a different serializer, so the schema has to be looked up by ID.
+	deserializer, err := newSerializer(newClientForTest(t, fakeregistry.New()), "group", nil)
+	require.NoError(t, err)
+
+	t.Run("struct", func(t *testing.T) {
+		var user userV2
+		require.NoError(t, serializer.Deserialize(context.Background(), content, &user, nil))
+		require.Equal(t, userV2{Name: "Ada", Age: 36}, user)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		var user map[string]any
+		require.NoError(t, serializer.Deserialize(context.Background(), content, &user, nil))
+		require.Equal(t, map[string]any{"name": "Ada", "age": 36}, user)
+	})
+
+	t.Run("schema not found", func(t *testing.T) {
+		var user userV2
+		err := deserializer.Deserialize(context.Background(), content, &user, nil)
+		require.ErrorContains(t, err, "ItemNotFound")
+	})
+}
+
+func TestSerializer_ReaderSchema(t *testing.T) {
+	client := newClientForTest(t, fakeregistry.New())
+
+	serializer, err := newSerializer(client, "group", &SerializerOptions{AutoRegisterSchemas: true})
+	require.NoError(t, err)
+
+	v1Content, err := serializer.Serialize(context.Background(), map[string]any{"name": "Grace"}, userSchemaV1, nil)
+	require.NoError(t, err)
+
+	v2Content, err := serializer.Serialize(context.Background(), userV2{Name: "Ada", Age: 36}, userSchemaV2, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, *v1Content.ContentType, *v2Content.ContentType)
+
+	// reading v1 data with v2 uses the default for the new field
+	var user userV2
+	require.NoError(t, serializer.Deserialize(context.Background(), v1Content, &user, &DeserializeOptions{ReaderSchema: to.Ptr(userSchemaV2)}))
+	require.Equal(t, userV2{Name: "Grace"}, user)
+
+	// reading v2 data with v1 ignores the new field
+	var oldUser userV1
+	require.NoError(t, serializer.Deserialize(context.Background(), v2Content, &oldUser, &DeserializeOptions{ReaderSchema: to.Ptr(userSchemaV1)}))
+	require.Equal(t, userV1{Name: "Ada"}, oldUser)
+
+	err = serializer.Deserialize(context.Background(), v1Content, &user, &DeserializeOptions{ReaderSchema: to.Ptr(userSchemaNotBackward)})
+	require.ErrorContains(t, err, "reader schema isn't compatible with schema")
+}
+
+func TestSerializer_Compatibility(t *testing.T) {
+	t.Run("Backward", func(t *testing.T) {
+		serializer, registry := newSerializerWithV1(t, CompatibilityBackward)
+
+		_, err := serializer.Serialize(context.Background(), map[string]any{"name": "Ada", "email": "ada@example.com"}, userSchemaNotBackward, nil)
+		require.ErrorContains(t, err, "schema example.User isn't backward compatible with version 1")
+
+		_, err = serializer.Serialize(context.Background(), userV2{Name: "Ada"}, userSchemaV2, nil)
+		require.NoError(t, err)
+
+		requireVersions(t, registry, 1, 2)
+	})
+
+	t.Run("Forward", func(t *testing.T) {
+		serializer, registry := newSerializerWithV1(t, CompatibilityForward)
+
+		// data written with this can be read with v1, since the extra field is ignored.
+		_, err := serializer.Serialize(context.Background(), map[string]any{"name": "Ada", "email": "ada@example.com"}, userSchemaNotBackward, nil)
+		require.NoError(t, err)
+
+		// removing a field without a default isn't forward compatible
+		_, err = serializer.Serialize(context.Background(), map[string]any{}, `{"type":"record","name":"User","namespace":"example","fields":[]}`, nil)
+		require.ErrorContains(t, err, "isn't forward compatible with version 2")
+
+		requireVersions(t, registry, 1, 2)
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		serializer, _ := newSerializerWithV1(t, CompatibilityFull)
+
+		_, err := serializer.Serialize(context.Background(), map[string]any{"name": "Ada", "email": "ada@example.com"}, userSchemaNotBackward, nil)
+		require.ErrorContains(t, err, "isn't backward compatible")
+
+		_, err = serializer.Serialize(context.Background(), userV2{Name: "Ada"}, userSchemaV2, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("None", func(t *testing.T) {
+		serializer, registry := newSerializerWithV1(t, CompatibilityNone)
+
+		_, err := serializer.Serialize(context.Background(), map[string]any{"name": "Ada", "email": "ada@example.com"}, userSchemaNotBackward, nil)
+		require.NoError(t, err)
+
+		requireVersions(t, registry, 1, 2)
+	})
+}
+
+func TestSerializer_NoAutoRegister(t *testing.T) {
+	registry := fakeregistry.New()
+	client := newClientForTest(t, registry)
+
+	serializer, err := newSerializer(client, "group", nil)
+	require.NoError(t, err)
+
+	_, err = serializer.Serialize(context.Background(), userV1{Name: "Ada"}, userSchemaV1, nil)
+	require.ErrorContains(t, err, "schema example.User with this definition isn't registered in schema group group, and AutoRegisterSchemas is false")
+
+	_, err = client.RegisterSchema(context.Background(), "group", "example.User", userSchemaV1, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+
+	content, err := serializer.Serialize(context.Background(), userV1{Name: "Ada"}, userSchemaV1, nil)
+	require.NoError(t, err)
+
+	requestsBefore := len(registry.Requests())
+
+	_, err = serializer.Serialize(context.Background(), userV1{Name: "Grace"}, userSchemaV1, nil)
+	require.NoError(t, err)
+
+	var user userV1
+	require.NoError(t, serializer.Deserialize(context.Background(), content, &user, nil))
+	require.Equal(t, userV1{Name: "Ada"}, user)
+
+	require.Len(t, registry.Requests(), requestsBefore, "schemas are cached")
+}
+
+func TestSerializer_Errors(t *testing.T) {
+	client := newClientForTest(t, fakeregistry.New())
+
+	_, err := newSerializer(client, "", nil)
+	require.EqualError(t, err, "groupName cannot be empty")
+
+	_, err = newSerializer(client, "group", &SerializerOptions{Compatibility: "Sideways"})
+	require.EqualError(t, err, `invalid Compatibility "Sideways"`)
+
+	serializer, err := newSerializer(client, "group", &SerializerOptions{AutoRegisterSchemas: true})
+	require.NoError(t, err)
+
+	_, err = serializer.Serialize(context.Background(), "hello", `"string"`, nil)
+	require.EqualError(t, err, "schema must be a named type (record, enum or fixed), not string")
+
+	_, err = serializer.Serialize(context.Background(), "hello", `{"type":`, nil)
+	require.Error(t, err)
+
+	_, err = serializer.Serialize(context.Background(), map[string]any{"wrong": 1}, userSchemaV1, nil)
+	require.Error(t, err)
+
+	var v any
+	require.EqualError(t, serializer.Deserialize(context.Background(), MessageContent{}, &v, nil), "content has no ContentType")
+	require.EqualError(t, serializer.Deserialize(context.Background(), MessageContent{ContentType: to.Ptr("application/json")}, &v, nil), `content type "application/json" is not avro/binary+<schema ID>`)
+
+	jsonSchema, err := client.RegisterSchema(context.Background(), "group", "json", "{}", azschemaregistry.SchemaFormatJSON, nil)
+	require.NoError(t, err)
+
+	err = serializer.Deserialize(context.Background(), MessageContent{ContentType: to.Ptr("avro/binary+" + jsonSchema.ID)}, &v, nil)
+	require.EqualError(t, err, `schema `+jsonSchema.ID+` has format "Json", not "Avro"`)
+}
+
+func newSerializerWithV1(t *testing.T, compatibility Compatibility) (*Serializer, *fakeregistry.Registry) {
+	registry := fakeregistry.New()
+	client := newClientForTest(t, registry)
+
+	_, err := client.RegisterSchema(context.Background(), "group", "example.User", userSchemaV1, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+
+	serializer, err := newSerializer(client, "group", &SerializerOptions{AutoRegisterSchemas: true, Compatibility: compatibility})
+	require.NoError(t, err)
+
+	return serializer, registry
+}
+
+func requireVersions(t *testing.T, registry *fakeregistry.Registry, expected ...int32) {
+	page, err := newClientForTest(t, registry).NewListSchemaVersionsPager("group", "example.User", nil).NextPage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, page.Versions)
+}
+
+func newClientForTest(t *testing.T, registry *fakeregistry.Registry) *azschemaregistry.Client {
+	client, err := azschemaregistry.NewClient("example.servicebus.windows.net", &fake.TokenCredential{}, &azschemaregistry.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: registry,
+		},
+	})
+	require.NoError(t, err)
+
+	return client
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+import "sync"
+
+// schemaCache caches schemas, by ID and version, and schema properties, by definition. Registered schemas
+// can't be changed, so entries never expire.
+type schemaCache struct {
+	mu           sync.RWMutex
+	byID         map[string]Schema
+	byVersion    map[schemaVersionKey]string
+	byDefinition map[schemaDefinitionKey]SchemaProperties
+}
+
+type schemaVersionKey struct {
+	GroupName string
+	Name      string
+	Version   int32
+}
+
+type schemaDefinitionKey struct {
+	GroupName  string
+	Name       string
+	Format     SchemaFormat
+	Definition string
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{
+		byID:         map[string]Schema{},
+		byVersion:    map[schemaVersionKey]string{},
+		byDefinition: map[schemaDefinitionKey]SchemaProperties{},
+	}
+}
+
+func (c *schemaCache) add(schema Schema) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	props := schema.Properties
+
+	c.byID[props.ID] = schema
+	c.byVersion[schemaVersionKey{GroupName: props.GroupName, Name: props.Name, Version: props.Version}] = props.ID
+	c.byDefinition[schemaDefinitionKey{GroupName: props.GroupName, Name: props.Name, Format: props.Format, Definition: schema.Definition}] = props
+}
+
+func (c *schemaCache) schemaByID(id string) (Schema, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	schema, ok := c.byID[id]
+	return schema, ok
+}
+
+func (c *schemaCache) schemaByVersion(groupName string, name string, version int32) (Schema, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	id, ok := c.byVersion[schemaVersionKey{GroupName: groupName, Name: name, Version: version}]
+
+	if !ok {
+		return Schema{}, false
+	}
+
+	schema, ok := c.byID[id]
+	return schema, ok
+}
+
+func (c *schemaCache) propertiesByDefinition(groupName string, name string, definition string, format SchemaFormat) (SchemaProperties, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	props, ok := c.byDefinition[schemaDefinitionKey{GroupName: groupName, Name: name, Format: format, Definition: definition}]
+	return props, ok
+}
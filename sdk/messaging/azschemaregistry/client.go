@@ -0,0 +1,387 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+)
+
+// Client is written by hand rather than generated. The service has four operations, which send and
+// return schema definitions as plain text bodies with a content type per schema format, and return
+// the schema properties in headers. Every result is cached, so a generated client would need a
+// hand-written wrapper for the cache and the content types that's larger than this client.
+
+// Client registers and gets schemas from Azure Schema Registry.
+// Don't use this type directly, use [NewClient] instead.
+//
+// Registered schemas can't change, so the Client caches the results of [Client.RegisterSchema],
+// [Client.GetSchema], [Client.GetSchemaByVersion] and [Client.GetSchemaProperties], and
+// returns cached results without contacting the service.
+type Client struct {
+	internal *azcore.Client
+	endpoint string
+	cache    *schemaCache
+}
+
+// NewClient creates a Client for the Schema Registry in an Event Hubs namespace.
+//   - fullyQualifiedNamespace - the Event Hubs namespace, ex: <your-namespace>.servicebus.windows.net
+//   - credential - used to authorize requests. See [github.com/Azure/azure-sdk-for-go/sdk/azidentity] for credentials.
+//   - options - optional settings for the client. Pass nil to accept the defaults.
+func NewClient(fullyQualifiedNamespace string, credential azcore.TokenCredential, options *ClientOptions) (*Client, error) {
+	if options == nil {
+		options = &ClientOptions{}
+	}
+
+	azc, err := azcore.NewClient(moduleName+".Client", moduleVersion, runtime.PipelineOptions{
+		PerRetry: []policy.Policy{
+			runtime.NewBearerTokenPolicy(credential, []string{authScope}, nil),
+		},
+	}, &options.ClientOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fullyQualifiedNamespace
+
+	if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+		endpoint = "https://" + endpoint
+	}
+
+	return &Client{
+		internal: azc,
+		endpoint: endpoint,
+		cache:    newSchemaCache(),
+	}, nil
+}
+
+// RegisterSchema registers a schema, creating a new version if the definition is different from the
+// schema's existing versions. Registering a definition that's already registered returns the existing version.
+// If the operation fails it returns an *azcore.ResponseError type.
+//   - groupName - the name of the schema group.
+//   - name - the name of the schema.
+//   - definition - the schema's content.
+//   - format - the format of the schema's content.
+//   - options - RegisterSchemaOptions contains the optional parameters for the Client.RegisterSchema method.
+func (client *Client) RegisterSchema(ctx context.Context, groupName string, name string, definition string, format SchemaFormat, options *RegisterSchemaOptions) (RegisterSchemaResponse, error) {
+	if props, ok := client.cache.propertiesByDefinition(groupName, name, definition, format); ok {
+		return RegisterSchemaResponse{SchemaProperties: props}, nil
+	}
+
+	req, err := client.schemaDefinitionRequest(ctx, http.MethodPut, "/$schemaGroups/{groupName}/schemas/{schemaName}", groupName, name, definition, format)
+
+	if err != nil {
+		return RegisterSchemaResponse{}, err
+	}
+
+	httpResp, err := client.internal.Pipeline().Do(req)
+
+	if err != nil {
+		return RegisterSchemaResponse{}, err
+	}
+
+	if !runtime.HasStatusCode(httpResp, http.StatusOK, http.StatusNoContent) {
+		return RegisterSchemaResponse{}, runtime.NewResponseError(httpResp)
+	}
+
+	props, err := schemaPropertiesFromHeaders(httpResp, format)
+
+	if err != nil {
+		return RegisterSchemaResponse{}, err
+	}
+
+	client.cache.add(Schema{Definition: definition, Properties: props})
+	return RegisterSchemaResponse{SchemaProperties: props}, nil
+}
+
+// GetSchemaProperties gets the properties of a registered schema, using its definition.
+// If the definition hasn't been registered it returns an *azcore.ResponseError type, with a StatusCode of 404.
+//   - groupName - the name of the schema group.
+//   - name - the name of the schema.
+//   - definition - the schema's content.
+//   - format - the format of the schema's content.
+//   - options - GetSchemaPropertiesOptions contains the optional parameters for the Client.GetSchemaProperties method.
+func (client *Client) GetSchemaProperties(ctx context.Context, groupName string, name string, definition string, format SchemaFormat, options *GetSchemaPropertiesOptions) (GetSchemaPropertiesResponse, error) {
+	if props, ok := client.cache.propertiesByDefinition(groupName, name, definition, format); ok {
+		return GetSchemaPropertiesResponse{SchemaProperties: props}, nil
+	}
+
+	req, err := client.schemaDefinitionRequest(ctx, http.MethodPost, "/$schemaGroups/{groupName}/schemas/{schemaName}:get-id", groupName, name, definition, format)
+
+	if err != nil {
+		return GetSchemaPropertiesResponse{}, err
+	}
+
+	httpResp, err := client.internal.Pipeline().Do(req)
+
+	if err != nil {
+		return GetSchemaPropertiesResponse{}, err
+	}
+
+	if !runtime.HasStatusCode(httpResp, http.StatusOK, http.StatusNoContent) {
+		return GetSchemaPropertiesResponse{}, runtime.NewResponseError(httpResp)
+	}
+
+	props, err := schemaPropertiesFromHeaders(httpResp, format)
+
+	if err != nil {
+		return GetSchemaPropertiesResponse{}, err
+	}
+
+	client.cache.add(Schema{Definition: definition, Properties: props})
+	return GetSchemaPropertiesResponse{SchemaProperties: props}, nil
+}
+
+// GetSchema gets a schema using its ID.
+// If the operation fails it returns an *azcore.ResponseError type.
+//   - id - the schema's ID.
+//   - options - GetSchemaOptions contains the optional parameters for the Client.GetSchema method.
+func (client *Client) GetSchema(ctx context.Context, id string, options *GetSchemaOptions) (GetSchemaResponse, error) {
+	if id == "" {
+		return GetSchemaResponse{}, errors.New("parameter id cannot be empty")
+	}
+
+	if schema, ok := client.cache.schemaByID(id); ok {
+		return GetSchemaResponse{Schema: schema}, nil
+	}
+
+	schema, err := client.getSchema(ctx, "/$schemaGroups/$schemas/"+url.PathEscape(id))
+
+	if err != nil {
+		return GetSchemaResponse{}, err
+	}
+
+	return GetSchemaResponse{Schema: schema}, nil
+}
+
+// GetSchemaByVersion gets a specific version of a schema.
+// If the operation fails it returns an *azcore.ResponseError type.
+//   - groupName - the name of the schema group.
+//   - name - the name of the schema.
+//   - version - the version of the schema.
+//   - options - GetSchemaByVersionOptions contains the optional parameters for the Client.GetSchemaByVersion method.
+func (client *Client) GetSchemaByVersion(ctx context.Context, groupName string, name string, version int32, options *GetSchemaByVersionOptions) (GetSchemaByVersionResponse, error) {
+	if schema, ok := client.cache.schemaByVersion(groupName, name, version); ok {
+		return GetSchemaByVersionResponse{Schema: schema}, nil
+	}
+
+	urlPath, err := schemaPath("/$schemaGroups/{groupName}/schemas/{schemaName}/versions/"+strconv.FormatInt(int64(version), 10), groupName, name)
+
+	if err != nil {
+		return GetSchemaByVersionResponse{}, err
+	}
+
+	schema, err := client.getSchema(ctx, urlPath)
+
+	if err != nil {
+		return GetSchemaByVersionResponse{}, err
+	}
+
+	return GetSchemaByVersionResponse{Schema: schema}, nil
+}
+
+// NewListSchemaVersionsPager creates a pager that lists the versions of a schema.
+// Versions are always fetched from the service, since new versions can be registered at any time.
+//   - groupName - the name of the schema group.
+//   - name - the name of the schema.
+//   - options - ListSchemaVersionsOptions contains the optional parameters for the Client.NewListSchemaVersionsPager method.
+func (client *Client) NewListSchemaVersionsPager(groupName string, name string, options *ListSchemaVersionsOptions) *runtime.Pager[ListSchemaVersionsResponse] {
+	return runtime.NewPager(runtime.PagingHandler[ListSchemaVersionsResponse]{
+		More: func(page ListSchemaVersionsResponse) bool {
+			return page.NextLink != nil && len(*page.NextLink) > 0
+		},
+		Fetcher: func(ctx context.Context, page *ListSchemaVersionsResponse) (ListSchemaVersionsResponse, error) {
+			var req *policy.Request
+			var err error
+
+			if page == nil {
+				req, err = client.listSchemaVersionsCreateRequest(ctx, groupName, name)
+			} else {
+				req, err = runtime.NewRequest(ctx, http.MethodGet, *page.NextLink)
+			}
+
+			if err != nil {
+				return ListSchemaVersionsResponse{}, err
+			}
+
+			httpResp, err := client.internal.Pipeline().Do(req)
+
+			if err != nil {
+				return ListSchemaVersionsResponse{}, err
+			}
+
+			if !runtime.HasStatusCode(httpResp, http.StatusOK) {
+				return ListSchemaVersionsResponse{}, runtime.NewResponseError(httpResp)
+			}
+
+			var body struct {
+				Value    []int32 `json:"Value"`
+				NextLink *string `json:"NextLink"`
+			}
+
+			if err := runtime.UnmarshalAsJSON(httpResp, &body); err != nil {
+				return ListSchemaVersionsResponse{}, err
+			}
+
+			return ListSchemaVersionsResponse{
+				SchemaVersions: SchemaVersions{Versions: body.Value, NextLink: body.NextLink},
+			}, nil
+		},
+	})
+}
+
+func (client *Client) listSchemaVersionsCreateRequest(ctx context.Context, groupName string, name string) (*policy.Request, error) {
+	urlPath, err := schemaPath("/$schemaGroups/{groupName}/schemas/{schemaName}/versions", groupName, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := runtime.NewRequest(ctx, http.MethodGet, runtime.JoinPaths(client.endpoint, urlPath))
+
+	if err != nil {
+		return nil, err
+	}
+
+	setAPIVersion(req)
+	req.Raw().Header["Accept"] = []string{"application/json"}
+	return req, nil
+}
+
+// getSchema gets the schema at urlPath, which is either a schema ID or a version, and caches it.
+func (client *Client) getSchema(ctx context.Context, urlPath string) (Schema, error) {
+	req, err := runtime.NewRequest(ctx, http.MethodGet, runtime.JoinPaths(client.endpoint, urlPath))
+
+	if err != nil {
+		return Schema{}, err
+	}
+
+	setAPIVersion(req)
+
+	var accept []string
+
+	for _, format := range PossibleSchemaFormatValues() {
+		accept = append(accept, format.contentType())
+	}
+
+	req.Raw().Header["Accept"] = []string{strings.Join(accept, ", ")}
+
+	httpResp, err := client.internal.Pipeline().Do(req)
+
+	if err != nil {
+		return Schema{}, err
+	}
+
+	if !runtime.HasStatusCode(httpResp, http.StatusOK) {
+		return Schema{}, runtime.NewResponseError(httpResp)
+	}
+
+	definition, err := runtime.Payload(httpResp)
+
+	if err != nil {
+		return Schema{}, err
+	}
+
+	props, err := schemaPropertiesFromHeaders(httpResp, schemaFormatFromContentType(httpResp.Header.Get("Content-Type")))
+
+	if err != nil {
+		return Schema{}, err
+	}
+
+	schema := Schema{Definition: string(definition), Properties: props}
+	client.cache.add(schema)
+
+	return schema, nil
+}
+
+// schemaDefinitionRequest creates a request that sends a schema definition, for registering, or looking up, a schema.
+func (client *Client) schemaDefinitionRequest(ctx context.Context, method string, urlPath string, groupName string, name string, definition string, format SchemaFormat) (*policy.Request, error) {
+	urlPath, err := schemaPath(urlPath, groupName, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		return nil, errors.New("parameter format cannot be empty")
+	}
+
+	req, err := runtime.NewRequest(ctx, method, runtime.JoinPaths(client.endpoint, urlPath))
+
+	if err != nil {
+		return nil, err
+	}
+
+	setAPIVersion(req)
+	req.Raw().Header["Accept"] = []string{"application/json"}
+
+	if err := req.SetBody(streaming.NopCloser(strings.NewReader(definition)), format.contentType()); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func schemaPath(urlPath string, groupName string, name string) (string, error) {
+	if groupName == "" {
+		return "", errors.New("parameter groupName cannot be empty")
+	}
+
+	if name == "" {
+		return "", errors.New("parameter name cannot be empty")
+	}
+
+	urlPath = strings.ReplaceAll(urlPath, "{groupName}", url.PathEscape(groupName))
+	urlPath = strings.ReplaceAll(urlPath, "{schemaName}", url.PathEscape(name))
+	return urlPath, nil
+}
+
+func setAPIVersion(req *policy.Request) {
+	reqQP := req.Raw().URL.Query()
+	reqQP.Set("api-version", apiVersion)
+	req.Raw().URL.RawQuery = reqQP.Encode()
+}
+
+// schemaPropertiesFromHeaders reads the schema's properties from the response headers. The service
+// returns them as headers for all operations.
+func schemaPropertiesFromHeaders(resp *http.Response, format SchemaFormat) (SchemaProperties, error) {
+	// the body isn't used, but it needs to be drained so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	props := SchemaProperties{
+		ID:        resp.Header.Get("Schema-Id"),
+		Format:    format,
+		GroupName: resp.Header.Get("Schema-Group-Name"),
+		Name:      resp.Header.Get("Schema-Name"),
+	}
+
+	if props.ID == "" {
+		return SchemaProperties{}, errors.New("the response did not include a Schema-Id header")
+	}
+
+	if version := resp.Header.Get("Schema-Version"); version != "" {
+		v, err := strconv.ParseInt(version, 10, 32)
+
+		if err != nil {
+			return SchemaProperties{}, fmt.Errorf("invalid Schema-Version header %q: %w", version, err)
+		}
+
+		props.Version = int32(v)
+	}
+
+	return props, nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry/internal/fakeregistry"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{"type":"record","name":"User","namespace":"example","fields":[{"name":"name","type":"string"}]}`
+
+func TestClient_RegisterAndGet(t *testing.T) {
+	registry := fakeregistry.New()
+	client := newClientForTest(t, registry)
+
+	registered, err := client.RegisterSchema(context.Background(), "group", "example.User", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, registered.ID)
+	require.Equal(t, azschemaregistry.SchemaProperties{
+		ID:        registered.ID,
+		Format:    azschemaregistry.SchemaFormatAvro,
+		GroupName: "group",
+		Name:      "example.User",
+		Version:   1,
+	}, registered.SchemaProperties)
+
+	// a different client, so nothing is cached
+	otherClient := newClientForTest(t, registry)
+
+	byID, err := otherClient.GetSchema(context.Background(), registered.ID, nil)
+	require.NoError(t, err)
+	require.Equal(t, azschemaregistry.Schema{Definition: testSchema, Properties: registered.SchemaProperties}, byID.Schema)
+
+	byVersion, err := otherClient.GetSchemaByVersion(context.Background(), "group", "example.User", 1, nil)
+	require.NoError(t, err)
+	require.Equal(t, byID.Schema, byVersion.Schema)
+
+	props, err := otherClient.GetSchemaProperties(context.Background(), "group", "example.User", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+	require.Equal(t, registered.SchemaProperties, props.SchemaProperties)
+
+	require.Equal(t, []string{
+		"PUT /$schemaGroups/group/schemas/example.User",
+		"GET /$schemaGroups/$schemas/" + registered.ID,
+	}, registry.Requests(), "the version and properties were cached by GetSchema")
+}
+
+func TestClient_Caching(t *testing.T) {
+	registry := fakeregistry.New()
+	client := newClientForTest(t, registry)
+
+	for i := 0; i < 3; i++ {
+		registered, err := client.RegisterSchema(context.Background(), "group", "example.User", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+		require.NoError(t, err)
+
+		_, err = client.GetSchema(context.Background(), registered.ID, nil)
+		require.NoError(t, err)
+
+		_, err = client.GetSchemaByVersion(context.Background(), "group", "example.User", registered.Version, nil)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, registry.Requests(), 1, "only the first registration goes to the service")
+
+	// versions are never cached, since they can change.
+	for i := 0; i < 2; i++ {
+		pager := client.NewListSchemaVersionsPager("group", "example.User", nil)
+		require.True(t, pager.More())
+
+		page, err := pager.NextPage(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []int32{1}, page.Versions)
+		require.False(t, pager.More())
+	}
+
+	require.Len(t, registry.Requests(), 3)
+}
+
+func TestClient_Versions(t *testing.T) {
+	client := newClientForTest(t, fakeregistry.New())
+
+	v1, err := client.RegisterSchema(context.Background(), "group", "example.User", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+
+	const v2Schema = `{"type":"record","name":"User","namespace":"example","fields":[{"name":"name","type":"string"},{"name":"age","type":"int","default":0}]}`
+
+	v2, err := client.RegisterSchema(context.Background(), "group", "example.User", v2Schema, azschemaregistry.SchemaFormatAvro, nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), v1.Version)
+	require.Equal(t, int32(2), v2.Version)
+	require.NotEqual(t, v1.ID, v2.ID)
+
+	resp, err := client.GetSchemaByVersion(context.Background(), "group", "example.User", 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, v2Schema, resp.Definition)
+
+	page, err := client.NewListSchemaVersionsPager("group", "example.User", nil).NextPage(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2}, page.Versions)
+}
+
+func TestClient_Formats(t *testing.T) {
+	registry := fakeregistry.New()
+	client := newClientForTest(t, registry)
+
+	for _, format := range azschemaregistry.PossibleSchemaFormatValues() {
+		registered, err := client.RegisterSchema(context.Background(), "group", "schema-"+string(format), "{}", format, nil)
+		require.NoError(t, err)
+
+		resp, err := newClientForTest(t, registry).GetSchema(context.Background(), registered.ID, nil)
+		require.NoError(t, err)
+		require.Equal(t, format, resp.Properties.Format)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	client := newClientForTest(t, fakeregistry.New())
+
+	_, err := client.GetSchema(context.Background(), "missing", nil)
+	var respErr *azcore.ResponseError
+	require.True(t, errors.As(err, &respErr))
+	require.Equal(t, http.StatusNotFound, respErr.StatusCode)
+	require.Equal(t, "ItemNotFound", respErr.ErrorCode)
+
+	_, err = client.GetSchemaProperties(context.Background(), "group", "example.User", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+	require.True(t, errors.As(err, &respErr))
+	require.Equal(t, http.StatusNotFound, respErr.StatusCode)
+
+	_, err = client.GetSchema(context.Background(), "", nil)
+	require.EqualError(t, err, "parameter id cannot be empty")
+
+	_, err = client.RegisterSchema(context.Background(), "", "example.User", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+	require.EqualError(t, err, "parameter groupName cannot be empty")
+
+	_, err = client.RegisterSchema(context.Background(), "group", "", testSchema, azschemaregistry.SchemaFormatAvro, nil)
+	require.EqualError(t, err, "parameter name cannot be empty")
+
+	_, err = client.RegisterSchema(context.Background(), "group", "example.User", testSchema, "", nil)
+	require.EqualError(t, err, "parameter format cannot be empty")
+}
+
+func newClientForTest(t *testing.T, registry *fakeregistry.Registry) *azschemaregistry.Client {
+	client, err := azschemaregistry.NewClient("example.servicebus.windows.net", &fake.TokenCredential{}, &azschemaregistry.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: registry,
+		},
+	})
+	require.NoError(t, err)
+
+	return client
+}
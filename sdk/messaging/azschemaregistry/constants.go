@@ -0,0 +1,66 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+import (
+	"mime"
+	"strings"
+)
+
+const (
+	apiVersion = "2023-07-01"
+	authScope  = "https://eventhubs.azure.net/.default"
+)
+
+// SchemaFormat is the format of a schema's definition.
+type SchemaFormat string
+
+const (
+	// SchemaFormatAvro - an Apache Avro schema.
+	SchemaFormatAvro SchemaFormat = "Avro"
+	// SchemaFormatCustom - a schema in a format that Schema Registry doesn't validate.
+	SchemaFormatCustom SchemaFormat = "Custom"
+	// SchemaFormatJSON - a JSON Schema schema.
+	SchemaFormatJSON SchemaFormat = "Json"
+)
+
+// PossibleSchemaFormatValues returns the possible values for the SchemaFormat const type.
+func PossibleSchemaFormatValues() []SchemaFormat {
+	return []SchemaFormat{
+		SchemaFormatAvro,
+		SchemaFormatCustom,
+		SchemaFormatJSON,
+	}
+}
+
+// contentType is the Content-Type the service uses for schemas in format.
+func (format SchemaFormat) contentType() string {
+	switch format {
+	case SchemaFormatCustom:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/json; serialization=" + string(format)
+	}
+}
+
+// schemaFormatFromContentType is the inverse of [SchemaFormat.contentType].
+func schemaFormatFromContentType(contentType string) SchemaFormat {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return ""
+	}
+
+	if mediaType == "text/plain" {
+		return SchemaFormatCustom
+	}
+
+	for _, format := range []SchemaFormat{SchemaFormatAvro, SchemaFormatJSON} {
+		if strings.EqualFold(params["serialization"], string(format)) {
+			return format
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,12 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package azschemaregistry is a client for Azure Schema Registry, which stores the schemas for
+// events and messages sent using Azure Event Hubs and Azure Service Bus.
+//
+// Use [Client] to register schemas and to get them by ID, or by name and version. Schemas are
+// immutable once registered, so the Client caches the schemas and schema IDs it has seen.
+//
+// The avroserializer package uses the Client to serialize and deserialize Apache Avro payloads
+// for azeventhubs.EventData and azservicebus.Message.
+package azschemaregistry
@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry"
+)
+
+func ExampleNewClient() {
+	// FullyQualifiedNamespace is the Event Hubs namespace, ex: <your-namespace>.servicebus.windows.net
+	fullyQualifiedNamespace := os.Getenv("SCHEMAREGISTRY_NAMESPACE")
+
+	tokenCredential, err := azidentity.NewDefaultAzureCredential(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	client, err := azschemaregistry.NewClient(fullyQualifiedNamespace, tokenCredential, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	_ = client // ignore
+}
+
+func ExampleClient_RegisterSchema() {
+	var client *azschemaregistry.Client = nil // see ExampleNewClient for an example of creating a client
+
+	if client == nil {
+		return
+	}
+
+	definition := `{"type":"record","name":"User","namespace":"example","fields":[{"name":"name","type":"string"}]}`
+
+	resp, err := client.RegisterSchema(context.TODO(), "<schema group>", "example.User", definition, azschemaregistry.SchemaFormatAvro, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Registered schema %s, version %d, with ID %s\n", resp.Name, resp.Version, resp.ID)
+
+	// Schemas can be retrieved by ID...
+	schema, err := client.GetSchema(context.TODO(), resp.ID, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Definition: %s\n", schema.Definition)
+
+	// ...or by name and version
+	schema2, err := client.GetSchemaByVersion(context.TODO(), "<schema group>", "example.User", resp.Version, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Definition: %s\n", schema2.Definition)
+}
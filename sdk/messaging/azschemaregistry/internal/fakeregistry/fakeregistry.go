@@ -0,0 +1,212 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package fakeregistry is an in-memory implementation of the Schema Registry REST API, used
+// as the Transport for tests.
+package fakeregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry is a policy.Transporter that implements the Schema Registry operations the azschemaregistry.Client uses.
+type Registry struct {
+	mu       sync.Mutex
+	schemas  map[string]*schema   // ID -> schema
+	versions map[string][]*schema // group/name -> schemas, by version
+	requests []string
+}
+
+type schema struct {
+	ID          string
+	GroupName   string
+	Name        string
+	Version     int
+	ContentType string
+	Definition  string
+}
+
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{
+		schemas:  map[string]*schema{},
+		versions: map[string][]*schema{},
+	}
+}
+
+// Requests returns the requests that have been made, as "<method> <path>".
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.requests...)
+}
+
+// Do implements policy.Transporter.
+func (r *Registry) Do(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 3 && parts[0] == "$schemaGroups" && parts[1] == "$schemas" && req.Method == http.MethodGet:
+		return r.get(req, r.schemas[parts[2]])
+	case len(parts) == 4 && parts[0] == "$schemaGroups" && parts[2] == "schemas" && req.Method == http.MethodPut:
+		return r.register(req, parts[1], parts[3], req.Header.Get("Content-Type"), string(body))
+	case len(parts) == 4 && parts[0] == "$schemaGroups" && parts[2] == "schemas" && req.Method == http.MethodPost && strings.HasSuffix(parts[3], ":get-id"):
+		return r.getID(req, parts[1], strings.TrimSuffix(parts[3], ":get-id"), req.Header.Get("Content-Type"), string(body))
+	case len(parts) == 5 && parts[0] == "$schemaGroups" && parts[4] == "versions" && req.Method == http.MethodGet:
+		return r.listVersions(req, parts[1], parts[3])
+	case len(parts) == 6 && parts[0] == "$schemaGroups" && parts[4] == "versions" && req.Method == http.MethodGet:
+		version, err := strconv.Atoi(parts[5])
+
+		if err != nil {
+			return errorResponse(req, http.StatusBadRequest, "InvalidRequest", err.Error()), nil
+		}
+
+		return r.get(req, r.findVersion(parts[1], parts[3], version))
+	}
+
+	return errorResponse(req, http.StatusNotFound, "NotFound", "unknown operation "+req.Method+" "+req.URL.Path), nil
+}
+
+func (r *Registry) register(req *http.Request, groupName string, name string, contentType string, definition string) (*http.Response, error) {
+	if existing := r.findDefinition(groupName, name, contentType, definition); existing != nil {
+		return propertiesResponse(req, http.StatusNoContent, existing), nil
+	}
+
+	key := groupName + "/" + name
+
+	s := &schema{
+		ID:          fmt.Sprintf("%032x", len(r.schemas)+1),
+		GroupName:   groupName,
+		Name:        name,
+		Version:     len(r.versions[key]) + 1,
+		ContentType: contentType,
+		Definition:  definition,
+	}
+
+	r.schemas[s.ID] = s
+	r.versions[key] = append(r.versions[key], s)
+
+	return propertiesResponse(req, http.StatusNoContent, s), nil
+}
+
+func (r *Registry) getID(req *http.Request, groupName string, name string, contentType string, definition string) (*http.Response, error) {
+	s := r.findDefinition(groupName, name, contentType, definition)
+
+	if s == nil {
+		return errorResponse(req, http.StatusNotFound, "ItemNotFound", "schema not found"), nil
+	}
+
+	return propertiesResponse(req, http.StatusNoContent, s), nil
+}
+
+func (r *Registry) get(req *http.Request, s *schema) (*http.Response, error) {
+	if s == nil {
+		return errorResponse(req, http.StatusNotFound, "ItemNotFound", "schema not found"), nil
+	}
+
+	resp := propertiesResponse(req, http.StatusOK, s)
+	resp.Header.Set("Content-Type", s.ContentType)
+	resp.Body = io.NopCloser(strings.NewReader(s.Definition))
+
+	return resp, nil
+}
+
+func (r *Registry) listVersions(req *http.Request, groupName string, name string) (*http.Response, error) {
+	schemas := r.versions[groupName+"/"+name]
+
+	if len(schemas) == 0 {
+		return errorResponse(req, http.StatusNotFound, "ItemNotFound", "schema not found"), nil
+	}
+
+	var versions []int
+
+	for _, s := range schemas {
+		versions = append(versions, s.Version)
+	}
+
+	body, err := json.Marshal(map[string]any{"Value": versions})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func (r *Registry) findDefinition(groupName string, name string, contentType string, definition string) *schema {
+	for _, s := range r.versions[groupName+"/"+name] {
+		if s.ContentType == contentType && s.Definition == definition {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) findVersion(groupName string, name string, version int) *schema {
+	schemas := r.versions[groupName+"/"+name]
+
+	if version < 1 || version > len(schemas) {
+		return nil
+	}
+
+	return schemas[version-1]
+}
+
+func propertiesResponse(req *http.Request, statusCode int, s *schema) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header: http.Header{
+			"Schema-Id":         []string{s.ID},
+			"Schema-Group-Name": []string{s.GroupName},
+			"Schema-Name":       []string{s.Name},
+			"Schema-Version":    []string{strconv.Itoa(s.Version)},
+		},
+		Body:    http.NoBody,
+		Request: req,
+	}
+}
+
+func errorResponse(req *http.Request, statusCode int, code string, message string) *http.Response {
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]string{"code": code, "message": message},
+	})
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Header: http.Header{
+			"Content-Type":    []string{"application/json"},
+			"X-Ms-Error-Code": []string{code},
+		},
+		Body:    io.NopCloser(bytes.NewReader(body)),
+		Request: req,
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+// Schema is a schema, and its properties.
+type Schema struct {
+	// Definition is the schema's content, in the format given by Properties.Format.
+	Definition string
+
+	// Properties are the schema's properties.
+	Properties SchemaProperties
+}
+
+// SchemaProperties are the properties of a registered schema.
+type SchemaProperties struct {
+	// ID uniquely identifies the schema within the namespace.
+	ID string
+
+	// Format is the format of the schema's definition.
+	Format SchemaFormat
+
+	// GroupName is the name of the schema group the schema belongs to.
+	GroupName string
+
+	// Name is the name of the schema. Each registered definition for a name is a new version.
+	Name string
+
+	// Version is the schema's version.
+	Version int32
+}
+
+// SchemaVersions is a page of versions from [Client.NewListSchemaVersionsPager].
+type SchemaVersions struct {
+	// Versions are the versions of the schema.
+	Versions []int32
+
+	// NextLink is the link to the next page of versions.
+	NextLink *string
+}
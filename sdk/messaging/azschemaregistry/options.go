@@ -0,0 +1,36 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+import "github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+// ClientOptions contains optional settings for [NewClient].
+type ClientOptions struct {
+	azcore.ClientOptions
+}
+
+// RegisterSchemaOptions contains the optional parameters for the [Client.RegisterSchema] method.
+type RegisterSchemaOptions struct {
+	// For future expansion
+}
+
+// GetSchemaOptions contains the optional parameters for the [Client.GetSchema] method.
+type GetSchemaOptions struct {
+	// For future expansion
+}
+
+// GetSchemaByVersionOptions contains the optional parameters for the [Client.GetSchemaByVersion] method.
+type GetSchemaByVersionOptions struct {
+	// For future expansion
+}
+
+// GetSchemaPropertiesOptions contains the optional parameters for the [Client.GetSchemaProperties] method.
+type GetSchemaPropertiesOptions struct {
+	// For future expansion
+}
+
+// ListSchemaVersionsOptions contains the optional parameters for the [Client.NewListSchemaVersionsPager] method.
+type ListSchemaVersionsOptions struct {
+	// For future expansion
+}
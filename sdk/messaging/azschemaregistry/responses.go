@@ -0,0 +1,29 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+// RegisterSchemaResponse contains the response from method [Client.RegisterSchema].
+type RegisterSchemaResponse struct {
+	SchemaProperties
+}
+
+// GetSchemaResponse contains the response from method [Client.GetSchema].
+type GetSchemaResponse struct {
+	Schema
+}
+
+// GetSchemaByVersionResponse contains the response from method [Client.GetSchemaByVersion].
+type GetSchemaByVersionResponse struct {
+	Schema
+}
+
+// GetSchemaPropertiesResponse contains the response from method [Client.GetSchemaProperties].
+type GetSchemaPropertiesResponse struct {
+	SchemaProperties
+}
+
+// ListSchemaVersionsResponse contains the response from method [Client.NewListSchemaVersionsPager].
+type ListSchemaVersionsResponse struct {
+	SchemaVersions
+}
@@ -0,0 +1,9 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azschemaregistry
+
+const (
+	moduleName    = "github.com/Azure/azure-sdk-for-go/sdk/messaging/azschemaregistry"
+	moduleVersion = "v0.1.0"
+)
@@ -0,0 +1,898 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package admin
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/internal/atom"
+)
+
+// Topology is the desired state of the queues, topics, subscriptions and rules in a namespace,
+// for Client.ReconcileTopology.
+type Topology struct {
+	// Queues are the queues in the namespace.
+	Queues []QueueTopology
+
+	// Topics are the topics in the namespace, and their subscriptions.
+	Topics []TopicTopology
+}
+
+// QueueTopology is the desired state of a queue.
+type QueueTopology struct {
+	// Name is the name of the queue.
+	Name string
+
+	// Properties are the properties the queue should have. Only the fields that are set are
+	// compared with the queue, so properties that aren't set keep their current value, or the
+	// service's default for a new queue. AuthorizationRules are only used when the queue is created.
+	Properties *QueueProperties
+}
+
+// TopicTopology is the desired state of a topic.
+type TopicTopology struct {
+	// Name is the name of the topic.
+	Name string
+
+	// Properties are the properties the topic should have. Only the fields that are set are
+	// compared with the topic, so properties that aren't set keep their current value, or the
+	// service's default for a new topic. AuthorizationRules are only used when the topic is created.
+	Properties *TopicProperties
+
+	// Subscriptions are the subscriptions to the topic.
+	Subscriptions []SubscriptionTopology
+}
+
+// SubscriptionTopology is the desired state of a subscription.
+type SubscriptionTopology struct {
+	// Name is the name of the subscription.
+	Name string
+
+	// Properties are the properties the subscription should have. Only the fields that are set are
+	// compared with the subscription, so properties that aren't set keep their current value, or the
+	// service's default for a new subscription. Use Rules, rather than DefaultRule, to manage rules.
+	Properties *SubscriptionProperties
+
+	// Rules are the subscription's rules. A rule without a Name is named "$Default", and a rule
+	// without a Filter uses a TrueFilter.
+	//
+	// If Rules is nil the subscription's rules aren't managed: a new subscription gets the "$Default"
+	// rule, which accepts every message. If Rules isn't nil, a new subscription is created with
+	// exactly these rules, and existing subscriptions get any rules that are missing or different.
+	Rules []RuleProperties
+}
+
+// TopologyEntityType is the type of entity in a ReconcileResult.
+type TopologyEntityType string
+
+const (
+	// TopologyEntityTypeQueue is a queue.
+	TopologyEntityTypeQueue TopologyEntityType = "Queue"
+	// TopologyEntityTypeTopic is a topic.
+	TopologyEntityTypeTopic TopologyEntityType = "Topic"
+	// TopologyEntityTypeSubscription is a subscription.
+	TopologyEntityTypeSubscription TopologyEntityType = "Subscription"
+	// TopologyEntityTypeRule is a subscription rule.
+	TopologyEntityTypeRule TopologyEntityType = "Rule"
+)
+
+// ReconcileAction is the change that's needed to make an entity match the topology.
+type ReconcileAction string
+
+const (
+	// ReconcileActionNone means the entity already matches the topology.
+	ReconcileActionNone ReconcileAction = "None"
+	// ReconcileActionCreate means the entity doesn't exist, and is created.
+	ReconcileActionCreate ReconcileAction = "Create"
+	// ReconcileActionUpdate means the entity exists, and some of its properties are updated.
+	ReconcileActionUpdate ReconcileAction = "Update"
+	// ReconcileActionDelete means the entity isn't in the topology, and is deleted. Entities are
+	// only deleted when ReconcileTopologyOptions.DeleteUnlisted is true.
+	ReconcileActionDelete ReconcileAction = "Delete"
+)
+
+// ReconcileResult is the planned, or applied, change for a single entity.
+type ReconcileResult struct {
+	// EntityType is the type of the entity.
+	EntityType TopologyEntityType
+
+	// EntityPath is the path of the entity. Ex: "queue", "topic", "topic/Subscriptions/subscription"
+	// or "topic/Subscriptions/subscription/Rules/rule".
+	EntityPath string
+
+	// Action is the change that's needed to make the entity match the topology.
+	Action ReconcileAction
+
+	// ChangedProperties are the names of the properties that are updated, for ReconcileActionUpdate.
+	ChangedProperties []string
+
+	// Applied is true if the change was made. It's false for a dry run, for ReconcileActionNone,
+	// and if the change failed.
+	Applied bool
+
+	// Err is the error, if the change failed or couldn't be made.
+	Err error
+}
+
+// ReconcileTopologyOptions contains the optional parameters for Client.ReconcileTopology.
+type ReconcileTopologyOptions struct {
+	// DryRun computes the changes, without making them. Results have Applied set to false.
+	DryRun bool
+
+	// DeleteUnlisted deletes the queues and topics that aren't in the topology, the subscriptions
+	// that aren't in their topic's topology and, for subscriptions with Rules, the rules that
+	// aren't listed.
+	DeleteUnlisted bool
+}
+
+// ReconcileTopologyResponse contains the response fields for Client.ReconcileTopology.
+type ReconcileTopologyResponse struct {
+	// Results contain a result for each entity in the topology, and each entity that's deleted, in
+	// the order the changes are made.
+	Results []ReconcileResult
+}
+
+// ReconcileTopology compares the topology with the namespace, and makes the changes needed for the
+// namespace to match it: entities are created, their properties are updated and, optionally,
+// entities that aren't in the topology are deleted. Reconciling the same topology again makes no
+// changes.
+//
+// Topics are created before their subscriptions, and entities that forward messages are changed
+// after the entities they forward to. Deletes are made last. If a change fails, the changes that
+// depend on it are skipped and the rest are still made. The error combines the errors in the
+// results. Properties that can't be changed after an entity is created, like RequiresSession,
+// are reported as an error in the entity's result, and the entity isn't changed.
+func (ac *Client) ReconcileTopology(ctx context.Context, topology Topology, options *ReconcileTopologyOptions) (ReconcileTopologyResponse, error) {
+	if options == nil {
+		options = &ReconcileTopologyOptions{}
+	}
+
+	if err := validateTopology(topology); err != nil {
+		return ReconcileTopologyResponse{}, err
+	}
+
+	live, err := ac.getLiveTopology(ctx, topology)
+
+	if err != nil {
+		return ReconcileTopologyResponse{}, err
+	}
+
+	changes, err := ac.planTopology(topology, live, options.DeleteUnlisted)
+
+	if err != nil {
+		return ReconcileTopologyResponse{}, err
+	}
+
+	applyChanges(ctx, changes, options.DryRun)
+
+	var errs []error
+	resp := ReconcileTopologyResponse{Results: make([]ReconcileResult, 0, len(changes))}
+
+	for _, c := range changes {
+		resp.Results = append(resp.Results, *c.result)
+
+		if c.result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", c.result.Action, c.result.EntityPath, c.result.Err))
+		}
+	}
+
+	return resp, errors.Join(errs...)
+}
+
+// applyChanges makes the changes, in order. Changes whose parent wasn't made are skipped.
+func applyChanges(ctx context.Context, changes []*plannedChange, dryRun bool) {
+	for _, c := range changes {
+		if dryRun || c.result.Action == ReconcileActionNone || c.result.Err != nil {
+			continue
+		}
+
+		if c.parent != nil && !c.parent.result.Applied && c.parent.result.Action != ReconcileActionNone {
+			c.result.Err = fmt.Errorf("skipped, because the change to %s %q wasn't made", strings.ToLower(string(c.parent.result.EntityType)), c.parent.result.EntityPath)
+			continue
+		}
+
+		if c.apply != nil {
+			c.result.Err = c.apply(ctx)
+		}
+
+		c.result.Applied = c.result.Err == nil
+	}
+}
+
+// plannedChange is a change to a single entity, and how to make it.
+type plannedChange struct {
+	result *ReconcileResult
+
+	// apply makes the change. It's nil when the change is made along with its parent, ex: the first
+	// rule of a new subscription.
+	apply func(ctx context.Context) error
+
+	// parent is the change this change depends on, ex: the creation of a subscription's topic.
+	parent *plannedChange
+
+	// phase orders the changes: entities that don't forward messages are changed first, then the
+	// entities that forward messages, and then the deletes.
+	phase int
+}
+
+const (
+	phaseChange = iota
+	phaseForwardingChange
+	phaseDelete
+)
+
+type liveTopology struct {
+	queues map[string]*QueueItem
+	topics map[string]*liveTopic
+}
+
+type liveTopic struct {
+	item          *TopicItem
+	subscriptions map[string]*liveSubscription
+}
+
+type liveSubscription struct {
+	item *SubscriptionPropertiesItem
+
+	// rules are only listed for subscriptions that manage their rules.
+	rules []RuleProperties
+}
+
+func validateTopology(topology Topology) error {
+	names := map[string]bool{}
+
+	checkName := func(kind string, name string) error {
+		if name == "" {
+			return fmt.Errorf("a %s in the topology has no name", kind)
+		}
+
+		key := kind + "/" + strings.ToLower(name)
+
+		if names[key] {
+			return fmt.Errorf("the %s %q is in the topology more than once", kind, name)
+		}
+
+		names[key] = true
+		return nil
+	}
+
+	for _, q := range topology.Queues {
+		if err := checkName("queue", q.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range topology.Topics {
+		if err := checkName("topic", t.Name); err != nil {
+			return err
+		}
+
+		for _, s := range t.Subscriptions {
+			if err := checkName("subscription", t.Name+"/"+s.Name); err != nil {
+				return err
+			}
+
+			for _, r := range s.Rules {
+				if err := checkName("rule", t.Name+"/"+s.Name+"/"+makeRuleNameForProperties(&r)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// getLiveTopology lists the entities in the namespace that are needed to plan the changes.
+func (ac *Client) getLiveTopology(ctx context.Context, topology Topology) (*liveTopology, error) {
+	live := &liveTopology{
+		queues: map[string]*QueueItem{},
+		topics: map[string]*liveTopic{},
+	}
+
+	queuePager := ac.NewListQueuesPager(nil)
+
+	for queuePager.More() {
+		page, err := queuePager.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range page.Queues {
+			live.queues[strings.ToLower(page.Queues[i].QueueName)] = &page.Queues[i]
+		}
+	}
+
+	topicPager := ac.NewListTopicsPager(nil)
+
+	for topicPager.More() {
+		page, err := topicPager.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range page.Topics {
+			live.topics[strings.ToLower(page.Topics[i].TopicName)] = &liveTopic{item: &page.Topics[i]}
+		}
+	}
+
+	for _, desiredTopic := range topology.Topics {
+		lt := live.topics[strings.ToLower(desiredTopic.Name)]
+
+		if lt == nil {
+			continue
+		}
+
+		lt.subscriptions = map[string]*liveSubscription{}
+		subPager := ac.NewListSubscriptionsPager(lt.item.TopicName, nil)
+
+		for subPager.More() {
+			page, err := subPager.NextPage(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for i := range page.Subscriptions {
+				lt.subscriptions[strings.ToLower(page.Subscriptions[i].SubscriptionName)] = &liveSubscription{item: &page.Subscriptions[i]}
+			}
+		}
+
+		for _, desiredSub := range desiredTopic.Subscriptions {
+			ls := lt.subscriptions[strings.ToLower(desiredSub.Name)]
+
+			if ls == nil || desiredSub.Rules == nil {
+				continue
+			}
+
+			rulePager := ac.NewListRulesPager(lt.item.TopicName, ls.item.SubscriptionName, nil)
+
+			for rulePager.More() {
+				page, err := rulePager.NextPage(ctx)
+
+				if err != nil {
+					return nil, err
+				}
+
+				ls.rules = append(ls.rules, page.Rules...)
+			}
+		}
+	}
+
+	return live, nil
+}
+
+// planTopology computes the changes that make the live topology match the desired topology.
+func (ac *Client) planTopology(desired Topology, live *liveTopology, deleteUnlisted bool) ([]*plannedChange, error) {
+	var changes []*plannedChange
+
+	add := func(entityType TopologyEntityType, path string, action ReconcileAction, changed []string, phase int, parent *plannedChange, apply func(ctx context.Context) error) *plannedChange {
+		c := &plannedChange{
+			result: &ReconcileResult{
+				EntityType:        entityType,
+				EntityPath:        path,
+				Action:            action,
+				ChangedProperties: changed,
+			},
+			apply:  apply,
+			parent: parent,
+			phase:  phase,
+		}
+
+		changes = append(changes, c)
+		return c
+	}
+
+	for _, q := range desired.Queues {
+		q := q
+		props := valueOrZero(q.Properties)
+		phase := forwardingPhase(props.ForwardTo, props.ForwardDeadLetteredMessagesTo)
+		existing := live.queues[strings.ToLower(q.Name)]
+
+		if existing == nil {
+			add(TopologyEntityTypeQueue, q.Name, ReconcileActionCreate, nil, phase, nil, func(ctx context.Context) error {
+				_, err := ac.CreateQueue(ctx, q.Name, &CreateQueueOptions{Properties: &props})
+				return err
+			})
+			continue
+		}
+
+		merged, changed, immutable := mergeProperties(props, existing.QueueProperties, "RequiresSession", "RequiresDuplicateDetection", "EnablePartitioning")
+		c := add(TopologyEntityTypeQueue, existing.QueueName, actionFor(changed), changed, phase, nil, func(ctx context.Context) error {
+			_, err := ac.UpdateQueue(ctx, existing.QueueName, merged, nil)
+			return err
+		})
+		c.result.Err = immutableError(immutable)
+	}
+
+	for _, t := range desired.Topics {
+		t := t
+		props := valueOrZero(t.Properties)
+		existing := live.topics[strings.ToLower(t.Name)]
+
+		var topicChange *plannedChange
+		topicName := t.Name
+
+		if existing == nil {
+			topicChange = add(TopologyEntityTypeTopic, t.Name, ReconcileActionCreate, nil, phaseChange, nil, func(ctx context.Context) error {
+				_, err := ac.CreateTopic(ctx, t.Name, &CreateTopicOptions{Properties: &props})
+				return err
+			})
+			existing = &liveTopic{subscriptions: map[string]*liveSubscription{}}
+		} else {
+			topicName = existing.item.TopicName
+			merged, changed, immutable := mergeProperties(props, existing.item.TopicProperties, "RequiresDuplicateDetection", "EnablePartitioning", "SupportOrdering")
+			topicChange = add(TopologyEntityTypeTopic, topicName, actionFor(changed), changed, phaseChange, nil, func(ctx context.Context) error {
+				_, err := ac.UpdateTopic(ctx, topicName, merged, nil)
+				return err
+			})
+			topicChange.result.Err = immutableError(immutable)
+		}
+
+		desiredSubs := map[string]bool{}
+
+		for _, s := range t.Subscriptions {
+			desiredSubs[strings.ToLower(s.Name)] = true
+
+			if err := ac.planSubscription(topicName, s, existing.subscriptions[strings.ToLower(s.Name)], topicChange, deleteUnlisted, add); err != nil {
+				return nil, err
+			}
+		}
+
+		if !deleteUnlisted {
+			continue
+		}
+
+		for _, name := range sortedKeys(existing.subscriptions) {
+			if desiredSubs[name] {
+				continue
+			}
+
+			ls := existing.subscriptions[name]
+			add(TopologyEntityTypeSubscription, topicName+"/Subscriptions/"+ls.item.SubscriptionName, ReconcileActionDelete, nil, phaseDelete, nil, func(ctx context.Context) error {
+				_, err := ac.DeleteSubscription(ctx, topicName, ls.item.SubscriptionName, nil)
+				return err
+			})
+		}
+	}
+
+	if deleteUnlisted {
+		desiredTopics := map[string]bool{}
+
+		for _, t := range desired.Topics {
+			desiredTopics[strings.ToLower(t.Name)] = true
+		}
+
+		for _, name := range sortedKeys(live.topics) {
+			if desiredTopics[name] {
+				continue
+			}
+
+			topicName := live.topics[name].item.TopicName
+			add(TopologyEntityTypeTopic, topicName, ReconcileActionDelete, nil, phaseDelete, nil, func(ctx context.Context) error {
+				_, err := ac.DeleteTopic(ctx, topicName, nil)
+				return err
+			})
+		}
+
+		desiredQueues := map[string]bool{}
+
+		for _, q := range desired.Queues {
+			desiredQueues[strings.ToLower(q.Name)] = true
+		}
+
+		for _, name := range sortedKeys(live.queues) {
+			if desiredQueues[name] {
+				continue
+			}
+
+			queueName := live.queues[name].QueueName
+			add(TopologyEntityTypeQueue, queueName, ReconcileActionDelete, nil, phaseDelete, nil, func(ctx context.Context) error {
+				_, err := ac.DeleteQueue(ctx, queueName, nil)
+				return err
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].phase < changes[j].phase })
+	return changes, nil
+}
+
+type addChangeFn func(entityType TopologyEntityType, path string, action ReconcileAction, changed []string, phase int, parent *plannedChange, apply func(ctx context.Context) error) *plannedChange
+
+func (ac *Client) planSubscription(topicName string, s SubscriptionTopology, existing *liveSubscription, topicChange *plannedChange, deleteUnlisted bool, add addChangeFn) error {
+	props := valueOrZero(s.Properties)
+	props.DefaultRule = nil
+	phase := forwardingPhase(props.ForwardTo, props.ForwardDeadLetteredMessagesTo)
+	path := topicName + "/Subscriptions/" + s.Name
+
+	if existing == nil {
+		// the subscription is created with its first rule, so it never has the "$Default" rule,
+		// which would accept every message.
+		if len(s.Rules) > 0 {
+			props.DefaultRule = &s.Rules[0]
+		}
+
+		subChange := add(TopologyEntityTypeSubscription, path, ReconcileActionCreate, nil, phase, topicChange, func(ctx context.Context) error {
+			_, err := ac.CreateSubscription(ctx, topicName, s.Name, &CreateSubscriptionOptions{Properties: &props})
+			return err
+		})
+
+		switch {
+		case s.Rules == nil:
+		case len(s.Rules) == 0:
+			add(TopologyEntityTypeRule, path+"/Rules/$Default", ReconcileActionDelete, nil, phase, subChange, func(ctx context.Context) error {
+				_, err := ac.DeleteRule(ctx, topicName, s.Name, "$Default", nil)
+				return err
+			})
+		default:
+			add(TopologyEntityTypeRule, path+"/Rules/"+makeRuleNameForProperties(&s.Rules[0]), ReconcileActionCreate, nil, phase, subChange, nil)
+
+			for _, r := range s.Rules[1:] {
+				r := r
+				add(TopologyEntityTypeRule, path+"/Rules/"+makeRuleNameForProperties(&r), ReconcileActionCreate, nil, phase, subChange, func(ctx context.Context) error {
+					return ac.createRuleFromProperties(ctx, topicName, s.Name, r)
+				})
+			}
+		}
+
+		return nil
+	}
+
+	subName := existing.item.SubscriptionName
+	path = topicName + "/Subscriptions/" + subName
+	merged, changed, immutable := mergeProperties(props, existing.item.SubscriptionProperties, "RequiresSession")
+	merged.DefaultRule = nil
+
+	subChange := add(TopologyEntityTypeSubscription, path, actionFor(changed), changed, phase, topicChange, func(ctx context.Context) error {
+		_, err := ac.UpdateSubscription(ctx, topicName, subName, merged, nil)
+		return err
+	})
+	subChange.result.Err = immutableError(immutable)
+
+	if s.Rules == nil {
+		return nil
+	}
+
+	liveRules := map[string]RuleProperties{}
+
+	for _, r := range existing.rules {
+		liveRules[strings.ToLower(r.Name)] = r
+	}
+
+	desiredRules := map[string]bool{}
+
+	for _, r := range s.Rules {
+		r := r
+		r.Name = makeRuleNameForProperties(&r)
+		desiredRules[strings.ToLower(r.Name)] = true
+		rulePath := path + "/Rules/" + r.Name
+
+		liveRule, exists := liveRules[strings.ToLower(r.Name)]
+
+		if !exists {
+			add(TopologyEntityTypeRule, rulePath, ReconcileActionCreate, nil, phase, subChange, func(ctx context.Context) error {
+				return ac.createRuleFromProperties(ctx, topicName, subName, r)
+			})
+			continue
+		}
+
+		changed, err := diffRules(r, liveRule)
+
+		if err != nil {
+			return err
+		}
+
+		r.Name = liveRule.Name
+
+		add(TopologyEntityTypeRule, path+"/Rules/"+liveRule.Name, actionFor(changed), changed, phase, subChange, func(ctx context.Context) error {
+			_, err := ac.UpdateRule(ctx, topicName, subName, r)
+			return err
+		})
+	}
+
+	if !deleteUnlisted {
+		return nil
+	}
+
+	for _, r := range existing.rules {
+		if desiredRules[strings.ToLower(r.Name)] {
+			continue
+		}
+
+		ruleName := r.Name
+		add(TopologyEntityTypeRule, path+"/Rules/"+ruleName, ReconcileActionDelete, nil, phaseDelete, nil, func(ctx context.Context) error {
+			_, err := ac.DeleteRule(ctx, topicName, subName, ruleName, nil)
+			return err
+		})
+	}
+
+	return nil
+}
+
+func (ac *Client) createRuleFromProperties(ctx context.Context, topicName string, subscriptionName string, r RuleProperties) error {
+	name := makeRuleNameForProperties(&r)
+
+	_, err := ac.CreateRule(ctx, topicName, subscriptionName, &CreateRuleOptions{
+		Name:   &name,
+		Filter: r.Filter,
+		Action: r.Action,
+	})
+	return err
+}
+
+func actionFor(changed []string) ReconcileAction {
+	if len(changed) == 0 {
+		return ReconcileActionNone
+	}
+
+	return ReconcileActionUpdate
+}
+
+func forwardingPhase(forwardTo *string, forwardDeadLetteredMessagesTo *string) int {
+	if forwardTo != nil && *forwardTo != "" || forwardDeadLetteredMessagesTo != nil && *forwardDeadLetteredMessagesTo != "" {
+		return phaseForwardingChange
+	}
+
+	return phaseChange
+}
+
+func immutableError(immutable []string) error {
+	if len(immutable) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%s can't be changed after the entity is created", strings.Join(immutable, ", "))
+}
+
+func valueOrZero[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+
+	return *v
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// unmanagedProperties aren't compared: AuthorizationRules include keys generated by the service,
+// and the rules of a subscription are reconciled on their own.
+var unmanagedProperties = map[string]bool{
+	"AuthorizationRules": true,
+	"DefaultRule":        true,
+}
+
+// durationProperties hold ISO 8601 durations, which the service can return in another form than
+// the one that was set, ex: "PT60S" for "PT1M".
+var durationProperties = map[string]bool{
+	"AutoDeleteOnIdle":                    true,
+	"DefaultMessageTimeToLive":            true,
+	"DuplicateDetectionHistoryTimeWindow": true,
+	"LockDuration":                        true,
+}
+
+// mergeProperties overlays the fields that are set in desired onto live. It returns the merged
+// properties, the names of the fields that are different, and the names of the fields in immutable
+// that are different.
+func mergeProperties[T any](desired T, live T, immutable ...string) (T, []string, []string) {
+	merged := live
+	desiredValue := reflect.ValueOf(desired)
+	liveValue := reflect.ValueOf(live)
+	mergedValue := reflect.ValueOf(&merged).Elem()
+
+	var changed, immutableChanged []string
+
+	for i := 0; i < desiredValue.NumField(); i++ {
+		name := desiredValue.Type().Field(i).Name
+		field := desiredValue.Field(i)
+
+		if unmanagedProperties[name] || field.Kind() != reflect.Pointer || field.IsNil() {
+			continue
+		}
+
+		if propertyEqual(name, field, liveValue.Field(i)) {
+			continue
+		}
+
+		mergedValue.Field(i).Set(field)
+
+		for _, n := range immutable {
+			if n == name {
+				immutableChanged = append(immutableChanged, name)
+			}
+		}
+
+		changed = append(changed, name)
+	}
+
+	return merged, changed, immutableChanged
+}
+
+func propertyEqual(name string, desired reflect.Value, live reflect.Value) bool {
+	if live.IsNil() {
+		return false
+	}
+
+	if d, ok := desired.Interface().(*string); ok {
+		l := live.Interface().(*string)
+
+		switch {
+		case strings.HasPrefix(name, "Forward"):
+			// the service returns the absolute URI of the entity that messages are forwarded to.
+			return forwardingTargetEqual(*d, *l)
+		case durationProperties[name]:
+			dd, dErr := parseISO8601Duration(*d)
+			ld, lErr := parseISO8601Duration(*l)
+
+			if dErr == nil && lErr == nil {
+				return dd == ld
+			}
+		}
+	}
+
+	return reflect.DeepEqual(desired.Elem().Interface(), live.Elem().Interface())
+}
+
+func forwardingTargetEqual(desired string, live string) bool {
+	trim := func(s string) string {
+		s = strings.ToLower(strings.TrimSuffix(s, "/"))
+
+		if i := strings.Index(s, "://"); i >= 0 {
+			s = s[i+3:]
+
+			if j := strings.Index(s, "/"); j >= 0 {
+				s = s[j+1:]
+			}
+		}
+
+		return s
+	}
+
+	return trim(desired) == trim(live)
+}
+
+var iso8601DurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISO8601Duration parses the durations the service uses, ex: "PT1M" or "P10675199DT2H48M5.4775807S".
+// Durations longer than a time.Duration, such as the service's maximum, are clamped to math.MaxInt64.
+func parseISO8601Duration(s string) (time.Duration, error) {
+	matches := iso8601DurationRegexp.FindStringSubmatch(s)
+
+	if matches == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("%q isn't an ISO 8601 duration", s)
+	}
+
+	var d time.Duration
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+	for i, unit := range units {
+		if matches[i+1] == "" {
+			continue
+		}
+
+		whole, fraction, _ := strings.Cut(matches[i+1], ".")
+		v, err := strconv.ParseInt(whole, 10, 64)
+
+		if err != nil || v > (math.MaxInt64-int64(d))/int64(unit) {
+			return math.MaxInt64, nil
+		}
+
+		d += time.Duration(v) * unit
+
+		if fraction != "" {
+			// only seconds have a fraction, and nanoseconds are the smallest unit of a time.Duration.
+			fraction = (fraction + "000000000")[:9]
+			ns, err := strconv.ParseInt(fraction, 10, 64)
+
+			if err != nil {
+				return 0, err
+			}
+
+			if time.Duration(ns) > math.MaxInt64-d {
+				return math.MaxInt64, nil
+			}
+
+			d += time.Duration(ns)
+		}
+	}
+
+	return d, nil
+}
+
+// diffRules returns "Filter" and/or "Action" if the rules are different. Rules are compared using
+// the XML that's sent to the service, so equivalent filters and actions are equal.
+func diffRules(desired RuleProperties, live RuleProperties) ([]string, error) {
+	var changed []string
+
+	desiredFilter, err := ruleFilterXML(desired.Filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	liveFilter, err := ruleFilterXML(live.Filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if desiredFilter != liveFilter {
+		changed = append(changed, "Filter")
+	}
+
+	desiredAction, err := ruleActionXML(desired.Action)
+
+	if err != nil {
+		return nil, err
+	}
+
+	liveAction, err := ruleActionXML(live.Action)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if desiredAction != liveAction {
+		changed = append(changed, "Action")
+	}
+
+	return changed, nil
+}
+
+func ruleFilterXML(filter RuleFilter) (string, error) {
+	fd, err := convertRuleFilterToFilterDescription(&filter)
+
+	if err != nil {
+		return "", err
+	}
+
+	sortParameters(fd.Parameters)
+	sortParameters(fd.CorrelationFilter.Properties)
+
+	b, err := xml.Marshal(fd)
+	return string(b), err
+}
+
+func ruleActionXML(action RuleAction) (string, error) {
+	ad, err := convertRuleActionToActionDescription(&action)
+
+	if err != nil || ad == nil {
+		return "", err
+	}
+
+	sortParameters(ad.Parameters)
+
+	b, err := xml.Marshal(ad)
+	return string(b), err
+}
+
+func sortParameters(params *atom.KeyValueList) {
+	if params == nil {
+		return
+	}
+
+	sort.Slice(params.KeyValues, func(i, j int) bool { return params.KeyValues[i].Key < params.KeyValues[j].Key })
+}
@@ -0,0 +1,305 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package admin
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileTopology_MergeProperties(t *testing.T) {
+	live := QueueProperties{
+		LockDuration:                     to.Ptr("PT1M"),
+		MaxDeliveryCount:                 to.Ptr(int32(10)),
+		RequiresSession:                  to.Ptr(false),
+		ForwardTo:                        to.Ptr("sb://myns.servicebus.windows.net/Target"),
+		DefaultMessageTimeToLive:         to.Ptr("P10675199DT2H48M5.4775807S"),
+		DeadLetteringOnMessageExpiration: to.Ptr(false),
+	}
+
+	desired := QueueProperties{
+		LockDuration:             to.Ptr("PT60S"),
+		MaxDeliveryCount:         to.Ptr(int32(5)),
+		ForwardTo:                to.Ptr("target"),
+		DefaultMessageTimeToLive: to.Ptr("P10675199DT2H48M5.4775807S"),
+		AuthorizationRules:       []AuthorizationRule{{KeyName: to.Ptr("ignored")}},
+	}
+
+	merged, changed, immutable := mergeProperties(desired, live, "RequiresSession")
+	require.Equal(t, []string{"MaxDeliveryCount"}, changed)
+	require.Empty(t, immutable)
+	require.Equal(t, int32(5), *merged.MaxDeliveryCount)
+	require.Equal(t, "PT1M", *merged.LockDuration, "unchanged properties keep their live value")
+	require.False(t, *merged.DeadLetteringOnMessageExpiration, "properties that aren't set keep their live value")
+	require.Empty(t, merged.AuthorizationRules)
+
+	desired.RequiresSession = to.Ptr(true)
+	_, changed, immutable = mergeProperties(desired, live, "RequiresSession")
+	require.Equal(t, []string{"RequiresSession", "MaxDeliveryCount"}, changed)
+	require.Equal(t, []string{"RequiresSession"}, immutable)
+}
+
+func TestReconcileTopology_ParseISO8601Duration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"PT1M":              time.Minute,
+		"PT60S":             time.Minute,
+		"PT1.5S":            1500 * time.Millisecond,
+		"P1D":               24 * time.Hour,
+		"P1DT2H3M4S":        26*time.Hour + 3*time.Minute + 4*time.Second,
+		"PT10M30S":          10*time.Minute + 30*time.Second,
+		"P0DT0H5M0S":        5 * time.Minute,
+		"PT0.123456789123S": 123456789 * time.Nanosecond,
+		// the service's maximum is longer than a time.Duration
+		"P10675199DT2H48M5.4775807S":   math.MaxInt64,
+		"P106751DT23H47M16.854775807S": math.MaxInt64,
+		"P106751DT23H47M16.854775808S": math.MaxInt64,
+		"P99999999999999999999D":       math.MaxInt64,
+	} {
+		d, err := parseISO8601Duration(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, d, s)
+	}
+
+	for _, s := range []string{"", "P", "PT", "1M", "PT1Y"} {
+		_, err := parseISO8601Duration(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestReconcileTopology_PropertyEqual(t *testing.T) {
+	desired := QueueProperties{
+		LockDuration:     to.Ptr("PT1M"),
+		AutoDeleteOnIdle: to.Ptr("P10675199DT2H48M5.4775807S"),
+		UserMetadata:     to.Ptr("P1D"),
+	}
+	live := QueueProperties{
+		LockDuration:     to.Ptr("PT60S"),
+		AutoDeleteOnIdle: to.Ptr("P10675199DT2H48M5.4775807S"),
+		UserMetadata:     to.Ptr("PT24H"),
+	}
+
+	// only the duration properties are compared as durations
+	_, changed, _ := mergeProperties(desired, live)
+	require.Equal(t, []string{"UserMetadata"}, changed)
+}
+
+func TestReconcileTopology_DiffRules(t *testing.T) {
+	live := RuleProperties{
+		Name: "rule",
+		Filter: &SQLFilter{
+			Expression: "color = @color AND size > @size",
+			Parameters: map[string]any{"@color": "red", "@size": int64(2)},
+		},
+		Action: &SQLAction{Expression: "SET quantity = quantity / 2"},
+	}
+
+	changed, err := diffRules(RuleProperties{
+		Name: "rule",
+		Filter: &SQLFilter{
+			Expression: "color = @color AND size > @size",
+			Parameters: map[string]any{"@size": int64(2), "@color": "red"},
+		},
+		Action: &SQLAction{Expression: "SET quantity = quantity / 2"},
+	}, live)
+	require.NoError(t, err)
+	require.Empty(t, changed)
+
+	changed, err = diffRules(RuleProperties{
+		Name:   "rule",
+		Filter: &CorrelationFilter{CorrelationID: to.Ptr("id")},
+	}, live)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Filter", "Action"}, changed)
+
+	changed, err = diffRules(RuleProperties{Name: "$Default"}, RuleProperties{Name: "$Default", Filter: &TrueFilter{}})
+	require.NoError(t, err)
+	require.Empty(t, changed, "a rule without a filter is a TrueFilter")
+}
+
+func TestReconcileTopology_Validate(t *testing.T) {
+	require.NoError(t, validateTopology(Topology{
+		Queues: []QueueTopology{{Name: "same"}},
+		Topics: []TopicTopology{{Name: "same", Subscriptions: []SubscriptionTopology{{Name: "same"}}}},
+	}))
+
+	require.ErrorContains(t, validateTopology(Topology{
+		Queues: []QueueTopology{{Name: "queue"}, {Name: "QUEUE"}},
+	}), `the queue "QUEUE" is in the topology more than once`)
+
+	require.ErrorContains(t, validateTopology(Topology{
+		Topics: []TopicTopology{{Name: "topic", Subscriptions: []SubscriptionTopology{{
+			Name:  "sub",
+			Rules: []RuleProperties{{}, {Name: "$Default"}},
+		}}}},
+	}), `the rule "topic/sub/$Default" is in the topology more than once`)
+
+	require.ErrorContains(t, validateTopology(Topology{Topics: []TopicTopology{{}}}), "a topic in the topology has no name")
+}
+
+func TestReconcileTopology_PlanCreate(t *testing.T) {
+	ac := &Client{}
+
+	changes, err := ac.planTopology(Topology{
+		Queues: []QueueTopology{
+			{Name: "forwarder", Properties: &QueueProperties{ForwardTo: to.Ptr("target")}},
+			{Name: "target"},
+		},
+		Topics: []TopicTopology{{
+			Name: "topic",
+			Subscriptions: []SubscriptionTopology{
+				{Name: "all"},
+				{Name: "none", Rules: []RuleProperties{}},
+				{Name: "filtered", Rules: []RuleProperties{
+					{Name: "red", Filter: &SQLFilter{Expression: "color = 'red'"}},
+					{Name: "blue", Filter: &CorrelationFilter{Subject: to.Ptr("blue")}},
+				}},
+			},
+		}},
+	}, &liveTopology{}, true)
+	require.NoError(t, err)
+
+	require.Equal(t, []ReconcileResult{
+		{EntityType: TopologyEntityTypeQueue, EntityPath: "target", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeTopic, EntityPath: "topic", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeSubscription, EntityPath: "topic/Subscriptions/all", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeSubscription, EntityPath: "topic/Subscriptions/none", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeRule, EntityPath: "topic/Subscriptions/none/Rules/$Default", Action: ReconcileActionDelete},
+		{EntityType: TopologyEntityTypeSubscription, EntityPath: "topic/Subscriptions/filtered", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeRule, EntityPath: "topic/Subscriptions/filtered/Rules/red", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeRule, EntityPath: "topic/Subscriptions/filtered/Rules/blue", Action: ReconcileActionCreate},
+		{EntityType: TopologyEntityTypeQueue, EntityPath: "forwarder", Action: ReconcileActionCreate},
+	}, planResults(changes))
+
+	// the first rule is created along with its subscription.
+	require.Nil(t, changes[6].apply)
+	require.Same(t, changes[5], changes[6].parent)
+	require.NotNil(t, changes[7].apply)
+}
+
+func TestReconcileTopology_PlanUpdateAndDelete(t *testing.T) {
+	ac := &Client{}
+
+	live := &liveTopology{
+		queues: map[string]*QueueItem{
+			"queue":    {QueueName: "Queue", QueueProperties: QueueProperties{MaxDeliveryCount: to.Ptr(int32(10)), RequiresSession: to.Ptr(false)}},
+			"unlisted": {QueueName: "unlisted"},
+		},
+		topics: map[string]*liveTopic{
+			"topic": {
+				item: &TopicItem{TopicName: "topic"},
+				subscriptions: map[string]*liveSubscription{
+					"sub": {
+						item: &SubscriptionPropertiesItem{TopicName: "topic", SubscriptionName: "sub", SubscriptionProperties: SubscriptionProperties{LockDuration: to.Ptr("PT1M")}},
+						rules: []RuleProperties{
+							{Name: "$Default", Filter: &TrueFilter{}},
+							{Name: "red", Filter: &SQLFilter{Expression: "color = 'red'"}},
+						},
+					},
+					"unlisted": {item: &SubscriptionPropertiesItem{TopicName: "topic", SubscriptionName: "unlisted"}},
+				},
+			},
+		},
+	}
+
+	desired := Topology{
+		Queues: []QueueTopology{{Name: "queue", Properties: &QueueProperties{MaxDeliveryCount: to.Ptr(int32(10)), RequiresSession: to.Ptr(true)}}},
+		Topics: []TopicTopology{{
+			Name: "topic",
+			Subscriptions: []SubscriptionTopology{{
+				Name:       "sub",
+				Properties: &SubscriptionProperties{LockDuration: to.Ptr("PT2M")},
+				Rules: []RuleProperties{
+					{Name: "red", Filter: &SQLFilter{Expression: "color = 'crimson'"}},
+					{Name: "blue", Filter: &SQLFilter{Expression: "color = 'blue'"}},
+				},
+			}},
+		}},
+	}
+
+	changes, err := ac.planTopology(desired, live, false)
+	require.NoError(t, err)
+
+	results := planResults(changes)
+	require.Equal(t, []ReconcileResult{
+		{EntityType: TopologyEntityTypeQueue, EntityPath: "Queue", Action: ReconcileActionUpdate, ChangedProperties: []string{"RequiresSession"}},
+		{EntityType: TopologyEntityTypeTopic, EntityPath: "topic", Action: ReconcileActionNone},
+		{EntityType: TopologyEntityTypeSubscription, EntityPath: "topic/Subscriptions/sub", Action: ReconcileActionUpdate, ChangedProperties: []string{"LockDuration"}},
+		{EntityType: TopologyEntityTypeRule, EntityPath: "topic/Subscriptions/sub/Rules/red", Action: ReconcileActionUpdate, ChangedProperties: []string{"Filter"}},
+		{EntityType: TopologyEntityTypeRule, EntityPath: "topic/Subscriptions/sub/Rules/blue", Action: ReconcileActionCreate},
+	}, results)
+
+	require.ErrorContains(t, changes[0].result.Err, "RequiresSession can't be changed after the entity is created")
+
+	changes, err = ac.planTopology(desired, live, true)
+	require.NoError(t, err)
+
+	results = planResults(changes)
+	require.Equal(t, []ReconcileResult{
+		{EntityType: TopologyEntityTypeRule, EntityPath: "topic/Subscriptions/sub/Rules/$Default", Action: ReconcileActionDelete},
+		{EntityType: TopologyEntityTypeSubscription, EntityPath: "topic/Subscriptions/unlisted", Action: ReconcileActionDelete},
+		{EntityType: TopologyEntityTypeQueue, EntityPath: "unlisted", Action: ReconcileActionDelete},
+	}, results[5:])
+}
+
+func TestReconcileTopology_SkipsChangesWhenParentFails(t *testing.T) {
+	ac := &Client{}
+
+	changes, err := ac.planTopology(Topology{
+		Topics: []TopicTopology{{Name: "topic", Subscriptions: []SubscriptionTopology{{Name: "sub"}}}},
+	}, &liveTopology{}, false)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	var applied []string
+
+	for _, c := range changes {
+		path := c.result.EntityPath
+		c.apply = func(ctx context.Context) error {
+			applied = append(applied, path)
+			return nil
+		}
+	}
+
+	// an invalid topic property is reported before anything is sent.
+	changes[0].result.Err = immutableError([]string{"EnablePartitioning"})
+
+	applyChanges(context.Background(), changes, false)
+	require.Empty(t, applied)
+	require.False(t, changes[1].result.Applied)
+	require.EqualError(t, changes[1].result.Err, `skipped, because the change to topic "topic" wasn't made`)
+
+	changes[0].result.Err = nil
+	changes[1].result.Err = nil
+
+	applyChanges(context.Background(), changes, true)
+	require.Empty(t, applied, "a dry run doesn't make changes")
+
+	applyChanges(context.Background(), changes, false)
+	require.Equal(t, []string{"topic", "topic/Subscriptions/sub"}, applied)
+	require.True(t, changes[0].result.Applied)
+	require.True(t, changes[1].result.Applied)
+}
+
+func TestReconcileTopology_ForwardingTargetEqual(t *testing.T) {
+	require.True(t, forwardingTargetEqual("target", "sb://myns.servicebus.windows.net/Target"))
+	require.True(t, forwardingTargetEqual("topic/subscriptions/sub", "https://myns.servicebus.windows.net/topic/Subscriptions/sub/"))
+	require.False(t, forwardingTargetEqual("other", "sb://myns.servicebus.windows.net/target"))
+}
+
+func planResults(changes []*plannedChange) []ReconcileResult {
+	var results []ReconcileResult
+
+	for _, c := range changes {
+		r := *c.result
+		r.Err = nil
+		results = append(results, r)
+	}
+
+	return results
+}
@@ -0,0 +1,326 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package claimcheck implements the claim-check pattern for Service Bus messages that are too
+// large to send. The body of a large message is uploaded to an Azure Blob Storage container,
+// and the message is sent with a reference to the blob in its application properties. When the
+// message is received, the body is downloaded from the blob.
+//
+// [Sender] and [Receiver] wrap an [azservicebus.Sender] and an [azservicebus.Receiver]. [Store]
+// can also be used on its own, ex: with an [azservicebus.Processor], or to add messages to an
+// [azservicebus.MessageBatch].
+//
+// Blobs aren't deleted automatically if a message isn't received, or when a message is dead-lettered.
+// Use a lifecycle management policy on the container to delete old blobs.
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+const (
+	// BlobNameProperty is the application property that holds the name of the blob that contains
+	// the message body.
+	BlobNameProperty = "claimcheck-blob-name"
+
+	// BodySizeProperty is the application property that holds the size, in bytes, of the message
+	// body that's stored in the blob.
+	BodySizeProperty = "claimcheck-body-size"
+
+	// DefaultThreshold is the default size, in bytes, above which message bodies are stored in a
+	// blob. It leaves room for the message's properties within the 256KB message size of the
+	// Standard tier.
+	DefaultThreshold = 192 * 1024
+)
+
+// Store stores message bodies in an Azure Blob Storage container.
+type Store struct {
+	cc        *container.Client
+	threshold int
+}
+
+// StoreOptions contains optional parameters for NewStore.
+type StoreOptions struct {
+	// Threshold is the size, in bytes, above which message bodies are stored in a blob.
+	// Defaults to DefaultThreshold.
+	Threshold int
+}
+
+// NewStore creates a Store that stores message bodies in a container.
+// NOTE: the container must exist before the store can be used.
+func NewStore(containerClient *container.Client, options *StoreOptions) *Store {
+	if options == nil {
+		options = &StoreOptions{}
+	}
+
+	threshold := options.Threshold
+
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	return &Store{cc: containerClient, threshold: threshold}
+}
+
+// Offload stores the body of the message in a blob, if it's larger than the threshold. It returns
+// a copy of the message with an empty body and a reference to the blob, or the message itself if
+// it's small enough to send as is. The message passed in isn't modified.
+func (s *Store) Offload(ctx context.Context, message *azservicebus.Message) (*azservicebus.Message, error) {
+	if len(message.Body) <= s.threshold {
+		return message, nil
+	}
+
+	id, err := uuid.New()
+
+	if err != nil {
+		return nil, err
+	}
+
+	blobName := id.String()
+
+	_, err = s.cc.NewBlockBlobClient(blobName).UploadBuffer(ctx, message.Body, &blockblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: message.ContentType},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload the message body to blob %q: %w", blobName, err)
+	}
+
+	offloaded := *message
+	offloaded.Body = []byte{}
+	offloaded.ApplicationProperties = make(map[string]any, len(message.ApplicationProperties)+2)
+
+	for k, v := range message.ApplicationProperties {
+		offloaded.ApplicationProperties[k] = v
+	}
+
+	offloaded.ApplicationProperties[BlobNameProperty] = blobName
+	offloaded.ApplicationProperties[BodySizeProperty] = int64(len(message.Body))
+
+	return &offloaded, nil
+}
+
+// Rehydrate downloads the body of a message that was sent with Offload, and replaces the message's
+// body with it. Messages that don't reference a blob aren't changed.
+func (s *Store) Rehydrate(ctx context.Context, message *azservicebus.ReceivedMessage) error {
+	blobName, ok := BlobName(message)
+
+	if !ok {
+		return nil
+	}
+
+	resp, err := s.cc.NewBlobClient(blobName).DownloadStream(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to download the message body from blob %q: %w", blobName, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return fmt.Errorf("failed to download the message body from blob %q: %w", blobName, err)
+	}
+
+	if size, ok := message.ApplicationProperties[BodySizeProperty].(int64); ok && size != int64(len(body)) {
+		return fmt.Errorf("blob %q has %d bytes, but the message body had %d bytes", blobName, len(body), size)
+	}
+
+	message.Body = body
+	return nil
+}
+
+// Delete deletes the blob that a message references. It does nothing for messages that don't
+// reference a blob, or if the blob was already deleted.
+func (s *Store) Delete(ctx context.Context, message *azservicebus.ReceivedMessage) error {
+	blobName, ok := BlobName(message)
+
+	if !ok {
+		return nil
+	}
+
+	return s.deleteBlob(ctx, blobName)
+}
+
+func (s *Store) deleteBlob(ctx context.Context, blobName string) error {
+	_, err := s.cc.NewBlobClient(blobName).Delete(ctx, &blob.DeleteOptions{
+		DeleteSnapshots: to.Ptr(blob.DeleteSnapshotsOptionTypeInclude),
+	})
+
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("failed to delete blob %q: %w", blobName, err)
+	}
+
+	return nil
+}
+
+// BlobName returns the name of the blob that contains the message body, if the message was sent
+// with Offload.
+func BlobName(message *azservicebus.ReceivedMessage) (string, bool) {
+	blobName, ok := message.ApplicationProperties[BlobNameProperty].(string)
+	return blobName, ok && blobName != ""
+}
+
+// Sender sends messages with an azservicebus.Sender, storing large message bodies in a Store.
+type Sender struct {
+	sender *azservicebus.Sender
+	store  *Store
+}
+
+// NewSender creates a Sender.
+func NewSender(sender *azservicebus.Sender, store *Store) *Sender {
+	return &Sender{sender: sender, store: store}
+}
+
+// SendMessage sends a message, storing its body in a blob if it's larger than the store's threshold.
+// If the message can't be sent, the blob is deleted.
+func (s *Sender) SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error {
+	offloaded, err := s.store.Offload(ctx, message)
+
+	if err != nil {
+		return err
+	}
+
+	if err := s.sender.SendMessage(ctx, offloaded, options); err != nil {
+		return s.deleteOffloaded(ctx, message, offloaded, err)
+	}
+
+	return nil
+}
+
+// AddMessage adds a message to a batch, storing its body in a blob if it's larger than the store's
+// threshold. If the message doesn't fit in the batch, the blob is deleted and the error is
+// azservicebus.ErrMessageTooLarge, as it is for MessageBatch.AddMessage.
+//
+// The blobs aren't deleted if the batch can't be sent.
+func (s *Sender) AddMessage(ctx context.Context, batch *azservicebus.MessageBatch, message *azservicebus.Message, options *azservicebus.AddMessageOptions) error {
+	offloaded, err := s.store.Offload(ctx, message)
+
+	if err != nil {
+		return err
+	}
+
+	if err := batch.AddMessage(offloaded, options); err != nil {
+		return s.deleteOffloaded(ctx, message, offloaded, err)
+	}
+
+	return nil
+}
+
+// deleteOffloaded deletes the blob for a message that wasn't sent, and returns the original error.
+func (s *Sender) deleteOffloaded(ctx context.Context, message *azservicebus.Message, offloaded *azservicebus.Message, sendErr error) error {
+	if offloaded == message {
+		return sendErr
+	}
+
+	if err := s.store.deleteBlob(ctx, offloaded.ApplicationProperties[BlobNameProperty].(string)); err != nil {
+		return errors.Join(sendErr, err)
+	}
+
+	return sendErr
+}
+
+// Receiver receives messages with an azservicebus.Receiver, downloading the bodies that are stored
+// in a Store. Use the azservicebus.Receiver to abandon, defer or dead-letter messages.
+type Receiver struct {
+	receiver         *azservicebus.Receiver
+	store            *Store
+	deleteOnComplete bool
+}
+
+// ReceiverOptions contains optional parameters for NewReceiver.
+type ReceiverOptions struct {
+	// DeleteBlobOnComplete deletes a message's blob after the message is completed with
+	// Receiver.CompleteMessage.
+	DeleteBlobOnComplete bool
+}
+
+// NewReceiver creates a Receiver.
+func NewReceiver(receiver *azservicebus.Receiver, store *Store, options *ReceiverOptions) *Receiver {
+	if options == nil {
+		options = &ReceiverOptions{}
+	}
+
+	return &Receiver{
+		receiver:         receiver,
+		store:            store,
+		deleteOnComplete: options.DeleteBlobOnComplete,
+	}
+}
+
+// ReceiveMessages receives messages, and downloads the bodies that are stored in blobs.
+//
+// Messages whose body can't be downloaded aren't returned. Instead, the error has a [*RehydrateError]
+// for each of them, which holds the message, and they're abandoned so they're received again later.
+// Messages received in [azservicebus.ReceiveModeReceiveAndDelete] can't be abandoned, so the
+// RehydrateError has the only copy of the message. The other messages are returned, along with the error.
+func (r *Receiver) ReceiveMessages(ctx context.Context, maxMessages int, options *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error) {
+	messages, err := r.receiver.ReceiveMessages(ctx, maxMessages, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rehydrated []*azservicebus.ReceivedMessage
+	var errs []error
+
+	for _, m := range messages {
+		if err := r.store.Rehydrate(ctx, m); err != nil {
+			errs = append(errs, &RehydrateError{Message: m, Err: err})
+
+			if err := r.receiver.AbandonMessage(ctx, m, nil); err != nil {
+				errs = append(errs, err)
+			}
+
+			continue
+		}
+
+		rehydrated = append(rehydrated, m)
+	}
+
+	return rehydrated, errors.Join(errs...)
+}
+
+// RehydrateError is returned by [Receiver.ReceiveMessages] for a message whose body couldn't be
+// downloaded. Use [errors.As] to get it from the error.
+type RehydrateError struct {
+	// Message is the received message, with an empty body and the reference to its blob.
+	Message *azservicebus.ReceivedMessage
+
+	// Err is the error returned by [Store.Rehydrate].
+	Err error
+}
+
+func (e *RehydrateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RehydrateError) Unwrap() error {
+	return e.Err
+}
+
+// CompleteMessage completes a message and, if ReceiverOptions.DeleteBlobOnComplete is true, deletes
+// the message's blob.
+func (r *Receiver) CompleteMessage(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.CompleteMessageOptions) error {
+	if err := r.receiver.CompleteMessage(ctx, message, options); err != nil {
+		return err
+	}
+
+	if r.deleteOnComplete {
+		return r.store.Delete(ctx, message)
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package claimcheck_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/claimcheck"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/emulator"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimCheck_SendAndReceive(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	client := newEmulatorClient(t, "queue")
+
+	azSender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	sender := claimcheck.NewSender(azSender, store)
+
+	large := bytes.Repeat([]byte("a"), 300*1024)
+	message := &azservicebus.Message{
+		Body:                  large,
+		ContentType:           to.Ptr("text/plain"),
+		ApplicationProperties: map[string]any{"kind": "large"},
+	}
+
+	require.NoError(t, sender.SendMessage(context.Background(), message, nil))
+	require.NoError(t, sender.SendMessage(context.Background(), &azservicebus.Message{Body: []byte("small")}, nil))
+
+	require.Equal(t, large, message.Body, "the message that's passed in isn't modified")
+	require.Equal(t, map[string]any{"kind": "large"}, message.ApplicationProperties)
+	require.Len(t, blobs.names(), 1)
+
+	azReceiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	receiver := claimcheck.NewReceiver(azReceiver, store, &claimcheck.ReceiverOptions{DeleteBlobOnComplete: true})
+
+	messages, err := receiver.ReceiveMessages(context.Background(), 2, nil)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+
+	require.Equal(t, large, messages[0].Body)
+	require.Equal(t, "large", messages[0].ApplicationProperties["kind"])
+	require.Equal(t, int64(len(large)), messages[0].ApplicationProperties[claimcheck.BodySizeProperty])
+	blobName, ok := claimcheck.BlobName(messages[0])
+	require.True(t, ok)
+	require.Equal(t, []string{blobName}, blobs.names())
+	require.Equal(t, "text/plain", blobs.contentTypes[blobName])
+
+	require.Equal(t, []byte("small"), messages[1].Body)
+	_, ok = claimcheck.BlobName(messages[1])
+	require.False(t, ok)
+
+	for _, m := range messages {
+		require.NoError(t, receiver.CompleteMessage(context.Background(), m, nil))
+	}
+
+	require.Empty(t, blobs.names())
+}
+
+func TestClaimCheck_BlobDeletedWhenMessageDoesNotFit(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	client := newEmulatorClient(t, "queue")
+
+	azSender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	sender := claimcheck.NewSender(azSender, store)
+
+	batch, err := azSender.NewMessageBatch(context.Background(), &azservicebus.MessageBatchOptions{MaxBytes: 2048})
+	require.NoError(t, err)
+
+	// the body is offloaded, but the message's properties are still too large for the batch.
+	err = sender.AddMessage(context.Background(), batch, &azservicebus.Message{
+		Body:                  bytes.Repeat([]byte("a"), 4096),
+		ApplicationProperties: map[string]any{"padding": strings.Repeat("p", 4096)},
+	}, nil)
+	require.ErrorIs(t, err, azservicebus.ErrMessageTooLarge)
+	require.Empty(t, blobs.names())
+
+	require.NoError(t, sender.AddMessage(context.Background(), batch, &azservicebus.Message{Body: bytes.Repeat([]byte("a"), 4096)}, nil))
+	require.Len(t, blobs.names(), 1)
+	require.NoError(t, azSender.SendMessageBatch(context.Background(), batch, nil))
+}
+
+func TestClaimCheck_AbandonsMessagesThatCannotBeRehydrated(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	client := newEmulatorClient(t, "queue")
+
+	azSender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	sender := claimcheck.NewSender(azSender, store)
+	require.NoError(t, sender.SendMessage(context.Background(), &azservicebus.Message{Body: bytes.Repeat([]byte("a"), 4096)}, nil))
+	require.NoError(t, sender.SendMessage(context.Background(), &azservicebus.Message{Body: []byte("small")}, nil))
+
+	for _, name := range blobs.names() {
+		blobs.remove(name)
+	}
+
+	azReceiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	receiver := claimcheck.NewReceiver(azReceiver, store, nil)
+
+	messages, err := receiver.ReceiveMessages(context.Background(), 2, nil)
+	require.ErrorContains(t, err, "failed to download the message body")
+	require.Len(t, messages, 1)
+	require.Equal(t, []byte("small"), messages[0].Body)
+
+	var rehydrateErr *claimcheck.RehydrateError
+	require.ErrorAs(t, err, &rehydrateErr)
+	_, ok := claimcheck.BlobName(rehydrateErr.Message)
+	require.True(t, ok)
+
+	// the message was abandoned, so it's available again right away.
+	redelivered, err := azReceiver.ReceiveMessages(context.Background(), 1, nil)
+	require.NoError(t, err)
+	require.Len(t, redelivered, 1)
+	require.Equal(t, uint32(2), redelivered[0].DeliveryCount)
+	require.Empty(t, redelivered[0].Body)
+}
+
+func TestClaimCheck_ReturnsReceiveAndDeleteMessagesThatCannotBeRehydrated(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), &claimcheck.StoreOptions{Threshold: 1024})
+	client := newEmulatorClient(t, "queue")
+
+	azSender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	sender := claimcheck.NewSender(azSender, store)
+	large := bytes.Repeat([]byte("a"), 4096)
+	require.NoError(t, sender.SendMessage(context.Background(), &azservicebus.Message{Body: large}, nil))
+
+	blobNames := blobs.names()
+	require.Len(t, blobNames, 1)
+	blobs.remove(blobNames[0])
+
+	azReceiver, err := client.NewReceiverForQueue("queue", &azservicebus.ReceiverOptions{ReceiveMode: azservicebus.ReceiveModeReceiveAndDelete})
+	require.NoError(t, err)
+
+	receiver := claimcheck.NewReceiver(azReceiver, store, nil)
+
+	messages, err := receiver.ReceiveMessages(context.Background(), 1, nil)
+	require.Empty(t, messages)
+
+	// the message was deleted when it was received, so the error has the only copy.
+	var rehydrateErr *claimcheck.RehydrateError
+	require.ErrorAs(t, err, &rehydrateErr)
+	require.Empty(t, rehydrateErr.Message.Body)
+
+	blobName, ok := claimcheck.BlobName(rehydrateErr.Message)
+	require.True(t, ok)
+	require.Equal(t, blobNames[0], blobName)
+
+	// the body can be downloaded again once the blob is available.
+	blobs.mu.Lock()
+	blobs.blobs[blobName] = large
+	blobs.mu.Unlock()
+	require.NoError(t, store.Rehydrate(context.Background(), rehydrateErr.Message))
+	require.Equal(t, large, rehydrateErr.Message.Body)
+}
+
+func TestClaimCheck_Delete(t *testing.T) {
+	blobs := &fakeBlobTransport{blobs: map[string][]byte{}}
+	store := claimcheck.NewStore(newContainerClient(t, blobs), nil)
+
+	offloaded, err := store.Offload(context.Background(), &azservicebus.Message{Body: bytes.Repeat([]byte("a"), claimcheck.DefaultThreshold+1)})
+	require.NoError(t, err)
+	require.Empty(t, offloaded.Body)
+	require.Len(t, blobs.names(), 1)
+
+	received := &azservicebus.ReceivedMessage{ApplicationProperties: offloaded.ApplicationProperties}
+	require.NoError(t, store.Delete(context.Background(), received))
+	require.Empty(t, blobs.names())
+
+	// deleting a blob that's already gone isn't an error.
+	require.NoError(t, store.Delete(context.Background(), received))
+	require.NoError(t, store.Delete(context.Background(), &azservicebus.ReceivedMessage{}))
+}
+
+func newEmulatorClient(t *testing.T, queueName string) *azservicebus.Client {
+	emu, err := emulator.New(nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = emu.Close() })
+
+	require.NoError(t, emu.CreateQueue(queueName, &emulator.QueueProperties{LockDuration: time.Minute}))
+
+	client, err := emu.NewClient(nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close(context.Background()) })
+
+	return client
+}
+
+func newContainerClient(t *testing.T, transport *fakeBlobTransport) *container.Client {
+	cc, err := container.NewClientWithNoCredential("https://account.blob.core.windows.net/claimchecks", &container.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: transport,
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	require.NoError(t, err)
+	return cc
+}
+
+// fakeBlobTransport is an in-memory blob container that supports uploading, downloading and
+// deleting block blobs.
+type fakeBlobTransport struct {
+	mu           sync.Mutex
+	blobs        map[string][]byte
+	contentTypes map[string]string
+}
+
+func (f *fakeBlobTransport) Do(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.TrimPrefix(req.URL.Path, "/claimchecks/")
+	header := http.Header{}
+	header.Set("ETag", `"0x1"`)
+	header.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+	switch req.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(req.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if f.contentTypes == nil {
+			f.contentTypes = map[string]string{}
+		}
+
+		f.blobs[name] = body
+		// the blob client sets the header without canonicalizing its name.
+		f.contentTypes[name] = strings.Join(req.Header["x-ms-blob-content-type"], "")
+		return newFakeResponse(req, http.StatusCreated, header, nil), nil
+	case http.MethodGet:
+		body, ok := f.blobs[name]
+
+		if !ok {
+			return newBlobNotFoundResponse(req), nil
+		}
+
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		return newFakeResponse(req, http.StatusOK, header, body), nil
+	case http.MethodDelete:
+		if _, ok := f.blobs[name]; !ok {
+			return newBlobNotFoundResponse(req), nil
+		}
+
+		delete(f.blobs, name)
+		return newFakeResponse(req, http.StatusAccepted, header, nil), nil
+	}
+
+	return nil, errors.New("unsupported method " + req.Method)
+}
+
+func (f *fakeBlobTransport) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+
+	for name := range f.blobs {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func (f *fakeBlobTransport) remove(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.blobs, name)
+}
+
+func newBlobNotFoundResponse(req *http.Request) *http.Response {
+	header := http.Header{}
+	header.Set("x-ms-error-code", "BlobNotFound")
+	return newFakeResponse(req, http.StatusNotFound, header, nil)
+}
+
+func newFakeResponse(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,535 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// DeadLetterQueueOptions contains options for the [Client.NewDeadLetterQueueForQueue] or
+// [Client.NewDeadLetterQueueForSubscription] functions.
+type DeadLetterQueueOptions struct {
+	// ResubmitTo is the queue or topic that messages are resubmitted to.
+	//
+	// Defaults to the queue for [Client.NewDeadLetterQueueForQueue], and the topic for
+	// [Client.NewDeadLetterQueueForSubscription]. Messages resubmitted to a topic are delivered to
+	// every subscription with a matching rule, not just the subscription they were dead-lettered from.
+	ResubmitTo string
+
+	// SubQueue selects the dead letter queue to work with. Defaults to [SubQueueDeadLetter].
+	// Use [SubQueueTransfer] to work with the transfer dead letter queue.
+	SubQueue SubQueue
+}
+
+// DeadLetterQueue inspects messages in the dead letter queue of a queue or subscription and
+// resubmits them to their original entity.
+//
+// Create a DeadLetterQueue using [Client.NewDeadLetterQueueForQueue] or [Client.NewDeadLetterQueueForSubscription].
+type DeadLetterQueue struct {
+	receiver dlqReceiver
+	sender   dlqSender
+}
+
+// dlqReceiver is the subset of [Receiver] that the DeadLetterQueue uses.
+// It's an interface here to make testing easier.
+type dlqReceiver interface {
+	PeekMessages(ctx context.Context, maxMessageCount int, options *PeekMessagesOptions) ([]*ReceivedMessage, error)
+	ReceiveMessages(ctx context.Context, maxMessages int, options *ReceiveMessagesOptions) ([]*ReceivedMessage, error)
+	CompleteMessage(ctx context.Context, message *ReceivedMessage, options *CompleteMessageOptions) error
+	AbandonMessage(ctx context.Context, message *ReceivedMessage, options *AbandonMessageOptions) error
+	Close(ctx context.Context) error
+}
+
+// dlqSender is the subset of [Sender] that the DeadLetterQueue uses.
+// It's an interface here to make testing easier.
+type dlqSender interface {
+	NewMessageBatch(ctx context.Context, options *MessageBatchOptions) (*MessageBatch, error)
+	SendMessageBatch(ctx context.Context, batch *MessageBatch, options *SendMessageBatchOptions) error
+	Close(ctx context.Context) error
+}
+
+// NewDeadLetterQueueForQueue creates a DeadLetterQueue for a queue's dead letter queue.
+func (client *Client) NewDeadLetterQueueForQueue(queueName string, options *DeadLetterQueueOptions) (*DeadLetterQueue, error) {
+	return client.newDeadLetterQueue(entity{Queue: queueName}, queueName, options)
+}
+
+// NewDeadLetterQueueForSubscription creates a DeadLetterQueue for a subscription's dead letter queue.
+func (client *Client) NewDeadLetterQueueForSubscription(topicName string, subscriptionName string, options *DeadLetterQueueOptions) (*DeadLetterQueue, error) {
+	return client.newDeadLetterQueue(entity{Topic: topicName, Subscription: subscriptionName}, topicName, options)
+}
+
+func (client *Client) newDeadLetterQueue(e entity, resubmitTo string, options *DeadLetterQueueOptions) (*DeadLetterQueue, error) {
+	subQueue := SubQueueDeadLetter
+
+	if options != nil {
+		if options.ResubmitTo != "" {
+			resubmitTo = options.ResubmitTo
+		}
+
+		if options.SubQueue != 0 {
+			subQueue = options.SubQueue
+		}
+	}
+
+	receiverOptions := &ReceiverOptions{
+		ReceiveMode: ReceiveModePeekLock,
+		SubQueue:    subQueue,
+	}
+
+	var receiver *Receiver
+	var err error
+
+	if e.Queue != "" {
+		receiver, err = client.NewReceiverForQueue(e.Queue, receiverOptions)
+	} else {
+		receiver, err = client.NewReceiverForSubscription(e.Topic, e.Subscription, receiverOptions)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := client.NewSender(resubmitTo, nil)
+
+	if err != nil {
+		_ = receiver.Close(context.Background())
+		return nil, err
+	}
+
+	return &DeadLetterQueue{
+		receiver: receiver,
+		sender:   sender,
+	}, nil
+}
+
+// DeadLetterFilter selects messages in a dead letter queue. A message must match every
+// field that is set.
+type DeadLetterFilter struct {
+	// DeadLetterReason matches messages whose [ReceivedMessage.DeadLetterReason] is equal to this value.
+	DeadLetterReason *string
+
+	// ApplicationProperties matches messages that have each of these application properties,
+	// with an equal value.
+	ApplicationProperties map[string]any
+
+	// EnqueuedAfter matches messages with an [ReceivedMessage.EnqueuedTime] after this time.
+	EnqueuedAfter *time.Time
+
+	// EnqueuedBefore matches messages with an [ReceivedMessage.EnqueuedTime] before this time.
+	EnqueuedBefore *time.Time
+
+	// Match, if set, is called for messages that match the other fields. It returns true if
+	// the message should be selected.
+	Match func(msg *ReceivedMessage) bool
+}
+
+func (f *DeadLetterFilter) matches(msg *ReceivedMessage) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.DeadLetterReason != nil && (msg.DeadLetterReason == nil || *msg.DeadLetterReason != *f.DeadLetterReason) {
+		return false
+	}
+
+	for k, v := range f.ApplicationProperties {
+		actual, ok := msg.ApplicationProperties[k]
+
+		if !ok || !reflect.DeepEqual(actual, v) {
+			return false
+		}
+	}
+
+	if f.EnqueuedAfter != nil && (msg.EnqueuedTime == nil || !msg.EnqueuedTime.After(*f.EnqueuedAfter)) {
+		return false
+	}
+
+	if f.EnqueuedBefore != nil && (msg.EnqueuedTime == nil || !msg.EnqueuedTime.Before(*f.EnqueuedBefore)) {
+		return false
+	}
+
+	if f.Match != nil && !f.Match(msg) {
+		return false
+	}
+
+	return true
+}
+
+// PeekDeadLetterMessagesOptions contains optional parameters for the [DeadLetterQueue.NewPeekMessagesPager] function.
+type PeekDeadLetterMessagesOptions struct {
+	// Filter selects the messages that are returned. If nil, all messages are returned.
+	Filter *DeadLetterFilter
+
+	// FromSequenceNumber is the sequence number to start with when peeking messages.
+	FromSequenceNumber *int64
+
+	// PageSize is the number of messages to peek, from the dead letter queue, for each page.
+	// Pages can contain fewer messages than this, since messages are filtered after they are peeked.
+	//
+	// Defaults to 100.
+	PageSize int
+}
+
+// PeekDeadLetterMessagesResponse contains a page of messages returned by the pager from [DeadLetterQueue.NewPeekMessagesPager].
+type PeekDeadLetterMessagesResponse struct {
+	// Messages are the messages in this page that matched the filter.
+	Messages []*ReceivedMessage
+}
+
+// NewPeekMessagesPager creates a pager that peeks through the dead letter queue, returning messages that match
+// the filter. Peeking does not lock or remove messages.
+//
+// Call [runtime.Pager.NextPage] until [runtime.Pager.More] returns false.
+func (q *DeadLetterQueue) NewPeekMessagesPager(options *PeekDeadLetterMessagesOptions) *runtime.Pager[PeekDeadLetterMessagesResponse] {
+	if options == nil {
+		options = &PeekDeadLetterMessagesOptions{}
+	}
+
+	pageSize := 100
+
+	if options.PageSize > 0 {
+		pageSize = options.PageSize
+	}
+
+	var nextSequenceNumber int64
+
+	if options.FromSequenceNumber != nil {
+		nextSequenceNumber = *options.FromSequenceNumber
+	}
+
+	filter := options.Filter
+	done := false
+
+	return runtime.NewPager(runtime.PagingHandler[PeekDeadLetterMessagesResponse]{
+		More: func(PeekDeadLetterMessagesResponse) bool {
+			return !done
+		},
+		Fetcher: func(ctx context.Context, _ *PeekDeadLetterMessagesResponse) (PeekDeadLetterMessagesResponse, error) {
+			peeked, err := q.receiver.PeekMessages(ctx, pageSize, &PeekMessagesOptions{
+				FromSequenceNumber: &nextSequenceNumber,
+			})
+
+			if err != nil {
+				return PeekDeadLetterMessagesResponse{}, err
+			}
+
+			if len(peeked) == 0 {
+				done = true
+				return PeekDeadLetterMessagesResponse{}, nil
+			}
+
+			if last := peeked[len(peeked)-1]; last.SequenceNumber != nil {
+				nextSequenceNumber = *last.SequenceNumber + 1
+			} else {
+				done = true
+			}
+
+			var resp PeekDeadLetterMessagesResponse
+
+			for _, msg := range peeked {
+				if filter.matches(msg) {
+					resp.Messages = append(resp.Messages, msg)
+				}
+			}
+
+			return resp, nil
+		},
+	})
+}
+
+// ResubmitMessagesOptions contains optional parameters for the [DeadLetterQueue.ResubmitMessages] function.
+type ResubmitMessagesOptions struct {
+	// Filter selects the messages that are resubmitted. If nil, all messages are resubmitted.
+	Filter *DeadLetterFilter
+
+	// Transform, if set, is called with each message before it's resubmitted. It can modify
+	// resubmit, which starts as a copy created by [ReceivedMessage.ResubmittableMessage].
+	//
+	// If Transform returns an error, ResubmitMessages stops and returns the error. Messages that
+	// haven't been resubmitted are left in the dead letter queue.
+	Transform func(msg *ReceivedMessage, resubmit *AMQPAnnotatedMessage) error
+
+	// MaxMessages is the maximum number of messages to resubmit. If 0, all matching messages are resubmitted.
+	MaxMessages int
+
+	// ReceiveBatchSize is the maximum number of messages received from the dead letter queue at a time.
+	//
+	// Defaults to 100.
+	ReceiveBatchSize int
+
+	// IdleTimeout is the amount of time to wait for more messages from the dead letter queue before
+	// ResubmitMessages considers it empty.
+	//
+	// Defaults to 5 seconds.
+	IdleTimeout time.Duration
+}
+
+// ResubmitMessagesResponse contains the results of [DeadLetterQueue.ResubmitMessages].
+type ResubmitMessagesResponse struct {
+	// Resubmitted is the number of messages that were resubmitted and removed from the dead letter queue.
+	Resubmitted int
+
+	// Skipped is the number of messages that didn't match the filter, and were left in the dead letter queue.
+	Skipped int
+}
+
+// ResubmitMessages receives messages from the dead letter queue and sends the messages that match
+// the filter to the ResubmitTo entity, in batches. A dead-lettered message is only completed after
+// its copy has been sent, so a failure can cause a message to be resubmitted more than once, but
+// never lost.
+//
+// Messages that don't match the filter stay locked until ResubmitMessages returns, so they aren't
+// received again, and are then abandoned. Use MaxMessages to keep each call short enough to finish
+// within the lock duration of the queue or subscription.
+//
+// If the entity has duplicate detection enabled, resubmitted messages with a MessageID still inside
+// the duplicate detection window are discarded by the service. Use Transform to assign a new MessageID.
+//
+// If the operation fails the response contains the counts from before the failure, and the error can
+// be an [*Error] type if the failure is actionable.
+func (q *DeadLetterQueue) ResubmitMessages(ctx context.Context, options *ResubmitMessagesOptions) (ResubmitMessagesResponse, error) {
+	if options == nil {
+		options = &ResubmitMessagesOptions{}
+	}
+
+	batchSize := 100
+
+	if options.ReceiveBatchSize > 0 {
+		batchSize = options.ReceiveBatchSize
+	}
+
+	idleTimeout := 5 * time.Second
+
+	if options.IdleTimeout > 0 {
+		idleTimeout = options.IdleTimeout
+	}
+
+	var resp ResubmitMessagesResponse
+	var skipped []*ReceivedMessage
+
+	defer func() {
+		q.abandonAll(skipped)
+	}()
+
+	for options.MaxMessages <= 0 || resp.Resubmitted < options.MaxMessages {
+		maxMessages := batchSize
+
+		if options.MaxMessages > 0 {
+			maxMessages = min(maxMessages, options.MaxMessages-resp.Resubmitted)
+		}
+
+		received, err := q.receiveBatch(ctx, maxMessages, idleTimeout)
+
+		if err != nil {
+			return resp, err
+		}
+
+		if len(received) == 0 {
+			break
+		}
+
+		var toResubmit []*ReceivedMessage
+		var copies []*AMQPAnnotatedMessage
+
+		for i, msg := range received {
+			if !options.Filter.matches(msg) {
+				skipped = append(skipped, msg)
+				resp.Skipped++
+				continue
+			}
+
+			resubmit := msg.ResubmittableMessage()
+
+			if options.Transform != nil {
+				if err := options.Transform(msg, resubmit); err != nil {
+					q.abandonAll(toResubmit)
+					q.abandonAll(received[i:])
+					return resp, err
+				}
+			}
+
+			toResubmit = append(toResubmit, msg)
+			copies = append(copies, resubmit)
+		}
+
+		resubmitted, err := q.resubmit(ctx, toResubmit, copies)
+		resp.Resubmitted += resubmitted
+
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+// Close closes the DeadLetterQueue's receiver and sender.
+func (q *DeadLetterQueue) Close(ctx context.Context) error {
+	return errors.Join(q.receiver.Close(ctx), q.sender.Close(ctx))
+}
+
+// receiveBatch receives up to maxMessages, returning an empty slice if none arrive within idleTimeout.
+func (q *DeadLetterQueue) receiveBatch(ctx context.Context, maxMessages int, idleTimeout time.Duration) ([]*ReceivedMessage, error) {
+	idleCtx, cancel := context.WithTimeout(ctx, idleTimeout)
+	defer cancel()
+
+	received, err := q.receiver.ReceiveMessages(idleCtx, maxMessages, nil)
+
+	if err != nil && ctx.Err() == nil && idleCtx.Err() != nil {
+		return nil, nil
+	}
+
+	return received, err
+}
+
+// resubmit sends copies in as few batches as possible, completing the original messages after each batch is sent.
+// It returns the number of messages that were sent and completed.
+func (q *DeadLetterQueue) resubmit(ctx context.Context, originals []*ReceivedMessage, copies []*AMQPAnnotatedMessage) (int, error) {
+	resubmitted := 0
+	start := 0
+
+	for start < len(copies) {
+		batch, err := q.sender.NewMessageBatch(ctx, nil)
+
+		if err != nil {
+			q.abandonAll(originals[start:])
+			return resubmitted, err
+		}
+
+		end := start
+
+		for end < len(copies) {
+			err := batch.AddAMQPAnnotatedMessage(copies[end], nil)
+
+			if errors.Is(err, ErrMessageTooLarge) && batch.NumMessages() > 0 {
+				break
+			}
+
+			if err != nil {
+				q.abandonAll(originals[start:])
+				return resubmitted, fmt.Errorf("failed to add message %q to batch: %w", originals[end].MessageID, err)
+			}
+
+			end++
+		}
+
+		if err := q.sender.SendMessageBatch(ctx, batch, nil); err != nil {
+			q.abandonAll(originals[start:])
+			return resubmitted, err
+		}
+
+		for i := start; i < end; i++ {
+			// the copy has already been sent, so a failure here means the message will be
+			// resubmitted again, the next time it's received.
+			if err := q.receiver.CompleteMessage(ctx, originals[i], nil); err != nil {
+				q.abandonAll(originals[i+1:])
+				return resubmitted, err
+			}
+
+			resubmitted++
+		}
+
+		start = end
+	}
+
+	return resubmitted, nil
+}
+
+// abandonAll abandons messages so they're immediately available in the dead letter queue again,
+// rather than waiting for their locks to expire. Failures are ignored since the lock will expire anyways.
+func (q *DeadLetterQueue) abandonAll(messages []*ReceivedMessage) {
+	if len(messages) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+
+	for _, msg := range messages {
+		_ = q.receiver.AbandonMessage(ctx, msg, nil)
+	}
+}
+
+// resubmitExcludedAnnotations are message annotations that are assigned by Service Bus when a
+// message is enqueued, or dead-lettered, and shouldn't be copied to a resubmitted message.
+var resubmitExcludedAnnotations = []string{
+	sequenceNumberAnnotation,
+	enqueuedTimeAnnotation,
+	enqueuedSequenceNumberAnnotation,
+	lockedUntilAnnotation,
+	deadLetterSourceAnnotation,
+	messageStateAnnotation,
+	scheduledEnqueuedTimeAnnotation,
+	lockTokenDeliveryAnnotation,
+	"x-opt-partition-id",
+}
+
+// ResubmittableMessage creates a copy of this message that can be sent with [Sender.SendAMQPAnnotatedMessage]
+// or [MessageBatch.AddAMQPAnnotatedMessage], preserving its body, properties and application properties.
+//
+// Unlike [ReceivedMessage.Message], the body is copied from [ReceivedMessage.RawAMQPMessage], so payloads
+// encoded as an AMQP value, sequence or multiple data sections are preserved. Values that are assigned by
+// Service Bus, like the sequence number, enqueued time, lock and delivery count, are not copied, along with
+// the DeadLetterReason and DeadLetterErrorDescription application properties.
+func (rm *ReceivedMessage) ResubmittableMessage() *AMQPAnnotatedMessage {
+	src := rm.RawAMQPMessage
+
+	if src == nil {
+		msg := rm.Message()
+		return newAMQPAnnotatedMessage(msg.toAMQPMessage())
+	}
+
+	dest := &AMQPAnnotatedMessage{
+		Body: AMQPAnnotatedMessageBody{
+			Value: src.Body.Value,
+		},
+		MessageAnnotations: make(map[any]any, len(src.MessageAnnotations)),
+	}
+
+	for _, data := range src.Body.Data {
+		dest.Body.Data = append(dest.Body.Data, append([]byte(nil), data...))
+	}
+
+	for _, seq := range src.Body.Sequence {
+		dest.Body.Sequence = append(dest.Body.Sequence, append([]any(nil), seq...))
+	}
+
+	dest.ApplicationProperties = make(map[string]any, len(src.ApplicationProperties))
+
+	for k, v := range src.ApplicationProperties {
+		dest.ApplicationProperties[k] = v
+	}
+
+	delete(dest.ApplicationProperties, "DeadLetterReason")
+	delete(dest.ApplicationProperties, "DeadLetterErrorDescription")
+
+	for k, v := range src.MessageAnnotations {
+		dest.MessageAnnotations[k] = v
+	}
+
+	for _, k := range resubmitExcludedAnnotations {
+		delete(dest.MessageAnnotations, k)
+	}
+
+	if src.Header != nil {
+		dest.Header = &AMQPAnnotatedMessageHeader{
+			Durable:  src.Header.Durable,
+			Priority: src.Header.Priority,
+			TTL:      src.Header.TTL,
+		}
+	}
+
+	if src.Properties != nil {
+		props := *src.Properties
+		dest.Properties = &props
+	}
+
+	return dest
+}
@@ -0,0 +1,324 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/go-amqp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterFilter(t *testing.T) {
+	now := time.Now()
+
+	msg := &ReceivedMessage{
+		DeadLetterReason:      to.Ptr("MaxDeliveryCountExceeded"),
+		ApplicationProperties: map[string]any{"tenant": "contoso", "attempt": int64(3)},
+		EnqueuedTime:          &now,
+	}
+
+	var nilFilter *DeadLetterFilter
+	require.True(t, nilFilter.matches(msg))
+	require.True(t, (&DeadLetterFilter{}).matches(msg))
+
+	require.True(t, (&DeadLetterFilter{DeadLetterReason: to.Ptr("MaxDeliveryCountExceeded")}).matches(msg))
+	require.False(t, (&DeadLetterFilter{DeadLetterReason: to.Ptr("TTLExpiredException")}).matches(msg))
+	require.False(t, (&DeadLetterFilter{DeadLetterReason: to.Ptr("x")}).matches(&ReceivedMessage{}))
+
+	require.True(t, (&DeadLetterFilter{ApplicationProperties: map[string]any{"tenant": "contoso", "attempt": int64(3)}}).matches(msg))
+	require.False(t, (&DeadLetterFilter{ApplicationProperties: map[string]any{"tenant": "fabrikam"}}).matches(msg))
+	require.False(t, (&DeadLetterFilter{ApplicationProperties: map[string]any{"attempt": 3}}).matches(msg), "types must match")
+	require.False(t, (&DeadLetterFilter{ApplicationProperties: map[string]any{"missing": "contoso"}}).matches(msg))
+
+	require.True(t, (&DeadLetterFilter{EnqueuedAfter: to.Ptr(now.Add(-time.Minute)), EnqueuedBefore: to.Ptr(now.Add(time.Minute))}).matches(msg))
+	require.False(t, (&DeadLetterFilter{EnqueuedAfter: &now}).matches(msg))
+	require.False(t, (&DeadLetterFilter{EnqueuedBefore: &now}).matches(msg))
+
+	require.False(t, (&DeadLetterFilter{Match: func(msg *ReceivedMessage) bool { return false }}).matches(msg))
+}
+
+func TestReceivedMessage_ResubmittableMessage(t *testing.T) {
+	raw := &AMQPAnnotatedMessage{
+		ApplicationProperties: map[string]any{
+			"DeadLetterReason":           "reason",
+			"DeadLetterErrorDescription": "description",
+			"custom":                     "value",
+		},
+		Body: AMQPAnnotatedMessageBody{
+			Sequence: [][]any{{"hello", int64(1)}},
+		},
+		DeliveryAnnotations: map[any]any{"x-opt-lock-token": "token"},
+		DeliveryTag:         []byte("tag"),
+		Header: &AMQPAnnotatedMessageHeader{
+			DeliveryCount: 10,
+			Durable:       true,
+			Priority:      4,
+			TTL:           time.Hour,
+		},
+		MessageAnnotations: map[any]any{
+			partitionKeyAnnotation:           "partition key",
+			sequenceNumberAnnotation:         int64(101),
+			enqueuedTimeAnnotation:           time.Now(),
+			enqueuedSequenceNumberAnnotation: int64(100),
+			lockedUntilAnnotation:            time.Now(),
+			deadLetterSourceAnnotation:       "queue",
+			messageStateAnnotation:           int64(0),
+			"x-custom":                       "kept",
+		},
+		Properties: &AMQPAnnotatedMessageProperties{
+			MessageID:     "message id",
+			CorrelationID: "correlation id",
+			Subject:       to.Ptr("subject"),
+		},
+	}
+
+	rm := &ReceivedMessage{RawAMQPMessage: raw}
+	resubmit := rm.ResubmittableMessage()
+
+	require.Equal(t, map[string]any{"custom": "value"}, resubmit.ApplicationProperties)
+	require.Equal(t, [][]any{{"hello", int64(1)}}, resubmit.Body.Sequence)
+	require.Empty(t, resubmit.DeliveryAnnotations)
+	require.Empty(t, resubmit.DeliveryTag)
+	require.Equal(t, &AMQPAnnotatedMessageHeader{Durable: true, Priority: 4, TTL: time.Hour}, resubmit.Header)
+	require.Equal(t, map[any]any{partitionKeyAnnotation: "partition key", "x-custom": "kept"}, resubmit.MessageAnnotations)
+	require.Equal(t, raw.Properties, resubmit.Properties)
+
+	// changes to the copy don't affect the received message
+	resubmit.Properties.MessageID = "new message id"
+	resubmit.Body.Sequence[0][0] = "changed"
+	resubmit.ApplicationProperties["custom"] = "changed"
+
+	require.Equal(t, "message id", raw.Properties.MessageID)
+	require.Equal(t, "hello", raw.Body.Sequence[0][0])
+	require.Equal(t, "value", raw.ApplicationProperties["custom"])
+	require.Contains(t, raw.ApplicationProperties, "DeadLetterReason")
+}
+
+func TestDeadLetterQueue_PeekMessagesPager(t *testing.T) {
+	receiver := newFakeDLQReceiver(newTestDeadLetteredMessages(5)...)
+	dlq := &DeadLetterQueue{receiver: receiver, sender: &fakeDLQSender{}}
+
+	pager := dlq.NewPeekMessagesPager(&PeekDeadLetterMessagesOptions{
+		PageSize: 2,
+		Filter: &DeadLetterFilter{
+			Match: func(msg *ReceivedMessage) bool { return *msg.SequenceNumber != 2 },
+		},
+	})
+
+	var pages [][]string
+
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		require.NoError(t, err)
+
+		var ids []string
+
+		for _, msg := range page.Messages {
+			ids = append(ids, msg.MessageID)
+		}
+
+		pages = append(pages, ids)
+	}
+
+	require.Equal(t, [][]string{{"message 0", "message 1"}, {"message 3"}, {"message 4"}, nil}, pages)
+	require.Equal(t, []int64{0, 2, 4, 5}, receiver.peekedFrom)
+	require.Len(t, receiver.messages, 5, "peeking doesn't remove messages")
+}
+
+func TestDeadLetterQueue_ResubmitMessages(t *testing.T) {
+	receiver := newFakeDLQReceiver(newTestDeadLetteredMessages(5)...)
+	sender := &fakeDLQSender{}
+	dlq := &DeadLetterQueue{receiver: receiver, sender: sender}
+
+	resp, err := dlq.ResubmitMessages(context.Background(), &ResubmitMessagesOptions{
+		Filter: &DeadLetterFilter{
+			Match: func(msg *ReceivedMessage) bool { return msg.MessageID != "message 1" },
+		},
+		Transform: func(msg *ReceivedMessage, resubmit *AMQPAnnotatedMessage) error {
+			resubmit.Properties.MessageID = msg.MessageID + " (resubmitted)"
+			return nil
+		},
+		ReceiveBatchSize: 2,
+		IdleTimeout:      time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, ResubmitMessagesResponse{Resubmitted: 4, Skipped: 1}, resp)
+
+	require.Equal(t, []string{
+		"message 0 (resubmitted)", "message 2 (resubmitted)", "message 3 (resubmitted)", "message 4 (resubmitted)",
+	}, sender.Sent())
+	require.Equal(t, []string{"message 0", "message 2", "message 3", "message 4"}, receiver.Settled("complete"))
+	require.Equal(t, []string{"message 1"}, receiver.Settled("abandon"))
+}
+
+func TestDeadLetterQueue_ResubmitMessagesMaxMessages(t *testing.T) {
+	receiver := newFakeDLQReceiver(newTestDeadLetteredMessages(5)...)
+	sender := &fakeDLQSender{}
+	dlq := &DeadLetterQueue{receiver: receiver, sender: sender}
+
+	resp, err := dlq.ResubmitMessages(context.Background(), &ResubmitMessagesOptions{
+		MaxMessages:      3,
+		ReceiveBatchSize: 2,
+		IdleTimeout:      time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, ResubmitMessagesResponse{Resubmitted: 3}, resp)
+	require.Equal(t, []int{2, 1}, receiver.ReceiveCounts())
+	require.Equal(t, []string{"message 0", "message 1", "message 2"}, sender.Sent())
+}
+
+func TestDeadLetterQueue_ResubmitMessagesSplitsBatches(t *testing.T) {
+	receiver := newFakeDLQReceiver(newTestDeadLetteredMessages(3)...)
+	sender := &fakeDLQSender{maxBytes: 600}
+	dlq := &DeadLetterQueue{receiver: receiver, sender: sender}
+
+	resp, err := dlq.ResubmitMessages(context.Background(), &ResubmitMessagesOptions{
+		Transform: func(msg *ReceivedMessage, resubmit *AMQPAnnotatedMessage) error {
+			resubmit.Body.Data = [][]byte{make([]byte, 200)}
+			return nil
+		},
+		IdleTimeout: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, resp.Resubmitted)
+	require.Greater(t, len(sender.batchSizes), 1)
+	require.Equal(t, []string{"message 0", "message 1", "message 2"}, sender.Sent())
+}
+
+func TestDeadLetterQueue_ResubmitMessagesSendFails(t *testing.T) {
+	receiver := newFakeDLQReceiver(newTestDeadLetteredMessages(3)...)
+	sender := &fakeDLQSender{sendErr: errors.New("send failed")}
+	dlq := &DeadLetterQueue{receiver: receiver, sender: sender}
+
+	resp, err := dlq.ResubmitMessages(context.Background(), &ResubmitMessagesOptions{
+		IdleTimeout: time.Millisecond,
+	})
+	require.EqualError(t, err, "send failed")
+	require.Equal(t, ResubmitMessagesResponse{}, resp)
+
+	// nothing was sent, so nothing is removed from the dead letter queue.
+	require.Empty(t, receiver.Settled("complete"))
+	require.Equal(t, []string{"message 0", "message 1", "message 2"}, receiver.Settled("abandon"))
+}
+
+func TestDeadLetterQueue_ResubmitMessagesTransformFails(t *testing.T) {
+	receiver := newFakeDLQReceiver(newTestDeadLetteredMessages(3)...)
+	sender := &fakeDLQSender{}
+	dlq := &DeadLetterQueue{receiver: receiver, sender: sender}
+
+	_, err := dlq.ResubmitMessages(context.Background(), &ResubmitMessagesOptions{
+		Transform: func(msg *ReceivedMessage, resubmit *AMQPAnnotatedMessage) error {
+			if msg.MessageID == "message 1" {
+				return errors.New("transform failed")
+			}
+			return nil
+		},
+		IdleTimeout: time.Millisecond,
+	})
+	require.EqualError(t, err, "transform failed")
+	require.Empty(t, sender.Sent())
+	require.ElementsMatch(t, []string{"message 0", "message 1", "message 2"}, receiver.Settled("abandon"))
+}
+
+func newTestDeadLetteredMessages(n int) []*ReceivedMessage {
+	messages := newTestMessages(n)
+
+	for i, msg := range messages {
+		msg.SequenceNumber = to.Ptr(int64(i))
+		msg.DeadLetterReason = to.Ptr("MaxDeliveryCountExceeded")
+		msg.RawAMQPMessage = &AMQPAnnotatedMessage{
+			ApplicationProperties: map[string]any{"DeadLetterReason": "MaxDeliveryCountExceeded"},
+			Body:                  AMQPAnnotatedMessageBody{Data: [][]byte{[]byte(msg.MessageID)}},
+			MessageAnnotations:    map[any]any{sequenceNumberAnnotation: int64(i)},
+			Properties:            &AMQPAnnotatedMessageProperties{MessageID: msg.MessageID},
+		}
+	}
+
+	return messages
+}
+
+type fakeDLQReceiver struct {
+	*fakeProcessorReceiver
+	all        []*ReceivedMessage
+	peekedFrom []int64
+}
+
+func newFakeDLQReceiver(messages ...*ReceivedMessage) *fakeDLQReceiver {
+	return &fakeDLQReceiver{
+		fakeProcessorReceiver: newFakeProcessorReceiver(messages...),
+		all:                   messages,
+	}
+}
+
+func (r *fakeDLQReceiver) PeekMessages(ctx context.Context, maxMessageCount int, options *PeekMessagesOptions) ([]*ReceivedMessage, error) {
+	from := *options.FromSequenceNumber
+	r.peekedFrom = append(r.peekedFrom, from)
+
+	var peeked []*ReceivedMessage
+
+	for _, msg := range r.all {
+		if *msg.SequenceNumber >= from && len(peeked) < maxMessageCount {
+			peeked = append(peeked, msg)
+		}
+	}
+
+	return peeked, nil
+}
+
+type fakeDLQSender struct {
+	mu         sync.Mutex
+	maxBytes   uint64
+	sendErr    error
+	sent       []string
+	batchSizes []int32
+}
+
+func (s *fakeDLQSender) NewMessageBatch(ctx context.Context, options *MessageBatchOptions) (*MessageBatch, error) {
+	if s.maxBytes == 0 {
+		return newMessageBatch(1024 * 1024), nil
+	}
+
+	return newMessageBatch(s.maxBytes), nil
+}
+
+func (s *fakeDLQSender) SendMessageBatch(ctx context.Context, batch *MessageBatch, options *SendMessageBatchOptions) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batchSizes = append(s.batchSizes, batch.NumMessages())
+
+	for _, bin := range batch.marshaledMessages {
+		var msg amqp.Message
+
+		if err := msg.UnmarshalBinary(bin); err != nil {
+			return err
+		}
+
+		s.sent = append(s.sent, fmt.Sprint(msg.Properties.MessageID))
+	}
+
+	return nil
+}
+
+func (s *fakeDLQSender) Sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sent
+}
+
+func (s *fakeDLQSender) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package emulator is an in-memory Service Bus namespace for unit tests. It speaks AMQP, so
+// the clients in the azservicebus package connect to it unchanged, using the connection string
+// from [Emulator.ConnectionString].
+//
+// The emulator supports queues, topics and subscriptions (with SQL, correlation and boolean
+// filters), sessions, message locks, deferral, scheduling and dead-lettering. Time only
+// moves when the test says so, with [Emulator.AdvanceTime], so lock expiration and
+// scheduled messages are deterministic.
+//
+// The emulator isn't a complete implementation of Service Bus. It doesn't support
+// transactions, auto-forwarding, duplicate detection, rule actions or the administration API.
+package emulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/internal/amqpserver"
+	"github.com/Azure/go-amqp"
+)
+
+// Options contains optional settings for [New].
+type Options struct {
+	// Now is the emulator's starting time. Defaults to the current time.
+	Now time.Time
+}
+
+// Emulator is an in-memory Service Bus namespace.
+type Emulator struct {
+	server *amqpserver.Server
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	closed bool
+
+	queues map[string]*entity
+	topics map[string]*topic
+
+	// replyLinks are the links management and CBS responses are sent on, by their address.
+	replyLinks map[string]*replyLink
+
+	// receivers are the receiver links, by link name, for management operations that
+	// reference a link.
+	receivers map[string]*receiver
+}
+
+// New creates an Emulator, listening on a local port.
+func New(options *Options) (*Emulator, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	e := &Emulator{
+		now:        options.Now,
+		queues:     map[string]*entity{},
+		topics:     map[string]*topic{},
+		replyLinks: map[string]*replyLink{},
+		receivers:  map[string]*receiver{},
+	}
+
+	if e.now.IsZero() {
+		e.now = time.Now()
+	}
+
+	e.now = e.now.UTC().Truncate(time.Millisecond)
+	e.cond = sync.NewCond(&e.mu)
+
+	server, err := amqpserver.Listen("127.0.0.1:0", amqpserver.HandlerFunc(e.attach))
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.server = server
+	return e, nil
+}
+
+// ConnectionString is a connection string for the emulator. Pass it to
+// azservicebus.NewClientFromConnectionString.
+func (e *Emulator) ConnectionString() string {
+	return fmt.Sprintf("Endpoint=sb://%s;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=emulator;UseDevelopmentEmulator=true", e.server.Addr())
+}
+
+// NewClient creates an azservicebus.Client that's connected to the emulator.
+func (e *Emulator) NewClient(options *azservicebus.ClientOptions) (*azservicebus.Client, error) {
+	return azservicebus.NewClientFromConnectionString(e.ConnectionString(), options)
+}
+
+// Now is the emulator's current time. Messages are enqueued, and locks expire, based on this time.
+func (e *Emulator) Now() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.now
+}
+
+// AdvanceTime moves the emulator's clock forward. Locks that expire are released, scheduled
+// messages that are due are enqueued, and messages that outlive their time to live expire.
+func (e *Emulator) AdvanceTime(d time.Duration) {
+	if d < 0 {
+		panic("emulator: time can't go backwards")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.now = e.now.Add(d)
+	e.refreshLocked()
+}
+
+// DisconnectAll closes every client connection, as if the service had restarted. Clients
+// reconnect on their next operation. Message and session locks held by the closed links
+// are released.
+func (e *Emulator) DisconnectAll() {
+	e.server.CloseConnections(&amqp.Error{
+		Condition:   amqp.ErrCondConnectionForced,
+		Description: "the emulator closed the connection",
+	})
+}
+
+// Close closes all connections and stops the emulator.
+func (e *Emulator) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	e.cond.Broadcast()
+	e.mu.Unlock()
+
+	return e.server.Close()
+}
+
+// MessageCounts are the number of messages in a queue or subscription.
+type MessageCounts struct {
+	// Active is the number of messages that can be received, including messages that are locked.
+	Active int
+
+	// DeadLetter is the number of messages in the dead letter queue.
+	DeadLetter int
+
+	// Deferred is the number of deferred messages.
+	Deferred int
+
+	// Scheduled is the number of messages scheduled to be enqueued later.
+	Scheduled int
+}
+
+// MessageCounts returns the number of messages in a queue (ex: "queue") or subscription
+// (ex: "topic/Subscriptions/subscription").
+func (e *Emulator) MessageCounts(entityPath string) (MessageCounts, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.refreshLocked()
+
+	ent, _, err := e.findEntityLocked(entityPath)
+
+	if err != nil {
+		return MessageCounts{}, err
+	}
+
+	counts := MessageCounts{DeadLetter: len(ent.deadLetter.messages)}
+
+	for _, m := range ent.messages {
+		switch m.state {
+		case stateActive:
+			counts.Active++
+		case stateDeferred:
+			counts.Deferred++
+		case stateScheduled:
+			counts.Scheduled++
+		}
+	}
+
+	if ent.topic != nil {
+		counts.Scheduled += len(ent.topic.scheduled)
+	}
+
+	return counts, nil
+}
+
+// findEntityLocked finds the queue, subscription or dead letter queue for an entity path.
+func (e *Emulator) findEntityLocked(entityPath string) (*entity, bool, error) {
+	path := strings.ToLower(strings.Trim(entityPath, "/"))
+	deadLetter := false
+
+	for _, suffix := range []string{"/$transfer/$deadletterqueue", "/$deadletterqueue"} {
+		if strings.HasSuffix(path, suffix) {
+			path = strings.TrimSuffix(path, suffix)
+			deadLetter = true
+			break
+		}
+	}
+
+	var ent *entity
+
+	if topicName, subName, ok := strings.Cut(path, "/subscriptions/"); ok {
+		if t := e.topics[topicName]; t != nil {
+			ent = t.subscriptions[subName]
+		}
+	} else {
+		ent = e.queues[path]
+	}
+
+	if ent == nil {
+		return nil, false, fmt.Errorf("entity %q does not exist", entityPath)
+	}
+
+	if deadLetter {
+		if strings.Contains(path, "$transfer") {
+			return ent.transferDeadLetter, true, nil
+		}
+
+		return ent.deadLetter, true, nil
+	}
+
+	return ent, false, nil
+}
+
+// refreshLocked expires locks and messages, and enqueues scheduled messages that are due.
+func (e *Emulator) refreshLocked() {
+	for _, q := range e.queues {
+		q.refreshLocked()
+	}
+
+	for _, t := range e.topics {
+		var due, remaining []*message
+
+		for _, m := range t.scheduled {
+			if !m.scheduledAt.After(e.now) {
+				due = append(due, m)
+			} else {
+				remaining = append(remaining, m)
+			}
+		}
+
+		t.scheduled = remaining
+
+		for _, m := range due {
+			amqpMsg, err := m.decode()
+
+			if err == nil {
+				t.publishLocked(amqpMsg, m.sequenceNumber)
+			}
+		}
+
+		for _, s := range t.subscriptions {
+			s.refreshLocked()
+		}
+	}
+
+	e.cond.Broadcast()
+}
+
+func (e *Emulator) newSequenceNumber(counter *int64) int64 {
+	*counter++
+	return *counter
+}
+
+var errEntityExists = errors.New("entity already exists")
+
+// waitLocked waits until the emulator changes, the deadline passes, or a short interval
+// passes, so callers can check for other conditions. It returns false if the deadline
+// passed or the emulator was closed.
+func (e *Emulator) waitLocked(ctx context.Context) bool {
+	if ctx.Err() != nil || e.closed {
+		return false
+	}
+
+	wake := func() {
+		e.mu.Lock()
+		e.cond.Broadcast()
+		e.mu.Unlock()
+	}
+
+	stop := context.AfterFunc(ctx, wake)
+	defer stop()
+
+	timer := time.AfterFunc(100*time.Millisecond, wake)
+	defer timer.Stop()
+
+	e.cond.Wait()
+	return ctx.Err() == nil && !e.closed
+}
+
+func sortMessages(messages []*message) {
+	sort.Slice(messages, func(i, j int) bool { return messages[i].sequenceNumber < messages[j].sequenceNumber })
+}
@@ -0,0 +1,534 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/emulator"
+	"github.com/Azure/go-amqp"
+	"github.com/stretchr/testify/require"
+)
+
+func newEmulator(t *testing.T) (*emulator.Emulator, *azservicebus.Client) {
+	emu, err := emulator.New(&emulator.Options{
+		Now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+
+	client, err := emu.NewClient(nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, client.Close(context.Background()))
+		require.NoError(t, emu.Close())
+	})
+
+	return emu, client
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func sendMessages(t *testing.T, client *azservicebus.Client, entity string, messages ...*azservicebus.Message) {
+	sender, err := client.NewSender(entity, nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sender.Close(context.Background())) }()
+
+	for _, msg := range messages {
+		require.NoError(t, sender.SendMessage(testContext(t), msg, nil))
+	}
+}
+
+func receiveBodies(t *testing.T, messages []*azservicebus.ReceivedMessage) []string {
+	var bodies []string
+
+	for _, m := range messages {
+		bodies = append(bodies, string(m.Body))
+	}
+
+	return bodies
+}
+
+// receiveN receives messages until there are n of them.
+func receiveN(t *testing.T, receiver interface {
+	ReceiveMessages(ctx context.Context, maxMessages int, options *azservicebus.ReceiveMessagesOptions) ([]*azservicebus.ReceivedMessage, error)
+}, n int) []*azservicebus.ReceivedMessage {
+	var all []*azservicebus.ReceivedMessage
+
+	for len(all) < n {
+		messages, err := receiver.ReceiveMessages(testContext(t), n-len(all), nil)
+		require.NoError(t, err)
+		all = append(all, messages...)
+	}
+
+	return all
+}
+
+func TestEmulator_SendAndReceive(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	sendMessages(t, client, "queue",
+		&azservicebus.Message{Body: []byte("hello"), ApplicationProperties: map[string]any{"number": int64(1)}},
+		&azservicebus.Message{Body: []byte("world"), MessageID: to.Ptr("message-id")},
+	)
+
+	counts, err := emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{Active: 2}, counts)
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	messages := receiveN(t, receiver, 2)
+	require.Equal(t, []string{"hello", "world"}, receiveBodies(t, messages))
+
+	require.Equal(t, int64(1), *messages[0].SequenceNumber)
+	require.Equal(t, int64(2), *messages[1].SequenceNumber)
+	require.Equal(t, emu.Now(), messages[0].EnqueuedTime.UTC())
+	require.Equal(t, emu.Now().Add(time.Minute), messages[0].LockedUntil.UTC())
+	require.Equal(t, uint32(1), messages[0].DeliveryCount)
+	require.Equal(t, map[string]any{"number": int64(1)}, messages[0].ApplicationProperties)
+	require.Equal(t, "message-id", messages[1].MessageID)
+
+	for _, m := range messages {
+		require.NoError(t, receiver.CompleteMessage(testContext(t), m, nil))
+	}
+
+	counts, err = emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{}, counts)
+}
+
+func TestEmulator_SendBatch(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	sender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	batch, err := sender.NewMessageBatch(testContext(t), nil)
+	require.NoError(t, err)
+
+	for _, body := range []string{"one", "two", "three"} {
+		require.NoError(t, batch.AddMessage(&azservicebus.Message{Body: []byte(body)}, nil))
+	}
+
+	require.NoError(t, sender.SendMessageBatch(testContext(t), batch, nil))
+
+	receiver, err := client.NewReceiverForQueue("queue", &azservicebus.ReceiverOptions{ReceiveMode: azservicebus.ReceiveModeReceiveAndDelete})
+	require.NoError(t, err)
+
+	messages := receiveN(t, receiver, 3)
+	require.Equal(t, []string{"one", "two", "three"}, receiveBodies(t, messages))
+
+	counts, err := emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{}, counts)
+}
+
+func TestEmulator_MissingEntity(t *testing.T) {
+	_, client := newEmulator(t)
+
+	sender, err := client.NewSender("missing", nil)
+	require.NoError(t, err)
+
+	err = sender.SendMessage(testContext(t), &azservicebus.Message{Body: []byte("hello")}, nil)
+
+	var amqpErr *amqp.Error
+	require.ErrorAs(t, err, &amqpErr)
+	require.Equal(t, amqp.ErrCondNotFound, amqpErr.Condition)
+}
+
+func TestEmulator_AbandonAndMaxDeliveryCount(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", &emulator.QueueProperties{MaxDeliveryCount: 2}))
+
+	sendMessages(t, client, "queue", &azservicebus.Message{Body: []byte("hello")})
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	msg := receiveN(t, receiver, 1)[0]
+	require.Equal(t, uint32(1), msg.DeliveryCount)
+	require.NoError(t, receiver.AbandonMessage(testContext(t), msg, &azservicebus.AbandonMessageOptions{
+		PropertiesToModify: map[string]any{"attempt": int64(1)},
+	}))
+
+	msg = receiveN(t, receiver, 1)[0]
+	require.Equal(t, uint32(2), msg.DeliveryCount)
+	require.Equal(t, int64(1), msg.ApplicationProperties["attempt"])
+	require.NoError(t, receiver.AbandonMessage(testContext(t), msg, nil))
+
+	counts, err := emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{DeadLetter: 1}, counts)
+
+	dlqReceiver, err := client.NewReceiverForQueue("queue", &azservicebus.ReceiverOptions{SubQueue: azservicebus.SubQueueDeadLetter})
+	require.NoError(t, err)
+
+	msg = receiveN(t, dlqReceiver, 1)[0]
+	require.Equal(t, "hello", string(msg.Body))
+	require.Equal(t, "MaxDeliveryCountExceeded", *msg.DeadLetterReason)
+	require.NoError(t, dlqReceiver.CompleteMessage(testContext(t), msg, nil))
+}
+
+func TestEmulator_DeadLetter(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	sendMessages(t, client, "queue", &azservicebus.Message{Body: []byte("hello")})
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	msg := receiveN(t, receiver, 1)[0]
+	require.NoError(t, receiver.DeadLetterMessage(testContext(t), msg, &azservicebus.DeadLetterOptions{
+		Reason:             to.Ptr("bad"),
+		ErrorDescription:   to.Ptr("the message was bad"),
+		PropertiesToModify: map[string]any{"extra": "value"},
+	}))
+
+	dlqReceiver, err := client.NewReceiverForQueue("queue", &azservicebus.ReceiverOptions{SubQueue: azservicebus.SubQueueDeadLetter})
+	require.NoError(t, err)
+
+	msg = receiveN(t, dlqReceiver, 1)[0]
+	require.Equal(t, "bad", *msg.DeadLetterReason)
+	require.Equal(t, "the message was bad", *msg.DeadLetterErrorDescription)
+	require.Equal(t, "queue", *msg.DeadLetterSource)
+	require.Equal(t, "value", msg.ApplicationProperties["extra"])
+}
+
+func TestEmulator_LockExpiration(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", &emulator.QueueProperties{LockDuration: 30 * time.Second}))
+
+	sendMessages(t, client, "queue", &azservicebus.Message{Body: []byte("hello")})
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	msg := receiveN(t, receiver, 1)[0]
+
+	emu.AdvanceTime(20 * time.Second)
+	require.NoError(t, receiver.RenewMessageLock(testContext(t), msg, nil))
+	require.Equal(t, emu.Now().Add(30*time.Second), msg.LockedUntil.UTC())
+
+	emu.AdvanceTime(31 * time.Second)
+
+	err = receiver.CompleteMessage(testContext(t), msg, nil)
+
+	var sbErr *azservicebus.Error
+	require.ErrorAs(t, err, &sbErr)
+	require.Equal(t, azservicebus.CodeLockLost, sbErr.Code)
+
+	msg = receiveN(t, receiver, 1)[0]
+	require.Equal(t, uint32(2), msg.DeliveryCount)
+	require.NoError(t, receiver.CompleteMessage(testContext(t), msg, nil))
+}
+
+func TestEmulator_Defer(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	sendMessages(t, client, "queue", &azservicebus.Message{Body: []byte("hello")})
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	msg := receiveN(t, receiver, 1)[0]
+	require.NoError(t, receiver.DeferMessage(testContext(t), msg, nil))
+
+	counts, err := emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{Deferred: 1}, counts)
+
+	deferred, err := receiver.ReceiveDeferredMessages(testContext(t), []int64{*msg.SequenceNumber}, nil)
+	require.NoError(t, err)
+	require.Len(t, deferred, 1)
+	require.Equal(t, azservicebus.MessageStateDeferred, deferred[0].State)
+	require.NoError(t, receiver.CompleteMessage(testContext(t), deferred[0], nil))
+
+	counts, err = emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{}, counts)
+}
+
+func TestEmulator_ScheduledMessages(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	sender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	sequenceNumbers, err := sender.ScheduleMessages(testContext(t), []*azservicebus.Message{
+		{Body: []byte("later")},
+		{Body: []byte("cancelled")},
+	}, emu.Now().Add(time.Hour), nil)
+	require.NoError(t, err)
+	require.Len(t, sequenceNumbers, 2)
+
+	require.NoError(t, sender.CancelScheduledMessages(testContext(t), sequenceNumbers[1:], nil))
+
+	counts, err := emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{Scheduled: 1}, counts)
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	peeked, err := receiver.PeekMessages(testContext(t), 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"later"}, receiveBodies(t, peeked))
+	require.Equal(t, azservicebus.MessageStateScheduled, peeked[0].State)
+
+	emu.AdvanceTime(time.Hour)
+
+	msg := receiveN(t, receiver, 1)[0]
+	require.Equal(t, "later", string(msg.Body))
+	require.Equal(t, sequenceNumbers[0], *msg.SequenceNumber)
+}
+
+func TestEmulator_TimeToLive(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", &emulator.QueueProperties{
+		DefaultMessageTimeToLive:         time.Hour,
+		DeadLetteringOnMessageExpiration: true,
+	}))
+
+	sendMessages(t, client, "queue",
+		&azservicebus.Message{Body: []byte("default")},
+		&azservicebus.Message{Body: []byte("short"), TimeToLive: to.Ptr(time.Minute)},
+	)
+
+	emu.AdvanceTime(2 * time.Minute)
+
+	counts, err := emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{Active: 1, DeadLetter: 1}, counts)
+
+	emu.AdvanceTime(time.Hour)
+
+	counts, err = emu.MessageCounts("queue")
+	require.NoError(t, err)
+	require.Equal(t, emulator.MessageCounts{DeadLetter: 2}, counts)
+}
+
+func TestEmulator_TopicFilters(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateTopic("topic"))
+	require.NoError(t, emu.CreateSubscription("topic", "all", nil))
+	require.NoError(t, emu.CreateSubscription("topic", "red", &emulator.SubscriptionProperties{
+		Rules: []emulator.Rule{{Name: "red", Filter: emulator.SQLFilter{Expression: "color = @color AND sys.Label LIKE 'paint%'", Parameters: map[string]any{"@color": "red"}}}},
+	}))
+	require.NoError(t, emu.CreateSubscription("topic", "orders", &emulator.SubscriptionProperties{
+		Rules: []emulator.Rule{{Name: "orders", Filter: emulator.CorrelationFilter{CorrelationID: to.Ptr("orders")}}},
+	}))
+	require.NoError(t, emu.CreateSubscription("topic", "none", &emulator.SubscriptionProperties{
+		Rules: []emulator.Rule{{Name: "none", Filter: emulator.FalseFilter{}}},
+	}))
+
+	sendMessages(t, client, "topic",
+		&azservicebus.Message{Body: []byte("red paint"), Subject: to.Ptr("paint can"), ApplicationProperties: map[string]any{"color": "red"}},
+		&azservicebus.Message{Body: []byte("blue paint"), Subject: to.Ptr("paint can"), ApplicationProperties: map[string]any{"color": "blue"}},
+		&azservicebus.Message{Body: []byte("order"), CorrelationID: to.Ptr("orders")},
+	)
+
+	expected := map[string]emulator.MessageCounts{
+		"all":    {Active: 3},
+		"red":    {Active: 1},
+		"orders": {Active: 1},
+		"none":   {},
+	}
+
+	for name, want := range expected {
+		counts, err := emu.MessageCounts("topic/Subscriptions/" + name)
+		require.NoError(t, err)
+		require.Equal(t, want, counts, name)
+	}
+
+	receiver, err := client.NewReceiverForSubscription("topic", "red", nil)
+	require.NoError(t, err)
+
+	msg := receiveN(t, receiver, 1)[0]
+	require.Equal(t, "red paint", string(msg.Body))
+	require.Equal(t, int64(1), *msg.SequenceNumber)
+}
+
+func TestEmulator_Sessions(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", &emulator.QueueProperties{RequiresSession: true}))
+
+	sender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	err = sender.SendMessage(testContext(t), &azservicebus.Message{Body: []byte("no session")}, nil)
+	require.Error(t, err)
+
+	sendMessages(t, client, "queue",
+		&azservicebus.Message{Body: []byte("a1"), SessionID: to.Ptr("a")},
+		&azservicebus.Message{Body: []byte("b1"), SessionID: to.Ptr("b")},
+		&azservicebus.Message{Body: []byte("a2"), SessionID: to.Ptr("a")},
+	)
+
+	sessionA, err := client.AcceptNextSessionForQueue(testContext(t), "queue", nil)
+	require.NoError(t, err)
+	require.Equal(t, "a", sessionA.SessionID())
+	require.Equal(t, emu.Now().Add(time.Minute), sessionA.LockedUntil().UTC())
+
+	// the session is locked by sessionA
+	_, err = client.AcceptSessionForQueue(testContext(t), "queue", "a", nil)
+	require.Error(t, err)
+
+	messages := receiveN(t, sessionA, 2)
+	require.Equal(t, []string{"a1", "a2"}, receiveBodies(t, messages))
+
+	for _, m := range messages {
+		require.NoError(t, sessionA.CompleteMessage(testContext(t), m, nil))
+	}
+
+	require.NoError(t, sessionA.SetSessionState(testContext(t), []byte("state"), nil))
+
+	state, err := sessionA.GetSessionState(testContext(t), nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("state"), state)
+
+	emu.AdvanceTime(30 * time.Second)
+	require.NoError(t, sessionA.RenewSessionLock(testContext(t), nil))
+	require.Equal(t, emu.Now().Add(time.Minute), sessionA.LockedUntil().UTC())
+	require.NoError(t, sessionA.Close(testContext(t)))
+
+	sessionB, err := client.AcceptNextSessionForQueue(testContext(t), "queue", nil)
+	require.NoError(t, err)
+	require.Equal(t, "b", sessionB.SessionID())
+
+	// there are no other sessions with messages
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err = client.AcceptNextSessionForQueue(ctx, "queue", nil)
+	require.Error(t, err)
+
+	// the session's state was kept
+	sessionA, err = client.AcceptSessionForQueue(testContext(t), "queue", "a", nil)
+	require.NoError(t, err)
+
+	state, err = sessionA.GetSessionState(testContext(t), nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("state"), state)
+}
+
+func TestEmulator_SessionLockExpiration(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", &emulator.QueueProperties{RequiresSession: true}))
+
+	sendMessages(t, client, "queue", &azservicebus.Message{Body: []byte("hello"), SessionID: to.Ptr("session")})
+
+	session, err := client.AcceptSessionForQueue(testContext(t), "queue", "session", nil)
+	require.NoError(t, err)
+
+	msg := receiveN(t, session, 1)[0]
+
+	emu.AdvanceTime(2 * time.Minute)
+
+	// the session's lock expired, so another receiver can accept it, and the message is redelivered
+	other, err := client.AcceptSessionForQueue(testContext(t), "queue", "session", nil)
+	require.NoError(t, err)
+
+	redelivered := receiveN(t, other, 1)[0]
+	require.Equal(t, uint32(2), redelivered.DeliveryCount)
+
+	require.Error(t, session.CompleteMessage(testContext(t), msg, nil))
+	require.NoError(t, other.CompleteMessage(testContext(t), redelivered, nil))
+}
+
+func TestEmulator_DisconnectAll(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	sender, err := client.NewSender("queue", nil)
+	require.NoError(t, err)
+
+	receiver, err := client.NewReceiverForQueue("queue", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, sender.SendMessage(testContext(t), &azservicebus.Message{Body: []byte("before")}, nil))
+	require.Equal(t, "before", string(receiveN(t, receiver, 1)[0].Body))
+
+	emu.DisconnectAll()
+
+	// the clients recover
+	require.NoError(t, sender.SendMessage(testContext(t), &azservicebus.Message{Body: []byte("after")}, nil))
+	require.Equal(t, "after", string(receiveN(t, receiver, 1)[0].Body))
+}
+
+func TestEmulator_CreateErrors(t *testing.T) {
+	emu, _ := newEmulator(t)
+
+	require.NoError(t, emu.CreateQueue("queue", nil))
+	require.Error(t, emu.CreateQueue("QUEUE", nil))
+	require.Error(t, emu.CreateTopic("queue"))
+	require.Error(t, emu.CreateSubscription("missing", "sub", nil))
+
+	require.NoError(t, emu.CreateTopic("topic"))
+	err := emu.CreateSubscription("topic", "sub", &emulator.SubscriptionProperties{
+		Rules: []emulator.Rule{{Name: "bad", Filter: emulator.SQLFilter{Expression: "color = "}}},
+	})
+	require.Error(t, err)
+
+	_, err = emu.MessageCounts("missing")
+	require.Error(t, err)
+	require.False(t, errors.Is(err, context.Canceled))
+}
+
+func TestEmulator_Processor(t *testing.T) {
+	emu, client := newEmulator(t)
+	require.NoError(t, emu.CreateQueue("queue", nil))
+
+	var messages []*azservicebus.Message
+
+	for i := 0; i < 20; i++ {
+		messages = append(messages, &azservicebus.Message{Body: []byte{byte(i)}})
+	}
+
+	sendMessages(t, client, "queue", messages...)
+
+	processor, err := client.NewProcessorForQueue("queue", &azservicebus.ProcessorOptions{MaxConcurrentCalls: 4})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	defer cancel()
+
+	received := make(chan byte, len(messages))
+
+	go func() {
+		_ = processor.Run(ctx, func(ctx context.Context, args *azservicebus.ProcessMessageArgs) error {
+			received <- args.Message.Body[0]
+			return nil
+		}, nil)
+	}()
+
+	seen := map[byte]bool{}
+
+	for len(seen) < len(messages) {
+		seen[<-received] = true
+	}
+
+	require.NoError(t, processor.Close(testContext(t)))
+
+	// messages are completed after the handler returns
+	require.Eventually(t, func() bool {
+		counts, err := emu.MessageCounts("queue")
+		return err == nil && counts == emulator.MessageCounts{}
+	}, 10*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,791 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/internal/uuid"
+	"github.com/Azure/go-amqp"
+)
+
+const (
+	defaultLockDuration     = time.Minute
+	defaultMaxDeliveryCount = 10
+
+	// reasons recorded in the DeadLetterReason property, when the emulator dead letters a message.
+	reasonMaxDeliveryCountExceeded = "MaxDeliveryCountExceeded"
+	reasonTTLExpired               = "TTLExpiredException"
+)
+
+// QueueProperties are the settings for a queue, passed to [Emulator.CreateQueue].
+type QueueProperties struct {
+	// LockDuration is how long a message is locked when it's received in peek-lock mode, and how
+	// long a session is locked. Defaults to one minute.
+	LockDuration time.Duration
+
+	// MaxDeliveryCount is the number of times a message can be delivered before it's dead lettered.
+	// Defaults to 10.
+	MaxDeliveryCount int32
+
+	// RequiresSession is true if messages must have a SessionID, and are received with a session receiver.
+	RequiresSession bool
+
+	// DefaultMessageTimeToLive is the time to live for messages that don't set one. Defaults to
+	// no expiration.
+	DefaultMessageTimeToLive time.Duration
+
+	// DeadLetteringOnMessageExpiration moves expired messages to the dead letter queue, rather
+	// than deleting them.
+	DeadLetteringOnMessageExpiration bool
+}
+
+// SubscriptionProperties are the settings for a subscription, passed to [Emulator.CreateSubscription].
+type SubscriptionProperties struct {
+	// LockDuration is how long a message is locked when it's received in peek-lock mode, and how
+	// long a session is locked. Defaults to one minute.
+	LockDuration time.Duration
+
+	// MaxDeliveryCount is the number of times a message can be delivered before it's dead lettered.
+	// Defaults to 10.
+	MaxDeliveryCount int32
+
+	// RequiresSession is true if messages are received with a session receiver. Messages
+	// without a SessionID aren't delivered to the subscription.
+	RequiresSession bool
+
+	// DefaultMessageTimeToLive is the time to live for messages that don't set one. Defaults to
+	// no expiration.
+	DefaultMessageTimeToLive time.Duration
+
+	// DeadLetteringOnMessageExpiration moves expired messages to the dead letter queue, rather
+	// than deleting them.
+	DeadLetteringOnMessageExpiration bool
+
+	// Rules select the messages that are copied to the subscription. A message is copied if any
+	// rule matches. Defaults to a single rule, named "$Default", that matches every message.
+	Rules []Rule
+}
+
+// Rule is a named filter on a subscription.
+type Rule struct {
+	// Name is the name of the rule.
+	Name string
+
+	// Filter is the filter for the rule: a [SQLFilter], [CorrelationFilter], [TrueFilter] or [FalseFilter].
+	Filter Filter
+}
+
+// Filter is a subscription filter: a [SQLFilter], [CorrelationFilter], [TrueFilter] or [FalseFilter].
+type Filter interface {
+	compile() (func(fm *filterMessage) bool, error)
+}
+
+// SQLFilter matches messages with a SQL expression, ex: "color = 'red' AND sys.Label = 'paint'".
+type SQLFilter struct {
+	// Expression is the SQL expression.
+	Expression string
+
+	// Parameters are the values for parameters (ex: @color) in the expression.
+	Parameters map[string]any
+}
+
+// CorrelationFilter matches messages where every property that's set in the filter is equal to
+// the message's property.
+type CorrelationFilter struct {
+	ApplicationProperties map[string]any
+	ContentType           *string
+	CorrelationID         *string
+	MessageID             *string
+	ReplyTo               *string
+	ReplyToSessionID      *string
+	SessionID             *string
+	Subject               *string
+	To                    *string
+}
+
+// TrueFilter matches every message.
+type TrueFilter struct{}
+
+// FalseFilter doesn't match any messages.
+type FalseFilter struct{}
+
+func (f SQLFilter) compile() (func(fm *filterMessage) bool, error) {
+	expr, err := compileSQLFilter(f.Expression, f.Parameters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(fm *filterMessage) bool {
+		matched, _ := expr(fm).(bool)
+		return matched
+	}, nil
+}
+
+func (f CorrelationFilter) compile() (func(fm *filterMessage) bool, error) {
+	return func(fm *filterMessage) bool {
+		checks := []struct {
+			name  string
+			value *string
+		}{
+			{"ContentType", f.ContentType},
+			{"CorrelationId", f.CorrelationID},
+			{"MessageId", f.MessageID},
+			{"ReplyTo", f.ReplyTo},
+			{"ReplyToSessionId", f.ReplyToSessionID},
+			{"SessionId", f.SessionID},
+			{"Label", f.Subject},
+			{"To", f.To},
+		}
+
+		for _, check := range checks {
+			if check.value == nil {
+				continue
+			}
+
+			v, _ := fm.systemProperty(check.name)
+
+			if fmt.Sprint(v) != *check.value || v == nil {
+				return false
+			}
+		}
+
+		for name, want := range f.ApplicationProperties {
+			got, ok := fm.msg.ApplicationProperties[name]
+
+			if !ok {
+				return false
+			}
+
+			if c, ok := compareValues(normalizeValue(got), normalizeValue(want)); !ok || c != 0 {
+				if !reflect.DeepEqual(got, want) {
+					return false
+				}
+			}
+		}
+
+		return true
+	}, nil
+}
+
+func (TrueFilter) compile() (func(fm *filterMessage) bool, error) {
+	return func(*filterMessage) bool { return true }, nil
+}
+
+func (FalseFilter) compile() (func(fm *filterMessage) bool, error) {
+	return func(*filterMessage) bool { return false }, nil
+}
+
+// CreateQueue creates a queue. properties can be nil.
+func (e *Emulator) CreateQueue(name string, properties *QueueProperties) error {
+	if properties == nil {
+		properties = &QueueProperties{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := strings.ToLower(name)
+
+	if e.queues[key] != nil || e.topics[key] != nil {
+		return fmt.Errorf("queue %q: %w", name, errEntityExists)
+	}
+
+	e.queues[key] = newEntity(e, name, entitySettings{
+		lockDuration:           properties.LockDuration,
+		maxDeliveryCount:       properties.MaxDeliveryCount,
+		requiresSession:        properties.RequiresSession,
+		defaultTimeToLive:      properties.DefaultMessageTimeToLive,
+		deadLetterOnExpiration: properties.DeadLetteringOnMessageExpiration,
+	}, nil)
+
+	return nil
+}
+
+// CreateTopic creates a topic. Messages sent to the topic are copied to its subscriptions.
+func (e *Emulator) CreateTopic(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := strings.ToLower(name)
+
+	if e.queues[key] != nil || e.topics[key] != nil {
+		return fmt.Errorf("topic %q: %w", name, errEntityExists)
+	}
+
+	e.topics[key] = &topic{e: e, name: name, subscriptions: map[string]*entity{}}
+	return nil
+}
+
+// CreateSubscription creates a subscription for a topic. properties can be nil.
+func (e *Emulator) CreateSubscription(topicName string, name string, properties *SubscriptionProperties) error {
+	if properties == nil {
+		properties = &SubscriptionProperties{}
+	}
+
+	rules := properties.Rules
+
+	if len(rules) == 0 {
+		rules = []Rule{{Name: "$Default", Filter: TrueFilter{}}}
+	}
+
+	var compiled []compiledRule
+
+	for _, rule := range rules {
+		if rule.Filter == nil {
+			return fmt.Errorf("rule %q has no filter", rule.Name)
+		}
+
+		match, err := rule.Filter.compile()
+
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+
+		compiled = append(compiled, compiledRule{name: rule.Name, match: match})
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.topics[strings.ToLower(topicName)]
+
+	if t == nil {
+		return fmt.Errorf("topic %q does not exist", topicName)
+	}
+
+	key := strings.ToLower(name)
+
+	if t.subscriptions[key] != nil {
+		return fmt.Errorf("subscription %q: %w", name, errEntityExists)
+	}
+
+	sub := newEntity(e, t.name+"/Subscriptions/"+name, entitySettings{
+		lockDuration:           properties.LockDuration,
+		maxDeliveryCount:       properties.MaxDeliveryCount,
+		requiresSession:        properties.RequiresSession,
+		defaultTimeToLive:      properties.DefaultMessageTimeToLive,
+		deadLetterOnExpiration: properties.DeadLetteringOnMessageExpiration,
+	}, t)
+
+	sub.rules = compiled
+	t.subscriptions[key] = sub
+	return nil
+}
+
+type compiledRule struct {
+	name  string
+	match func(fm *filterMessage) bool
+}
+
+type topic struct {
+	e             *Emulator
+	name          string
+	subscriptions map[string]*entity
+
+	lastSequenceNumber int64
+
+	// scheduled are messages sent to the topic, to be copied to the subscriptions when they're due.
+	scheduled []*message
+}
+
+// publishLocked copies a message to each subscription with a matching rule.
+func (t *topic) publishLocked(msg *amqp.Message, sequenceNumber int64) {
+	if sequenceNumber == 0 {
+		sequenceNumber = t.e.newSequenceNumber(&t.lastSequenceNumber)
+	}
+
+	names := make([]string, 0, len(t.subscriptions))
+
+	for name := range t.subscriptions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		sub := t.subscriptions[name]
+
+		if sub.settings.requiresSession && (msg.Properties == nil || msg.Properties.GroupID == nil) {
+			continue
+		}
+
+		size := 0
+
+		if encoded, err := msg.MarshalBinary(); err == nil {
+			size = len(encoded)
+		}
+
+		fm := &filterMessage{msg: msg, sequenceNumber: sequenceNumber, enqueuedTime: t.e.now, size: size}
+
+		for _, rule := range sub.rules {
+			if rule.match(fm) {
+				_, _ = sub.enqueueLocked(msg, sequenceNumber)
+				break
+			}
+		}
+	}
+}
+
+type entitySettings struct {
+	lockDuration           time.Duration
+	maxDeliveryCount       int32
+	requiresSession        bool
+	defaultTimeToLive      time.Duration
+	deadLetterOnExpiration bool
+}
+
+type messageState int
+
+const (
+	stateActive messageState = iota
+	stateDeferred
+	stateScheduled
+)
+
+// message is a message stored in an entity.
+type message struct {
+	// payload is the message, as it was sent, with any properties modified since.
+	payload []byte
+
+	sequenceNumber int64
+	enqueuedTime   time.Time
+	scheduledAt    time.Time
+	expiresAt      time.Time
+	sessionID      *string
+	state          messageState
+
+	// deliveryCount is the number of times the message was delivered, and wasn't settled.
+	deliveryCount uint32
+
+	locked      bool
+	lockToken   amqp.UUID
+	lockedUntil time.Time
+	lockedBy    *receiver
+
+	deadLetterSource string
+}
+
+func (m *message) decode() (*amqp.Message, error) {
+	var msg amqp.Message
+
+	if err := msg.UnmarshalBinary(m.payload); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// modifyLocked updates the message's application properties.
+func (m *message) modifyLocked(properties map[string]any) {
+	if len(properties) == 0 {
+		return
+	}
+
+	msg, err := m.decode()
+
+	if err != nil {
+		return
+	}
+
+	if msg.ApplicationProperties == nil {
+		msg.ApplicationProperties = map[string]any{}
+	}
+
+	for k, v := range properties {
+		msg.ApplicationProperties[k] = v
+	}
+
+	if payload, err := msg.MarshalBinary(); err == nil {
+		m.payload = payload
+	}
+}
+
+// render encodes the message as it's delivered to a receiver, with the broker's annotations.
+func (m *message) render(withLockToken bool) ([]byte, error) {
+	msg, err := m.decode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Annotations == nil {
+		msg.Annotations = amqp.Annotations{}
+	}
+
+	msg.Annotations["x-opt-sequence-number"] = m.sequenceNumber
+	msg.Annotations["x-opt-enqueued-time"] = m.enqueuedTime
+
+	if m.locked {
+		msg.Annotations["x-opt-locked-until"] = m.lockedUntil
+	}
+
+	if m.deadLetterSource != "" {
+		msg.Annotations["x-opt-deadletter-source"] = m.deadLetterSource
+	}
+
+	switch m.state {
+	case stateDeferred:
+		msg.Annotations["x-opt-message-state"] = int64(1)
+	case stateScheduled:
+		msg.Annotations["x-opt-message-state"] = int64(2)
+	}
+
+	if msg.Header == nil {
+		msg.Header = &amqp.MessageHeader{}
+	}
+
+	msg.Header.DeliveryCount = m.deliveryCount
+
+	if msg.Properties == nil {
+		msg.Properties = &amqp.MessageProperties{}
+	}
+
+	if withLockToken {
+		msg.DeliveryAnnotations = amqp.Annotations{"x-opt-lock-token": m.lockToken}
+	}
+
+	return msg.MarshalBinary()
+}
+
+// entity is a queue, subscription or dead letter queue.
+type entity struct {
+	e        *Emulator
+	path     string
+	settings entitySettings
+	topic    *topic
+	rules    []compiledRule
+
+	lastSequenceNumber int64
+
+	// messages are ordered by sequence number.
+	messages  []*message
+	receivers []*receiver
+	sessions  map[string]*session
+
+	// nextReceiver is where dispatch starts, so messages are spread over the receivers.
+	nextReceiver int
+
+	deadLetter         *entity
+	transferDeadLetter *entity
+}
+
+// session is the state of a session, in a session-enabled entity.
+type session struct {
+	id          string
+	state       []byte
+	lastUpdated time.Time
+	lockedBy    *receiver
+	lockedUntil time.Time
+}
+
+func newEntity(e *Emulator, path string, settings entitySettings, t *topic) *entity {
+	if settings.lockDuration <= 0 {
+		settings.lockDuration = defaultLockDuration
+	}
+
+	if settings.maxDeliveryCount <= 0 {
+		settings.maxDeliveryCount = defaultMaxDeliveryCount
+	}
+
+	ent := &entity{e: e, path: path, settings: settings, topic: t, sessions: map[string]*session{}}
+
+	// dead letter queues don't have sessions, or expire messages.
+	dlqSettings := entitySettings{lockDuration: settings.lockDuration, maxDeliveryCount: settings.maxDeliveryCount}
+	ent.deadLetter = &entity{e: e, path: path + "/$DeadLetterQueue", settings: dlqSettings, sessions: map[string]*session{}}
+	ent.transferDeadLetter = &entity{e: e, path: path + "/$Transfer/$DeadLetterQueue", settings: dlqSettings, sessions: map[string]*session{}}
+
+	return ent
+}
+
+// enqueueLocked adds a copy of msg to the entity. The message is scheduled if it has a
+// scheduled enqueue time in the future.
+func (ent *entity) enqueueLocked(msg *amqp.Message, sequenceNumber int64) (*message, error) {
+	payload, err := msg.MarshalBinary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sequenceNumber == 0 {
+		sequenceNumber = ent.e.newSequenceNumber(&ent.lastSequenceNumber)
+	}
+
+	m := &message{
+		payload:        payload,
+		sequenceNumber: sequenceNumber,
+		enqueuedTime:   ent.e.now,
+		state:          stateActive,
+	}
+
+	if msg.Properties != nil && msg.Properties.GroupID != nil {
+		id := *msg.Properties.GroupID
+		m.sessionID = &id
+	}
+
+	if at, ok := msg.Annotations["x-opt-scheduled-enqueue-time"].(time.Time); ok && at.After(ent.e.now) {
+		m.state = stateScheduled
+		m.scheduledAt = at
+		m.enqueuedTime = at.UTC().Truncate(time.Millisecond)
+	}
+
+	ttl := ent.settings.defaultTimeToLive
+
+	if msg.Header != nil && msg.Header.TTL > 0 {
+		ttl = msg.Header.TTL
+	}
+
+	if ttl > 0 {
+		m.expiresAt = m.enqueuedTime.Add(ttl)
+	}
+
+	ent.messages = append(ent.messages, m)
+	sortMessages(ent.messages)
+
+	if m.sessionID != nil {
+		ent.sessionLocked(*m.sessionID)
+	}
+
+	ent.dispatchLocked()
+	ent.e.cond.Broadcast()
+	return m, nil
+}
+
+// sessionLocked gets or creates the session with the given ID.
+func (ent *entity) sessionLocked(id string) *session {
+	s := ent.sessions[id]
+
+	if s == nil {
+		s = &session{id: id}
+		ent.sessions[id] = s
+	}
+
+	return s
+}
+
+func (ent *entity) removeLocked(m *message) {
+	for i, candidate := range ent.messages {
+		if candidate == m {
+			ent.messages = append(ent.messages[:i], ent.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ent *entity) findByLockToken(token amqp.UUID) *message {
+	for _, m := range ent.messages {
+		if m.locked && m.lockToken == token {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (ent *entity) findBySequenceNumber(sequenceNumber int64) *message {
+	for _, m := range ent.messages {
+		if m.sequenceNumber == sequenceNumber {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// lockLocked locks a message, for a receiver in peek-lock mode.
+func (ent *entity) lockLocked(m *message, r *receiver) error {
+	token, err := uuid.New()
+
+	if err != nil {
+		return err
+	}
+
+	m.locked = true
+	m.lockToken = amqp.UUID(token)
+	m.lockedUntil = ent.e.now.Add(ent.settings.lockDuration)
+	m.lockedBy = r
+	return nil
+}
+
+// unlockLocked releases a message's lock. If the delivery failed (the message was
+// abandoned, or its lock expired) it counts as a delivery, and the message is dead lettered
+// once it's been delivered too many times.
+func (ent *entity) unlockLocked(m *message, deliveryFailed bool) {
+	m.locked = false
+	m.lockedBy = nil
+	m.lockToken = amqp.UUID{}
+	m.lockedUntil = time.Time{}
+
+	if !deliveryFailed {
+		return
+	}
+
+	m.deliveryCount++
+
+	if m.state == stateActive && int64(m.deliveryCount) >= int64(ent.settings.maxDeliveryCount) && ent.deadLetter != nil {
+		ent.deadLetterLocked(m, reasonMaxDeliveryCountExceeded,
+			fmt.Sprintf("Message could not be consumed after %d delivery attempts.", ent.settings.maxDeliveryCount), nil)
+	}
+}
+
+// deadLetterLocked moves a message to the entity's dead letter queue.
+func (ent *entity) deadLetterLocked(m *message, reason string, description string, properties map[string]any) {
+	ent.removeLocked(m)
+
+	if ent.deadLetter == nil {
+		// dead lettering a message in a dead letter queue just completes it.
+		return
+	}
+
+	props := map[string]any{}
+
+	for k, v := range properties {
+		props[k] = v
+	}
+
+	props["DeadLetterReason"] = reason
+	props["DeadLetterErrorDescription"] = description
+	m.modifyLocked(props)
+
+	m.locked = false
+	m.lockedBy = nil
+	m.lockToken = amqp.UUID{}
+	m.state = stateActive
+	m.expiresAt = time.Time{}
+	m.deadLetterSource = ent.path
+
+	if ent.topic != nil {
+		// the dead letter source is the subscription's name.
+		m.deadLetterSource = ent.path[strings.LastIndex(ent.path, "/")+1:]
+	}
+
+	dlq := ent.deadLetter
+	dlq.messages = append(dlq.messages, m)
+	sortMessages(dlq.messages)
+	dlq.dispatchLocked()
+}
+
+// refreshLocked expires locks and messages, and activates scheduled messages.
+func (ent *entity) refreshLocked() {
+	now := ent.e.now
+
+	for _, s := range ent.sessions {
+		if s.lockedBy != nil && !s.lockedUntil.After(now) {
+			r := s.lockedBy
+			r.closeLocked()
+			go r.link.Detach(&amqp.Error{Condition: errCondSessionLockLost, Description: "the session lock has expired"})
+		}
+	}
+
+	for _, m := range append([]*message(nil), ent.messages...) {
+		if m.locked && !m.lockedUntil.After(now) {
+			ent.unlockLocked(m, true)
+		}
+
+		if m.state == stateScheduled && !m.scheduledAt.After(now) {
+			m.state = stateActive
+		}
+
+		if m.state != stateScheduled && !m.locked && !m.expiresAt.IsZero() && !m.expiresAt.After(now) && ent.contains(m) {
+			if ent.settings.deadLetterOnExpiration {
+				ent.deadLetterLocked(m, reasonTTLExpired, "The message expired and was dead lettered.", nil)
+			} else {
+				ent.removeLocked(m)
+			}
+		}
+	}
+
+	ent.cleanSessionsLocked()
+	ent.dispatchLocked()
+
+	if ent.deadLetter != nil {
+		ent.deadLetter.refreshLocked()
+		ent.transferDeadLetter.refreshLocked()
+	}
+}
+
+func (ent *entity) contains(m *message) bool {
+	for _, candidate := range ent.messages {
+		if candidate == m {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cleanSessionsLocked forgets sessions that have no messages, state or lock.
+func (ent *entity) cleanSessionsLocked() {
+	active := map[string]bool{}
+
+	for _, m := range ent.messages {
+		if m.sessionID != nil {
+			active[*m.sessionID] = true
+		}
+	}
+
+	for id, s := range ent.sessions {
+		if !active[id] && s.state == nil && s.lockedBy == nil {
+			delete(ent.sessions, id)
+		}
+	}
+}
+
+// available returns true if a message can be delivered to a receiver.
+func (ent *entity) available(m *message, r *receiver) bool {
+	if m.state != stateActive || m.locked {
+		return false
+	}
+
+	if !m.expiresAt.IsZero() && !m.expiresAt.After(ent.e.now) {
+		return false
+	}
+
+	if r.sessionID == nil {
+		return true
+	}
+
+	return m.sessionID != nil && *m.sessionID == *r.sessionID
+}
+
+// dispatchLocked sends messages to receivers that have credit.
+func (ent *entity) dispatchLocked() {
+	for {
+		progress := false
+
+		for i := 0; i < len(ent.receivers); i++ {
+			r := ent.receivers[(ent.nextReceiver+i)%len(ent.receivers)]
+
+			if r.link.Credit() == 0 {
+				continue
+			}
+
+			for _, m := range ent.messages {
+				if !ent.available(m, r) {
+					continue
+				}
+
+				if r.deliverLocked(m) {
+					progress = true
+					ent.nextReceiver = (ent.nextReceiver + i + 1) % len(ent.receivers)
+				}
+
+				break
+			}
+
+			if progress {
+				break
+			}
+		}
+
+		if !progress {
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/emulator"
+)
+
+func Example() {
+	emu, err := emulator.New(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer emu.Close()
+
+	if err := emu.CreateQueue("orders", &emulator.QueueProperties{LockDuration: 30 * time.Second}); err != nil {
+		panic(err)
+	}
+
+	// the client is an ordinary azservicebus.Client, connected to the emulator.
+	client, err := emu.NewClient(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer client.Close(context.TODO())
+
+	sender, err := client.NewSender("orders", nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := sender.SendMessage(context.TODO(), &azservicebus.Message{Body: []byte("order 1")}, nil); err != nil {
+		panic(err)
+	}
+
+	receiver, err := client.NewReceiverForQueue("orders", nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	messages, err := receiver.ReceiveMessages(context.TODO(), 1, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// time only moves when you advance it, so the lock expires exactly when you expect.
+	emu.AdvanceTime(time.Minute)
+
+	err = receiver.CompleteMessage(context.TODO(), messages[0], nil)
+	fmt.Printf("completing after the lock expired fails: %t\n", err != nil)
+
+	// the message is delivered again
+	messages, err = receiver.ReceiveMessages(context.TODO(), 1, nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%s, delivery count %d\n", messages[0].Body, messages[0].DeliveryCount)
+
+	// Output:
+	// completing after the lock expired fails: true
+	// order 1, delivery count 2
+}
+
+func ExampleEmulator_CreateSubscription() {
+	emu, err := emulator.New(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer emu.Close()
+
+	if err := emu.CreateTopic("events"); err != nil {
+		panic(err)
+	}
+
+	err = emu.CreateSubscription("events", "errors", &emulator.SubscriptionProperties{
+		Rules: []emulator.Rule{
+			{Name: "errors", Filter: emulator.SQLFilter{Expression: "level = 'error' OR sys.Label = 'crash'"}},
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	client, err := emu.NewClient(nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer client.Close(context.TODO())
+
+	sender, err := client.NewSender("events", nil)
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, msg := range []*azservicebus.Message{
+		{Body: []byte("disk full"), ApplicationProperties: map[string]any{"level": "error"}},
+		{Body: []byte("started"), ApplicationProperties: map[string]any{"level": "info"}},
+		{Body: []byte("segfault"), Subject: to.Ptr("crash")},
+	} {
+		if err := sender.SendMessage(context.TODO(), msg, nil); err != nil {
+			panic(err)
+		}
+	}
+
+	counts, err := emu.MessageCounts("events/Subscriptions/errors")
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%d messages matched\n", counts.Active)
+
+	// Output:
+	// 2 messages matched
+}
@@ -0,0 +1,654 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/internal/amqpserver"
+	"github.com/Azure/go-amqp"
+)
+
+const (
+	cbsAddress        = "$cbs"
+	managementSuffix  = "/$management"
+	sessionFilterName = "com.microsoft:session-filter"
+
+	// batchMessageFormat is the message format of a batch, where each data section is an encoded message.
+	batchMessageFormat = 0x80013700
+
+	// maxMessageSize is the largest message, or batch, the emulator accepts: the limit for the standard tier.
+	maxMessageSize = 256 * 1024
+
+	// defaultAcceptNextTimeout is how long a session receiver waits for a session, if it doesn't set a timeout.
+	defaultAcceptNextTimeout = time.Minute
+
+	// epochTicks is the Unix epoch in .NET ticks (100ns since 0001-01-01).
+	epochTicks = 621355968000000000
+)
+
+const (
+	errCondLockLost              amqp.ErrCond = "com.microsoft:message-lock-lost"
+	errCondSessionLockLost       amqp.ErrCond = "com.microsoft:session-lock-lost"
+	errCondSessionCannotBeLocked amqp.ErrCond = "com.microsoft:session-cannot-be-locked"
+	errCondTimeout               amqp.ErrCond = "com.microsoft:timeout"
+	errCondEntityNotFound        amqp.ErrCond = amqp.ErrCondNotFound
+	errCondOperationNotAllowed   amqp.ErrCond = amqp.ErrCondNotAllowed
+	errCondMessageSizeExceeded   amqp.ErrCond = amqp.ErrCondMessageSizeExceeded
+	errCondInternalError         amqp.ErrCond = amqp.ErrCondInternalError
+)
+
+// attach is the emulator's [amqpserver.Handler]. It decides what each link the clients
+// attach is connected to.
+func (e *Emulator) attach(link *amqpserver.Link) *amqp.Error {
+	if link.Outgoing {
+		address := ""
+
+		if link.Source != nil {
+			address = link.Source.Address
+		}
+
+		if link.Target != nil && (address == cbsAddress || strings.HasSuffix(address, managementSuffix)) {
+			return e.attachReplyLink(link)
+		}
+
+		return e.attachReceiver(link, address)
+	}
+
+	address := ""
+
+	if link.Target != nil {
+		address = link.Target.Address
+	}
+
+	switch {
+	case address == cbsAddress:
+		link.OnMessage = func(msg *amqpserver.IncomingMessage) amqpserver.DeliveryState {
+			return e.onRequest(msg, e.handleCBS)
+		}
+		return nil
+	case strings.HasSuffix(address, managementSuffix):
+		entityPath := strings.TrimSuffix(address, managementSuffix)
+
+		link.OnMessage = func(msg *amqpserver.IncomingMessage) amqpserver.DeliveryState {
+			return e.onRequest(msg, func(req *amqp.Message) *amqp.Message {
+				return e.handleManagement(entityPath, req)
+			})
+		}
+		return nil
+	default:
+		return e.attachSender(link, address)
+	}
+}
+
+// replyLink is a client's receiver, for the responses to its management and CBS requests.
+type replyLink struct {
+	link    *amqpserver.Link
+	pending [][]byte
+	nextTag uint64
+}
+
+func (rl *replyLink) flushLocked() {
+	for len(rl.pending) > 0 && rl.link != nil {
+		rl.nextTag++
+		tag := make([]byte, 8)
+		binary.BigEndian.PutUint64(tag, rl.nextTag)
+
+		if !rl.link.Send(tag, 0, rl.pending[0], true) {
+			return
+		}
+
+		rl.pending = rl.pending[1:]
+	}
+}
+
+func (e *Emulator) attachReplyLink(link *amqpserver.Link) *amqp.Error {
+	address := link.Target.Address
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rl := e.replyLinks[address]
+
+	if rl == nil {
+		rl = &replyLink{}
+		e.replyLinks[address] = rl
+	}
+
+	rl.link = link
+
+	link.OnCredit = func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		rl.flushLocked()
+	}
+
+	link.OnDetach = func(*amqp.Error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if e.replyLinks[address] == rl {
+			delete(e.replyLinks, address)
+		}
+	}
+
+	return nil
+}
+
+// onRequest handles a request sent to $cbs or $management, and queues the response for the client's reply link.
+func (e *Emulator) onRequest(msg *amqpserver.IncomingMessage, handle func(req *amqp.Message) *amqp.Message) amqpserver.DeliveryState {
+	var req amqp.Message
+
+	if err := req.UnmarshalBinary(msg.Payload); err != nil {
+		return &amqpserver.Rejected{Error: &amqp.Error{Condition: amqp.ErrCondDecodeError, Description: err.Error()}}
+	}
+
+	if req.Properties == nil || req.Properties.ReplyTo == nil {
+		return &amqpserver.Rejected{Error: &amqp.Error{Condition: amqp.ErrCondInvalidField, Description: "the request has no reply-to address"}}
+	}
+
+	resp := handle(&req)
+
+	if resp.Properties == nil {
+		resp.Properties = &amqp.MessageProperties{}
+	}
+
+	resp.Properties.CorrelationID = req.Properties.MessageID
+
+	payload, err := resp.MarshalBinary()
+
+	if err != nil {
+		return &amqpserver.Rejected{Error: &amqp.Error{Condition: errCondInternalError, Description: err.Error()}}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rl := e.replyLinks[*req.Properties.ReplyTo]
+
+	if rl == nil {
+		rl = &replyLink{}
+		e.replyLinks[*req.Properties.ReplyTo] = rl
+	}
+
+	rl.pending = append(rl.pending, payload)
+	rl.flushLocked()
+
+	return &amqpserver.Accepted{}
+}
+
+func newResponse(statusCode int32, description string, value any) *amqp.Message {
+	return &amqp.Message{
+		ApplicationProperties: map[string]any{
+			"statusCode":        statusCode,
+			"statusDescription": description,
+		},
+		Value: value,
+	}
+}
+
+// handleCBS accepts every token. The emulator doesn't check authorization.
+func (e *Emulator) handleCBS(req *amqp.Message) *amqp.Message {
+	return newResponse(202, "Accepted", nil)
+}
+
+func (e *Emulator) attachSender(link *amqpserver.Link, address string) *amqp.Error {
+	e.mu.Lock()
+	_, _, err := e.findSendTargetLocked(address)
+	e.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	link.MaxMessageSize = maxMessageSize
+
+	link.OnMessage = func(msg *amqpserver.IncomingMessage) amqpserver.DeliveryState {
+		if len(msg.Payload) > maxMessageSize {
+			return &amqpserver.Rejected{Error: &amqp.Error{
+				Condition:   errCondMessageSizeExceeded,
+				Description: fmt.Sprintf("the message size (%d bytes) exceeds the limit (%d bytes)", len(msg.Payload), maxMessageSize),
+			}}
+		}
+
+		messages, err := decodeMessages(msg)
+
+		if err != nil {
+			return &amqpserver.Rejected{Error: &amqp.Error{Condition: amqp.ErrCondDecodeError, Description: err.Error()}}
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if _, amqpErr := e.sendLocked(address, messages); amqpErr != nil {
+			return &amqpserver.Rejected{Error: amqpErr}
+		}
+
+		return &amqpserver.Accepted{}
+	}
+
+	return nil
+}
+
+// decodeMessages decodes a message, or the messages in a batch.
+func decodeMessages(msg *amqpserver.IncomingMessage) ([]*amqp.Message, error) {
+	var outer amqp.Message
+
+	if err := outer.UnmarshalBinary(msg.Payload); err != nil {
+		return nil, err
+	}
+
+	if msg.Format != batchMessageFormat {
+		return []*amqp.Message{&outer}, nil
+	}
+
+	messages := make([]*amqp.Message, 0, len(outer.Data))
+
+	for _, data := range outer.Data {
+		var inner amqp.Message
+
+		if err := inner.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, &inner)
+	}
+
+	return messages, nil
+}
+
+// findSendTargetLocked finds the queue or topic a sender sends to.
+func (e *Emulator) findSendTargetLocked(address string) (*entity, *topic, *amqp.Error) {
+	key := strings.ToLower(strings.Trim(address, "/"))
+
+	if q := e.queues[key]; q != nil {
+		return q, nil, nil
+	}
+
+	if t := e.topics[key]; t != nil {
+		return nil, t, nil
+	}
+
+	return nil, nil, &amqp.Error{
+		Condition:   errCondEntityNotFound,
+		Description: fmt.Sprintf("The messaging entity '%s' could not be found.", address),
+	}
+}
+
+// sendLocked enqueues messages in a queue or topic, and returns their sequence numbers.
+func (e *Emulator) sendLocked(address string, messages []*amqp.Message) ([]int64, *amqp.Error) {
+	q, t, amqpErr := e.findSendTargetLocked(address)
+
+	if amqpErr != nil {
+		return nil, amqpErr
+	}
+
+	if q != nil && q.settings.requiresSession {
+		for _, msg := range messages {
+			if msg.Properties == nil || msg.Properties.GroupID == nil {
+				return nil, &amqp.Error{
+					Condition:   errCondOperationNotAllowed,
+					Description: fmt.Sprintf("The SessionId was not set on a message, and it cannot be sent to the entity '%s'. Entities that have session support enabled can only receive messages that have the SessionId set to a valid value.", address),
+				}
+			}
+		}
+	}
+
+	var sequenceNumbers []int64
+
+	for _, msg := range messages {
+		if q != nil {
+			m, err := q.enqueueLocked(msg, 0)
+
+			if err != nil {
+				return nil, &amqp.Error{Condition: errCondInternalError, Description: err.Error()}
+			}
+
+			sequenceNumbers = append(sequenceNumbers, m.sequenceNumber)
+			continue
+		}
+
+		sequenceNumber := e.newSequenceNumber(&t.lastSequenceNumber)
+		sequenceNumbers = append(sequenceNumbers, sequenceNumber)
+
+		if at, ok := msg.Annotations["x-opt-scheduled-enqueue-time"].(time.Time); ok && at.After(e.now) {
+			payload, err := msg.MarshalBinary()
+
+			if err != nil {
+				return nil, &amqp.Error{Condition: errCondInternalError, Description: err.Error()}
+			}
+
+			t.scheduled = append(t.scheduled, &message{payload: payload, sequenceNumber: sequenceNumber, scheduledAt: at, state: stateScheduled})
+			continue
+		}
+
+		t.publishLocked(msg, sequenceNumber)
+	}
+
+	return sequenceNumbers, nil
+}
+
+// receiver is a client's receiver link, for a queue, subscription or dead letter queue.
+type receiver struct {
+	e        *Emulator
+	link     *amqpserver.Link
+	ent      *entity
+	peekLock bool
+
+	// sessionID is the session the receiver has locked, for a session receiver.
+	sessionID *string
+	closed    bool
+
+	nextTag uint64
+}
+
+func (e *Emulator) attachReceiver(link *amqpserver.Link, address string) *amqp.Error {
+	_, isSessionReceiver := link.Source.FilterValue(sessionFilterName)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ent, isDeadLetter, err := e.findEntityLocked(address)
+
+	if err != nil {
+		return &amqp.Error{Condition: errCondEntityNotFound, Description: err.Error()}
+	}
+
+	r := &receiver{e: e, link: link, ent: ent, peekLock: !link.SenderSettled}
+
+	switch {
+	case isSessionReceiver && (isDeadLetter || !ent.settings.requiresSession):
+		return &amqp.Error{
+			Condition:   errCondOperationNotAllowed,
+			Description: fmt.Sprintf("It is not possible for an entity that does not require sessions to create a session receiver: '%s'.", address),
+		}
+	case !isSessionReceiver && !isDeadLetter && ent.settings.requiresSession:
+		return &amqp.Error{
+			Condition:   errCondOperationNotAllowed,
+			Description: fmt.Sprintf("It is not possible for an entity that requires sessions to create a non-sessionful message receiver: '%s'.", address),
+		}
+	case isSessionReceiver:
+		if amqpErr := e.lockSessionLocked(r); amqpErr != nil {
+			return amqpErr
+		}
+	}
+
+	link.OnCredit = func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		r.ent.dispatchLocked()
+	}
+
+	link.OnDisposition = func(tag []byte, state amqpserver.DeliveryState) amqpserver.DeliveryState {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return r.settleLocked(tag, state)
+	}
+
+	link.OnDetach = func(*amqp.Error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		r.closeLocked()
+	}
+
+	ent.receivers = append(ent.receivers, r)
+	e.receivers[link.Name] = r
+	return nil
+}
+
+// lockSessionLocked locks the session a session receiver asked for, or waits for the next
+// available session.
+func (e *Emulator) lockSessionLocked(r *receiver) *amqp.Error {
+	link := r.link
+	requested, _ := link.Source.FilterValue(sessionFilterName)
+
+	if id, ok := requested.(string); ok {
+		s := r.ent.sessionLocked(id)
+
+		if s.lockedBy != nil {
+			return &amqp.Error{
+				Condition:   errCondSessionCannotBeLocked,
+				Description: fmt.Sprintf("The requested session '%s' cannot be accepted. It may be locked by another receiver.", id),
+			}
+		}
+
+		e.acquireSessionLocked(r, s)
+		return nil
+	}
+
+	timeout := defaultAcceptNextTimeout
+
+	if ms, ok := link.Properties["com.microsoft:timeout"].(uint32); ok {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		if s := r.ent.nextAvailableSessionLocked(); s != nil {
+			e.acquireSessionLocked(r, s)
+			return nil
+		}
+
+		// the link can be detached while we wait, ex: the client gave up, or disconnected.
+		if !e.waitLocked(ctx) || link.Detached() {
+			return &amqp.Error{
+				Condition:   errCondTimeout,
+				Description: "The operation did not complete within the allocated time for accepting the next available session.",
+			}
+		}
+	}
+}
+
+func (e *Emulator) acquireSessionLocked(r *receiver, s *session) {
+	id := s.id
+	r.sessionID = &id
+	s.lockedBy = r
+	s.lockedUntil = e.now.Add(r.ent.settings.lockDuration)
+
+	r.link.Source.SetFilterValue(sessionFilterName, id)
+	r.link.ResponseProperties = map[string]any{
+		"com.microsoft:locked-until-utc": toTicks(s.lockedUntil),
+	}
+}
+
+// nextAvailableSessionLocked returns the unlocked session with the oldest message that can be received.
+func (ent *entity) nextAvailableSessionLocked() *session {
+	for _, m := range ent.messages {
+		if m.sessionID == nil || m.state != stateActive || m.locked {
+			continue
+		}
+
+		if s := ent.sessionLocked(*m.sessionID); s.lockedBy == nil {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func toTicks(t time.Time) int64 {
+	return epochTicks + t.UnixMilli()*10000
+}
+
+// lockTokenTag is the delivery tag for a lock token, which Service Bus sends in .NET's GUID byte order.
+func lockTokenTag(token amqp.UUID) []byte {
+	tag := make([]byte, 16)
+	copy(tag, token[:])
+	tag[0], tag[3] = tag[3], tag[0]
+	tag[1], tag[2] = tag[2], tag[1]
+	tag[4], tag[5] = tag[5], tag[4]
+	tag[6], tag[7] = tag[7], tag[6]
+	return tag
+}
+
+func lockTokenFromTag(tag []byte) (amqp.UUID, bool) {
+	if len(tag) != 16 {
+		return amqp.UUID{}, false
+	}
+
+	// the byte swap is its own inverse
+	return amqp.UUID(lockTokenTag(amqp.UUID(tag))), true
+}
+
+// deliverLocked sends a message to the receiver. In receive-and-delete mode the message is
+// deleted, otherwise it's locked.
+func (r *receiver) deliverLocked(m *message) bool {
+	var tag []byte
+
+	if r.peekLock {
+		if err := r.ent.lockLocked(m, r); err != nil {
+			return false
+		}
+
+		tag = lockTokenTag(m.lockToken)
+	} else {
+		r.nextTag++
+		tag = make([]byte, 8)
+		binary.BigEndian.PutUint64(tag, r.nextTag)
+	}
+
+	payload, err := m.render(false)
+
+	if err != nil || !r.link.Send(tag, 0, payload, !r.peekLock) {
+		if r.peekLock {
+			r.ent.unlockLocked(m, false)
+		}
+
+		return false
+	}
+
+	if !r.peekLock {
+		r.ent.removeLocked(m)
+	}
+
+	return true
+}
+
+// settleLocked settles a message the client received on the link. It returns the outcome
+// that's confirmed to the client.
+func (r *receiver) settleLocked(tag []byte, state amqpserver.DeliveryState) amqpserver.DeliveryState {
+	token, ok := lockTokenFromTag(tag)
+
+	if !ok {
+		return state
+	}
+
+	ent := r.ent
+	m := ent.findByLockToken(token)
+
+	if m == nil || !m.lockedUntil.After(r.e.now) {
+		return &amqpserver.Rejected{Error: &amqp.Error{
+			Condition:   errCondLockLost,
+			Description: "The lock supplied is invalid. Either the lock expired, or the message has already been removed from the queue.",
+		}}
+	}
+
+	switch s := state.(type) {
+	case *amqpserver.Accepted:
+		ent.removeLocked(m)
+	case *amqpserver.Released:
+		ent.unlockLocked(m, false)
+	case *amqpserver.Modified:
+		m.modifyLocked(annotationsToProperties(s.Annotations))
+
+		if s.UndeliverableHere {
+			m.state = stateDeferred
+			ent.unlockLocked(m, false)
+		} else {
+			ent.unlockLocked(m, true)
+		}
+	case *amqpserver.Rejected:
+		reason, description := "", ""
+		var properties map[string]any
+
+		if s.Error != nil {
+			for k, v := range s.Error.Info {
+				switch k {
+				case "DeadLetterReason":
+					reason, _ = v.(string)
+				case "DeadLetterErrorDescription":
+					description, _ = v.(string)
+				default:
+					if properties == nil {
+						properties = map[string]any{}
+					}
+					properties[k] = v
+				}
+			}
+		}
+
+		ent.deadLetterLocked(m, reason, description, properties)
+
+		// a rejected outcome with an error is reported to the client as a failure.
+		state = &amqpserver.Rejected{}
+	}
+
+	ent.dispatchLocked()
+	r.e.cond.Broadcast()
+	return state
+}
+
+func annotationsToProperties(annotations map[any]any) map[string]any {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	props := map[string]any{}
+
+	for k, v := range annotations {
+		switch k := k.(type) {
+		case string:
+			props[k] = v
+		case amqp.Symbol:
+			props[string(k)] = v
+		}
+	}
+
+	return props
+}
+
+// closeLocked removes a receiver that's been detached. Its session is unlocked, and the
+// messages it received in the session are abandoned. Locks on other messages remain until
+// they expire, so those messages can still be settled with the management link.
+func (r *receiver) closeLocked() {
+	if r.closed {
+		return
+	}
+
+	r.closed = true
+	ent := r.ent
+
+	for i, candidate := range ent.receivers {
+		if candidate == r {
+			ent.receivers = append(ent.receivers[:i], ent.receivers[i+1:]...)
+			break
+		}
+	}
+
+	if r.e.receivers[r.link.Name] == r {
+		delete(r.e.receivers, r.link.Name)
+	}
+
+	if r.sessionID != nil {
+		if s := ent.sessions[*r.sessionID]; s != nil && s.lockedBy == r {
+			s.lockedBy = nil
+			s.lockedUntil = time.Time{}
+		}
+
+		for _, m := range append([]*message(nil), ent.messages...) {
+			if m.locked && m.lockedBy == r {
+				ent.unlockLocked(m, true)
+			}
+		}
+	}
+
+	ent.dispatchLocked()
+	r.e.cond.Broadcast()
+}
@@ -0,0 +1,397 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+// handleManagement handles a request sent to an entity's $management address.
+func (e *Emulator) handleManagement(entityPath string, req *amqp.Message) *amqp.Message {
+	operation, _ := req.ApplicationProperties["operation"].(string)
+	body, _ := req.Value.(map[string]any)
+	linkName, _ := req.ApplicationProperties["associated-link-name"].(string)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// schedule-message and cancel-scheduled-message are sent to the topic, by senders.
+	switch operation {
+	case "com.microsoft:schedule-message":
+		return e.scheduleMessagesLocked(entityPath, body)
+	case "com.microsoft:cancel-scheduled-message":
+		return e.cancelScheduledMessagesLocked(entityPath, body)
+	}
+
+	ent, _, err := e.findEntityLocked(entityPath)
+
+	if err != nil {
+		return newResponse(404, err.Error(), nil)
+	}
+
+	// the receiver that sent the request, if any. Session receivers only see messages in their session.
+	r := e.receivers[linkName]
+
+	if r != nil && r.ent != ent {
+		r = nil
+	}
+
+	switch operation {
+	case "com.microsoft:renew-lock":
+		return e.renewLocksLocked(ent, body)
+	case "com.microsoft:update-disposition":
+		return e.updateDispositionLocked(ent, body)
+	case "com.microsoft:receive-by-sequence-number":
+		return e.receiveDeferredLocked(ent, r, body)
+	case "com.microsoft:peek-message":
+		return e.peekLocked(ent, r, body)
+	case "com.microsoft:batch-delete-messages":
+		return e.deleteMessagesLocked(ent, body)
+	case "com.microsoft:renew-session-lock":
+		return e.renewSessionLockLocked(ent, body)
+	case "com.microsoft:get-session-state":
+		return e.getSessionStateLocked(ent, body)
+	case "com.microsoft:set-session-state":
+		return e.setSessionStateLocked(ent, body)
+	case "com.microsoft:get-message-sessions":
+		return e.getMessageSessionsLocked(ent, body)
+	}
+
+	return newResponse(501, fmt.Sprintf("The operation %q isn't supported by the emulator.", operation), nil)
+}
+
+func lockLostResponse() *amqp.Message {
+	return newResponse(410, "The lock supplied is invalid. Either the lock expired, or the message has already been removed from the queue.", nil)
+}
+
+func (e *Emulator) lockedMessagesLocked(ent *entity, body map[string]any) ([]*message, bool) {
+	tokens, _ := body["lock-tokens"].([]amqp.UUID)
+	messages := make([]*message, 0, len(tokens))
+
+	for _, token := range tokens {
+		m := ent.findByLockToken(token)
+
+		if m == nil || !m.lockedUntil.After(e.now) {
+			return nil, false
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, true
+}
+
+func (e *Emulator) renewLocksLocked(ent *entity, body map[string]any) *amqp.Message {
+	messages, ok := e.lockedMessagesLocked(ent, body)
+
+	if !ok {
+		return lockLostResponse()
+	}
+
+	expirations := make([]time.Time, 0, len(messages))
+
+	for _, m := range messages {
+		m.lockedUntil = e.now.Add(ent.settings.lockDuration)
+		expirations = append(expirations, m.lockedUntil)
+	}
+
+	return newResponse(200, "OK", map[string]any{"expirations": expirations})
+}
+
+func (e *Emulator) updateDispositionLocked(ent *entity, body map[string]any) *amqp.Message {
+	messages, ok := e.lockedMessagesLocked(ent, body)
+
+	if !ok {
+		return lockLostResponse()
+	}
+
+	status, _ := body["disposition-status"].(string)
+	properties, _ := body["properties-to-modify"].(map[string]any)
+
+	for _, m := range messages {
+		switch status {
+		case "completed":
+			ent.removeLocked(m)
+		case "abandoned":
+			m.modifyLocked(properties)
+			ent.unlockLocked(m, true)
+		case "defered":
+			m.modifyLocked(properties)
+			m.state = stateDeferred
+			ent.unlockLocked(m, false)
+		case "suspended":
+			reason, _ := body["deadletter-reason"].(string)
+			description, _ := body["deadletter-description"].(string)
+			ent.deadLetterLocked(m, reason, description, properties)
+		default:
+			return newResponse(400, fmt.Sprintf("The disposition status %q is invalid.", status), nil)
+		}
+	}
+
+	ent.dispatchLocked()
+	e.cond.Broadcast()
+	return newResponse(200, "OK", nil)
+}
+
+func messagesResponse(rendered [][]byte) *amqp.Message {
+	if len(rendered) == 0 {
+		return newResponse(204, "No Content", nil)
+	}
+
+	messages := make([]any, 0, len(rendered))
+
+	for _, payload := range rendered {
+		messages = append(messages, map[string]any{"message": payload})
+	}
+
+	return newResponse(200, "OK", map[string]any{"messages": messages})
+}
+
+func (e *Emulator) receiveDeferredLocked(ent *entity, r *receiver, body map[string]any) *amqp.Message {
+	sequenceNumbers, _ := body["sequence-numbers"].([]int64)
+	mode, _ := body["receiver-settle-mode"].(uint32)
+	peekLock := mode == 1
+
+	var rendered [][]byte
+
+	for _, sequenceNumber := range sequenceNumbers {
+		m := ent.findBySequenceNumber(sequenceNumber)
+
+		if m == nil || m.state != stateDeferred || m.locked || (r != nil && r.sessionID != nil && (m.sessionID == nil || *m.sessionID != *r.sessionID)) {
+			return newResponse(404, fmt.Sprintf("Failed to lock one or more specified messages. The message with sequence number %d was not found, or isn't deferred.", sequenceNumber), nil)
+		}
+
+		if peekLock {
+			if err := ent.lockLocked(m, nil); err != nil {
+				return newResponse(500, err.Error(), nil)
+			}
+		}
+
+		payload, err := m.render(peekLock)
+
+		if err != nil {
+			return newResponse(500, err.Error(), nil)
+		}
+
+		if !peekLock {
+			ent.removeLocked(m)
+		}
+
+		rendered = append(rendered, payload)
+	}
+
+	return messagesResponse(rendered)
+}
+
+func (e *Emulator) peekLocked(ent *entity, r *receiver, body map[string]any) *amqp.Message {
+	from, _ := body["from-sequence-number"].(int64)
+	count, _ := body["message-count"].(int32)
+
+	var rendered [][]byte
+
+	for _, m := range ent.messages {
+		if len(rendered) >= int(count) {
+			break
+		}
+
+		if m.sequenceNumber < from {
+			continue
+		}
+
+		if r != nil && r.sessionID != nil && (m.sessionID == nil || *m.sessionID != *r.sessionID) {
+			continue
+		}
+
+		// peeked messages don't include the lock.
+		peeked := *m
+		peeked.locked = false
+
+		payload, err := peeked.render(false)
+
+		if err != nil {
+			return newResponse(500, err.Error(), nil)
+		}
+
+		rendered = append(rendered, payload)
+	}
+
+	return messagesResponse(rendered)
+}
+
+func (e *Emulator) deleteMessagesLocked(ent *entity, body map[string]any) *amqp.Message {
+	before, _ := body["enqueued-time-utc"].(time.Time)
+	count, _ := body["message-count"].(int32)
+	deleted := int32(0)
+
+	for _, m := range append([]*message(nil), ent.messages...) {
+		if deleted >= count {
+			break
+		}
+
+		if m.locked || m.state == stateScheduled || !m.enqueuedTime.Before(before) {
+			continue
+		}
+
+		ent.removeLocked(m)
+		deleted++
+	}
+
+	if deleted == 0 {
+		return newResponse(204, "No Content", nil)
+	}
+
+	return newResponse(200, "OK", map[string]any{"message-count": deleted})
+}
+
+func (e *Emulator) scheduleMessagesLocked(entityPath string, body map[string]any) *amqp.Message {
+	entries, _ := body["messages"].([]any)
+	messages := make([]*amqp.Message, 0, len(entries))
+
+	for _, entry := range entries {
+		fields, _ := entry.(map[string]any)
+		encoded, _ := fields["message"].([]byte)
+
+		var msg amqp.Message
+
+		if err := msg.UnmarshalBinary(encoded); err != nil {
+			return newResponse(400, err.Error(), nil)
+		}
+
+		messages = append(messages, &msg)
+	}
+
+	sequenceNumbers, amqpErr := e.sendLocked(entityPath, messages)
+
+	if amqpErr != nil {
+		return newResponse(400, amqpErr.Description, nil)
+	}
+
+	return newResponse(200, "OK", map[string]any{"sequence-numbers": sequenceNumbers})
+}
+
+func (e *Emulator) cancelScheduledMessagesLocked(entityPath string, body map[string]any) *amqp.Message {
+	sequenceNumbers, _ := body["sequence-numbers"].([]int64)
+
+	q, t, amqpErr := e.findSendTargetLocked(entityPath)
+
+	if amqpErr != nil {
+		return newResponse(404, amqpErr.Description, nil)
+	}
+
+	for _, sequenceNumber := range sequenceNumbers {
+		if q != nil {
+			if m := q.findBySequenceNumber(sequenceNumber); m != nil && m.state == stateScheduled {
+				q.removeLocked(m)
+			}
+
+			continue
+		}
+
+		for i, m := range t.scheduled {
+			if m.sequenceNumber == sequenceNumber {
+				t.scheduled = append(t.scheduled[:i], t.scheduled[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return newResponse(200, "OK", nil)
+}
+
+// lockedSessionLocked finds a session that's locked by a receiver.
+func (e *Emulator) lockedSessionLocked(ent *entity, body map[string]any) (*session, *amqp.Message) {
+	id, _ := body["session-id"].(string)
+	s := ent.sessions[id]
+
+	if s == nil || s.lockedBy == nil || !s.lockedUntil.After(e.now) {
+		return nil, newResponse(410, fmt.Sprintf("The session lock has expired on the MessageSession. Accept a new MessageSession. Session ID: %s", id), nil)
+	}
+
+	return s, nil
+}
+
+func (e *Emulator) renewSessionLockLocked(ent *entity, body map[string]any) *amqp.Message {
+	s, errResp := e.lockedSessionLocked(ent, body)
+
+	if errResp != nil {
+		return errResp
+	}
+
+	s.lockedUntil = e.now.Add(ent.settings.lockDuration)
+	return newResponse(200, "OK", map[string]any{"expiration": s.lockedUntil})
+}
+
+func (e *Emulator) getSessionStateLocked(ent *entity, body map[string]any) *amqp.Message {
+	s, errResp := e.lockedSessionLocked(ent, body)
+
+	if errResp != nil {
+		return errResp
+	}
+
+	var state any
+
+	if s.state != nil {
+		state = s.state
+	}
+
+	return newResponse(200, "OK", map[string]any{"session-state": state})
+}
+
+func (e *Emulator) setSessionStateLocked(ent *entity, body map[string]any) *amqp.Message {
+	s, errResp := e.lockedSessionLocked(ent, body)
+
+	if errResp != nil {
+		return errResp
+	}
+
+	state, _ := body["session-state"].([]byte)
+	s.state = state
+	s.lastUpdated = e.now
+	return newResponse(200, "OK", nil)
+}
+
+func (e *Emulator) getMessageSessionsLocked(ent *entity, body map[string]any) *amqp.Message {
+	lastUpdated, _ := body["last-updated-time"].(time.Time)
+	skip, _ := body["skip"].(int32)
+	top, _ := body["top"].(int32)
+
+	// a time in year 10000 (DateTime.MaxValue, for the service) lists every session with
+	// messages or state. Otherwise it lists the sessions with state that changed after that time.
+	listAll := lastUpdated.Year() >= 9999
+
+	withMessages := map[string]bool{}
+
+	for _, m := range ent.messages {
+		if m.sessionID != nil {
+			withMessages[*m.sessionID] = true
+		}
+	}
+
+	var ids []string
+
+	for id, s := range ent.sessions {
+		if listAll && (withMessages[id] || s.state != nil) || !listAll && s.lastUpdated.After(lastUpdated) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return strings.ToLower(ids[i]) < strings.ToLower(ids[j]) })
+
+	if int(skip) >= len(ids) {
+		return newResponse(204, "No Content", nil)
+	}
+
+	ids = ids[skip:]
+
+	if top > 0 && int(top) < len(ids) {
+		ids = ids[:top]
+	}
+
+	return newResponse(200, "OK", map[string]any{"sessions-ids": ids})
+}
@@ -0,0 +1,891 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Azure/go-amqp"
+)
+
+// This file implements the subset of SQL-92 that Service Bus uses for SQL filters:
+// https://learn.microsoft.com/azure/service-bus-messaging/service-bus-messaging-sql-filter
+//
+// Expressions use three-valued logic: comparisons with a missing property are unknown (nil),
+// and a message only matches when the whole expression is true.
+
+// filterMessage is the message a filter is evaluated against.
+type filterMessage struct {
+	msg            *amqp.Message
+	sequenceNumber int64
+	enqueuedTime   time.Time
+	deliveryCount  uint32
+	size           int
+}
+
+func (fm *filterMessage) systemProperty(name string) (any, bool) {
+	props := fm.msg.Properties
+
+	if props == nil {
+		props = &amqp.MessageProperties{}
+	}
+
+	str := func(s *string) any {
+		if s == nil {
+			return nil
+		}
+		return *s
+	}
+
+	switch strings.ToLower(name) {
+	case "messageid":
+		return props.MessageID, true
+	case "correlationid":
+		return props.CorrelationID, true
+	case "to":
+		return str(props.To), true
+	case "replyto":
+		return str(props.ReplyTo), true
+	case "label", "subject":
+		return str(props.Subject), true
+	case "sessionid":
+		return str(props.GroupID), true
+	case "replytosessionid":
+		return str(props.ReplyToGroupID), true
+	case "contenttype":
+		if props.ContentType == nil {
+			return nil, true
+		}
+		return *props.ContentType, true
+	case "sequencenumber":
+		return fm.sequenceNumber, true
+	case "enqueuedtimeutc":
+		return fm.enqueuedTime, true
+	case "deliverycount":
+		return int64(fm.deliveryCount), true
+	case "size":
+		return int64(fm.size), true
+	case "timetolive":
+		if fm.msg.Header == nil || fm.msg.Header.TTL == 0 {
+			return nil, true
+		}
+		return fm.msg.Header.TTL, true
+	}
+
+	return nil, false
+}
+
+func (fm *filterMessage) property(scope string, name string) (any, bool) {
+	if scope == "sys" {
+		return fm.systemProperty(name)
+	}
+
+	v, ok := fm.msg.ApplicationProperties[name]
+	return v, ok
+}
+
+// sqlExpr is a compiled SQL filter expression.
+type sqlExpr func(fm *filterMessage) any
+
+// compileSQLFilter parses a SQL filter expression. Parameters are referenced as @name.
+func compileSQLFilter(expression string, parameters map[string]any) (sqlExpr, error) {
+	tokens, err := tokenizeSQL(expression)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &sqlParser{tokens: tokens, parameters: parameters}
+	expr, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.atEnd() {
+		return nil, fmt.Errorf("unexpected %q in SQL filter %q", p.peek().text, expression)
+	}
+
+	return expr, nil
+}
+
+type sqlTokenKind int
+
+const (
+	tokIdent sqlTokenKind = iota
+	tokNumber
+	tokString
+	tokParam
+	tokOp
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+func tokenizeSQL(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			var sb strings.Builder
+			i++
+
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string in SQL filter %q", s)
+				}
+
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+
+					i++
+					break
+				}
+
+				sb.WriteRune(runes[i])
+				i++
+			}
+
+			tokens = append(tokens, sqlToken{kind: tokString, text: sb.String()})
+		case r == '[':
+			end := strings.IndexRune(string(runes[i:]), ']')
+
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier in SQL filter %q", s)
+			}
+
+			name := string(runes[i:])[1:end]
+			tokens = append(tokens, sqlToken{kind: tokIdent, text: name})
+			i += len([]rune(string(runes[i:])[:end+1]))
+		case r == '@':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokParam, text: string(runes[i:j])})
+			i = j
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'e' || runes[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokNumber, text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokIdent, text: string(runes[i:j])})
+			i = j
+		default:
+			op := string(r)
+
+			if i+1 < len(runes) {
+				if two := string(runes[i : i+2]); two == "<>" || two == "!=" || two == ">=" || two == "<=" {
+					op = two
+				}
+			}
+
+			if !strings.Contains("=<>!+-*/%(),", string(r)) {
+				return nil, fmt.Errorf("unexpected character %q in SQL filter %q", r, s)
+			}
+
+			tokens = append(tokens, sqlToken{kind: tokOp, text: op})
+			i += len([]rune(op))
+		}
+	}
+
+	return tokens, nil
+}
+
+type sqlParser struct {
+	tokens     []sqlToken
+	pos        int
+	parameters map[string]any
+}
+
+func (p *sqlParser) atEnd() bool { return p.pos >= len(p.tokens) }
+
+func (p *sqlParser) peek() sqlToken {
+	if p.atEnd() {
+		return sqlToken{kind: tokOp}
+	}
+
+	return p.tokens[p.pos]
+}
+
+// keyword consumes the next token if it's the (case insensitive) keyword.
+func (p *sqlParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *sqlParser) op(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op && !p.atEnd() {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *sqlParser) expectOp(op string) error {
+	if !p.op(op) {
+		return fmt.Errorf("expected %q in SQL filter", op)
+	}
+
+	return nil
+}
+
+func (p *sqlParser) parseOr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(fm *filterMessage) any {
+			a, b := l(fm), right(fm)
+
+			if a == true || b == true {
+				return true
+			}
+
+			if a == nil || b == nil {
+				return nil
+			}
+
+			return false
+		}
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(fm *filterMessage) any {
+			a, b := l(fm), right(fm)
+
+			if a == false || b == false {
+				return false
+			}
+
+			if a == nil || b == nil {
+				return nil
+			}
+
+			return true
+		}
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fm *filterMessage) any {
+			if b, ok := inner(fm).(bool); ok {
+				return !b
+			}
+
+			return nil
+		}, nil
+	}
+
+	return p.parsePredicate()
+}
+
+func (p *sqlParser) parsePredicate() (sqlExpr, error) {
+	if p.keyword("EXISTS") {
+		return p.parseExists()
+	}
+
+	left, err := p.parseAdditive()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokOp && !p.atEnd() {
+		switch t.text {
+		case "=", "<>", "!=", ">", ">=", "<", "<=":
+			p.pos++
+			right, err := p.parseAdditive()
+
+			if err != nil {
+				return nil, err
+			}
+
+			return compareExpr(t.text, left, right), nil
+		}
+	}
+
+	if p.keyword("IS") {
+		negate := p.keyword("NOT")
+
+		if !p.keyword("NULL") {
+			return nil, fmt.Errorf("expected NULL after IS in SQL filter")
+		}
+
+		return func(fm *filterMessage) any {
+			return (left(fm) == nil) != negate
+		}, nil
+	}
+
+	negate := p.keyword("NOT")
+
+	switch {
+	case p.keyword("IN"):
+		return p.parseIn(left, negate)
+	case p.keyword("LIKE"):
+		return p.parseLike(left, negate)
+	case negate:
+		return nil, fmt.Errorf("expected IN or LIKE after NOT in SQL filter")
+	}
+
+	return func(fm *filterMessage) any {
+		// a bare value is only valid if it's a boolean
+		if b, ok := left(fm).(bool); ok {
+			return b
+		}
+
+		return nil
+	}, nil
+}
+
+func (p *sqlParser) parseExists() (sqlExpr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("expected a property name in EXISTS in SQL filter")
+	}
+
+	p.pos++
+
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	scope, name := splitPropertyName(t.text)
+
+	return func(fm *filterMessage) any {
+		v, ok := fm.property(scope, name)
+		return ok && (scope != "sys" || v != nil)
+	}, nil
+}
+
+func (p *sqlParser) parseIn(left sqlExpr, negate bool) (sqlExpr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	var values []sqlExpr
+
+	for {
+		v, err := p.parseAdditive()
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+
+		if p.op(")") {
+			break
+		}
+
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(fm *filterMessage) any {
+		l := left(fm)
+
+		if l == nil {
+			return nil
+		}
+
+		for _, v := range values {
+			if c, ok := compareValues(l, v(fm)); ok && c == 0 {
+				return !negate
+			}
+		}
+
+		return negate
+	}, nil
+}
+
+func (p *sqlParser) parseLike(left sqlExpr, negate bool) (sqlExpr, error) {
+	t := p.peek()
+
+	if t.kind != tokString {
+		return nil, fmt.Errorf("expected a pattern after LIKE in SQL filter")
+	}
+
+	p.pos++
+	escape := rune(0)
+
+	if p.keyword("ESCAPE") {
+		e := p.peek()
+
+		if e.kind != tokString || len([]rune(e.text)) != 1 {
+			return nil, fmt.Errorf("expected a single character after ESCAPE in SQL filter")
+		}
+
+		p.pos++
+		escape = []rune(e.text)[0]
+	}
+
+	re, err := likeToRegexp(t.text, escape)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(fm *filterMessage) any {
+		s, ok := left(fm).(string)
+
+		if !ok {
+			return nil
+		}
+
+		return re.MatchString(s) != negate
+	}, nil
+}
+
+func likeToRegexp(pattern string, escape rune) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	runes := []rune(pattern)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case escape != 0 && r == escape && i+1 < len(runes):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '%':
+			sb.WriteString(".*")
+		case r == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpr, error) {
+	left, err := p.parseMultiplicative()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+
+		if p.atEnd() || t.kind != tokOp || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+
+		p.pos++
+		right, err := p.parseMultiplicative()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = arithmeticExpr(t.text, left, right)
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	left, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+
+		if p.atEnd() || t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+
+		p.pos++
+		right, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = arithmeticExpr(t.text, left, right)
+	}
+}
+
+func (p *sqlParser) parseUnary() (sqlExpr, error) {
+	if p.op("-") {
+		inner, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return arithmeticExpr("-", func(*filterMessage) any { return int64(0) }, inner), nil
+	}
+
+	if p.op("+") {
+		return p.parseUnary()
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *sqlParser) parsePrimary() (sqlExpr, error) {
+	if p.atEnd() {
+		return nil, fmt.Errorf("unexpected end of SQL filter")
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case tokNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return constExpr(i), nil
+		}
+
+		f, err := strconv.ParseFloat(t.text, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in SQL filter", t.text)
+		}
+
+		return constExpr(f), nil
+	case tokString:
+		return constExpr(t.text), nil
+	case tokParam:
+		v, ok := p.parameters[t.text]
+
+		if !ok {
+			v, ok = p.parameters[strings.TrimPrefix(t.text, "@")]
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("no value for parameter %s in SQL filter", t.text)
+		}
+
+		return constExpr(normalizeValue(v)), nil
+	case tokOp:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+
+			return inner, nil
+		}
+
+		return nil, fmt.Errorf("unexpected %q in SQL filter", t.text)
+	}
+
+	switch strings.ToUpper(t.text) {
+	case "TRUE":
+		return constExpr(true), nil
+	case "FALSE":
+		return constExpr(false), nil
+	case "NULL":
+		return constExpr(nil), nil
+	}
+
+	scope, name := splitPropertyName(t.text)
+
+	return func(fm *filterMessage) any {
+		v, _ := fm.property(scope, name)
+		return normalizeValue(v)
+	}, nil
+}
+
+// splitPropertyName splits "sys.Label" or "user.color" into their scope and name. Properties
+// without a scope are user properties.
+func splitPropertyName(name string) (string, string) {
+	if scope, rest, ok := strings.Cut(name, "."); ok {
+		switch strings.ToLower(scope) {
+		case "sys":
+			return "sys", rest
+		case "user":
+			return "user", rest
+		}
+	}
+
+	return "user", name
+}
+
+func constExpr(v any) sqlExpr {
+	return func(*filterMessage) any { return v }
+}
+
+// normalizeValue converts numbers to int64 or float64, so they can be compared.
+func normalizeValue(v any) any {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v)
+		}
+		return int64(v)
+	case float32:
+		return float64(v)
+	case amqp.Symbol:
+		return string(v)
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+
+	return v
+}
+
+// compareValues compares two values, returning false if they can't be compared.
+func compareValues(a, b any) (int, bool) {
+	a, b = normalizeValue(a), normalizeValue(b)
+
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	switch av := a.(type) {
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return cmpOrdered(av, bv), true
+		case float64:
+			return cmpOrdered(float64(av), bv), true
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return cmpOrdered(av, float64(bv)), true
+		case float64:
+			return cmpOrdered(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return av.Compare(bv), true
+		}
+	case time.Duration:
+		if bv, ok := b.(time.Duration); ok {
+			return cmpOrdered(av, bv), true
+		}
+	}
+
+	if a == b {
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func cmpOrdered[T int64 | float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func compareExpr(op string, left, right sqlExpr) sqlExpr {
+	return func(fm *filterMessage) any {
+		c, ok := compareValues(left(fm), right(fm))
+
+		if !ok {
+			return nil
+		}
+
+		switch op {
+		case "=":
+			return c == 0
+		case "<>", "!=":
+			return c != 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		case "<":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}
+}
+
+func arithmeticExpr(op string, left, right sqlExpr) sqlExpr {
+	return func(fm *filterMessage) any {
+		a, b := normalizeValue(left(fm)), normalizeValue(right(fm))
+
+		if op == "+" {
+			if as, ok := a.(string); ok {
+				if bs, ok := b.(string); ok {
+					return as + bs
+				}
+			}
+		}
+
+		ai, aIsInt := a.(int64)
+		bi, bIsInt := b.(int64)
+
+		if aIsInt && bIsInt {
+			switch op {
+			case "+":
+				return ai + bi
+			case "-":
+				return ai - bi
+			case "*":
+				return ai * bi
+			case "/":
+				if bi == 0 {
+					return nil
+				}
+				return ai / bi
+			case "%":
+				if bi == 0 {
+					return nil
+				}
+				return ai % bi
+			}
+		}
+
+		af, ok1 := toFloat(a)
+		bf, ok2 := toFloat(b)
+
+		if !ok1 || !ok2 {
+			return nil
+		}
+
+		switch op {
+		case "+":
+			return af + bf
+		case "-":
+			return af - bf
+		case "*":
+			return af * bf
+		case "/":
+			if bf == 0 {
+				return nil
+			}
+			return af / bf
+		default:
+			if bf == 0 {
+				return nil
+			}
+			return math.Mod(af, bf)
+		}
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package emulator
+
+import (
+	"testing"
+
+	"github.com/Azure/go-amqp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLFilter(t *testing.T) {
+	subject := "paint"
+
+	fm := &filterMessage{
+		msg: &amqp.Message{
+			Properties: &amqp.MessageProperties{
+				MessageID: "message-id",
+				Subject:   &subject,
+			},
+			ApplicationProperties: map[string]any{
+				"color":    "red",
+				"quantity": int32(10),
+				"price":    2.5,
+				"name":     "50% off",
+			},
+		},
+		sequenceNumber: 7,
+	}
+
+	tests := []struct {
+		expression string
+		matches    bool
+	}{
+		{"color = 'red'", true},
+		{"color <> 'red'", false},
+		{"Color = 'red'", false},
+		{"[color] = 'red'", true},
+		{"user.color = 'red'", true},
+		{"sys.Label = 'paint'", true},
+		{"sys.MessageId = 'message-id'", true},
+		{"sys.SequenceNumber >= 7", true},
+		{"quantity > 5 AND price < 3", true},
+		{"quantity * price = 25", true},
+		{"quantity % 3 = 1", true},
+		{"-quantity < 0", true},
+		{"quantity / 4 = 2", true},
+		{"quantity / 4.0 = 2.5", true},
+		{"color IN ('green', 'red')", true},
+		{"color NOT IN ('green', 'red')", false},
+		{"color LIKE 'r%'", true},
+		{"color LIKE 'r_d'", true},
+		{"color NOT LIKE 'b%'", true},
+		{"name LIKE '50!%%' ESCAPE '!'", true},
+		{"name LIKE '50!%' ESCAPE '!'", false},
+		{"EXISTS(color)", true},
+		{"NOT EXISTS(size)", true},
+		{"size IS NULL", true},
+		{"color IS NOT NULL", true},
+		{"size = 'large'", false},
+		{"NOT (size = 'large')", false},
+		{"size = 'large' OR color = 'red'", true},
+		{"size = 'large' AND color = 'red'", false},
+		{"TRUE", true},
+		{"1 = 1", true},
+		{"color = @color", true},
+		{"'it''s' = 'it''s'", true},
+	}
+
+	for _, test := range tests {
+		expr, err := compileSQLFilter(test.expression, map[string]any{"@color": "red"})
+		require.NoError(t, err, test.expression)
+
+		matched, _ := expr(fm).(bool)
+		require.Equal(t, test.matches, matched, test.expression)
+	}
+}
+
+func TestSQLFilter_Errors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"color =",
+		"color = 'red",
+		"(color = 'red'",
+		"color IN ()",
+		"color = @missing",
+		"color = 'red' extra",
+	} {
+		_, err := compileSQLFilter(expression, nil)
+		require.Error(t, err, expression)
+	}
+}
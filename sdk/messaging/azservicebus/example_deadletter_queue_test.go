@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func ExampleClient_NewDeadLetterQueueForQueue() {
+	dlq, err := client.NewDeadLetterQueueForQueue("exampleQueue", nil)
+	exitOnError("Failed to create DeadLetterQueue", err)
+
+	defer func() { _ = dlq.Close(context.TODO()) }()
+
+	filter := &azservicebus.DeadLetterFilter{
+		DeadLetterReason: to.Ptr("MaxDeliveryCountExceeded"),
+	}
+
+	// peek through the dead letter queue, without locking or removing any messages.
+	pager := dlq.NewPeekMessagesPager(&azservicebus.PeekDeadLetterMessagesOptions{
+		Filter: filter,
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(context.TODO())
+		exitOnError("Failed to peek messages", err)
+
+		for _, msg := range page.Messages {
+			fmt.Printf("Message %s was dead-lettered: %s\n", msg.MessageID, *msg.DeadLetterReason)
+		}
+	}
+
+	// send the matching messages back to the queue. Each dead-lettered message is only completed
+	// after its copy has been sent.
+	resp, err := dlq.ResubmitMessages(context.TODO(), &azservicebus.ResubmitMessagesOptions{
+		Filter: filter,
+		Transform: func(msg *azservicebus.ReceivedMessage, resubmit *azservicebus.AMQPAnnotatedMessage) error {
+			resubmit.ApplicationProperties["ResubmittedFromDeadLetter"] = true
+			return nil
+		},
+	})
+	exitOnError("Failed to resubmit messages", err)
+
+	fmt.Printf("Resubmitted %d messages, skipped %d messages\n", resp.Resubmitted, resp.Skipped)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+)
+
+func ExampleClient_NewProcessorForQueue() {
+	processor, err := client.NewProcessorForQueue("exampleQueue", &azservicebus.ProcessorOptions{
+		// up to 10 messages will be handled at the same time.
+		MaxConcurrentCalls: 10,
+		// message locks are renewed, while your handler runs, for up to 10 minutes.
+		MaxAutoLockRenewalDuration: 10 * time.Minute,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Close stops receiving and waits for any in-flight messages to be handled and settled.
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := processor.Close(ctx); err != nil {
+			log.Printf("ERROR: %s", err)
+		}
+	}()
+
+	err = processor.Run(context.TODO(), func(ctx context.Context, args *azservicebus.ProcessMessageArgs) error {
+		fmt.Printf("Received message %s\n", args.Message.MessageID)
+
+		// Returning nil completes the message. Returning an error abandons it, making it
+		// available to be received again.
+		//
+		// You can also settle the message yourself, using the functions on args.
+		if args.Message.DeliveryCount > 5 {
+			return args.DeadLetterMessage(ctx, nil)
+		}
+
+		return nil
+	}, func(ctx context.Context, args *azservicebus.ProcessErrorArgs) {
+		//  TODO: Update the following line with your application specific error handling logic
+		log.Printf("ERROR (%s): %s", args.ErrorSource, args.Err)
+	})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ExampleClient_NewSessionProcessorForQueue() {
+	processor, err := client.NewSessionProcessorForQueue("exampleSessionQueue", &azservicebus.SessionProcessorOptions{
+		// up to 4 sessions will be processed at the same time. Messages within a session
+		// are handled one at a time, in order.
+		MaxConcurrentSessions: 4,
+		// sessions that don't receive a message for 30 seconds are closed, so the next
+		// available session can be accepted.
+		SessionIdleTimeout: 30 * time.Second,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = processor.Run(context.TODO(), func(ctx context.Context, args *azservicebus.ProcessMessageArgs) error {
+		fmt.Printf("Received message %s from session %s\n", args.Message.MessageID, *args.SessionID)
+		return args.SetSessionState(ctx, []byte(args.Message.MessageID), nil)
+	}, nil)
+
+	if err != nil {
+		panic(err)
+	}
+}
@@ -330,3 +330,26 @@ func Example_settleWithLockToken() {
 		fmt.Printf("Received and completed the message\n")
 	}
 }
+
+func ExampleReceiver_PurgeMessages() {
+	deadLetterReceiver, err := client.NewReceiverForQueue(
+		"exampleQueue",
+		&azservicebus.ReceiverOptions{
+			SubQueue: azservicebus.SubQueueDeadLetter,
+		},
+	)
+	exitOnError("Failed to create Receiver for DeadLetterQueue", err)
+
+	defer func() { _ = deadLetterReceiver.Close(context.TODO()) }()
+
+	// deletes every message that was dead-lettered more than a day ago, in batches of up to 4000
+	// messages. Messages are deleted on the service, without being received.
+	cutoff := time.Now().Add(-24 * time.Hour)
+
+	deleted, err := deadLetterReceiver.PurgeMessages(context.TODO(), &azservicebus.PurgeMessagesOptions{
+		BeforeEnqueueTime: &cutoff,
+	})
+	exitOnError("Failed to purge messages", err)
+
+	fmt.Printf("Deleted %d messages\n", deleted)
+}
@@ -18,6 +18,7 @@ require (
 )
 
 require (
+	github.com/Azure/azure-sdk-for-go/sdk/storage/azblob v1.8.0
 	github.com/coder/websocket v1.8.15
 	github.com/golang/mock v1.6.0
 )
@@ -0,0 +1,536 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package amqpserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+// This file has a small AMQP 1.0 type system codec. It only needs to handle the
+// performatives, terminus and delivery state types - message sections are encoded
+// and decoded using go-amqp's [amqp.Message].
+
+// described is an AMQP described type.
+type described struct {
+	descriptor any
+	value      any
+}
+
+// array is an AMQP array. Decoded arrays are returned as their natural Go slice type
+// when the element type is known (ex: []amqp.Symbol), otherwise as an array.
+type array []any
+
+var errBufferTooSmall = errors.New("amqp: buffer too small")
+
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errBufferTooSmall
+	}
+
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.next(1)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+func (d *decoder) readValue() (any, error) {
+	code, err := d.readByte()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if code == 0x00 {
+		descriptor, err := d.readValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := d.readValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return described{descriptor: descriptor, value: value}, nil
+	}
+
+	return d.readWithCode(code)
+}
+
+func (d *decoder) readWithCode(code byte) (any, error) {
+	fixed := func(n int) ([]byte, error) { return d.next(n) }
+
+	switch code {
+	case 0x40:
+		return nil, nil
+	case 0x41:
+		return true, nil
+	case 0x42:
+		return false, nil
+	case 0x56:
+		b, err := d.readByte()
+		return b != 0, err
+	case 0x50:
+		return d.readByte()
+	case 0x60:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.Uint16(b), nil
+	case 0x70:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.Uint32(b), nil
+	case 0x52:
+		b, err := d.readByte()
+		return uint32(b), err
+	case 0x43:
+		return uint32(0), nil
+	case 0x80:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	case 0x53:
+		b, err := d.readByte()
+		return uint64(b), err
+	case 0x44:
+		return uint64(0), nil
+	case 0x51:
+		b, err := d.readByte()
+		return int8(b), err
+	case 0x61:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return int16(binary.BigEndian.Uint16(b)), nil
+	case 0x71:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return int32(binary.BigEndian.Uint32(b)), nil
+	case 0x54:
+		b, err := d.readByte()
+		return int32(int8(b)), err
+	case 0x81:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case 0x55:
+		b, err := d.readByte()
+		return int64(int8(b)), err
+	case 0x72:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case 0x82:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0x73:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return rune(binary.BigEndian.Uint32(b)), nil
+	case 0x74:
+		return fixed(4)
+	case 0x84:
+		return fixed(8)
+	case 0x94:
+		return fixed(16)
+	case 0x83:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return time.UnixMilli(int64(binary.BigEndian.Uint64(b))).UTC(), nil
+	case 0x98:
+		b, err := fixed(16)
+		if err != nil {
+			return nil, err
+		}
+		var u amqp.UUID
+		copy(u[:], b)
+		return u, nil
+	case 0xa0, 0xa1, 0xa3, 0xb0, 0xb1, 0xb3:
+		n, err := d.readSize(code&0xf0 == 0xb0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		switch code & 0x0f {
+		case 0x0:
+			return append([]byte(nil), b...), nil
+		case 0x1:
+			return string(b), nil
+		default:
+			return amqp.Symbol(b), nil
+		}
+	case 0x45:
+		return []any{}, nil
+	case 0xc0, 0xd0:
+		return d.readCompound(code == 0xd0, false)
+	case 0xc1, 0xd1:
+		items, err := d.readCompound(code == 0xd1, true)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[any]any, len(items)/2)
+		for i := 0; i+1 < len(items); i += 2 {
+			m[items[i]] = items[i+1]
+		}
+		return m, nil
+	case 0xe0, 0xf0:
+		return d.readArray(code == 0xf0)
+	default:
+		return nil, fmt.Errorf("amqp: unsupported type code 0x%02x", code)
+	}
+}
+
+func (d *decoder) readSize(wide bool) (int, error) {
+	if wide {
+		b, err := d.next(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+
+	b, err := d.readByte()
+	return int(b), err
+}
+
+func (d *decoder) readCompound(wide bool, isMap bool) ([]any, error) {
+	size, err := d.readSize(wide)
+
+	if err != nil {
+		return nil, err
+	}
+
+	end := d.pos + size
+
+	count, err := d.readSize(wide)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isMap && count%2 != 0 {
+		return nil, errors.New("amqp: invalid map count")
+	}
+
+	items := make([]any, 0, count)
+
+	for i := 0; i < count; i++ {
+		v, err := d.readValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, v)
+	}
+
+	if d.pos != end {
+		return nil, errors.New("amqp: invalid compound size")
+	}
+
+	return items, nil
+}
+
+func (d *decoder) readArray(wide bool) (any, error) {
+	if _, err := d.readSize(wide); err != nil {
+		return nil, err
+	}
+
+	count, err := d.readSize(wide)
+
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := d.readByte()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptor any
+
+	if code == 0x00 {
+		if descriptor, err = d.readValue(); err != nil {
+			return nil, err
+		}
+
+		if code, err = d.readByte(); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make(array, 0, count)
+
+	for i := 0; i < count; i++ {
+		v, err := d.readWithCode(code)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if descriptor != nil {
+			v = described{descriptor: descriptor, value: v}
+		}
+
+		items = append(items, v)
+	}
+
+	if code == 0xa3 || code == 0xb3 {
+		symbols := make([]amqp.Symbol, len(items))
+
+		for i, v := range items {
+			symbols[i], _ = v.(amqp.Symbol)
+		}
+
+		return symbols, nil
+	}
+
+	return items, nil
+}
+
+// encoder appends AMQP encoded values to buf.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) writeByte(b byte) { e.buf = append(e.buf, b) }
+
+func (e *encoder) writeUint32(v uint32) { e.buf = binary.BigEndian.AppendUint32(e.buf, v) }
+
+func (e *encoder) writeValue(v any) error {
+	switch v := v.(type) {
+	case nil:
+		e.writeByte(0x40)
+	case bool:
+		if v {
+			e.writeByte(0x41)
+		} else {
+			e.writeByte(0x42)
+		}
+	case uint8:
+		e.buf = append(e.buf, 0x50, v)
+	case uint16:
+		e.writeByte(0x60)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, v)
+	case uint32:
+		switch {
+		case v == 0:
+			e.writeByte(0x43)
+		case v < 256:
+			e.buf = append(e.buf, 0x52, byte(v))
+		default:
+			e.writeByte(0x70)
+			e.writeUint32(v)
+		}
+	case uint64:
+		switch {
+		case v == 0:
+			e.writeByte(0x44)
+		case v < 256:
+			e.buf = append(e.buf, 0x53, byte(v))
+		default:
+			e.writeByte(0x80)
+			e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+		}
+	case int8:
+		e.buf = append(e.buf, 0x51, byte(v))
+	case int16:
+		e.writeByte(0x61)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+	case int32:
+		if v >= math.MinInt8 && v <= math.MaxInt8 {
+			e.buf = append(e.buf, 0x54, byte(v))
+		} else {
+			e.writeByte(0x71)
+			e.writeUint32(uint32(v))
+		}
+	case int64:
+		if v >= math.MinInt8 && v <= math.MaxInt8 {
+			e.buf = append(e.buf, 0x55, byte(v))
+		} else {
+			e.writeByte(0x81)
+			e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+		}
+	case int:
+		return e.writeValue(int64(v))
+	case float32:
+		e.writeByte(0x72)
+		e.writeUint32(math.Float32bits(v))
+	case float64:
+		e.writeByte(0x82)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+	case time.Time:
+		e.writeByte(0x83)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v.UnixMilli()))
+	case amqp.UUID:
+		e.writeByte(0x98)
+		e.buf = append(e.buf, v[:]...)
+	case []byte:
+		e.writeVariable(0xa0, v)
+	case string:
+		e.writeVariable(0xa1, []byte(v))
+	case amqp.Symbol:
+		e.writeVariable(0xa3, []byte(v))
+	case amqp.ErrCond:
+		e.writeVariable(0xa3, []byte(v))
+	case []amqp.Symbol:
+		return e.writeSymbolArray(v)
+	case []any:
+		return e.writeList(v)
+	case map[any]any:
+		items := make([]any, 0, len(v)*2)
+		for k, val := range v {
+			items = append(items, k, val)
+		}
+		return e.writeCompound(0xc1, 0xd1, items)
+	case map[amqp.Symbol]any:
+		items := make([]any, 0, len(v)*2)
+		for k, val := range v {
+			items = append(items, k, val)
+		}
+		return e.writeCompound(0xc1, 0xd1, items)
+	case map[string]any:
+		// maps with string keys are fields (ex: link properties and error info), which use symbol keys.
+		items := make([]any, 0, len(v)*2)
+		for k, val := range v {
+			items = append(items, amqp.Symbol(k), val)
+		}
+		return e.writeCompound(0xc1, 0xd1, items)
+	case described:
+		e.writeByte(0x00)
+		if err := e.writeValue(v.descriptor); err != nil {
+			return err
+		}
+		return e.writeValue(v.value)
+	case *amqp.Error:
+		if v == nil {
+			e.writeByte(0x40)
+			return nil
+		}
+		return e.writeValue(described{descriptor: codeError, value: []any{amqp.Symbol(v.Condition), stringOrNil(v.Description), mapOrNil(v.Info)}})
+	default:
+		return fmt.Errorf("amqp: unsupported type %T", v)
+	}
+
+	return nil
+}
+
+func (e *encoder) writeVariable(code byte, b []byte) {
+	if len(b) < 256 {
+		e.buf = append(e.buf, code, byte(len(b)))
+	} else {
+		e.writeByte(code | 0x10)
+		e.writeUint32(uint32(len(b)))
+	}
+
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeList(items []any) error {
+	if len(items) == 0 {
+		e.writeByte(0x45)
+		return nil
+	}
+
+	return e.writeCompound(0xc0, 0xd0, items)
+}
+
+func (e *encoder) writeCompound(code8, code32 byte, items []any) error {
+	inner := encoder{}
+
+	for _, item := range items {
+		if err := inner.writeValue(item); err != nil {
+			return err
+		}
+	}
+
+	if len(inner.buf)+1 < 256 && len(items) < 256 {
+		e.buf = append(e.buf, code8, byte(len(inner.buf)+1), byte(len(items)))
+	} else {
+		e.writeByte(code32)
+		e.writeUint32(uint32(len(inner.buf) + 4))
+		e.writeUint32(uint32(len(items)))
+	}
+
+	e.buf = append(e.buf, inner.buf...)
+	return nil
+}
+
+func (e *encoder) writeSymbolArray(symbols []amqp.Symbol) error {
+	inner := encoder{}
+
+	for _, s := range symbols {
+		inner.writeUint32(uint32(len(s)))
+		inner.buf = append(inner.buf, s...)
+	}
+
+	e.writeByte(0xf0)
+	e.writeUint32(uint32(len(inner.buf) + 5))
+	e.writeUint32(uint32(len(symbols)))
+	e.writeByte(0xb3)
+	e.buf = append(e.buf, inner.buf...)
+	return nil
+}
+
+func stringOrNil(s string) any {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+func mapOrNil(m map[string]any) any {
+	if m == nil {
+		return nil
+	}
+
+	return m
+}
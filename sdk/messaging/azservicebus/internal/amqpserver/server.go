@@ -0,0 +1,1130 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package amqpserver is a minimal, in-process AMQP 1.0 server. It handles the connection,
+// session and link protocol (SASL ANONYMOUS, flow control, multi-frame transfers and
+// settlement) and leaves the behavior of each link to a [Handler].
+package amqpserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+const (
+	// maxFrameSize is the largest frame the server accepts, and the most it sends.
+	maxFrameSize = 65536
+
+	// linkCredit is the credit the server grants to clients that send on a link.
+	linkCredit = 1000
+
+	// sessionWindow is the incoming and outgoing window the server advertises.
+	sessionWindow = math.MaxInt32
+)
+
+var (
+	protoSASL = []byte{'A', 'M', 'Q', 'P', 3, 1, 0, 0}
+	protoAMQP = []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+)
+
+// Handler decides what happens on the links that clients attach.
+type Handler interface {
+	// Attach is called, on its own goroutine, when a client attaches a link. It can block, for
+	// instance to wait for a resource to become available. It sets the callbacks on link, and
+	// returns an error to refuse the link.
+	Attach(link *Link) *amqp.Error
+}
+
+// HandlerFunc is a function that implements [Handler].
+type HandlerFunc func(link *Link) *amqp.Error
+
+// Attach calls f(link).
+func (f HandlerFunc) Attach(link *Link) *amqp.Error {
+	return f(link)
+}
+
+// Server accepts AMQP connections on a listener.
+type Server struct {
+	handler  Handler
+	listener net.Listener
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Listen starts a Server, listening on addr (ex: "127.0.0.1:0").
+func Listen(addr string, handler Handler) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		handler:  handler,
+		listener: l,
+		conns:    map[*conn]struct{}{},
+	}
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		s.acceptLoop()
+	}()
+
+	return s, nil
+}
+
+// Addr is the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// CloseConnections closes all the open connections, with the given error. Clients see
+// this as a connection failure, and reconnect.
+func (s *Server) CloseConnections(err *amqp.Error) {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.close(err)
+	}
+}
+
+// Close stops listening and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.CloseConnections(nil)
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) acceptLoop() {
+	for {
+		netConn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		c := newConn(s, netConn)
+
+		s.mu.Lock()
+
+		if s.closed {
+			s.mu.Unlock()
+			_ = netConn.Close()
+			return
+		}
+
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+type conn struct {
+	server  *Server
+	netConn net.Conn
+
+	// mu guards the connection, session and link state.
+	mu           sync.Mutex
+	sessions     map[uint16]*session
+	peerMaxFrame uint32
+	closing      bool
+
+	writeMu    sync.Mutex
+	writeCond  *sync.Cond
+	writeQueue [][]byte
+	writeDone  bool
+
+	done chan struct{}
+}
+
+func newConn(s *Server, netConn net.Conn) *conn {
+	c := &conn{
+		server:       s,
+		netConn:      netConn,
+		sessions:     map[uint16]*session{},
+		peerMaxFrame: maxFrameSize,
+		done:         make(chan struct{}),
+	}
+
+	c.writeCond = sync.NewCond(&c.writeMu)
+	return c
+}
+
+type session struct {
+	channel uint16
+	links   map[uint32]*Link
+
+	nextIncomingID       uint32
+	nextOutgoingID       uint32
+	remoteIncomingWindow uint32
+	nextDeliveryID       uint32
+
+	// pending holds transfer frames waiting for the client's incoming window to open.
+	pending [][]byte
+
+	unsettled map[uint32]*outgoingDelivery
+}
+
+type outgoingDelivery struct {
+	link *Link
+	tag  []byte
+}
+
+func (c *conn) serve() {
+	writerDone := make(chan struct{})
+
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+
+	err := c.handshake()
+
+	if err == nil {
+		err = c.readLoop()
+	}
+
+	c.teardown()
+
+	c.writeMu.Lock()
+	c.writeDone = true
+	c.writeCond.Broadcast()
+	c.writeMu.Unlock()
+
+	<-writerDone
+	_ = c.netConn.Close()
+	close(c.done)
+}
+
+func (c *conn) handshake() error {
+	header := make([]byte, 8)
+
+	if _, err := io.ReadFull(c.netConn, header); err != nil {
+		return err
+	}
+
+	if string(header) == string(protoSASL) {
+		c.writeRaw(protoSASL)
+
+		if err := c.writeFrame(frameTypeSASL, 0, codeSASLMechanisms, []amqp.Symbol{"ANONYMOUS", "MSSBCBS"}); err != nil {
+			return err
+		}
+
+		// sasl-init. Any mechanism is accepted - authorization happens with CBS.
+		if _, _, _, err := c.readFrame(); err != nil {
+			return err
+		}
+
+		if err := c.writeFrame(frameTypeSASL, 0, codeSASLOutcome, uint8(0)); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(c.netConn, header); err != nil {
+			return err
+		}
+	}
+
+	if string(header) != string(protoAMQP) {
+		c.writeRaw(protoAMQP)
+		return errors.New("amqp: unsupported protocol header")
+	}
+
+	c.writeRaw(protoAMQP)
+	return nil
+}
+
+func (c *conn) readFrame() (uint8, uint16, []byte, error) {
+	header := make([]byte, 8)
+
+	if _, err := io.ReadFull(c.netConn, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	doff := uint32(header[4]) * 4
+
+	if size < 8 || size > maxFrameSize || doff < 8 || doff > size {
+		return 0, 0, nil, errors.New("amqp: invalid frame header")
+	}
+
+	body := make([]byte, size-8)
+
+	if _, err := io.ReadFull(c.netConn, body); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[5], binary.BigEndian.Uint16(header[6:8]), body[doff-8:], nil
+}
+
+func (c *conn) readLoop() error {
+	for {
+		_, channel, body, err := c.readFrame()
+
+		if err != nil {
+			return err
+		}
+
+		if len(body) == 0 {
+			// heartbeat
+			continue
+		}
+
+		p, payload, err := decodePerformative(body)
+
+		if err != nil {
+			c.close(&amqp.Error{Condition: amqp.ErrCondDecodeError, Description: err.Error()})
+			return err
+		}
+
+		switch p.code {
+		case codeOpen:
+			c.onOpen(p)
+		case codeBegin:
+			c.onBegin(channel, p)
+		case codeAttach:
+			c.onAttach(channel, p)
+		case codeFlow:
+			c.onFlow(channel, p)
+		case codeTransfer:
+			c.onTransfer(channel, p, payload)
+		case codeDisposition:
+			c.onDisposition(channel, p)
+		case codeDetach:
+			c.onDetach(channel, p)
+		case codeEnd:
+			c.onEnd(channel)
+		case codeClose:
+			_ = c.writeFrame(frameTypeAMQP, 0, codeClose)
+			return nil
+		}
+	}
+}
+
+func (c *conn) onOpen(p performative) {
+	c.mu.Lock()
+
+	if v, ok := p.uint32(2); ok && v < c.peerMaxFrame {
+		c.peerMaxFrame = v
+	}
+
+	c.mu.Unlock()
+
+	_ = c.writeFrame(frameTypeAMQP, 0, codeOpen, "emulator", nil, uint32(maxFrameSize), uint16(math.MaxUint16))
+
+	if idle, ok := p.uint32(4); ok && idle > 0 {
+		go c.heartbeats(time.Duration(idle) * time.Millisecond / 2)
+	}
+}
+
+func (c *conn) heartbeats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.writeRaw([]byte{0, 0, 0, 8, 2, 0, 0, 0})
+		}
+	}
+}
+
+func (c *conn) onBegin(channel uint16, p performative) {
+	nextOutgoingID, _ := p.uint32(1)
+	incomingWindow, _ := p.uint32(2)
+
+	c.mu.Lock()
+	c.sessions[channel] = &session{
+		channel:              channel,
+		links:                map[uint32]*Link{},
+		nextIncomingID:       nextOutgoingID,
+		remoteIncomingWindow: incomingWindow,
+		unsettled:            map[uint32]*outgoingDelivery{},
+	}
+	c.mu.Unlock()
+
+	_ = c.writeFrame(frameTypeAMQP, channel, codeBegin, channel, uint32(0), uint32(sessionWindow), uint32(sessionWindow), uint32(math.MaxUint32))
+}
+
+func (c *conn) onEnd(channel uint16) {
+	c.mu.Lock()
+	s := c.sessions[channel]
+	delete(c.sessions, channel)
+
+	var detached []*Link
+
+	if s != nil {
+		for _, l := range s.links {
+			if !l.detached {
+				l.detached = true
+
+				if l.attached {
+					detached = append(detached, l)
+				}
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, l := range detached {
+		l.notifyDetached(nil)
+	}
+
+	_ = c.writeFrame(frameTypeAMQP, channel, codeEnd)
+}
+
+func (c *conn) onAttach(channel uint16, p performative) {
+	c.mu.Lock()
+	s := c.sessions[channel]
+	c.mu.Unlock()
+
+	if s == nil {
+		return
+	}
+
+	name, _ := p.field(0).(string)
+	handle, _ := p.uint32(1)
+	initialDeliveryCount, _ := p.uint32(9)
+	capabilities, _ := p.field(12).([]amqp.Symbol)
+
+	if capability, ok := p.field(12).(amqp.Symbol); ok {
+		capabilities = []amqp.Symbol{capability}
+	}
+
+	l := &Link{
+		Name:                name,
+		Outgoing:            p.bool(2),
+		Source:              parseTerminus(p.field(5)),
+		Target:              parseTerminus(p.field(6)),
+		Properties:          stringMap(p.field(13)),
+		DesiredCapabilities: capabilities,
+
+		conn:             c,
+		session:          s,
+		handle:           handle,
+		sndSettleMode:    p.field(3),
+		rcvSettleMode:    p.field(4),
+		peerInitialCount: initialDeliveryCount,
+	}
+
+	if mode, ok := p.field(4).(uint8); ok && mode == 1 {
+		l.ReceiverSettleModeSecond = true
+	}
+
+	if mode, ok := p.field(3).(uint8); ok && mode == 1 {
+		l.SenderSettled = true
+	}
+
+	c.mu.Lock()
+	s.links[handle] = l
+	c.mu.Unlock()
+
+	go c.completeAttach(l)
+}
+
+func (c *conn) completeAttach(l *Link) {
+	attachErr := c.server.handler.Attach(l)
+
+	c.mu.Lock()
+
+	if l.detached {
+		// the connection or session ended before we responded.
+		c.mu.Unlock()
+
+		if attachErr == nil {
+			l.notifyDetached(&amqp.Error{Condition: amqp.ErrCondConnectionForced})
+		}
+
+		return
+	}
+
+	ourRole := !l.Outgoing
+
+	if attachErr != nil {
+		// refuse the link: an attach without a terminus, followed by a detach with the error.
+		_ = c.writeFrameLocked(l.session.channel, codeAttach, l.Name, l.handle, ourRole, l.sndSettleMode, l.rcvSettleMode)
+		l.detached = true
+		l.detachSent = true
+		_ = c.writeFrameLocked(l.session.channel, codeDetach, l.handle, true, attachErr)
+		c.mu.Unlock()
+		return
+	}
+
+	var initialDeliveryCount, maxMessageSize any
+
+	if l.Outgoing {
+		initialDeliveryCount = uint32(0)
+	}
+
+	if l.MaxMessageSize > 0 {
+		maxMessageSize = l.MaxMessageSize
+	}
+
+	var props any
+
+	if l.ResponseProperties != nil {
+		props = l.ResponseProperties
+	}
+
+	_ = c.writeFrameLocked(l.session.channel, codeAttach, l.Name, l.handle, ourRole, l.sndSettleMode, l.rcvSettleMode,
+		l.Source.encode(), l.Target.encode(), nil, nil, initialDeliveryCount, maxMessageSize, nil, nil, props)
+
+	l.attached = true
+
+	if !l.Outgoing {
+		l.deliveryCount = l.peerInitialCount
+		l.credit = linkCredit
+		l.writeFlowLocked(false)
+	}
+
+	c.mu.Unlock()
+
+	if l.Outgoing {
+		// a client can issue credit before the attach completes.
+		l.notifyCredit()
+	}
+}
+
+func (c *conn) onFlow(channel uint16, p performative) {
+	c.mu.Lock()
+	s := c.sessions[channel]
+
+	if s == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	nextIncomingID, _ := p.uint32(0)
+	incomingWindow, _ := p.uint32(1)
+	s.remoteIncomingWindow = nextIncomingID + incomingWindow - s.nextOutgoingID
+	c.flushPendingLocked(s)
+
+	handle, hasHandle := p.uint32(4)
+
+	if !hasHandle {
+		c.mu.Unlock()
+		return
+	}
+
+	l := s.links[handle]
+
+	if l == nil || l.detached || !l.Outgoing {
+		c.mu.Unlock()
+		return
+	}
+
+	attached := l.attached
+	deliveryCount, ok := p.uint32(5)
+
+	if !ok {
+		deliveryCount = 0
+	}
+
+	credit, _ := p.uint32(6)
+	l.credit = deliveryCount + credit - l.deliveryCount
+	drain := p.bool(8)
+	c.mu.Unlock()
+
+	if !attached {
+		// completeAttach checks for credit once the link is attached.
+		return
+	}
+
+	l.notifyCredit()
+
+	if drain {
+		c.mu.Lock()
+
+		if !l.detached {
+			l.deliveryCount += l.credit
+			l.credit = 0
+			l.writeFlowLocked(true)
+		}
+
+		c.mu.Unlock()
+	}
+}
+
+func (c *conn) onTransfer(channel uint16, p performative, payload []byte) {
+	c.mu.Lock()
+	s := c.sessions[channel]
+
+	if s == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	s.nextIncomingID++
+
+	handle, _ := p.uint32(0)
+	l := s.links[handle]
+
+	if l == nil || l.detached || !l.attached || l.Outgoing {
+		c.mu.Unlock()
+		return
+	}
+
+	if !l.inProgress {
+		l.inProgress = true
+		l.inDeliveryID, _ = p.uint32(1)
+		l.inFormat, _ = p.uint32(3)
+		l.inSettled = p.bool(4)
+		l.inBuf = nil
+	}
+
+	l.inBuf = append(l.inBuf, payload...)
+	l.inSettled = l.inSettled || p.bool(4)
+
+	if p.bool(9) {
+		// aborted
+		l.inProgress = false
+		l.inBuf = nil
+		c.mu.Unlock()
+		return
+	}
+
+	if p.bool(5) {
+		// more frames to come
+		c.mu.Unlock()
+		return
+	}
+
+	msg := &IncomingMessage{Format: l.inFormat, Payload: l.inBuf, Settled: l.inSettled}
+	deliveryID := l.inDeliveryID
+	l.inProgress = false
+	l.inBuf = nil
+	l.deliveryCount++
+
+	if l.credit > 0 {
+		l.credit--
+	}
+
+	onMessage := l.OnMessage
+	c.mu.Unlock()
+
+	var state DeliveryState = &Accepted{}
+
+	if onMessage != nil {
+		if s := onMessage(msg); s != nil {
+			state = s
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !msg.Settled {
+		_ = c.writeFrameLocked(channel, codeDisposition, true, deliveryID, nil, true, state.encode())
+	}
+
+	if !l.detached && l.credit < linkCredit/2 {
+		l.credit = linkCredit
+		l.writeFlowLocked(false)
+	}
+}
+
+func (c *conn) onDisposition(channel uint16, p performative) {
+	if !p.bool(0) {
+		// dispositions from the client, as a sender. The server always settles what it receives.
+		return
+	}
+
+	first, _ := p.uint32(1)
+	last, ok := p.uint32(2)
+
+	if !ok {
+		last = first
+	}
+
+	clientSettled := p.bool(3)
+	state := parseDeliveryState(p.field(4))
+
+	c.mu.Lock()
+	s := c.sessions[channel]
+
+	if s == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	type settlement struct {
+		id uint32
+		d  *outgoingDelivery
+	}
+
+	var settlements []settlement
+
+	for id := first; ; id++ {
+		if d, ok := s.unsettled[id]; ok {
+			delete(s.unsettled, id)
+			settlements = append(settlements, settlement{id, d})
+		}
+
+		if id == last {
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	for _, st := range settlements {
+		var final DeliveryState = state
+
+		if onDisposition := st.d.link.OnDisposition; onDisposition != nil {
+			final = onDisposition(st.d.tag, state)
+		}
+
+		if !clientSettled {
+			if final == nil {
+				final = state
+			}
+
+			var encoded any
+
+			if final != nil {
+				encoded = final.encode()
+			}
+
+			_ = c.writeFrame(frameTypeAMQP, channel, codeDisposition, false, st.id, nil, true, encoded)
+		}
+	}
+}
+
+func (c *conn) onDetach(channel uint16, p performative) {
+	handle, _ := p.uint32(0)
+
+	c.mu.Lock()
+	s := c.sessions[channel]
+
+	if s == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	l := s.links[handle]
+
+	if l == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	delete(s.links, handle)
+
+	if l.detachSent {
+		// the client acknowledged our detach
+		c.mu.Unlock()
+		return
+	}
+
+	wasDetached := l.detached
+	l.detached = true
+	l.dropUnsettledLocked()
+	_ = c.writeFrameLocked(channel, codeDetach, handle, true)
+	c.mu.Unlock()
+
+	if !wasDetached {
+		l.notifyDetached(parseError(p.field(2)))
+	}
+}
+
+// close sends a close performative, with err, and closes the connection.
+func (c *conn) close(err *amqp.Error) {
+	c.mu.Lock()
+
+	if c.closing {
+		c.mu.Unlock()
+		return
+	}
+
+	c.closing = true
+	c.mu.Unlock()
+
+	var errField any
+
+	if err != nil {
+		errField = err
+	}
+
+	_ = c.writeFrame(frameTypeAMQP, 0, codeClose, errField)
+
+	c.writeMu.Lock()
+	c.writeDone = true
+	c.writeCond.Broadcast()
+	c.writeMu.Unlock()
+}
+
+func (c *conn) teardown() {
+	c.mu.Lock()
+	c.closing = true
+
+	var detached []*Link
+
+	for _, s := range c.sessions {
+		for _, l := range s.links {
+			if !l.detached {
+				l.detached = true
+
+				if l.attached {
+					detached = append(detached, l)
+				}
+			}
+		}
+	}
+
+	c.sessions = map[uint16]*session{}
+	c.mu.Unlock()
+
+	for _, l := range detached {
+		l.notifyDetached(&amqp.Error{Condition: amqp.ErrCondConnectionForced})
+	}
+}
+
+func (c *conn) writeLoop() {
+	for {
+		c.writeMu.Lock()
+
+		for len(c.writeQueue) == 0 && !c.writeDone {
+			c.writeCond.Wait()
+		}
+
+		queue := c.writeQueue
+		c.writeQueue = nil
+		done := c.writeDone
+		c.writeMu.Unlock()
+
+		for _, b := range queue {
+			if _, err := c.netConn.Write(b); err != nil {
+				_ = c.netConn.Close()
+				return
+			}
+		}
+
+		if done && len(queue) == 0 {
+			// close the connection so the reader stops, if it hasn't already.
+			_ = c.netConn.Close()
+			return
+		}
+	}
+}
+
+func (c *conn) writeRaw(b []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.writeDone {
+		return
+	}
+
+	c.writeQueue = append(c.writeQueue, b)
+	c.writeCond.Signal()
+}
+
+func (c *conn) writeFrame(frameType uint8, channel uint16, code uint64, fields ...any) error {
+	b, err := buildFrame(frameType, channel, code, nil, fields...)
+
+	if err != nil {
+		return err
+	}
+
+	c.writeRaw(b)
+	return nil
+}
+
+// writeFrameLocked writes a frame, ordered with the other frames written while holding c.mu.
+func (c *conn) writeFrameLocked(channel uint16, code uint64, fields ...any) error {
+	return c.writeFrame(frameTypeAMQP, channel, code, fields...)
+}
+
+func buildFrame(frameType uint8, channel uint16, code uint64, payload []byte, fields ...any) ([]byte, error) {
+	body, err := encodePerformative(code, fields...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 8, 8+len(body)+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(8+len(body)+len(payload)))
+	b[4] = 2
+	b[5] = frameType
+	binary.BigEndian.PutUint16(b[6:8], channel)
+	b = append(b, body...)
+	b = append(b, payload...)
+	return b, nil
+}
+
+// writeTransferLocked writes a transfer frame, or queues it until the client's incoming window opens.
+func (c *conn) writeTransferLocked(s *session, frame []byte) {
+	if s.remoteIncomingWindow == 0 || len(s.pending) > 0 {
+		s.pending = append(s.pending, frame)
+		return
+	}
+
+	s.remoteIncomingWindow--
+	s.nextOutgoingID++
+	c.writeRaw(frame)
+}
+
+func (c *conn) flushPendingLocked(s *session) {
+	for len(s.pending) > 0 && s.remoteIncomingWindow > 0 {
+		frame := s.pending[0]
+		s.pending = s.pending[1:]
+		s.remoteIncomingWindow--
+		s.nextOutgoingID++
+		c.writeRaw(frame)
+	}
+}
+
+// IncomingMessage is a message the client sent on a link.
+type IncomingMessage struct {
+	// Format is the message format. go-amqp uses 0 for a single message, and 0x80013700
+	// for a batch, where each data section is an encoded message.
+	Format uint32
+
+	// Payload is the encoded message.
+	Payload []byte
+
+	// Settled is true if the client sent the message pre-settled.
+	Settled bool
+}
+
+// Link is a link attached by a client.
+type Link struct {
+	// Name is the name of the link.
+	Name string
+
+	// Outgoing is true when the client attached a receiver, and the server sends messages on
+	// the link.
+	Outgoing bool
+
+	// Source and Target are the link's terminuses, as sent by the client. They're echoed back to the
+	// client in the attach response, so they can be modified by the [Handler].
+	Source, Target *Terminus
+
+	// Properties are the link properties sent by the client.
+	Properties map[string]any
+
+	// DesiredCapabilities are the capabilities the client asked for.
+	DesiredCapabilities []amqp.Symbol
+
+	// ReceiverSettleModeSecond is true when the client (as a receiver) settles messages after the
+	// server confirms its disposition.
+	ReceiverSettleModeSecond bool
+
+	// SenderSettled is true when the client asked for messages to be sent pre-settled.
+	SenderSettled bool
+
+	// ResponseProperties are sent to the client, in the attach response.
+	ResponseProperties map[string]any
+
+	// MaxMessageSize is sent to the client, in the attach response.
+	MaxMessageSize uint64
+
+	// OnMessage is called for each message the client sends. It returns the outcome, which
+	// defaults to [*Accepted].
+	OnMessage func(msg *IncomingMessage) DeliveryState
+
+	// OnCredit is called when the client issues credit. The handler should [Link.Send] any
+	// messages that are waiting.
+	OnCredit func()
+
+	// OnDisposition is called when the client settles a message sent with [Link.Send]. It returns
+	// the outcome that's confirmed to the client, which defaults to the client's outcome.
+	OnDisposition func(tag []byte, state DeliveryState) DeliveryState
+
+	// OnDetach is called once, when the link is detached by either side, or the connection is lost.
+	OnDetach func(err *amqp.Error)
+
+	conn             *conn
+	session          *session
+	handle           uint32
+	sndSettleMode    any
+	rcvSettleMode    any
+	peerInitialCount uint32
+
+	// guarded by conn.mu
+	attached      bool
+	detached      bool
+	detachSent    bool
+	credit        uint32
+	deliveryCount uint32
+	inProgress    bool
+	inDeliveryID  uint32
+	inFormat      uint32
+	inSettled     bool
+	inBuf         []byte
+}
+
+// Credit is the number of messages the server can send on the link.
+func (l *Link) Credit() uint32 {
+	l.conn.mu.Lock()
+	defer l.conn.mu.Unlock()
+
+	if !l.attached || l.detached {
+		return 0
+	}
+
+	return l.credit
+}
+
+// Detached returns true if the link has been detached.
+func (l *Link) Detached() bool {
+	l.conn.mu.Lock()
+	defer l.conn.mu.Unlock()
+	return l.detached
+}
+
+// Send sends a message on the link, returning false if the link has no credit or
+// has been detached. Messages that aren't settled are settled by the client, which
+// calls OnDisposition.
+func (l *Link) Send(tag []byte, format uint32, payload []byte, settled bool) bool {
+	c := l.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !l.attached || l.detached || l.credit == 0 || !l.Outgoing {
+		return false
+	}
+
+	s := l.session
+	deliveryID := s.nextDeliveryID
+	s.nextDeliveryID++
+	l.deliveryCount++
+	l.credit--
+
+	if !settled {
+		s.unsettled[deliveryID] = &outgoingDelivery{link: l, tag: tag}
+	}
+
+	first := true
+
+	for {
+		var fields []any
+
+		if first {
+			fields = []any{l.handle, deliveryID, tag, format, settled, true}
+		} else {
+			fields = []any{l.handle, nil, nil, nil, settled, true}
+		}
+
+		// the most payload that fits in a frame, after the frame header and the transfer performative.
+		overhead, err := encodePerformative(codeTransfer, fields...)
+
+		if err != nil {
+			return false
+		}
+
+		chunk := int(c.peerMaxFrame) - 8 - len(overhead)
+		more := len(payload) > chunk
+
+		if !more {
+			chunk = len(payload)
+		}
+
+		fields[5] = more
+		frame, err := buildFrame(frameTypeAMQP, s.channel, codeTransfer, payload[:chunk], fields...)
+
+		if err != nil {
+			return false
+		}
+
+		c.writeTransferLocked(s, frame)
+		payload = payload[chunk:]
+		first = false
+
+		if !more {
+			return true
+		}
+	}
+}
+
+// Detach detaches the link, with an optional error.
+func (l *Link) Detach(err *amqp.Error) {
+	c := l.conn
+	c.mu.Lock()
+
+	if l.detached {
+		c.mu.Unlock()
+		return
+	}
+
+	l.detached = true
+	l.detachSent = true
+	l.dropUnsettledLocked()
+
+	var errField any
+
+	if err != nil {
+		errField = err
+	}
+
+	_ = c.writeFrameLocked(l.session.channel, codeDetach, l.handle, true, errField)
+	c.mu.Unlock()
+
+	l.notifyDetached(err)
+}
+
+// CloseConnection closes the connection the link belongs to, with an optional error.
+func (l *Link) CloseConnection(err *amqp.Error) {
+	l.conn.close(err)
+}
+
+func (l *Link) notifyCredit() {
+	if l.OnCredit != nil {
+		l.OnCredit()
+	}
+}
+
+func (l *Link) notifyDetached(err *amqp.Error) {
+	if l.OnDetach != nil {
+		l.OnDetach(err)
+	}
+}
+
+func (l *Link) dropUnsettledLocked() {
+	for id, d := range l.session.unsettled {
+		if d.link == l {
+			delete(l.session.unsettled, id)
+		}
+	}
+}
+
+// writeFlowLocked sends the link's flow state to the client.
+func (l *Link) writeFlowLocked(drain bool) {
+	s := l.session
+	_ = l.conn.writeFrameLocked(s.channel, codeFlow, s.nextIncomingID, uint32(sessionWindow), s.nextOutgoingID, uint32(sessionWindow),
+		l.handle, l.deliveryCount, l.credit, nil, drain)
+}
@@ -591,6 +591,60 @@ func CancelScheduledMessages(ctx context.Context, rpcLink amqpwrap.RPCLink, link
 	return nil
 }
 
+// MaxDeleteMessageCount is the maximum number of messages the service will delete in a
+// single batch-delete-messages request.
+const MaxDeleteMessageCount = 4000
+
+// DeleteMessages deletes up to messageCount messages, which were enqueued before enqueuedBefore,
+// from the entity. It returns the number of messages that were deleted.
+func DeleteMessages(ctx context.Context, rpcLink amqpwrap.RPCLink, linkName string, enqueuedBefore time.Time, messageCount int32) (int32, error) {
+	const messageCountField = "message-count"
+
+	msg := &amqp.Message{
+		ApplicationProperties: map[string]any{
+			"operation": "com.microsoft:batch-delete-messages",
+		},
+		Value: map[string]any{
+			"enqueued-time-utc": enqueuedBefore.UTC(),
+			messageCountField:   messageCount,
+		},
+	}
+
+	addAssociatedLinkName(linkName, msg)
+
+	resp, err := rpcLink.RPC(ctx, msg)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// no messages matched
+	if resp.Code == 204 {
+		return 0, nil
+	}
+
+	if resp.Code != 200 {
+		return 0, ErrAMQP(*resp)
+	}
+
+	asMap, ok := resp.Message.Value.(map[string]any)
+
+	if !ok {
+		return 0, NewErrIncorrectType("Value", map[string]any{}, resp.Message.Value)
+	}
+
+	switch v := asMap[messageCountField].(type) {
+	case int32:
+		return v, nil
+	case int64:
+		return int32(v), nil
+	case nil:
+		return 0, ErrMissingField(messageCountField)
+	default:
+		return 0, NewErrIncorrectType(messageCountField, int32(0), v)
+	}
+}
+
 // addAssociatedLinkName adds the 'associated-link-name' application
 // property to the AMQP message. Setting this property associates
 // management link activity with a sender or receiver link, which can
@@ -150,3 +150,56 @@ func TestPeekMessagesDefersServerTimeoutToRPC(t *testing.T) {
 	require.NotContains(t, link.Sent.ApplicationProperties, "com.microsoft:server-timeout",
 		"a preset vendor-prefixed key would stop RPC from setting server-timeout")
 }
+
+func TestDeleteMessages(t *testing.T) {
+	enqueuedBefore := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("deleted", func(t *testing.T) {
+		link := &countingRPCLink{Resp: &amqpwrap.RPCResponse{
+			Code:    200,
+			Message: &amqp.Message{Value: map[string]any{"message-count": int32(42)}},
+		}}
+
+		deleted, err := DeleteMessages(context.Background(), link, "link-name", enqueuedBefore, 100)
+		require.NoError(t, err)
+		require.Equal(t, int32(42), deleted)
+
+		require.Equal(t, "com.microsoft:batch-delete-messages", link.Sent.ApplicationProperties["operation"])
+		require.Equal(t, "link-name", link.Sent.ApplicationProperties["associated-link-name"])
+		require.Equal(t, map[string]any{
+			"enqueued-time-utc": enqueuedBefore,
+			"message-count":     int32(100),
+		}, link.Sent.Value)
+	})
+
+	t.Run("no messages", func(t *testing.T) {
+		link := &countingRPCLink{Resp: &amqpwrap.RPCResponse{Code: 204}}
+
+		deleted, err := DeleteMessages(context.Background(), link, "link-name", enqueuedBefore, 100)
+		require.NoError(t, err)
+		require.Zero(t, deleted)
+	})
+
+	t.Run("missing count", func(t *testing.T) {
+		link := &countingRPCLink{Resp: &amqpwrap.RPCResponse{
+			Code:    200,
+			Message: &amqp.Message{Value: map[string]any{}},
+		}}
+
+		_, err := DeleteMessages(context.Background(), link, "link-name", enqueuedBefore, 100)
+		require.ErrorIs(t, err, ErrMissingField("message-count"))
+	})
+}
+
+// countingRPCLink records the message handed to RPC and answers with Resp.
+type countingRPCLink struct {
+	Sent *amqp.Message
+	Resp *amqpwrap.RPCResponse
+}
+
+func (l *countingRPCLink) Close(ctx context.Context) error { return nil }
+
+func (l *countingRPCLink) RPC(ctx context.Context, msg *amqp.Message) (*amqpwrap.RPCResponse, error) {
+	l.Sent = msg
+	return l.Resp, nil
+}
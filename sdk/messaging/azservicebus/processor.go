@@ -0,0 +1,714 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/internal"
+)
+
+// ProcessorOptions contains options for the [Client.NewProcessorForQueue] or
+// [Client.NewProcessorForSubscription] functions.
+type ProcessorOptions struct {
+	// ReceiveMode controls when a message is deleted from Service Bus.
+	//
+	// [ReceiveModePeekLock] is the default. Messages are settled automatically, based
+	// on the result of your handler, unless DisableAutoComplete is true.
+	//
+	// [ReceiveModeReceiveAndDelete] causes Service Bus to remove the message as soon
+	// as it's received. Messages are not settled, and their locks are not renewed.
+	ReceiveMode ReceiveMode
+
+	// SubQueue should be set to connect to the sub queue (ex: dead letter queue)
+	// of the queue or subscription.
+	SubQueue SubQueue
+
+	// MaxConcurrentCalls is the maximum number of messages that will be passed to your
+	// handler at the same time.
+	//
+	// Defaults to 1.
+	MaxConcurrentCalls int
+
+	// MaxAutoLockRenewalDuration is the maximum amount of time the Processor will continue
+	// to renew the lock for a message while it's being handled.
+	//
+	// Defaults to 5 minutes. Disabled if MaxAutoLockRenewalDuration < 0.
+	MaxAutoLockRenewalDuration time.Duration
+
+	// DisableAutoComplete stops the Processor from settling messages after your handler returns.
+	//
+	// By default a message is completed if your handler returns nil, and abandoned if it
+	// returns an error. Messages that your handler settles itself, using one of the
+	// settlement functions on [ProcessMessageArgs], are never settled again.
+	DisableAutoComplete bool
+}
+
+// ProcessMessageHandler is called by a [Processor] or [SessionProcessor] for each message
+// that is received.
+//
+// The ctx is cancelled if the Processor is stopped before the handler returns.
+type ProcessMessageHandler func(ctx context.Context, args *ProcessMessageArgs) error
+
+// ProcessErrorHandler is called by a [Processor] or [SessionProcessor] when an error occurs
+// while receiving, renewing locks, settling, or from your [ProcessMessageHandler].
+//
+// Errors that are passed to this function are informational. The Processor will continue
+// running unless the error is also returned from Run.
+type ProcessErrorHandler func(ctx context.Context, args *ProcessErrorArgs)
+
+// ProcessErrorSource indicates the operation that failed, for a [ProcessErrorArgs].
+type ProcessErrorSource string
+
+const (
+	// ProcessErrorSourceReceive means the error occurred while receiving messages.
+	ProcessErrorSourceReceive ProcessErrorSource = "receive"
+
+	// ProcessErrorSourceAcceptSession means the error occurred while accepting the next available session.
+	ProcessErrorSourceAcceptSession ProcessErrorSource = "acceptSession"
+
+	// ProcessErrorSourceRenewLock means the error occurred while renewing a message or session lock.
+	ProcessErrorSourceRenewLock ProcessErrorSource = "renewLock"
+
+	// ProcessErrorSourceSettle means the error occurred while automatically completing or abandoning a message.
+	ProcessErrorSourceSettle ProcessErrorSource = "settle"
+
+	// ProcessErrorSourceHandler means the error was returned from your [ProcessMessageHandler].
+	ProcessErrorSourceHandler ProcessErrorSource = "handler"
+)
+
+// ProcessErrorArgs are the arguments passed to a [ProcessErrorHandler].
+type ProcessErrorArgs struct {
+	// Err is the error that occurred.
+	Err error
+
+	// ErrorSource is the operation that failed.
+	ErrorSource ProcessErrorSource
+
+	// EntityPath is the path of the queue or subscription the Processor is receiving from.
+	EntityPath string
+
+	// Message is the message being processed when the error occurred, or nil if the
+	// error wasn't related to a specific message.
+	Message *ReceivedMessage
+
+	// SessionID is the ID of the session being processed when the error occurred, or nil
+	// if the error wasn't related to a specific session.
+	SessionID *string
+}
+
+// ProcessMessageArgs are the arguments passed to a [ProcessMessageHandler].
+type ProcessMessageArgs struct {
+	// Message is the message that was received.
+	Message *ReceivedMessage
+
+	// SessionID is the ID of the session the message was received from, or nil if
+	// the message was received by a [Processor].
+	SessionID *string
+
+	receiver processorReceiver
+	session  processorSessionReceiver
+	settled  atomic.Bool
+}
+
+// CompleteMessage completes the message, deleting it from the queue or subscription.
+// Once called, the Processor will not automatically settle the message.
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (a *ProcessMessageArgs) CompleteMessage(ctx context.Context, options *CompleteMessageOptions) error {
+	a.settled.Store(true)
+	return a.receiver.CompleteMessage(ctx, a.Message, options)
+}
+
+// AbandonMessage will cause the message to be available again from the queue or subscription.
+// Once called, the Processor will not automatically settle the message.
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (a *ProcessMessageArgs) AbandonMessage(ctx context.Context, options *AbandonMessageOptions) error {
+	a.settled.Store(true)
+	return a.receiver.AbandonMessage(ctx, a.Message, options)
+}
+
+// DeferMessage will cause the message to be deferred. Deferred messages can be received using
+// [Receiver.ReceiveDeferredMessages].
+// Once called, the Processor will not automatically settle the message.
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (a *ProcessMessageArgs) DeferMessage(ctx context.Context, options *DeferMessageOptions) error {
+	a.settled.Store(true)
+	return a.receiver.DeferMessage(ctx, a.Message, options)
+}
+
+// DeadLetterMessage settles the message by moving it to the dead letter queue for the
+// queue or subscription.
+// Once called, the Processor will not automatically settle the message.
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (a *ProcessMessageArgs) DeadLetterMessage(ctx context.Context, options *DeadLetterOptions) error {
+	a.settled.Store(true)
+	return a.receiver.DeadLetterMessage(ctx, a.Message, options)
+}
+
+// GetSessionState retrieves state associated with the session the message was received from.
+// This function can only be used with messages from a [SessionProcessor].
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (a *ProcessMessageArgs) GetSessionState(ctx context.Context, options *GetSessionStateOptions) ([]byte, error) {
+	if a.session == nil {
+		return nil, errors.New("session state is only available for messages received by a SessionProcessor")
+	}
+
+	return a.session.GetSessionState(ctx, options)
+}
+
+// SetSessionState sets the state associated with the session the message was received from.
+// Pass nil for the state parameter to clear the stored session state.
+// This function can only be used with messages from a [SessionProcessor].
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (a *ProcessMessageArgs) SetSessionState(ctx context.Context, state []byte, options *SetSessionStateOptions) error {
+	if a.session == nil {
+		return errors.New("session state is only available for messages received by a SessionProcessor")
+	}
+
+	return a.session.SetSessionState(ctx, state, options)
+}
+
+// Processor receives messages from a queue or subscription and passes them to a
+// [ProcessMessageHandler], with bounded concurrency.
+//
+// While a message is being handled its lock is renewed automatically. When the handler returns
+// the message is completed (nil error) or abandoned (non-nil error), unless
+// [ProcessorOptions.DisableAutoComplete] is set or the handler settled the message itself.
+//
+// Create a Processor using [Client.NewProcessorForQueue] or [Client.NewProcessorForSubscription].
+type Processor struct {
+	receiver   processorReceiver
+	entityPath string
+	pump       *messagePump
+	lifecycle  processorLifecycle
+}
+
+// processorReceiver is the subset of [Receiver] and [SessionReceiver] that the message pump uses.
+// It's an interface here to make testing easier.
+type processorReceiver interface {
+	ReceiveMessages(ctx context.Context, maxMessages int, options *ReceiveMessagesOptions) ([]*ReceivedMessage, error)
+	CompleteMessage(ctx context.Context, message *ReceivedMessage, options *CompleteMessageOptions) error
+	AbandonMessage(ctx context.Context, message *ReceivedMessage, options *AbandonMessageOptions) error
+	DeferMessage(ctx context.Context, message *ReceivedMessage, options *DeferMessageOptions) error
+	DeadLetterMessage(ctx context.Context, message *ReceivedMessage, options *DeadLetterOptions) error
+	Close(ctx context.Context) error
+}
+
+// NewProcessorForQueue creates a Processor for a queue.
+func (client *Client) NewProcessorForQueue(queueName string, options *ProcessorOptions) (*Processor, error) {
+	return client.newProcessor(entity{Queue: queueName}, options)
+}
+
+// NewProcessorForSubscription creates a Processor for a subscription.
+func (client *Client) NewProcessorForSubscription(topicName string, subscriptionName string, options *ProcessorOptions) (*Processor, error) {
+	return client.newProcessor(entity{Topic: topicName, Subscription: subscriptionName}, options)
+}
+
+func (client *Client) newProcessor(e entity, options *ProcessorOptions) (*Processor, error) {
+	if options == nil {
+		options = &ProcessorOptions{}
+	}
+
+	id, cleanupOnClose := client.getCleanupForCloseable()
+	receiver, err := newReceiver(newReceiverArgs{
+		cleanupOnClose:      cleanupOnClose,
+		ns:                  client.namespace,
+		entity:              e,
+		getRecoveryKindFunc: internal.GetRecoveryKind,
+		retryOptions:        client.retryOptions,
+	}, &ReceiverOptions{
+		ReceiveMode: options.ReceiveMode,
+		SubQueue:    options.SubQueue,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	processor, err := newProcessorImpl(receiver, receiver.entityPath, receiver.RenewMessageLock, client.retryOptions, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client.addCloseable(id, receiver)
+	return processor, nil
+}
+
+func newProcessorImpl(receiver processorReceiver, entityPath string, renewMessageLock func(ctx context.Context, msg *ReceivedMessage, options *RenewMessageLockOptions) error, retryOptions RetryOptions, options *ProcessorOptions) (*Processor, error) {
+	if options == nil {
+		options = &ProcessorOptions{}
+	}
+
+	if err := checkReceiverMode(options.ReceiveMode); err != nil {
+		return nil, err
+	}
+
+	maxConcurrentCalls, err := defaultConcurrency("MaxConcurrentCalls", options.MaxConcurrentCalls, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Processor{
+		receiver:   receiver,
+		entityPath: entityPath,
+		pump: &messagePump{
+			receiver:           receiver,
+			entityPath:         entityPath,
+			receiveMode:        options.ReceiveMode,
+			maxConcurrentCalls: maxConcurrentCalls,
+			maxAutoLockRenewal: defaultAutoLockRenewal(options.MaxAutoLockRenewalDuration),
+			autoComplete:       !options.DisableAutoComplete,
+			renewMessageLock: func(ctx context.Context, msg *ReceivedMessage) error {
+				return renewMessageLock(ctx, msg, nil)
+			},
+			retryOptions: retryOptions,
+		},
+		lifecycle: newProcessorLifecycle(),
+	}, nil
+}
+
+// Run receives messages and passes them to handleMessage, blocking until the passed in context
+// is cancelled, [Processor.Close] is called, or an unrecoverable error occurs.
+//
+// handleError is optional. If it's not nil, it is called with any errors that occur while processing.
+//
+// When the context is cancelled the Processor stops receiving, cancels the context passed to any
+// running handlers and waits for them to return. Use [Processor.Close] instead to let running
+// handlers finish before stopping.
+//
+// On cancellation, or after Close, Run returns a nil error. Once a Processor has been stopped it
+// cannot be restarted and a new instance must be created.
+func (p *Processor) Run(ctx context.Context, handleMessage ProcessMessageHandler, handleError ProcessErrorHandler) error {
+	if handleMessage == nil {
+		return errors.New("handleMessage must not be nil")
+	}
+
+	ctx, err := p.lifecycle.start(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer p.lifecycle.finish()
+
+	err = p.pump.Run(ctx, p.lifecycle.stopReceiving, handleMessage, handleError)
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// Close stops the Processor from receiving new messages and waits for any running handlers
+// to finish and their messages to be settled. If ctx is cancelled before that happens, the
+// contexts passed to the running handlers are cancelled as well.
+//
+// The underlying receiver is closed once all handlers have returned.
+func (p *Processor) Close(ctx context.Context) error {
+	p.lifecycle.stop(ctx)
+	return p.receiver.Close(ctx)
+}
+
+// processorLifecycle tracks the running state for a [Processor] or [SessionProcessor],
+// and coordinates a graceful shutdown between Run and Close.
+type processorLifecycle struct {
+	mu             sync.Mutex
+	state          state
+	stopReceiving  chan struct{}
+	stopOnce       *sync.Once
+	runDone        chan struct{}
+	cancelHandlers context.CancelFunc
+}
+
+type state int32
+
+const (
+	stateNone    state = 0
+	stateStopped state = 1
+	stateRunning state = 2
+)
+
+func newProcessorLifecycle() processorLifecycle {
+	return processorLifecycle{
+		stopReceiving: make(chan struct{}),
+		stopOnce:      &sync.Once{},
+		runDone:       make(chan struct{}),
+	}
+}
+
+// start moves the lifecycle into the running state, returning the context that handlers
+// should use. The returned context is cancelled if Close times out.
+func (pl *processorLifecycle) start(ctx context.Context) (context.Context, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	switch pl.state {
+	case stateNone:
+		pl.state = stateRunning
+	case stateRunning:
+		return nil, errors.New("the processor is currently running, concurrent calls to Run() are not allowed")
+	case stateStopped:
+		return nil, errors.New("the processor has been stopped. Create a new instance to start processing again")
+	default:
+		return nil, fmt.Errorf("unhandled state value %v", pl.state)
+	}
+
+	ctx, pl.cancelHandlers = context.WithCancel(ctx)
+	return ctx, nil
+}
+
+func (pl *processorLifecycle) finish() {
+	pl.mu.Lock()
+	pl.state = stateStopped
+	pl.cancelHandlers()
+	pl.mu.Unlock()
+
+	close(pl.runDone)
+}
+
+// stop stops receiving and, if Run is active, waits for it to drain any in-flight messages.
+func (pl *processorLifecycle) stop(ctx context.Context) {
+	pl.mu.Lock()
+	wasRunning := pl.state == stateRunning
+	cancelHandlers := pl.cancelHandlers
+
+	if !wasRunning {
+		pl.state = stateStopped
+	}
+	pl.mu.Unlock()
+
+	pl.stopOnce.Do(func() { close(pl.stopReceiving) })
+
+	if !wasRunning {
+		return
+	}
+
+	select {
+	case <-pl.runDone:
+	case <-ctx.Done():
+		cancelHandlers()
+		<-pl.runDone
+	}
+}
+
+// settleTimeout is the maximum amount of time we'll wait to automatically settle a message after
+// the handler returns. We can't use the handler's context since it might already be cancelled.
+const settleTimeout = time.Minute
+
+// minLockRenewalInterval keeps us from hammering the service when a lock is about to expire.
+const minLockRenewalInterval = time.Second
+
+// messagePump receives messages from a single receiver and dispatches them to a handler.
+// It's used directly by the [Processor], and once per accepted session by the [SessionProcessor].
+type messagePump struct {
+	receiver           processorReceiver
+	session            processorSessionReceiver
+	sessionID          *string
+	entityPath         string
+	receiveMode        ReceiveMode
+	maxConcurrentCalls int
+	maxAutoLockRenewal time.Duration
+	autoComplete       bool
+	retryOptions       RetryOptions
+
+	// renewMessageLock is nil for session receivers, where the session lock covers
+	// all of the messages in the session.
+	renewMessageLock func(ctx context.Context, msg *ReceivedMessage) error
+
+	// idleTimeout, if > 0, stops the pump if no messages arrive within the duration.
+	idleTimeout time.Duration
+}
+
+// Run receives and dispatches messages until ctx is cancelled, stopReceiving is closed,
+// the idle timeout expires or receiving fails with an unrecoverable error. It always waits
+// for dispatched handlers to return before it returns.
+func (mp *messagePump) Run(ctx context.Context, stopReceiving <-chan struct{}, handleMessage ProcessMessageHandler, handleError ProcessErrorHandler) error {
+	receiveCtx, cancelReceive := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-stopReceiving:
+			cancelReceive()
+		case <-receiveCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+	defer cancelReceive()
+
+	slots := make(chan struct{}, mp.maxConcurrentCalls)
+	failures := int32(0)
+
+	for {
+		// wait until at least one handler slot is free, then claim any others that are
+		// free so we can receive them in a single call.
+		select {
+		case slots <- struct{}{}:
+		case <-receiveCtx.Done():
+			return nil
+		}
+
+		claimed := 1
+
+	claimSlots:
+		for claimed < mp.maxConcurrentCalls {
+			select {
+			case slots <- struct{}{}:
+				claimed++
+			default:
+				break claimSlots
+			}
+		}
+
+		messages, idle, err := mp.receive(receiveCtx, claimed)
+
+		for i := len(messages); i < claimed; i++ {
+			<-slots
+		}
+
+		if err != nil {
+			if receiveCtx.Err() != nil {
+				return nil
+			}
+
+			mp.reportError(ctx, handleError, &ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceReceive})
+
+			if isFatalProcessorError(err) {
+				return err
+			}
+
+			failures++
+
+			select {
+			case <-time.After(calcProcessorRetryDelay(mp.retryOptions, failures)):
+			case <-receiveCtx.Done():
+				return nil
+			}
+			continue
+		}
+
+		failures = 0
+
+		if idle {
+			azlog.Writef(EventReceiver, "[%s] No messages received within the idle timeout, stopping", mp.entityPath)
+			return nil
+		}
+
+		for _, msg := range messages {
+			wg.Add(1)
+
+			go func(msg *ReceivedMessage) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				mp.processMessage(ctx, msg, handleMessage, handleError)
+			}(msg)
+		}
+	}
+}
+
+// receive receives up to maxMessages. idle is true if the pump's idle timeout expired without
+// receiving any messages.
+func (mp *messagePump) receive(ctx context.Context, maxMessages int) (messages []*ReceivedMessage, idle bool, err error) {
+	if mp.idleTimeout <= 0 {
+		messages, err = mp.receiver.ReceiveMessages(ctx, maxMessages, nil)
+		return messages, false, err
+	}
+
+	idleCtx, cancel := context.WithTimeout(ctx, mp.idleTimeout)
+	defer cancel()
+
+	messages, err = mp.receiver.ReceiveMessages(idleCtx, maxMessages, nil)
+
+	if len(messages) == 0 && ctx.Err() == nil && idleCtx.Err() != nil {
+		return nil, true, nil
+	}
+
+	return messages, false, err
+}
+
+func (mp *messagePump) processMessage(ctx context.Context, msg *ReceivedMessage, handleMessage ProcessMessageHandler, handleError ProcessErrorHandler) {
+	args := &ProcessMessageArgs{
+		Message:   msg,
+		SessionID: mp.sessionID,
+		receiver:  mp.receiver,
+		session:   mp.session,
+	}
+
+	handlerCtx, cancelHandler := context.WithCancel(ctx)
+	defer cancelHandler()
+
+	stopRenewal := func() {}
+
+	if mp.receiveMode == ReceiveModePeekLock && mp.renewMessageLock != nil && mp.maxAutoLockRenewal > 0 {
+		renewCtx, cancelRenew := context.WithCancel(handlerCtx)
+		renewDone := make(chan struct{})
+
+		go func() {
+			defer close(renewDone)
+			mp.autoRenewMessageLock(renewCtx, msg, handleError)
+		}()
+
+		stopRenewal = func() {
+			cancelRenew()
+			<-renewDone
+		}
+	}
+
+	err := handleMessage(handlerCtx, args)
+	stopRenewal()
+
+	if err != nil {
+		mp.reportError(ctx, handleError, &ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceHandler, Message: msg})
+	}
+
+	if mp.receiveMode != ReceiveModePeekLock || !mp.autoComplete || args.settled.Load() {
+		return
+	}
+
+	settleCtx, cancelSettle := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancelSettle()
+
+	var settleErr error
+
+	if err == nil {
+		settleErr = mp.receiver.CompleteMessage(settleCtx, msg, nil)
+	} else {
+		settleErr = mp.receiver.AbandonMessage(settleCtx, msg, nil)
+	}
+
+	if settleErr != nil {
+		mp.reportError(ctx, handleError, &ProcessErrorArgs{Err: settleErr, ErrorSource: ProcessErrorSourceSettle, Message: msg})
+	}
+}
+
+// autoRenewMessageLock renews the lock for msg until ctx is cancelled, the lock is lost, or
+// the maximum auto lock renewal duration has elapsed.
+func (mp *messagePump) autoRenewMessageLock(ctx context.Context, msg *ReceivedMessage, handleError ProcessErrorHandler) {
+	renewUntil := time.Now().Add(mp.maxAutoLockRenewal)
+
+	for {
+		if msg.LockedUntil == nil || !msg.LockedUntil.Before(renewUntil) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(calcLockRenewalDelay(*msg.LockedUntil)):
+		}
+
+		if err := mp.renewMessageLock(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			mp.reportError(ctx, handleError, &ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceRenewLock, Message: msg})
+
+			if sbErr := (*Error)(nil); errors.As(err, &sbErr) && sbErr.Code == CodeLockLost {
+				return
+			}
+		}
+	}
+}
+
+func (mp *messagePump) reportError(ctx context.Context, handleError ProcessErrorHandler, args *ProcessErrorArgs) {
+	args.EntityPath = mp.entityPath
+
+	if args.SessionID == nil {
+		args.SessionID = mp.sessionID
+	}
+
+	azlog.Writef(EventReceiver, "[%s] Processor error (%s): %s", mp.entityPath, args.ErrorSource, args.Err)
+
+	if handleError != nil {
+		handleError(ctx, args)
+	}
+}
+
+// calcLockRenewalDelay returns how long to wait before renewing a lock that expires at lockedUntil.
+// We renew at the halfway point, which leaves time for a retry if the renewal fails.
+func calcLockRenewalDelay(lockedUntil time.Time) time.Duration {
+	return max(time.Until(lockedUntil)/2, minLockRenewalInterval)
+}
+
+// calcProcessorRetryDelay calculates an exponential backoff for repeated receive failures, using
+// the RetryDelay and MaxRetryDelay from the client's RetryOptions.
+func calcProcessorRetryDelay(o RetryOptions, failures int32) time.Duration {
+	retryDelay := o.RetryDelay
+
+	if retryDelay == 0 {
+		retryDelay = 4 * time.Second
+	} else if retryDelay < 0 {
+		retryDelay = 0
+	}
+
+	maxRetryDelay := o.MaxRetryDelay
+
+	if maxRetryDelay == 0 {
+		maxRetryDelay = 120 * time.Second
+	}
+
+	delay := retryDelay
+
+	for i := int32(1); i < failures && (maxRetryDelay < 0 || delay < maxRetryDelay); i++ {
+		delay *= 2
+	}
+
+	if maxRetryDelay > 0 && delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
+
+// isFatalProcessorError returns true if err indicates that continuing to receive
+// will never succeed, without some intervention.
+func isFatalProcessorError(err error) bool {
+	var sbErr *Error
+
+	if !errors.As(err, &sbErr) {
+		return false
+	}
+
+	switch sbErr.Code {
+	case CodeUnauthorizedAccess, CodeNotFound, CodeClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+func defaultConcurrency(name string, value int, defaultValue int) (int, error) {
+	switch {
+	case value == 0:
+		return defaultValue, nil
+	case value < 0:
+		return 0, fmt.Errorf("%s must be greater than or equal to 0", name)
+	default:
+		return value, nil
+	}
+}
+
+func defaultAutoLockRenewal(d time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return 5 * time.Minute
+	case d < 0:
+		return 0
+	default:
+		return d
+	}
+}
@@ -0,0 +1,649 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus/internal/exported"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessor_CompletesAndAbandons(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(4)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{
+		MaxConcurrentCalls: 2,
+	})
+	require.NoError(t, err)
+
+	var handled sync.WaitGroup
+	handled.Add(4)
+
+	runErr := make(chan error, 1)
+
+	go func() {
+		runErr <- processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer handled.Done()
+
+			if args.Message.MessageID == "message 1" {
+				return errors.New("handler failed")
+			}
+
+			return nil
+		}, nil)
+	}()
+
+	handled.Wait()
+	require.NoError(t, processor.Close(context.Background()))
+	require.NoError(t, <-runErr)
+
+	require.ElementsMatch(t, []string{"message 0", "message 2", "message 3"}, receiver.Settled("complete"))
+	require.Equal(t, []string{"message 1"}, receiver.Settled("abandon"))
+	require.True(t, receiver.closed.Load())
+}
+
+func TestProcessor_HandlerSettlesMessage(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(1)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer close(done)
+			require.Nil(t, args.SessionID)
+
+			_, err := args.GetSessionState(ctx, nil)
+			require.Error(t, err)
+
+			// the Processor shouldn't settle the message a second time, even though we return an error.
+			require.NoError(t, args.DeadLetterMessage(ctx, nil))
+			return errors.New("handler failed")
+		}, nil)
+	}()
+
+	<-done
+	require.NoError(t, processor.Close(context.Background()))
+
+	require.Equal(t, []string{"message 0"}, receiver.Settled("deadletter"))
+	require.Empty(t, receiver.Settled("abandon"))
+}
+
+func TestProcessor_DisableAutoComplete(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(1)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{
+		DisableAutoComplete: true,
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			close(done)
+			return nil
+		}, nil)
+	}()
+
+	<-done
+	require.NoError(t, processor.Close(context.Background()))
+	require.Empty(t, receiver.Settled("complete"))
+}
+
+func TestProcessor_BoundedConcurrency(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(20)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{
+		MaxConcurrentCalls: 3,
+	})
+	require.NoError(t, err)
+
+	var running, maxRunning atomic.Int32
+	var handled sync.WaitGroup
+	handled.Add(20)
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer handled.Done()
+
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				cur := maxRunning.Load()
+				if n <= cur || maxRunning.CompareAndSwap(cur, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}, nil)
+	}()
+
+	handled.Wait()
+	require.NoError(t, processor.Close(context.Background()))
+
+	require.LessOrEqual(t, maxRunning.Load(), int32(3))
+	require.Len(t, receiver.Settled("complete"), 20)
+
+	for _, n := range receiver.ReceiveCounts() {
+		require.LessOrEqual(t, n, 3)
+	}
+}
+
+func TestProcessor_RenewsLocks(t *testing.T) {
+	msg := newTestMessages(1)[0]
+	msg.LockedUntil = to.Ptr(time.Now().Add(2 * minLockRenewalInterval))
+
+	receiver := newFakeProcessorReceiver(msg)
+	receiver.lockDuration = 2 * minLockRenewalInterval
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer close(done)
+
+			// wait long enough for a couple of renewals
+			time.Sleep(3 * minLockRenewalInterval)
+			return nil
+		}, nil)
+	}()
+
+	<-done
+	require.NoError(t, processor.Close(context.Background()))
+
+	require.GreaterOrEqual(t, receiver.renewals.Load(), int32(2))
+	require.Equal(t, []string{"message 0"}, receiver.Settled("complete"))
+}
+
+func TestProcessor_RenewStopsOnLockLost(t *testing.T) {
+	msg := newTestMessages(1)[0]
+	msg.LockedUntil = to.Ptr(time.Now())
+
+	receiver := newFakeProcessorReceiver(msg)
+	receiver.renewErr = exported.NewError(exported.CodeLockLost, errors.New("lock lost"))
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	errorsCh := make(chan *ProcessErrorArgs, 10)
+	done := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer close(done)
+			time.Sleep(3 * minLockRenewalInterval)
+			return nil
+		}, func(ctx context.Context, args *ProcessErrorArgs) {
+			errorsCh <- args
+		})
+	}()
+
+	<-done
+	require.NoError(t, processor.Close(context.Background()))
+	close(errorsCh)
+
+	var sources []ProcessErrorSource
+
+	for args := range errorsCh {
+		require.Equal(t, "queue", args.EntityPath)
+		sources = append(sources, args.ErrorSource)
+	}
+
+	require.Equal(t, []ProcessErrorSource{ProcessErrorSourceRenewLock}, sources)
+	require.Equal(t, int32(1), receiver.renewals.Load())
+}
+
+func TestProcessor_ReceiveAndDelete(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(1)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{
+		ReceiveMode: ReceiveModeReceiveAndDelete,
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			close(done)
+			return nil
+		}, nil)
+	}()
+
+	<-done
+	require.NoError(t, processor.Close(context.Background()))
+	require.Empty(t, receiver.Settled("complete"))
+	require.Zero(t, receiver.renewals.Load())
+}
+
+func TestProcessor_CloseDrainsInFlight(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(1)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runErr := make(chan error, 1)
+
+	go func() {
+		runErr <- processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			close(started)
+			<-release
+			return ctx.Err()
+		}, nil)
+	}()
+
+	<-started
+
+	closeErr := make(chan error, 1)
+	go func() { closeErr <- processor.Close(context.Background()) }()
+
+	select {
+	case <-closeErr:
+		require.Fail(t, "Close should wait for in-flight handlers")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-closeErr)
+	require.NoError(t, <-runErr)
+
+	// the handler's context was never cancelled, so the message is completed.
+	require.Equal(t, []string{"message 0"}, receiver.Settled("complete"))
+
+	err = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error { return nil }, nil)
+	require.EqualError(t, err, "the processor has been stopped. Create a new instance to start processing again")
+}
+
+func TestProcessor_CloseTimeoutCancelsHandlers(t *testing.T) {
+	receiver := newFakeProcessorReceiver(newTestMessages(1)...)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil)
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, processor.Close(ctx))
+	require.Equal(t, []string{"message 0"}, receiver.Settled("abandon"))
+}
+
+func TestProcessor_ContextCancellation(t *testing.T) {
+	receiver := newFakeProcessorReceiver()
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = processor.Run(ctx, func(ctx context.Context, args *ProcessMessageArgs) error { return nil }, nil)
+	require.NoError(t, err)
+}
+
+func TestProcessor_FatalReceiveError(t *testing.T) {
+	receiver := newFakeProcessorReceiver()
+	receiver.receiveErr = exported.NewError(exported.CodeUnauthorizedAccess, errors.New("unauthorized"))
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+
+	var reported []ProcessErrorSource
+
+	err = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error { return nil }, func(ctx context.Context, args *ProcessErrorArgs) {
+		reported = append(reported, args.ErrorSource)
+	})
+
+	var sbErr *Error
+	require.ErrorAs(t, err, &sbErr)
+	require.Equal(t, CodeUnauthorizedAccess, sbErr.Code)
+	require.Equal(t, []ProcessErrorSource{ProcessErrorSourceReceive}, reported)
+}
+
+func TestProcessor_Options(t *testing.T) {
+	receiver := newFakeProcessorReceiver()
+
+	_, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{MaxConcurrentCalls: -1})
+	require.EqualError(t, err, "MaxConcurrentCalls must be greater than or equal to 0")
+
+	_, err = newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{ReceiveMode: ReceiveMode(100)})
+	require.Error(t, err)
+
+	processor, err := newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, processor.pump.maxConcurrentCalls)
+	require.Equal(t, 5*time.Minute, processor.pump.maxAutoLockRenewal)
+	require.True(t, processor.pump.autoComplete)
+
+	processor, err = newProcessorImpl(receiver, "queue", receiver.RenewMessageLock, RetryOptions{}, &ProcessorOptions{MaxAutoLockRenewalDuration: -1})
+	require.NoError(t, err)
+	require.Zero(t, processor.pump.maxAutoLockRenewal)
+
+	err = processor.Run(context.Background(), nil, nil)
+	require.EqualError(t, err, "handleMessage must not be nil")
+}
+
+func TestSessionProcessor(t *testing.T) {
+	sessions := make(chan processorSessionReceiver, 2)
+
+	session1 := newFakeProcessorSessionReceiver("session 1", newTestMessages(2)...)
+	session2 := newFakeProcessorSessionReceiver("session 2", newTestMessages(1)...)
+	sessions <- session1
+	sessions <- session2
+
+	acceptNextSession := func(ctx context.Context) (processorSessionReceiver, error) {
+		select {
+		case s := <-sessions:
+			return s, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	processor, err := newSessionProcessorImpl("queue", acceptNextSession, RetryOptions{}, &SessionProcessorOptions{
+		MaxConcurrentSessions: 2,
+		SessionIdleTimeout:    50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	handled := map[string][]string{}
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer wg.Done()
+
+			require.NoError(t, args.SetSessionState(ctx, []byte("state"), nil))
+
+			mu.Lock()
+			handled[*args.SessionID] = append(handled[*args.SessionID], args.Message.MessageID)
+			mu.Unlock()
+			return nil
+		}, nil)
+	}()
+
+	wg.Wait()
+
+	// idle sessions are closed so the next session can be accepted.
+	require.Eventually(t, func() bool {
+		return session1.closed.Load() && session2.closed.Load()
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, processor.Close(context.Background()))
+
+	require.Equal(t, map[string][]string{
+		"session 1": {"message 0", "message 1"},
+		"session 2": {"message 0"},
+	}, handled)
+
+	require.Equal(t, []string{"message 0", "message 1"}, session1.Settled("complete"))
+	require.Equal(t, "state", string(session1.state))
+}
+
+func TestSessionProcessor_AcceptErrors(t *testing.T) {
+	var accepts atomic.Int32
+
+	acceptNextSession := func(ctx context.Context) (processorSessionReceiver, error) {
+		if accepts.Add(1) == 1 {
+			return nil, exported.NewError(exported.CodeTimeout, errors.New("no sessions available"))
+		}
+
+		return nil, exported.NewError(exported.CodeNotFound, errors.New("entity not found"))
+	}
+
+	processor, err := newSessionProcessorImpl("queue", acceptNextSession, RetryOptions{}, &SessionProcessorOptions{
+		MaxConcurrentSessions: 1,
+	})
+	require.NoError(t, err)
+
+	var reported []ProcessErrorSource
+
+	err = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error { return nil }, func(ctx context.Context, args *ProcessErrorArgs) {
+		reported = append(reported, args.ErrorSource)
+	})
+
+	var sbErr *Error
+	require.ErrorAs(t, err, &sbErr)
+	require.Equal(t, CodeNotFound, sbErr.Code)
+
+	// timeouts just mean there are no sessions available, so they aren't reported.
+	require.Equal(t, []ProcessErrorSource{ProcessErrorSourceAcceptSession}, reported)
+}
+
+func TestSessionProcessor_RenewsSessionLock(t *testing.T) {
+	session := newFakeProcessorSessionReceiver("session 1", newTestMessages(1)...)
+	session.lockedUntil = time.Now().Add(2 * minLockRenewalInterval)
+
+	sessions := make(chan processorSessionReceiver, 1)
+	sessions <- session
+
+	acceptNextSession := func(ctx context.Context) (processorSessionReceiver, error) {
+		select {
+		case s := <-sessions:
+			return s, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	processor, err := newSessionProcessorImpl("queue", acceptNextSession, RetryOptions{}, &SessionProcessorOptions{
+		MaxConcurrentSessions: 1,
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = processor.Run(context.Background(), func(ctx context.Context, args *ProcessMessageArgs) error {
+			defer close(done)
+			time.Sleep(3 * minLockRenewalInterval)
+			return nil
+		}, nil)
+	}()
+
+	<-done
+	require.NoError(t, processor.Close(context.Background()))
+
+	require.GreaterOrEqual(t, session.sessionRenewals.Load(), int32(2))
+	require.Zero(t, session.renewals.Load(), "message locks aren't renewed for sessions")
+	require.True(t, session.closed.Load())
+}
+
+func Test_calcProcessorRetryDelay(t *testing.T) {
+	require.Equal(t, 4*time.Second, calcProcessorRetryDelay(RetryOptions{}, 1))
+	require.Equal(t, 16*time.Second, calcProcessorRetryDelay(RetryOptions{}, 3))
+	require.Equal(t, 120*time.Second, calcProcessorRetryDelay(RetryOptions{}, 100))
+	require.Equal(t, 3*time.Second, calcProcessorRetryDelay(RetryOptions{RetryDelay: time.Second, MaxRetryDelay: 3 * time.Second}, 10))
+	require.Zero(t, calcProcessorRetryDelay(RetryOptions{RetryDelay: -1}, 10))
+}
+
+func newTestMessages(n int) []*ReceivedMessage {
+	var messages []*ReceivedMessage
+
+	for i := 0; i < n; i++ {
+		messages = append(messages, &ReceivedMessage{
+			MessageID:   fmt.Sprintf("message %d", i),
+			LockedUntil: to.Ptr(time.Now().Add(time.Hour)),
+		})
+	}
+
+	return messages
+}
+
+type fakeProcessorReceiver struct {
+	mu            sync.Mutex
+	messages      []*ReceivedMessage
+	settled       map[string][]string
+	receiveCounts []int
+	receiveErr    error
+
+	lockDuration time.Duration
+	renewErr     error
+	renewals     atomic.Int32
+	closed       atomic.Bool
+}
+
+func newFakeProcessorReceiver(messages ...*ReceivedMessage) *fakeProcessorReceiver {
+	return &fakeProcessorReceiver{
+		messages: messages,
+		settled:  map[string][]string{},
+	}
+}
+
+func (r *fakeProcessorReceiver) ReceiveMessages(ctx context.Context, maxMessages int, options *ReceiveMessagesOptions) ([]*ReceivedMessage, error) {
+	if r.receiveErr != nil {
+		return nil, r.receiveErr
+	}
+
+	r.mu.Lock()
+	n := min(maxMessages, len(r.messages))
+	messages := r.messages[:n]
+	r.messages = r.messages[n:]
+	r.receiveCounts = append(r.receiveCounts, maxMessages)
+	r.mu.Unlock()
+
+	if len(messages) > 0 {
+		return messages, nil
+	}
+
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (r *fakeProcessorReceiver) settle(kind string, message *ReceivedMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.settled[kind] = append(r.settled[kind], message.MessageID)
+	return nil
+}
+
+func (r *fakeProcessorReceiver) Settled(kind string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.settled[kind]
+}
+
+func (r *fakeProcessorReceiver) ReceiveCounts() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.receiveCounts
+}
+
+func (r *fakeProcessorReceiver) CompleteMessage(ctx context.Context, message *ReceivedMessage, options *CompleteMessageOptions) error {
+	return r.settle("complete", message)
+}
+
+func (r *fakeProcessorReceiver) AbandonMessage(ctx context.Context, message *ReceivedMessage, options *AbandonMessageOptions) error {
+	return r.settle("abandon", message)
+}
+
+func (r *fakeProcessorReceiver) DeferMessage(ctx context.Context, message *ReceivedMessage, options *DeferMessageOptions) error {
+	return r.settle("defer", message)
+}
+
+func (r *fakeProcessorReceiver) DeadLetterMessage(ctx context.Context, message *ReceivedMessage, options *DeadLetterOptions) error {
+	return r.settle("deadletter", message)
+}
+
+func (r *fakeProcessorReceiver) RenewMessageLock(ctx context.Context, msg *ReceivedMessage, options *RenewMessageLockOptions) error {
+	r.renewals.Add(1)
+
+	if r.renewErr != nil {
+		return r.renewErr
+	}
+
+	msg.LockedUntil = to.Ptr(time.Now().Add(r.lockDuration))
+	return nil
+}
+
+func (r *fakeProcessorReceiver) Close(ctx context.Context) error {
+	r.closed.Store(true)
+	return nil
+}
+
+type fakeProcessorSessionReceiver struct {
+	*fakeProcessorReceiver
+	sessionID       string
+	lockedUntil     time.Time
+	sessionRenewals atomic.Int32
+	state           []byte
+}
+
+func newFakeProcessorSessionReceiver(sessionID string, messages ...*ReceivedMessage) *fakeProcessorSessionReceiver {
+	return &fakeProcessorSessionReceiver{
+		fakeProcessorReceiver: newFakeProcessorReceiver(messages...),
+		sessionID:             sessionID,
+		lockedUntil:           time.Now().Add(time.Hour),
+	}
+}
+
+func (r *fakeProcessorSessionReceiver) SessionID() string {
+	return r.sessionID
+}
+
+func (r *fakeProcessorSessionReceiver) LockedUntil() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lockedUntil
+}
+
+func (r *fakeProcessorSessionReceiver) RenewSessionLock(ctx context.Context, options *RenewSessionLockOptions) error {
+	r.sessionRenewals.Add(1)
+
+	r.mu.Lock()
+	r.lockedUntil = time.Now().Add(2 * minLockRenewalInterval)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *fakeProcessorSessionReceiver) GetSessionState(ctx context.Context, options *GetSessionStateOptions) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state, nil
+}
+
+func (r *fakeProcessorSessionReceiver) SetSessionState(ctx context.Context, state []byte, options *SetSessionStateOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state = state
+	return nil
+}
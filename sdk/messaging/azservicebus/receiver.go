@@ -320,6 +320,108 @@ func (r *Receiver) PeekMessages(ctx context.Context, maxMessageCount int, option
 	return receivedMessages, internal.TransformError(err)
 }
 
+// DeleteMessagesOptions contains optional parameters for the DeleteMessages function.
+type DeleteMessagesOptions struct {
+	// BeforeEnqueueTime limits deletion to messages that were enqueued before this time.
+	// Defaults to the current time.
+	BeforeEnqueueTime *time.Time
+}
+
+// DeleteMessages deletes up to maxMessages messages from the queue, subscription or subqueue
+// (using [ReceiverOptions.SubQueue]) in a single service operation. Messages are deleted without
+// being received or locked. maxMessages must be between 1 and 4000.
+//
+// It returns the number of messages that were deleted, which can be less than maxMessages even if
+// more messages remain. Use [Receiver.PurgeMessages] to delete all matching messages.
+//
+// The delete isn't retried if it fails, since it can have deleted messages before failing.
+//
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (r *Receiver) DeleteMessages(ctx context.Context, maxMessages int, options *DeleteMessagesOptions) (int, error) {
+	if maxMessages <= 0 || maxMessages > internal.MaxDeleteMessageCount {
+		return 0, fmt.Errorf("maxMessages must be between 1 and %d", internal.MaxDeleteMessageCount)
+	}
+
+	beforeEnqueueTime := time.Now()
+
+	if options != nil && options.BeforeEnqueueTime != nil {
+		beforeEnqueueTime = *options.BeforeEnqueueTime
+	}
+
+	return r.deleteMessages(ctx, int32(maxMessages), beforeEnqueueTime)
+}
+
+// PurgeMessagesOptions contains optional parameters for the PurgeMessages function.
+type PurgeMessagesOptions struct {
+	// BeforeEnqueueTime limits deletion to messages that were enqueued before this time.
+	// Defaults to the time PurgeMessages is called, so messages that arrive while purging
+	// are not deleted.
+	BeforeEnqueueTime *time.Time
+}
+
+// PurgeMessages deletes all messages from the queue, subscription or subqueue (using [ReceiverOptions.SubQueue])
+// by calling the batch delete operation until no matching messages remain. Messages are deleted without
+// being received or locked.
+//
+// It returns the number of messages that were deleted. If the operation fails, or ctx is cancelled, the
+// returned count includes the messages deleted by the batches that succeeded. A batch that fails isn't
+// retried, but calling PurgeMessages again with the same BeforeEnqueueTime continues the purge.
+//
+// If the operation fails it can return an [*Error] type if the failure is actionable.
+func (r *Receiver) PurgeMessages(ctx context.Context, options *PurgeMessagesOptions) (int, error) {
+	beforeEnqueueTime := time.Now()
+
+	if options != nil && options.BeforeEnqueueTime != nil {
+		beforeEnqueueTime = *options.BeforeEnqueueTime
+	}
+
+	total := 0
+
+	for {
+		deleted, err := r.deleteMessages(ctx, internal.MaxDeleteMessageCount, beforeEnqueueTime)
+		total += deleted
+
+		if err != nil {
+			return total, err
+		}
+
+		r.amqpLinks.Writef(EventReceiver, "Purged %d messages (%d total)", deleted, total)
+
+		// a batch can delete fewer messages than requested even when more remain, so we only stop once
+		// a batch deletes nothing.
+		if deleted == 0 {
+			return total, nil
+		}
+	}
+}
+
+func (r *Receiver) deleteMessages(ctx context.Context, maxMessages int32, beforeEnqueueTime time.Time) (int, error) {
+	var deleted int32
+	var deleteErr error
+
+	// Only getting the links is retried. Deleting messages isn't idempotent: a delete that fails can
+	// still have deleted messages, and retrying it would delete another batch.
+	err := r.amqpLinks.Retry(ctx, EventReceiver, "deleteMessages", func(ctx context.Context, lwid *internal.LinksWithID, args *utils.RetryFnArgs) error {
+		count, err := internal.DeleteMessages(ctx, lwid.RPC, lwid.Receiver.LinkName(), beforeEnqueueTime, maxMessages)
+
+		if err != nil {
+			deleteErr = err
+			return internal.NewErrNonRetriable(err.Error())
+		}
+
+		deleted = count
+		return nil
+	}, r.retryOptions)
+
+	if deleteErr != nil {
+		// the links are recovered, if needed, by the next call.
+		_ = r.amqpLinks.CloseIfNeeded(context.Background(), deleteErr)
+		err = deleteErr
+	}
+
+	return int(deleted), internal.TransformError(err)
+}
+
 // RenewMessageLockOptions contains optional parameters for the RenewMessageLock function.
 type RenewMessageLockOptions struct {
 	// For future expansion
@@ -6,6 +6,7 @@ package azservicebus
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -486,3 +487,129 @@ func defaultNewReceiverArgsForTest() newReceiverArgs {
 		retryOptions: exported.RetryOptions{},
 	}
 }
+
+func TestReceiver_DeleteAndPurgeMessages(t *testing.T) {
+	deleteResponse := func(count int32) *amqpwrap.RPCResponse {
+		return &amqpwrap.RPCResponse{
+			Code:    200,
+			Message: &amqp.Message{Value: map[string]any{"message-count": count}},
+		}
+	}
+
+	newTestReceiver := func(rpcLink amqpwrap.RPCLink) *Receiver {
+		return &Receiver{
+			amqpLinks: &internal.FakeAMQPLinks{
+				Receiver: &internal.FakeAMQPReceiver{},
+				RPC:      rpcLink,
+			},
+		}
+	}
+
+	t.Run("DeleteMessages", func(t *testing.T) {
+		rpcLink := &scriptedRPCLink{t: t, responses: []*amqpwrap.RPCResponse{deleteResponse(5)}}
+		receiver := newTestReceiver(rpcLink)
+		before := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		deleted, err := receiver.DeleteMessages(context.Background(), 10, &DeleteMessagesOptions{BeforeEnqueueTime: &before})
+		require.NoError(t, err)
+		require.Equal(t, 5, deleted)
+
+		require.Len(t, rpcLink.calls, 1)
+		require.Equal(t, map[string]any{
+			"enqueued-time-utc": before,
+			"message-count":     int32(10),
+		}, rpcLink.calls[0].Value)
+	})
+
+	t.Run("DeleteMessagesInvalidCount", func(t *testing.T) {
+		receiver := newTestReceiver(&scriptedRPCLink{t: t})
+
+		for _, count := range []int{0, -1, internal.MaxDeleteMessageCount + 1} {
+			_, err := receiver.DeleteMessages(context.Background(), count, nil)
+			require.EqualError(t, err, "maxMessages must be between 1 and 4000")
+		}
+	})
+
+	t.Run("PurgeMessages", func(t *testing.T) {
+		rpcLink := &scriptedRPCLink{t: t, responses: []*amqpwrap.RPCResponse{
+			deleteResponse(internal.MaxDeleteMessageCount),
+			deleteResponse(internal.MaxDeleteMessageCount),
+			deleteResponse(7),
+			deleteResponse(0),
+		}}
+		receiver := newTestReceiver(rpcLink)
+
+		deleted, err := receiver.PurgeMessages(context.Background(), nil)
+		require.NoError(t, err)
+		require.Equal(t, 2*internal.MaxDeleteMessageCount+7, deleted)
+		require.Len(t, rpcLink.calls, 4)
+
+		// every batch uses the same cutoff, so messages that arrive while purging are kept.
+		cutoff := rpcLink.calls[0].Value.(map[string]any)["enqueued-time-utc"]
+
+		for _, call := range rpcLink.calls {
+			require.Equal(t, cutoff, call.Value.(map[string]any)["enqueued-time-utc"])
+			require.Equal(t, int32(internal.MaxDeleteMessageCount), call.Value.(map[string]any)["message-count"])
+		}
+	})
+
+	t.Run("PurgeMessagesShortBatch", func(t *testing.T) {
+		// the service can delete fewer messages than requested, even though more messages remain.
+		rpcLink := &scriptedRPCLink{t: t, responses: []*amqpwrap.RPCResponse{
+			deleteResponse(100),
+			deleteResponse(internal.MaxDeleteMessageCount),
+			deleteResponse(3),
+			deleteResponse(0),
+		}}
+		receiver := newTestReceiver(rpcLink)
+
+		deleted, err := receiver.PurgeMessages(context.Background(), nil)
+		require.NoError(t, err)
+		require.Equal(t, 100+internal.MaxDeleteMessageCount+3, deleted)
+		require.Len(t, rpcLink.calls, 4)
+	})
+
+	t.Run("DeleteMessagesNotRetried", func(t *testing.T) {
+		// a delete that fails can still have deleted messages, so it isn't retried, even for errors
+		// that other operations retry.
+		rpcLink := &scriptedRPCLink{
+			t:         t,
+			responses: []*amqpwrap.RPCResponse{nil, deleteResponse(5)},
+			errs:      []error{io.EOF, nil},
+		}
+		client, ns := newClientForListSessionsUnitTest(t, rpcLink)
+		ns.Session = &internal.FakeAMQPSession{
+			NewReceiverFn: func(ctx context.Context, source string, opts *amqp.ReceiverOptions) (amqpwrap.AMQPReceiverCloser, error) {
+				return &internal.FakeAMQPReceiver{}, nil
+			},
+		}
+		receiver, err := client.NewReceiverForQueue("queue", nil)
+		require.NoError(t, err)
+
+		_, err = receiver.DeleteMessages(context.Background(), 10, nil)
+		require.Error(t, err)
+		require.Len(t, rpcLink.calls, 1)
+
+		// the links are recovered by the next call
+		deleted, err := receiver.DeleteMessages(context.Background(), 10, nil)
+		require.NoError(t, err)
+		require.Equal(t, 5, deleted)
+		require.Len(t, rpcLink.calls, 2)
+	})
+
+	t.Run("PurgeMessagesPartialFailure", func(t *testing.T) {
+		rpcLink := &scriptedRPCLink{
+			t:         t,
+			responses: []*amqpwrap.RPCResponse{deleteResponse(internal.MaxDeleteMessageCount), nil},
+			errs:      []error{nil, internal.RPCError{Resp: &amqpwrap.RPCResponse{Code: 404}}},
+		}
+		receiver := newTestReceiver(rpcLink)
+
+		deleted, err := receiver.PurgeMessages(context.Background(), nil)
+		require.Equal(t, internal.MaxDeleteMessageCount, deleted)
+
+		var sbErr *Error
+		require.ErrorAs(t, err, &sbErr)
+		require.Equal(t, CodeNotFound, sbErr.Code)
+	})
+}
@@ -0,0 +1,383 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package azservicebus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	azlog "github.com/Azure/azure-sdk-for-go/sdk/internal/log"
+)
+
+// SessionProcessorOptions contains options for the [Client.NewSessionProcessorForQueue] or
+// [Client.NewSessionProcessorForSubscription] functions.
+type SessionProcessorOptions struct {
+	// ReceiveMode controls when a message is deleted from Service Bus.
+	//
+	// [ReceiveModePeekLock] is the default. Messages are settled automatically, based
+	// on the result of your handler, unless DisableAutoComplete is true.
+	//
+	// [ReceiveModeReceiveAndDelete] causes Service Bus to remove the message as soon
+	// as it's received. Messages are not settled.
+	ReceiveMode ReceiveMode
+
+	// MaxConcurrentSessions is the maximum number of sessions that will be processed at
+	// the same time.
+	//
+	// Defaults to 8.
+	MaxConcurrentSessions int
+
+	// MaxConcurrentCallsPerSession is the maximum number of messages, from a single session,
+	// that will be passed to your handler at the same time. Values greater than 1 do not
+	// preserve the order of messages within a session.
+	//
+	// Defaults to 1.
+	MaxConcurrentCallsPerSession int
+
+	// MaxAutoLockRenewalDuration is the maximum amount of time the SessionProcessor will continue
+	// to renew the lock for a session.
+	//
+	// Defaults to 5 minutes. Disabled if MaxAutoLockRenewalDuration < 0.
+	MaxAutoLockRenewalDuration time.Duration
+
+	// SessionIdleTimeout is the amount of time to wait for a message from a session before
+	// closing it, and accepting the next available session.
+	//
+	// Defaults to 1 minute.
+	SessionIdleTimeout time.Duration
+
+	// DisableAutoComplete stops the SessionProcessor from settling messages after your handler returns.
+	//
+	// By default a message is completed if your handler returns nil, and abandoned if it
+	// returns an error. Messages that your handler settles itself, using one of the
+	// settlement functions on [ProcessMessageArgs], are never settled again.
+	DisableAutoComplete bool
+}
+
+// SessionProcessor accepts sessions from a session-enabled queue or subscription and passes
+// their messages to a [ProcessMessageHandler].
+//
+// Each session is processed until it's idle for [SessionProcessorOptions.SessionIdleTimeout], at
+// which point it's closed and the next available session is accepted. Session locks are renewed
+// automatically, and messages are settled in the same way as a [Processor].
+//
+// Create a SessionProcessor using [Client.NewSessionProcessorForQueue] or [Client.NewSessionProcessorForSubscription].
+type SessionProcessor struct {
+	entityPath         string
+	acceptNextSession  func(ctx context.Context) (processorSessionReceiver, error)
+	receiveMode        ReceiveMode
+	maxSessions        int
+	maxCallsPerSession int
+	maxAutoLockRenewal time.Duration
+	idleTimeout        time.Duration
+	autoComplete       bool
+	retryOptions       RetryOptions
+	lifecycle          processorLifecycle
+}
+
+// processorSessionReceiver is the subset of [SessionReceiver] that the SessionProcessor uses.
+// It's an interface here to make testing easier.
+type processorSessionReceiver interface {
+	processorReceiver
+	SessionID() string
+	LockedUntil() time.Time
+	RenewSessionLock(ctx context.Context, options *RenewSessionLockOptions) error
+	GetSessionState(ctx context.Context, options *GetSessionStateOptions) ([]byte, error)
+	SetSessionState(ctx context.Context, state []byte, options *SetSessionStateOptions) error
+}
+
+// NewSessionProcessorForQueue creates a SessionProcessor for a session-enabled queue.
+func (client *Client) NewSessionProcessorForQueue(queueName string, options *SessionProcessorOptions) (*SessionProcessor, error) {
+	return client.newSessionProcessor(entity{Queue: queueName}, options)
+}
+
+// NewSessionProcessorForSubscription creates a SessionProcessor for a session-enabled subscription.
+func (client *Client) NewSessionProcessorForSubscription(topicName string, subscriptionName string, options *SessionProcessorOptions) (*SessionProcessor, error) {
+	return client.newSessionProcessor(entity{Topic: topicName, Subscription: subscriptionName}, options)
+}
+
+func (client *Client) newSessionProcessor(e entity, options *SessionProcessorOptions) (*SessionProcessor, error) {
+	entityPath, err := e.String()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var receiverOptions *SessionReceiverOptions
+
+	if options != nil {
+		receiverOptions = &SessionReceiverOptions{ReceiveMode: options.ReceiveMode}
+	}
+
+	acceptNextSession := func(ctx context.Context) (processorSessionReceiver, error) {
+		sessionReceiver, err := client.acceptNextSessionForEntity(ctx, e, receiverOptions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return sessionReceiver, nil
+	}
+
+	return newSessionProcessorImpl(entityPath, acceptNextSession, client.retryOptions, options)
+}
+
+func newSessionProcessorImpl(entityPath string, acceptNextSession func(ctx context.Context) (processorSessionReceiver, error), retryOptions RetryOptions, options *SessionProcessorOptions) (*SessionProcessor, error) {
+	if options == nil {
+		options = &SessionProcessorOptions{}
+	}
+
+	if err := checkReceiverMode(options.ReceiveMode); err != nil {
+		return nil, err
+	}
+
+	maxSessions, err := defaultConcurrency("MaxConcurrentSessions", options.MaxConcurrentSessions, 8)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxCallsPerSession, err := defaultConcurrency("MaxConcurrentCallsPerSession", options.MaxConcurrentCallsPerSession, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idleTimeout := time.Minute
+
+	if options.SessionIdleTimeout > 0 {
+		idleTimeout = options.SessionIdleTimeout
+	}
+
+	return &SessionProcessor{
+		entityPath:         entityPath,
+		acceptNextSession:  acceptNextSession,
+		receiveMode:        options.ReceiveMode,
+		maxSessions:        maxSessions,
+		maxCallsPerSession: maxCallsPerSession,
+		maxAutoLockRenewal: defaultAutoLockRenewal(options.MaxAutoLockRenewalDuration),
+		idleTimeout:        idleTimeout,
+		autoComplete:       !options.DisableAutoComplete,
+		retryOptions:       retryOptions,
+		lifecycle:          newProcessorLifecycle(),
+	}, nil
+}
+
+// Run accepts sessions and passes their messages to handleMessage, blocking until the passed in
+// context is cancelled, [SessionProcessor.Close] is called, or an unrecoverable error occurs.
+//
+// handleError is optional. If it's not nil, it is called with any errors that occur while processing.
+//
+// When the context is cancelled the SessionProcessor stops receiving, cancels the context passed to
+// any running handlers and waits for them to return. Use [SessionProcessor.Close] instead to let
+// running handlers finish before stopping.
+//
+// On cancellation, or after Close, Run returns a nil error. Once a SessionProcessor has been stopped
+// it cannot be restarted and a new instance must be created.
+func (p *SessionProcessor) Run(ctx context.Context, handleMessage ProcessMessageHandler, handleError ProcessErrorHandler) error {
+	if handleMessage == nil {
+		return errors.New("handleMessage must not be nil")
+	}
+
+	ctx, err := p.lifecycle.start(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer p.lifecycle.finish()
+
+	// a fatal error from any of the session workers stops all of them.
+	workerCtx, cancelWorkers := context.WithCancel(ctx)
+	defer cancelWorkers()
+
+	var fatalErr error
+	var fatalOnce sync.Once
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.maxSessions; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := p.runSessionWorker(workerCtx, handleMessage, handleError); err != nil {
+				fatalOnce.Do(func() {
+					fatalErr = err
+					cancelWorkers()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return fatalErr
+}
+
+// Close stops the SessionProcessor from accepting sessions and receiving new messages, and waits
+// for any running handlers to finish and their messages to be settled. If ctx is cancelled before
+// that happens, the contexts passed to the running handlers are cancelled as well.
+//
+// Sessions are closed once all of their handlers have returned.
+func (p *SessionProcessor) Close(ctx context.Context) error {
+	p.lifecycle.stop(ctx)
+	return nil
+}
+
+// runSessionWorker accepts and processes sessions, one at a time, until the processor stops.
+func (p *SessionProcessor) runSessionWorker(ctx context.Context, handleMessage ProcessMessageHandler, handleError ProcessErrorHandler) error {
+	acceptCtx, cancelAccept := context.WithCancel(ctx)
+	defer cancelAccept()
+
+	go func() {
+		select {
+		case <-p.lifecycle.stopReceiving:
+			cancelAccept()
+		case <-acceptCtx.Done():
+		}
+	}()
+
+	failures := int32(0)
+
+	for {
+		sessionReceiver, err := p.acceptNextSession(acceptCtx)
+
+		if err != nil {
+			if acceptCtx.Err() != nil {
+				return nil
+			}
+
+			if sbErr := (*Error)(nil); errors.As(err, &sbErr) && sbErr.Code == CodeTimeout {
+				// there are no sessions available - this is expected, so we just try again.
+				failures = 0
+				continue
+			}
+
+			p.reportError(ctx, handleError, &ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceAcceptSession})
+
+			if isFatalProcessorError(err) {
+				return err
+			}
+
+			failures++
+
+			select {
+			case <-time.After(calcProcessorRetryDelay(p.retryOptions, failures)):
+			case <-acceptCtx.Done():
+				return nil
+			}
+			continue
+		}
+
+		failures = 0
+
+		if err := p.processSession(ctx, sessionReceiver, handleMessage, handleError); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *SessionProcessor) processSession(ctx context.Context, sessionReceiver processorSessionReceiver, handleMessage ProcessMessageHandler, handleError ProcessErrorHandler) error {
+	sessionID := sessionReceiver.SessionID()
+	azlog.Writef(EventReceiver, "[%s] Processing session %q", p.entityPath, sessionID)
+
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+		defer cancel()
+
+		if err := sessionReceiver.Close(closeCtx); err != nil {
+			azlog.Writef(EventReceiver, "[%s] Failed to close session %q: %s", p.entityPath, sessionID, err)
+		}
+	}()
+
+	pump := &messagePump{
+		receiver:           sessionReceiver,
+		session:            sessionReceiver,
+		sessionID:          &sessionID,
+		entityPath:         p.entityPath,
+		receiveMode:        p.receiveMode,
+		maxConcurrentCalls: p.maxCallsPerSession,
+		maxAutoLockRenewal: p.maxAutoLockRenewal,
+		autoComplete:       p.autoComplete,
+		retryOptions:       p.retryOptions,
+		idleTimeout:        p.idleTimeout,
+	}
+
+	if p.receiveMode == ReceiveModePeekLock && p.maxAutoLockRenewal > 0 {
+		renewCtx, cancelRenew := context.WithCancel(ctx)
+		renewDone := make(chan struct{})
+
+		go func() {
+			defer close(renewDone)
+			pump.autoRenewSessionLock(renewCtx, sessionReceiver, handleError)
+		}()
+
+		defer func() {
+			cancelRenew()
+			<-renewDone
+		}()
+	}
+
+	err := pump.Run(ctx, p.lifecycle.stopReceiving, handleMessage, handleError)
+
+	if err != nil {
+		var sbErr *Error
+
+		// losing the session lock only affects this session - we can move on to the next one.
+		if errors.As(err, &sbErr) && (sbErr.Code == CodeLockLost || sbErr.Code == CodeClosed) {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// autoRenewSessionLock renews the lock for the session until ctx is cancelled, the lock is lost, or
+// the maximum auto lock renewal duration has elapsed.
+func (mp *messagePump) autoRenewSessionLock(ctx context.Context, sessionReceiver processorSessionReceiver, handleError ProcessErrorHandler) {
+	renewUntil := time.Now().Add(mp.maxAutoLockRenewal)
+
+	for {
+		lockedUntil := sessionReceiver.LockedUntil()
+
+		if lockedUntil.IsZero() || !lockedUntil.Before(renewUntil) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(calcLockRenewalDelay(lockedUntil)):
+		}
+
+		if err := sessionReceiver.RenewSessionLock(ctx, nil); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			mp.reportError(ctx, handleError, &ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceRenewLock})
+
+			if sbErr := (*Error)(nil); errors.As(err, &sbErr) && sbErr.Code == CodeLockLost {
+				return
+			}
+		}
+	}
+}
+
+func (p *SessionProcessor) reportError(ctx context.Context, handleError ProcessErrorHandler, args *ProcessErrorArgs) {
+	args.EntityPath = p.entityPath
+
+	azlog.Writef(EventReceiver, "[%s] Processor error (%s): %s", p.entityPath, args.ErrorSource, args.Err)
+
+	if handleError != nil {
+		handleError(ctx, args)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package eventhandler_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azwebpubsub/eventhandler"
+)
+
+func ExampleNewHandler() {
+	// the Web PubSub service's access key, used to validate that requests came from the service.
+	accessKey := os.Getenv("WEBPUBSUB_ACCESS_KEY")
+
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AllowedEndpoints: []string{"https://<resource>.webpubsub.azure.com"},
+		AccessKeys:       []string{accessKey},
+		OnConnect: func(ctx context.Context, req *eventhandler.ConnectRequest) (*eventhandler.ConnectResponse, error) {
+			if len(req.Claims["sub"]) == 0 {
+				return nil, &eventhandler.Error{Code: eventhandler.ErrorCodeUnauthorized, Message: "sign in to chat"}
+			}
+
+			// join the connection to the room the client asked for.
+			return &eventhandler.ConnectResponse{
+				Groups: req.Query["room"],
+				Roles:  []string{"webpubsub.sendToGroup", "webpubsub.joinLeaveGroup"},
+			}, nil
+		},
+		OnUserEvent: func(ctx context.Context, req *eventhandler.UserEventRequest) (*eventhandler.UserEventResponse, error) {
+			fmt.Printf("Event %s from %s: %s\n", req.Context.EventName, req.Context.UserID, req.Data)
+
+			return &eventhandler.UserEventResponse{
+				DataType: eventhandler.DataTypeText,
+				Data:     []byte("received"),
+			}, nil
+		},
+		OnDisconnected: func(ctx context.Context, req *eventhandler.DisconnectedRequest) {
+			fmt.Printf("Connection %s disconnected: %s\n", req.Context.ConnectionID, req.Reason)
+		},
+	})
+
+	if err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	// configure the hub's event handler URL template as https://<your-host>/eventhandler
+	http.Handle("/eventhandler", handler)
+}
@@ -0,0 +1,425 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+// Package eventhandler contains an [http.Handler] for the Web PubSub service's CloudEvents upstream
+// protocol, so a Go service can act as the event handler for a hub.
+//
+// The [Handler] completes the webhook abuse protection handshake, validates request signatures, and
+// calls your functions for connect, connected, disconnected and user events.
+// See https://learn.microsoft.com/azure/azure-web-pubsub/reference-cloud-events
+package eventhandler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	eventTypeConnect      = "azure.webpubsub.sys.connect"
+	eventTypeConnected    = "azure.webpubsub.sys.connected"
+	eventTypeDisconnected = "azure.webpubsub.sys.disconnected"
+	eventTypeUserPrefix   = "azure.webpubsub.user."
+
+	headerConnectionState = "ce-connectionState"
+)
+
+// HandlerOptions contains optional parameters for [NewHandler].
+type HandlerOptions struct {
+	// AllowedEndpoints are the endpoints of the Web PubSub services that can send events to the handler,
+	// ex: "https://<resource>.webpubsub.azure.com". They are used for the abuse protection handshake.
+	//
+	// If empty, the handshake is rejected for every service.
+	AllowedEndpoints []string
+
+	// AccessKeys are the access keys of the Web PubSub service. Each request's signature is validated,
+	// and requests without a valid signature are rejected with http.StatusUnauthorized.
+	// Include both keys, so the handler keeps working while keys are rotated.
+	//
+	// At least one key is required, unless AllowUnauthenticated is true.
+	AccessKeys []string
+
+	// AllowUnauthenticated accepts requests without a valid signature when AccessKeys is empty, ex: when
+	// the service authenticates to the handler with Microsoft Entra ID, which the handler doesn't validate.
+	AllowUnauthenticated bool
+
+	// MaxRequestBodyBytes is the largest request body that is accepted.
+	//
+	// The default is 1MiB, the largest message the Web PubSub service accepts.
+	MaxRequestBodyBytes int64
+
+	// OnConnect is called before a client's connection is established. Return an [Error] to reject the connection.
+	//
+	// If nil, all connections are accepted.
+	OnConnect func(ctx context.Context, req *ConnectRequest) (*ConnectResponse, error)
+
+	// OnConnected is called after a client's connection is established.
+	OnConnected func(ctx context.Context, req *ConnectedRequest)
+
+	// OnUserEvent is called when a client sends an event. The response's data is sent back to the client.
+	//
+	// If nil, user events are accepted and no data is sent back.
+	OnUserEvent func(ctx context.Context, req *UserEventRequest) (*UserEventResponse, error)
+
+	// OnDisconnected is called after a client's connection is closed.
+	OnDisconnected func(ctx context.Context, req *DisconnectedRequest)
+}
+
+// Handler is an [http.Handler] for the events of a Web PubSub hub.
+// Don't use this type directly, use [NewHandler] instead.
+type Handler struct {
+	hub            string
+	allowedOrigins []string
+	options        HandlerOptions
+}
+
+// NewHandler creates a Handler for the events of hub.
+func NewHandler(hub string, options *HandlerOptions) (*Handler, error) {
+	if hub == "" {
+		return nil, errors.New("empty hub name is not allowed")
+	}
+
+	if options == nil {
+		options = &HandlerOptions{}
+	}
+
+	if len(options.AccessKeys) == 0 && !options.AllowUnauthenticated {
+		return nil, errors.New("at least one access key is required, or AllowUnauthenticated must be true")
+	}
+
+	for _, key := range options.AccessKeys {
+		if key == "" {
+			return nil, errors.New("empty access key is not allowed")
+		}
+	}
+
+	h := &Handler{
+		hub:     hub,
+		options: *options,
+	}
+
+	for _, endpoint := range options.AllowedEndpoints {
+		u, err := url.Parse(endpoint)
+
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("allowed endpoint %q is not a valid URL", endpoint)
+		}
+
+		h.allowedOrigins = append(h.allowedOrigins, u.Host)
+	}
+
+	if h.options.MaxRequestBodyBytes <= 0 {
+		h.options.MaxRequestBodyBytes = 1024 * 1024
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		h.serveAbuseProtection(w, r)
+	case http.MethodPost:
+		h.serveEvent(w, r)
+	default:
+		w.Header().Set("Allow", "OPTIONS, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveAbuseProtection handles the CloudEvents webhook validation request.
+// See https://github.com/cloudevents/spec/blob/v1.0/http-webhook.md#4-abuse-protection
+func (h *Handler) serveAbuseProtection(w http.ResponseWriter, r *http.Request) {
+	origins := r.Header.Values("WebHook-Request-Origin")
+
+	if len(origins) == 0 {
+		http.Error(w, "missing WebHook-Request-Origin header", http.StatusBadRequest)
+		return
+	}
+
+	for _, origin := range origins {
+		if h.isAllowedOrigin(origin) {
+			w.Header().Set("WebHook-Allowed-Origin", origin)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	http.Error(w, "origin is not allowed", http.StatusForbidden)
+}
+
+func (h *Handler) isAllowedOrigin(origin string) bool {
+	for _, allowed := range h.allowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *Handler) serveEvent(w http.ResponseWriter, r *http.Request) {
+	eventType := r.Header.Get("ce-type")
+
+	if eventType == "" {
+		http.Error(w, "missing ce-type header", http.StatusBadRequest)
+		return
+	}
+
+	connCtx, err := newConnectionContext(r.Header)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !strings.EqualFold(connCtx.Hub, h.hub) {
+		http.Error(w, fmt.Sprintf("unexpected hub %q", connCtx.Hub), http.StatusBadRequest)
+		return
+	}
+
+	if !h.isValidSignature(connCtx.ConnectionID, r.Header.Get("ce-signature")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.options.MaxRequestBodyBytes))
+
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case eventType == eventTypeConnect:
+		h.serveConnect(w, r, connCtx, body)
+	case eventType == eventTypeConnected:
+		if h.options.OnConnected != nil {
+			h.options.OnConnected(r.Context(), &ConnectedRequest{Context: connCtx})
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case eventType == eventTypeDisconnected:
+		req := &DisconnectedRequest{Context: connCtx}
+
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, req); err != nil {
+				http.Error(w, fmt.Sprintf("failed to decode disconnected event: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if h.options.OnDisconnected != nil {
+			h.options.OnDisconnected(r.Context(), req)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(eventType, eventTypeUserPrefix):
+		h.serveUserEvent(w, r, connCtx, body)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported event type %q", eventType), http.StatusBadRequest)
+	}
+}
+
+func (h *Handler) serveConnect(w http.ResponseWriter, r *http.Request, connCtx ConnectionContext, body []byte) {
+	req := &ConnectRequest{Context: connCtx}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode connect event: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if h.options.OnConnect == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp, err := h.options.OnConnect(r.Context(), req)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	respBody, err := json.Marshal(resp)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := setConnectionState(w.Header(), resp.States); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(respBody)
+}
+
+func (h *Handler) serveUserEvent(w http.ResponseWriter, r *http.Request, connCtx ConnectionContext, body []byte) {
+	req := &UserEventRequest{
+		Context:  connCtx,
+		DataType: dataTypeFromContentType(r.Header.Get("Content-Type")),
+		Data:     body,
+	}
+
+	if h.options.OnUserEvent == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp, err := h.options.OnUserEvent(r.Context(), req)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := setConnectionState(w.Header(), resp.States); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(resp.Data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	dataType := resp.DataType
+
+	if dataType == "" {
+		dataType = DataTypeText
+	}
+
+	w.Header().Set("Content-Type", dataType.contentType())
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resp.Data)
+}
+
+// isValidSignature checks the ce-signature header, which contains an HMAC-SHA256 of the connection ID for
+// each of the service's access keys. See https://learn.microsoft.com/azure/azure-web-pubsub/reference-cloud-events#signature
+func (h *Handler) isValidSignature(connectionID string, header string) bool {
+	if len(h.options.AccessKeys) == 0 {
+		// NewHandler only allows no keys when AllowUnauthenticated is true.
+		return h.options.AllowUnauthenticated
+	}
+
+	for _, signature := range strings.Split(header, ",") {
+		signature = strings.TrimSpace(signature)
+
+		for _, key := range h.options.AccessKeys {
+			if hmac.Equal([]byte(signature), []byte(computeSignature(key, connectionID))) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func computeSignature(key string, connectionID string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(connectionID))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newConnectionContext(header http.Header) (ConnectionContext, error) {
+	connCtx := ConnectionContext{
+		Hub:          header.Get("ce-hub"),
+		ConnectionID: header.Get("ce-connectionId"),
+		EventName:    header.Get("ce-eventName"),
+		UserID:       header.Get("ce-userId"),
+		Origin:       header.Get("WebHook-Request-Origin"),
+	}
+
+	if connCtx.Hub == "" || connCtx.ConnectionID == "" {
+		return ConnectionContext{}, errors.New("missing ce-hub or ce-connectionId header")
+	}
+
+	if state := header.Get(headerConnectionState); state != "" {
+		decoded, err := base64.StdEncoding.DecodeString(state)
+
+		if err != nil {
+			return ConnectionContext{}, fmt.Errorf("failed to decode %s header: %w", headerConnectionState, err)
+		}
+
+		if err := json.Unmarshal(decoded, &connCtx.States); err != nil {
+			return ConnectionContext{}, fmt.Errorf("failed to decode %s header: %w", headerConnectionState, err)
+		}
+	}
+
+	return connCtx, nil
+}
+
+func setConnectionState(header http.Header, states map[string]any) error {
+	if states == nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(states)
+
+	if err != nil {
+		return fmt.Errorf("failed to encode connection states: %w", err)
+	}
+
+	header.Set(headerConnectionState, base64.StdEncoding.EncodeToString(encoded))
+	return nil
+}
+
+func dataTypeFromContentType(contentType string) DataType {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return DataTypeBinary
+	}
+
+	switch mediaType {
+	case "application/json":
+		return DataTypeJSON
+	case "text/plain":
+		return DataTypeText
+	default:
+		return DataTypeBinary
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var handlerErr *Error
+
+	if errors.As(err, &handlerErr) {
+		http.Error(w, handlerErr.Message, handlerErr.statusCode())
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,310 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package eventhandler_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azwebpubsub/eventhandler"
+	"github.com/stretchr/testify/require"
+)
+
+const connectBody = `{
+	"claims": {"sub": ["user-1"], "role": ["webpubsub.joinLeaveGroup"]},
+	"query": {"access_token": ["token"], "room": ["lobby"]},
+	"headers": {"User-Agent": ["test"]},
+	"subprotocols": ["json.webpubsub.azure.v1", "custom"],
+	"clientCertificates": [{"thumbprint": "ABC", "content": "-----BEGIN CERTIFICATE-----"}]
+}`
+
+func TestHandler_AbuseProtection(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+			AllowedEndpoints:     []string{"https://resource.webpubsub.azure.com"},
+			AllowUnauthenticated: true,
+		})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodOptions, "/eventhandler", nil)
+		req.Header.Set("WebHook-Request-Origin", "resource.webpubsub.azure.com")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "resource.webpubsub.azure.com", resp.Header().Get("WebHook-Allowed-Origin"))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+			AllowedEndpoints:     []string{"https://resource.webpubsub.azure.com"},
+			AllowUnauthenticated: true,
+		})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodOptions, "/eventhandler", nil)
+		req.Header.Set("WebHook-Request-Origin", "other.webpubsub.azure.com")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusForbidden, resp.Code)
+		require.Empty(t, resp.Header().Get("WebHook-Allowed-Origin"))
+	})
+
+	t.Run("invalid endpoint", func(t *testing.T) {
+		_, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+			AllowedEndpoints:     []string{"resource.webpubsub.azure.com"},
+			AllowUnauthenticated: true,
+		})
+		require.EqualError(t, err, `allowed endpoint "resource.webpubsub.azure.com" is not a valid URL`)
+	})
+
+	t.Run("no allowed endpoints", func(t *testing.T) {
+		handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{AccessKeys: []string{"primary"}})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodOptions, "/eventhandler", nil)
+		req.Header.Set("WebHook-Request-Origin", "resource.webpubsub.azure.com")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusForbidden, resp.Code)
+		require.Empty(t, resp.Header().Get("WebHook-Allowed-Origin"))
+	})
+}
+
+func TestHandler_Connect(t *testing.T) {
+	var got *eventhandler.ConnectRequest
+
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AllowUnauthenticated: true,
+		OnConnect: func(ctx context.Context, req *eventhandler.ConnectRequest) (*eventhandler.ConnectResponse, error) {
+			got = req
+
+			return &eventhandler.ConnectResponse{
+				UserID:      "user-1",
+				Groups:      req.Query["room"],
+				Roles:       []string{"webpubsub.sendToGroup.lobby"},
+				Subprotocol: "json.webpubsub.azure.v1",
+				States:      map[string]any{"room": "lobby"},
+			}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	resp := serveEvent(handler, "azure.webpubsub.sys.connect", "connect", connectBody, nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	require.Equal(t, "chat", got.Context.Hub)
+	require.Equal(t, "conn-1", got.Context.ConnectionID)
+	require.Equal(t, "connect", got.Context.EventName)
+	require.Equal(t, []string{"user-1"}, got.Claims["sub"])
+	require.Equal(t, []string{"json.webpubsub.azure.v1", "custom"}, got.Subprotocols)
+	require.Equal(t, "ABC", got.ClientCertificates[0].Thumbprint)
+
+	require.JSONEq(t, `{
+		"userId": "user-1",
+		"groups": ["lobby"],
+		"roles": ["webpubsub.sendToGroup.lobby"],
+		"subprotocol": "json.webpubsub.azure.v1"
+	}`, resp.Body.String())
+
+	require.Equal(t, map[string]string{"room": "lobby"}, decodeStates(t, resp.Header().Get("ce-connectionState")))
+}
+
+func TestHandler_ConnectRejected(t *testing.T) {
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AllowUnauthenticated: true,
+		OnConnect: func(ctx context.Context, req *eventhandler.ConnectRequest) (*eventhandler.ConnectResponse, error) {
+			if req.Claims["sub"] == nil {
+				return nil, &eventhandler.Error{Code: eventhandler.ErrorCodeUnauthorized, Message: "anonymous users are not allowed"}
+			}
+
+			return nil, errors.New("database is unavailable")
+		},
+	})
+	require.NoError(t, err)
+
+	resp := serveEvent(handler, "azure.webpubsub.sys.connect", "connect", `{}`, nil)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+	require.Equal(t, "anonymous users are not allowed\n", resp.Body.String())
+
+	resp = serveEvent(handler, "azure.webpubsub.sys.connect", "connect", connectBody, nil)
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.Equal(t, "database is unavailable\n", resp.Body.String())
+}
+
+func TestHandler_UserEvent(t *testing.T) {
+	var got *eventhandler.UserEventRequest
+
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AllowUnauthenticated: true,
+		OnUserEvent: func(ctx context.Context, req *eventhandler.UserEventRequest) (*eventhandler.UserEventResponse, error) {
+			got = req
+
+			return &eventhandler.UserEventResponse{
+				DataType: eventhandler.DataTypeJSON,
+				Data:     []byte(`{"echo":true}`),
+				States:   map[string]any{"count": 2},
+			}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	states := base64.StdEncoding.EncodeToString([]byte(`{"count":1}`))
+
+	resp := serveEvent(handler, "azure.webpubsub.user.message", "message", "hello", http.Header{
+		"Content-Type":       []string{"text/plain; charset=utf-8"},
+		"Ce-Connectionstate": []string{states},
+		"Ce-Userid":          []string{"user-1"},
+	})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	require.Equal(t, `{"echo":true}`, resp.Body.String())
+
+	require.Equal(t, "message", got.Context.EventName)
+	require.Equal(t, "user-1", got.Context.UserID)
+	require.Equal(t, eventhandler.DataTypeText, got.DataType)
+	require.Equal(t, []byte("hello"), got.Data)
+	require.JSONEq(t, "1", string(got.Context.States["count"]))
+
+	var newStates map[string]int
+	decoded, err := base64.StdEncoding.DecodeString(resp.Header().Get("ce-connectionState"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(decoded, &newStates))
+	require.Equal(t, map[string]int{"count": 2}, newStates)
+}
+
+func TestHandler_ConnectedAndDisconnected(t *testing.T) {
+	var connected *eventhandler.ConnectedRequest
+	var disconnected *eventhandler.DisconnectedRequest
+
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AllowUnauthenticated: true,
+		OnConnected: func(ctx context.Context, req *eventhandler.ConnectedRequest) {
+			connected = req
+		},
+		OnDisconnected: func(ctx context.Context, req *eventhandler.DisconnectedRequest) {
+			disconnected = req
+		},
+	})
+	require.NoError(t, err)
+
+	resp := serveEvent(handler, "azure.webpubsub.sys.connected", "connected", `{}`, nil)
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	require.Equal(t, "conn-1", connected.Context.ConnectionID)
+
+	resp = serveEvent(handler, "azure.webpubsub.sys.disconnected", "disconnected", `{"reason":"client closed"}`, nil)
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	require.Equal(t, "client closed", disconnected.Reason)
+}
+
+func TestHandler_Signature(t *testing.T) {
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AccessKeys: []string{"primary", "secondary"},
+	})
+	require.NoError(t, err)
+
+	resp := serveEvent(handler, "azure.webpubsub.sys.connected", "connected", `{}`, http.Header{
+		"Ce-Signature": []string{"sha256=0000," + sign("secondary", "conn-1")},
+	})
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = serveEvent(handler, "azure.webpubsub.sys.connected", "connected", `{}`, http.Header{
+		"Ce-Signature": []string{sign("other", "conn-1")},
+	})
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = serveEvent(handler, "azure.webpubsub.sys.connected", "connected", `{}`, nil)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestHandler_InvalidRequests(t *testing.T) {
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{AllowUnauthenticated: true})
+	require.NoError(t, err)
+
+	resp := serveEvent(handler, "azure.webpubsub.sys.connected", "connected", `{}`, http.Header{"Ce-Hub": []string{"other"}})
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), `unexpected hub "other"`)
+
+	resp = serveEvent(handler, "azure.webpubsub.mqtt.connect", "connect", `{}`, nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = serveEvent(handler, "azure.webpubsub.sys.connect", "connect", `not json`, nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/eventhandler", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	_, err = eventhandler.NewHandler("", nil)
+	require.EqualError(t, err, "empty hub name is not allowed")
+}
+
+func TestHandler_RequiresAccessKeys(t *testing.T) {
+	_, err := eventhandler.NewHandler("chat", nil)
+	require.EqualError(t, err, "at least one access key is required, or AllowUnauthenticated must be true")
+
+	_, err = eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{AccessKeys: []string{""}})
+	require.EqualError(t, err, "empty access key is not allowed")
+
+	// the signature is still validated when there are keys, even if AllowUnauthenticated is true
+	handler, err := eventhandler.NewHandler("chat", &eventhandler.HandlerOptions{
+		AccessKeys:           []string{"primary"},
+		AllowUnauthenticated: true,
+	})
+	require.NoError(t, err)
+
+	resp := serveEvent(handler, "azure.webpubsub.sys.connected", "connected", `{}`, nil)
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func serveEvent(handler http.Handler, eventType string, eventName string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/eventhandler", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-type", eventType)
+	req.Header.Set("ce-source", "/hubs/chat/client/conn-1")
+	req.Header.Set("ce-id", "1")
+	req.Header.Set("ce-hub", "chat")
+	req.Header.Set("ce-connectionId", "conn-1")
+	req.Header.Set("ce-eventName", eventName)
+	req.Header.Set("WebHook-Request-Origin", "resource.webpubsub.azure.com")
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func sign(key string, connectionID string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(connectionID))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func decodeStates(t *testing.T, header string) map[string]string {
+	decoded, err := base64.StdEncoding.DecodeString(header)
+	require.NoError(t, err)
+
+	var states map[string]string
+	require.NoError(t, json.Unmarshal(decoded, &states))
+	return states
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package eventhandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ConnectionContext describes the connection that an event is for.
+type ConnectionContext struct {
+	// Hub is the hub the connection belongs to.
+	Hub string
+
+	// ConnectionID is the ID of the connection.
+	ConnectionID string
+
+	// EventName is the name of the event, ex: "connect", or the name of a user event.
+	EventName string
+
+	// UserID is the user ID of the connection, if it has one.
+	UserID string
+
+	// Origin is the host name of the Web PubSub service that sent the event.
+	Origin string
+
+	// States are the connection's states, as set by previous [ConnectResponse.States] or [UserEventResponse.States].
+	States map[string]json.RawMessage
+}
+
+// ClientCertificate is a certificate a client presented when connecting.
+type ClientCertificate struct {
+	// Thumbprint is the certificate's thumbprint.
+	Thumbprint string `json:"thumbprint"`
+
+	// Content is the certificate, PEM encoded.
+	Content string `json:"content"`
+}
+
+// ConnectRequest is the request for a connect event, which is sent before a client's connection is established.
+type ConnectRequest struct {
+	// Context is the connection the event is for.
+	Context ConnectionContext `json:"-"`
+
+	// Claims are the claims from the client's access token.
+	Claims map[string][]string `json:"claims"`
+
+	// Query is the query string the client connected with.
+	Query map[string][]string `json:"query"`
+
+	// Headers are the HTTP headers the client connected with.
+	Headers map[string][]string `json:"headers"`
+
+	// Subprotocols are the WebSocket subprotocols the client requested.
+	Subprotocols []string `json:"subprotocols"`
+
+	// ClientCertificates are the certificates the client presented.
+	ClientCertificates []ClientCertificate `json:"clientCertificates"`
+}
+
+// ConnectResponse is the response to a connect event, returned from [HandlerOptions.OnConnect].
+type ConnectResponse struct {
+	// UserID sets the user ID of the connection. If empty, the user ID from the client's access token is used.
+	UserID string `json:"userId,omitempty"`
+
+	// Groups are the groups the connection joins.
+	Groups []string `json:"groups,omitempty"`
+
+	// Roles are the roles the connection has, ex: "webpubsub.joinLeaveGroup".
+	Roles []string `json:"roles,omitempty"`
+
+	// Subprotocol is the subprotocol, chosen from [ConnectRequest.Subprotocols], for the connection.
+	Subprotocol string `json:"subprotocol,omitempty"`
+
+	// States, if not nil, replaces the connection's states. Each value is encoded as JSON.
+	States map[string]any `json:"-"`
+}
+
+// ConnectedRequest is the request for a connected event, which is sent after a client's connection is established.
+type ConnectedRequest struct {
+	// Context is the connection the event is for.
+	Context ConnectionContext
+}
+
+// DisconnectedRequest is the request for a disconnected event, which is sent after a client's connection is closed.
+type DisconnectedRequest struct {
+	// Context is the connection the event is for.
+	Context ConnectionContext `json:"-"`
+
+	// Reason is the reason the connection was closed, if there was an error.
+	Reason string `json:"reason"`
+}
+
+// DataType is the type of the data in a user event.
+type DataType string
+
+const (
+	// DataTypeBinary - binary data, with the content type "application/octet-stream".
+	DataTypeBinary DataType = "binary"
+
+	// DataTypeJSON - JSON data, with the content type "application/json".
+	DataTypeJSON DataType = "json"
+
+	// DataTypeText - UTF-8 text, with the content type "text/plain".
+	DataTypeText DataType = "text"
+)
+
+func (dt DataType) contentType() string {
+	switch dt {
+	case DataTypeJSON:
+		return "application/json"
+	case DataTypeText:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// UserEventRequest is the request for a user event, which is sent when a client sends an event or message.
+type UserEventRequest struct {
+	// Context is the connection the event is for.
+	Context ConnectionContext
+
+	// DataType is the type of Data.
+	DataType DataType
+
+	// Data is the data the client sent.
+	Data []byte
+}
+
+// UserEventResponse is the response to a user event, returned from [HandlerOptions.OnUserEvent].
+// The data is sent back to the client.
+type UserEventResponse struct {
+	// DataType is the type of Data.
+	//
+	// Defaults to [DataTypeText].
+	DataType DataType
+
+	// Data is the data to send to the client. If empty, nothing is sent.
+	Data []byte
+
+	// States, if not nil, replaces the connection's states. Each value is encoded as JSON.
+	States map[string]any
+}
+
+// ErrorCode is the kind of failure an [Error] represents.
+type ErrorCode string
+
+const (
+	// ErrorCodeUnauthorized rejects the request because the client isn't allowed to connect, or send the event.
+	ErrorCodeUnauthorized ErrorCode = "Unauthorized"
+
+	// ErrorCodeUserError rejects the request because it's invalid.
+	ErrorCodeUserError ErrorCode = "UserError"
+
+	// ErrorCodeServerError means the request failed because of an error in the event handler.
+	ErrorCodeServerError ErrorCode = "ServerError"
+)
+
+// Error can be returned from [HandlerOptions.OnConnect] or [HandlerOptions.OnUserEvent] to control the
+// status code sent to the Web PubSub service. Other errors are treated as an [ErrorCodeServerError].
+type Error struct {
+	// Code is the kind of failure.
+	Code ErrorCode
+
+	// Message is returned to the Web PubSub service, and the client.
+	Message string
+}
+
+// Error implements the error interface for type Error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) statusCode() int {
+	switch e.Code {
+	case ErrorCodeUnauthorized:
+		return http.StatusUnauthorized
+	case ErrorCodeUserError:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
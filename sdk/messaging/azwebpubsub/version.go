@@ -6,5 +6,5 @@ package azwebpubsub
 
 const (
 	moduleName    = "github.com/Azure/azure-sdk-for-go/sdk/messaging/azwebpubsub"
-	moduleVersion = "v0.1.2"
+	moduleVersion = "v0.2.0"
 )
@@ -0,0 +1,836 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+// Package webpubsubclient contains a client for the Web PubSub service's JSON WebSocket subprotocols,
+// so a Go program can connect to a hub as a Web PubSub client.
+//
+// The [Client] joins and leaves groups, sends messages to groups and events to the server, and waits
+// for the service to acknowledge them. If the connection drops it recovers it, when using
+// [ProtocolJSONReliable], or reconnects and rejoins its groups.
+// See https://learn.microsoft.com/azure/azure-web-pubsub/reference-json-webpubsub-subprotocol
+package webpubsubclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	// maxMessageBytes is larger than the service's 1MiB message limit, to allow for base64 encoding of binary data.
+	maxMessageBytes = 4 * 1024 * 1024
+
+	recoveryTimeout     = 30 * time.Second
+	recoveryInterval    = time.Second
+	sequenceAckInterval = time.Second
+
+	// writeTimeout bounds writes, instead of the caller's context, since a cancelled write closes the connection.
+	writeTimeout = 30 * time.Second
+)
+
+// Client is a Web PubSub client, connected over a WebSocket.
+// Don't use this type directly, use [NewClient] instead.
+type Client struct {
+	getClientAccessURL ClientAccessURLFunc
+	options            ClientOptions
+	nextAckID          atomic.Uint64
+
+	mu                  sync.Mutex
+	running             bool
+	stopping            bool
+	cancelRun           context.CancelFunc
+	runDone             chan struct{}
+	events              *dispatcher
+	conn                *websocket.Conn
+	accessURL           string
+	connectionID        string
+	reconnectionToken   string
+	disconnectedMessage string
+	pending             map[uint64]chan ackOutcome
+	groups              map[string]bool
+	sequenceID          *uint64
+	sequenceIDChanged   bool
+}
+
+type ackOutcome struct {
+	duplicated bool
+	err        error
+}
+
+// NewClient creates a Client. Call [Client.Start] to connect.
+//   - getClientAccessURL - returns the URL, with an access token, to connect to.
+//   - options - optional settings for the client. Can be nil.
+func NewClient(getClientAccessURL ClientAccessURLFunc, options *ClientOptions) (*Client, error) {
+	if getClientAccessURL == nil {
+		return nil, errors.New("getClientAccessURL must not be nil")
+	}
+
+	if options == nil {
+		options = &ClientOptions{}
+	}
+
+	c := &Client{
+		getClientAccessURL: getClientAccessURL,
+		options:            *options,
+		pending:            map[uint64]chan ackOutcome{},
+		groups:             map[string]bool{},
+	}
+
+	switch c.options.Protocol {
+	case "":
+		c.options.Protocol = ProtocolJSON
+	case ProtocolJSON, ProtocolJSONReliable:
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", c.options.Protocol)
+	}
+
+	retry := &c.options.ReconnectRetryOptions
+
+	if retry.MaxRetries == 0 {
+		retry.MaxRetries = 5
+	}
+
+	if retry.RetryDelay <= 0 {
+		retry.RetryDelay = time.Second
+	}
+
+	if retry.MaxRetryDelay <= 0 {
+		retry.MaxRetryDelay = 30 * time.Second
+	}
+
+	return c, nil
+}
+
+// Start connects to the service, and returns once the connection is established.
+// A Client that has been stopped can be started again.
+func (c *Client) Start(ctx context.Context) error {
+	c.mu.Lock()
+
+	if c.running {
+		c.mu.Unlock()
+		return errors.New("the client has already been started")
+	}
+
+	runCtx, cancelRun := context.WithCancel(context.Background())
+
+	c.running = true
+	c.cancelRun = cancelRun
+	c.runDone = make(chan struct{})
+	c.events = newDispatcher()
+	events := c.events
+	runDone := c.runDone
+	c.mu.Unlock()
+
+	// Stop cancels connecting, as well as the caller.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopCancel := context.AfterFunc(runCtx, cancel)
+	defer stopCancel()
+
+	conn, err := c.connect(ctx, events)
+
+	if err != nil {
+		cancelRun()
+		events.close()
+
+		c.mu.Lock()
+		c.running = false
+		c.stopping = false
+		c.mu.Unlock()
+
+		close(runDone)
+		return err
+	}
+
+	go c.run(runCtx, conn, events)
+	return nil
+}
+
+// Stop closes the connection, and stops the client from reconnecting. Messages that are waiting to be
+// acknowledged fail with [ErrDisconnected].
+func (c *Client) Stop(ctx context.Context) error {
+	c.mu.Lock()
+
+	if !c.running {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.stopping = true
+	conn := c.conn
+	cancelRun := c.cancelRun
+	runDone := c.runDone
+	c.mu.Unlock()
+
+	go func() {
+		if conn != nil {
+			_ = conn.Close(websocket.StatusNormalClosure, "")
+		}
+
+		cancelRun()
+	}()
+
+	select {
+	case <-runDone:
+		return nil
+	case <-ctx.Done():
+		cancelRun()
+		return ctx.Err()
+	}
+}
+
+// ConnectionID returns the ID of the current connection, or an empty string if the client isn't connected.
+func (c *Client) ConnectionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return ""
+	}
+
+	return c.connectionID
+}
+
+// JoinGroup joins the connection to group, and waits for the service to acknowledge it.
+// Groups joined with JoinGroup are rejoined after the client reconnects.
+func (c *Client) JoinGroup(ctx context.Context, group string, options *JoinGroupOptions) (JoinGroupResponse, error) {
+	if group == "" {
+		return JoinGroupResponse{}, errors.New("empty group name is not allowed")
+	}
+
+	if options == nil {
+		options = &JoinGroupOptions{}
+	}
+
+	result, err := c.send(ctx, &outgoingMessage{Type: messageTypeJoinGroup, Group: group}, true, options.AckID)
+
+	if err != nil {
+		return JoinGroupResponse{}, err
+	}
+
+	c.mu.Lock()
+	c.groups[group] = true
+	c.mu.Unlock()
+
+	return JoinGroupResponse{AckResult: result}, nil
+}
+
+// LeaveGroup removes the connection from group, and waits for the service to acknowledge it.
+func (c *Client) LeaveGroup(ctx context.Context, group string, options *LeaveGroupOptions) (LeaveGroupResponse, error) {
+	if group == "" {
+		return LeaveGroupResponse{}, errors.New("empty group name is not allowed")
+	}
+
+	if options == nil {
+		options = &LeaveGroupOptions{}
+	}
+
+	result, err := c.send(ctx, &outgoingMessage{Type: messageTypeLeaveGroup, Group: group}, true, options.AckID)
+
+	if err != nil {
+		return LeaveGroupResponse{}, err
+	}
+
+	c.mu.Lock()
+	delete(c.groups, group)
+	c.mu.Unlock()
+
+	return LeaveGroupResponse{AckResult: result}, nil
+}
+
+// SendToGroup sends data to group, and waits for the service to acknowledge it, unless
+// [SendToGroupOptions.FireAndForget] is set.
+func (c *Client) SendToGroup(ctx context.Context, group string, dataType DataType, data []byte, options *SendToGroupOptions) (SendToGroupResponse, error) {
+	if group == "" {
+		return SendToGroupResponse{}, errors.New("empty group name is not allowed")
+	}
+
+	if options == nil {
+		options = &SendToGroupOptions{}
+	}
+
+	encoded, err := encodeData(dataType, data)
+
+	if err != nil {
+		return SendToGroupResponse{}, err
+	}
+
+	result, err := c.send(ctx, &outgoingMessage{
+		Type:     messageTypeSendToGroup,
+		Group:    group,
+		NoEcho:   options.NoEcho,
+		DataType: dataType,
+		Data:     encoded,
+	}, !options.FireAndForget, options.AckID)
+
+	if err != nil {
+		return SendToGroupResponse{}, err
+	}
+
+	return SendToGroupResponse{AckResult: result}, nil
+}
+
+// SendEvent sends an event, named eventName, to the server's event handler, and waits for the service
+// to acknowledge it, unless [SendEventOptions.FireAndForget] is set.
+func (c *Client) SendEvent(ctx context.Context, eventName string, dataType DataType, data []byte, options *SendEventOptions) (SendEventResponse, error) {
+	if eventName == "" {
+		return SendEventResponse{}, errors.New("empty event name is not allowed")
+	}
+
+	if options == nil {
+		options = &SendEventOptions{}
+	}
+
+	encoded, err := encodeData(dataType, data)
+
+	if err != nil {
+		return SendEventResponse{}, err
+	}
+
+	result, err := c.send(ctx, &outgoingMessage{
+		Type:     messageTypeEvent,
+		Event:    eventName,
+		DataType: dataType,
+		Data:     encoded,
+	}, !options.FireAndForget, options.AckID)
+
+	if err != nil {
+		return SendEventResponse{}, err
+	}
+
+	return SendEventResponse{AckResult: result}, nil
+}
+
+func (c *Client) send(ctx context.Context, msg *outgoingMessage, waitForAck bool, ackID *uint64) (AckResult, error) {
+	var ackCh chan ackOutcome
+	var id uint64
+
+	if waitForAck {
+		if ackID != nil {
+			id = *ackID
+		} else {
+			id = c.nextAckID.Add(1)
+		}
+
+		msg.AckID = &id
+		ackCh = make(chan ackOutcome, 1)
+
+		c.mu.Lock()
+
+		if _, exists := c.pending[id]; exists {
+			c.mu.Unlock()
+			return AckResult{}, fmt.Errorf("ack ID %d is already in use", id)
+		}
+
+		c.pending[id] = ackCh
+		c.mu.Unlock()
+	}
+
+	data, err := json.Marshal(msg)
+
+	if err != nil {
+		c.removePending(id, ackCh)
+		return AckResult{}, err
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		c.removePending(id, ackCh)
+		return AckResult{}, ErrDisconnected
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	if err := conn.Write(writeCtx, websocket.MessageText, data); err != nil {
+		c.removePending(id, ackCh)
+		return AckResult{}, fmt.Errorf("%w: %w", ErrDisconnected, err)
+	}
+
+	if !waitForAck {
+		return AckResult{}, nil
+	}
+
+	select {
+	case outcome := <-ackCh:
+		if outcome.err != nil {
+			return AckResult{}, outcome.err
+		}
+
+		return AckResult{AckID: id, IsDuplicated: outcome.duplicated}, nil
+	case <-ctx.Done():
+		c.removePending(id, ackCh)
+		return AckResult{}, ctx.Err()
+	}
+}
+
+func (c *Client) removePending(id uint64, ackCh chan ackOutcome) {
+	if ackCh == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending[id] == ackCh {
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) failPending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, ackCh := range c.pending {
+		ackCh <- ackOutcome{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// run owns the connection, after Start returns. It reads messages, and recovers or reconnects when the
+// connection drops, until the client is stopped.
+func (c *Client) run(ctx context.Context, conn *websocket.Conn, events *dispatcher) {
+	if c.options.Protocol == ProtocolJSONReliable {
+		go c.sendSequenceAcks(ctx)
+	}
+
+	for conn != nil {
+		c.readMessages(ctx, conn, events)
+
+		c.mu.Lock()
+		c.conn = nil
+		stopping := c.stopping
+		disconnected := DisconnectedEvent{ConnectionID: c.connectionID, Message: c.disconnectedMessage}
+		c.disconnectedMessage = ""
+		c.mu.Unlock()
+
+		if stopping || ctx.Err() != nil {
+			break
+		}
+
+		if c.options.Protocol == ProtocolJSONReliable {
+			if conn = c.recover(ctx); conn != nil {
+				continue
+			}
+		}
+
+		c.failPending(ErrDisconnected)
+
+		if c.options.OnDisconnected != nil {
+			events.push(func() { c.options.OnDisconnected(disconnected) })
+		}
+
+		if c.options.DisableAutoReconnect {
+			break
+		}
+
+		if conn = c.reconnect(ctx, events); conn != nil && !c.options.DisableAutoRejoinGroups {
+			go c.rejoinGroups(ctx, events)
+		}
+	}
+
+	c.cancelRun()
+	c.failPending(ErrDisconnected)
+
+	if c.options.OnStopped != nil {
+		events.push(c.options.OnStopped)
+	}
+
+	events.close()
+
+	c.mu.Lock()
+	c.running = false
+	c.stopping = false
+	c.connectionID = ""
+	c.reconnectionToken = ""
+	runDone := c.runDone
+	c.mu.Unlock()
+
+	close(runDone)
+}
+
+// connect opens a new connection, and waits for the service to send the connected message.
+func (c *Client) connect(ctx context.Context, events *dispatcher) (*websocket.Conn, error) {
+	accessURL, err := c.getClientAccessURL(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the client access URL: %w", err)
+	}
+
+	conn, err := c.dial(ctx, accessURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.accessURL = accessURL
+	c.sequenceID = nil
+	c.sequenceIDChanged = false
+	c.mu.Unlock()
+
+	for {
+		_, data, err := conn.Read(ctx)
+
+		if err != nil {
+			_ = conn.CloseNow()
+			return nil, fmt.Errorf("failed to connect: %w", err)
+		}
+
+		var msg incomingMessage
+
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		if msg.Type == messageTypeSystem && msg.Event == systemEventDisconnected {
+			_ = conn.CloseNow()
+			return nil, fmt.Errorf("the service closed the connection: %s", msg.Message)
+		}
+
+		c.handleMessage(&msg, events)
+
+		if msg.Type == messageTypeSystem && msg.Event == systemEventConnected {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = conn
+	return conn, nil
+}
+
+func (c *Client) dial(ctx context.Context, accessURL string) (*websocket.Conn, error) {
+	conn, _, err := websocket.Dial(ctx, accessURL, &websocket.DialOptions{
+		HTTPClient:   c.options.HTTPClient,
+		Subprotocols: []string{string(c.options.Protocol)},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if conn.Subprotocol() != string(c.options.Protocol) {
+		_ = conn.Close(websocket.StatusProtocolError, "unsupported subprotocol")
+		return nil, fmt.Errorf("the service doesn't support the %s subprotocol", c.options.Protocol)
+	}
+
+	conn.SetReadLimit(maxMessageBytes)
+	return conn, nil
+}
+
+// recover reopens the connection, using its reconnection token, so no messages are lost.
+// It returns nil if the connection can't be recovered.
+func (c *Client) recover(ctx context.Context) *websocket.Conn {
+	c.mu.Lock()
+	connectionID, reconnectionToken, accessURL := c.connectionID, c.reconnectionToken, c.accessURL
+	c.mu.Unlock()
+
+	if connectionID == "" || reconnectionToken == "" {
+		return nil
+	}
+
+	recoveryURL, err := url.Parse(accessURL)
+
+	if err != nil {
+		return nil
+	}
+
+	query := recoveryURL.Query()
+	query.Set("awps_connection_id", connectionID)
+	query.Set("awps_reconnection_token", reconnectionToken)
+	recoveryURL.RawQuery = query.Encode()
+
+	deadline := time.Now().Add(recoveryTimeout)
+
+	for time.Now().Before(deadline) {
+		conn, err := c.dial(ctx, recoveryURL.String())
+
+		if err == nil {
+			c.mu.Lock()
+			c.conn = conn
+			c.mu.Unlock()
+
+			return conn
+		}
+
+		select {
+		case <-time.After(recoveryInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// reconnect opens a new connection, retrying according to ReconnectRetryOptions. It returns nil if
+// the client is stopped, or all the retries fail.
+func (c *Client) reconnect(ctx context.Context, events *dispatcher) *websocket.Conn {
+	retry := c.options.ReconnectRetryOptions
+
+	for try := int32(0); ; try++ {
+		if try > 0 {
+			select {
+			case <-time.After(calcRetryDelay(retry, try)):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		conn, err := c.connect(ctx, events)
+
+		if err == nil {
+			return conn
+		}
+
+		if ctx.Err() != nil || retry.MaxRetries < 0 || try >= retry.MaxRetries {
+			return nil
+		}
+	}
+}
+
+func (c *Client) rejoinGroups(ctx context.Context, events *dispatcher) {
+	c.mu.Lock()
+	groups := make([]string, 0, len(c.groups))
+
+	for group := range c.groups {
+		groups = append(groups, group)
+	}
+
+	c.mu.Unlock()
+
+	for _, group := range groups {
+		if _, err := c.JoinGroup(ctx, group, nil); err != nil && c.options.OnRejoinGroupFailed != nil {
+			events.push(func() { c.options.OnRejoinGroupFailed(group, err) })
+		}
+	}
+}
+
+func (c *Client) readMessages(ctx context.Context, conn *websocket.Conn, events *dispatcher) {
+	for {
+		_, data, err := conn.Read(ctx)
+
+		if err != nil {
+			return
+		}
+
+		var msg incomingMessage
+
+		// messages we can't decode are ignored, like message types from newer versions of the protocol.
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		c.handleMessage(&msg, events)
+	}
+}
+
+func (c *Client) handleMessage(msg *incomingMessage, events *dispatcher) {
+	switch msg.Type {
+	case messageTypeSystem:
+		switch msg.Event {
+		case systemEventConnected:
+			c.mu.Lock()
+			c.connectionID = msg.ConnectionID
+			c.reconnectionToken = msg.ReconnectionToken
+			c.mu.Unlock()
+
+			if c.options.OnConnected != nil {
+				event := ConnectedEvent{ConnectionID: msg.ConnectionID, UserID: msg.UserID}
+				events.push(func() { c.options.OnConnected(event) })
+			}
+		case systemEventDisconnected:
+			c.mu.Lock()
+			c.disconnectedMessage = msg.Message
+			c.mu.Unlock()
+		}
+	case messageTypeMessage:
+		if msg.SequenceID != nil && !c.updateSequenceID(*msg.SequenceID) {
+			// a message that was redelivered after the connection was recovered.
+			return
+		}
+
+		data, err := decodeData(msg.DataType, msg.Data)
+
+		if err != nil {
+			return
+		}
+
+		switch msg.From {
+		case messageFromGroup:
+			if c.options.OnGroupMessage != nil {
+				message := GroupMessage{Group: msg.Group, FromUserID: msg.FromUserID, DataType: msg.DataType, Data: data, SequenceID: msg.SequenceID}
+				events.push(func() { c.options.OnGroupMessage(message) })
+			}
+		case messageFromServer:
+			if c.options.OnServerMessage != nil {
+				message := ServerMessage{DataType: msg.DataType, Data: data, SequenceID: msg.SequenceID}
+				events.push(func() { c.options.OnServerMessage(message) })
+			}
+		}
+	case messageTypeAck:
+		if msg.AckID == nil {
+			return
+		}
+
+		var outcome ackOutcome
+
+		if !msg.Success {
+			if msg.Error != nil && msg.Error.Name == ackErrorDuplicate {
+				outcome.duplicated = true
+			} else {
+				ackErr := &AckError{AckID: *msg.AckID}
+
+				if msg.Error != nil {
+					ackErr.Name, ackErr.Message = msg.Error.Name, msg.Error.Message
+				}
+
+				outcome.err = ackErr
+			}
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if ackCh, ok := c.pending[*msg.AckID]; ok {
+			ackCh <- outcome
+			delete(c.pending, *msg.AckID)
+		}
+	}
+}
+
+// updateSequenceID records the sequence ID of a received message. It returns false if the message has already been received.
+func (c *Client) updateSequenceID(sequenceID uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// duplicates are acknowledged as well, so the service stops redelivering them.
+	c.sequenceIDChanged = true
+
+	if c.sequenceID != nil && sequenceID <= *c.sequenceID {
+		return false
+	}
+
+	c.sequenceID = &sequenceID
+	return true
+}
+
+// sendSequenceAcks periodically tells the service the latest sequence ID that was received, so it
+// doesn't redeliver those messages when the connection is recovered.
+func (c *Client) sendSequenceAcks(ctx context.Context) {
+	ticker := time.NewTicker(sequenceAckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		conn := c.conn
+
+		if conn == nil || !c.sequenceIDChanged || c.sequenceID == nil {
+			c.mu.Unlock()
+			continue
+		}
+
+		sequenceID := *c.sequenceID
+		c.sequenceIDChanged = false
+		c.mu.Unlock()
+
+		data, err := json.Marshal(&outgoingMessage{Type: messageTypeSequenceAck, SequenceID: &sequenceID})
+
+		if err != nil {
+			continue
+		}
+
+		writeCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+
+		if err := conn.Write(writeCtx, websocket.MessageText, data); err != nil {
+			c.mu.Lock()
+			c.sequenceIDChanged = true
+			c.mu.Unlock()
+		}
+
+		cancel()
+	}
+}
+
+func calcRetryDelay(retry RetryOptions, try int32) time.Duration {
+	delay := retry.RetryDelay << min(try-1, 16)
+	return min(delay, retry.MaxRetryDelay)
+}
+
+// dispatcher calls the ClientOptions callbacks in order, from its own goroutine, so callbacks can
+// call Client methods that wait for acknowledgements without blocking the connection.
+type dispatcher struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []func()
+	closed bool
+}
+
+func newDispatcher() *dispatcher {
+	d := &dispatcher{}
+	d.cond = sync.NewCond(&d.mu)
+
+	go d.run()
+	return d
+}
+
+func (d *dispatcher) push(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	d.queue = append(d.queue, fn)
+	d.cond.Signal()
+}
+
+// close stops the dispatcher, after the callbacks that have already been pushed are called.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	d.cond.Signal()
+}
+
+func (d *dispatcher) run() {
+	for {
+		d.mu.Lock()
+
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+
+		if len(d.queue) == 0 {
+			d.mu.Unlock()
+			return
+		}
+
+		fn := d.queue[0]
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+
+		fn()
+	}
+}
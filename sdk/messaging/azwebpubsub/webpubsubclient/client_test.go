@@ -0,0 +1,504 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package webpubsubclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azwebpubsub/webpubsubclient"
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GroupMessages(t *testing.T) {
+	service := newFakeService(t)
+
+	messages := make(chan webpubsubclient.GroupMessage, 10)
+	connected := make(chan webpubsubclient.ConnectedEvent, 1)
+
+	client, err := webpubsubclient.NewClient(service.URL, &webpubsubclient.ClientOptions{
+		OnConnected:    func(event webpubsubclient.ConnectedEvent) { connected <- event },
+		OnGroupMessage: func(message webpubsubclient.GroupMessage) { messages <- message },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	defer func() { require.NoError(t, client.Stop(context.Background())) }()
+
+	event := <-connected
+	require.Equal(t, "conn-1", event.ConnectionID)
+	require.Equal(t, "user-1", event.UserID)
+	require.Equal(t, "conn-1", client.ConnectionID())
+
+	joinResp, err := client.JoinGroup(context.Background(), "lobby", nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), joinResp.AckID)
+
+	_, err = client.SendToGroup(context.Background(), "lobby", webpubsubclient.DataTypeText, []byte("hello"), nil)
+	require.NoError(t, err)
+
+	_, err = client.SendToGroup(context.Background(), "lobby", webpubsubclient.DataTypeBinary, []byte{0, 1, 2}, &webpubsubclient.SendToGroupOptions{FireAndForget: true})
+	require.NoError(t, err)
+
+	_, err = client.SendToGroup(context.Background(), "lobby", webpubsubclient.DataTypeText, []byte("not echoed"), &webpubsubclient.SendToGroupOptions{NoEcho: true})
+	require.NoError(t, err)
+
+	_, err = client.SendToGroup(context.Background(), "lobby", webpubsubclient.DataTypeJSON, []byte(`{"n":1}`), nil)
+	require.NoError(t, err)
+
+	msg := <-messages
+	require.Equal(t, "lobby", msg.Group)
+	require.Equal(t, "user-1", msg.FromUserID)
+	require.Equal(t, webpubsubclient.DataTypeText, msg.DataType)
+	require.Equal(t, []byte("hello"), msg.Data)
+
+	msg = <-messages
+	require.Equal(t, webpubsubclient.DataTypeBinary, msg.DataType)
+	require.Equal(t, []byte{0, 1, 2}, msg.Data)
+
+	msg = <-messages
+	require.Equal(t, webpubsubclient.DataTypeJSON, msg.DataType)
+	require.JSONEq(t, `{"n":1}`, string(msg.Data))
+
+	_, err = client.LeaveGroup(context.Background(), "lobby", nil)
+	require.NoError(t, err)
+	require.Empty(t, service.GroupMembers("lobby"))
+}
+
+func TestClient_SendEvent(t *testing.T) {
+	service := newFakeService(t)
+	messages := make(chan webpubsubclient.ServerMessage, 1)
+
+	client, err := webpubsubclient.NewClient(service.URL, &webpubsubclient.ClientOptions{
+		OnServerMessage: func(message webpubsubclient.ServerMessage) { messages <- message },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	defer func() { require.NoError(t, client.Stop(context.Background())) }()
+
+	resp, err := client.SendEvent(context.Background(), "echo", webpubsubclient.DataTypeJSON, []byte(`{"hello":"world"}`), &webpubsubclient.SendEventOptions{AckID: to(uint64(100))})
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), resp.AckID)
+	require.False(t, resp.IsDuplicated)
+
+	msg := <-messages
+	require.Equal(t, webpubsubclient.DataTypeJSON, msg.DataType)
+	require.JSONEq(t, `{"hello":"world"}`, string(msg.Data))
+
+	// the service has already seen this ack ID.
+	resp, err = client.SendEvent(context.Background(), "echo", webpubsubclient.DataTypeText, []byte("again"), &webpubsubclient.SendEventOptions{AckID: to(uint64(100))})
+	require.NoError(t, err)
+	require.True(t, resp.IsDuplicated)
+
+	_, err = client.SendEvent(context.Background(), "echo", webpubsubclient.DataTypeJSON, []byte(`{`), nil)
+	require.EqualError(t, err, "data is not valid JSON")
+}
+
+func TestClient_AckError(t *testing.T) {
+	service := newFakeService(t)
+	service.forbiddenGroups["admins"] = true
+
+	client, err := webpubsubclient.NewClient(service.URL, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	defer func() { require.NoError(t, client.Stop(context.Background())) }()
+
+	_, err = client.JoinGroup(context.Background(), "admins", nil)
+
+	var ackErr *webpubsubclient.AckError
+	require.ErrorAs(t, err, &ackErr)
+	require.Equal(t, "Forbidden", ackErr.Name)
+	require.Equal(t, "not allowed to join admins", ackErr.Message)
+}
+
+func TestClient_ReconnectAndRejoin(t *testing.T) {
+	service := newFakeService(t)
+
+	disconnected := make(chan webpubsubclient.DisconnectedEvent, 1)
+	connected := make(chan webpubsubclient.ConnectedEvent, 2)
+
+	client, err := webpubsubclient.NewClient(service.URL, &webpubsubclient.ClientOptions{
+		ReconnectRetryOptions: webpubsubclient.RetryOptions{RetryDelay: time.Millisecond},
+		OnConnected:           func(event webpubsubclient.ConnectedEvent) { connected <- event },
+		OnDisconnected:        func(event webpubsubclient.DisconnectedEvent) { disconnected <- event },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	defer func() { require.NoError(t, client.Stop(context.Background())) }()
+
+	require.Equal(t, "conn-1", (<-connected).ConnectionID)
+
+	_, err = client.JoinGroup(context.Background(), "lobby", nil)
+	require.NoError(t, err)
+
+	service.Drop("conn-1", "service is restarting")
+
+	event := <-disconnected
+	require.Equal(t, "conn-1", event.ConnectionID)
+	require.Equal(t, "service is restarting", event.Message)
+
+	require.Equal(t, "conn-2", (<-connected).ConnectionID)
+
+	require.Eventually(t, func() bool {
+		return len(service.GroupMembers("lobby")) == 1 && service.GroupMembers("lobby")[0] == "conn-2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, int32(2), service.urlRequests.Load())
+}
+
+func TestClient_ReliableRecovery(t *testing.T) {
+	service := newFakeService(t)
+
+	connected := make(chan webpubsubclient.ConnectedEvent, 2)
+	messages := make(chan webpubsubclient.GroupMessage, 10)
+	var disconnects atomic.Int32
+
+	client, err := webpubsubclient.NewClient(service.URL, &webpubsubclient.ClientOptions{
+		Protocol:       webpubsubclient.ProtocolJSONReliable,
+		OnConnected:    func(event webpubsubclient.ConnectedEvent) { connected <- event },
+		OnDisconnected: func(event webpubsubclient.DisconnectedEvent) { disconnects.Add(1) },
+		OnGroupMessage: func(message webpubsubclient.GroupMessage) { messages <- message },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	defer func() { require.NoError(t, client.Stop(context.Background())) }()
+
+	require.Equal(t, "conn-1", (<-connected).ConnectionID)
+
+	_, err = client.JoinGroup(context.Background(), "lobby", nil)
+	require.NoError(t, err)
+
+	_, err = client.SendToGroup(context.Background(), "lobby", webpubsubclient.DataTypeText, []byte("first"), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), *(<-messages).SequenceID)
+
+	// the client acknowledges the sequence IDs it has received.
+	require.Eventually(t, func() bool { return service.LastSequenceAck("conn-1") == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	service.Drop("conn-1", "")
+
+	require.Eventually(t, func() bool { return service.recoveries.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return client.ConnectionID() == "conn-1" }, 5*time.Second, 10*time.Millisecond)
+
+	// the connection, and its groups, survive recovery.
+	_, err = client.SendToGroup(context.Background(), "lobby", webpubsubclient.DataTypeText, []byte("second"), nil)
+	require.NoError(t, err)
+
+	msg := <-messages
+	require.Equal(t, []byte("second"), msg.Data)
+	require.Equal(t, uint64(2), *msg.SequenceID)
+
+	require.Zero(t, disconnects.Load())
+	require.Equal(t, int32(1), service.urlRequests.Load())
+}
+
+func TestClient_Stop(t *testing.T) {
+	service := newFakeService(t)
+	stopped := make(chan struct{}, 2)
+
+	client, err := webpubsubclient.NewClient(service.URL, &webpubsubclient.ClientOptions{
+		OnStopped: func() { stopped <- struct{}{} },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	require.EqualError(t, client.Start(context.Background()), "the client has already been started")
+
+	require.NoError(t, client.Stop(context.Background()))
+	<-stopped
+
+	require.Empty(t, client.ConnectionID())
+
+	_, err = client.JoinGroup(context.Background(), "lobby", nil)
+	require.ErrorIs(t, err, webpubsubclient.ErrDisconnected)
+
+	// the client doesn't reconnect after it's stopped, but it can be started again.
+	require.Equal(t, int32(1), service.urlRequests.Load())
+
+	require.NoError(t, client.Start(context.Background()))
+	require.Equal(t, "conn-2", client.ConnectionID())
+	require.NoError(t, client.Stop(context.Background()))
+}
+
+func TestClient_DisableAutoReconnect(t *testing.T) {
+	service := newFakeService(t)
+	stopped := make(chan struct{})
+
+	client, err := webpubsubclient.NewClient(service.URL, &webpubsubclient.ClientOptions{
+		DisableAutoReconnect: true,
+		OnStopped:            func() { close(stopped) },
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+
+	service.Drop("conn-1", "")
+	<-stopped
+
+	require.Equal(t, int32(1), service.urlRequests.Load())
+}
+
+// fakeService implements the service side of the json.webpubsub.azure.v1 and json.reliable.webpubsub.azure.v1 subprotocols.
+type fakeService struct {
+	server *httptest.Server
+
+	urlRequests atomic.Int32
+	recoveries  atomic.Int32
+
+	mu              sync.Mutex
+	nextConn        int
+	conns           map[string]*fakeConn
+	groups          map[string]map[string]bool
+	forbiddenGroups map[string]bool
+}
+
+type fakeConn struct {
+	id       string
+	reliable bool
+	ws       *websocket.Conn
+	seq      uint64
+	seqAck   uint64
+	ackIDs   map[uint64]bool
+}
+
+func newFakeService(t *testing.T) *fakeService {
+	s := &fakeService{
+		conns:           map[string]*fakeConn{},
+		groups:          map[string]map[string]bool{},
+		forbiddenGroups: map[string]bool{},
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// URL is the ClientAccessURLFunc for the service.
+func (s *fakeService) URL(ctx context.Context) (string, error) {
+	s.urlRequests.Add(1)
+	return strings.Replace(s.server.URL, "http", "ws", 1) + "/client/hubs/chat?access_token=token", nil
+}
+
+func (s *fakeService) GroupMembers(group string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var members []string
+
+	for id := range s.groups[group] {
+		members = append(members, id)
+	}
+
+	return members
+}
+
+func (s *fakeService) LastSequenceAck(connID string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conns[connID].seqAck
+}
+
+// Drop closes the connection, without a close handshake, after sending a disconnected message if message isn't empty.
+func (s *fakeService) Drop(connID string, message string) {
+	s.mu.Lock()
+	conn := s.conns[connID]
+	ws := conn.ws
+	s.mu.Unlock()
+
+	if message != "" {
+		s.write(conn, map[string]any{"type": "system", "event": "disconnected", "message": message})
+	}
+
+	_ = ws.CloseNow()
+}
+
+func (s *fakeService) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols: []string{string(webpubsubclient.ProtocolJSON), string(webpubsubclient.ProtocolJSONReliable)},
+	})
+
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+
+	conn := s.conns[r.URL.Query().Get("awps_connection_id")]
+
+	if conn != nil && conn.reliable && r.URL.Query().Get("awps_reconnection_token") == "token-"+conn.id {
+		conn.ws = ws
+		s.recoveries.Add(1)
+		s.mu.Unlock()
+	} else {
+		s.nextConn++
+		conn = &fakeConn{
+			id:       fmt.Sprintf("conn-%d", s.nextConn),
+			reliable: ws.Subprotocol() == string(webpubsubclient.ProtocolJSONReliable),
+			ws:       ws,
+			ackIDs:   map[uint64]bool{},
+		}
+		s.conns[conn.id] = conn
+		s.mu.Unlock()
+
+		connected := map[string]any{"type": "system", "event": "connected", "connectionId": conn.id, "userId": "user-1"}
+
+		if conn.reliable {
+			connected["reconnectionToken"] = "token-" + conn.id
+		}
+
+		s.write(conn, connected)
+	}
+
+	for {
+		_, data, err := ws.Read(context.Background())
+
+		if err != nil {
+			if !conn.reliable {
+				s.mu.Lock()
+				for _, members := range s.groups {
+					delete(members, conn.id)
+				}
+				s.mu.Unlock()
+			}
+
+			return
+		}
+
+		var msg struct {
+			Type       string          `json:"type"`
+			Group      string          `json:"group"`
+			Event      string          `json:"event"`
+			AckID      *uint64         `json:"ackId"`
+			NoEcho     bool            `json:"noEcho"`
+			DataType   string          `json:"dataType"`
+			Data       json.RawMessage `json:"data"`
+			SequenceID uint64          `json:"sequenceId"`
+		}
+
+		if err := json.Unmarshal(data, &msg); err != nil {
+			panic(err)
+		}
+
+		s.mu.Lock()
+
+		duplicate := msg.AckID != nil && conn.ackIDs[*msg.AckID]
+
+		if msg.AckID != nil {
+			conn.ackIDs[*msg.AckID] = true
+		}
+
+		s.mu.Unlock()
+
+		if duplicate {
+			s.ack(conn, *msg.AckID, "Duplicate", "")
+			continue
+		}
+
+		switch msg.Type {
+		case "joinGroup":
+			s.mu.Lock()
+			forbidden := s.forbiddenGroups[msg.Group]
+
+			if !forbidden {
+				if s.groups[msg.Group] == nil {
+					s.groups[msg.Group] = map[string]bool{}
+				}
+
+				s.groups[msg.Group][conn.id] = true
+			}
+
+			s.mu.Unlock()
+
+			if forbidden {
+				s.ack(conn, *msg.AckID, "Forbidden", "not allowed to join "+msg.Group)
+			} else {
+				s.ack(conn, *msg.AckID, "", "")
+			}
+		case "leaveGroup":
+			s.mu.Lock()
+			delete(s.groups[msg.Group], conn.id)
+			s.mu.Unlock()
+
+			s.ack(conn, *msg.AckID, "", "")
+		case "sendToGroup":
+			s.mu.Lock()
+			var members []*fakeConn
+
+			for id := range s.groups[msg.Group] {
+				if !msg.NoEcho || id != conn.id {
+					members = append(members, s.conns[id])
+				}
+			}
+
+			s.mu.Unlock()
+
+			for _, member := range members {
+				s.write(member, map[string]any{"type": "message", "from": "group", "group": msg.Group, "fromUserId": "user-1", "dataType": msg.DataType, "data": msg.Data})
+			}
+
+			if msg.AckID != nil {
+				s.ack(conn, *msg.AckID, "", "")
+			}
+		case "event":
+			if msg.AckID != nil {
+				s.ack(conn, *msg.AckID, "", "")
+			}
+
+			s.write(conn, map[string]any{"type": "message", "from": "server", "dataType": msg.DataType, "data": msg.Data})
+		case "sequenceAck":
+			s.mu.Lock()
+			conn.seqAck = msg.SequenceID
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *fakeService) ack(conn *fakeConn, ackID uint64, errName string, errMessage string) {
+	ack := map[string]any{"type": "ack", "ackId": ackID, "success": errName == ""}
+
+	if errName != "" {
+		ack["error"] = map[string]string{"name": errName, "message": errMessage}
+	}
+
+	s.write(conn, ack)
+}
+
+func (s *fakeService) write(conn *fakeConn, msg map[string]any) {
+	s.mu.Lock()
+
+	if conn.reliable && msg["type"] == "message" {
+		conn.seq++
+		msg["sequenceId"] = conn.seq
+	}
+
+	ws := conn.ws
+	s.mu.Unlock()
+
+	data, err := json.Marshal(msg)
+
+	if err != nil {
+		panic(err)
+	}
+
+	_ = ws.Write(context.Background(), websocket.MessageText, data)
+}
+
+func to[T any](v T) *T {
+	return &v
+}
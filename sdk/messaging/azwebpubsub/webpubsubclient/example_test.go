@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package webpubsubclient_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azwebpubsub"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azwebpubsub/webpubsubclient"
+)
+
+func ExampleNewClient() {
+	connectionString := os.Getenv("WEBPUBSUB_CONNECTIONSTRING")
+
+	if connectionString == "" {
+		return
+	}
+
+	// normally your server generates the client access URL, and the client requests it from your server.
+	serviceClient, err := azwebpubsub.NewClientFromConnectionString(connectionString, nil)
+
+	if err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	getClientAccessURL := func(ctx context.Context) (string, error) {
+		resp, err := serviceClient.GenerateClientAccessURL(ctx, "chat", &azwebpubsub.GenerateClientAccessURLOptions{
+			UserID: "user-1",
+			Roles:  []string{"webpubsub.joinLeaveGroup", "webpubsub.sendToGroup"},
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return resp.URL, nil
+	}
+
+	client, err := webpubsubclient.NewClient(getClientAccessURL, &webpubsubclient.ClientOptions{
+		OnGroupMessage: func(message webpubsubclient.GroupMessage) {
+			fmt.Printf("Message in %s from %s: %s\n", message.Group, message.FromUserID, message.Data)
+		},
+	})
+
+	if err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	if err := client.Start(context.TODO()); err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	defer client.Stop(context.TODO())
+
+	if _, err := client.JoinGroup(context.TODO(), "lobby", nil); err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	if _, err := client.SendToGroup(context.TODO(), "lobby", webpubsubclient.DataTypeText, []byte("hello"), nil); err != nil {
+		// TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+}
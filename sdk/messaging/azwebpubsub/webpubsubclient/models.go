@@ -0,0 +1,229 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package webpubsubclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Protocol is the WebSocket subprotocol the [Client] uses.
+type Protocol string
+
+const (
+	// ProtocolJSON is the "json.webpubsub.azure.v1" subprotocol. If the connection drops the client
+	// reconnects with a new connection, and rejoins its groups.
+	ProtocolJSON Protocol = "json.webpubsub.azure.v1"
+
+	// ProtocolJSONReliable is the "json.reliable.webpubsub.azure.v1" subprotocol. If the connection drops
+	// the client first tries to recover it, without losing messages, before reconnecting.
+	ProtocolJSONReliable Protocol = "json.reliable.webpubsub.azure.v1"
+)
+
+// DataType is the type of the data in a message.
+type DataType string
+
+const (
+	// DataTypeBinary - binary data.
+	DataTypeBinary DataType = "binary"
+
+	// DataTypeJSON - JSON data. The data must be valid JSON.
+	DataTypeJSON DataType = "json"
+
+	// DataTypeText - UTF-8 text.
+	DataTypeText DataType = "text"
+)
+
+// ClientAccessURLFunc returns the URL, with an access token, the [Client] connects to. It's called each time the
+// client connects, so the token can be refreshed. Use azwebpubsub.Client.GenerateClientAccessURL, on your server,
+// to generate the URL.
+type ClientAccessURLFunc func(ctx context.Context) (string, error)
+
+// RetryOptions controls how reconnecting is retried.
+type RetryOptions struct {
+	// MaxRetries specifies the maximum number of attempts to reconnect.
+	// The default is 5. Set to -1 to disable retries.
+	MaxRetries int32
+
+	// RetryDelay specifies the amount of time to delay before retrying. The delay increases
+	// exponentially with each retry up to a maximum specified by MaxRetryDelay.
+	// The default is 1 second.
+	RetryDelay time.Duration
+
+	// MaxRetryDelay specifies the maximum delay allowed before retrying.
+	// The default is 30 seconds.
+	MaxRetryDelay time.Duration
+}
+
+// ClientOptions contains optional settings for [NewClient].
+type ClientOptions struct {
+	// Protocol is the subprotocol to use.
+	//
+	// Defaults to [ProtocolJSON].
+	Protocol Protocol
+
+	// DisableAutoReconnect stops the client, instead of reconnecting, when the connection drops.
+	DisableAutoReconnect bool
+
+	// DisableAutoRejoinGroups stops the client from rejoining the groups it joined, with [Client.JoinGroup],
+	// after it reconnects.
+	DisableAutoRejoinGroups bool
+
+	// ReconnectRetryOptions controls how reconnecting is retried.
+	ReconnectRetryOptions RetryOptions
+
+	// HTTPClient is used to open the WebSocket connection. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// OnConnected is called each time a connection is established.
+	OnConnected func(event ConnectedEvent)
+
+	// OnDisconnected is called each time the connection is lost, and can't be recovered.
+	OnDisconnected func(event DisconnectedEvent)
+
+	// OnStopped is called when the client stops, after [Client.Stop] or when it can't reconnect.
+	OnStopped func()
+
+	// OnServerMessage is called for each message sent to the connection by the server.
+	OnServerMessage func(message ServerMessage)
+
+	// OnGroupMessage is called for each message sent to a group the connection has joined.
+	OnGroupMessage func(message GroupMessage)
+
+	// OnRejoinGroupFailed is called when a group can't be rejoined after reconnecting.
+	OnRejoinGroupFailed func(group string, err error)
+}
+
+// ConnectedEvent is passed to [ClientOptions.OnConnected].
+type ConnectedEvent struct {
+	// ConnectionID is the ID of the connection.
+	ConnectionID string
+
+	// UserID is the user ID of the connection, if it has one.
+	UserID string
+}
+
+// DisconnectedEvent is passed to [ClientOptions.OnDisconnected].
+type DisconnectedEvent struct {
+	// ConnectionID is the ID of the connection that was lost.
+	ConnectionID string
+
+	// Message is the reason the service closed the connection, if it sent one.
+	Message string
+}
+
+// ServerMessage is a message sent to the connection by the server.
+type ServerMessage struct {
+	// DataType is the type of Data.
+	DataType DataType
+
+	// Data is the message's data. For [DataTypeJSON] this is the raw JSON.
+	Data []byte
+
+	// SequenceID is the message's sequence ID, when using [ProtocolJSONReliable].
+	SequenceID *uint64
+}
+
+// GroupMessage is a message sent to a group the connection has joined.
+type GroupMessage struct {
+	// Group is the group the message was sent to.
+	Group string
+
+	// FromUserID is the user ID of the connection that sent the message, if it has one.
+	FromUserID string
+
+	// DataType is the type of Data.
+	DataType DataType
+
+	// Data is the message's data. For [DataTypeJSON] this is the raw JSON.
+	Data []byte
+
+	// SequenceID is the message's sequence ID, when using [ProtocolJSONReliable].
+	SequenceID *uint64
+}
+
+// AckResult is the service's acknowledgement of a message.
+type AckResult struct {
+	// AckID is the ID the message was sent with.
+	AckID uint64
+
+	// IsDuplicated is true if the service had already received a message with the same AckID.
+	IsDuplicated bool
+}
+
+// JoinGroupOptions contains the optional parameters for [Client.JoinGroup].
+type JoinGroupOptions struct {
+	// AckID is the ID to send the message with. If nil, an ID is generated.
+	AckID *uint64
+}
+
+// JoinGroupResponse contains the response from [Client.JoinGroup].
+type JoinGroupResponse struct {
+	AckResult
+}
+
+// LeaveGroupOptions contains the optional parameters for [Client.LeaveGroup].
+type LeaveGroupOptions struct {
+	// AckID is the ID to send the message with. If nil, an ID is generated.
+	AckID *uint64
+}
+
+// LeaveGroupResponse contains the response from [Client.LeaveGroup].
+type LeaveGroupResponse struct {
+	AckResult
+}
+
+// SendToGroupOptions contains the optional parameters for [Client.SendToGroup].
+type SendToGroupOptions struct {
+	// AckID is the ID to send the message with. If nil, an ID is generated.
+	AckID *uint64
+
+	// FireAndForget sends the message without waiting for the service to acknowledge it.
+	FireAndForget bool
+
+	// NoEcho stops the message from being sent back to this connection.
+	NoEcho bool
+}
+
+// SendToGroupResponse contains the response from [Client.SendToGroup].
+type SendToGroupResponse struct {
+	AckResult
+}
+
+// SendEventOptions contains the optional parameters for [Client.SendEvent].
+type SendEventOptions struct {
+	// AckID is the ID to send the message with. If nil, an ID is generated.
+	AckID *uint64
+
+	// FireAndForget sends the message without waiting for the service to acknowledge it.
+	FireAndForget bool
+}
+
+// SendEventResponse contains the response from [Client.SendEvent].
+type SendEventResponse struct {
+	AckResult
+}
+
+// ErrDisconnected is returned when a message can't be sent, or acknowledged, because the client isn't connected.
+var ErrDisconnected = errors.New("the client is not connected")
+
+// AckError is returned when the service rejects a message.
+type AckError struct {
+	// AckID is the ID the message was sent with.
+	AckID uint64
+
+	// Name is the name of the error, ex: "Forbidden".
+	Name string
+
+	// Message describes the error.
+	Message string
+}
+
+// Error implements the error interface for type AckError.
+func (e *AckError) Error() string {
+	return fmt.Sprintf("message %d was rejected: %s: %s", e.AckID, e.Name, e.Message)
+}
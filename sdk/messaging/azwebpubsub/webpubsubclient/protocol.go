@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package webpubsubclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The messages of the json.webpubsub.azure.v1 and json.reliable.webpubsub.azure.v1 subprotocols.
+// See https://learn.microsoft.com/azure/azure-web-pubsub/reference-json-reliable-webpubsub-subprotocol
+
+const (
+	messageTypeAck         = "ack"
+	messageTypeEvent       = "event"
+	messageTypeJoinGroup   = "joinGroup"
+	messageTypeLeaveGroup  = "leaveGroup"
+	messageTypeMessage     = "message"
+	messageTypeSendToGroup = "sendToGroup"
+	messageTypeSequenceAck = "sequenceAck"
+	messageTypeSystem      = "system"
+
+	systemEventConnected    = "connected"
+	systemEventDisconnected = "disconnected"
+
+	messageFromGroup  = "group"
+	messageFromServer = "server"
+
+	ackErrorDuplicate = "Duplicate"
+)
+
+type outgoingMessage struct {
+	Type       string          `json:"type"`
+	Group      string          `json:"group,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	AckID      *uint64         `json:"ackId,omitempty"`
+	NoEcho     bool            `json:"noEcho,omitempty"`
+	DataType   DataType        `json:"dataType,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	SequenceID *uint64         `json:"sequenceId,omitempty"`
+}
+
+type incomingMessage struct {
+	Type string `json:"type"`
+
+	// system messages
+	Event             string `json:"event"`
+	UserID            string `json:"userId"`
+	ConnectionID      string `json:"connectionId"`
+	ReconnectionToken string `json:"reconnectionToken"`
+	Message           string `json:"message"`
+
+	// group and server messages
+	From       string          `json:"from"`
+	Group      string          `json:"group"`
+	FromUserID string          `json:"fromUserId"`
+	DataType   DataType        `json:"dataType"`
+	Data       json.RawMessage `json:"data"`
+	SequenceID *uint64         `json:"sequenceId"`
+
+	// acks
+	AckID   *uint64 `json:"ackId"`
+	Success bool    `json:"success"`
+	Error   *struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// encodeData converts data to its representation in a message: JSON as-is, text as a JSON string and
+// binary as a base64 encoded JSON string.
+func encodeData(dataType DataType, data []byte) (json.RawMessage, error) {
+	switch dataType {
+	case DataTypeJSON:
+		if !json.Valid(data) {
+			return nil, errors.New("data is not valid JSON")
+		}
+
+		return data, nil
+	case DataTypeText:
+		return json.Marshal(string(data))
+	case DataTypeBinary:
+		return json.Marshal(base64.StdEncoding.EncodeToString(data))
+	default:
+		return nil, fmt.Errorf("unsupported data type %q", dataType)
+	}
+}
+
+// decodeData is the inverse of encodeData.
+func decodeData(dataType DataType, data json.RawMessage) ([]byte, error) {
+	switch dataType {
+	case DataTypeJSON:
+		return data, nil
+	case DataTypeText, DataTypeBinary:
+		var s string
+
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("failed to decode %s data: %w", dataType, err)
+		}
+
+		if dataType == DataTypeText {
+			return []byte(s), nil
+		}
+
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unsupported data type %q", dataType)
+	}
+}
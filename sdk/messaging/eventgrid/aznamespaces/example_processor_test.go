@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aznamespaces_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/aznamespaces"
+)
+
+func ExampleReceiverClient_NewProcessor() {
+	endpoint := os.Getenv("EVENTGRID_ENDPOINT")
+	sharedKey := os.Getenv("EVENTGRID_KEY")
+	topic := os.Getenv("EVENTGRID_TOPIC")
+	subscription := os.Getenv("EVENTGRID_SUBSCRIPTION")
+
+	if endpoint == "" || sharedKey == "" || topic == "" || subscription == "" {
+		return
+	}
+
+	client, err := aznamespaces.NewReceiverClientWithSharedKeyCredential(endpoint, topic, subscription, azcore.NewKeyCredential(sharedKey), nil)
+
+	if err != nil {
+		//  TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	processor, err := client.NewProcessor(&aznamespaces.ProcessorOptions{
+		// process up to 10 events at the same time.
+		MaxConcurrentCalls: 10,
+	})
+
+	if err != nil {
+		//  TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	// when the program is interrupted, stop receiving events and let the events that are
+	// being processed finish, for up to 30 seconds.
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := processor.Close(ctx); err != nil {
+			fmt.Printf("Events were still being processed when the processor was closed: %s\n", err)
+		}
+	}()
+
+	err = processor.Run(context.Background(), func(ctx context.Context, args *aznamespaces.ProcessEventArgs) error {
+		event := args.Event.Event
+
+		if event.Type != "example.event" {
+			// we'll never be able to process this event, so reject it instead of retrying.
+			args.Reject()
+			return nil
+		}
+
+		fmt.Printf("Processing event %s (delivery count: %d)\n", event.ID, *args.Event.BrokerProperties.DeliveryCount)
+
+		// returning nil acknowledges the event. Returning an error releases it, so it'll be received again.
+		return nil
+	}, func(ctx context.Context, args *aznamespaces.ProcessErrorArgs) {
+		fmt.Printf("Error from %s: %s\n", args.ErrorSource, args.Err)
+	})
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		//  TODO: Update the following line with your application specific error handling logic
+		log.Fatalf("ERROR: %s", err)
+	}
+
+	stats := processor.Stats()
+	fmt.Printf("Received %d events: %d acknowledged, %d released, %d rejected\n", stats.Received, stats.Acknowledged, stats.Released, stats.Rejected)
+}
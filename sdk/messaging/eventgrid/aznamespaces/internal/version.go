@@ -14,5 +14,5 @@ const (
 	ModuleName = "github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/aznamespaces"
 
 	// ModuleVersion is the semantic version (see http://semver.org) of this module.
-	ModuleVersion = "v1.0.1"
+	ModuleVersion = "v1.1.0-beta.1"
 )
@@ -0,0 +1,838 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package aznamespaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// ProcessorOptions contains the optional parameters for [ReceiverClient.NewProcessor].
+type ProcessorOptions struct {
+	// MaxConcurrentCalls is the maximum number of events that will be passed to your
+	// handler at the same time.
+	//
+	// Defaults to 1.
+	MaxConcurrentCalls int
+
+	// ReceiveWaitTime is how long each receive waits for events to become available. Must be
+	// between 10 seconds and 120 seconds.
+	//
+	// Defaults to 60 seconds.
+	ReceiveWaitTime time.Duration
+
+	// LockRenewalInterval is how often the locks for events that are being processed are renewed.
+	// It should be less than the lock duration configured for the event subscription.
+	//
+	// Defaults to 30 seconds, half of the default lock duration.
+	LockRenewalInterval time.Duration
+
+	// MaxLockRenewalDuration is the maximum amount of time the Processor will continue to renew
+	// the lock for an event while it's being handled.
+	//
+	// Defaults to 5 minutes. Disabled if MaxLockRenewalDuration < 0.
+	MaxLockRenewalDuration time.Duration
+
+	// ReleaseDelay is the delay used when an event is released because your handler returned an error.
+	//
+	// Defaults to [ReleaseDelayTenSeconds].
+	ReleaseDelay ReleaseDelay
+
+	// SettlementInterval is the maximum amount of time an event's acknowledgement, release or rejection
+	// is held so it can be sent with other events. Settlements are also sent once there are 100 for
+	// the same outcome.
+	//
+	// Defaults to 1 second.
+	SettlementInterval time.Duration
+}
+
+// ProcessEventHandler is called by a [Processor] for each event that is received.
+//
+// If the handler returns nil the event is acknowledged. If it returns an error the event is
+// released, with [ProcessorOptions.ReleaseDelay]. Use the methods on [ProcessEventArgs] to choose
+// a different outcome.
+//
+// The ctx is cancelled if the Processor is stopped before the handler returns.
+type ProcessEventHandler func(ctx context.Context, args *ProcessEventArgs) error
+
+// ProcessErrorHandler is called by a [Processor] when an error occurs while receiving, renewing locks,
+// settling, or from your [ProcessEventHandler].
+//
+// Errors that are passed to this function are informational. The Processor will continue
+// running unless the error is also returned from Run.
+type ProcessErrorHandler func(ctx context.Context, args *ProcessErrorArgs)
+
+// ProcessErrorSource indicates the operation that failed, for a [ProcessErrorArgs].
+type ProcessErrorSource string
+
+const (
+	// ProcessErrorSourceReceive means the error occurred while receiving events.
+	ProcessErrorSourceReceive ProcessErrorSource = "receive"
+
+	// ProcessErrorSourceRenewLock means the error occurred while renewing an event's lock.
+	ProcessErrorSourceRenewLock ProcessErrorSource = "renewLock"
+
+	// ProcessErrorSourceSettle means the error occurred while acknowledging, releasing or rejecting an event.
+	ProcessErrorSourceSettle ProcessErrorSource = "settle"
+
+	// ProcessErrorSourceHandler means the error was returned from your [ProcessEventHandler].
+	ProcessErrorSourceHandler ProcessErrorSource = "handler"
+)
+
+// ProcessErrorArgs are the arguments passed to a [ProcessErrorHandler].
+type ProcessErrorArgs struct {
+	// Err is the error that occurred.
+	Err error
+
+	// ErrorSource is the operation that failed.
+	ErrorSource ProcessErrorSource
+
+	// Event is the event being processed when the error occurred, or nil if the
+	// error wasn't related to a specific event.
+	Event *ReceiveDetails
+}
+
+// ProcessEventArgs are the arguments passed to a [ProcessEventHandler].
+type ProcessEventArgs struct {
+	// Event is the event that was received.
+	Event *ReceiveDetails
+
+	mu      sync.Mutex
+	outcome *settlementOutcome
+}
+
+// Acknowledge acknowledges the event when the handler returns, even if it returns an error.
+func (a *ProcessEventArgs) Acknowledge() {
+	a.setOutcome(settlementOutcome{kind: settlementAcknowledge})
+}
+
+// Release releases the event when the handler returns, so it can be received again after delay.
+func (a *ProcessEventArgs) Release(delay ReleaseDelay) {
+	a.setOutcome(settlementOutcome{kind: settlementRelease, releaseDelay: delay})
+}
+
+// Reject rejects the event when the handler returns. Rejected events are dead-lettered, if
+// dead-lettering is configured for the event subscription, or dropped.
+func (a *ProcessEventArgs) Reject() {
+	a.setOutcome(settlementOutcome{kind: settlementReject})
+}
+
+func (a *ProcessEventArgs) setOutcome(outcome settlementOutcome) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.outcome = &outcome
+}
+
+func (a *ProcessEventArgs) getOutcome() *settlementOutcome {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.outcome
+}
+
+// ProcessorStats are counts of the events a [Processor] has received and settled.
+type ProcessorStats struct {
+	// Received is the number of events that have been received.
+	Received int64
+
+	// Acknowledged is the number of events that have been acknowledged.
+	Acknowledged int64
+
+	// Released is the number of events that have been released.
+	Released int64
+
+	// Rejected is the number of events that have been rejected.
+	Rejected int64
+
+	// HandlerErrors is the number of times your [ProcessEventHandler] has returned an error.
+	HandlerErrors int64
+
+	// SettlementFailures is the number of events that couldn't be acknowledged, released or rejected.
+	// These events are received again once their locks expire.
+	SettlementFailures int64
+
+	// LockRenewalFailures is the number of times an event's lock couldn't be renewed.
+	LockRenewalFailures int64
+}
+
+// Processor receives events from an Event Grid namespace topic subscription, and passes them
+// to your [ProcessEventHandler] concurrently. It renews the locks for events that are being processed,
+// and acknowledges, releases or rejects them in batches.
+// Don't use this type directly, use [ReceiverClient.NewProcessor] instead.
+type Processor struct {
+	client processorClient
+
+	maxConcurrentCalls     int
+	receiveWaitTime        int32
+	lockRenewalInterval    time.Duration
+	maxLockRenewalDuration time.Duration
+	releaseDelay           ReleaseDelay
+	settlementInterval     time.Duration
+
+	stats processorStats
+
+	mu            sync.Mutex
+	state         processorState
+	stopReceiving chan struct{}
+	runDone       chan struct{}
+	cancelRun     context.CancelFunc
+
+	inflight *inflightEvents
+}
+
+type processorState int
+
+const (
+	processorStateIdle processorState = iota
+	processorStateRunning
+	processorStateStopped
+)
+
+// processorClient is the subset of [ReceiverClient] that the Processor uses.
+type processorClient interface {
+	AcknowledgeEvents(ctx context.Context, lockTokens []string, options *AcknowledgeEventsOptions) (AcknowledgeEventsResponse, error)
+	ReceiveEvents(ctx context.Context, options *ReceiveEventsOptions) (ReceiveEventsResponse, error)
+	RejectEvents(ctx context.Context, lockTokens []string, options *RejectEventsOptions) (RejectEventsResponse, error)
+	ReleaseEvents(ctx context.Context, lockTokens []string, options *ReleaseEventsOptions) (ReleaseEventsResponse, error)
+	RenewEventLocks(ctx context.Context, lockTokens []string, options *RenewEventLocksOptions) (RenewEventLocksResponse, error)
+}
+
+// maxLockTokensPerRequest is the maximum number of lock tokens the service accepts in a single request.
+const maxLockTokensPerRequest = 100
+
+// NewProcessor creates a [Processor] that receives events from the client's topic subscription.
+func (client *ReceiverClient) NewProcessor(options *ProcessorOptions) (*Processor, error) {
+	return newProcessor(client, options)
+}
+
+func newProcessor(client processorClient, options *ProcessorOptions) (*Processor, error) {
+	if options == nil {
+		options = &ProcessorOptions{}
+	}
+
+	p := &Processor{
+		client:                 client,
+		maxConcurrentCalls:     options.MaxConcurrentCalls,
+		lockRenewalInterval:    options.LockRenewalInterval,
+		maxLockRenewalDuration: options.MaxLockRenewalDuration,
+		releaseDelay:           options.ReleaseDelay,
+		settlementInterval:     options.SettlementInterval,
+		stopReceiving:          make(chan struct{}),
+		runDone:                make(chan struct{}),
+		inflight:               &inflightEvents{events: map[string]inflightEvent{}},
+	}
+
+	if p.maxConcurrentCalls < 0 {
+		return nil, errors.New("MaxConcurrentCalls cannot be negative")
+	} else if p.maxConcurrentCalls == 0 {
+		p.maxConcurrentCalls = 1
+	}
+
+	receiveWaitTime := options.ReceiveWaitTime
+
+	if receiveWaitTime == 0 {
+		receiveWaitTime = time.Minute
+	}
+
+	if receiveWaitTime < 10*time.Second || receiveWaitTime > 120*time.Second {
+		return nil, errors.New("ReceiveWaitTime must be between 10 seconds and 120 seconds")
+	}
+
+	p.receiveWaitTime = int32(receiveWaitTime / time.Second)
+
+	if p.lockRenewalInterval < 0 {
+		return nil, errors.New("LockRenewalInterval cannot be negative")
+	} else if p.lockRenewalInterval == 0 {
+		p.lockRenewalInterval = 30 * time.Second
+	}
+
+	if p.maxLockRenewalDuration == 0 {
+		p.maxLockRenewalDuration = 5 * time.Minute
+	}
+
+	if p.releaseDelay == "" {
+		p.releaseDelay = ReleaseDelayTenSeconds
+	}
+
+	if p.settlementInterval < 0 {
+		return nil, errors.New("SettlementInterval cannot be negative")
+	} else if p.settlementInterval == 0 {
+		p.settlementInterval = time.Second
+	}
+
+	return p, nil
+}
+
+// Run receives events and passes them to handleEvent, until ctx is cancelled, [Processor.Close]
+// is called, or an unrecoverable error occurs.
+//
+// handleError is optional. If it's not nil, it is called with any errors that occur while processing.
+//
+// When ctx is cancelled the Processor stops receiving, cancels the context passed to any running
+// handlers and waits for them to return. Settlements that haven't been sent are dropped, and those
+// events are received again once their locks expire. Use [Processor.Close] instead to let running
+// handlers finish, and their events be settled, before stopping.
+//
+// On cancellation, or after Close, Run returns a nil error. Once a Processor has been stopped it
+// cannot be restarted and a new instance must be created.
+func (p *Processor) Run(ctx context.Context, handleEvent ProcessEventHandler, handleError ProcessErrorHandler) error {
+	if handleEvent == nil {
+		return errors.New("handleEvent must not be nil")
+	}
+
+	p.mu.Lock()
+
+	switch p.state {
+	case processorStateRunning:
+		p.mu.Unlock()
+		return errors.New("the Processor is already running")
+	case processorStateStopped:
+		p.mu.Unlock()
+		return errors.New("the Processor has been stopped and cannot be restarted")
+	}
+
+	p.state = processorStateRunning
+	ctx, cancel := context.WithCancel(ctx)
+	p.cancelRun = cancel
+	p.mu.Unlock()
+
+	defer func() {
+		cancel()
+
+		p.mu.Lock()
+		p.state = processorStateStopped
+		p.mu.Unlock()
+
+		close(p.runDone)
+	}()
+
+	reportError := func(args *ProcessErrorArgs) {
+		if handleError != nil {
+			handleError(ctx, args)
+		}
+	}
+
+	settler := newSettler(p, reportError)
+	settlerDone := make(chan struct{})
+
+	go func() {
+		defer close(settlerDone)
+		settler.Run(ctx)
+	}()
+
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	renewerDone := make(chan struct{})
+
+	go func() {
+		defer close(renewerDone)
+		p.renewLocks(renewCtx, reportError)
+	}()
+
+	var handlers sync.WaitGroup
+	err := p.receiveLoop(ctx, &handlers, settler, handleEvent, reportError)
+
+	handlers.Wait()
+	stopRenewing()
+	<-renewerDone
+	settler.Close()
+	<-settlerDone
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// Close stops the Processor from receiving new events, and waits for any running handlers
+// to finish and their events to be settled. If ctx is cancelled before that happens, the
+// contexts passed to the running handlers are cancelled as well, and any events that
+// haven't been settled are received again once their locks expire.
+func (p *Processor) Close(ctx context.Context) error {
+	p.mu.Lock()
+
+	if p.cancelRun == nil {
+		// Run was never called, so there's nothing to wait for.
+		p.state = processorStateStopped
+		p.mu.Unlock()
+		return nil
+	}
+
+	select {
+	case <-p.stopReceiving:
+	default:
+		close(p.stopReceiving)
+	}
+
+	cancelRun := p.cancelRun
+	p.mu.Unlock()
+
+	select {
+	case <-p.runDone:
+		return nil
+	case <-ctx.Done():
+		cancelRun()
+		<-p.runDone
+		return ctx.Err()
+	}
+}
+
+// Stats returns counts of the events the Processor has received and settled.
+func (p *Processor) Stats() ProcessorStats {
+	return p.stats.snapshot()
+}
+
+func (p *Processor) receiveLoop(ctx context.Context, handlers *sync.WaitGroup, settler *settler, handleEvent ProcessEventHandler, reportError func(args *ProcessErrorArgs)) error {
+	// stopping receives cancels the long-poll, but not the handlers or settlement.
+	receiveCtx, cancelReceive := context.WithCancel(ctx)
+	defer cancelReceive()
+
+	go func() {
+		select {
+		case <-p.stopReceiving:
+			cancelReceive()
+		case <-receiveCtx.Done():
+		}
+	}()
+
+	// slots has a token for each handler that is running, or that is reserved for the next receive.
+	slots := make(chan struct{}, p.maxConcurrentCalls)
+	failures := 0
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-receiveCtx.Done():
+			return nil
+		}
+
+		maxEvents := 1
+
+	ReserveSlots:
+		for maxEvents < min(p.maxConcurrentCalls, maxLockTokensPerRequest) {
+			select {
+			case slots <- struct{}{}:
+				maxEvents++
+			default:
+				break ReserveSlots
+			}
+		}
+
+		resp, err := p.client.ReceiveEvents(receiveCtx, &ReceiveEventsOptions{
+			MaxEvents:   toInt32Ptr(int32(maxEvents)),
+			MaxWaitTime: toInt32Ptr(p.receiveWaitTime),
+		})
+
+		if err != nil {
+			releaseSlots(slots, maxEvents)
+
+			if receiveCtx.Err() != nil {
+				return nil
+			}
+
+			reportError(&ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceReceive})
+
+			if isFatalProcessorError(err) {
+				return err
+			}
+
+			failures++
+
+			select {
+			case <-time.After(calcProcessorRetryDelay(failures)):
+			case <-receiveCtx.Done():
+				return nil
+			}
+
+			continue
+		}
+
+		failures = 0
+		p.stats.received.Add(int64(len(resp.Details)))
+
+		// any slots we didn't receive an event for are available for the next receive.
+		releaseSlots(slots, maxEvents-len(resp.Details))
+
+		for i := range resp.Details {
+			event := &resp.Details[i]
+			p.inflight.add(event)
+
+			handlers.Add(1)
+
+			go func() {
+				defer handlers.Done()
+				defer releaseSlots(slots, 1)
+
+				p.processEvent(ctx, event, settler, handleEvent, reportError)
+			}()
+		}
+	}
+}
+
+func (p *Processor) processEvent(ctx context.Context, event *ReceiveDetails, settler *settler, handleEvent ProcessEventHandler, reportError func(args *ProcessErrorArgs)) {
+	args := &ProcessEventArgs{Event: event}
+	err := handleEvent(ctx, args)
+
+	if err != nil {
+		p.stats.handlerErrors.Add(1)
+		reportError(&ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceHandler, Event: event})
+	}
+
+	outcome := args.getOutcome()
+
+	if outcome == nil {
+		if err == nil {
+			outcome = &settlementOutcome{kind: settlementAcknowledge}
+		} else {
+			outcome = &settlementOutcome{kind: settlementRelease, releaseDelay: p.releaseDelay}
+		}
+	}
+
+	settler.Add(*outcome, event)
+}
+
+// renewLocks renews the locks for in-flight events every LockRenewalInterval, until ctx is cancelled.
+func (p *Processor) renewLocks(ctx context.Context, reportError func(args *ProcessErrorArgs)) {
+	if p.maxLockRenewalDuration < 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.lockRenewalInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events := p.inflight.renewable(time.Now().Add(-p.maxLockRenewalDuration))
+
+		for _, chunk := range chunkEvents(events, maxLockTokensPerRequest) {
+			resp, err := p.client.RenewEventLocks(ctx, lockTokens(chunk), nil)
+
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				p.stats.lockRenewalFailures.Add(int64(len(chunk)))
+				reportError(&ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceRenewLock})
+				continue
+			}
+
+			for _, failed := range resp.FailedLockTokens {
+				p.stats.lockRenewalFailures.Add(1)
+				reportError(&ProcessErrorArgs{
+					Err:         failedLockTokenError(failed),
+					ErrorSource: ProcessErrorSourceRenewLock,
+					Event:       p.inflight.get(failed.LockToken),
+				})
+			}
+		}
+	}
+}
+
+type settlementKind int
+
+const (
+	settlementAcknowledge settlementKind = iota
+	settlementRelease
+	settlementReject
+)
+
+type settlementOutcome struct {
+	kind         settlementKind
+	releaseDelay ReleaseDelay
+}
+
+// settler batches settlements, sending them when there are maxLockTokensPerRequest for the same outcome,
+// or every settlementInterval.
+type settler struct {
+	processor   *Processor
+	reportError func(args *ProcessErrorArgs)
+
+	ch     chan settlement
+	closed chan struct{}
+}
+
+type settlement struct {
+	outcome settlementOutcome
+	event   *ReceiveDetails
+}
+
+func newSettler(p *Processor, reportError func(args *ProcessErrorArgs)) *settler {
+	return &settler{
+		processor:   p,
+		reportError: reportError,
+		ch:          make(chan settlement),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Add queues the event to be settled.
+func (s *settler) Add(outcome settlementOutcome, event *ReceiveDetails) {
+	s.ch <- settlement{outcome: outcome, event: event}
+}
+
+// Close sends any pending settlements, and stops the settler. Add must not be called after Close.
+func (s *settler) Close() {
+	close(s.closed)
+}
+
+func (s *settler) Run(ctx context.Context) {
+	pending := map[settlementOutcome][]*ReceiveDetails{}
+
+	ticker := time.NewTicker(s.processor.settlementInterval)
+	defer ticker.Stop()
+
+	flushAll := func() {
+		for outcome, events := range pending {
+			s.send(ctx, outcome, events)
+			delete(pending, outcome)
+		}
+	}
+
+	for {
+		select {
+		case item := <-s.ch:
+			pending[item.outcome] = append(pending[item.outcome], item.event)
+
+			if len(pending[item.outcome]) >= maxLockTokensPerRequest {
+				s.send(ctx, item.outcome, pending[item.outcome])
+				delete(pending, item.outcome)
+			}
+		case <-ticker.C:
+			flushAll()
+		case <-s.closed:
+			flushAll()
+			return
+		}
+	}
+}
+
+func (s *settler) send(ctx context.Context, outcome settlementOutcome, events []*ReceiveDetails) {
+	p := s.processor
+	defer p.inflight.remove(events)
+
+	if ctx.Err() != nil {
+		// the Processor was stopped without a graceful shutdown.
+		return
+	}
+
+	tokens := lockTokens(events)
+
+	var succeeded []string
+	var failed []FailedLockToken
+	var err error
+	var counter *atomic.Int64
+
+	switch outcome.kind {
+	case settlementAcknowledge:
+		var resp AcknowledgeEventsResponse
+		resp, err = p.client.AcknowledgeEvents(ctx, tokens, nil)
+		succeeded, failed, counter = resp.SucceededLockTokens, resp.FailedLockTokens, &p.stats.acknowledged
+	case settlementRelease:
+		var resp ReleaseEventsResponse
+		resp, err = p.client.ReleaseEvents(ctx, tokens, &ReleaseEventsOptions{ReleaseDelayInSeconds: &outcome.releaseDelay})
+		succeeded, failed, counter = resp.SucceededLockTokens, resp.FailedLockTokens, &p.stats.released
+	case settlementReject:
+		var resp RejectEventsResponse
+		resp, err = p.client.RejectEvents(ctx, tokens, nil)
+		succeeded, failed, counter = resp.SucceededLockTokens, resp.FailedLockTokens, &p.stats.rejected
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+
+		p.stats.settlementFailures.Add(int64(len(events)))
+
+		for _, event := range events {
+			s.reportError(&ProcessErrorArgs{Err: err, ErrorSource: ProcessErrorSourceSettle, Event: event})
+		}
+
+		return
+	}
+
+	counter.Add(int64(len(succeeded)))
+	p.stats.settlementFailures.Add(int64(len(failed)))
+
+	byToken := map[string]*ReceiveDetails{}
+
+	for _, event := range events {
+		byToken[*event.BrokerProperties.LockToken] = event
+	}
+
+	for _, f := range failed {
+		var event *ReceiveDetails
+
+		if f.LockToken != nil {
+			event = byToken[*f.LockToken]
+		}
+
+		s.reportError(&ProcessErrorArgs{Err: failedLockTokenError(f), ErrorSource: ProcessErrorSourceSettle, Event: event})
+	}
+}
+
+// inflightEvents are the events that have been received but not settled yet.
+type inflightEvents struct {
+	mu     sync.Mutex
+	events map[string]inflightEvent
+}
+
+type inflightEvent struct {
+	event    *ReceiveDetails
+	received time.Time
+}
+
+func (ie *inflightEvents) add(event *ReceiveDetails) {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	ie.events[*event.BrokerProperties.LockToken] = inflightEvent{event: event, received: time.Now()}
+}
+
+func (ie *inflightEvents) remove(events []*ReceiveDetails) {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	for _, event := range events {
+		delete(ie.events, *event.BrokerProperties.LockToken)
+	}
+}
+
+func (ie *inflightEvents) get(lockToken *string) *ReceiveDetails {
+	if lockToken == nil {
+		return nil
+	}
+
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	return ie.events[*lockToken].event
+}
+
+// renewable returns the in-flight events that were received after receivedAfter.
+func (ie *inflightEvents) renewable(receivedAfter time.Time) []*ReceiveDetails {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	var events []*ReceiveDetails
+
+	for _, e := range ie.events {
+		if e.received.After(receivedAfter) {
+			events = append(events, e.event)
+		}
+	}
+
+	return events
+}
+
+type processorStats struct {
+	received            atomic.Int64
+	acknowledged        atomic.Int64
+	released            atomic.Int64
+	rejected            atomic.Int64
+	handlerErrors       atomic.Int64
+	settlementFailures  atomic.Int64
+	lockRenewalFailures atomic.Int64
+}
+
+func (s *processorStats) snapshot() ProcessorStats {
+	return ProcessorStats{
+		Received:            s.received.Load(),
+		Acknowledged:        s.acknowledged.Load(),
+		Released:            s.released.Load(),
+		Rejected:            s.rejected.Load(),
+		HandlerErrors:       s.handlerErrors.Load(),
+		SettlementFailures:  s.settlementFailures.Load(),
+		LockRenewalFailures: s.lockRenewalFailures.Load(),
+	}
+}
+
+func failedLockTokenError(failed FailedLockToken) error {
+	token := ""
+
+	if failed.LockToken != nil {
+		token = *failed.LockToken
+	}
+
+	if failed.Error == nil {
+		return fmt.Errorf("lock token %s failed", token)
+	}
+
+	return fmt.Errorf("lock token %s failed: %w", token, failed.Error)
+}
+
+func lockTokens(events []*ReceiveDetails) []string {
+	tokens := make([]string, 0, len(events))
+
+	for _, event := range events {
+		tokens = append(tokens, *event.BrokerProperties.LockToken)
+	}
+
+	return tokens
+}
+
+func chunkEvents(events []*ReceiveDetails, size int) [][]*ReceiveDetails {
+	var chunks [][]*ReceiveDetails
+
+	for len(events) > size {
+		chunks = append(chunks, events[:size])
+		events = events[size:]
+	}
+
+	if len(events) > 0 {
+		chunks = append(chunks, events)
+	}
+
+	return chunks
+}
+
+func releaseSlots(slots chan struct{}, n int) {
+	for i := 0; i < n; i++ {
+		<-slots
+	}
+}
+
+// calcProcessorRetryDelay is an exponential backoff, from 1 second up to 30 seconds, for consecutive receive failures.
+func calcProcessorRetryDelay(failures int) time.Duration {
+	delay := time.Second << min(failures-1, 5)
+	return min(delay, 30*time.Second)
+}
+
+// isFatalProcessorError returns true for errors that won't be fixed by retrying, like authentication
+// failures or a missing topic or subscription.
+func isFatalProcessorError(err error) bool {
+	var respErr *azcore.ResponseError
+
+	if !errors.As(err, &respErr) {
+		return false
+	}
+
+	switch respErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+func toInt32Ptr(v int32) *int32 {
+	return &v
+}
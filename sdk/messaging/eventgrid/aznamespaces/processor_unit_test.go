@@ -0,0 +1,458 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package aznamespaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/messaging"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessor_Options(t *testing.T) {
+	p, err := newProcessor(&fakeProcessorClient{}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, p.maxConcurrentCalls)
+	require.Equal(t, int32(60), p.receiveWaitTime)
+	require.Equal(t, 30*time.Second, p.lockRenewalInterval)
+	require.Equal(t, 5*time.Minute, p.maxLockRenewalDuration)
+	require.Equal(t, ReleaseDelayTenSeconds, p.releaseDelay)
+	require.Equal(t, time.Second, p.settlementInterval)
+
+	_, err = newProcessor(&fakeProcessorClient{}, &ProcessorOptions{ReceiveWaitTime: 5 * time.Second})
+	require.EqualError(t, err, "ReceiveWaitTime must be between 10 seconds and 120 seconds")
+
+	_, err = newProcessor(&fakeProcessorClient{}, &ProcessorOptions{MaxConcurrentCalls: -1})
+	require.EqualError(t, err, "MaxConcurrentCalls cannot be negative")
+}
+
+func TestProcessor_SettlesByOutcome(t *testing.T) {
+	client := &fakeProcessorClient{}
+	client.Enqueue(5)
+
+	p, err := newProcessor(client, &ProcessorOptions{
+		MaxConcurrentCalls: 5,
+		ReceiveWaitTime:    10 * time.Second,
+		ReleaseDelay:       ReleaseDelayOneMinute,
+		SettlementInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	var handled atomic.Int32
+	var handlerErrs []error
+	var mu sync.Mutex
+
+	go func() {
+		for handled.Load() < 5 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		require.NoError(t, p.Close(context.Background()))
+	}()
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+		defer handled.Add(1)
+
+		switch args.Event.Event.ID {
+		case "event-1":
+			return errors.New("handler failed")
+		case "event-2":
+			args.Reject()
+		case "event-3":
+			args.Release(ReleaseDelayNoDelay)
+		}
+
+		return nil
+	}, func(ctx context.Context, args *ProcessErrorArgs) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.Equal(t, ProcessErrorSourceHandler, args.ErrorSource)
+		handlerErrs = append(handlerErrs, args.Err)
+	})
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{"token-0", "token-4"}, client.Settled("acknowledge"))
+	require.ElementsMatch(t, []string{"token-1"}, client.Settled("release:60"))
+	require.ElementsMatch(t, []string{"token-3"}, client.Settled("release:0"))
+	require.ElementsMatch(t, []string{"token-2"}, client.Settled("reject"))
+	require.Len(t, handlerErrs, 1)
+
+	require.Equal(t, ProcessorStats{
+		Received:      5,
+		Acknowledged:  2,
+		Released:      2,
+		Rejected:      1,
+		HandlerErrors: 1,
+	}, p.Stats())
+
+	require.Empty(t, p.inflight.events)
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error { return nil }, nil)
+	require.EqualError(t, err, "the Processor has been stopped and cannot be restarted")
+}
+
+func TestProcessor_MaxConcurrentCalls(t *testing.T) {
+	client := &fakeProcessorClient{}
+	client.Enqueue(20)
+
+	p, err := newProcessor(client, &ProcessorOptions{
+		MaxConcurrentCalls: 3,
+		ReceiveWaitTime:    10 * time.Second,
+		SettlementInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	var running, maxRunning, handled atomic.Int32
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			current := maxRunning.Load()
+
+			if n <= current || maxRunning.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		if handled.Add(1) == 20 {
+			go func() { _ = p.Close(context.Background()) }()
+		}
+
+		return nil
+	}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, int32(3), maxRunning.Load())
+	require.Len(t, client.Settled("acknowledge"), 20)
+
+	for _, maxEvents := range client.ReceiveMaxEvents() {
+		require.LessOrEqual(t, maxEvents, int32(3))
+	}
+}
+
+func TestProcessor_RenewsLocks(t *testing.T) {
+	client := &fakeProcessorClient{}
+	client.Enqueue(1)
+
+	p, err := newProcessor(client, &ProcessorOptions{
+		ReceiveWaitTime:     10 * time.Second,
+		LockRenewalInterval: 10 * time.Millisecond,
+		SettlementInterval:  10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+		for len(client.Renewed()) < 3 {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		go func() { _ = p.Close(context.Background()) }()
+		return nil
+	}, nil)
+	require.NoError(t, err)
+
+	for _, token := range client.Renewed() {
+		require.Equal(t, "token-0", token)
+	}
+
+	require.Equal(t, []string{"token-0"}, client.Settled("acknowledge"))
+}
+
+func TestProcessor_SettlementFailures(t *testing.T) {
+	client := &fakeProcessorClient{failTokens: map[string]bool{"token-1": true}}
+	client.Enqueue(2)
+
+	p, err := newProcessor(client, &ProcessorOptions{
+		MaxConcurrentCalls: 2,
+		ReceiveWaitTime:    10 * time.Second,
+		SettlementInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	var settleErrs []*ProcessErrorArgs
+	var handled atomic.Int32
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+		if handled.Add(1) == 2 {
+			go func() { _ = p.Close(context.Background()) }()
+		}
+
+		return nil
+	}, func(ctx context.Context, args *ProcessErrorArgs) {
+		settleErrs = append(settleErrs, args)
+	})
+	require.NoError(t, err)
+
+	// both acknowledgements were sent in a single request when the Processor was closed.
+	require.Equal(t, 1, client.Requests("acknowledge"))
+	require.Len(t, settleErrs, 1)
+	require.Equal(t, ProcessErrorSourceSettle, settleErrs[0].ErrorSource)
+	require.Equal(t, "token-1", *settleErrs[0].Event.BrokerProperties.LockToken)
+
+	stats := p.Stats()
+	require.Equal(t, int64(1), stats.Acknowledged)
+	require.Equal(t, int64(1), stats.SettlementFailures)
+}
+
+func TestProcessor_FatalReceiveError(t *testing.T) {
+	client := &fakeProcessorClient{receiveErr: &azcore.ResponseError{StatusCode: http.StatusUnauthorized}}
+
+	p, err := newProcessor(client, nil)
+	require.NoError(t, err)
+
+	var receiveErrs []error
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+		return nil
+	}, func(ctx context.Context, args *ProcessErrorArgs) {
+		require.Equal(t, ProcessErrorSourceReceive, args.ErrorSource)
+		receiveErrs = append(receiveErrs, args.Err)
+	})
+
+	var respErr *azcore.ResponseError
+	require.ErrorAs(t, err, &respErr)
+	require.Equal(t, http.StatusUnauthorized, respErr.StatusCode)
+	require.Len(t, receiveErrs, 1)
+}
+
+func TestProcessor_CloseTimeoutCancelsHandlers(t *testing.T) {
+	client := &fakeProcessorClient{}
+	client.Enqueue(1)
+
+	p, err := newProcessor(client, &ProcessorOptions{ReceiveWaitTime: 10 * time.Second})
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	runErr := make(chan error, 1)
+
+	go func() {
+		runErr <- p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil)
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+	require.NoError(t, <-runErr)
+
+	// the Processor was stopped before the event could be settled, so it'll be redelivered when its lock expires.
+	require.Empty(t, client.Settled("release:10"))
+	require.Equal(t, int64(1), p.Stats().HandlerErrors)
+}
+
+func TestProcessor_CloseBeforeRun(t *testing.T) {
+	p, err := newProcessor(&fakeProcessorClient{}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	require.NoError(t, p.Close(ctx))
+	require.NoError(t, p.Close(ctx))
+	require.NoError(t, p.Close(context.Background()))
+
+	err = p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+		return nil
+	}, nil)
+	require.EqualError(t, err, "the Processor has been stopped and cannot be restarted")
+}
+
+func TestProcessor_CloseTwice(t *testing.T) {
+	client := &fakeProcessorClient{}
+	client.Enqueue(1)
+
+	p, err := newProcessor(client, &ProcessorOptions{
+		ReceiveWaitTime:    10 * time.Second,
+		SettlementInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	handled := make(chan struct{})
+	runErr := make(chan error, 1)
+
+	go func() {
+		runErr <- p.Run(context.Background(), func(ctx context.Context, args *ProcessEventArgs) error {
+			close(handled)
+			return nil
+		}, nil)
+	}()
+
+	<-handled
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	require.NoError(t, p.Close(ctx))
+	require.NoError(t, <-runErr)
+
+	// the Processor has already stopped, so the second Close returns right away.
+	require.NoError(t, p.Close(ctx))
+	require.Equal(t, []string{"token-0"}, client.Settled("acknowledge"))
+}
+
+func TestCalcProcessorRetryDelay(t *testing.T) {
+	require.Equal(t, time.Second, calcProcessorRetryDelay(1))
+	require.Equal(t, 2*time.Second, calcProcessorRetryDelay(2))
+	require.Equal(t, 16*time.Second, calcProcessorRetryDelay(5))
+	require.Equal(t, 30*time.Second, calcProcessorRetryDelay(6))
+	require.Equal(t, 30*time.Second, calcProcessorRetryDelay(100))
+}
+
+// fakeProcessorClient is an in-memory processorClient. ReceiveEvents returns queued events,
+// blocking until ctx is cancelled when the queue is empty, like a long-poll.
+type fakeProcessorClient struct {
+	receiveErr error
+	failTokens map[string]bool
+
+	mu               sync.Mutex
+	queue            []ReceiveDetails
+	enqueued         int
+	receiveMaxEvents []int32
+	settled          map[string][]string
+	requests         map[string]int
+	renewed          []string
+}
+
+func (c *fakeProcessorClient) Enqueue(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		c.queue = append(c.queue, ReceiveDetails{
+			BrokerProperties: &BrokerProperties{
+				DeliveryCount: to.Ptr[int32](1),
+				LockToken:     to.Ptr(fmt.Sprintf("token-%d", c.enqueued)),
+			},
+			Event: messaging.CloudEvent{ID: fmt.Sprintf("event-%d", c.enqueued)},
+		})
+		c.enqueued++
+	}
+}
+
+func (c *fakeProcessorClient) Settled(outcome string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.settled[outcome]
+}
+
+func (c *fakeProcessorClient) Requests(outcome string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.requests[outcome]
+}
+
+func (c *fakeProcessorClient) Renewed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.renewed...)
+}
+
+func (c *fakeProcessorClient) ReceiveMaxEvents() []int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]int32(nil), c.receiveMaxEvents...)
+}
+
+func (c *fakeProcessorClient) ReceiveEvents(ctx context.Context, options *ReceiveEventsOptions) (ReceiveEventsResponse, error) {
+	if c.receiveErr != nil {
+		return ReceiveEventsResponse{}, c.receiveErr
+	}
+
+	c.mu.Lock()
+	c.receiveMaxEvents = append(c.receiveMaxEvents, *options.MaxEvents)
+
+	if len(c.queue) == 0 {
+		c.mu.Unlock()
+		<-ctx.Done()
+		return ReceiveEventsResponse{}, ctx.Err()
+	}
+
+	n := min(int(*options.MaxEvents), len(c.queue))
+	details := c.queue[:n]
+	c.queue = c.queue[n:]
+	c.mu.Unlock()
+
+	return ReceiveEventsResponse{ReceiveEventsResult: ReceiveEventsResult{Details: details}}, nil
+}
+
+func (c *fakeProcessorClient) AcknowledgeEvents(ctx context.Context, lockTokens []string, options *AcknowledgeEventsOptions) (AcknowledgeEventsResponse, error) {
+	succeeded, failed := c.settle("acknowledge", lockTokens)
+	return AcknowledgeEventsResponse{AcknowledgeEventsResult{SucceededLockTokens: succeeded, FailedLockTokens: failed}}, nil
+}
+
+func (c *fakeProcessorClient) ReleaseEvents(ctx context.Context, lockTokens []string, options *ReleaseEventsOptions) (ReleaseEventsResponse, error) {
+	succeeded, failed := c.settle("release:"+string(*options.ReleaseDelayInSeconds), lockTokens)
+	return ReleaseEventsResponse{ReleaseEventsResult{SucceededLockTokens: succeeded, FailedLockTokens: failed}}, nil
+}
+
+func (c *fakeProcessorClient) RejectEvents(ctx context.Context, lockTokens []string, options *RejectEventsOptions) (RejectEventsResponse, error) {
+	succeeded, failed := c.settle("reject", lockTokens)
+	return RejectEventsResponse{RejectEventsResult{SucceededLockTokens: succeeded, FailedLockTokens: failed}}, nil
+}
+
+func (c *fakeProcessorClient) RenewEventLocks(ctx context.Context, lockTokens []string, options *RenewEventLocksOptions) (RenewEventLocksResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.renewed = append(c.renewed, lockTokens...)
+	return RenewEventLocksResponse{RenewEventLocksResult{SucceededLockTokens: lockTokens}}, nil
+}
+
+func (c *fakeProcessorClient) settle(outcome string, lockTokens []string) ([]string, []FailedLockToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.settled == nil {
+		c.settled = map[string][]string{}
+		c.requests = map[string]int{}
+	}
+
+	c.requests[outcome]++
+
+	var succeeded []string
+	var failed []FailedLockToken
+
+	for _, token := range lockTokens {
+		if c.failTokens[token] {
+			failed = append(failed, FailedLockToken{
+				Error:     &Error{Code: to.Ptr("TokenLost"), Message: to.Ptr("lock token lost")},
+				LockToken: to.Ptr(token),
+			})
+			continue
+		}
+
+		succeeded = append(succeeded, token)
+		c.settled[outcome] = append(c.settled[outcome], token)
+	}
+
+	return succeeded, failed
+}
@@ -0,0 +1,37 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package webhook_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/azsystemevents"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/azsystemevents/webhook"
+)
+
+func ExampleNewHandler() {
+	handler := webhook.NewHandler(&webhook.HandlerOptions{
+		// Only allow CloudEvents to be delivered by Event Grid.
+		AllowedOrigins: []string{"eventgrid.azure.net"},
+	})
+
+	// System events are decoded into their data type from azsystemevents.
+	webhook.HandleEvent(handler, azsystemevents.TypeStorageBlobCreated, func(ctx context.Context, event webhook.Event, data azsystemevents.StorageBlobCreatedEventData) error {
+		fmt.Printf("Blob created: %s\n", *data.URL)
+		return nil
+	})
+
+	// Events can also be handled using their raw data.
+	handler.Handle("Contoso.Items.ItemReceived", func(ctx context.Context, event webhook.Event) error {
+		fmt.Printf("Item received: %s\n", string(event.Data))
+		return nil
+	})
+
+	// The handler completes the subscription validation handshakes, for both the Event Grid and CloudEvents schemas.
+	http.Handle("/api/events", handler)
+
+	// err := http.ListenAndServe(":8080", nil)
+}
@@ -0,0 +1,406 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+// Package webhook contains an [http.Handler] that receives events from Azure Event Grid webhook subscriptions.
+//
+// The [Handler] completes the Event Grid subscription validation handshake, and the CloudEvents webhook
+// abuse protection handshake, decodes batches of events in either the Event Grid schema or the CloudEvents
+// schema, and dispatches each event to the function registered for its type, using the Type constants
+// from the azsystemevents package, or your own event types.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/messaging"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/azsystemevents"
+)
+
+// Schema is the schema an event was delivered in.
+type Schema string
+
+const (
+	// SchemaCloudEvents - the CloudEvents v1.0 schema.
+	SchemaCloudEvents Schema = "CloudEvents"
+	// SchemaEventGrid - the Event Grid event schema.
+	SchemaEventGrid Schema = "EventGrid"
+)
+
+// Event is an event received by the [Handler], in either schema.
+type Event struct {
+	// Schema is the schema the event was delivered in. Either EventGridEvent or CloudEvent is set, depending on the schema.
+	Schema Schema
+
+	// ID is the event's ID.
+	ID string
+
+	// Type is the event's type. For system events this is one of the Type constants in azsystemevents, ex: [azsystemevents.TypeStorageBlobCreated].
+	Type string
+
+	// Source is the topic (Event Grid schema) or source (CloudEvents schema) of the event.
+	Source string
+
+	// Subject is the event's subject.
+	Subject string
+
+	// Time is the time the event was generated.
+	Time *time.Time
+
+	// Data is the event's data. For JSON data this is the raw JSON.
+	Data []byte
+
+	// EventGridEvent is the event, if it was delivered in the Event Grid schema.
+	EventGridEvent *azsystemevents.EventGridEvent
+
+	// CloudEvent is the event, if it was delivered in the CloudEvents schema.
+	CloudEvent *messaging.CloudEvent
+}
+
+// HandlerFunc handles an event. Returning an error fails the request, and Event Grid redelivers the entire
+// batch, according to the subscription's retry policy. Handlers should be idempotent.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// HandlerOptions contains optional parameters for [NewHandler].
+type HandlerOptions struct {
+	// AllowedOrigins are the origins that can deliver CloudEvents to the handler, as part of the
+	// CloudEvents webhook abuse protection handshake. Event Grid's origin is "eventgrid.azure.net".
+	//
+	// If empty, all origins are allowed.
+	AllowedOrigins []string
+
+	// MaxRequestBodyBytes is the largest request body that is accepted.
+	//
+	// The default is 2MiB, which is larger than Event Grid's largest batch.
+	MaxRequestBodyBytes int64
+
+	// SubscriptionValidation is called when Event Grid validates a subscription that uses the Event Grid
+	// schema. If it returns an error the subscription is rejected.
+	//
+	// If nil, all subscriptions are accepted.
+	SubscriptionValidation func(ctx context.Context, event Event, data azsystemevents.SubscriptionValidationEventData) error
+
+	// UnhandledEvent is called for events that don't have a registered function.
+	//
+	// If nil, unhandled events are ignored.
+	UnhandledEvent HandlerFunc
+}
+
+// Handler is an [http.Handler] for Event Grid webhook deliveries.
+// Don't use this type directly, use [NewHandler] instead.
+type Handler struct {
+	options HandlerOptions
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+// NewHandler creates a Handler. Use [Handler.Handle] or [HandleEvent] to register functions for event types.
+func NewHandler(options *HandlerOptions) *Handler {
+	if options == nil {
+		options = &HandlerOptions{}
+	}
+
+	h := &Handler{
+		options:  *options,
+		handlers: map[string]HandlerFunc{},
+	}
+
+	if h.options.MaxRequestBodyBytes <= 0 {
+		h.options.MaxRequestBodyBytes = 2 * 1024 * 1024
+	}
+
+	return h
+}
+
+// Handle registers fn for events with eventType, replacing any existing function.
+func (h *Handler) Handle(eventType string, fn HandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.handlers[eventType] = fn
+}
+
+// HandleEvent registers fn for events with eventType, with the event's data decoded, from JSON, into a T.
+//
+// T is usually the data type for a system event, ex: [azsystemevents.StorageBlobCreatedEventData] for
+// [azsystemevents.TypeStorageBlobCreated]. If the data can't be decoded the request is rejected, with
+// http.StatusBadRequest, since redelivering it won't help.
+func HandleEvent[T any](h *Handler, eventType string, fn func(ctx context.Context, event Event, data T) error) {
+	h.Handle(eventType, func(ctx context.Context, event Event) error {
+		var data T
+
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return &decodeError{err: fmt.Errorf("failed to decode data for event %s, with type %s: %w", event.ID, event.Type, err)}
+		}
+
+		return fn(ctx, event, data)
+	})
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		h.serveAbuseProtection(w, r)
+	case http.MethodPost:
+		h.serveEvents(w, r)
+	default:
+		w.Header().Set("Allow", "OPTIONS, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveAbuseProtection handles the CloudEvents webhook validation request.
+// See https://github.com/cloudevents/spec/blob/v1.0/http-webhook.md#4-abuse-protection
+func (h *Handler) serveAbuseProtection(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("WebHook-Request-Origin")
+
+	if origin == "" {
+		http.Error(w, "missing WebHook-Request-Origin header", http.StatusBadRequest)
+		return
+	}
+
+	if !h.isAllowedOrigin(origin) {
+		http.Error(w, "origin is not allowed", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("WebHook-Allowed-Origin", origin)
+
+	if r.Header.Get("WebHook-Request-Rate") != "" {
+		w.Header().Set("WebHook-Allowed-Rate", "*")
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) isAllowedOrigin(origin string) bool {
+	if len(h.options.AllowedOrigins) == 0 {
+		return true
+	}
+
+	for _, allowed := range h.options.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.options.MaxRequestBodyBytes))
+
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	events, err := decodeEvents(body)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(events) == 1 && events[0].Schema == SchemaEventGrid && events[0].Type == azsystemevents.TypeSubscriptionValidation {
+		h.serveSubscriptionValidation(w, r, events[0])
+		return
+	}
+
+	for _, event := range events {
+		if err := h.dispatch(r.Context(), event); err != nil {
+			var decodeErr *decodeError
+
+			if errors.As(err, &decodeErr) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveSubscriptionValidation responds to the Event Grid subscription validation handshake.
+// See https://learn.microsoft.com/azure/event-grid/webhook-event-delivery
+func (h *Handler) serveSubscriptionValidation(w http.ResponseWriter, r *http.Request, event Event) {
+	var data azsystemevents.SubscriptionValidationEventData
+
+	if err := json.Unmarshal(event.Data, &data); err != nil || data.ValidationCode == nil {
+		http.Error(w, "invalid subscription validation event", http.StatusBadRequest)
+		return
+	}
+
+	if h.options.SubscriptionValidation != nil {
+		if err := h.options.SubscriptionValidation(r.Context(), event, data); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	resp, err := json.Marshal(azsystemevents.SubscriptionValidationResponse{
+		ValidationResponse: data.ValidationCode,
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resp)
+}
+
+func (h *Handler) dispatch(ctx context.Context, event Event) error {
+	h.mu.RLock()
+	fn := h.handlers[event.Type]
+	h.mu.RUnlock()
+
+	if fn == nil {
+		fn = h.options.UnhandledEvent
+	}
+
+	if fn == nil {
+		return nil
+	}
+
+	return fn(ctx, event)
+}
+
+// decodeEvents decodes a single event, or a batch of events, in either schema. CloudEvents are
+// recognized by their required specversion attribute.
+func decodeEvents(body []byte) ([]Event, error) {
+	body = bytes.TrimSpace(body)
+
+	var rawEvents []json.RawMessage
+
+	if len(body) > 0 && body[0] == '{' {
+		rawEvents = []json.RawMessage{body}
+	} else if err := json.Unmarshal(body, &rawEvents); err != nil {
+		return nil, fmt.Errorf("failed to decode events: %w", err)
+	}
+
+	events := make([]Event, 0, len(rawEvents))
+
+	for _, rawEvent := range rawEvents {
+		var attributes struct {
+			SpecVersion *string `json:"specversion"`
+		}
+
+		if err := json.Unmarshal(rawEvent, &attributes); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+
+		var event Event
+		var err error
+
+		if attributes.SpecVersion != nil {
+			event, err = decodeCloudEvent(rawEvent)
+		} else {
+			event, err = decodeEventGridEvent(rawEvent)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func decodeCloudEvent(rawEvent []byte) (Event, error) {
+	var ce messaging.CloudEvent
+
+	if err := json.Unmarshal(rawEvent, &ce); err != nil {
+		return Event{}, fmt.Errorf("failed to decode CloudEvent: %w", err)
+	}
+
+	event := Event{
+		Schema:     SchemaCloudEvents,
+		ID:         ce.ID,
+		Type:       ce.Type,
+		Source:     ce.Source,
+		Time:       ce.Time,
+		CloudEvent: &ce,
+	}
+
+	if ce.Subject != nil {
+		event.Subject = *ce.Subject
+	}
+
+	if data, ok := ce.Data.([]byte); ok {
+		event.Data = data
+	}
+
+	return event, nil
+}
+
+func decodeEventGridEvent(rawEvent []byte) (Event, error) {
+	var ege azsystemevents.EventGridEvent
+
+	if err := json.Unmarshal(rawEvent, &ege); err != nil {
+		return Event{}, fmt.Errorf("failed to decode EventGridEvent: %w", err)
+	}
+
+	if ege.ID == nil || ege.EventType == nil {
+		return Event{}, errors.New("failed to decode EventGridEvent: id and eventType are required")
+	}
+
+	event := Event{
+		Schema:         SchemaEventGrid,
+		ID:             *ege.ID,
+		Type:           *ege.EventType,
+		Time:           ege.EventTime,
+		EventGridEvent: &ege,
+	}
+
+	if ege.Topic != nil {
+		event.Source = *ege.Topic
+	}
+
+	if ege.Subject != nil {
+		event.Subject = *ege.Subject
+	}
+
+	if data, ok := ege.Data.([]byte); ok {
+		event.Data = data
+	}
+
+	return event, nil
+}
+
+// decodeError is returned when an event's data can't be decoded into the type the HandleEvent function expects.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
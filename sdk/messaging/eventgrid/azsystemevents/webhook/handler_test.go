@@ -0,0 +1,260 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License. See License.txt in the project root for license information.
+
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/azsystemevents"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/eventgrid/azsystemevents/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+const subscriptionValidationEvent = `[{
+	"id": "2d1781af-3a4c-4d7c-bd0c-e34b19da4e66",
+	"topic": "/subscriptions/xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx",
+	"subject": "",
+	"data": {
+		"validationCode": "512d38b6-c7b8-40c8-89fe-f46f9e9622b6",
+		"validationUrl": "https://rp-eastus2.eventgrid.azure.net:553/eventsubscriptions/estest/validate"
+	},
+	"eventType": "Microsoft.EventGrid.SubscriptionValidationEvent",
+	"eventTime": "2018-01-25T22:12:19.4556811Z",
+	"metadataVersion": "1",
+	"dataVersion": "1"
+}]`
+
+const blobCreatedEventGridEvents = `[{
+	"topic": "/subscriptions/id/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account",
+	"subject": "/blobServices/default/containers/container/blobs/first.txt",
+	"eventType": "Microsoft.Storage.BlobCreated",
+	"eventTime": "2024-01-01T00:00:00Z",
+	"id": "event-1",
+	"data": {"api": "PutBlob", "url": "https://account.blob.core.windows.net/container/first.txt"},
+	"dataVersion": "",
+	"metadataVersion": "1"
+}, {
+	"topic": "/subscriptions/id/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account",
+	"subject": "/blobServices/default/containers/container/blobs/first.txt",
+	"eventType": "Microsoft.Storage.BlobDeleted",
+	"eventTime": "2024-01-01T00:00:01Z",
+	"id": "event-2",
+	"data": {"api": "DeleteBlob", "url": "https://account.blob.core.windows.net/container/first.txt"},
+	"dataVersion": "",
+	"metadataVersion": "1"
+}, {
+	"topic": "/subscriptions/id/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account",
+	"subject": "/blobServices/default/containers/container/blobs/second.txt",
+	"eventType": "Microsoft.Storage.BlobCreated",
+	"eventTime": "2024-01-01T00:00:02Z",
+	"id": "event-3",
+	"data": {"api": "PutBlob", "url": "https://account.blob.core.windows.net/container/second.txt"},
+	"dataVersion": "",
+	"metadataVersion": "1"
+}]`
+
+const blobCreatedCloudEvent = `{
+	"specversion": "1.0",
+	"id": "event-1",
+	"source": "/subscriptions/id/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account",
+	"subject": "/blobServices/default/containers/container/blobs/first.txt",
+	"type": "Microsoft.Storage.BlobCreated",
+	"time": "2024-01-01T00:00:00Z",
+	"datacontenttype": "application/json",
+	"data": {"api": "PutBlob", "url": "https://account.blob.core.windows.net/container/first.txt"}
+}`
+
+func TestHandler_SubscriptionValidation(t *testing.T) {
+	t.Run("accepted", func(t *testing.T) {
+		handler := webhook.NewHandler(nil)
+
+		resp := serve(handler, http.MethodPost, subscriptionValidationEvent, http.Header{"Aeg-Event-Type": []string{"SubscriptionValidation"}})
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+		require.JSONEq(t, `{"validationResponse":"512d38b6-c7b8-40c8-89fe-f46f9e9622b6"}`, resp.Body.String())
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		handler := webhook.NewHandler(&webhook.HandlerOptions{
+			SubscriptionValidation: func(ctx context.Context, event webhook.Event, data azsystemevents.SubscriptionValidationEventData) error {
+				require.Equal(t, "/subscriptions/xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx", event.Source)
+				require.Equal(t, "https://rp-eastus2.eventgrid.azure.net:553/eventsubscriptions/estest/validate", *data.ValidationURL)
+				return errors.New("unknown topic")
+			},
+		})
+
+		resp := serve(handler, http.MethodPost, subscriptionValidationEvent, nil)
+		require.Equal(t, http.StatusForbidden, resp.Code)
+		require.Contains(t, resp.Body.String(), "unknown topic")
+	})
+}
+
+func TestHandler_AbuseProtection(t *testing.T) {
+	handler := webhook.NewHandler(&webhook.HandlerOptions{
+		AllowedOrigins: []string{"eventgrid.azure.net"},
+	})
+
+	resp := serve(handler, http.MethodOptions, "", http.Header{
+		"Webhook-Request-Origin": []string{"eventgrid.azure.net"},
+		"Webhook-Request-Rate":   []string{"120"},
+	})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "eventgrid.azure.net", resp.Header().Get("WebHook-Allowed-Origin"))
+	require.Equal(t, "*", resp.Header().Get("WebHook-Allowed-Rate"))
+
+	resp = serve(handler, http.MethodOptions, "", http.Header{"Webhook-Request-Origin": []string{"example.com"}})
+	require.Equal(t, http.StatusForbidden, resp.Code)
+	require.Empty(t, resp.Header().Get("WebHook-Allowed-Origin"))
+
+	resp = serve(handler, http.MethodOptions, "", nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// all origins are allowed by default
+	resp = serve(webhook.NewHandler(nil), http.MethodOptions, "", http.Header{"Webhook-Request-Origin": []string{"example.com"}})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "example.com", resp.Header().Get("WebHook-Allowed-Origin"))
+	require.Empty(t, resp.Header().Get("WebHook-Allowed-Rate"))
+}
+
+func TestHandler_EventGridSchema(t *testing.T) {
+	var urls []string
+	var unhandled []string
+
+	handler := webhook.NewHandler(&webhook.HandlerOptions{
+		UnhandledEvent: func(ctx context.Context, event webhook.Event) error {
+			unhandled = append(unhandled, event.Type)
+			return nil
+		},
+	})
+
+	webhook.HandleEvent(handler, azsystemevents.TypeStorageBlobCreated, func(ctx context.Context, event webhook.Event, data azsystemevents.StorageBlobCreatedEventData) error {
+		require.Equal(t, webhook.SchemaEventGrid, event.Schema)
+		require.NotNil(t, event.EventGridEvent)
+		require.Nil(t, event.CloudEvent)
+		require.Equal(t, "/subscriptions/id/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account", event.Source)
+		require.Equal(t, "PutBlob", *data.API)
+
+		urls = append(urls, *data.URL)
+		return nil
+	})
+
+	resp := serve(handler, http.MethodPost, blobCreatedEventGridEvents, http.Header{"Aeg-Event-Type": []string{"Notification"}})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, []string{
+		"https://account.blob.core.windows.net/container/first.txt",
+		"https://account.blob.core.windows.net/container/second.txt",
+	}, urls)
+	require.Equal(t, []string{azsystemevents.TypeStorageBlobDeleted}, unhandled)
+}
+
+func TestHandler_CloudEventsSchema(t *testing.T) {
+	var events []webhook.Event
+
+	handler := webhook.NewHandler(nil)
+
+	webhook.HandleEvent(handler, azsystemevents.TypeStorageBlobCreated, func(ctx context.Context, event webhook.Event, data azsystemevents.StorageBlobCreatedEventData) error {
+		require.Equal(t, "https://account.blob.core.windows.net/container/first.txt", *data.URL)
+		events = append(events, event)
+		return nil
+	})
+
+	// a single event, in structured mode
+	resp := serve(handler, http.MethodPost, blobCreatedCloudEvent, http.Header{"Content-Type": []string{"application/cloudevents+json"}})
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// a batch
+	resp = serve(handler, http.MethodPost, "["+blobCreatedCloudEvent+","+blobCreatedCloudEvent+"]", http.Header{"Content-Type": []string{"application/cloudevents-batch+json"}})
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	require.Len(t, events, 3)
+
+	for _, event := range events {
+		require.Equal(t, webhook.SchemaCloudEvents, event.Schema)
+		require.NotNil(t, event.CloudEvent)
+		require.Nil(t, event.EventGridEvent)
+		require.Equal(t, "event-1", event.ID)
+		require.Equal(t, "/blobServices/default/containers/container/blobs/first.txt", event.Subject)
+		require.Equal(t, 2024, event.Time.Year())
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	handler := webhook.NewHandler(&webhook.HandlerOptions{MaxRequestBodyBytes: 4096})
+
+	var calls int
+
+	handler.Handle(azsystemevents.TypeStorageBlobCreated, func(ctx context.Context, event webhook.Event) error {
+		calls++
+		return errors.New("database is down")
+	})
+
+	// handler errors are retried by Event Grid
+	resp := serve(handler, http.MethodPost, blobCreatedEventGridEvents, nil)
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.Contains(t, resp.Body.String(), "database is down")
+	require.Equal(t, 1, calls, "the remaining events aren't dispatched")
+
+	// data that can't be decoded isn't retried
+	webhook.HandleEvent(handler, azsystemevents.TypeStorageBlobCreated, func(ctx context.Context, event webhook.Event, data azsystemevents.StorageBlobCreatedEventData) error {
+		return nil
+	})
+
+	resp = serve(handler, http.MethodPost, strings.Replace(blobCreatedCloudEvent, `{"api": "PutBlob"`, `{"api": 1`, 1), nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "failed to decode data for event event-1")
+
+	resp = serve(handler, http.MethodPost, "not json", nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = serve(handler, http.MethodPost, `[{"specversion": "1.0"}]`, nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = serve(handler, http.MethodPost, `[{"subject": "no id"}]`, nil)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = serve(handler, http.MethodPost, "["+strings.Repeat(blobCreatedCloudEvent+",", 20)+blobCreatedCloudEvent+"]", nil)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+
+	resp = serve(handler, http.MethodGet, "", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	require.Equal(t, "OPTIONS, POST", resp.Header().Get("Allow"))
+}
+
+func TestHandler_RawData(t *testing.T) {
+	handler := webhook.NewHandler(nil)
+
+	var data map[string]any
+
+	handler.Handle("Contoso.Items.ItemReceived", func(ctx context.Context, event webhook.Event) error {
+		return json.Unmarshal(event.Data, &data)
+	})
+
+	resp := serve(handler, http.MethodPost, `[{
+		"specversion": "1.0",
+		"id": "custom",
+		"source": "/contoso/items",
+		"type": "Contoso.Items.ItemReceived",
+		"data_base64": "eyJpdGVtU2t1IjoiTGFyZ2UgTWVhdCBQaXp6YSJ9"
+	}]`, nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, map[string]any{"itemSku": "Large Meat Pizza"}, data)
+}
+
+func serve(handler http.Handler, method string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "https://example.com/api/events", strings.NewReader(body))
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}